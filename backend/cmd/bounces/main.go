@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"email_campaign/internal/bounce"
+	"email_campaign/internal/config"
+	"email_campaign/internal/database/mysql"
+	"email_campaign/internal/logger"
+	"email_campaign/internal/repository"
+	"email_campaign/internal/service"
+	"email_campaign/internal/tracking"
+)
+
+func main() {
+	maildir := flag.String("maildir", "", "maildir to poll for bounce and complaint reports")
+	poll := flag.Duration("poll", 0, "maildir poll interval (default 30s)")
+	smtpAddr := flag.String("smtp", "", "address for the built-in SMTP receiver, e.g. :2525")
+	hostname := flag.String("hostname", "localhost", "hostname announced by the SMTP receiver")
+	flag.Parse()
+
+	if *maildir == "" && *smtpAddr == "" {
+		log.Fatal("nothing to do: set -maildir and/or -smtp")
+	}
+
+	cfg := config.Load()
+
+	if err := logger.Init("app.log"); err != nil {
+		log.Printf("Failed to initialize logger: %v", err)
+	}
+
+	db, err := mysql.New(cfg)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+	defer db.Close()
+
+	verp, err := bounce.VERPFromEnv(cfg.JWTSecret)
+	if err != nil {
+		log.Fatalf("Invalid VERP configuration: %v", err)
+	}
+
+	campaignSvc := service.NewCampaignService(repository.NewCampaignRepository(db.DB()), repository.NewBlockRepository(db.DB()), repository.NewCustomFieldRepository(db.DB()), tracking.SignerFromEnv(cfg.JWTSecret), verp)
+	bounceSvc := service.NewBounceService(campaignSvc, verp)
+
+	var sources []bounce.Source
+	if *maildir != "" {
+		sources = append(sources, bounce.NewMaildirSource(*maildir, *poll))
+	}
+	if *smtpAddr != "" {
+		sources = append(sources, bounce.NewSMTPSource(*smtpAddr, *hostname))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		wg.Add(1)
+		go func(src bounce.Source) {
+			defer wg.Done()
+			if err := src.Run(ctx, bounceSvc.HandleMessage); err != nil {
+				log.Printf("bounce source stopped: %v", err)
+				stop()
+			}
+		}(src)
+	}
+
+	log.Printf("Bounce processor started")
+	wg.Wait()
+	log.Println("Bounce processor exiting")
+}
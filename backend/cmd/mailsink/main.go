@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"email_campaign/internal/mailsink"
+)
+
+func main() {
+	smtpAddr := flag.String("smtp", "127.0.0.1:1025", "SMTP listen address")
+	httpAddr := flag.String("http", "127.0.0.1:8025", "HTTP API listen address")
+	dir := flag.String("dir", "", "store messages as .eml files in this directory instead of memory")
+	max := flag.Int("max", 1000, "messages kept by the in-memory store (0 for no limit)")
+	hostname := flag.String("hostname", "mailsink.local", "hostname announced over SMTP")
+	flag.Parse()
+
+	var store mailsink.Store
+	if *dir != "" {
+		var err error
+		store, err = mailsink.NewDiskStore(*dir)
+		if err != nil {
+			log.Fatalf("Could not open message directory: %v", err)
+		}
+	} else {
+		store = mailsink.NewMemoryStore(*max)
+	}
+
+	sink := mailsink.New(store, *hostname)
+	if err := sink.Listen(*smtpAddr, *httpAddr); err != nil {
+		log.Fatalf("listen: %s\n", err)
+	}
+
+	log.Printf("Mail sink accepting SMTP on %s, API on %s", sink.SMTPAddr(), sink.URL())
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sink.Shutdown(ctx); err != nil {
+		log.Printf("Mail sink forced to shutdown: %v", err)
+	}
+}
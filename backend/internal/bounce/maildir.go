@@ -0,0 +1,102 @@
+package bounce
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"email_campaign/internal/logger"
+)
+
+// maxMessageSize bounds how much of a maildir file is read.
+const maxMessageSize = 25 << 20
+
+// MaildirSource polls the new/ folder of a maildir, such as the one an MTA
+// delivers the return-path mailbox into. Handled messages are moved to cur/
+// with the Seen flag; failed ones stay in new/ and are retried next poll.
+type MaildirSource struct {
+	Dir      string
+	Interval time.Duration
+}
+
+func NewMaildirSource(dir string, interval time.Duration) *MaildirSource {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &MaildirSource{Dir: dir, Interval: interval}
+}
+
+func (m *MaildirSource) Run(ctx context.Context, handle Handler) error {
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(m.Dir, sub), 0o700); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.scan(ctx, handle); err != nil {
+			logger.Error("Failed to scan maildir", map[string]interface{}{"dir": m.Dir, "error": err.Error()})
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *MaildirSource) scan(ctx context.Context, handle Handler) error {
+	newDir := filepath.Join(m.Dir, "new")
+	entries, err := os.ReadDir(newDir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		path := filepath.Join(newDir, name)
+		data, err := readFile(path)
+		if err != nil {
+			logger.Error("Failed to read maildir message", map[string]interface{}{"file": path, "error": err.Error()})
+			continue
+		}
+
+		if err := handle(&Message{Data: data}); err != nil {
+			logger.Error("Failed to process bounce message, will retry", map[string]interface{}{"file": path, "error": err.Error()})
+			continue
+		}
+
+		base, _, _ := strings.Cut(name, ":")
+		if err := os.Rename(path, filepath.Join(m.Dir, "cur", base+":2,S")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, maxMessageSize))
+}
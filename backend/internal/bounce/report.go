@@ -0,0 +1,311 @@
+// Package bounce turns delivery status notifications (RFC 3464) and abuse
+// feedback reports (RFC 5965) that arrive at the return path into the same
+// normalized events the provider webhooks produce.
+package bounce
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"email_campaign/internal/types"
+)
+
+const (
+	ProviderDSN = "dsn"
+	ProviderARF = "arf"
+)
+
+// maxPartSize bounds how much of any report part we read.
+const maxPartSize = 1 << 20
+
+// ErrNotReport is returned for messages that are not a multipart/report
+// carrying delivery-status or feedback-report data, such as auto-replies.
+var ErrNotReport = errors.New("message is not a delivery or feedback report")
+
+// Report is a parsed DSN or ARF message.
+type Report struct {
+	// Kind is ProviderDSN or ProviderARF.
+	Kind string
+	// Addressees are the addresses the report itself was delivered to, taken
+	// from Delivered-To, X-Original-To and To. With VERP one of them is the
+	// encoded return path.
+	Addressees []string
+	// OriginalMessageID and OriginalReturnPath come from the returned
+	// message or its headers, when the reporting MTA included them.
+	OriginalMessageID  string
+	OriginalReturnPath string
+	Events             []types.DeliveryEvent
+}
+
+// Parse reads a raw RFC 5322 message and extracts its report.
+func Parse(raw []byte) (*Report, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || params["boundary"] == "" {
+		return nil, ErrNotReport
+	}
+
+	report := &Report{}
+	for _, h := range []string{"Delivered-To", "X-Original-To", "To"} {
+		for _, v := range msg.Header[textproto.CanonicalMIMEHeaderKey(h)] {
+			report.Addressees = append(report.Addressees, addressList(v)...)
+		}
+	}
+
+	var statusFields []textproto.MIMEHeader
+	var feedback textproto.MIMEHeader
+	var original textproto.MIMEHeader
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid report: %w", err)
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		body, err := readPart(part)
+		if err != nil {
+			return nil, err
+		}
+
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status":
+			statusFields = parseFieldGroups(body)
+		case "message/feedback-report":
+			if groups := parseFieldGroups(body); len(groups) > 0 {
+				feedback = groups[0]
+			}
+		case "message/rfc822", "message/global", "text/rfc822-headers", "message/rfc822-headers", "message/global-headers":
+			original = readHeaders(body)
+		}
+	}
+
+	if original != nil {
+		report.OriginalMessageID = strings.TrimSpace(original.Get("Message-Id"))
+		report.OriginalReturnPath = strings.Trim(strings.TrimSpace(original.Get("Return-Path")), "<>")
+	}
+
+	reportDate, _ := mail.ParseDate(msg.Header.Get("Date"))
+
+	switch params["report-type"] {
+	case "delivery-status":
+		if statusFields == nil {
+			return nil, ErrNotReport
+		}
+		report.Kind = ProviderDSN
+		report.Events = dsnEvents(statusFields, report.OriginalMessageID, reportDate)
+	case "feedback-report":
+		if feedback == nil {
+			return nil, ErrNotReport
+		}
+		report.Kind = ProviderARF
+		if from := strings.Trim(strings.TrimSpace(feedback.Get("Original-Mail-From")), "<>"); from != "" && report.OriginalReturnPath == "" {
+			report.OriginalReturnPath = from
+		}
+		if ev, ok := arfEvent(feedback, original, report.OriginalMessageID, reportDate); ok {
+			report.Events = append(report.Events, ev)
+		}
+	default:
+		return nil, ErrNotReport
+	}
+	return report, nil
+}
+
+// dsnEvents maps the per-recipient blocks of a delivery-status part. The
+// per-message block that precedes them is only used for the arrival date.
+func dsnEvents(groups []textproto.MIMEHeader, messageID string, reportDate time.Time) []types.DeliveryEvent {
+	arrival := reportDate
+
+	var events []types.DeliveryEvent
+	for _, fields := range groups {
+		if fields.Get("Final-Recipient") == "" && fields.Get("Original-Recipient") == "" {
+			if t, err := mail.ParseDate(fields.Get("Arrival-Date")); err == nil {
+				arrival = t
+			}
+			continue
+		}
+
+		email := addressField(fields.Get("Original-Recipient"))
+		if email == "" {
+			email = addressField(fields.Get("Final-Recipient"))
+		}
+		if email == "" {
+			continue
+		}
+
+		ev := types.DeliveryEvent{
+			Provider:  ProviderDSN,
+			Email:     email,
+			MessageID: messageID,
+			Timestamp: arrival,
+			Raw:       fieldsJSON(fields),
+		}
+		if t, err := mail.ParseDate(fields.Get("Last-Attempt-Date")); err == nil {
+			ev.Timestamp = t
+		}
+
+		status := strings.TrimSpace(fields.Get("Status"))
+		switch strings.ToLower(strings.TrimSpace(fields.Get("Action"))) {
+		case "failed":
+			ev.Type = types.DeliveryEventBounce
+			ev.BounceType = types.BounceTypeHard
+			if strings.HasPrefix(status, "4") {
+				// A transient failure the MTA gave up retrying.
+				ev.BounceType = types.BounceTypeSoft
+			}
+			ev.Reason = diagnostic(fields.Get("Diagnostic-Code"), status)
+		case "delivered", "relayed", "expanded":
+			ev.Type = types.DeliveryEventDelivery
+		default:
+			// "delayed" only says the MTA is still retrying.
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func arfEvent(feedback, original textproto.MIMEHeader, messageID string, reportDate time.Time) (types.DeliveryEvent, bool) {
+	switch strings.ToLower(strings.TrimSpace(feedback.Get("Feedback-Type"))) {
+	case "abuse", "fraud", "other":
+	default:
+		// not-spam, virus and auth-failure reports are not complaints
+		// about the recipient receiving our mail.
+		return types.DeliveryEvent{}, false
+	}
+
+	email := addressField(feedback.Get("Original-Rcpt-To"))
+	if email == "" && original != nil {
+		if list := addressList(original.Get("To")); len(list) > 0 {
+			email = list[0]
+		}
+	}
+
+	ts, err := mail.ParseDate(feedback.Get("Arrival-Date"))
+	if err != nil {
+		ts = reportDate
+	}
+
+	return types.DeliveryEvent{
+		Provider:  ProviderARF,
+		Type:      types.DeliveryEventComplaint,
+		Email:     email,
+		MessageID: messageID,
+		Reason:    strings.TrimSpace(feedback.Get("Feedback-Type")),
+		Timestamp: ts,
+		Raw:       fieldsJSON(feedback),
+	}, true
+}
+
+func readPart(part *multipart.Part) ([]byte, error) {
+	var r io.Reader = io.LimitReader(part, maxPartSize)
+	if strings.EqualFold(strings.TrimSpace(part.Header.Get("Content-Transfer-Encoding")), "base64") {
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading report part: %w", err)
+	}
+	return body, nil
+}
+
+// parseFieldGroups splits a delivery-status or feedback-report body into its
+// blank-line separated header blocks.
+func parseFieldGroups(body []byte) []textproto.MIMEHeader {
+	normalized := strings.ReplaceAll(string(body), "\r\n", "\n")
+
+	var groups []textproto.MIMEHeader
+	for _, block := range strings.Split(normalized, "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		if h := readHeaders([]byte(strings.TrimLeft(block, "\n") + "\n\n")); len(h) > 0 {
+			groups = append(groups, h)
+		}
+	}
+	return groups
+}
+
+// readHeaders parses the header section at the start of data, tolerating a
+// missing body.
+func readHeaders(data []byte) textproto.MIMEHeader {
+	if !bytes.Contains(data, []byte("\n\n")) && !bytes.Contains(data, []byte("\r\n\r\n")) {
+		data = append(data, "\r\n\r\n"...)
+	}
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(data)))
+	h, err := tp.ReadMIMEHeader()
+	if err != nil && len(h) == 0 {
+		return nil
+	}
+	return h
+}
+
+// addressField strips the address-type prefix from fields such as
+// "Final-Recipient: rfc822; jane@example.com".
+func addressField(v string) string {
+	v = strings.TrimSpace(v)
+	if typ, addr, ok := strings.Cut(v, ";"); ok {
+		if !strings.EqualFold(strings.TrimSpace(typ), "rfc822") {
+			return ""
+		}
+		v = addr
+	}
+	return strings.ToLower(strings.Trim(strings.TrimSpace(v), "<>"))
+}
+
+func addressList(v string) []string {
+	list, err := mail.ParseAddressList(v)
+	if err != nil {
+		if addr := strings.Trim(strings.TrimSpace(v), "<>"); strings.Contains(addr, "@") {
+			return []string{addr}
+		}
+		return nil
+	}
+	out := make([]string, 0, len(list))
+	for _, a := range list {
+		out = append(out, a.Address)
+	}
+	return out
+}
+
+func diagnostic(code, status string) string {
+	code = strings.Join(strings.Fields(code), " ")
+	if typ, text, ok := strings.Cut(code, ";"); ok && !strings.Contains(typ, " ") {
+		code = strings.TrimSpace(text)
+	}
+	if code == "" {
+		return status
+	}
+	return code
+}
+
+func fieldsJSON(h textproto.MIMEHeader) json.RawMessage {
+	flat := make(map[string]string, len(h))
+	for k, v := range h {
+		flat[k] = strings.Join(v, ", ")
+	}
+	data, err := json.Marshal(flat)
+	if err != nil {
+		return nil
+	}
+	return data
+}
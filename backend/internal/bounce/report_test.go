@@ -0,0 +1,143 @@
+package bounce
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"email_campaign/internal/types"
+)
+
+func loadReport(t *testing.T, name string, verp *VERP) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("reading fixture %s: %v", name, err)
+	}
+	if verp != nil {
+		data = bytes.ReplaceAll(data, []byte("bounces+1234-TAG@mail.acme.test"), []byte(verp.Address(1234)))
+	}
+	return data
+}
+
+func testVERP(t *testing.T) *VERP {
+	t.Helper()
+	v, err := NewVERP("bounces@mail.acme.test", []byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestParsePostfixDSN(t *testing.T) {
+	verp := testVERP(t)
+	report, err := Parse(loadReport(t, "postfix_dsn.eml", verp))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if report.Kind != ProviderDSN {
+		t.Errorf("kind = %q, want %q", report.Kind, ProviderDSN)
+	}
+	if report.OriginalMessageID != "<42.7.1736673260@acme.test>" {
+		t.Errorf("original message id = %q", report.OriginalMessageID)
+	}
+	if id, ok := verp.Parse(report.OriginalReturnPath); !ok || id != 1234 {
+		t.Errorf("original return path %q decoded to %d, %v", report.OriginalReturnPath, id, ok)
+	}
+
+	// The delayed recipient is still being retried and must not count.
+	if len(report.Events) != 1 {
+		t.Fatalf("got %d events, want 1", len(report.Events))
+	}
+	ev := report.Events[0]
+	if ev.Type != types.DeliveryEventBounce || ev.BounceType != types.BounceTypeHard {
+		t.Errorf("got %s/%s, want bounce/hard", ev.Type, ev.BounceType)
+	}
+	if ev.Email != "jane@example.com" {
+		t.Errorf("email = %q", ev.Email)
+	}
+	if want := "550 5.1.1 <jane@example.com>: Recipient address rejected: User unknown in virtual mailbox table"; ev.Reason != want {
+		t.Errorf("reason = %q, want %q", ev.Reason, want)
+	}
+	if ev.Timestamp.IsZero() {
+		t.Error("timestamp not set")
+	}
+}
+
+func TestParseBase64SoftDSN(t *testing.T) {
+	report, err := Parse(loadReport(t, "exchange_soft_dsn.eml", nil))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(report.Events) != 1 {
+		t.Fatalf("got %d events, want 1", len(report.Events))
+	}
+	ev := report.Events[0]
+	if ev.BounceType != types.BounceTypeSoft || ev.Email != "carol@example.com" {
+		t.Errorf("got %s for %s, want soft for carol@example.com", ev.BounceType, ev.Email)
+	}
+	if ev.MessageID != "<42.9.1736673260@acme.test>" {
+		t.Errorf("message id = %q", ev.MessageID)
+	}
+	if ev.Reason != "452 4.2.2 Mailbox full" {
+		t.Errorf("reason = %q", ev.Reason)
+	}
+}
+
+func TestParseARFComplaint(t *testing.T) {
+	verp := testVERP(t)
+	report, err := Parse(loadReport(t, "arf_complaint.eml", verp))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if report.Kind != ProviderARF {
+		t.Errorf("kind = %q, want %q", report.Kind, ProviderARF)
+	}
+	if id, ok := verp.Parse(report.OriginalReturnPath); !ok || id != 1234 {
+		t.Errorf("original mail from %q decoded to %d, %v", report.OriginalReturnPath, id, ok)
+	}
+	if len(report.Events) != 1 {
+		t.Fatalf("got %d events, want 1", len(report.Events))
+	}
+	ev := report.Events[0]
+	if ev.Type != types.DeliveryEventComplaint || ev.Email != "dave@example.com" {
+		t.Errorf("got %s for %s, want complaint for dave@example.com", ev.Type, ev.Email)
+	}
+	if ev.MessageID != "<42.10.1736673260@acme.test>" {
+		t.Errorf("message id = %q", ev.MessageID)
+	}
+}
+
+func TestParseRejectsPlainMessages(t *testing.T) {
+	msg := []byte("From: jane@example.com\r\nSubject: Out of office\r\nContent-Type: text/plain\r\n\r\nBack on Monday.\r\n")
+	if _, err := Parse(msg); !errors.Is(err, ErrNotReport) {
+		t.Errorf("got %v, want ErrNotReport", err)
+	}
+}
+
+func TestVERPRoundTrip(t *testing.T) {
+	v := testVERP(t)
+
+	addr := v.Address(987654321)
+	id, ok := v.Parse("<" + addr + ">")
+	if !ok || id != 987654321 {
+		t.Fatalf("Parse(%q) = %d, %v", addr, id, ok)
+	}
+
+	other, _ := NewVERP("bounces@mail.acme.test", []byte("another-secret"))
+	if _, ok := other.Parse(addr); ok {
+		t.Error("address verified under a different secret")
+	}
+	for _, bad := range []string{
+		"bounces+987654322-" + addr[len("bounces+987654321-"):],
+		"bounces@mail.acme.test",
+		"jane@example.com",
+	} {
+		if _, ok := v.Parse(bad); ok {
+			t.Errorf("Parse(%q) unexpectedly succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package bounce
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"email_campaign/internal/smtpd"
+)
+
+// SMTPSource receives reports directly over SMTP, for setups where the MX
+// for the return-path domain points at this service.
+type SMTPSource struct {
+	server *smtpd.Server
+}
+
+func NewSMTPSource(addr, hostname string) *SMTPSource {
+	return &SMTPSource{server: &smtpd.Server{Addr: addr, Hostname: hostname}}
+}
+
+func (s *SMTPSource) Run(ctx context.Context, handle Handler) error {
+	s.server.Handler = func(env *smtpd.Envelope) error {
+		if err := handle(&Message{Recipients: env.To, Data: env.Data}); err != nil {
+			return fmt.Errorf("%w: %v", smtpd.ErrTemporary, err)
+		}
+		return nil
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.server.ListenAndServe() }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s.server.Shutdown(shutdownCtx)
+	if err := <-errCh; err != nil && err != net.ErrClosed {
+		return err
+	}
+	return nil
+}
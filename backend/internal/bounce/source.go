@@ -0,0 +1,41 @@
+package bounce
+
+import (
+	"context"
+	"os"
+)
+
+// Message is one inbound message handed over by a Source.
+type Message struct {
+	// Recipients are the envelope recipients when the source knows them, as
+	// the SMTP receiver does. Mailbox sources leave it empty and the
+	// delivery headers are used instead.
+	Recipients []string
+	Data       []byte
+}
+
+// Handler processes one message. Returning an error asks the source to keep
+// the message and offer it again later.
+type Handler func(msg *Message) error
+
+// Source feeds inbound messages to a Handler until ctx is cancelled. Maildir
+// and SMTP sources are built in; an IMAP mailbox or a provider's inbound
+// parse API plugs in by implementing Run.
+type Source interface {
+	Run(ctx context.Context, handle Handler) error
+}
+
+// VERPFromEnv builds the VERP encoder from BOUNCE_RETURN_PATH and
+// BOUNCE_SECRET. It returns nil when no return path is configured, in which
+// case reports can only be matched by Message-ID.
+func VERPFromEnv(fallbackSecret string) (*VERP, error) {
+	returnPath := os.Getenv("BOUNCE_RETURN_PATH")
+	if returnPath == "" {
+		return nil, nil
+	}
+	secret := os.Getenv("BOUNCE_SECRET")
+	if secret == "" {
+		secret = "verp:" + fallbackSecret
+	}
+	return NewVERP(returnPath, []byte(secret))
+}
@@ -0,0 +1,72 @@
+package bounce
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// verpTagLen is the number of hex characters of the HMAC kept in the
+// address. It only has to stop people from guessing recipient IDs.
+const verpTagLen = 10
+
+// VERP encodes a campaign recipient ID into the envelope sender, so a bounce
+// that reaches the return path identifies the exact send even when the
+// remote MTA strips the original headers.
+//
+// With a return path of bounces@mail.example.com the recipient 1234 is sent
+// with MAIL FROM:<bounces+1234-1f0c9e2ab4@mail.example.com>.
+type VERP struct {
+	local  string
+	domain string
+	secret []byte
+}
+
+func NewVERP(returnPath string, secret []byte) (*VERP, error) {
+	local, domain, ok := strings.Cut(returnPath, "@")
+	if !ok || local == "" || domain == "" || strings.Contains(local, "+") {
+		return nil, errors.New("return path must look like bounces@example.com")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("verp secret is required")
+	}
+	return &VERP{local: local, domain: strings.ToLower(domain), secret: secret}, nil
+}
+
+// Address returns the envelope sender to use for a recipient.
+func (v *VERP) Address(recipientID uint64) string {
+	id := strconv.FormatUint(recipientID, 10)
+	return v.local + "+" + id + "-" + v.tag(id) + "@" + v.domain
+}
+
+// Parse returns the recipient ID encoded in addr. It reports false for
+// addresses that are not ours or whose tag does not verify.
+func (v *VERP) Parse(addr string) (uint64, bool) {
+	addr = strings.Trim(strings.TrimSpace(addr), "<>")
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok || !strings.EqualFold(domain, v.domain) {
+		return 0, false
+	}
+	base, ext, ok := strings.Cut(local, "+")
+	if !ok || !strings.EqualFold(base, v.local) {
+		return 0, false
+	}
+	id, tag, ok := strings.Cut(ext, "-")
+	if !ok || !hmac.Equal([]byte(strings.ToLower(tag)), []byte(v.tag(id))) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+func (v *VERP) tag(id string) string {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))[:verpTagLen]
+}
@@ -0,0 +1,284 @@
+// Package bundle reads and writes portable template bundles: a zip with
+// the template's settings in template.json, its MJML or HTML and text in
+// files of their own, and the images it uses under assets/.
+//
+// Content refers to bundled images by relative path, such as
+// "assets/hero.png#600", where the fragment names the variant the
+// template used. Importing uploads the images again and swaps in their
+// new URLs.
+package bundle
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Format is the bundle layout version written by this package.
+const Format = 1
+
+const (
+	ManifestFile = "template.json"
+	AssetDir     = "assets"
+
+	// MaxContentSize bounds template.json and each content file.
+	MaxContentSize = 5 << 20
+	// MaxAssetSize bounds each image, matching the upload limit.
+	MaxAssetSize = 10 << 20
+	MaxAssets    = 50
+)
+
+var (
+	ErrInvalid     = errors.New("invalid template bundle")
+	ErrUnsupported = errors.New("template bundle was made by a newer version")
+)
+
+// Manifest is template.json. Content and Text name the files holding the
+// template's MJML or HTML and its text part.
+type Manifest struct {
+	Format      int      `json:"format"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Subject     string   `json:"subject"`
+	Type        string   `json:"type"`
+	Content     string   `json:"content"`
+	Text        string   `json:"text,omitempty"`
+	Locales     []Locale `json:"locales,omitempty"`
+	Blocks      []Block  `json:"blocks,omitempty"`
+	Assets      []Asset  `json:"assets,omitempty"`
+}
+
+// Locale is a translation, kept inline as translations are small.
+type Locale struct {
+	Locale      string `json:"locale"`
+	Subject     string `json:"subject,omitempty"`
+	MJMLContent string `json:"mjml_content,omitempty"`
+	HTMLContent string `json:"html_content,omitempty"`
+	TextContent string `json:"text_content,omitempty"`
+}
+
+// Block is a content block the template includes, directly or not.
+type Block struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type"`
+	Content     string `json:"content"`
+}
+
+// Asset is an image file. Filename is the name it had in the library.
+type Asset struct {
+	Path     string `json:"path"`
+	Filename string `json:"filename"`
+}
+
+// Bundle is a loaded bundle. Files holds the asset data by path.
+type Bundle struct {
+	Manifest
+	Body  string
+	Text  string
+	Files map[string][]byte
+}
+
+// ContentFile is the conventional file name for a template's content.
+func ContentFile(typ string) string {
+	if typ == "mjml" {
+		return "template.mjml"
+	}
+	return "template.html"
+}
+
+// Write stores b as a zip.
+func Write(w io.Writer, b *Bundle) error {
+	m := b.Manifest
+	m.Format = Format
+	if m.Content == "" {
+		m.Content = ContentFile(m.Type)
+	}
+	if m.Text == "" && b.Text != "" {
+		m.Text = "template.txt"
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	if err := add(zw, ManifestFile, manifest, zip.Deflate); err != nil {
+		return err
+	}
+	if err := add(zw, m.Content, []byte(b.Body), zip.Deflate); err != nil {
+		return err
+	}
+	if m.Text != "" {
+		if err := add(zw, m.Text, []byte(b.Text), zip.Deflate); err != nil {
+			return err
+		}
+	}
+	for _, a := range m.Assets {
+		// Images are compressed already.
+		if err := add(zw, a.Path, b.Files[a.Path], zip.Store); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func add(zw *zip.Writer, name string, data []byte, method uint16) error {
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+
+// Open reads a zipped bundle.
+func Open(r io.ReaderAt, size int64) (*Bundle, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return Load(zr)
+}
+
+// Load reads a bundle laid out in fsys, which may be an opened zip or a
+// directory.
+func Load(fsys fs.FS) (*Bundle, error) {
+	data, err := readFile(fsys, ManifestFile, MaxContentSize)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{Files: map[string][]byte{}}
+	if err := json.Unmarshal(data, &b.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalid, ManifestFile, err)
+	}
+	m := &b.Manifest
+	if m.Format > Format {
+		return nil, ErrUnsupported
+	}
+	if m.Type != "mjml" && m.Type != "html" {
+		return nil, fmt.Errorf("%w: type must be mjml or html", ErrInvalid)
+	}
+	if strings.TrimSpace(m.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if m.Content == "" {
+		m.Content = ContentFile(m.Type)
+	}
+	if data, err = readFile(fsys, m.Content, MaxContentSize); err != nil {
+		return nil, err
+	}
+	b.Body = string(data)
+	if m.Text != "" {
+		if data, err = readFile(fsys, m.Text, MaxContentSize); err != nil {
+			return nil, err
+		}
+		b.Text = string(data)
+	}
+
+	if len(m.Assets) > MaxAssets {
+		return nil, fmt.Errorf("%w: more than %d assets", ErrInvalid, MaxAssets)
+	}
+	for _, a := range m.Assets {
+		if !assetPath.MatchString(a.Path) {
+			return nil, fmt.Errorf("%w: asset path %q", ErrInvalid, a.Path)
+		}
+		if b.Files[a.Path] != nil {
+			return nil, fmt.Errorf("%w: asset %s is listed twice", ErrInvalid, a.Path)
+		}
+		if b.Files[a.Path], err = readFile(fsys, a.Path, MaxAssetSize); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// readFile reads name, trusting only what is actually read for its size
+// as zip headers can claim anything.
+func readFile(fsys fs.FS, name string, limit int64) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, fmt.Errorf("%w: file name %q", ErrInvalid, name)
+	}
+	f, err := fsys.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s is missing", ErrInvalid, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalid, name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: %s is larger than %dMB", ErrInvalid, name, limit>>20)
+	}
+	return data, nil
+}
+
+var (
+	assetPath = regexp.MustCompile(`^assets/[A-Za-z0-9][A-Za-z0-9._-]{0,199}$`)
+	// assetRef is a reference in content: the asset path, with an
+	// optional variant, after a quote, bracket, space or equals sign.
+	assetRef = regexp.MustCompile(`(^|["'(\s=])(assets/[A-Za-z0-9][A-Za-z0-9._-]*)(?:#([A-Za-z0-9]+))?`)
+)
+
+// AssetPath returns a path under assets/ for filename that is not in use.
+func AssetPath(filename string, used map[string]bool) string {
+	ext := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(path.Ext(filename)))
+	stem := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ' || r == '.':
+			return '-'
+		}
+		return -1
+	}, strings.TrimSuffix(filename, path.Ext(filename)))
+	stem = strings.Trim(stem, "-_")
+	if stem == "" {
+		stem = "image"
+	}
+	if len(stem) > 100 {
+		stem = stem[:100]
+	}
+	p := AssetDir + "/" + stem + ext
+	for n := 2; used[p]; n++ {
+		p = fmt.Sprintf("%s/%s-%d%s", AssetDir, stem, n, ext)
+	}
+	used[p] = true
+	return p
+}
+
+// Ref is how content refers to a variant of the asset at p.
+func Ref(p, variant string) string {
+	if variant == "" {
+		return p
+	}
+	return p + "#" + variant
+}
+
+// Resolve replaces asset references in content with what url returns for
+// them. References url does not know are left alone.
+func Resolve(content string, url func(path, variant string) (string, bool)) string {
+	return assetRef.ReplaceAllStringFunc(content, func(m string) string {
+		sub := assetRef.FindStringSubmatch(m)
+		u, ok := url(sub[2], sub[3])
+		if !ok {
+			return m
+		}
+		return sub[1] + u
+	})
+}
@@ -0,0 +1,128 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func sample() *Bundle {
+	return &Bundle{
+		Manifest: Manifest{
+			Name:    "Spring news",
+			Subject: "Hello {{ contact.first_name }}",
+			Type:    "mjml",
+			Locales: []Locale{{Locale: "es", Subject: "Hola", MJMLContent: "<mjml><mj-body></mj-body></mjml>"}},
+			Blocks:  []Block{{Name: "footer", Type: "mjml", Content: "<mj-text>Bye</mj-text>"}},
+			Assets:  []Asset{{Path: "assets/hero.png", Filename: "hero.png"}},
+		},
+		Body:  `<mjml><mj-body><mj-image src="assets/hero.png#600" /></mj-body></mjml>`,
+		Text:  "Spring is here",
+		Files: map[string][]byte{"assets/hero.png": {0x89, 'P', 'N', 'G'}},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, sample()); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sample()
+	if b.Format != Format || b.Content != "template.mjml" || b.Text != want.Text || b.Body != want.Body {
+		t.Errorf("bundle = %+v", b)
+	}
+	if len(b.Locales) != 1 || b.Locales[0].Subject != "Hola" || len(b.Blocks) != 1 || b.Blocks[0].Name != "footer" {
+		t.Errorf("locales %+v, blocks %+v", b.Locales, b.Blocks)
+	}
+	if !bytes.Equal(b.Files["assets/hero.png"], want.Files["assets/hero.png"]) {
+		t.Errorf("asset = %v", b.Files["assets/hero.png"])
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	manifest := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+	body := &fstest.MapFile{Data: []byte("<p>Hi</p>")}
+	for name, fsys := range map[string]fstest.MapFS{
+		"no manifest": {"template.html": body},
+		"bad type":    {ManifestFile: manifest(`{"name":"x","type":"pdf"}`), "template.html": body},
+		"no name":     {ManifestFile: manifest(`{"type":"html"}`), "template.html": body},
+		"no content":  {ManifestFile: manifest(`{"name":"x","type":"html"}`)},
+		"escape":      {ManifestFile: manifest(`{"name":"x","type":"html","content":"../etc/passwd"}`)},
+		"asset path":  {ManifestFile: manifest(`{"name":"x","type":"html","assets":[{"path":"template.html"}]}`), "template.html": body},
+		"missing asset": {
+			ManifestFile: manifest(`{"name":"x","type":"html","assets":[{"path":"assets/a.png"}]}`), "template.html": body,
+		},
+	} {
+		if _, err := Load(fsys); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+
+	newer := fstest.MapFS{ManifestFile: manifest(`{"format":99,"name":"x","type":"html"}`), "template.html": body}
+	if _, err := Load(newer); err != ErrUnsupported {
+		t.Errorf("newer format: err = %v", err)
+	}
+}
+
+func TestLoadChecksRealSize(t *testing.T) {
+	// The size a zip header claims is not trusted.
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add(zw, ManifestFile, []byte(`{"name":"x","type":"html"}`), zip.Deflate)
+	add(zw, "template.html", bytes.Repeat([]byte("a"), MaxContentSize+1), zip.Deflate)
+	zw.Close()
+	_, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestAssetPath(t *testing.T) {
+	used := map[string]bool{}
+	for _, tc := range []struct{ in, want string }{
+		{"hero.png", "assets/hero.png"},
+		{"hero.png", "assets/hero-2.png"},
+		{"Summer Sale (final).JPG", "assets/Summer-Sale-final.jpg"},
+		{"../../x.gif", "assets/x.gif"},
+		{"ünïcode.webp", "assets/ncode.webp"},
+		{"???.png", "assets/image.png"},
+	} {
+		if got := AssetPath(tc.in, used); got != tc.want {
+			t.Errorf("AssetPath(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+		if !assetPath.MatchString(tc.want) {
+			t.Errorf("%q would not load", tc.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	content := `<img src="assets/hero.png#600"><img src='assets/logo.png'>
+<mj-section background-url="assets/bg.jpg"></mj-section>
+<div style="background:url(assets/hero.png)"></div>
+See assets/hero.png and https://cdn.test/assets/hero.png and assets/other.png`
+	urls := map[string]string{
+		"assets/hero.png":     "https://new/hero-1200.png",
+		"assets/hero.png#600": "https://new/hero-600.png",
+		"assets/logo.png":     "https://new/logo.png",
+		"assets/bg.jpg":       "https://new/bg.jpg",
+	}
+	got := Resolve(content, func(p, variant string) (string, bool) {
+		u, ok := urls[Ref(p, variant)]
+		return u, ok
+	})
+	want := `<img src="https://new/hero-600.png"><img src='https://new/logo.png'>
+<mj-section background-url="https://new/bg.jpg"></mj-section>
+<div style="background:url(https://new/hero-1200.png)"></div>
+See https://new/hero-1200.png and https://cdn.test/assets/hero.png and assets/other.png`
+	if got != want {
+		t.Errorf("Resolve() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,276 @@
+// Package customfield checks contacts' custom field values against the
+// fields a user has defined, and converts them to the fields' types.
+package customfield
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"email_campaign/internal/types"
+)
+
+var (
+	ErrInvalidField = errors.New("invalid custom field")
+	ErrInvalidValue = errors.New("invalid custom field value")
+)
+
+// DateLayout is how date values are stored.
+const DateLayout = "2006-01-02"
+
+// MaxOptions is the most options an enum field can have.
+const MaxOptions = 100
+
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// ValidKey reports whether key can name a custom field. Keys are safe to
+// use in merge tags and JSON paths as they are.
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+// Check checks a field definition, filling in its defaults, and converts
+// its default value to the field's type.
+func Check(f *types.CustomField) error {
+	f.Key = strings.TrimSpace(f.Key)
+	if !ValidKey(f.Key) {
+		return fmt.Errorf("%w: keys are lowercase letters, digits and _, starting with a letter, up to 64 characters", ErrInvalidField)
+	}
+	if f.Label = strings.TrimSpace(f.Label); f.Label == "" {
+		f.Label = f.Key
+	}
+	if len(f.Label) > 255 {
+		return fmt.Errorf("%w: label is longer than 255 characters", ErrInvalidField)
+	}
+	if f.Type == "" {
+		f.Type = types.CustomFieldText
+	}
+	switch f.Type {
+	case types.CustomFieldText, types.CustomFieldNumber, types.CustomFieldDate, types.CustomFieldBool:
+		f.Options = nil
+	case types.CustomFieldEnum:
+		options := make([]string, 0, len(f.Options))
+		seen := map[string]bool{}
+		for _, o := range f.Options {
+			o = strings.TrimSpace(o)
+			if o == "" {
+				continue
+			}
+			if seen[strings.ToLower(o)] {
+				return fmt.Errorf("%w: option %q is listed twice", ErrInvalidField, o)
+			}
+			seen[strings.ToLower(o)] = true
+			options = append(options, o)
+		}
+		if len(options) == 0 {
+			return fmt.Errorf("%w: an enum field needs options", ErrInvalidField)
+		}
+		if len(options) > MaxOptions {
+			return fmt.Errorf("%w: an enum field has at most %d options", ErrInvalidField, MaxOptions)
+		}
+		f.Options = options
+	default:
+		return fmt.Errorf("%w: type must be text, number, date, bool or enum", ErrInvalidField)
+	}
+
+	if empty(f.Default) {
+		f.Default = nil
+		return nil
+	}
+	v, err := convert(f, f.Default)
+	if err != nil {
+		return fmt.Errorf("%w: the default %v", ErrInvalidField, err)
+	}
+	f.Default = v
+	return nil
+}
+
+// Schema is the custom fields a user has defined.
+type Schema struct {
+	fields []types.CustomField
+	// byKey finds fields by lower-cased key, so "Plan" is taken for
+	// "plan".
+	byKey map[string]*types.CustomField
+}
+
+func NewSchema(fields []types.CustomField) *Schema {
+	s := &Schema{fields: fields, byKey: make(map[string]*types.CustomField, len(fields))}
+	for i := range s.fields {
+		s.byKey[strings.ToLower(s.fields[i].Key)] = &s.fields[i]
+	}
+	return s
+}
+
+// Fields lists the schema's fields.
+func (s *Schema) Fields() []types.CustomField {
+	return s.fields
+}
+
+// Field finds a field by its key, or returns nil.
+func (s *Schema) Field(key string) *types.CustomField {
+	return s.byKey[strings.ToLower(key)]
+}
+
+// Fills reports whether Complete can change anything: whether a field is
+// required or has a default.
+func (s *Schema) Fills() bool {
+	for _, f := range s.fields {
+		if f.Required || f.Default != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Check checks the values of defined fields and converts them to the
+// fields' types, for values merged into a contact's existing ones. Keys
+// that differ from a field's only by case are renamed to it. Empty values
+// are dropped, except for required fields, where they are an error. Keys
+// no field defines are kept as they are.
+func (s *Schema) Check(values map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(values))
+	for _, key := range sortedKeys(values) {
+		v := values[key]
+		f := s.Field(key)
+		if f == nil {
+			out[key] = v
+			continue
+		}
+		if empty(v) {
+			if f.Required {
+				return nil, fmt.Errorf("%w: %s is required", ErrInvalidValue, f.Key)
+			}
+			continue
+		}
+		cv, err := convert(f, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %v", ErrInvalidValue, f.Key, err)
+		}
+		out[f.Key] = cv
+	}
+	return out, nil
+}
+
+// Complete is Check for a contact's whole set of values: fields without a
+// value take their default, and a required field without one is an
+// error.
+func (s *Schema) Complete(values map[string]interface{}) (map[string]interface{}, error) {
+	out, err := s.Check(values)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range s.fields {
+		if _, ok := out[f.Key]; ok {
+			continue
+		}
+		switch {
+		case f.Default != nil:
+			out[f.Key] = f.Default
+		case f.Required:
+			return nil, fmt.Errorf("%w: %s is required", ErrInvalidValue, f.Key)
+		}
+	}
+	return out, nil
+}
+
+// Typed is a contact's stored values as the merge language sees them:
+// defined fields in their type where the stored value converts, and
+// missing fields as their default.
+func (s *Schema) Typed(values map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(values)+len(s.fields))
+	for key, v := range values {
+		out[key] = v
+	}
+	for _, f := range s.fields {
+		v, ok := out[f.Key]
+		if !ok || empty(v) {
+			if f.Default != nil {
+				out[f.Key] = f.Default
+			}
+			continue
+		}
+		if cv, err := convert(&f, v); err == nil {
+			out[f.Key] = cv
+		}
+	}
+	return out
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func empty(v interface{}) bool {
+	s, ok := v.(string)
+	return v == nil || ok && strings.TrimSpace(s) == ""
+}
+
+var dateLayouts = []string{DateLayout, time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// convert converts a value to the field's type. Text is converted too,
+// since imported values are always text.
+func convert(f *types.CustomField, v interface{}) (interface{}, error) {
+	s, isText := v.(string)
+	if isText {
+		s = strings.TrimSpace(s)
+	}
+	switch f.Type {
+	case types.CustomFieldNumber:
+		n, ok := v.(float64)
+		if isText {
+			var err error
+			n, err = strconv.ParseFloat(s, 64)
+			ok = err == nil
+		}
+		if !ok || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, errors.New("must be a number")
+		}
+		return n, nil
+	case types.CustomFieldDate:
+		if isText {
+			for _, layout := range dateLayouts {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t.Format(DateLayout), nil
+				}
+			}
+		}
+		return nil, errors.New("must be a date, such as 2024-03-01")
+	case types.CustomFieldBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		switch strings.ToLower(s) {
+		case "1", "y", "yes", "true", "t", "on":
+			return true, nil
+		case "0", "n", "no", "false", "f", "off":
+			return false, nil
+		}
+		return nil, errors.New("must be true or false")
+	case types.CustomFieldEnum:
+		for _, o := range f.Options {
+			if isText && strings.EqualFold(s, o) {
+				return o, nil
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(f.Options, ", "))
+	}
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	}
+	return nil, errors.New("must be text")
+}
@@ -0,0 +1,109 @@
+package customfield
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"email_campaign/internal/types"
+)
+
+var fields = []types.CustomField{
+	{Key: "plan", Type: types.CustomFieldEnum, Options: []string{"Free", "Pro"}, Required: true, Default: "Free"},
+	{Key: "seats", Type: types.CustomFieldNumber},
+	{Key: "renews", Type: types.CustomFieldDate},
+	{Key: "vip", Type: types.CustomFieldBool, Required: true},
+	{Key: "notes", Type: types.CustomFieldText},
+}
+
+func TestCheck(t *testing.T) {
+	s := NewSchema(fields)
+	got, err := s.Check(map[string]interface{}{
+		"Plan":   "pro",
+		"seats":  " 12.5",
+		"renews": "2024-03-01T09:30:00Z",
+		"vip":    "yes",
+		"notes":  float64(7),
+		"source": "web",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"plan": "Pro", "seats": 12.5, "renews": "2024-03-01", "vip": true, "notes": "7", "source": "web",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check = %v", got)
+	}
+
+	for _, tt := range []struct {
+		values map[string]interface{}
+		reason string
+	}{
+		{map[string]interface{}{"plan": "Enterprise"}, "plan must be one of Free, Pro"},
+		{map[string]interface{}{"seats": "a dozen"}, "seats must be a number"},
+		{map[string]interface{}{"seats": true}, "seats must be a number"},
+		{map[string]interface{}{"renews": "next week"}, "renews must be a date"},
+		{map[string]interface{}{"vip": "maybe"}, "vip must be true or false"},
+		{map[string]interface{}{"notes": []interface{}{"a"}}, "notes must be text"},
+		{map[string]interface{}{"vip": ""}, "vip is required"},
+	} {
+		_, err := s.Check(tt.values)
+		if !errors.Is(err, ErrInvalidValue) || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("Check(%v) err = %v, want %q", tt.values, err, tt.reason)
+		}
+	}
+
+	got, err = s.Check(map[string]interface{}{"seats": "", "notes": nil})
+	if err != nil || len(got) != 0 {
+		t.Errorf("empty values: Check = %v, %v", got, err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := NewSchema(fields)
+	got, err := s.Complete(map[string]interface{}{"vip": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"plan": "Free", "vip": false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Complete = %v", got)
+	}
+	if _, err := s.Complete(nil); !errors.Is(err, ErrInvalidValue) || !strings.Contains(err.Error(), "vip is required") {
+		t.Errorf("missing required field: err = %v", err)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	s := NewSchema(fields)
+	got := s.Typed(map[string]interface{}{"seats": "3", "vip": "false", "renews": "soon", "plan": ""})
+	want := map[string]interface{}{"plan": "Free", "seats": float64(3), "vip": false, "renews": "soon"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Typed = %v", got)
+	}
+}
+
+func TestCheckField(t *testing.T) {
+	f := types.CustomField{Key: "plan", Type: types.CustomFieldEnum, Options: []string{" Free ", "", "Pro"}, Default: "pro"}
+	if err := Check(&f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Label != "plan" || !reflect.DeepEqual(f.Options, []string{"Free", "Pro"}) || f.Default != "Pro" {
+		t.Errorf("field = %+v", f)
+	}
+
+	for _, f := range []types.CustomField{
+		{Key: "Plan"},
+		{Key: "1st"},
+		{Key: "plan name"},
+		{Key: "plan", Type: "list"},
+		{Key: "plan", Type: types.CustomFieldEnum},
+		{Key: "plan", Type: types.CustomFieldEnum, Options: []string{"Pro", "pro"}},
+		{Key: "seats", Type: types.CustomFieldNumber, Default: "many"},
+	} {
+		if err := Check(&f); !errors.Is(err, ErrInvalidField) {
+			t.Errorf("Check(%+v) err = %v", f, err)
+		}
+	}
+}
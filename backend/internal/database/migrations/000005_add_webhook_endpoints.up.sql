@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    provider ENUM('ses', 'sendgrid', 'mailgun', 'postmark') NOT NULL,
+    token VARCHAR(64) NOT NULL,
+    signing_secret TEXT,
+    is_active BOOLEAN DEFAULT TRUE,
+    last_received_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    is_deleted BOOLEAN NOT NULL DEFAULT 0,
+    deleted_at TIMESTAMP NULL DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY unique_webhook_token (token),
+    INDEX idx_user_id (user_id),
+    INDEX idx_webhook_endpoints_is_deleted (is_deleted)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+ALTER TABLE campaign_recipients
+ADD COLUMN message_id VARCHAR(255) NULL AFTER contact_id,
+ADD INDEX idx_message_id (message_id);
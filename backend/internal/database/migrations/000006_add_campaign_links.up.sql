@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS campaign_links (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    campaign_id BIGINT UNSIGNED NOT NULL,
+    url VARCHAR(2000) NOT NULL,
+    url_hash CHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (campaign_id) REFERENCES campaigns(id) ON DELETE CASCADE,
+    UNIQUE KEY unique_campaign_url (campaign_id, url_hash)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+ALTER TABLE email_events
+ADD COLUMN campaign_link_id BIGINT UNSIGNED NULL AFTER campaign_recipient_id,
+ADD CONSTRAINT fk_email_events_link FOREIGN KEY (campaign_link_id) REFERENCES campaign_links(id) ON DELETE SET NULL;
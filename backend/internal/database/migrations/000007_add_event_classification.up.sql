@@ -0,0 +1,3 @@
+ALTER TABLE email_events
+ADD COLUMN classification ENUM('human', 'proxy', 'scanner') NULL AFTER event_type,
+ADD INDEX idx_recipient_event_time (campaign_recipient_id, event_type, created_at);
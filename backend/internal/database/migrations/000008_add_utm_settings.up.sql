@@ -0,0 +1,14 @@
+ALTER TABLE user_settings
+ADD COLUMN utm_enabled BOOLEAN DEFAULT FALSE,
+ADD COLUMN utm_source VARCHAR(255),
+ADD COLUMN utm_medium VARCHAR(255),
+ADD COLUMN utm_campaign VARCHAR(255),
+ADD COLUMN utm_content VARCHAR(255);
+
+-- NULL means the campaign inherits the user's default
+ALTER TABLE campaigns
+ADD COLUMN utm_enabled BOOLEAN NULL,
+ADD COLUMN utm_source VARCHAR(255) NULL,
+ADD COLUMN utm_medium VARCHAR(255) NULL,
+ADD COLUMN utm_campaign VARCHAR(255) NULL,
+ADD COLUMN utm_content VARCHAR(255) NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE email_events
+ADD COLUMN client VARCHAR(50) NULL AFTER user_agent,
+ADD COLUMN os VARCHAR(30) NULL AFTER client,
+ADD COLUMN device VARCHAR(20) NULL AFTER os,
+ADD COLUMN country CHAR(2) NULL AFTER device;
@@ -0,0 +1,5 @@
+ALTER TABLE user_settings
+ADD COLUMN archive_enabled BOOLEAN DEFAULT FALSE,
+ADD COLUMN archive_slug VARCHAR(64) NULL,
+ADD COLUMN archive_title VARCHAR(255),
+ADD UNIQUE KEY unique_archive_slug (archive_slug);
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS email_template_versions (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    template_id BIGINT UNSIGNED NOT NULL,
+    version INT UNSIGNED NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    subject VARCHAR(500) NOT NULL,
+    type ENUM('mjml', 'html') NOT NULL DEFAULT 'mjml',
+    mjml_content LONGTEXT,
+    html_content LONGTEXT NOT NULL,
+    text_content TEXT,
+    created_by BIGINT UNSIGNED NULL,
+    restored_from INT UNSIGNED NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (template_id) REFERENCES email_templates(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE KEY unique_template_version (template_id, version)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+ALTER TABLE email_templates
+ADD COLUMN current_version INT UNSIGNED NOT NULL DEFAULT 0 AFTER is_default;
+
+ALTER TABLE campaigns
+ADD COLUMN template_version INT UNSIGNED NULL AFTER template_id;
+
+INSERT INTO email_template_versions (template_id, version, name, subject, type, mjml_content, html_content, text_content, created_by, created_at)
+SELECT id, 1, name, subject, type, mjml_content, html_content, text_content, user_id, updated_at
+FROM email_templates;
+
+UPDATE email_templates SET current_version = 1, updated_at = updated_at;
+
+UPDATE campaigns c
+JOIN email_templates t ON c.template_id = t.id
+SET c.template_version = t.current_version;
@@ -0,0 +1,2 @@
+ALTER TABLE user_settings
+ADD COLUMN s3_endpoint VARCHAR(255) AFTER s3_region;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS content_blocks (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    description VARCHAR(255),
+    type ENUM('html', 'mjml') NOT NULL DEFAULT 'html',
+    content LONGTEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY unique_user_block_name (user_id, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- The blocks a campaign was sent with, so later edits only reach unsent campaigns
+CREATE TABLE IF NOT EXISTS campaign_blocks (
+    campaign_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    type ENUM('html', 'mjml') NOT NULL,
+    content LONGTEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (campaign_id, name),
+    FOREIGN KEY (campaign_id) REFERENCES campaigns(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,24 @@
+ALTER TABLE contacts
+ADD COLUMN locale VARCHAR(35) NULL AFTER company,
+ADD INDEX idx_contacts_locale (locale);
+
+ALTER TABLE user_settings
+ADD COLUMN default_locale VARCHAR(35) NOT NULL DEFAULT 'en';
+
+CREATE TABLE IF NOT EXISTS email_template_locales (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    template_id BIGINT UNSIGNED NOT NULL,
+    locale VARCHAR(35) NOT NULL,
+    subject VARCHAR(500) NOT NULL DEFAULT '',
+    mjml_content LONGTEXT,
+    html_content LONGTEXT NOT NULL,
+    text_content TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (template_id) REFERENCES email_templates(id) ON DELETE CASCADE,
+    UNIQUE KEY unique_template_locale (template_id, locale)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- The variant each recipient was served, for per-locale stats
+ALTER TABLE campaign_recipients
+ADD COLUMN locale VARCHAR(35) NULL AFTER contact_id;
@@ -0,0 +1,11 @@
+-- The latest lint of each template, for health badges
+CREATE TABLE IF NOT EXISTS template_lint_reports (
+    template_id BIGINT UNSIGNED PRIMARY KEY,
+    template_version INT UNSIGNED NOT NULL,
+    status ENUM('ok', 'warning', 'error') NOT NULL,
+    errors INT NOT NULL DEFAULT 0,
+    warnings INT NOT NULL DEFAULT 0,
+    report JSON NOT NULL,
+    checked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (template_id) REFERENCES email_templates(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
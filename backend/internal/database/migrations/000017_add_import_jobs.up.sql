@@ -0,0 +1,13 @@
+-- A run of an importer, with the summary it reported
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    source VARCHAR(32) NOT NULL,
+    status ENUM('running', 'completed', 'failed') NOT NULL DEFAULT 'running',
+    summary JSON,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_import_jobs_user (user_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,24 @@
+-- Contact imports run in the background: a job waits as queued until a
+-- worker claims it, and records how far it got so it can resume
+ALTER TABLE import_jobs
+MODIFY COLUMN status ENUM('queued', 'running', 'completed', 'failed') NOT NULL DEFAULT 'running',
+ADD COLUMN options JSON AFTER status,
+ADD COLUMN file_name VARCHAR(255) AFTER options,
+ADD COLUMN file_key VARCHAR(255) AFTER file_name,
+ADD COLUMN file_size BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER file_key,
+ADD COLUMN rows_done INT UNSIGNED NOT NULL DEFAULT 0 AFTER file_size,
+ADD COLUMN progress TINYINT UNSIGNED NOT NULL DEFAULT 0 AFTER rows_done,
+ADD COLUMN attempts TINYINT UNSIGNED NOT NULL DEFAULT 0 AFTER progress,
+ADD COLUMN updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP AFTER created_at,
+ADD INDEX idx_import_jobs_status (status, updated_at);
+
+-- Rows an import could not take, with the reason, kept for download
+CREATE TABLE IF NOT EXISTS import_rejects (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    job_id BIGINT UNSIGNED NOT NULL,
+    file_row INT UNSIGNED NOT NULL,
+    record JSON NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    FOREIGN KEY (job_id) REFERENCES import_jobs(id) ON DELETE CASCADE,
+    INDEX idx_import_rejects_job (job_id, file_row)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,16 @@
+-- The custom fields a user's contacts have, with the type their values take
+CREATE TABLE IF NOT EXISTS contact_custom_fields (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    field_key VARCHAR(64) NOT NULL,
+    label VARCHAR(255) NOT NULL,
+    type ENUM('text', 'number', 'date', 'bool', 'enum') NOT NULL DEFAULT 'text',
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    default_value JSON,
+    options JSON,
+    sort_order INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY unique_user_field_key (user_id, field_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
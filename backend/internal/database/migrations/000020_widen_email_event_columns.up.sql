@@ -0,0 +1,3 @@
+-- Tracked links are up to 2000 characters before UTM parameters are added.
+ALTER TABLE email_events
+MODIFY COLUMN clicked_url TEXT NULL;
@@ -0,0 +1,4 @@
+-- SES endpoints only accept notifications from the SNS topic they were
+-- created for
+ALTER TABLE webhook_endpoints
+ADD COLUMN topic_arn VARCHAR(256) NULL AFTER signing_secret;
@@ -0,0 +1,5 @@
+-- Provider delivery events are keyed so a webhook or bounce report that is
+-- delivered twice is recorded once. Opens and clicks leave it NULL.
+ALTER TABLE email_events
+ADD COLUMN delivery_key VARCHAR(64) NULL AFTER event_type,
+ADD UNIQUE KEY unique_delivery_event (campaign_recipient_id, delivery_key);
@@ -0,0 +1,226 @@
+// Package diff compares text line by line.
+package diff
+
+import (
+	"strings"
+
+	"email_campaign/internal/types"
+)
+
+// Context is the number of unchanged lines kept around each change.
+const Context = 3
+
+// maxEdits bounds the work done on very different inputs. Past it the
+// remaining lines are reported as replaced wholesale.
+const maxEdits = 2000
+
+const (
+	OpEqual  = "equal"
+	OpDelete = "delete"
+	OpInsert = "insert"
+)
+
+type edit struct {
+	op   string
+	a, b int // line indices in the old and new text
+}
+
+// Lines returns the hunks that turn a into b, or nil when they are equal.
+func Lines(a, b string) []types.DiffHunk {
+	if a == b {
+		return nil
+	}
+	al, bl := split(a), split(b)
+	return hunks(compare(al, bl), al, bl)
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// compare returns the edit script from a to b, trimming the common prefix
+// and suffix before running Myers' algorithm on what is left.
+func compare(a, b []string) []edit {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var edits []edit
+	for i := 0; i < pre; i++ {
+		edits = append(edits, edit{OpEqual, i, i})
+	}
+	for _, e := range myers(a[pre:len(a)-suf], b[pre:len(b)-suf]) {
+		edits = append(edits, edit{e.op, e.a + pre, e.b + pre})
+	}
+	for i := suf; i > 0; i-- {
+		edits = append(edits, edit{OpEqual, len(a) - i, len(b) - i})
+	}
+	return edits
+}
+
+// myers finds a shortest edit script. trace[d] holds the furthest x
+// reached on each diagonal k in [-d, d] after d edits.
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	var trace [][]int
+	prev := []int{0}
+	for d := 0; d <= n+m; d++ {
+		if d > maxEdits {
+			return replaceAll(n, m)
+		}
+		v := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && at(prev, d-1, k-1) < at(prev, d-1, k+1) {
+				x = at(prev, d-1, k+1)
+			} else {
+				x = at(prev, d-1, k-1) + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+d] = x
+			if x >= n && y >= m {
+				trace = append(trace, v)
+				return backtrack(trace, n, m)
+			}
+		}
+		trace = append(trace, v)
+		prev = v
+	}
+	return nil
+}
+
+// at reads diagonal k from the row written after d edits.
+func at(v []int, d, k int) int {
+	if d < 0 {
+		return 0
+	}
+	if k < -d || k > d {
+		return -1
+	}
+	return v[k+d]
+}
+
+func backtrack(trace [][]int, n, m int) []edit {
+	var rev []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		k := x - y
+		prev := trace[d-1]
+		down := k == -d || k != d && at(prev, d-1, k-1) < at(prev, d-1, k+1)
+		pk := k - 1
+		if down {
+			pk = k + 1
+		}
+		px := at(prev, d-1, pk)
+		py := px - pk
+
+		// Walk the snake back to where the edit landed.
+		sx, sy := px+1, py
+		if down {
+			sx, sy = px, py+1
+		}
+		for x > sx && y > sy {
+			x--
+			y--
+			rev = append(rev, edit{OpEqual, x, y})
+		}
+		if down {
+			rev = append(rev, edit{OpInsert, px, py})
+		} else {
+			rev = append(rev, edit{OpDelete, px, py})
+		}
+		x, y = px, py
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		rev = append(rev, edit{OpEqual, x, y})
+	}
+
+	edits := make([]edit, len(rev))
+	for i, e := range rev {
+		edits[len(rev)-1-i] = e
+	}
+	return edits
+}
+
+func replaceAll(n, m int) []edit {
+	edits := make([]edit, 0, n+m)
+	for i := 0; i < n; i++ {
+		edits = append(edits, edit{OpDelete, i, 0})
+	}
+	for j := 0; j < m; j++ {
+		edits = append(edits, edit{OpInsert, n, j})
+	}
+	return edits
+}
+
+// hunks groups the edits into hunks, merging changes that are close enough
+// for their context to touch.
+func hunks(edits []edit, a, b []string) []types.DiffHunk {
+	var out []types.DiffHunk
+	for i := 0; i < len(edits); {
+		if edits[i].op == OpEqual {
+			i++
+			continue
+		}
+		start := max(i-Context, 0)
+		end := i
+		for end < len(edits) {
+			if edits[end].op != OpEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == OpEqual {
+				run++
+			}
+			if run == len(edits) || run-end > 2*Context {
+				end = min(end+Context, run)
+				break
+			}
+			end = run
+		}
+
+		h := types.DiffHunk{OldStart: edits[start].a + 1, NewStart: edits[start].b + 1}
+		for _, e := range edits[start:end] {
+			line := types.DiffLine{Op: e.op}
+			switch e.op {
+			case OpEqual:
+				line.Text, line.OldLine, line.NewLine = a[e.a], e.a+1, e.b+1
+				h.OldLines++
+				h.NewLines++
+			case OpDelete:
+				line.Text, line.OldLine = a[e.a], e.a+1
+				h.OldLines++
+			case OpInsert:
+				line.Text, line.NewLine = b[e.b], e.b+1
+				h.NewLines++
+			}
+			h.Lines = append(h.Lines, line)
+		}
+		// As in unified diffs, an empty side starts at the line before.
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+		out = append(out, h)
+		i = end
+	}
+	return out
+}
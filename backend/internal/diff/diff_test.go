@@ -0,0 +1,121 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"email_campaign/internal/types"
+)
+
+// unified renders hunks in the familiar text form to keep cases readable.
+func unified(hunks []types.DiffHunk) string {
+	var b strings.Builder
+	for _, h := range hunks {
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		for _, l := range h.Lines {
+			prefix := map[string]string{OpEqual: " ", OpDelete: "-", OpInsert: "+"}[l.Op]
+			b.WriteString(prefix + l.Text + "\n")
+		}
+	}
+	return b.String()
+}
+
+func lines(n int, f func(i int) string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		b.WriteString(f(i) + "\n")
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"line endings", "a\r\nb\r\n", "a\nb", ""},
+		{"from empty", "", "a\nb\n", "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"to empty", "a\n", "", "@@ -1,1 +0,0 @@\n-a\n"},
+		{"replace", "a\nb\nc\n", "a\nx\nc\n", "@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"interleaved", "a\nb\nc\nd\n", "b\nx\nd\ny\n",
+			"@@ -1,4 +1,4 @@\n-a\n b\n-c\n+x\n d\n+y\n"},
+		{"context", lines(10, func(i int) string { return fmt.Sprint(i) }),
+			lines(10, func(i int) string {
+				if i == 5 {
+					return "five"
+				}
+				return fmt.Sprint(i)
+			}),
+			"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n"},
+		{"separate hunks", lines(20, func(i int) string { return fmt.Sprint(i) }),
+			lines(20, func(i int) string {
+				if i == 2 || i == 18 {
+					return "x"
+				}
+				return fmt.Sprint(i)
+			}),
+			"@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n 5\n" +
+				"@@ -15,6 +15,6 @@\n 15\n 16\n 17\n-18\n+x\n 19\n 20\n"},
+		{"merged hunks", lines(12, func(i int) string { return fmt.Sprint(i) }),
+			lines(12, func(i int) string {
+				if i == 3 || i == 9 {
+					return "x"
+				}
+				return fmt.Sprint(i)
+			}),
+			"@@ -1,12 +1,12 @@\n 1\n 2\n-3\n+x\n 4\n 5\n 6\n 7\n 8\n-9\n+x\n 10\n 11\n 12\n"},
+	}
+	for _, c := range cases {
+		if got := unified(Lines(c.a, c.b)); got != c.want {
+			t.Errorf("%s:\n got:\n%s\nwant:\n%s", c.name, got, c.want)
+		}
+	}
+}
+
+// TestLinesApply checks that applying the hunks to the old text gives the
+// new one, for inputs where the shortest script is not obvious.
+func TestLinesApply(t *testing.T) {
+	pairs := [][2]string{
+		{"a b c a b b a", "c b a b a c"},
+		{"x y z", "z y x"},
+		{"1 2 3 4 5 6 7 8 9 10 11 12 13 14", "1 2 x 4 5 6 7 8 9 10 11 y 13 14 15"},
+		{"a a a b", "b a a a"},
+	}
+	for _, p := range pairs {
+		a := strings.ReplaceAll(p[0], " ", "\n")
+		b := strings.ReplaceAll(p[1], " ", "\n")
+		if got := apply(a, Lines(a, b)); got != b {
+			t.Errorf("apply(%q): got %q, want %q", p[0], got, b)
+		}
+	}
+}
+
+func apply(a string, hunks []types.DiffHunk) string {
+	old := split(a)
+	var out []string
+	next := 0 // index of the next old line not yet copied
+	for _, h := range hunks {
+		start := h.OldStart - 1
+		if h.OldLines == 0 {
+			start = h.OldStart
+		}
+		out = append(out, old[next:start]...)
+		next = start
+		for _, l := range h.Lines {
+			switch l.Op {
+			case OpEqual:
+				out = append(out, old[next])
+				next++
+			case OpDelete:
+				next++
+			case OpInsert:
+				out = append(out, l.Text)
+			}
+		}
+	}
+	out = append(out, old[next:]...)
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,320 @@
+// Package exporter writes contacts as CSV, Excel or newline-delimited
+// JSON, a row at a time.
+package exporter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"email_campaign/internal/types"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type Format string
+
+const (
+	CSV    Format = "csv"
+	XLSX   Format = "xlsx"
+	NDJSON Format = "ndjson"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("format must be csv, xlsx or ndjson")
+	ErrUnknownColumn     = errors.New("unknown column")
+	ErrDuplicateColumn   = errors.New("column is listed twice")
+	ErrTooManyRows       = fmt.Errorf("xlsx files hold at most %d rows; export as csv or ndjson", excelize.TotalRows-1)
+)
+
+// ParseFormat reads a format name; empty means CSV.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return CSV, nil
+	case CSV, XLSX, NDJSON:
+		return f, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case NDJSON:
+		return "application/x-ndjson"
+	}
+	return "text/csv"
+}
+
+// The columns an export can have. Custom fields are exported one per
+// column as "custom.<key>", or all together as JSON in custom_fields.
+const (
+	ColumnID           = "id"
+	ColumnEmail        = "email"
+	ColumnFirstName    = "first_name"
+	ColumnLastName     = "last_name"
+	ColumnPhone        = "phone"
+	ColumnCompany      = "company"
+	ColumnLocale       = "locale"
+	ColumnIsSubscribed = "is_subscribed"
+	ColumnIsBounced    = "is_bounced"
+	ColumnTags         = "tags"
+	ColumnCustomFields = "custom_fields"
+	ColumnCreatedAt    = "created_at"
+	ColumnUpdatedAt    = "updated_at"
+
+	CustomPrefix = "custom."
+)
+
+var knownColumns = map[string]bool{
+	ColumnID: true, ColumnEmail: true, ColumnFirstName: true, ColumnLastName: true, ColumnPhone: true,
+	ColumnCompany: true, ColumnLocale: true, ColumnIsSubscribed: true, ColumnIsBounced: true, ColumnTags: true,
+	ColumnCustomFields: true, ColumnCreatedAt: true, ColumnUpdatedAt: true,
+}
+
+// DefaultColumns are exported when none are chosen.
+var DefaultColumns = []string{
+	ColumnEmail, ColumnFirstName, ColumnLastName, ColumnPhone, ColumnCompany, ColumnLocale,
+	ColumnIsSubscribed, ColumnIsBounced, ColumnTags, ColumnCreatedAt,
+}
+
+// CheckColumns checks that every column can be exported, once.
+func CheckColumns(columns []string) error {
+	seen := map[string]bool{}
+	for _, c := range columns {
+		if key, ok := strings.CutPrefix(c, CustomPrefix); !knownColumns[c] && (!ok || key == "") {
+			return fmt.Errorf("%w %q", ErrUnknownColumn, c)
+		}
+		if seen[c] {
+			return fmt.Errorf("%w: %q", ErrDuplicateColumn, c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// Writer writes contacts, each as a row of the writer's columns.
+type Writer interface {
+	Write(c *types.ContactExportRow) error
+	// Rows is the number of contacts written.
+	Rows() int
+	// Close writes whatever is buffered; the export is not complete
+	// until then.
+	Close() error
+	// Discard gives up on an export that failed part way.
+	Discard()
+}
+
+// NewWriter starts an export, writing the header row if the format has
+// one.
+func NewWriter(w io.Writer, f Format, columns []string) (Writer, error) {
+	if err := CheckColumns(columns); err != nil {
+		return nil, err
+	}
+	switch f {
+	case CSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw, columns: columns}, nil
+	case XLSX:
+		return newXLSXWriter(w, columns)
+	case NDJSON:
+		return &ndjsonWriter{w: bufio.NewWriter(w), columns: columns}, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// value is the contact's value for a column: a string, bool, number,
+// time, tag list or custom field value.
+func value(c *types.ContactExportRow, column string) interface{} {
+	switch column {
+	case ColumnID:
+		return c.ID
+	case ColumnEmail:
+		return c.Email
+	case ColumnFirstName:
+		return c.FirstName
+	case ColumnLastName:
+		return c.LastName
+	case ColumnPhone:
+		return c.Phone
+	case ColumnCompany:
+		return c.Company
+	case ColumnLocale:
+		return c.Locale
+	case ColumnIsSubscribed:
+		return c.IsSubscribed
+	case ColumnIsBounced:
+		return c.IsBounced
+	case ColumnTags:
+		if c.Tags == nil {
+			return []string{}
+		}
+		return c.Tags
+	case ColumnCustomFields:
+		if c.CustomFields == nil {
+			return map[string]interface{}{}
+		}
+		return c.CustomFields
+	case ColumnCreatedAt:
+		return c.CreatedAt.UTC()
+	case ColumnUpdatedAt:
+		return c.UpdatedAt.UTC()
+	}
+	return c.CustomFields[strings.TrimPrefix(column, CustomPrefix)]
+}
+
+// text is how a value reads in a cell. Tags are separated by commas, as
+// the importer reads them; lists and objects are written as JSON.
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, ", ")
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+	record  []string
+	rows    int
+}
+
+func (w *csvWriter) Write(c *types.ContactExportRow) error {
+	w.record = w.record[:0]
+	for _, col := range w.columns {
+		w.record = append(w.record, text(value(c, col)))
+	}
+	w.rows++
+	return w.w.Write(w.record)
+}
+
+func (w *csvWriter) Rows() int { return w.rows }
+func (w *csvWriter) Discard()  {}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// xlsxWriter streams rows into a single sheet. Rows beyond the writer's
+// memory buffer are kept in a temporary file until Close writes the
+// workbook out.
+type xlsxWriter struct {
+	out     io.Writer
+	f       *excelize.File
+	sw      *excelize.StreamWriter
+	columns []string
+	cells   []interface{}
+	rows    int
+}
+
+func newXLSXWriter(out io.Writer, columns []string) (Writer, error) {
+	f := excelize.NewFile()
+	sw, err := f.NewStreamWriter(f.GetSheetName(0))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	header := make([]interface{}, len(columns))
+	for i, c := range columns {
+		header[i] = c
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &xlsxWriter{out: out, f: f, sw: sw, columns: columns}, nil
+}
+
+func (w *xlsxWriter) Write(c *types.ContactExportRow) error {
+	if w.rows+1 >= excelize.TotalRows {
+		return ErrTooManyRows
+	}
+	w.cells = w.cells[:0]
+	for _, col := range w.columns {
+		switch v := value(c, col).(type) {
+		case string, bool, uint64, float64, time.Time, nil:
+			w.cells = append(w.cells, v)
+		default:
+			w.cells = append(w.cells, text(v))
+		}
+	}
+	w.rows++
+	cell, err := excelize.CoordinatesToCellName(1, w.rows+1)
+	if err != nil {
+		return err
+	}
+	return w.sw.SetRow(cell, w.cells)
+}
+
+func (w *xlsxWriter) Rows() int { return w.rows }
+func (w *xlsxWriter) Discard()  { w.f.Close() }
+
+func (w *xlsxWriter) Close() error {
+	defer w.f.Close()
+	if err := w.sw.Flush(); err != nil {
+		return err
+	}
+	return w.f.Write(w.out)
+}
+
+// ndjsonWriter writes each contact as a JSON object on its own line, with
+// the columns as keys in order. Tags are a list and custom_fields an
+// object.
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	columns []string
+	rows    int
+}
+
+func (w *ndjsonWriter) Write(c *types.ContactExportRow) error {
+	w.w.WriteByte('{')
+	for i, col := range w.columns {
+		if i > 0 {
+			w.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(col)
+		w.w.Write(key)
+		w.w.WriteByte(':')
+		v, err := json.Marshal(value(c, col))
+		if err != nil {
+			return err
+		}
+		w.w.Write(v)
+	}
+	w.rows++
+	_, err := w.w.WriteString("}\n")
+	return err
+}
+
+func (w *ndjsonWriter) Rows() int { return w.rows }
+func (w *ndjsonWriter) Discard()  {}
+
+func (w *ndjsonWriter) Close() error {
+	return w.w.Flush()
+}
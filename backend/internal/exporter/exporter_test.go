@@ -0,0 +1,123 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"email_campaign/internal/types"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var contacts = []types.ContactExportRow{
+	{
+		ID:           7,
+		Email:        "ann@example.com",
+		FirstName:    "Ann",
+		IsSubscribed: true,
+		CustomFields: map[string]interface{}{"plan": "pro", "seats": float64(12)},
+		Tags:         []string{"VIP", "Customer"},
+		CreatedAt:    time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+	},
+	{ID: 9, Email: "bob@example.com", LastName: "Ray, Jr."},
+}
+
+func export(t *testing.T, f Format, columns []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, f, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range contacts {
+		if err := w.Write(&contacts[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Rows() != len(contacts) {
+		t.Errorf("rows = %d", w.Rows())
+	}
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	got := export(t, CSV, []string{"email", "last_name", "is_subscribed", "tags", "custom.plan", "custom.seats", "created_at"})
+	want := "email,last_name,is_subscribed,tags,custom.plan,custom.seats,created_at\n" +
+		"ann@example.com,,true,\"VIP, Customer\",pro,12,2024-03-01T09:30:00Z\n" +
+		"bob@example.com,\"Ray, Jr.\",false,,,,0001-01-01T00:00:00Z\n"
+	if string(got) != want {
+		t.Errorf("csv =\n%s", got)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	got := export(t, NDJSON, []string{"id", "email", "tags", "custom_fields"})
+	lines := strings.Split(strings.TrimSuffix(string(got), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %q", lines)
+	}
+	if want := `{"id":7,"email":"ann@example.com","tags":["VIP","Customer"],"custom_fields":{"plan":"pro","seats":12}}`; lines[0] != want {
+		t.Errorf("line 1 = %s", lines[0])
+	}
+	var second map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(second["tags"], []interface{}{}) || !reflect.DeepEqual(second["custom_fields"], map[string]interface{}{}) {
+		t.Errorf("line 2 = %s", lines[1])
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	got := export(t, XLSX, []string{"email", "is_subscribed", "tags", "custom.seats"})
+	f, err := excelize.OpenReader(bytes.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows(f.GetSheetName(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"email", "is_subscribed", "tags", "custom.seats"},
+		{"ann@example.com", "TRUE", "VIP, Customer", "12"},
+		{"bob@example.com", "FALSE"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q", rows)
+	}
+}
+
+func TestCheckColumns(t *testing.T) {
+	if err := CheckColumns(append(DefaultColumns, "custom.plan", "custom_fields")); err != nil {
+		t.Error(err)
+	}
+	for _, columns := range [][]string{{"email", "password"}, {"custom."}} {
+		if err := CheckColumns(columns); !errors.Is(err, ErrUnknownColumn) {
+			t.Errorf("CheckColumns(%q) = %v", columns, err)
+		}
+	}
+	if err := CheckColumns([]string{"email", "email"}); !errors.Is(err, ErrDuplicateColumn) {
+		t.Errorf("duplicate column: err = %v", err)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for s, want := range map[string]Format{"": CSV, "CSV": CSV, "xlsx": XLSX, "ndjson": NDJSON} {
+		if f, err := ParseFormat(s); f != want || err != nil {
+			t.Errorf("ParseFormat(%q) = %q, %v", s, f, err)
+		}
+	}
+	if _, err := ParseFormat("xls"); err != ErrUnsupportedFormat {
+		t.Errorf("ParseFormat(xls) err = %v", err)
+	}
+}
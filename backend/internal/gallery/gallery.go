@@ -0,0 +1,60 @@
+// Package gallery holds the starter templates users can clone into their
+// library. Each starter is a template bundle laid out under starters/.
+package gallery
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"sort"
+
+	"email_campaign/internal/bundle"
+	"email_campaign/internal/types"
+)
+
+//go:embed starters
+var starters embed.FS
+
+var ErrNotFound = errors.New("starter template not found")
+
+// List describes every starter, by slug.
+func List() ([]types.TemplateStarter, error) {
+	entries, err := fs.ReadDir(starters, "starters")
+	if err != nil {
+		return nil, err
+	}
+	list := []types.TemplateStarter{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		b, err := Open(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, types.TemplateStarter{
+			Slug:        e.Name(),
+			Name:        b.Name,
+			Description: b.Description,
+			Subject:     b.Subject,
+			Type:        b.Type,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Slug < list[j].Slug })
+	return list, nil
+}
+
+// Open loads the starter with the slug.
+func Open(slug string) (*bundle.Bundle, error) {
+	if !fs.ValidPath(slug) || slug == "." {
+		return nil, ErrNotFound
+	}
+	dir, err := fs.Sub(starters, "starters/"+slug)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.Stat(dir, bundle.ManifestFile); err != nil {
+		return nil, ErrNotFound
+	}
+	return bundle.Load(dir)
+}
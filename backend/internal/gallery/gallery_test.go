@@ -0,0 +1,54 @@
+package gallery
+
+import (
+	"testing"
+
+	"email_campaign/internal/lint"
+	"email_campaign/internal/merge"
+	"email_campaign/internal/mjml"
+)
+
+func TestStarters(t *testing.T) {
+	list, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) < 3 {
+		t.Fatalf("starters = %+v", list)
+	}
+	for _, s := range list {
+		b, err := Open(s.Slug)
+		if err != nil {
+			t.Fatalf("%s: %v", s.Slug, err)
+		}
+		if s.Name == "" || s.Description == "" || s.Type != "mjml" {
+			t.Errorf("%s: %+v", s.Slug, s)
+		}
+		if err := merge.Validate(b.Subject); err != nil {
+			t.Errorf("%s subject: %v", s.Slug, err)
+		}
+		if err := merge.Validate(b.Body); err != nil {
+			t.Errorf("%s merge tags: %v", s.Slug, err)
+		}
+		html, err := mjml.Compile(b.Body)
+		if err != nil {
+			t.Fatalf("%s: %v", s.Slug, err)
+		}
+		// Starters are meant as good examples.
+		r, err := lint.Check(html, lint.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Status != lint.StatusOK {
+			t.Errorf("%s lint: %+v", s.Slug, r.Findings)
+		}
+	}
+}
+
+func TestOpenUnknown(t *testing.T) {
+	for _, slug := range []string{"nope", "", ".", "../gallery", "starters"} {
+		if _, err := Open(slug); err != ErrNotFound {
+			t.Errorf("Open(%q) = %v", slug, err)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+// Package geoip looks up the country of an IP address in a local MaxMind
+// DB (.mmdb) file, such as GeoLite2-Country or DB-IP's free country database.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+
+	"email_campaign/internal/logger"
+)
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+var ErrInvalidDatabase = errors.New("invalid MaxMind DB file")
+
+// Reader holds an entire MMDB file in memory. It is safe for concurrent
+// use.
+type Reader struct {
+	buf        []byte
+	data       []byte // data section
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+	ipv4Depth  int
+}
+
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(buf)
+}
+
+// FromEnv opens the database at GEOIP_DB_PATH. It returns nil, and logs
+// why, when the variable is unset or the file cannot be read; lookups on a
+// nil Reader simply find nothing.
+func FromEnv() *Reader {
+	path := os.Getenv("GEOIP_DB_PATH")
+	if path == "" {
+		return nil
+	}
+	r, err := Open(path)
+	if err != nil {
+		logger.Error("Failed to open GeoIP database", map[string]interface{}{"path": path, "error": err.Error()})
+		return nil
+	}
+	return r
+}
+
+func FromBytes(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	metaStart := i + len(metadataMarker)
+	meta := decoder{buf: buf[metaStart:]}
+	v, _, err := meta.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalidDatabase, err)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+
+	r := &Reader{
+		buf:        buf,
+		nodeCount:  uint(asUint(m["node_count"])),
+		recordSize: uint(asUint(m["record_size"])),
+		ipVersion:  uint(asUint(m["ip_version"])),
+	}
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: record size %d", ErrInvalidDatabase, r.recordSize)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, ErrInvalidDatabase
+	}
+	r.data = buf[treeSize+16 : i]
+
+	// IPv4 addresses live under ::/96 in an IPv6 tree.
+	if r.ipVersion == 6 {
+		node := uint(0)
+		depth := 0
+		for ; depth < 96 && node < r.nodeCount; depth++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start, r.ipv4Depth = node, depth
+	}
+	return r, nil
+}
+
+// Lookup returns the data record for ip, or nil when there is none.
+func (r *Reader) Lookup(ip net.IP) (interface{}, error) {
+	if r == nil || ip == nil {
+		return nil, nil
+	}
+
+	node := uint(0)
+	bits := 128
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		bits = 32
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+			if r.ipv4Depth < 96 {
+				// The tree ended before reaching the IPv4 subtree.
+				return r.resolve(node)
+			}
+		}
+	} else if r.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := (ip[i>>3] >> (7 - uint(i&7))) & 1
+		node = r.record(node, uint(bit))
+	}
+	return r.resolve(node)
+}
+
+// Country returns the ISO 3166-1 alpha-2 code for the address, preferring
+// the country where it is located over the one it is registered in.
+func (r *Reader) Country(ip net.IP) string {
+	v, err := r.Lookup(ip)
+	if err != nil || v == nil {
+		return ""
+	}
+	m, _ := v.(map[string]interface{})
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := m[key].(map[string]interface{}); ok {
+			if code, ok := c["iso_code"].(string); ok && code != "" {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+func (r *Reader) resolve(node uint) (interface{}, error) {
+	if node <= r.nodeCount {
+		// node == nodeCount means "no data"; less means the address ran out
+		// of bits inside the tree.
+		return nil, nil
+	}
+	offset := node - r.nodeCount - 16
+	d := decoder{buf: r.data}
+	v, _, err := d.decode(offset)
+	return v, err
+}
+
+func (r *Reader) record(node uint, bit uint) uint {
+	b := r.buf
+	switch r.recordSize {
+	case 24:
+		o := node*6 + bit*3
+		return uint(b[o])<<16 | uint(b[o+1])<<8 | uint(b[o+2])
+	case 28:
+		o := node * 7
+		if bit == 0 {
+			return uint(b[o+3]&0xF0)<<20 | uint(b[o])<<16 | uint(b[o+1])<<8 | uint(b[o+2])
+		}
+		return uint(b[o+3]&0x0F)<<24 | uint(b[o+4])<<16 | uint(b[o+5])<<8 | uint(b[o+6])
+	default:
+		o := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(b[o:]))
+	}
+}
+
+// decoder reads the MaxMind DB data format. Offsets and pointers are
+// relative to buf.
+type decoder struct {
+	buf []byte
+}
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+var errTruncated = errors.New("truncated data")
+
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	return d.decodeDepth(offset, 0)
+}
+
+func (d *decoder) decodeDepth(offset uint, depth int) (interface{}, uint, error) {
+	if depth > 64 {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+
+	if typ == typePointer {
+		ptr, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decodeDepth(ptr, depth+1)
+		return v, next, err
+	}
+
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errTruncated
+		}
+		typ = 7 + uint(d.buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return nil, 0, errTruncated
+		}
+		extra := uint(0)
+		for _, b := range d.buf[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + extra
+		case 2:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decodeDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			v, next, err := d.decodeDepth(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decodeDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+	raw := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case typeString:
+		return string(raw), next, nil
+	case typeBytes:
+		return append([]byte(nil), raw...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("bad double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("bad float size")
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(raw)), next, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128:
+		if size > 8 {
+			// uint128 values beyond 64 bits are not needed for lookups.
+			raw = raw[size-8:]
+		}
+		v := uint64(0)
+		for _, b := range raw {
+			v = v<<8 | uint64(b)
+		}
+		return v, next, nil
+	case typeInt32:
+		v := uint32(0)
+		for _, b := range raw {
+			v = v<<8 | uint32(b)
+		}
+		return int32(v), next, nil
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d", typ)
+}
+
+func (d *decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	ss := uint(ctrl>>3) & 0x3
+	n := ss + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errTruncated
+	}
+	p := uint(0)
+	if ss < 3 {
+		p = uint(ctrl & 0x7)
+	}
+	for _, b := range d.buf[offset : offset+n] {
+		p = p<<8 | uint(b)
+	}
+	switch ss {
+	case 1:
+		p += 2048
+	case 2:
+		p += 526336
+	}
+	return p, offset + n, nil
+}
+
+func asUint(v interface{}) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int32:
+		return uint64(n)
+	}
+	return 0
+}
@@ -0,0 +1,152 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// testDB builds a small MMDB file with record size 24.
+type testDB struct {
+	ipVersion int
+	nodes     [][2]int // >= 0: child node; < 0: -(data offset + 1); unset: 0 below the root is never a child
+	data      bytes.Buffer
+}
+
+func newTestDB(ipVersion int) *testDB {
+	return &testDB{ipVersion: ipVersion, nodes: [][2]int{{0, 0}}}
+}
+
+func (db *testDB) insert(cidr string, dataOffset int) {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	ip := n.IP
+	ones, _ := n.Mask.Size()
+	if db.ipVersion == 6 && len(ip) == net.IPv4len {
+		// IPv4 lives under ::/96 in an IPv6 tree.
+		ip = append(make(net.IP, 12), ip...)
+		ones += 96
+	}
+
+	node := 0
+	for i := 0; i < ones; i++ {
+		bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+		if i == ones-1 {
+			db.nodes[node][bit] = -(dataOffset + 1)
+			return
+		}
+		next := db.nodes[node][bit]
+		if next <= 0 {
+			db.nodes = append(db.nodes, [2]int{0, 0})
+			next = len(db.nodes) - 1
+			db.nodes[node][bit] = next
+		}
+		node = next
+	}
+}
+
+func (db *testDB) bytes() []byte {
+	count := len(db.nodes)
+	var out bytes.Buffer
+	for _, n := range db.nodes {
+		for _, rec := range n {
+			v := count // empty
+			switch {
+			case rec < 0:
+				v = count + 16 + (-rec - 1)
+			case rec > 0:
+				v = rec
+			}
+			out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(db.data.Bytes())
+	out.Write(metadataMarker)
+
+	writeMap(&out, 3)
+	writeString(&out, "node_count")
+	out.WriteByte(6<<5 | 4)
+	binary.Write(&out, binary.BigEndian, uint32(count))
+	writeString(&out, "record_size")
+	out.Write([]byte{5<<5 | 2, 0, 24})
+	writeString(&out, "ip_version")
+	out.Write([]byte{5<<5 | 2, 0, byte(db.ipVersion)})
+	return out.Bytes()
+}
+
+func writeMap(b *bytes.Buffer, size int) { b.WriteByte(byte(7<<5 | size)) }
+
+func writeString(b *bytes.Buffer, s string) {
+	b.WriteByte(byte(2<<5 | len(s)))
+	b.WriteString(s)
+}
+
+// countryRecord appends {"country": {"iso_code": code}} and returns its
+// offset and the offset of the inner map.
+func (db *testDB) countryRecord(code string) (int, int) {
+	start := db.data.Len()
+	writeMap(&db.data, 1)
+	writeString(&db.data, "country")
+	inner := db.data.Len()
+	writeMap(&db.data, 1)
+	writeString(&db.data, "iso_code")
+	writeString(&db.data, code)
+	return start, inner
+}
+
+func TestCountryLookup(t *testing.T) {
+	for _, version := range []int{4, 6} {
+		db := newTestDB(version)
+		de, deInner := db.countryRecord("DE")
+		us, _ := db.countryRecord("US")
+
+		// A record that only points at DE's country map.
+		registered := db.data.Len()
+		writeMap(&db.data, 1)
+		writeString(&db.data, "registered_country")
+		db.data.Write([]byte{1 << 5, byte(deInner)})
+
+		db.insert("81.0.0.0/8", de)
+		db.insert("8.8.8.0/24", us)
+		db.insert("100.64.0.0/10", registered)
+		if version == 6 {
+			db.insert("2001:db8::/32", us)
+		}
+
+		r, err := FromBytes(db.bytes())
+		if err != nil {
+			t.Fatalf("v%d: FromBytes: %v", version, err)
+		}
+
+		cases := map[string]string{
+			"81.2.69.160": "DE",
+			"8.8.8.8":     "US",
+			"8.8.9.1":     "",
+			"100.70.1.1":  "DE",
+			"10.0.0.1":    "",
+		}
+		if version == 6 {
+			cases["2001:db8::1"] = "US"
+			cases["2001:db9::1"] = ""
+		}
+		for ip, want := range cases {
+			if got := r.Country(net.ParseIP(ip)); got != want {
+				t.Errorf("v%d: Country(%s) = %q, want %q", version, ip, got, want)
+			}
+		}
+	}
+}
+
+func TestNilReader(t *testing.T) {
+	var r *Reader
+	if got := r.Country(net.ParseIP("8.8.8.8")); got != "" {
+		t.Errorf("got %q", got)
+	}
+	if _, err := FromBytes([]byte("not a database")); err == nil {
+		t.Error("expected error for garbage input")
+	}
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"email_campaign/internal/service"
+	"email_campaign/internal/types"
 	"email_campaign/internal/utils"
 )
 
@@ -111,3 +115,85 @@ func (h *AnalyticsHandler) GetQuickStats(w http.ResponseWriter, r *http.Request)
 	}
 	utils.SuccessResponse(w, http.StatusOK, "Success", res)
 }
+
+func (h *AnalyticsHandler) GetCampaignAudience(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid campaign ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	humanOnly := r.URL.Query().Get("filtered") == "true"
+	res, err := h.svc.GetCampaignAudience(id, userID, humanOnly)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Campaign not found")
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	utils.SuccessResponse(w, http.StatusOK, "Success", res)
+}
+
+func (h *AnalyticsHandler) GetAudienceTrend(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := &types.AudienceTrendFilter{
+		Dimension: q.Get("dimension"),
+		Period:    q.Get("period"),
+		HumanOnly: q.Get("filtered") == "true",
+	}
+	if filter.Dimension == "" {
+		filter.Dimension = "client"
+	}
+	if v := q.Get("campaign_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid campaign ID")
+			return
+		}
+		filter.CampaignID = id
+	}
+	for _, d := range []struct {
+		key string
+		dst **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		v := q.Get(d.key)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid "+d.key+" date, expected YYYY-MM-DD")
+			return
+		}
+		if d.key == "to" {
+			// Include the whole end day.
+			t = t.AddDate(0, 0, 1)
+		}
+		*d.dst = &t
+	}
+
+	res, err := h.svc.GetAudienceTrend(userID, filter)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAudienceFilter) {
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	utils.SuccessResponse(w, http.StatusOK, "Success", res)
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"email_campaign/internal/merge"
+	"email_campaign/internal/mjml"
+	"email_campaign/internal/service"
+	"email_campaign/internal/types"
+	"email_campaign/internal/utils"
+)
+
+type BlockHandler struct {
+	svc service.BlockService
+}
+
+func NewBlockHandler(svc service.BlockService) *BlockHandler {
+	return &BlockHandler{svc: svc}
+}
+
+func (h *BlockHandler) CreateBlock(w http.ResponseWriter, r *http.Request) {
+	var req types.CreateContentBlockRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	req.UserID = userID
+
+	block, err := h.svc.CreateBlock(&req)
+	if err != nil {
+		writeBlockError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Content block created successfully", block)
+}
+
+func (h *BlockHandler) ListBlocks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	page := utils.ParseIntDefault(query.Get("page"), 1)
+	limit := utils.ParseIntDefault(query.Get("limit"), 20)
+
+	blocks, total, err := h.svc.ListBlocks(userID, query.Get("search"), page, limit)
+	if err != nil {
+		writeBlockError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data":  blocks,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Content blocks retrieved successfully", response)
+}
+
+func (h *BlockHandler) GetBlock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid content block ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	block, err := h.svc.GetBlock(id, userID)
+	if err != nil {
+		writeBlockError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Content block retrieved successfully", block)
+}
+
+func (h *BlockHandler) UpdateBlock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid content block ID")
+		return
+	}
+
+	var req types.UpdateContentBlockRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	block, err := h.svc.UpdateBlock(id, userID, &req)
+	if err != nil {
+		writeBlockError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Content block updated successfully", block)
+}
+
+func (h *BlockHandler) DeleteBlock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid content block ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.svc.DeleteBlock(id, userID); err != nil {
+		writeBlockError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Content block deleted successfully", nil)
+}
+
+func (h *BlockHandler) GetBlockUsage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid content block ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	usage, err := h.svc.GetBlockUsage(id, userID)
+	if err != nil {
+		writeBlockError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Content block usage retrieved successfully", usage)
+}
+
+func writeBlockError(w http.ResponseWriter, err error) {
+	var mjmlErrs mjml.Errors
+	var mergeErrs merge.Errors
+	switch {
+	case errors.As(err, &mjmlErrs), errors.As(err, &mergeErrs):
+		writeTemplateError(w, err)
+	case errors.Is(err, service.ErrInvalidBlockName), errors.Is(err, service.ErrInvalidBlockType),
+		errors.Is(err, service.ErrBlockBreaksTemplate):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrBlockNameTaken), errors.Is(err, service.ErrBlockInUse):
+		utils.ErrorResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		utils.ErrorResponse(w, http.StatusNotFound, "Content block not found")
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
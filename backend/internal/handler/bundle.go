@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"email_campaign/internal/bundle"
+	"email_campaign/internal/gallery"
+	"email_campaign/internal/imaging"
+	"email_campaign/internal/repository"
+	"email_campaign/internal/service"
+	"email_campaign/internal/types"
+	"email_campaign/internal/utils"
+)
+
+type TemplateBundleHandler struct {
+	svc service.TemplateBundleService
+}
+
+func NewTemplateBundleHandler(svc service.TemplateBundleService) *TemplateBundleHandler {
+	return &TemplateBundleHandler{svc: svc}
+}
+
+// ExportTemplate downloads the template as a zip bundle.
+func (h *TemplateBundleHandler) ExportTemplate(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	b, err := h.svc.ExportTemplate(id, userID)
+	if err != nil {
+		writeBundleError(w, err)
+		return
+	}
+	// Built in full first so a failure can still be reported as JSON.
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf, b); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+bundleFilename(b.Name)+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+// ImportTemplate creates a template from a bundle in the "file" form field.
+func (h *TemplateBundleHandler) ImportTemplate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxBundleSize+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, service.ErrBundleTooLarge.Error())
+			return
+		}
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid file")
+		return
+	}
+	defer file.Close()
+
+	result, err := h.svc.ImportTemplate(userID, file, header.Size)
+	if err != nil {
+		writeBundleError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Template imported successfully", result)
+}
+
+func (h *TemplateBundleHandler) ListStarters(w http.ResponseWriter, r *http.Request) {
+	starters, err := h.svc.ListStarters()
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Starter templates retrieved successfully", starters)
+}
+
+func (h *TemplateBundleHandler) CloneStarter(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	result, err := h.svc.CloneStarter(userID, r.PathValue("slug"))
+	if err != nil {
+		writeBundleError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Starter template cloned successfully", result)
+}
+
+// bundleFilename turns a template name into a safe zip file name.
+func bundleFilename(name string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, name)
+	slug = strings.Trim(slug, "-")
+	for strings.Contains(slug, "--") {
+		slug = strings.ReplaceAll(slug, "--", "-")
+	}
+	if slug == "" {
+		slug = "template"
+	}
+	return slug + ".zip"
+}
+
+// writeBundleError maps bundle problems, and the image and block problems
+// an import can run into, to responses.
+func writeBundleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, bundle.ErrInvalid), errors.Is(err, bundle.ErrUnsupported), errors.Is(err, service.ErrBlockLoop):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrBundleTooLarge):
+		utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, gallery.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, imaging.ErrUnsupportedType), errors.Is(err, imaging.ErrTooLarge),
+		errors.Is(err, service.ErrFileTypeNotPermitted), errors.Is(err, repository.ErrQuotaExceeded):
+		writeMediaError(w, err)
+	case errors.Is(err, service.ErrInvalidBlockName), errors.Is(err, service.ErrInvalidBlockType):
+		writeBlockError(w, err)
+	default:
+		writeTemplateError(w, err)
+	}
+}
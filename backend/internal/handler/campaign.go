@@ -1,21 +1,28 @@
 package handler
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"strconv"
+	"time"
 
+	"email_campaign/internal/logger"
 	"email_campaign/internal/service"
+	"email_campaign/internal/tracking"
 	"email_campaign/internal/types"
 	"email_campaign/internal/utils"
 )
 
 type CampaignHandler struct {
-	svc service.CampaignService
+	svc    service.CampaignService
+	events *tracking.Pipeline
 }
 
-func NewCampaignHandler(svc service.CampaignService) *CampaignHandler {
-	return &CampaignHandler{svc: svc}
+func NewCampaignHandler(svc service.CampaignService, events *tracking.Pipeline) *CampaignHandler {
+	return &CampaignHandler{svc: svc, events: events}
 }
 
 func (h *CampaignHandler) CreateCampaign(w http.ResponseWriter, r *http.Request) {
@@ -341,6 +348,162 @@ func (h *CampaignHandler) GetCampaignRecipients(w http.ResponseWriter, r *http.R
 	utils.SuccessResponse(w, http.StatusOK, "Recipients retrieved successfully", recipients)
 }
 
+func (h *CampaignHandler) GetCampaignLinks(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid campaign ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	links, err := h.svc.GetCampaignLinks(id, userID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Links retrieved successfully", links)
+}
+
+func (h *CampaignHandler) GetCampaignLink(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid campaign ID")
+		return
+	}
+
+	linkID, err := strconv.ParseUint(r.PathValue("linkId"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid link ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page := 1
+	limit := 50
+
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil {
+			page = p
+		}
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil {
+			limit = l
+		}
+	}
+
+	link, err := h.svc.GetCampaignLink(id, linkID, userID, page, limit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Link not found")
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Link retrieved successfully", link)
+}
+
+func (h *CampaignHandler) PreviewCampaignLinks(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid campaign ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	preview, err := h.svc.PreviewCampaignLinks(id, userID, r.URL.Query().Get("variant"), r.URL.Query().Get("locale"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Campaign not found")
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Link preview generated successfully", preview)
+}
+
+func (h *CampaignHandler) GetCampaignUTM(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid campaign ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	utm, err := h.svc.GetCampaignUTM(id, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Campaign not found")
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "UTM settings retrieved successfully", utm)
+}
+
+func (h *CampaignHandler) UpdateCampaignUTM(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid campaign ID")
+		return
+	}
+
+	var req types.CampaignUTM
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.svc.UpdateCampaignUTM(id, userID, &req); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Campaign not found")
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "UTM settings updated successfully", nil)
+}
+
 func (h *CampaignHandler) GetCampaignStats(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	id, err := strconv.ParseUint(idStr, 10, 64)
@@ -364,17 +527,39 @@ func (h *CampaignHandler) GetCampaignStats(w http.ResponseWriter, r *http.Reques
 	utils.SuccessResponse(w, http.StatusOK, "Stats retrieved successfully", stats)
 }
 
-func (h *CampaignHandler) TrackOpen(w http.ResponseWriter, r *http.Request) {
-	trackingID := r.PathValue("id")
-	if trackingID == "" {
-		http.Error(w, "Missing tracking ID", http.StatusBadRequest)
+func (h *CampaignHandler) GetLocaleStats(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid campaign ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	stats, err := h.svc.GetLocaleStats(id, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Campaign not found")
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Async track to not block response
-	go func() {
-		h.svc.TrackEvent(trackingID, "opened", r.UserAgent(), r.RemoteAddr, "")
-	}()
+	utils.SuccessResponse(w, http.StatusOK, "Locale stats retrieved successfully", stats)
+}
+
+func (h *CampaignHandler) TrackOpen(w http.ResponseWriter, r *http.Request) {
+	// Invalid tokens are dropped; the pixel is served either way so
+	// forgeries learn nothing.
+	if token, err := h.svc.VerifyOpen(r.PathValue("id")); err == nil {
+		h.track(r, token, "")
+	}
 
 	// Serve 1x1 transparent GIF
 	pixel := []byte{
@@ -403,57 +588,36 @@ func (h *CampaignHandler) GetFailedRecipients(w http.ResponseWriter, r *http.Req
 }
 
 func (h *CampaignHandler) TrackClick(w http.ResponseWriter, r *http.Request) {
-	trackingID := r.PathValue("id")
-	targetURL := r.URL.Query().Get("url")
-
-	if trackingID == "" || targetURL == "" {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	token, targetURL, err := h.svc.ResolveClick(r.PathValue("id"))
+	if err != nil {
+		// Forged, expired or unknown links get a bare 404 without detail.
+		http.NotFound(w, r)
 		return
 	}
-
-	// Async track
-	go func() {
-		h.svc.TrackEvent(trackingID, "clicked", r.UserAgent(), r.RemoteAddr, targetURL)
-	}()
+	h.track(r, token, targetURL)
 
 	http.Redirect(w, r, targetURL, http.StatusFound)
 }
 
-func (h *CampaignHandler) WebhookBounce(w http.ResponseWriter, r *http.Request) {
-	var req types.WebhookBounceRequest
-	if err := utils.ReadJSON(w, r, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
-		return
-	}
-	if err := h.svc.HandleWebhookBounce(&req); err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-	utils.SuccessResponse(w, http.StatusOK, "Bounce recorded", nil)
-}
-
-func (h *CampaignHandler) WebhookComplaint(w http.ResponseWriter, r *http.Request) {
-	var req types.WebhookComplaintRequest
-	if err := utils.ReadJSON(w, r, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
-		return
-	}
-	if err := h.svc.HandleWebhookComplaint(&req); err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
-		return
+// track queues an open or click for batched recording. A full pipeline
+// costs the event, never the visitor's pixel or redirect.
+func (h *CampaignHandler) track(r *http.Request, token *tracking.Token, url string) {
+	err := h.events.Enqueue(tracking.Event{
+		Token:     *token,
+		URL:       url,
+		UserAgent: r.UserAgent(),
+		IPAddress: remoteIP(r),
+		At:        time.Now(),
+	})
+	if err != nil {
+		logger.Error("Tracking event dropped", map[string]interface{}{"campaign_id": token.CampaignID, "error": err.Error()})
 	}
-	utils.SuccessResponse(w, http.StatusOK, "Complaint recorded", nil)
 }
 
-func (h *CampaignHandler) WebhookDelivery(w http.ResponseWriter, r *http.Request) {
-	var req types.WebhookDeliveryRequest
-	if err := utils.ReadJSON(w, r, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
-		return
-	}
-	if err := h.svc.HandleWebhookDelivery(&req); err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
-		return
+// remoteIP is the client's address without its port.
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
 	}
-	utils.SuccessResponse(w, http.StatusOK, "Delivery recorded", nil)
+	return r.RemoteAddr
 }
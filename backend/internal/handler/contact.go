@@ -2,12 +2,20 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"email_campaign/internal/customfield"
+	"email_campaign/internal/exporter"
+	"email_campaign/internal/locale"
+	"email_campaign/internal/logger"
 	"email_campaign/internal/service"
+	"email_campaign/internal/storage"
 	"email_campaign/internal/types"
 	"email_campaign/internal/utils"
 )
@@ -39,6 +47,10 @@ func (h *ContactHandler) CreateContact(w http.ResponseWriter, r *http.Request) {
 			utils.ErrorResponse(w, http.StatusConflict, err.Error())
 			return
 		}
+		if errors.Is(err, locale.ErrInvalid) || errors.Is(err, customfield.ErrInvalidValue) {
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -78,16 +90,9 @@ func (h *ContactHandler) ListContacts(w http.ResponseWriter, r *http.Request) {
 	filter.Limit = utils.ParseIntDefault(query.Get("limit"), 10)
 	filter.SortBy = utils.DefaultString(query.Get("sort_by"), "created_at")
 	filter.SortOrder = utils.DefaultString(query.Get("sort_order"), "desc")
-	filter.Search = query.Get("search")
-	filter.JoinOperator = utils.DefaultString(query.Get("join_operator"), "and")
-
-	filtersJSON := query.Get("filters")
-
-	if filtersJSON != "" {
-		if err := json.Unmarshal([]byte(filtersJSON), &filter.Filters); err != nil {
-			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid filters format")
-			return
-		}
+	if err := contactFilterFromQuery(query, &filter); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
@@ -113,6 +118,19 @@ func (h *ContactHandler) ListContacts(w http.ResponseWriter, r *http.Request) {
 	utils.SuccessResponse(w, http.StatusOK, "Contacts retrieved successfully", response)
 }
 
+// contactFilterFromQuery reads the search, join_operator and filters
+// (JSON) query parameters.
+func contactFilterFromQuery(query url.Values, filter *types.ContactFilter) error {
+	filter.Search = query.Get("search")
+	filter.JoinOperator = utils.DefaultString(query.Get("join_operator"), "and")
+	if filtersJSON := query.Get("filters"); filtersJSON != "" {
+		if err := json.Unmarshal([]byte(filtersJSON), &filter.Filters); err != nil {
+			return errors.New("Invalid filters format")
+		}
+	}
+	return nil
+}
+
 func (h *ContactHandler) UpdateContact(w http.ResponseWriter, r *http.Request) {
 
 	idStr := r.PathValue("id")
@@ -140,6 +158,10 @@ func (h *ContactHandler) UpdateContact(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.svc.UpdateContact(contactID, userID, &req); err != nil {
+		if errors.Is(err, locale.ErrInvalid) || errors.Is(err, customfield.ErrInvalidValue) {
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -270,6 +292,10 @@ func (h *ContactHandler) BulkCreateContacts(w http.ResponseWriter, r *http.Reque
 	}
 
 	if err := h.svc.BulkCreateContacts(userID, &req); err != nil {
+		if errors.Is(err, locale.ErrInvalid) || errors.Is(err, customfield.ErrInvalidValue) {
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -319,80 +345,117 @@ func (h *ContactHandler) BulkDeleteContacts(w http.ResponseWriter, r *http.Reque
 	utils.SuccessResponse(w, http.StatusOK, "Contacts deleted successfully", nil)
 }
 
-func (h *ContactHandler) ImportContacts(w http.ResponseWriter, r *http.Request) {
-	// 10MB limit
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, "File too large")
+// exportTimeout is how long an export may take to stream, well beyond the
+// server's usual write timeout.
+const exportTimeout = 30 * time.Minute
+
+// ExportContacts exports the contacts matching the same filters, search
+// and join_operator as ListContacts. format is csv (the default), xlsx or
+// ndjson and columns a comma separated list. The file is streamed in the
+// response, or with storage=true saved to the user's file storage to be
+// downloaded later.
+func (h *ContactHandler) ExportContacts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid file")
+	query := r.URL.Query()
+	var req types.ExportContactsRequest
+	if err := contactFilterFromQuery(query, &req.Filter); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer file.Close()
-
-	fileBytes, err := io.ReadAll(file)
+	format, err := exporter.ParseFormat(query.Get("format"))
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to read file")
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	fileType := "csv"
-	// Basic extension check
-	if strings.HasSuffix(header.Filename, ".xlsx") {
-		fileType = "excel"
+	req.Format = string(format)
+	for _, c := range strings.Split(query.Get("columns"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			req.Columns = append(req.Columns, c)
+		}
 	}
 
-	var req types.ImportContactsRequest
-	// User can provide field mapping as JSON string in form data
-	mappingStr := r.FormValue("field_mapping")
-	if mappingStr != "" {
-		_ = json.Unmarshal([]byte(mappingStr), &req.FieldMapping)
-	}
-	req.FileData = fileBytes
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(exportTimeout))
 
-	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
-	if !ok {
-		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+	if toStorage, _ := strconv.ParseBool(query.Get("storage")); toStorage {
+		file, err := h.svc.ExportContactsToFile(r.Context(), userID, &req)
+		if err != nil {
+			writeExportError(w, err)
+			return
+		}
+		utils.SuccessResponse(w, http.StatusCreated, "Contacts exported successfully", file)
 		return
 	}
 
-	if err := h.svc.ImportContacts(userID, &req, fileType); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
-		return
+	dw := &downloadWriter{
+		w:           w,
+		filename:    "contacts-" + time.Now().Format("20060102") + "." + string(format),
+		contentType: format.ContentType(),
 	}
+	rows, err := h.svc.ExportContacts(r.Context(), userID, &req, dw)
+	if err != nil {
+		if !dw.started {
+			writeExportError(w, err)
+			return
+		}
+		// The response has started, so the error can only be logged.
+		logger.Error("Contact export failed", map[string]interface{}{"user_id": userID, "rows": rows, "error": err.Error()})
+	}
+}
 
-	utils.SuccessResponse(w, http.StatusOK, "Contacts imported successfully", nil)
+// downloadWriter sends the download headers with the first write, so an
+// export that fails before then can still answer with an error.
+type downloadWriter struct {
+	w           http.ResponseWriter
+	filename    string
+	contentType string
+	started     bool
 }
 
-func (h *ContactHandler) ExportContacts(w http.ResponseWriter, r *http.Request) {
-	format := r.URL.Query().Get("format")
-	if format == "" {
-		format = "csv"
+func (d *downloadWriter) Write(p []byte) (int, error) {
+	if !d.started {
+		d.started = true
+		d.w.Header().Set("Content-Disposition", "attachment; filename="+d.filename)
+		d.w.Header().Set("Content-Type", d.contentType)
 	}
+	return d.w.Write(p)
+}
 
+// DownloadExport sends an export saved with storage=true.
+func (h *ContactHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
 	if !ok {
 		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Reuse list logic for filtering, modify request to assume empty filter means all
-	var filter types.ContactFilter
-	// TODO: Populate filter from query params like ListCalls if we want filtered export
-	// For now, simpler approach:
-	filter.UserID = userID
-
-	data, err := h.svc.ExportContacts(userID, &filter, format)
+	id := r.PathValue("id")
+	rc, contentType, err := h.svc.OpenContactExport(userID, id)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		writeStorageError(w, err)
 		return
 	}
+	defer rc.Close()
+
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(exportTimeout))
+	w.Header().Set("Content-Disposition", "attachment; filename="+id)
+	w.Header().Set("Content-Type", contentType)
+	io.Copy(w, rc)
+}
 
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", "attachment; filename=contacts.csv")
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+func writeExportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, exporter.ErrUnsupportedFormat), errors.Is(err, exporter.ErrUnknownColumn),
+		errors.Is(err, exporter.ErrTooManyRows), errors.Is(err, exporter.ErrDuplicateColumn):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, storage.ErrNotConfigured), errors.Is(err, storage.ErrUnknownBackend):
+		writeStorageError(w, err)
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
 }
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"email_campaign/internal/customfield"
+	"email_campaign/internal/service"
+	"email_campaign/internal/types"
+	"email_campaign/internal/utils"
+)
+
+type CustomFieldHandler struct {
+	svc service.CustomFieldService
+}
+
+func NewCustomFieldHandler(svc service.CustomFieldService) *CustomFieldHandler {
+	return &CustomFieldHandler{svc: svc}
+}
+
+func (h *CustomFieldHandler) CreateField(w http.ResponseWriter, r *http.Request) {
+	var req types.CreateCustomFieldRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	req.UserID = userID
+
+	field, err := h.svc.CreateField(&req)
+	if err != nil {
+		writeCustomFieldError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Custom field created successfully", field)
+}
+
+func (h *CustomFieldHandler) ListFields(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	fields, err := h.svc.ListFields(userID)
+	if err != nil {
+		writeCustomFieldError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Custom fields retrieved successfully", fields)
+}
+
+func (h *CustomFieldHandler) GetField(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid custom field ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	field, err := h.svc.GetField(id, userID)
+	if err != nil {
+		writeCustomFieldError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Custom field retrieved successfully", field)
+}
+
+func (h *CustomFieldHandler) UpdateField(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid custom field ID")
+		return
+	}
+
+	var req types.UpdateCustomFieldRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	field, err := h.svc.UpdateField(id, userID, &req)
+	if err != nil {
+		writeCustomFieldError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Custom field updated successfully", field)
+}
+
+func (h *CustomFieldHandler) DeleteField(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid custom field ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.svc.DeleteField(id, userID); err != nil {
+		writeCustomFieldError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Custom field deleted successfully", nil)
+}
+
+func writeCustomFieldError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, customfield.ErrInvalidField):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrFieldKeyTaken):
+		utils.ErrorResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		utils.ErrorResponse(w, http.StatusNotFound, "Custom field not found")
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
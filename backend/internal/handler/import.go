@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"email_campaign/internal/importer"
+	"email_campaign/internal/logger"
+	"email_campaign/internal/mailchimp"
+	"email_campaign/internal/service"
+	"email_campaign/internal/types"
+	"email_campaign/internal/utils"
+)
+
+// importTimeout is how long an import may take to upload and run, well
+// beyond the server's usual timeouts.
+const importTimeout = 15 * time.Minute
+
+type ImportHandler struct {
+	svc service.ImportService
+}
+
+func NewImportHandler(svc service.ImportService) *ImportHandler {
+	return &ImportHandler{svc: svc}
+}
+
+// ImportMailchimp imports the Mailchimp audience exports in the "audience"
+// form fields, each a CSV or Mailchimp's zip of them, and the template
+// HTML in the "template" field. Optional fields are template_name,
+// merge_fields (a JSON object of merge tags to column labels),
+// gdpr_fields (the marketing permission columns, comma separated) and
+// dry_run.
+func (h *ImportHandler) ImportMailchimp(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(importTimeout))
+	rc.SetWriteDeadline(time.Now().Add(importTimeout))
+
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxImportUploadSize+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, service.ErrImportTooLarge.Error())
+			return
+		}
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var req types.MailchimpImportRequest
+	req.DryRun, _ = strconv.ParseBool(r.FormValue("dry_run"))
+	req.TemplateName = strings.TrimSpace(r.FormValue("template_name"))
+	if s := r.FormValue("merge_fields"); s != "" {
+		if err := json.Unmarshal([]byte(s), &req.MergeFields); err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "merge_fields must be a JSON object of merge tags to column labels")
+			return
+		}
+	}
+	if s := r.FormValue("gdpr_fields"); s != "" {
+		for _, f := range strings.Split(s, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				req.GDPRFields = append(req.GDPRFields, f)
+			}
+		}
+	}
+
+	if headers := r.MultipartForm.File["template"]; len(headers) > 0 {
+		f, err := headers[0].Open()
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template file")
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(f, service.MaxTemplateImportSize+1))
+		f.Close()
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template file")
+			return
+		}
+		if len(data) > service.MaxTemplateImportSize {
+			utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, "Template is larger than 5MB")
+			return
+		}
+		req.Template = string(data)
+		if req.TemplateName == "" {
+			req.TemplateName = strings.TrimSuffix(headers[0].Filename, path.Ext(headers[0].Filename))
+		}
+	}
+
+	var files []service.ImportFile
+	for _, header := range r.MultipartForm.File["audience"] {
+		f, err := header.Open()
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid audience file")
+			return
+		}
+		defer f.Close()
+		files = append(files, service.ImportFile{Name: header.Filename, Data: f, Size: header.Size})
+	}
+
+	job, summary, err := h.svc.ImportMailchimp(userID, files, &req)
+	if err != nil {
+		writeImportError(w, err)
+		return
+	}
+
+	status, message := http.StatusCreated, "Mailchimp import completed"
+	if job == nil {
+		status, message = http.StatusOK, "Mailchimp import checked"
+	} else {
+		// The summary is returned on its own.
+		job.Summary = nil
+	}
+	utils.SuccessResponse(w, status, message, map[string]interface{}{
+		"job":     job,
+		"summary": summary,
+	})
+}
+
+// ImportContacts queues an import of the CSV or .xlsx file in the "file"
+// form field and returns its job. Optional fields are mode (create,
+// upsert or update), field_mapping (a JSON object of contact fields to
+// headers), tag_ids (comma separated) and ignore_unmapped.
+func (h *ImportHandler) ImportContacts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(importTimeout))
+	rc.SetWriteDeadline(time.Now().Add(importTimeout))
+
+	// Files beyond the memory limit are spooled to disk while parsing.
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxContactImportSize+1<<20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, "File is larger than 1GB")
+			return
+		}
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid file")
+		return
+	}
+	defer file.Close()
+
+	req := types.ImportContactsRequest{Mode: strings.TrimSpace(r.FormValue("mode"))}
+	req.IgnoreUnmapped, _ = strconv.ParseBool(r.FormValue("ignore_unmapped"))
+	if s := r.FormValue("field_mapping"); s != "" {
+		if err := json.Unmarshal([]byte(s), &req.FieldMapping); err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "field_mapping must be a JSON object of contact fields to column headers")
+			return
+		}
+	}
+	for _, s := range strings.Split(r.FormValue("tag_ids"), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "tag_ids must be comma separated tag IDs")
+			return
+		}
+		req.TagIDs = append(req.TagIDs, id)
+	}
+
+	job, err := h.svc.ImportContacts(userID, service.ImportFile{Name: header.Filename, Data: file, Size: header.Size}, &req)
+	if err != nil {
+		writeImportError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusAccepted, "Contact import queued", job)
+}
+
+func (h *ImportHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	page := utils.ParseIntDefault(query.Get("page"), 1)
+	limit := utils.ParseIntDefault(query.Get("limit"), 20)
+
+	jobs, total, err := h.svc.ListJobs(userID, page, limit)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"data":  jobs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Import jobs retrieved successfully", response)
+}
+
+func (h *ImportHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid import job ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	job, err := h.svc.GetJob(id, userID)
+	if err != nil {
+		writeImportError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Import job retrieved successfully", job)
+}
+
+// DownloadRejects sends the rows a contact import rejected as CSV, with
+// the reason for each.
+func (h *ImportHandler) DownloadRejects(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid import job ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	job, err := h.svc.GetJob(id, userID)
+	if err != nil {
+		writeImportError(w, err)
+		return
+	}
+	if job.RejectedURL == "" {
+		utils.ErrorResponse(w, http.StatusNotFound, "Import job has no rejected rows")
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=import-%d-rejected.csv", job.ID))
+	w.Header().Set("Content-Type", "text/csv")
+	if err := h.svc.WriteRejects(job, w); err != nil {
+		// The response has started, so the error can only be logged.
+		logger.Error("Failed to write rejected rows", map[string]interface{}{"job_id": job.ID, "error": err.Error()})
+	}
+}
+
+// writeImportError maps unreadable uploads to 400s. An import that fails
+// part way has its job marked failed, with the summary so far.
+func writeImportError(w http.ResponseWriter, err error) {
+	var parseErr *csv.ParseError
+	switch {
+	case errors.Is(err, service.ErrNothingToImport), errors.Is(err, service.ErrNoAudienceFiles),
+		errors.Is(err, mailchimp.ErrNoEmailColumn), errors.Is(err, zip.ErrFormat), errors.As(err, &parseErr),
+		errors.Is(err, importer.ErrUnsupportedFormat), errors.Is(err, importer.ErrInvalidMapping),
+		errors.Is(err, service.ErrInvalidImportMode), errors.Is(err, service.ErrImportTagNotFound):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrTooManyImportRows), errors.Is(err, service.ErrImportFileTooLarge):
+		utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		utils.ErrorResponse(w, http.StatusNotFound, "Import job not found")
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
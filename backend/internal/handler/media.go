@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"email_campaign/internal/imaging"
+	"email_campaign/internal/repository"
+	"email_campaign/internal/service"
+	"email_campaign/internal/types"
+	"email_campaign/internal/utils"
+)
+
+type MediaHandler struct {
+	svc service.MediaService
+}
+
+func NewMediaHandler(svc service.MediaService) *MediaHandler {
+	return &MediaHandler{svc: svc}
+}
+
+// UploadMedia accepts an image in the "image" form field. It also serves
+// the older template image upload route, whose clients read data.url.
+func (h *MediaHandler) UploadMedia(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Leave room for the multipart framing around a maximum-size file
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxUploadSize+1<<20)
+	if err := r.ParseMultipartForm(service.MaxUploadSize); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, service.ErrFileTooLarge.Error())
+			return
+		}
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid image")
+		return
+	}
+	defer file.Close()
+
+	media, err := h.svc.Upload(userID, file, header.Filename)
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Image uploaded successfully", media)
+}
+
+func (h *MediaHandler) ListMedia(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page := utils.ParseIntDefault(r.URL.Query().Get("page"), 1)
+	limit := utils.ParseIntDefault(r.URL.Query().Get("limit"), 20)
+
+	media, total, err := h.svc.List(userID, page, limit)
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data":  media,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Media retrieved successfully", response)
+}
+
+func (h *MediaHandler) GetMediaUsage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	usage, err := h.svc.Usage(userID)
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Media usage retrieved successfully", usage)
+}
+
+func (h *MediaHandler) DeleteMedia(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid media ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.svc.Delete(id, userID); err != nil {
+		writeMediaError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Media deleted successfully", nil)
+}
+
+func writeMediaError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.ErrorResponse(w, http.StatusNotFound, "Media not found")
+	case errors.Is(err, imaging.ErrUnsupportedType):
+		utils.ErrorResponse(w, http.StatusUnsupportedMediaType, "Only JPEG, PNG and GIF images can be uploaded")
+	case errors.Is(err, service.ErrFileTypeNotPermitted):
+		utils.ErrorResponse(w, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, service.ErrFileTooLarge), errors.Is(err, imaging.ErrTooLarge):
+		utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, repository.ErrQuotaExceeded):
+		utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, "Storage quota exceeded; delete unused media or upgrade your plan")
+	default:
+		writeStorageError(w, err)
+	}
+}
@@ -1,9 +1,18 @@
 package handler
 
 import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"html"
+	"io"
 	"net/http"
+	"strconv"
 
+	"email_campaign/internal/logger"
+	"email_campaign/internal/render"
 	"email_campaign/internal/service"
+	"email_campaign/internal/tracking"
 	"email_campaign/internal/types"
 	"email_campaign/internal/utils"
 )
@@ -24,6 +33,10 @@ func (h *PublicHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.svc.Unsubscribe(&req); err != nil {
+		if invalidLink(err) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Invalid or expired token")
+			return
+		}
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -31,6 +44,44 @@ func (h *PublicHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
 	utils.SuccessResponse(w, http.StatusOK, "Unsubscribed successfully", nil)
 }
 
+// UnsubscribePage is where a message's unsubscribe link lands. It only asks
+// for confirmation, so link scanners that follow it unsubscribe nobody.
+func (h *PublicHandler) UnsubscribePage(w http.ResponseWriter, r *http.Request) {
+	writeUnsubscribePage(w, http.StatusOK, "Unsubscribe from these emails?", true)
+}
+
+// UnsubscribeLink unsubscribes the recipient the link was sent to. Mail
+// clients post here directly for one-click unsubscribes (RFC 8058).
+func (h *PublicHandler) UnsubscribeLink(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.Unsubscribe(&types.UnsubscribeRequest{Token: r.PathValue("token")}); err != nil {
+		if invalidLink(err) {
+			writeUnsubscribePage(w, http.StatusNotFound, "This link is invalid or has expired.", false)
+			return
+		}
+		logger.Error("Failed to unsubscribe", map[string]interface{}{"error": err.Error()})
+		writeUnsubscribePage(w, http.StatusInternalServerError, "Something went wrong. Please try again later.", false)
+		return
+	}
+	writeUnsubscribePage(w, http.StatusOK, "You have been unsubscribed.", false)
+}
+
+// invalidLink reports errors caused by a bad or stale public link.
+func invalidLink(err error) bool {
+	return errors.Is(err, tracking.ErrInvalidToken) || errors.Is(err, tracking.ErrExpiredToken) || errors.Is(err, sql.ErrNoRows)
+}
+
+func writeUnsubscribePage(w http.ResponseWriter, status int, message string, confirm bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.WriteHeader(status)
+	body := `<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>Unsubscribe</title></head><body><p>` + html.EscapeString(message) + `</p>`
+	if confirm {
+		body += `<form method="post"><button type="submit">Unsubscribe</button></form>`
+	}
+	w.Write([]byte(body + `</body></html>`))
+}
+
 func (h *PublicHandler) Resubscribe(w http.ResponseWriter, r *http.Request) {
 	// Expect token in path? server.go says /:token, handled by manual parsing or query
 	token := r.PathValue("token") // or r.URL.Query().Get("token")
@@ -64,3 +115,88 @@ func (h *PublicHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request
 	}
 	utils.SuccessResponse(w, http.StatusOK, "Preferences updated successfully", nil)
 }
+
+// ViewOnline serves one recipient's "view in browser" copy of a campaign.
+func (h *PublicHandler) ViewOnline(w http.ResponseWriter, r *http.Request) {
+	body, err := h.svc.ViewOnline(r.PathValue("token"))
+	if err != nil {
+		if invalidLink(err) {
+			http.Error(w, "This link is invalid or has expired.", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to render web version", map[string]interface{}{"error": err.Error()})
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+	writeCampaignHTML(w, body, true)
+}
+
+func (h *PublicHandler) ArchiveIndex(w http.ResponseWriter, r *http.Request) {
+	h.serveArchive(w, r, "text/html; charset=utf-8", render.WriteArchiveIndex)
+}
+
+func (h *PublicHandler) ArchiveRSS(w http.ResponseWriter, r *http.Request) {
+	h.serveArchive(w, r, "application/rss+xml; charset=utf-8", render.WriteArchiveRSS)
+}
+
+func (h *PublicHandler) ArchiveAtom(w http.ResponseWriter, r *http.Request) {
+	h.serveArchive(w, r, "application/atom+xml; charset=utf-8", render.WriteArchiveAtom)
+}
+
+func (h *PublicHandler) serveArchive(w http.ResponseWriter, r *http.Request, contentType string, write func(io.Writer, *render.ArchivePage) error) {
+	page, err := h.svc.GetArchive(r.PathValue("slug"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		logger.Error("Failed to load campaign archive", map[string]interface{}{"error": err.Error()})
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := write(&buf, page); err != nil {
+		logger.Error("Failed to render campaign archive", map[string]interface{}{"error": err.Error()})
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(buf.Bytes())
+}
+
+func (h *PublicHandler) ArchivedCampaign(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := h.svc.GetArchivedCampaign(r.PathValue("slug"), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		logger.Error("Failed to render archived campaign", map[string]interface{}{"error": err.Error()})
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+	writeCampaignHTML(w, body, false)
+}
+
+// writeCampaignHTML serves campaign content as a page of its own. The
+// content is user-authored, so it is sandboxed: scripts and forms do not
+// run even if a template contains them.
+func writeCampaignHTML(w http.ResponseWriter, body string, private bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "sandbox allow-popups allow-popups-to-escape-sandbox allow-top-navigation-by-user-activation")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if private {
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("X-Robots-Tag", "noindex")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	}
+	w.Write([]byte(body))
+}
@@ -22,9 +22,15 @@ func (h *ReportHandler) GenerateReport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	report, err := h.svc.GenerateReport(&req)
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	report, err := h.svc.GenerateReport(userID, &req)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		writeStorageError(w, err)
 		return
 	}
 
@@ -32,10 +38,16 @@ func (h *ReportHandler) GenerateReport(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ReportHandler) DownloadReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
 	id := r.PathValue("id")
-	content, filename, err := h.svc.DownloadReport(id)
+	content, filename, err := h.svc.DownloadReport(userID, id)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		writeStorageError(w, err)
 		return
 	}
 
@@ -1,9 +1,11 @@
 package handler
 
 import (
+	"email_campaign/internal/locale"
 	"email_campaign/internal/service"
 	"email_campaign/internal/types"
 	"email_campaign/internal/utils"
+	"errors"
 	"net/http"
 )
 
@@ -45,6 +47,10 @@ func (h *SettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.svc.UpdateSettings(userID, &req); err != nil {
+		if errors.Is(err, locale.ErrInvalid) {
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -108,7 +114,7 @@ func (h *SettingsHandler) UpdateFileSettings(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := h.svc.UpdateFileSettings(userID, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		writeStorageError(w, err)
 		return
 	}
 
@@ -135,3 +141,52 @@ func (h *SettingsHandler) UpdatePrivacySettings(w http.ResponseWriter, r *http.R
 
 	utils.SuccessResponse(w, http.StatusOK, "Privacy settings updated successfully", nil)
 }
+
+func (h *SettingsHandler) UpdateUTMSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req types.UTMSettings
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.svc.UpdateUTMSettings(userID, &req); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "UTM settings updated successfully", nil)
+}
+
+func (h *SettingsHandler) UpdateArchiveSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req types.ArchiveSettings
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.svc.UpdateArchiveSettings(userID, &req); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidArchiveSlug):
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrArchiveSlugTaken):
+			utils.ErrorResponse(w, http.StatusConflict, err.Error())
+		default:
+			utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Archive settings updated successfully", nil)
+}
@@ -1,12 +1,18 @@
 package handler
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
+	"email_campaign/internal/locale"
+	"email_campaign/internal/merge"
+	"email_campaign/internal/mjml"
 	"email_campaign/internal/service"
+	"email_campaign/internal/storage"
 	"email_campaign/internal/types"
 	"email_campaign/internal/utils"
 )
@@ -33,12 +39,13 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 	}
 	req.UserID = userID
 
-	if err := h.svc.CreateTemplate(&req); err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	template, err := h.svc.CreateTemplate(&req)
+	if err != nil {
+		writeTemplateError(w, err)
 		return
 	}
 
-	utils.SuccessResponse(w, http.StatusCreated, "Template created successfully", nil)
+	utils.SuccessResponse(w, http.StatusCreated, "Template created successfully", template)
 }
 
 func (h *TemplateHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
@@ -133,7 +140,7 @@ func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.svc.UpdateTemplate(id, userID, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		writeTemplateError(w, err)
 		return
 	}
 
@@ -215,14 +222,27 @@ func (h *TemplateHandler) PreviewTemplate(w http.ResponseWriter, r *http.Request
 	// Let's assume this endpoint is for previewing *unsaved* changes or validating current edit.
 	// So we primarily look at body.
 
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
 	var req types.PreviewTemplateRequest
 	if err := utils.ReadJSON(w, r, &req); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	req.UserID = userID
 
 	html, err := h.svc.PreviewTemplate(&req)
 	if err != nil {
+		var mjmlErrs mjml.Errors
+		var mergeErrs merge.Errors
+		if errors.As(err, &mjmlErrs) || errors.As(err, &mergeErrs) {
+			writeTemplateError(w, err)
+			return
+		}
 		utils.ErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Template error: %v", err))
 		return
 	}
@@ -232,25 +252,354 @@ func (h *TemplateHandler) PreviewTemplate(w http.ResponseWriter, r *http.Request
 	utils.SuccessResponse(w, http.StatusOK, "Preview generated", map[string]string{"html": html})
 }
 
-func (h *TemplateHandler) UploadTemplateImage(w http.ResponseWriter, r *http.Request) {
-	// Limit 10MB
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
+func (h *TemplateHandler) GenerateTemplateText(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// The body is optional; without it the saved template is converted.
+	var req types.GenerateTextRequest
+	if r.ContentLength != 0 {
+		if err := utils.ReadJSON(w, r, &req); err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	text, err := h.svc.GenerateText(id, userID, &req)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Text generated", types.GenerateTextResponse{TextContent: text})
+}
+
+func (h *TemplateHandler) ListTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page := utils.ParseIntDefault(r.URL.Query().Get("page"), 1)
+	limit := utils.ParseIntDefault(r.URL.Query().Get("limit"), 20)
+
+	versions, total, err := h.svc.ListTemplateVersions(id, userID, page, limit)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data":  versions,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Template versions retrieved successfully", response)
+}
+
+func (h *TemplateHandler) GetTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || version < 1 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid version")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	v, err := h.svc.GetTemplateVersion(id, userID, version)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Template version retrieved successfully", v)
+}
+
+// DiffTemplateVersions compares ?from= with ?to=, which defaults to the
+// current version.
+func (h *TemplateHandler) DiffTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	query := r.URL.Query()
+	from, err := strconv.Atoi(query.Get("from"))
+	if err != nil || from < 1 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid from version")
+		return
+	}
+	to := 0
+	if toStr := query.Get("to"); toStr != "" {
+		to, err = strconv.Atoi(toStr)
+		if err != nil || to < 1 {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid to version")
+			return
+		}
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	d, err := h.svc.DiffTemplateVersions(id, userID, from, to)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Template versions compared", d)
+}
+
+func (h *TemplateHandler) RestoreTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || version < 1 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid version")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	template, err := h.svc.RestoreTemplateVersion(id, userID, version)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Template version restored successfully", template)
+}
+
+func (h *TemplateHandler) ListTemplateLocales(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	locales, err := h.svc.ListTemplateLocales(id, userID)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Template translations retrieved successfully", locales)
+}
+
+func (h *TemplateHandler) GetTemplateLocale(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	l, err := h.svc.GetTemplateLocale(id, userID, r.PathValue("locale"))
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Template translation retrieved successfully", l)
+}
+
+// SaveTemplateLocale creates the translation for the locale in the path,
+// or replaces it if there is one.
+func (h *TemplateHandler) SaveTemplateLocale(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req types.SaveTemplateLocaleRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	file, header, err := r.FormFile("image")
+	l, err := h.svc.SaveTemplateLocale(id, userID, r.PathValue("locale"), &req)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid image")
+		writeTemplateError(w, err)
 		return
 	}
-	defer file.Close()
 
-	url, err := h.svc.UploadTemplateImage(file, header.Filename)
+	utils.SuccessResponse(w, http.StatusOK, "Template translation saved successfully", l)
+}
+
+func (h *TemplateHandler) DeleteTemplateLocale(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.svc.DeleteTemplateLocale(id, userID, r.PathValue("locale")); err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Template translation deleted successfully", nil)
+}
+
+// LintTemplate checks the template for email-client problems and stores
+// the report behind the template's health badge.
+func (h *TemplateHandler) LintTemplate(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	report, err := h.svc.LintTemplate(id, userID)
+	if err != nil {
+		writeTemplateError(w, err)
 		return
 	}
 
-	utils.SuccessResponse(w, http.StatusOK, "Image uploaded successfully", types.UploadTemplateImageResponse{URL: url})
+	utils.SuccessResponse(w, http.StatusOK, "Template linted successfully", report)
+}
+
+func (h *TemplateHandler) GetTemplateLint(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	report, err := h.svc.GetTemplateLint(id, userID)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Template lint report retrieved successfully", report)
+}
+
+// writeTemplateError reports invalid MJML or merge tags as a 400 listing
+// every problem with its line and column, so editors can highlight them.
+func writeTemplateError(w http.ResponseWriter, err error) {
+	var mjmlErrs mjml.Errors
+	var mergeErrs merge.Errors
+	switch {
+	case errors.As(err, &mjmlErrs):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.JSONResponse{
+			Error:   true,
+			Message: "Invalid MJML: " + mjmlErrs[0].Error(),
+			Data:    map[string]interface{}{"errors": mjmlErrs},
+		})
+	case errors.As(err, &mergeErrs):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.JSONResponse{
+			Error:   true,
+			Message: "Invalid merge tags: " + mergeErrs[0].Error(),
+			Data:    map[string]interface{}{"errors": mergeErrs},
+		})
+	case errors.Is(err, service.ErrMJMLContentRequired), errors.Is(err, service.ErrHTMLContentRequired), errors.Is(err, locale.ErrInvalid):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrLocaleNotFound), errors.Is(err, service.ErrNotLinted):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		utils.ErrorResponse(w, http.StatusNotFound, "Template not found")
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// writeStorageError maps file backend errors to responses. A backend that
+// is missing settings is the user's to fix, so it is reported as a 400.
+func writeStorageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotConfigured), errors.Is(err, storage.ErrUnknownBackend):
+		utils.ErrorResponse(w, http.StatusBadRequest, "File storage: "+err.Error())
+	case errors.Is(err, storage.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, "File not found")
+	case errors.Is(err, storage.ErrInvalidKey):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
 }
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"email_campaign/internal/logger"
+	"email_campaign/internal/service"
+	"email_campaign/internal/types"
+	"email_campaign/internal/utils"
+	"email_campaign/internal/webhook"
+)
+
+type WebhookHandler struct {
+	svc service.WebhookService
+}
+
+func NewWebhookHandler(svc service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{svc: svc}
+}
+
+func (h *WebhookHandler) ListEndpoints(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	endpoints, err := h.svc.ListEndpoints(userID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if endpoints == nil {
+		endpoints = []types.WebhookEndpoint{}
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Webhook endpoints retrieved successfully", endpoints)
+}
+
+func (h *WebhookHandler) CreateEndpoint(w http.ResponseWriter, r *http.Request) {
+	var req types.CreateWebhookEndpointRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	req.UserID = userID
+
+	endpoint, err := h.svc.CreateEndpoint(&req)
+	if err != nil {
+		if errors.Is(err, webhook.ErrUnknownProvider) || errors.Is(err, service.ErrWebhookSecretRequired) || errors.Is(err, service.ErrWebhookTopicRequired) {
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Webhook endpoint created successfully", endpoint)
+}
+
+func (h *WebhookHandler) DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid endpoint ID")
+		return
+	}
+
+	userID, ok := r.Context().Value(types.UserIDKey).(uint64)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.svc.DeleteEndpoint(id, userID); err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Webhook endpoint deleted successfully", nil)
+}
+
+// Receive is the public callback target given to the email provider.
+func (h *WebhookHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	applied, err := h.svc.HandleWebhook(token, r, body)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrWebhookEndpointNotFound):
+			utils.ErrorResponse(w, http.StatusNotFound, "Not found")
+		case errors.Is(err, webhook.ErrInvalidSignature):
+			utils.ErrorResponse(w, http.StatusUnauthorized, "Invalid signature")
+		case errors.Is(err, webhook.ErrInvalidPayload):
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			// Anything else is ours; a 5xx tells the provider to retry.
+			logger.Error("Failed to process webhook", map[string]interface{}{"error": err.Error()})
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Webhook processed", map[string]int{"applied": applied})
+}
@@ -0,0 +1,167 @@
+// Package imaging prepares uploaded images for use in email: it checks
+// what the bytes really are, strips metadata by re-encoding, and makes
+// copies at email-friendly widths.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+)
+
+// Widths are the variant widths made for email: 600px is the usual body
+// width and 1200px serves retina screens at the same layout size.
+var Widths = []int{600, 1200}
+
+const (
+	// MaxPixels and MaxSide bound the decoded size of an upload, so a small
+	// file cannot expand into gigabytes of pixels.
+	MaxPixels = 40_000_000
+	MaxSide   = 10_000
+
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrTooLarge        = fmt.Errorf("image is larger than %d pixels or %dpx on a side", MaxPixels, MaxSide)
+)
+
+// Formats maps the content types that can be processed to their file
+// extension.
+var Formats = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// Extensions lists the names a permitted-extensions setting may use for
+// each content type.
+var Extensions = map[string][]string{
+	"image/jpeg": {"jpg", "jpeg"},
+	"image/png":  {"png"},
+	"image/gif":  {"gif"},
+}
+
+// Sniff returns the content type of data judged by its bytes alone.
+func Sniff(data []byte) string {
+	return http.DetectContentType(data)
+}
+
+// Variant is one encoded copy of an image. Name is "original" or the width.
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Result is a processed upload.
+type Result struct {
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+	Variants    []Variant
+}
+
+// Process decodes an image and re-encodes it without metadata, turned
+// upright by its EXIF orientation. Besides the full-size original it adds
+// a copy for each of Widths narrower than the image. Animated GIFs are
+// kept at full size only.
+func Process(data []byte) (*Result, error) {
+	contentType := Sniff(data)
+	ext, ok := Formats[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > MaxSide || cfg.Height > MaxSide || cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	res := &Result{ContentType: contentType, Ext: ext}
+	if contentType == "image/gif" {
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+		}
+		if len(g.Image) > 1 {
+			var buf bytes.Buffer
+			if err := gif.EncodeAll(&buf, g); err != nil {
+				return nil, err
+			}
+			res.Width, res.Height = g.Config.Width, g.Config.Height
+			res.Variants = []Variant{{Name: "original", Width: res.Width, Height: res.Height, Data: buf.Bytes()}}
+			return res, nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	if contentType == "image/jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	b := img.Bounds()
+	res.Width, res.Height = b.Dx(), b.Dy()
+	out, err := encode(img, contentType)
+	if err != nil {
+		return nil, err
+	}
+	res.Variants = append(res.Variants, Variant{Name: "original", Width: res.Width, Height: res.Height, Data: out})
+
+	for _, w := range Widths {
+		if w >= res.Width {
+			continue
+		}
+		small := Resize(img, w)
+		out, err := encode(small, contentType)
+		if err != nil {
+			return nil, err
+		}
+		sb := small.Bounds()
+		res.Variants = append(res.Variants, Variant{Name: strconv.Itoa(w), Width: sb.Dx(), Height: sb.Dy(), Data: out})
+	}
+	return res, nil
+}
+
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	case "image/png":
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	case "image/gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		err = ErrUnsupportedType
+	}
+	return buf.Bytes(), err
+}
+
+// toRGBA returns img as premultiplied RGBA with bounds starting at 0,0.
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && b.Min == (image.Point{}) {
+		return rgba
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
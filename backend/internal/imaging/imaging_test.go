@@ -0,0 +1,241 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withOrientation inserts an EXIF APP1 segment carrying the orientation
+// tag right after the JPEG's SOI marker.
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	out := append([]byte{}, data[:2]...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(seg)+2))
+	out = append(out, seg...)
+	return append(out, data[2:]...)
+}
+
+func TestProcessVariants(t *testing.T) {
+	res, err := Process(encodePNG(t, gradient(1600, 800)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ContentType != "image/png" || res.Ext != "png" || res.Width != 1600 || res.Height != 800 {
+		t.Fatalf("result = %s %s %dx%d", res.ContentType, res.Ext, res.Width, res.Height)
+	}
+	want := []struct {
+		name string
+		w, h int
+	}{{"original", 1600, 800}, {"600", 600, 300}, {"1200", 1200, 600}}
+	if len(res.Variants) != len(want) {
+		t.Fatalf("got %d variants, want %d", len(res.Variants), len(want))
+	}
+	for i, w := range want {
+		v := res.Variants[i]
+		if v.Name != w.name || v.Width != w.w || v.Height != w.h {
+			t.Errorf("variant %d = %s %dx%d, want %s %dx%d", i, v.Name, v.Width, v.Height, w.name, w.w, w.h)
+		}
+		cfg, err := png.DecodeConfig(bytes.NewReader(v.Data))
+		if err != nil {
+			t.Fatalf("variant %s: %v", v.Name, err)
+		}
+		if cfg.Width != w.w || cfg.Height != w.h {
+			t.Errorf("variant %s decodes as %dx%d", v.Name, cfg.Width, cfg.Height)
+		}
+	}
+}
+
+func TestProcessSmallImageKeepsOriginalOnly(t *testing.T) {
+	res, err := Process(encodePNG(t, gradient(400, 200)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Variants) != 1 || res.Variants[0].Name != "original" {
+		t.Fatalf("variants = %+v", res.Variants)
+	}
+}
+
+func TestProcessStripsMetadataAndOrients(t *testing.T) {
+	// A wide image marked as needing a quarter turn clockwise comes out
+	// tall, and without the EXIF segment.
+	src := image.NewRGBA(image.Rect(0, 0, 80, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 80; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < 40 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	data := withOrientation(encodeJPEG(t, src), 6)
+	if jpegOrientation(data) != 6 {
+		t.Fatalf("orientation = %d, want 6", jpegOrientation(data))
+	}
+
+	res, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Width != 40 || res.Height != 80 {
+		t.Fatalf("size = %dx%d, want 40x80", res.Width, res.Height)
+	}
+	out := res.Variants[0].Data
+	if bytes.Contains(out, []byte("Exif")) {
+		t.Error("EXIF survived re-encoding")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The left (red) half of the source is now the top.
+	if r, _, b, _ := img.At(20, 10).RGBA(); r < b {
+		t.Errorf("top is not red after rotation")
+	}
+	if r, _, b, _ := img.At(20, 70).RGBA(); b < r {
+		t.Errorf("bottom is not blue after rotation")
+	}
+}
+
+func TestOrientAll(t *testing.T) {
+	// A 2x1 image, A then B. Each orientation says how it was stored;
+	// orient must bring A back to the top left.
+	a, b := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	stored := map[int][][]color.RGBA{
+		1: {{a, b}},
+		2: {{b, a}},
+		3: {{b, a}},
+		4: {{a, b}},
+		5: {{a}, {b}},
+		6: {{b}, {a}},
+		7: {{b}, {a}},
+		8: {{a}, {b}},
+	}
+	for o, rows := range stored {
+		img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+		for y, row := range rows {
+			for x, c := range row {
+				img.Set(x, y, c)
+			}
+		}
+		got := orient(img, o).(interface{ RGBAAt(x, y int) color.RGBA })
+		if got.RGBAAt(0, 0) != a {
+			t.Errorf("orientation %d: top left = %v, want A", o, got.RGBAAt(0, 0))
+		}
+	}
+}
+
+func TestProcessAnimatedGIF(t *testing.T) {
+	pal := color.Palette{color.Black, color.White}
+	g := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 800, 100), pal)
+		frame.SetColorIndex(i, 0, 1)
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Process(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Variants) != 1 {
+		t.Fatalf("got %d variants, want the original only", len(res.Variants))
+	}
+	out, err := gif.DecodeAll(bytes.NewReader(res.Variants[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Image) != 3 {
+		t.Errorf("frames = %d, want 3", len(out.Image))
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
+	if _, err := Process(svg); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("svg: err = %v, want ErrUnsupportedType", err)
+	}
+	if _, err := Process([]byte("GIF89a\x10\x00\x10\x00")); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("truncated gif: err = %v, want ErrUnsupportedType", err)
+	}
+
+	// A PNG header claiming a huge canvas is refused before decoding.
+	huge := encodePNG(t, image.NewGray(image.Rect(0, 0, 1, 1)))
+	binary.BigEndian.PutUint32(huge[16:], 50_000)
+	binary.BigEndian.PutUint32(huge[20:], 50_000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+	if _, err := Process(huge); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("huge: err = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestResizeAverages(t *testing.T) {
+	// Alternating black and white columns average to mid grey.
+	src := image.NewRGBA(image.Rect(0, 0, 100, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 100; x++ {
+			if x%2 == 0 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+	out := Resize(src, 10).(*image.RGBA)
+	if b := out.Bounds(); b.Dx() != 10 || b.Dy() != 1 {
+		t.Fatalf("size = %dx%d, want 10x1", b.Dx(), b.Dy())
+	}
+	if c := out.RGBAAt(5, 0); c.R < 120 || c.R > 135 || c.A != 255 {
+		t.Errorf("pixel = %v, want mid grey", c)
+	}
+}
@@ -0,0 +1,220 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const contacts = "\ufeffE-mail,First Name,Surname,Plan,Tags\n" +
+	"Ann@Example.com,Ann,Lee,pro,\"VIP; Customer\"\n" +
+	"bad\"row,x\n" +
+	"not-an-email,Bob,,,\n"
+
+func TestCSVRows(t *testing.T) {
+	rows, err := Open(strings.NewReader(contacts), int64(len(contacts)), CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if h := rows.Header(); h[0] != "E-mail" {
+		t.Errorf("header = %q", h)
+	}
+
+	record, err := rows.Next()
+	if err != nil || rows.Row() != 2 || record[0] != "Ann@Example.com" {
+		t.Fatalf("row %d = %q, %v", rows.Row(), record, err)
+	}
+	var parseErr *csv.ParseError
+	if _, err := rows.Next(); !errors.As(err, &parseErr) || rows.Row() != 3 {
+		t.Fatalf("row %d: err = %v, want a parse error", rows.Row(), err)
+	}
+	if _, err := rows.Next(); err != nil || rows.Row() != 4 {
+		t.Fatalf("row %d: err = %v", rows.Row(), err)
+	}
+	if _, err := rows.Next(); err != io.EOF {
+		t.Fatalf("err = %v, want EOF", err)
+	}
+	if p := rows.Progress(); p != 100 {
+		t.Errorf("progress = %d, want 100", p)
+	}
+}
+
+func TestXLSXRows(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]string{"Email", "Company"})
+	f.SetSheetRow("Sheet1", "A2", &[]string{"ann@example.com", "Acme"})
+	f.SetSheetRow("Sheet1", "A3", &[]string{"bob@example.com"})
+	f.SetSheetRow("Sheet1", "A4", &[]string{"cy@example.com", "Initech"})
+	// As Excel writes it; progress is counted against it.
+	f.SetSheetDimension("Sheet1", "A1:B4")
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := Open(&buf, int64(buf.Len()), XLSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if h := rows.Header(); !reflect.DeepEqual(h, []string{"Email", "Company"}) {
+		t.Errorf("header = %q", h)
+	}
+	var got [][]string
+	for {
+		record, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, record)
+	}
+	want := [][]string{{"ann@example.com", "Acme"}, {"bob@example.com"}, {"cy@example.com", "Initech"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q", got)
+	}
+	if rows.Row() != 4 || rows.Progress() != 100 {
+		t.Errorf("row = %d, progress = %d", rows.Row(), rows.Progress())
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for name, want := range map[string]Format{"list.CSV": CSV, "list.txt": CSV, "list.xlsx": XLSX} {
+		if f, err := FormatOf(name); f != want || err != nil {
+			t.Errorf("FormatOf(%q) = %q, %v", name, f, err)
+		}
+	}
+	if _, err := FormatOf("list.xls"); err != ErrUnsupportedFormat {
+		t.Errorf("FormatOf(xls) err = %v", err)
+	}
+}
+
+func TestMapper(t *testing.T) {
+	header := []string{"E-mail", "First Name", "Surname", "Plan", "Tags", "Notes", RowColumn, ReasonColumn}
+	m, err := NewMapper(header, map[string]string{"company": "Notes"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := []string{FieldEmail, FieldFirstName, FieldLastName, "custom", FieldTags, FieldCompany, "ignored", "ignored"}
+	for i, c := range m.Columns() {
+		if c.Kind != kinds[i] {
+			t.Errorf("column %q is %s, want %s", c.Header, c.Kind, kinds[i])
+		}
+	}
+	if keys := m.CustomKeys(); !reflect.DeepEqual(keys, []string{"plan"}) {
+		t.Errorf("custom keys = %q", keys)
+	}
+
+	c, tags, reason := m.Contact([]string{" Ann@Example.com ", "Ann", "Lee", "pro", "VIP; Customer,", "Acme"})
+	if reason != "" {
+		t.Fatal(reason)
+	}
+	if c.Email != "ann@example.com" || c.FirstName != "Ann" || c.LastName != "Lee" || c.Company != "Acme" || !c.IsSubscribed {
+		t.Errorf("contact = %+v", c)
+	}
+	if c.CustomFields["plan"] != "pro" {
+		t.Errorf("custom fields = %v", c.CustomFields)
+	}
+	if !reflect.DeepEqual(tags, []string{"VIP", "Customer"}) {
+		t.Errorf("tags = %q", tags)
+	}
+
+	m, err = NewMapper(header, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := m.CustomKeys(); len(keys) != 0 {
+		t.Errorf("ignoring unmapped columns, custom keys = %q", keys)
+	}
+}
+
+func TestMapperReadsExports(t *testing.T) {
+	header := []string{"email", "is_subscribed", "is_bounced", "tags", "custom.Plan", "custom_fields", "created_at"}
+	m, err := NewMapper(header, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := []string{FieldEmail, FieldIsSubscribed, "ignored", FieldTags, "custom", "ignored", "ignored"}
+	for i, c := range m.Columns() {
+		if c.Kind != kinds[i] {
+			t.Errorf("column %q is %s, want %s", c.Header, c.Kind, kinds[i])
+		}
+	}
+	c, tags, reason := m.Contact([]string{"ann@example.com", "false", "true", "VIP, Customer", "pro", "{}", "2024-03-01T09:30:00Z"})
+	if reason != "" || c.IsSubscribed || c.CustomFields["plan"] != "pro" || len(c.CustomFields) != 1 || len(tags) != 2 {
+		t.Errorf("contact = %+v, tags = %q, reason = %q", c, tags, reason)
+	}
+}
+
+func TestMapperErrors(t *testing.T) {
+	if _, err := NewMapper([]string{"Name", "Phone"}, nil, false); err != ErrNoEmailColumn {
+		t.Errorf("no email column: err = %v", err)
+	}
+	for _, mapping := range []map[string]string{
+		{"email": "Missing"},
+		{"nickname": "Name"},
+		{"custom.Plan Name": "Name"},
+	} {
+		if _, err := NewMapper([]string{"Address", "Name"}, mapping, false); !errors.Is(err, ErrInvalidMapping) {
+			t.Errorf("mapping %v: err = %v", mapping, err)
+		}
+	}
+	if _, err := NewMapper([]string{"Address", "Name"}, map[string]string{"email": "address", "custom.nick": "Name"}, false); err != nil {
+		t.Errorf("mapping by header: err = %v", err)
+	}
+}
+
+func TestMapperRejects(t *testing.T) {
+	m, err := NewMapper([]string{"email", "phone", "locale", "subscribed", "tags"}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		record []string
+		reason string
+	}{
+		{[]string{""}, "email is empty"},
+		{[]string{"Ann <ann@example.com>"}, "email is not a valid address"},
+		{[]string{"ann@example.com", strings.Repeat("1", 21)}, "phone is longer than 20 characters"},
+		{[]string{"ann@example.com", "", "english!"}, `locale "english!" is not a language tag`},
+		{[]string{"ann@example.com", "", "", "maybe"}, `is_subscribed "maybe" is not yes or no`},
+		{[]string{"ann@example.com", "", "", "", strings.Repeat("t", 101)}, "is longer than 100 characters"},
+	} {
+		if _, _, reason := m.Contact(tt.record); !strings.Contains(reason, tt.reason) {
+			t.Errorf("Contact(%q) reason = %q, want %q", tt.record, reason, tt.reason)
+		}
+	}
+
+	c, _, reason := m.Contact([]string{"ann@example.com", "", "pt_br", "no"})
+	if reason != "" || c.Locale != "pt-BR" || c.IsSubscribed {
+		t.Errorf("contact = %+v, reason = %q", c, reason)
+	}
+}
+
+func TestRejects(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := NewRejects(&buf, []string{"email", "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Add(3, []string{"bad"}, "email is not a valid address")
+	r.Add(7, nil, `bare " in non-quoted field`)
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "email,name,import_row,import_error\n" +
+		"bad,,3,email is not a valid address\n" +
+		",,7,\"bare \"\" in non-quoted field\"\n"
+	if buf.String() != want || r.Count() != 2 {
+		t.Errorf("rejects (%d) =\n%s", r.Count(), buf.String())
+	}
+}
@@ -0,0 +1,303 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"email_campaign/internal/locale"
+	"email_campaign/internal/types"
+)
+
+// The contact fields a column can fill. Custom fields are mapped as
+// "custom.<key>".
+const (
+	FieldEmail        = "email"
+	FieldFirstName    = "first_name"
+	FieldLastName     = "last_name"
+	FieldPhone        = "phone"
+	FieldCompany      = "company"
+	FieldLocale       = "locale"
+	FieldIsSubscribed = "is_subscribed"
+	FieldTags         = "tags"
+
+	CustomPrefix = "custom."
+)
+
+var knownFields = map[string]bool{
+	FieldEmail: true, FieldFirstName: true, FieldLastName: true, FieldPhone: true, FieldCompany: true,
+	FieldLocale: true, FieldIsSubscribed: true, FieldTags: true,
+}
+
+// aliases are the headers recognised for each field without a mapping,
+// compared as field keys.
+var aliases = map[string]string{
+	"email": FieldEmail, "email_address": FieldEmail, "e_mail": FieldEmail, "e_mail_address": FieldEmail,
+	"first_name": FieldFirstName, "firstname": FieldFirstName, "given_name": FieldFirstName,
+	"last_name": FieldLastName, "lastname": FieldLastName, "surname": FieldLastName, "family_name": FieldLastName,
+	"phone": FieldPhone, "phone_number": FieldPhone, "mobile": FieldPhone,
+	"company": FieldCompany, "company_name": FieldCompany, "organization": FieldCompany,
+	"locale": FieldLocale, "language": FieldLocale,
+	"is_subscribed": FieldIsSubscribed, "subscribed": FieldIsSubscribed,
+	"tags": FieldTags,
+}
+
+// exportOnly are the columns of a contact export that an import does not
+// set.
+var exportOnly = map[string]bool{
+	"id": true, "is_bounced": true, "custom_fields": true, "created_at": true, "updated_at": true,
+}
+
+// Column lengths, as stored.
+var maxLengths = map[string]int{
+	FieldEmail: 255, FieldFirstName: 100, FieldLastName: 100, FieldPhone: 20, FieldCompany: 255,
+}
+
+// MaxTagLength is the longest tag name.
+const MaxTagLength = 100
+
+var (
+	ErrNoEmailColumn  = errors.New("file has no email column; map one with field_mapping")
+	ErrInvalidMapping = errors.New("invalid field_mapping")
+)
+
+// Mapper turns rows of a file into contacts.
+type Mapper struct {
+	fields  map[string]int
+	custom  []customColumn
+	columns []types.ImportColumn
+}
+
+type customColumn struct {
+	index int
+	key   string
+}
+
+// NewMapper works out which column fills which field. mapping maps fields
+// to headers; other columns are matched by name, and those that match no
+// field become custom fields unless ignoreUnmapped is set.
+func NewMapper(header []string, mapping map[string]string, ignoreUnmapped bool) (*Mapper, error) {
+	m := &Mapper{fields: map[string]int{}}
+	index := map[string]int{}
+	for i, h := range header {
+		if _, ok := index[strings.ToLower(strings.TrimSpace(h))]; !ok {
+			index[strings.ToLower(strings.TrimSpace(h))] = i
+		}
+	}
+
+	if err := CheckMapping(mapping); err != nil {
+		return nil, err
+	}
+	taken := map[int]bool{}
+	customKeys := map[string]bool{}
+	for field, h := range mapping {
+		i, ok := index[strings.ToLower(strings.TrimSpace(h))]
+		if !ok {
+			return nil, fmt.Errorf("%w: column %q is not in the file", ErrInvalidMapping, h)
+		}
+		if key, ok := strings.CutPrefix(field, CustomPrefix); ok {
+			m.custom = append(m.custom, customColumn{index: i, key: key})
+			customKeys[key] = true
+		} else {
+			m.fields[field] = i
+		}
+		taken[i] = true
+	}
+
+	for i, h := range header {
+		if taken[i] || h == RowColumn || h == ReasonColumn || strings.TrimSpace(h) == "" {
+			continue
+		}
+		// Contact exports name custom field columns "custom.<key>".
+		if k, ok := strings.CutPrefix(strings.ToLower(strings.TrimSpace(h)), CustomPrefix); ok && k != "" {
+			if key := FieldKey(k); !customKeys[key] {
+				m.custom = append(m.custom, customColumn{index: i, key: key})
+				customKeys[key] = true
+				taken[i] = true
+			}
+			continue
+		}
+		key := FieldKey(h)
+		if exportOnly[key] {
+			continue
+		}
+		if field, ok := aliases[key]; ok {
+			if _, mapped := m.fields[field]; !mapped {
+				m.fields[field] = i
+				taken[i] = true
+				continue
+			}
+		}
+		if !ignoreUnmapped && !customKeys[key] {
+			m.custom = append(m.custom, customColumn{index: i, key: key})
+			customKeys[key] = true
+			taken[i] = true
+		}
+	}
+	if _, ok := m.fields[FieldEmail]; !ok {
+		return nil, ErrNoEmailColumn
+	}
+
+	for i, h := range header {
+		c := types.ImportColumn{Header: h, Kind: "ignored"}
+		for field, j := range m.fields {
+			if i == j {
+				c.Kind = field
+			}
+		}
+		for _, cc := range m.custom {
+			if cc.index == i {
+				c.Kind, c.Key = "custom", cc.key
+			}
+		}
+		m.columns = append(m.columns, c)
+	}
+	return m, nil
+}
+
+// CheckMapping checks that a field mapping names only fields a column can
+// fill.
+func CheckMapping(mapping map[string]string) error {
+	for field := range mapping {
+		if key, ok := strings.CutPrefix(field, CustomPrefix); ok {
+			if key != FieldKey(key) {
+				return fmt.Errorf("%w: %q is not a valid custom field key", ErrInvalidMapping, key)
+			}
+		} else if !knownFields[field] {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidMapping, field)
+		}
+	}
+	return nil
+}
+
+// Columns reports how each column is read.
+func (m *Mapper) Columns() []types.ImportColumn {
+	return m.columns
+}
+
+// CustomKeys lists the custom fields the file fills.
+func (m *Mapper) CustomKeys() []string {
+	keys := make([]string, len(m.custom))
+	for i, c := range m.custom {
+		keys[i] = c.key
+	}
+	return keys
+}
+
+// Contact reads a row. Contacts are subscribed unless the row says
+// otherwise. Tags are the names in the tags column, separated by commas or
+// semicolons. A row that cannot be imported returns the reason.
+func (m *Mapper) Contact(record []string) (*types.ImportedContact, []string, string) {
+	get := func(field string) string {
+		if i, ok := m.fields[field]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	c := &types.ImportedContact{
+		Email:        strings.ToLower(get(FieldEmail)),
+		FirstName:    get(FieldFirstName),
+		LastName:     get(FieldLastName),
+		Phone:        get(FieldPhone),
+		Company:      get(FieldCompany),
+		IsSubscribed: true,
+		CustomFields: map[string]interface{}{},
+	}
+	if c.Email == "" {
+		return nil, nil, "email is empty"
+	}
+	if !ValidEmail(c.Email) {
+		return nil, nil, "email is not a valid address"
+	}
+	for _, f := range []struct{ field, value string }{
+		{FieldFirstName, c.FirstName}, {FieldLastName, c.LastName}, {FieldPhone, c.Phone}, {FieldCompany, c.Company},
+	} {
+		if field := f.field; utf8.RuneCountInString(f.value) > maxLengths[field] {
+			return nil, nil, fmt.Sprintf("%s is longer than %d characters", field, maxLengths[field])
+		}
+	}
+	if tag := get(FieldLocale); tag != "" {
+		n, err := locale.Normalize(tag)
+		if err != nil {
+			return nil, nil, fmt.Sprintf("locale %q is not a language tag", tag)
+		}
+		c.Locale = n
+	}
+	if v := get(FieldIsSubscribed); v != "" {
+		sub, ok := ParseBool(v)
+		if !ok {
+			return nil, nil, fmt.Sprintf("is_subscribed %q is not yes or no", v)
+		}
+		c.IsSubscribed = sub
+	}
+
+	var tags []string
+	for _, name := range strings.FieldsFunc(get(FieldTags), func(r rune) bool { return r == ',' || r == ';' }) {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if utf8.RuneCountInString(name) > MaxTagLength {
+			return nil, nil, fmt.Sprintf("tag %q is longer than %d characters", name, MaxTagLength)
+		}
+		tags = append(tags, name)
+	}
+
+	for _, cc := range m.custom {
+		if cc.index < len(record) {
+			if v := strings.TrimSpace(record[cc.index]); v != "" {
+				c.CustomFields[cc.key] = v
+			}
+		}
+	}
+	return c, tags, ""
+}
+
+// ParseBool reads the ways spreadsheets say yes and no.
+func ParseBool(s string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "y", "yes", "true", "t", "subscribed", "on":
+		return true, true
+	case "0", "n", "no", "false", "f", "unsubscribed", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// ValidEmail accepts a bare address, without a display name.
+func ValidEmail(email string) bool {
+	if len(email) > maxLengths[FieldEmail] {
+		return false
+	}
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// FieldKey turns a column label into a custom field key that merge tags
+// can name: "Company Size" becomes "company_size".
+func FieldKey(label string) string {
+	var b strings.Builder
+	under := false
+	for _, r := range strings.ToLower(strings.TrimSpace(label)) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if under && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			under = false
+		} else {
+			under = true
+		}
+	}
+	key := b.String()
+	if key == "" {
+		return "field"
+	}
+	if key[0] >= '0' && key[0] <= '9' {
+		key = "f_" + key
+	}
+	return key
+}
@@ -0,0 +1,218 @@
+// Package importer reads contact files a row at a time and turns each row
+// into a contact, or into the reason it cannot be one.
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("file must be a .csv or .xlsx file")
+	ErrEmpty             = errors.New("file has no header row")
+)
+
+// FormatOf tells the format from a file name.
+func FormatOf(filename string) (Format, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv", ".txt":
+		return CSV, nil
+	case ".xlsx":
+		return XLSX, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Rows reads a file's rows after its header.
+type Rows interface {
+	Header() []string
+	// Next returns the next row, or io.EOF. A row that cannot be read
+	// returns a *csv.ParseError; reading can go on after it.
+	Next() ([]string, error)
+	// Row is the number of the row Next last returned, counting the
+	// header as row 1.
+	Row() int
+	// Progress is the percentage of the file read so far.
+	Progress() int
+	Close() error
+}
+
+// Open reads the header of a file of size bytes. CSVs are read as they
+// stream in; spreadsheets are read into memory first, then a row at a
+// time.
+func Open(r io.Reader, size int64, f Format) (Rows, error) {
+	switch f {
+	case CSV:
+		return openCSV(r, size)
+	case XLSX:
+		return openXLSX(r)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func percent(done, total int64) int {
+	if total <= 0 {
+		return 0
+	}
+	return int(min(done*100/total, 100))
+}
+
+type csvRows struct {
+	r      *csv.Reader
+	in     *countingReader
+	size   int64
+	header []string
+	row    int
+}
+
+func openCSV(r io.Reader, size int64) (Rows, error) {
+	in := &countingReader{r: r}
+	cr := csv.NewReader(in)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, ErrEmpty
+	}
+	if err != nil {
+		return nil, err
+	}
+	header = append([]string(nil), header...)
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	return &csvRows{r: cr, in: in, size: size, header: header, row: 1}, nil
+}
+
+func (c *csvRows) Header() []string { return c.header }
+func (c *csvRows) Row() int         { return c.row }
+func (c *csvRows) Progress() int    { return percent(c.in.n, c.size) }
+func (c *csvRows) Close() error     { return nil }
+
+func (c *csvRows) Next() ([]string, error) {
+	record, err := c.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	c.row++
+	return record, err
+}
+
+type xlsxRows struct {
+	f      *excelize.File
+	rows   *excelize.Rows
+	header []string
+	row    int
+	// total is the row count the sheet declares, if it does.
+	total int
+}
+
+func openXLSX(r io.Reader) (Rows, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	sheet := f.GetSheetName(0)
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	x := &xlsxRows{f: f, rows: rows}
+	if dim, err := f.GetSheetDimension(sheet); err == nil {
+		if _, last, ok := strings.Cut(dim, ":"); ok {
+			_, x.total, _ = excelize.CellNameToCoordinates(last)
+		}
+	}
+	header, err := x.Next()
+	if err != nil {
+		x.Close()
+		if err == io.EOF {
+			return nil, ErrEmpty
+		}
+		return nil, err
+	}
+	x.header = header
+	return x, nil
+}
+
+func (x *xlsxRows) Header() []string { return x.header }
+func (x *xlsxRows) Row() int         { return x.row }
+func (x *xlsxRows) Progress() int    { return percent(int64(x.row), int64(x.total)) }
+
+func (x *xlsxRows) Next() ([]string, error) {
+	if !x.rows.Next() {
+		if err := x.rows.Error(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	x.row++
+	return x.rows.Columns()
+}
+
+func (x *xlsxRows) Close() error {
+	x.rows.Close()
+	return x.f.Close()
+}
+
+// Rejected rows are written with the file's own columns followed by these
+// two, so the file can be fixed and imported again. The mapper ignores
+// them.
+const (
+	RowColumn    = "import_row"
+	ReasonColumn = "import_error"
+)
+
+// Rejects writes rejected rows as CSV.
+type Rejects struct {
+	w     *csv.Writer
+	width int
+	count int
+}
+
+func NewRejects(w io.Writer, header []string) (*Rejects, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append(append([]string(nil), header...), RowColumn, ReasonColumn)); err != nil {
+		return nil, err
+	}
+	return &Rejects{w: cw, width: len(header)}, nil
+}
+
+func (r *Rejects) Add(row int, record []string, reason string) error {
+	out := make([]string, r.width, r.width+2)
+	copy(out, record)
+	r.count++
+	return r.w.Write(append(out, strconv.Itoa(row), reason))
+}
+
+func (r *Rejects) Count() int { return r.count }
+
+func (r *Rejects) Flush() error {
+	r.w.Flush()
+	return r.w.Error()
+}
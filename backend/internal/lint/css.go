@@ -0,0 +1,199 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+)
+
+// decl is one CSS declaration. offset is where it starts in the text it
+// was parsed from; conditional is set inside @media, @supports and other
+// at-rule blocks.
+type decl struct {
+	prop        string
+	value       string
+	offset      int
+	conditional bool
+}
+
+// blankComments replaces CSS comments with spaces, keeping offsets.
+func blankComments(css string) string {
+	b := []byte(css)
+	for i := 0; i+1 < len(b); i++ {
+		if b[i] != '/' || b[i+1] != '*' {
+			continue
+		}
+		end := strings.Index(css[i+2:], "*/")
+		stop := len(b)
+		if end >= 0 {
+			stop = i + 2 + end + 2
+		}
+		for j := i; j < stop; j++ {
+			if b[j] != '\n' {
+				b[j] = ' '
+			}
+		}
+		i = stop - 1
+	}
+	return string(b)
+}
+
+// parseDeclarations splits the body of a rule or a style attribute.
+func parseDeclarations(body string, base int) []decl {
+	var decls []decl
+	start := 0
+	for i := 0; i <= len(body); i++ {
+		if i < len(body) && body[i] != ';' {
+			continue
+		}
+		if d, ok := parseDeclaration(body[start:i], base+start); ok {
+			decls = append(decls, d)
+		}
+		start = i + 1
+	}
+	return decls
+}
+
+func parseDeclaration(s string, offset int) (decl, bool) {
+	colon := strings.IndexByte(s, ':')
+	if colon < 0 {
+		return decl{}, false
+	}
+	prop := strings.ToLower(strings.TrimSpace(s[:colon]))
+	if prop == "" {
+		return decl{}, false
+	}
+	value := strings.TrimSpace(s[colon+1:])
+	value = strings.TrimSpace(strings.TrimSuffix(strings.ToLower(value), "!important"))
+	lead := len(s) - len(strings.TrimLeft(s, " \t\r\n"))
+	return decl{prop: prop, value: value, offset: offset + lead}, true
+}
+
+// parseStylesheet lists every declaration in a style sheet. Segments ended
+// by '{' are selectors or at-rule preludes; the rest are declarations.
+func parseStylesheet(css string) []decl {
+	css = blankComments(css)
+	var decls []decl
+	// Each open block records whether it, or a block around it, is an
+	// at-rule such as @media.
+	var blocks []bool
+	conditional := func() bool { return len(blocks) > 0 && blocks[len(blocks)-1] }
+
+	start := 0
+	for i := 0; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			prelude := strings.TrimSpace(css[start:i])
+			blocks = append(blocks, conditional() || strings.HasPrefix(prelude, "@"))
+			start = i + 1
+		case '}':
+			if len(blocks) > 0 {
+				if d, ok := parseDeclaration(css[start:i], start); ok {
+					d.conditional = conditional()
+					decls = append(decls, d)
+				}
+				blocks = blocks[:len(blocks)-1]
+			}
+			start = i + 1
+		case ';':
+			if len(blocks) > 0 {
+				if d, ok := parseDeclaration(css[start:i], start); ok {
+					d.conditional = conditional()
+					decls = append(decls, d)
+				}
+			}
+			start = i + 1
+		}
+	}
+	return decls
+}
+
+// parseImports returns the offsets of @import rules.
+func parseImports(css string) []int {
+	css = strings.ToLower(blankComments(css))
+	var offsets []int
+	for i := 0; ; {
+		j := strings.Index(css[i:], "@import")
+		if j < 0 {
+			return offsets
+		}
+		offsets = append(offsets, i+j)
+		i += j + len("@import")
+	}
+}
+
+// unsupported describes a CSS property that major clients drop. when
+// narrows it to the values that are a problem.
+type unsupported struct {
+	severity Severity
+	clients  string
+	when     func(value string) bool
+}
+
+func anyValue(string) bool { return true }
+
+func hasURL(v string) bool { return strings.Contains(v, "url(") }
+
+func oneOf(values ...string) func(string) bool {
+	return func(v string) bool {
+		for _, x := range values {
+			if v == x {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func noneOf(values ...string) func(string) bool {
+	match := oneOf(values...)
+	return func(v string) bool { return !match(v) }
+}
+
+// cssProperties lists what fails in Gmail, Outlook for Windows, Yahoo and
+// Apple Mail, per caniemail.com. Things that merely look plainer, like
+// square corners, are info.
+var cssProperties = map[string]unsupported{
+	"position":         {SeverityWarning, "Gmail, Outlook (Windows) and Yahoo", noneOf("static")},
+	"display":          {SeverityWarning, "Outlook (Windows) and Gmail for non-Google accounts", oneOf("flex", "inline-flex", "grid", "inline-grid")},
+	"float":            {SeverityWarning, "Outlook (Windows)", noneOf("none")},
+	"background-image": {SeverityWarning, "Outlook (Windows), which needs a VML fallback", hasURL},
+	"background":       {SeverityWarning, "Outlook (Windows), which needs a VML fallback", hasURL},
+	"transform":        {SeverityWarning, "Gmail and Outlook", anyValue},
+	"transition":       {SeverityWarning, "Gmail and Outlook", anyValue},
+	"animation":        {SeverityWarning, "Gmail and Outlook", anyValue},
+	"filter":           {SeverityWarning, "Gmail and Outlook", anyValue},
+	"clip-path":        {SeverityWarning, "Gmail and Outlook", anyValue},
+	"object-fit":       {SeverityWarning, "Gmail and Outlook (Windows)", anyValue},
+	"box-shadow":       {SeverityInfo, "Outlook (Windows) and Gmail", anyValue},
+	"text-shadow":      {SeverityInfo, "Outlook (Windows)", anyValue},
+	"border-radius":    {SeverityInfo, "Outlook (Windows)", anyValue},
+}
+
+// cssSupport reports a declaration that major clients do not support.
+func cssSupport(prop, value string) (string, Severity, bool) {
+	if strings.HasPrefix(prop, "--") || strings.Contains(value, "var(") {
+		return "CSS custom properties (var()) are not supported in Gmail or Outlook (Windows)", SeverityWarning, true
+	}
+	// Vendor prefixes fail the same way as the property itself.
+	name := prop
+	if strings.HasPrefix(name, "-") {
+		if i := strings.IndexByte(name[1:], '-'); i >= 0 {
+			name = name[i+2:]
+		}
+	}
+	if strings.HasPrefix(name, "animation-") {
+		name = "animation"
+	}
+	if strings.HasPrefix(name, "transition-") {
+		name = "transition"
+	}
+	u, ok := cssProperties[name]
+	if !ok || !u.when(value) {
+		return "", "", false
+	}
+	subject := prop
+	if name == "display" || name == "position" || name == "float" {
+		subject = prop + ": " + value
+	}
+	return fmt.Sprintf("%s is not supported in %s", subject, u.clients), u.severity, true
+}
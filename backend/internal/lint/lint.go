@@ -0,0 +1,515 @@
+// Package lint checks email HTML for things that break or degrade it in
+// common mail clients: size, images, CSS support, missing preview text and
+// title, active content and too little text.
+package lint
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	// SeverityInfo findings degrade gracefully and do not affect Status.
+	SeverityInfo Severity = "info"
+)
+
+// Status summarizes a report for badges: the worst severity found, or
+// "ok" when there are only info findings.
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusWarning Status = "warning"
+	StatusError   Status = "error"
+)
+
+const (
+	// ClipSize is where Gmail cuts a message off behind a "View entire
+	// message" link.
+	ClipSize = 102 * 1024
+	// NearClipSize warns while there is still room to trim.
+	NearClipSize = 92 * 1024
+
+	// MinTextPerImage is the visible text, in characters, expected for
+	// each image before a message looks image-heavy to spam filters.
+	MinTextPerImage = 100
+	// MinText is the least text a message with images should carry.
+	MinText = 20
+)
+
+// Finding is one problem. Line and Column are 1-based and point at the
+// tag or declaration concerned; they are 0 for findings about the whole
+// message. Count is how many times the same problem occurs; the location
+// is its first.
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Count    int      `json:"count,omitempty"`
+}
+
+type Report struct {
+	Status     Status    `json:"status"`
+	Errors     int       `json:"errors"`
+	Warnings   int       `json:"warnings"`
+	Size       int       `json:"size"`
+	TextLength int       `json:"text_length"`
+	Images     int       `json:"images"`
+	Findings   []Finding `json:"findings"`
+}
+
+// Options adjusts a check. SentSize is the size of the message as it
+// goes out, when that differs from the HTML checked, for example once CSS
+// has been inlined.
+type Options struct {
+	SentSize int
+}
+
+// Check lints an HTML document.
+func Check(body string, opts Options) (*Report, error) {
+	c := &checker{src: body, lines: lineStarts(body), seen: map[string]int{}, findings: []Finding{}}
+	if err := c.walk(); err != nil {
+		return nil, err
+	}
+	c.finish(opts)
+
+	r := &Report{
+		Status:     StatusOK,
+		Size:       len(body),
+		TextLength: c.text,
+		Images:     c.images,
+		Findings:   c.findings,
+	}
+	if opts.SentSize > 0 {
+		r.Size = opts.SentSize
+	}
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		a, b := r.Findings[i], r.Findings[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	for _, f := range r.Findings {
+		switch f.Severity {
+		case SeverityError:
+			r.Errors++
+		case SeverityWarning:
+			r.Warnings++
+		}
+	}
+	switch {
+	case r.Errors > 0:
+		r.Status = StatusError
+	case r.Warnings > 0:
+		r.Status = StatusWarning
+	}
+	return r, nil
+}
+
+type openTag struct {
+	name   string
+	hidden bool
+}
+
+type checker struct {
+	src      string
+	lines    []int
+	findings []Finding
+	// seen maps a finding's key to its index, so repeats are counted
+	// instead of listed.
+	seen map[string]int
+
+	stack    []openTag
+	hidden   int
+	inHead   bool
+	inTitle  bool
+	inStyle  bool
+	skipText int
+
+	title      string
+	hasTitle   bool
+	sawText    bool
+	hasPreview bool
+	text       int
+	images     int
+}
+
+func (c *checker) walk() error {
+	z := html.NewTokenizer(strings.NewReader(c.src))
+	offset := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return nil
+			}
+			return z.Err()
+		}
+		pos := offset
+		offset += len(z.Raw())
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			c.startTag(&tok, pos, tt == html.SelfClosingTagToken)
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			c.endTag(string(name))
+		case html.TextToken:
+			c.textToken(string(z.Raw()), pos)
+		}
+	}
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+func (c *checker) startTag(tok *html.Token, pos int, selfClosing bool) {
+	name := tok.Data
+	switch name {
+	case "head":
+		c.inHead = true
+	case "title":
+		c.inTitle = true
+		c.hasTitle = true
+	case "style":
+		c.inStyle = true
+	case "script":
+		c.add("javascript", SeverityError, pos, name, "<script> is removed or blocked by every major email client")
+		c.skipText++
+	case "link":
+		if strings.Contains(strings.ToLower(attr(tok, "rel")), "stylesheet") {
+			c.add("external-css", SeverityError, pos, attr(tok, "href"),
+				"external stylesheets are not loaded by Gmail or Outlook; put the CSS in a <style> block or inline it")
+		}
+	case "form", "input", "button", "select", "textarea":
+		c.add("form", SeverityWarning, pos, name,
+			fmt.Sprintf("<%s>: forms do not work in Gmail, Outlook or Apple Mail; link to a web page instead", name))
+	case "iframe", "object", "embed", "frame", "frameset", "applet":
+		c.add("embedded-content", SeverityError, pos, name, fmt.Sprintf("<%s> is not supported in email", name))
+	case "img":
+		c.image(tok, pos)
+	}
+
+	for _, a := range tok.Attr {
+		key := strings.ToLower(a.Key)
+		if strings.HasPrefix(key, "on") && len(key) > 2 {
+			c.add("javascript", SeverityError, pos, key, fmt.Sprintf("%s event handler: JavaScript does not run in email", key))
+		}
+		if (key == "href" || key == "src" || key == "action") &&
+			strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.Val)), "javascript:") {
+			c.add("javascript", SeverityError, pos, key+"=javascript:", "javascript: URLs do not run in email")
+		}
+	}
+	style := attr(tok, "style")
+	if style != "" {
+		for _, d := range parseDeclarations(style, 0) {
+			c.declaration(d, pos)
+		}
+	}
+
+	if voidElements[name] || selfClosing {
+		return
+	}
+	hidden := hiddenElement(tok)
+	c.stack = append(c.stack, openTag{name: name, hidden: hidden})
+	if hidden {
+		c.hidden++
+	}
+}
+
+func (c *checker) endTag(name string) {
+	switch name {
+	case "head":
+		c.inHead = false
+	case "title":
+		c.inTitle = false
+	case "style":
+		c.inStyle = false
+	case "script":
+		if c.skipText > 0 {
+			c.skipText--
+		}
+	}
+	for i := len(c.stack) - 1; i >= 0; i-- {
+		if c.stack[i].name != name {
+			continue
+		}
+		for _, t := range c.stack[i:] {
+			if t.hidden {
+				c.hidden--
+			}
+		}
+		c.stack = c.stack[:i]
+		return
+	}
+}
+
+func (c *checker) textToken(raw string, pos int) {
+	switch {
+	case c.inStyle:
+		c.stylesheet(raw, pos)
+		return
+	case c.inTitle:
+		c.title += html.UnescapeString(raw)
+		return
+	case c.skipText > 0, c.inHead:
+		return
+	}
+	text := strings.Join(strings.Fields(html.UnescapeString(raw)), " ")
+	if text == "" {
+		return
+	}
+	if c.hidden > 0 {
+		// Clients preview the first text of the body; hidden text there
+		// is the preheader.
+		if !c.sawText {
+			c.hasPreview = true
+		}
+		return
+	}
+	c.sawText = true
+	c.text += utf8.RuneCountInString(text)
+}
+
+func (c *checker) image(tok *html.Token, pos int) {
+	src := strings.TrimSpace(attr(tok, "src"))
+	width, height := attr(tok, "width"), attr(tok, "height")
+	decls := parseDeclarations(attr(tok, "style"), 0)
+	for _, d := range decls {
+		switch d.prop {
+		case "width":
+			width = d.value
+		case "height":
+			height = d.value
+		}
+	}
+	// Tracking pixels are neither content nor worth describing, and
+	// icons are too small to count against the text.
+	pixel := isPixel(width) && isPixel(height)
+	if !pixel && !isIcon(width, height) && c.hidden == 0 {
+		c.images++
+	}
+
+	if !hasAttr(tok, "alt") && !pixel {
+		c.add("img-alt", SeverityWarning, pos, "img-alt:"+src,
+			"image has no alt text, so nothing shows while images are blocked; use alt=\"\" for decoration")
+	}
+	if width == "" || height == "" {
+		c.add("img-dimensions", SeverityWarning, pos, "img-dimensions:"+src,
+			"image has no width or height; Outlook shows it at full size and the layout shifts while it loads")
+	}
+	c.imageURL(src, pos)
+}
+
+func (c *checker) imageURL(src string, pos int) {
+	lower := strings.ToLower(src)
+	switch {
+	case src == "":
+		c.add("img-url", SeverityError, pos, "img-url:", "image has no src")
+	case strings.Contains(src, "{{"):
+		// Filled in per recipient.
+	case strings.HasPrefix(lower, "https:"), strings.HasPrefix(lower, "cid:"):
+	case strings.HasPrefix(lower, "http:"):
+		c.add("img-url", SeverityWarning, pos, "img-url:"+src,
+			fmt.Sprintf("image %s is served over http:; some clients block it or mark the message as not secure", src))
+	case strings.HasPrefix(lower, "data:"):
+		c.add("img-url", SeverityWarning, pos, "img-url:data",
+			"data: URI images are blocked by Gmail and Outlook; upload the image instead")
+	case strings.HasPrefix(src, "//"):
+		c.add("img-url", SeverityError, pos, "img-url:"+src,
+			fmt.Sprintf("image %s has no scheme; email clients have no page to resolve it against, use https:", src))
+	default:
+		if u, err := url.Parse(src); err != nil || u.Scheme == "" {
+			c.add("img-url", SeverityError, pos, "img-url:"+src,
+				fmt.Sprintf("image %s is a relative URL and will not load in email; use an absolute https: URL", src))
+		}
+	}
+}
+
+// stylesheet checks the declarations of a <style> block. Rules inside
+// @media and other conditional blocks are progressive enhancement and are
+// left alone.
+func (c *checker) stylesheet(css string, pos int) {
+	for _, imp := range parseImports(css) {
+		c.add("external-css", SeverityError, pos+imp, "@import",
+			"@import stylesheets are not loaded by Gmail or Outlook; put the CSS in the message")
+	}
+	for _, d := range parseStylesheet(css) {
+		if !d.conditional {
+			c.declaration(d, pos+d.offset)
+		}
+	}
+}
+
+func (c *checker) declaration(d decl, pos int) {
+	if msg, sev, ok := cssSupport(d.prop, d.value); ok {
+		c.add("css-support", sev, pos, "css:"+msg, msg)
+	}
+}
+
+func (c *checker) finish(opts Options) {
+	size := len(c.src)
+	if opts.SentSize > 0 {
+		size = opts.SentSize
+	}
+	switch {
+	case size > ClipSize:
+		f := Finding{
+			Rule:     "size",
+			Severity: SeverityError,
+			Message: fmt.Sprintf("message is %s; Gmail clips messages over %s, hiding the rest and the unsubscribe link",
+				kb(size), kb(ClipSize)),
+		}
+		if opts.SentSize == 0 {
+			f.Line, f.Column = c.location(ClipSize)
+			f.Message += "; the cut falls here"
+		}
+		c.findings = append(c.findings, f)
+	case size > NearClipSize:
+		c.findings = append(c.findings, Finding{
+			Rule:     "size",
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("message is %s, close to the %s at which Gmail clips it", kb(size), kb(ClipSize)),
+		})
+	}
+
+	if !c.hasTitle || strings.TrimSpace(c.title) == "" {
+		c.findings = append(c.findings, Finding{
+			Rule:     "title",
+			Severity: SeverityWarning,
+			Message:  "document has no <title>; some clients and the web version show it",
+		})
+	}
+	if !c.hasPreview {
+		c.findings = append(c.findings, Finding{
+			Rule:     "preheader",
+			Severity: SeverityWarning,
+			Message:  "no preheader: inbox previews will show the first text of the message instead of a summary",
+		})
+	}
+
+	switch {
+	case c.images > 0 && c.text < MinText:
+		c.findings = append(c.findings, Finding{
+			Rule:     "text-ratio",
+			Severity: SeverityError,
+			Message:  "message is images with almost no text; it looks like spam and shows nothing while images are blocked",
+		})
+	case c.images > 0 && c.text < c.images*MinTextPerImage:
+		c.findings = append(c.findings, Finding{
+			Rule:     "text-ratio",
+			Severity: SeverityWarning,
+			Message: fmt.Sprintf("%d characters of text for %d images; aim for at least %d per image to keep clear of spam filters",
+				c.text, c.images, MinTextPerImage),
+		})
+	}
+}
+
+// add records a finding at byte offset pos, or counts it against an
+// earlier finding with the same key.
+func (c *checker) add(rule string, sev Severity, pos int, key string, msg string) {
+	key = rule + "\x00" + key
+	if i, ok := c.seen[key]; ok {
+		c.findings[i].Count++
+		return
+	}
+	line, col := c.location(pos)
+	c.seen[key] = len(c.findings)
+	c.findings = append(c.findings, Finding{Rule: rule, Severity: sev, Message: msg, Line: line, Column: col, Count: 1})
+}
+
+func lineStarts(s string) []int {
+	starts := []int{0}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+func (c *checker) location(pos int) (int, int) {
+	if pos > len(c.src) {
+		pos = len(c.src)
+	}
+	i := sort.Search(len(c.lines), func(i int) bool { return c.lines[i] > pos }) - 1
+	return i + 1, utf8.RuneCountInString(c.src[c.lines[i]:pos]) + 1
+}
+
+func kb(n int) string {
+	return fmt.Sprintf("%.1f KB", float64(n)/1024)
+}
+
+func attr(tok *html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(tok *html.Token, key string) bool {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func isPixel(v string) bool {
+	v = strings.TrimSuffix(strings.TrimSpace(v), "px")
+	return v == "0" || v == "1"
+}
+
+// IconSize is the largest image, in pixels each way, treated as an icon.
+const IconSize = 48
+
+func isIcon(width, height string) bool {
+	w, errW := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(width), "px"))
+	h, errH := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(height), "px"))
+	return errW == nil && errH == nil && w <= IconSize && h <= IconSize
+}
+
+// hiddenElement reports whether an element is hidden the ways preheaders
+// are hidden.
+func hiddenElement(tok *html.Token) bool {
+	if hasAttr(tok, "hidden") {
+		return true
+	}
+	for _, key := range []string{"class", "id"} {
+		v := strings.ToLower(attr(tok, key))
+		if strings.Contains(v, "preheader") || strings.Contains(v, "preview") {
+			return true
+		}
+	}
+	for _, d := range parseDeclarations(attr(tok, "style"), 0) {
+		switch {
+		case d.prop == "display" && d.value == "none",
+			d.prop == "visibility" && d.value == "hidden",
+			d.prop == "mso-hide" && d.value == "all",
+			d.prop == "max-height" && isPixel(d.value),
+			d.prop == "opacity" && d.value == "0":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"email_campaign/internal/mjml"
+)
+
+const clean = `<!doctype html>
+<html>
+<head>
+<title>Spring news</title>
+<style>
+p { margin: 0; border-radius: 4px }
+@media (max-width: 480px) { .col { display: flex !important } }
+</style>
+</head>
+<body>
+<div style="display:none;max-height:0;overflow:hidden">The spring range is here</div>
+<table role="presentation"><tr><td>
+<img src="https://cdn.acme.test/hero.png" alt="Spring range" width="600" height="300">
+<p>Our spring range has landed, with new colours across the whole collection and free delivery on every order this month. Come and see it in store or online before it sells out.</p>
+<img src="{{ contact.custom.avatar }}" alt="" width="40" height="40">
+<img src="https://t.acme.test/o.gif" width="1" height="1">
+</td></tr></table>
+</body>
+</html>`
+
+func rules(r *Report) map[string]Finding {
+	m := map[string]Finding{}
+	for _, f := range r.Findings {
+		if _, ok := m[f.Rule]; !ok {
+			m[f.Rule] = f
+		}
+	}
+	return m
+}
+
+func TestCheckClean(t *testing.T) {
+	r, err := Check(clean, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != StatusOK || r.Errors != 0 || r.Warnings != 0 {
+		t.Fatalf("status %s, findings %+v", r.Status, r.Findings)
+	}
+	// Only the rounded corners, which Outlook squares off.
+	if len(r.Findings) != 1 || r.Findings[0].Severity != SeverityInfo {
+		t.Errorf("findings = %+v", r.Findings)
+	}
+	if r.Images != 1 {
+		t.Errorf("images = %d, want 1 without the icon and tracking pixel", r.Images)
+	}
+	if r.Size != len(clean) {
+		t.Errorf("size = %d", r.Size)
+	}
+}
+
+func TestCheckCompiledMJML(t *testing.T) {
+	html, err := mjml.Compile(`<mjml>
+  <mj-head><mj-title>News</mj-title><mj-preview>This month at Acme</mj-preview></mj-head>
+  <mj-body>
+    <mj-section><mj-column>
+      <mj-image src="https://acme.test/logo.png" alt="Acme" width="200px" height="80px" />
+      <mj-text>Everything that happened at Acme this month, from new stores to the products our customers liked best.</mj-text>
+      <mj-button href="https://acme.test">Visit</mj-button>
+    </mj-column></mj-section>
+  </mj-body>
+</mjml>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Check(html, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != StatusOK {
+		t.Errorf("compiled MJML: %+v", r.Findings)
+	}
+}
+
+func TestCheckFindings(t *testing.T) {
+	body := `<html><head>
+<link rel="stylesheet" href="https://acme.test/mail.css">
+<style>
+@import url("https://fonts.test/font.css");
+.box { position: absolute; display: flex; }
+/* float: left; */
+.col { float: left }
+</style>
+</head>
+<body>
+<p onclick="track()">Hi</p>
+<script>alert(1)</script>
+<a href="javascript:void(0)">x</a>
+<img src="/images/logo.png">
+<img src="http://acme.test/a.png" alt="A" style="width:10px;height:10px">
+<img src="//acme.test/b.png" alt="B" width="10" height="10">
+<img src="data:image/png;base64,AAAA" alt="C" width="10" height="10">
+<form action="/subscribe"><input name="email"><button>Go</button></form>
+<iframe src="https://acme.test/video"></iframe>
+<div style="transform: rotate(2deg); color: var(--brand)">x</div>
+<div style="transform: none">y</div>
+</body></html>`
+	r, err := Check(body, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != StatusError {
+		t.Errorf("status = %s", r.Status)
+	}
+
+	want := map[string][]string{
+		"external-css":     {"external stylesheets", "@import"},
+		"css-support":      {"position: absolute", "display: flex", "float: left", "transform", "var()"},
+		"javascript":       {"<script>", "onclick", "javascript: URLs"},
+		"img-url":          {"/images/logo.png is a relative URL", "http:", "//acme.test/b.png has no scheme", "data: URI"},
+		"img-alt":          {"no alt text"},
+		"img-dimensions":   {"no width or height"},
+		"form":             {"<form>", "<input>", "<button>"},
+		"embedded-content": {"<iframe>"},
+		"title":            {"no <title>"},
+		"preheader":        {"no preheader"},
+		"text-ratio":       {"almost no text"},
+	}
+	for rule, msgs := range want {
+		for _, msg := range msgs {
+			found := false
+			for _, f := range r.Findings {
+				if f.Rule == rule && strings.Contains(f.Message, msg) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("no %s finding mentioning %q", rule, msg)
+			}
+		}
+	}
+
+	// The commented-out float is not reported, so float: left is on line 7.
+	for _, f := range r.Findings {
+		switch {
+		case strings.Contains(f.Message, "float: left"):
+			if f.Line != 7 || f.Column != 8 {
+				t.Errorf("float at %d:%d, want 7:8", f.Line, f.Column)
+			}
+		case f.Rule == "external-css" && strings.Contains(f.Message, "@import"):
+			if f.Line != 4 || f.Column != 1 {
+				t.Errorf("@import at %d:%d, want 4:1", f.Line, f.Column)
+			}
+		case strings.Contains(f.Message, "onclick"):
+			if f.Line != 11 || f.Column != 1 {
+				t.Errorf("onclick at %d:%d, want 11:1", f.Line, f.Column)
+			}
+		}
+	}
+}
+
+func TestCheckCountsRepeats(t *testing.T) {
+	body := `<title>x</title><div style="display:none">preview</div>
+<p>` + strings.Repeat("text ", 100) + `</p>
+<div style="position:relative">a</div>
+<div style="position:relative">b</div>
+<div style="position:relative">c</div>`
+	r, err := Check(body, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Findings) != 1 {
+		t.Fatalf("findings = %+v", r.Findings)
+	}
+	f := r.Findings[0]
+	if f.Count != 3 || f.Line != 3 {
+		t.Errorf("finding = %+v, want 3 occurrences from line 3", f)
+	}
+}
+
+func TestCheckPreheaderMustComeFirst(t *testing.T) {
+	body := `<title>x</title><p>` + strings.Repeat("visible ", 20) + `</p><span class="preheader">late</span>`
+	r, _ := Check(body, Options{})
+	if _, ok := rules(r)["preheader"]; !ok {
+		t.Error("hidden text after visible text counted as a preheader")
+	}
+}
+
+func TestCheckSize(t *testing.T) {
+	head := `<title>x</title><div style="display:none">preview</div><p>`
+	body := head + strings.Repeat("a", ClipSize) + `</p>`
+	r, _ := Check(body, Options{})
+	f, ok := rules(r)["size"]
+	if !ok || f.Severity != SeverityError {
+		t.Fatalf("size finding = %+v", f)
+	}
+	if f.Line != 1 || f.Column != ClipSize+1 {
+		t.Errorf("clip point at %d:%d", f.Line, f.Column)
+	}
+
+	r, _ = Check(clean, Options{SentSize: NearClipSize + 1})
+	f, ok = rules(r)["size"]
+	if !ok || f.Severity != SeverityWarning || f.Line != 0 {
+		t.Errorf("near-limit finding = %+v", f)
+	}
+	if r.Size != NearClipSize+1 {
+		t.Errorf("size = %d", r.Size)
+	}
+}
+
+func TestCheckTextRatio(t *testing.T) {
+	img := `<img src="https://a.test/x.png" alt="x" width="300" height="200">`
+	body := `<title>x</title><div style="display:none">preview</div><p>` + strings.Repeat("word ", 30) + `</p>` + strings.Repeat(img, 3)
+	r, _ := Check(body, Options{})
+	f, ok := rules(r)["text-ratio"]
+	if !ok || f.Severity != SeverityWarning {
+		t.Errorf("text-ratio = %+v (text %d, images %d)", f, r.TextLength, r.Images)
+	}
+}
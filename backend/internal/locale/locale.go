@@ -0,0 +1,146 @@
+// Package locale normalizes language tags and picks the closest of a set
+// of translations for a contact.
+package locale
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Default is the locale assumed when a user has not chosen one.
+const Default = "en"
+
+// ErrInvalid is returned for strings that are not language tags.
+var ErrInvalid = errors.New("locale must be a language tag such as en, hi or es-MX")
+
+// Normalize returns tag in canonical case: a lowercase language, a title
+// case script and an uppercase region, joined by hyphens. Underscores are
+// accepted as separators, so es_mx becomes es-MX.
+func Normalize(tag string) (string, error) {
+	tag = strings.TrimSpace(strings.ReplaceAll(tag, "_", "-"))
+	if tag == "" || len(tag) > 35 {
+		return "", ErrInvalid
+	}
+	parts := strings.Split(tag, "-")
+	for i, p := range parts {
+		if p == "" || len(p) > 8 || !alnum(p) {
+			return "", ErrInvalid
+		}
+		switch {
+		case i == 0:
+			if len(p) < 2 || len(p) > 3 || !alpha(p) {
+				return "", ErrInvalid
+			}
+			parts[i] = strings.ToLower(p)
+		case len(p) == 4 && alpha(p):
+			parts[i] = strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		case len(p) == 2 && alpha(p), len(p) == 3 && digits(p):
+			parts[i] = strings.ToUpper(p)
+		default:
+			parts[i] = strings.ToLower(p)
+		}
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+// Language is the primary language subtag of a normalized tag.
+func Language(tag string) string {
+	lang, _, _ := strings.Cut(tag, "-")
+	return lang
+}
+
+// Match picks the best of available for a contact who wants want:
+//
+//  1. the same tag;
+//  2. a shorter form of it, so es-MX falls back to es;
+//  3. any other variant of the same language, so es-MX takes es-ES when
+//     no plain es exists.
+//
+// Tags that fail to normalize never match. ok is false when nothing in
+// available shares want's language.
+func Match(want string, available []string) (string, bool) {
+	want, err := Normalize(want)
+	if err != nil {
+		return "", false
+	}
+	have := make(map[string]string, len(available))
+	for _, a := range available {
+		if n, err := Normalize(a); err == nil {
+			have[n] = a
+		}
+	}
+
+	for tag := want; ; {
+		if a, ok := have[tag]; ok {
+			return a, true
+		}
+		i := strings.LastIndexByte(tag, '-')
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+
+	lang := Language(want)
+	var siblings []string
+	for n := range have {
+		if Language(n) == lang {
+			siblings = append(siblings, n)
+		}
+	}
+	if len(siblings) == 0 {
+		return "", false
+	}
+	// Shortest first, then alphabetical, so the choice is stable.
+	sort.Slice(siblings, func(i, j int) bool {
+		if len(siblings[i]) != len(siblings[j]) {
+			return len(siblings[i]) < len(siblings[j])
+		}
+		return siblings[i] < siblings[j]
+	})
+	return have[siblings[0]], true
+}
+
+// Resolve tries each preference in turn, typically the contact's locale
+// and then the user's default, and returns the first match. ok is false
+// when none match and the caller should use its untranslated content.
+func Resolve(available []string, preferences ...string) (string, bool) {
+	for _, p := range preferences {
+		if p == "" {
+			continue
+		}
+		if tag, ok := Match(p, available); ok {
+			return tag, true
+		}
+	}
+	return "", false
+}
+
+func alpha(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func alnum(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !alpha(s[i:i+1]) && !digits(s[i:i+1]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package locale
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"en":          "en",
+		"EN":          "en",
+		"es_mx":       "es-MX",
+		" hi-in ":     "hi-IN",
+		"zh-hant-tw":  "zh-Hant-TW",
+		"es-419":      "es-419",
+		"de-ch-1996":  "de-CH-1996",
+		"sr-LATN-rs":  "sr-Latn-RS",
+		"fil":         "fil",
+		"en-US-posix": "en-US-posix",
+	} {
+		got, err := Normalize(in)
+		if err != nil || got != want {
+			t.Errorf("Normalize(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "e", "english", "en--US", "en-", "1en", "en US", "en-toolongsubtag"} {
+		if got, err := Normalize(in); err != ErrInvalid {
+			t.Errorf("Normalize(%q) = %q, %v; want ErrInvalid", in, got, err)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	available := []string{"en", "es-ES", "es-MX", "hi", "zh-Hant"}
+	for _, tc := range []struct {
+		want  string
+		match string
+		ok    bool
+	}{
+		{"en", "en", true},
+		{"en-GB", "en", true},
+		{"es_mx", "es-MX", true},
+		{"es-AR", "es-ES", true},
+		{"es", "es-ES", true},
+		{"hi-IN", "hi", true},
+		{"zh-Hant-TW", "zh-Hant", true},
+		{"zh-Hans", "zh-Hant", true},
+		{"fr", "", false},
+		{"", "", false},
+		{"not a locale", "", false},
+	} {
+		got, ok := Match(tc.want, available)
+		if got != tc.match || ok != tc.ok {
+			t.Errorf("Match(%q) = %q, %v; want %q, %v", tc.want, got, ok, tc.match, tc.ok)
+		}
+	}
+}
+
+func TestMatchKeepsStoredSpelling(t *testing.T) {
+	if got, _ := Match("pt-br", []string{"pt_BR"}); got != "pt_BR" {
+		t.Errorf("Match = %q, want the tag as given", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	available := []string{"hi", "es"}
+	for _, tc := range []struct {
+		prefs []string
+		match string
+		ok    bool
+	}{
+		{[]string{"hi-IN", "en"}, "hi", true},
+		{[]string{"fr", "es"}, "es", true},
+		{[]string{"", "es-MX"}, "es", true},
+		{[]string{"fr", "en"}, "", false},
+		{nil, "", false},
+	} {
+		got, ok := Resolve(available, tc.prefs...)
+		if got != tc.match || ok != tc.ok {
+			t.Errorf("Resolve(%v) = %q, %v; want %q, %v", tc.prefs, got, ok, tc.match, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+// Package mailchimp reads Mailchimp audience exports and converts
+// Mailchimp templates' *|MERGE|* tags into our merge language.
+package mailchimp
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"email_campaign/internal/importer"
+)
+
+// Status is a member's status in Mailchimp. Exports put each status in a
+// file of its own, named after it.
+type Status string
+
+const (
+	StatusSubscribed    Status = "subscribed"
+	StatusUnsubscribed  Status = "unsubscribed"
+	StatusCleaned       Status = "cleaned"
+	StatusPending       Status = "pending"
+	StatusTransactional Status = "transactional"
+)
+
+// StatusFromFilename reads the status from an export file name such as
+// "cleaned_email_audience_export_1a2b.csv". Files not named after a status
+// are taken to hold subscribed members.
+func StatusFromFilename(name string) Status {
+	base := strings.ToLower(path.Base(strings.ReplaceAll(name, "\\", "/")))
+	switch {
+	case strings.HasPrefix(base, "unsubscribed"):
+		return StatusUnsubscribed
+	case strings.HasPrefix(base, "cleaned"):
+		return StatusCleaned
+	case strings.HasPrefix(base, "pending"):
+		return StatusPending
+	case strings.HasPrefix(base, "nonsubscribed"), strings.HasPrefix(base, "non_subscribed"), strings.HasPrefix(base, "transactional"):
+		return StatusTransactional
+	}
+	return StatusSubscribed
+}
+
+// ParseStatus reads a status column value.
+func ParseStatus(s string) (Status, bool) {
+	switch st := Status(strings.ToLower(strings.TrimSpace(s))); st {
+	case StatusSubscribed, StatusUnsubscribed, StatusCleaned, StatusPending, StatusTransactional:
+		return st, true
+	case "nonsubscribed", "non-subscribed":
+		return StatusTransactional, true
+	}
+	return "", false
+}
+
+// Kind is what a column of an export holds.
+type Kind string
+
+const (
+	KindEmail     Kind = "email"
+	KindFirstName Kind = "first_name"
+	KindLastName  Kind = "last_name"
+	KindPhone     Kind = "phone"
+	KindCompany   Kind = "company"
+	KindStatus    Kind = "status"
+	KindTags      Kind = "tags"
+	// KindGDPR is a marketing permission column; KindConsent is evidence of
+	// opt-in, such as OPTIN_TIME.
+	KindGDPR    Kind = "gdpr"
+	KindConsent Kind = "consent"
+	KindCustom  Kind = "custom"
+	// KindIgnored is Mailchimp bookkeeping, such as LEID or MEMBER_RATING.
+	KindIgnored Kind = "ignored"
+)
+
+// Column is how a header is read. Key names the custom field, consent
+// field or permission it fills.
+type Column struct {
+	Header string `json:"header"`
+	Kind   Kind   `json:"kind"`
+	Key    string `json:"key,omitempty"`
+}
+
+var standardColumns = map[string]Kind{
+	"email address": KindEmail,
+	"email":         KindEmail,
+	"first name":    KindFirstName,
+	"last name":     KindLastName,
+	"phone number":  KindPhone,
+	"phone":         KindPhone,
+	"company":       KindCompany,
+	"company name":  KindCompany,
+	"status":        KindStatus,
+	"tags":          KindTags,
+}
+
+var consentColumns = map[string]bool{
+	"OPTIN_TIME": true, "OPTIN_IP": true, "CONFIRM_TIME": true, "CONFIRM_IP": true,
+	"UNSUB_TIME": true, "UNSUB_REASON": true, "UNSUB_REASON_OTHER": true, "CLEAN_TIME": true,
+}
+
+var ignoredColumns = map[string]bool{
+	"MEMBER_RATING": true, "LATITUDE": true, "LONGITUDE": true, "GMTOFF": true, "DSTOFF": true,
+	"TIMEZONE": true, "CC": true, "REGION": true, "LAST_CHANGED": true, "LEID": true, "EUID": true,
+	"NOTES": true, "UNSUB_CAMPAIGN_TITLE": true, "UNSUB_CAMPAIGN_ID": true,
+	"CLEAN_CAMPAIGN_TITLE": true, "CLEAN_CAMPAIGN_ID": true, "SSH": true,
+}
+
+// GDPRFields are the marketing permissions Mailchimp offers by default.
+// The export has a column for each one enabled on the audience.
+var GDPRFields = []string{"Email", "Direct Mail", "Customized Online Advertising"}
+
+// EmailPermission is the key of the permission to be emailed.
+const EmailPermission = "email"
+
+// classify works out what a header holds. gdpr lists the headers that
+// are marketing permissions.
+func classify(header string, gdpr map[string]bool) Column {
+	h := strings.TrimSpace(header)
+	c := Column{Header: header}
+	switch {
+	case gdpr[strings.ToLower(h)]:
+		c.Kind, c.Key = KindGDPR, FieldKey(h)
+	case standardColumns[strings.ToLower(h)] != "":
+		c.Kind = standardColumns[strings.ToLower(h)]
+	case consentColumns[h]:
+		c.Kind, c.Key = KindConsent, FieldKey(h)
+	case ignoredColumns[h]:
+		c.Kind = KindIgnored
+	default:
+		c.Kind, c.Key = KindCustom, FieldKey(h)
+	}
+	return c
+}
+
+// FieldKey turns a column label into a custom field key, as contact
+// imports do.
+func FieldKey(label string) string {
+	return importer.FieldKey(label)
+}
+
+// Member is one row of an export. Custom holds custom fields and consent
+// evidence; GDPR holds the marketing permissions the row answers.
+type Member struct {
+	Row       int
+	Email     string
+	FirstName string
+	LastName  string
+	Phone     string
+	Company   string
+	Status    Status
+	Tags      []string
+	Custom    map[string]string
+	GDPR      map[string]bool
+}
+
+// EmailConsent reports whether the member may be emailed, as far as the
+// export's permissions say; ok is false when it has no email permission.
+func (m *Member) EmailConsent() (consent, ok bool) {
+	consent, ok = m.GDPR[EmailPermission]
+	return
+}
+
+var ErrNoEmailColumn = errors.New("export has no Email Address column")
+
+// Reader reads the members of one export file.
+type Reader struct {
+	csv     *csv.Reader
+	columns []Column
+	status  Status
+	row     int
+}
+
+// NewReader reads the header of an export whose members have status,
+// unless it has a status column. gdpr names the permission columns; nil
+// means GDPRFields.
+func NewReader(r io.Reader, status Status, gdpr []string) (*Reader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, ErrNoEmailColumn
+	}
+	if err != nil {
+		return nil, err
+	}
+	if gdpr == nil {
+		gdpr = GDPRFields
+	}
+	permissions := map[string]bool{}
+	for _, g := range gdpr {
+		permissions[strings.ToLower(strings.TrimSpace(g))] = true
+	}
+
+	rd := &Reader{csv: cr, status: status, row: 1}
+	hasEmail := false
+	for i, h := range header {
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\ufeff")
+		}
+		c := classify(h, permissions)
+		if c.Kind == KindEmail {
+			if hasEmail {
+				// Only the first email column is the address.
+				c = Column{Header: h, Kind: KindCustom, Key: FieldKey(h)}
+			}
+			hasEmail = true
+		}
+		rd.columns = append(rd.columns, c)
+	}
+	if !hasEmail {
+		// A lone "Email" column is the address, not the permission.
+		for i, c := range rd.columns {
+			if c.Kind == KindGDPR && c.Key == EmailPermission {
+				rd.columns[i] = Column{Header: c.Header, Kind: KindEmail}
+				hasEmail = true
+				break
+			}
+		}
+	}
+	if !hasEmail {
+		return nil, ErrNoEmailColumn
+	}
+	return rd, nil
+}
+
+func (r *Reader) Columns() []Column {
+	return r.columns
+}
+
+// Next returns the next member, or io.EOF. Row numbers count the header
+// as row 1.
+func (r *Reader) Next() (*Member, error) {
+	record, err := r.csv.Read()
+	if err != nil {
+		return nil, err
+	}
+	r.row++
+	m := &Member{Row: r.row, Status: r.status, Custom: map[string]string{}, GDPR: map[string]bool{}}
+	for i, c := range r.columns {
+		if i >= len(record) {
+			break
+		}
+		v := strings.TrimSpace(record[i])
+		switch c.Kind {
+		case KindEmail:
+			m.Email = strings.ToLower(v)
+		case KindFirstName:
+			m.FirstName = v
+		case KindLastName:
+			m.LastName = v
+		case KindPhone:
+			m.Phone = v
+		case KindCompany:
+			m.Company = v
+		case KindStatus:
+			if st, ok := ParseStatus(v); ok {
+				m.Status = st
+			}
+		case KindTags:
+			m.Tags = ParseTags(v)
+		case KindGDPR:
+			if v != "" {
+				m.GDPR[c.Key] = truthy(v)
+			}
+		case KindConsent, KindCustom:
+			if v != "" {
+				m.Custom[c.Key] = v
+			}
+		}
+	}
+	return m, nil
+}
+
+// ParseTags reads a TAGS cell, which lists quoted names: "VIP","Customer".
+func ParseTags(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	cr := csv.NewReader(strings.NewReader(s))
+	cr.LazyQuotes = true
+	fields, err := cr.Read()
+	if err != nil {
+		fields = strings.Split(s, ",")
+	}
+	var tags []string
+	seen := map[string]bool{}
+	for _, f := range fields {
+		f = strings.TrimSpace(strings.Trim(strings.TrimSpace(f), `"`))
+		if f == "" || seen[strings.ToLower(f)] {
+			continue
+		}
+		seen[strings.ToLower(f)] = true
+		tags = append(tags, f)
+	}
+	return tags
+}
+
+func truthy(v string) bool {
+	switch strings.ToLower(v) {
+	case "y", "yes", "true", "1", "x", "opted in", "granted":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package mailchimp
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"email_campaign/internal/merge"
+	"email_campaign/internal/types"
+)
+
+const export = "\ufeffEmail Address,First Name,Last Name,Company Size,Email,Direct Mail,MEMBER_RATING,OPTIN_TIME,TAGS\n" +
+	"Ann@Example.com,Ann,Lee,50-100,Y,,2,2023-01-02 10:00:00,\"\"\"VIP\"\",\"\"Customer\"\"\"\n" +
+	"bob@example.com,Bob,,,N,Y,1,,\n"
+
+func TestReader(t *testing.T) {
+	r, err := NewReader(strings.NewReader(export), StatusFromFilename("unsubscribed_members_export_1a2b.csv"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := []Kind{KindEmail, KindFirstName, KindLastName, KindCustom, KindGDPR, KindGDPR, KindIgnored, KindConsent, KindTags}
+	for i, c := range r.Columns() {
+		if c.Kind != kinds[i] {
+			t.Errorf("column %q is %s, want %s", c.Header, c.Kind, kinds[i])
+		}
+	}
+
+	m, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Row != 2 || m.Email != "ann@example.com" || m.FirstName != "Ann" || m.Status != StatusUnsubscribed {
+		t.Errorf("member = %+v", m)
+	}
+	if !reflect.DeepEqual(m.Tags, []string{"VIP", "Customer"}) {
+		t.Errorf("tags = %q", m.Tags)
+	}
+	want := map[string]string{"company_size": "50-100", "optin_time": "2023-01-02 10:00:00"}
+	if !reflect.DeepEqual(m.Custom, want) {
+		t.Errorf("custom = %v", m.Custom)
+	}
+	if consent, ok := m.EmailConsent(); !consent || !ok {
+		t.Errorf("consent = %v, %v", consent, ok)
+	}
+
+	m, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consent, ok := m.EmailConsent(); consent || !ok || !m.GDPR["direct_mail"] {
+		t.Errorf("gdpr = %v", m.GDPR)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("err = %v, want EOF", err)
+	}
+}
+
+func TestReaderNeedsEmail(t *testing.T) {
+	if _, err := NewReader(strings.NewReader("First Name\nAnn\n"), StatusSubscribed, nil); err != ErrNoEmailColumn {
+		t.Errorf("err = %v", err)
+	}
+	// Without an address column the "Email" column is the address.
+	r, err := NewReader(strings.NewReader("Email\nann@example.com\n"), StatusSubscribed, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := r.Next(); m.Email != "ann@example.com" || len(m.GDPR) != 0 {
+		t.Errorf("member = %+v", m)
+	}
+}
+
+func TestStatusFromFilename(t *testing.T) {
+	for name, want := range map[string]Status{
+		"subscribed_email_audience_export_a1.csv":  StatusSubscribed,
+		"export/cleaned_email_audience_export.csv": StatusCleaned,
+		"Unsubscribed_members.csv":                 StatusUnsubscribed,
+		"nonsubscribed_email_audience_export.csv":  StatusTransactional,
+		"members.csv": StatusSubscribed,
+	} {
+		if got := StatusFromFilename(name); got != want {
+			t.Errorf("%s: %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestFieldKey(t *testing.T) {
+	for in, want := range map[string]string{
+		"Company Size":  "company_size",
+		" Birthday ":    "birthday",
+		"2nd Address!":  "f_2nd_address",
+		"Café":          "caf",
+		"???":           "field",
+		"MMERGE5":       "mmerge5",
+		"Plan -- Level": "plan_level",
+	} {
+		if got := FieldKey(in); got != want {
+			t.Errorf("FieldKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	columns := []Column{{Header: "Company Size", Kind: KindCustom, Key: "company_size"}, {Header: "Plan", Kind: KindCustom, Key: "plan"}}
+	fields := MergeFields(columns, map[string]string{"MMERGE5": "Company Size"})
+	src := `<p>Hi *|FNAME|*, *|UPPER:LNAME|*</p>
+*|IF:PLAN=Pro|*Pro*|ELSEIF:COMPANYSIZ|*Team*|ELSE:|*Free*|END:IF|*
+*|IFNOT:ARCHIVE_PAGE|*<a href="*|ARCHIVE|*">View</a>*|END:IF|*
+*|IF:AGE>18|*adult*|END:IF|* *|MMERGE5|* *|SHOESIZE|*
+<a href="*|UNSUB|*">Unsubscribe</a> &copy; *|CURRENT_YEAR|* *|LIST:COMPANY|* *|DATE:d/m/Y|*
+*|LIST:ADDRESS|* *|MC_PREVIEW_TEXT|* *|REWARDS|*`
+	c := Convert(src, fields)
+
+	want := `<p>Hi {{ contact.first_name }}, {{ contact.last_name | upper }}</p>
+{{ if eq (contact.custom.plan | default "") "Pro" }}Pro{{ else if contact.custom.company_size }}Team{{ else }}Free{{ end }}
+{{ if not false }}<a href="{{ view_online_url }}">View</a>{{ end }}
+{{ if contact.custom.age }}adult{{ end }} {{ contact.custom.company_size }} {{ contact.custom.shoesize }}
+<a href="{{ unsubscribe_url }}">Unsubscribe</a> &copy; {{ now | date "2006" }} {{ sender.name }} {{ now | date "02/01/2006" }}
+*|LIST:ADDRESS|*  *|REWARDS|*`
+	if c.Content != want {
+		t.Errorf("Convert() =\n%s\nwant\n%s", c.Content, want)
+	}
+	if c.Converted != 18 {
+		t.Errorf("converted = %d", c.Converted)
+	}
+	var tags []string
+	for _, is := range c.Issues {
+		tags = append(tags, is.Tag)
+	}
+	wantTags := []string{"*|AGE|*", "*|IF:AGE>18|*", "*|LIST:ADDRESS|*", "*|MC_PREVIEW_TEXT|*", "*|REWARDS|*", "*|SHOESIZE|*"}
+	if !reflect.DeepEqual(tags, wantTags) {
+		t.Errorf("issues = %+v", c.Issues)
+	}
+
+	if err := merge.ValidateHTML(c.Content); err != nil {
+		t.Fatalf("converted template does not validate: %v", err)
+	}
+	out, err := merge.HTML(strings.Split(c.Content, "\n")[1], &types.MergeData{
+		Contact: &types.MergeContact{Custom: map[string]interface{}{"plan": "Pro"}},
+	})
+	if err != nil || out != "Pro" {
+		t.Errorf("render = %q, %v", out, err)
+	}
+}
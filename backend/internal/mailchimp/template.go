@@ -0,0 +1,300 @@
+package mailchimp
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fields maps Mailchimp merge tags, such as FNAME, to the variables they
+// become, such as contact.first_name.
+type Fields map[string]string
+
+// DefaultFields are the merge tags every Mailchimp audience starts with.
+func DefaultFields() Fields {
+	return Fields{
+		"EMAIL":    "contact.email",
+		"FNAME":    "contact.first_name",
+		"LNAME":    "contact.last_name",
+		"PHONE":    "contact.phone",
+		"COMPANY":  "contact.company",
+		"ADDRESS":  "contact.custom.address",
+		"BIRTHDAY": "contact.custom.birthday",
+	}
+}
+
+// MergeFields adds an export's columns to the default fields. labels maps
+// merge tags to the column labels they fill, as listed under the
+// audience's "Audience fields and *|MERGE|* tags"; otherwise each custom
+// column is also reachable by the tag Mailchimp would suggest for it.
+func MergeFields(columns []Column, labels map[string]string) Fields {
+	fields := DefaultFields()
+	for _, c := range columns {
+		if c.Kind != KindCustom {
+			continue
+		}
+		v := "contact.custom." + c.Key
+		for _, tag := range []string{strings.ToUpper(c.Key), suggestedTag(c.Key)} {
+			if _, ok := fields[tag]; !ok {
+				fields[tag] = v
+			}
+		}
+	}
+	for tag, label := range labels {
+		tag = strings.ToUpper(strings.TrimSpace(tag))
+		v := "contact.custom." + FieldKey(label)
+		for _, c := range columns {
+			if strings.EqualFold(strings.TrimSpace(c.Header), strings.TrimSpace(label)) {
+				v = columnVariable(c)
+			}
+		}
+		if v != "" {
+			fields[tag] = v
+		}
+	}
+	return fields
+}
+
+// suggestedTag is the label squeezed into Mailchimp's ten characters.
+func suggestedTag(key string) string {
+	tag := strings.ToUpper(strings.ReplaceAll(key, "_", ""))
+	if len(tag) > 10 {
+		tag = tag[:10]
+	}
+	return tag
+}
+
+func columnVariable(c Column) string {
+	switch c.Kind {
+	case KindEmail, KindFirstName, KindLastName, KindPhone, KindCompany:
+		return "contact." + string(c.Kind)
+	case KindCustom, KindConsent:
+		return "contact.custom." + c.Key
+	}
+	return ""
+}
+
+// Issue is a Mailchimp tag that was left as it is or only approximated,
+// with how often it occurs.
+type Issue struct {
+	Tag     string `json:"tag"`
+	Count   int    `json:"count"`
+	Message string `json:"message"`
+}
+
+// Conversion is a template with its merge tags converted.
+type Conversion struct {
+	Content   string  `json:"-"`
+	Converted int     `json:"converted"`
+	Issues    []Issue `json:"issues"`
+}
+
+var (
+	mergeTag = regexp.MustCompile(`\*\|([^|*]{1,200})\|\*`)
+	// condition is a field with an optional comparison.
+	condition = regexp.MustCompile(`^([A-Za-z0-9_:]+)\s*(?:(!=|>=|<=|=|>|<)\s*(.*))?$`)
+	fieldTag  = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,19}$`)
+)
+
+// Tags with a direct equivalent in our merge language.
+var specialTags = map[string]string{
+	"UNSUB":        "unsubscribe_url",
+	"ARCHIVE":      "view_online_url",
+	"MC:SUBJECT":   "campaign.subject",
+	"CAMPAIGN_UID": "campaign.id",
+	"LIST:COMPANY": "sender.name",
+	"LIST:NAME":    "sender.name",
+	"CURRENT_YEAR": `now | date "2006"`,
+	"MC:DATE":      `now | date "01/02/2006"`,
+}
+
+// Mailchimp features we have no equivalent for, which would otherwise look
+// like merge fields.
+var unsupportedTags = map[string]bool{
+	"REWARDS": true, "REWARDS_TEXT": true, "UPDATE_PROFILE": true, "FORWARD": true,
+	"ABOUT_LIST": true, "EMAIL_TYPE": true, "MC_LANGUAGE": true, "MC_LANGUAGE_LABEL": true,
+	"TRANSLATE": true, "ARCHIVE_PAGE": true, "FACEBOOK": true, "TWITTER": true,
+}
+
+// Conditions with a fixed answer in a sent message.
+var specialConditions = map[string]string{
+	"ARCHIVE_PAGE": "false",
+}
+
+// Convert rewrites the *|MERGE|* tags of a Mailchimp template. Tags with
+// no equivalent are left in place and reported, as are conditions that
+// could only be approximated.
+func Convert(src string, fields Fields) *Conversion {
+	c := &Conversion{}
+	issues := map[string]*Issue{}
+	report := func(tag, format string, args ...interface{}) {
+		if is, ok := issues[tag]; ok {
+			is.Count++
+			return
+		}
+		issues[tag] = &Issue{Tag: "*|" + tag + "|*", Count: 1, Message: fmt.Sprintf(format, args...)}
+	}
+
+	c.Content = mergeTag.ReplaceAllStringFunc(src, func(m string) string {
+		tag := strings.TrimSpace(mergeTag.FindStringSubmatch(m)[1])
+		out, ok := c.convert(tag, fields, report)
+		if !ok {
+			return m
+		}
+		c.Converted++
+		return out
+	})
+
+	for _, is := range issues {
+		c.Issues = append(c.Issues, *is)
+	}
+	sort.Slice(c.Issues, func(i, j int) bool { return c.Issues[i].Tag < c.Issues[j].Tag })
+	if c.Issues == nil {
+		c.Issues = []Issue{}
+	}
+	return c
+}
+
+func (c *Conversion) convert(tag string, fields Fields, report func(tag, format string, args ...interface{})) (string, bool) {
+	upper := strings.ToUpper(tag)
+	switch {
+	case upper == "END:IF":
+		return "{{ end }}", true
+	case upper == "ELSE:" || upper == "ELSE":
+		return "{{ else }}", true
+	case strings.HasPrefix(upper, "IF:"):
+		return "{{ if " + c.condition(tag, tag[3:], fields, report) + " }}", true
+	case strings.HasPrefix(upper, "ELSEIF:"):
+		return "{{ else if " + c.condition(tag, tag[7:], fields, report) + " }}", true
+	case strings.HasPrefix(upper, "IFNOT:"):
+		return "{{ if not " + c.condition(tag, tag[6:], fields, report) + " }}", true
+	case upper == "MC_PREVIEW_TEXT":
+		report(tag, "removed; write the preview text into the template as a hidden preheader")
+		return "", true
+	}
+	if v, ok := specialTags[upper]; ok {
+		return "{{ " + v + " }}", true
+	}
+
+	if fn, arg, ok := strings.Cut(tag, ":"); ok {
+		switch strings.ToUpper(fn) {
+		case "UPPER", "LOWER", "TITLE":
+			if v, ok := c.field(tag, arg, fields, report); ok {
+				return "{{ " + v + " | " + strings.ToLower(fn) + " }}", true
+			}
+			return "", false
+		case "DATE":
+			return "{{ now | date " + strconv.Quote(dateLayout(arg)) + " }}", true
+		}
+	}
+	if v, ok := c.field(tag, tag, fields, report); ok {
+		return "{{ " + v + " }}", true
+	}
+	return "", false
+}
+
+// field converts a merge field name. Unknown names that look like merge
+// fields are taken to be custom fields of the same name.
+func (c *Conversion) field(tag, name string, fields Fields, report func(tag, format string, args ...interface{})) (string, bool) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if v, ok := fields[name]; ok {
+		return v, true
+	}
+	if fieldTag.MatchString(name) && !unsupportedTags[name] {
+		v := "contact.custom." + FieldKey(name)
+		report(name, "not a column of the audience; assumed to be the custom field %s", v)
+		return v, true
+	}
+	report(name, "has no equivalent and was left as it is")
+	return "", false
+}
+
+// condition converts what follows IF:, such as FNAME or PLAN=Pro. A
+// condition it cannot express is reduced to whether the field is set.
+func (c *Conversion) condition(tag, cond string, fields Fields, report func(tag, format string, args ...interface{})) string {
+	m := condition.FindStringSubmatch(strings.TrimSpace(cond))
+	if m == nil {
+		report(tag, "could not be read; replaced with a condition that is never true")
+		return "false"
+	}
+	if v, ok := specialConditions[strings.ToUpper(m[1])]; ok {
+		return v
+	}
+	v, ok := c.field(tag, m[1], fields, report)
+	if !ok {
+		return "false"
+	}
+	value := strconv.Quote(strings.Trim(strings.TrimSpace(m[3]), `"'`))
+	switch m[2] {
+	case "":
+		return v
+	case "=":
+		return "eq (" + v + ` | default "") ` + value
+	case "!=":
+		return "ne (" + v + ` | default "") ` + value
+	}
+	report(tag, "numeric comparison %s is not supported; the condition only checks that the field is set", m[2])
+	return v
+}
+
+// dateLayout turns a PHP date format, which Mailchimp's DATE tag takes,
+// into a Go layout.
+func dateLayout(format string) string {
+	if strings.TrimSpace(format) == "" {
+		return "01/02/2006"
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range format {
+		if escaped {
+			b.WriteRune(r)
+			escaped = false
+			continue
+		}
+		switch r {
+		case '\\':
+			escaped = true
+		case 'd':
+			b.WriteString("02")
+		case 'j':
+			b.WriteString("2")
+		case 'D':
+			b.WriteString("Mon")
+		case 'l':
+			b.WriteString("Monday")
+		case 'm':
+			b.WriteString("01")
+		case 'n':
+			b.WriteString("1")
+		case 'M':
+			b.WriteString("Jan")
+		case 'F':
+			b.WriteString("January")
+		case 'Y':
+			b.WriteString("2006")
+		case 'y':
+			b.WriteString("06")
+		case 'a':
+			b.WriteString("pm")
+		case 'A':
+			b.WriteString("PM")
+		case 'g':
+			b.WriteString("3")
+		case 'h':
+			b.WriteString("03")
+		case 'G', 'H':
+			b.WriteString("15")
+		case 'i':
+			b.WriteString("04")
+		case 's':
+			b.WriteString("05")
+		case 'T':
+			b.WriteString("MST")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
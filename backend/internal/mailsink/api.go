@@ -0,0 +1,111 @@
+package mailsink
+
+import (
+	"errors"
+	"net/http"
+
+	"email_campaign/internal/utils"
+)
+
+type handler struct {
+	store Store
+}
+
+// NewHandler serves the inbox API:
+//
+//	GET    /api/messages              list, filtered by q, from, to and subject
+//	DELETE /api/messages              delete everything
+//	GET    /api/messages/{id}         parsed message with headers, text and HTML
+//	GET    /api/messages/{id}/raw     original source
+//	GET    /api/messages/{id}/html    HTML part, for viewing in a browser
+//	DELETE /api/messages/{id}         delete one message
+func NewHandler(store Store) http.Handler {
+	h := &handler{store: store}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/messages", h.list)
+	mux.HandleFunc("DELETE /api/messages", h.clear)
+	mux.HandleFunc("GET /api/messages/{id}", h.get)
+	mux.HandleFunc("GET /api/messages/{id}/raw", h.raw)
+	mux.HandleFunc("GET /api/messages/{id}/html", h.html)
+	mux.HandleFunc("DELETE /api/messages/{id}", h.delete)
+	return mux
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	summaries := []Summary{}
+	for _, msg := range h.store.List() {
+		if msg.matches(q.Get("q"), q.Get("from"), q.Get("to"), q.Get("subject")) {
+			summaries = append(summaries, msg.Summary())
+		}
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Messages retrieved successfully", summaries)
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	utils.SuccessResponse(w, http.StatusOK, "Message retrieved successfully", msg)
+}
+
+func (h *handler) raw(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "message/rfc822")
+	w.Write(msg.Raw)
+}
+
+func (h *handler) html(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	if msg.HTML == "" {
+		utils.ErrorResponse(w, http.StatusNotFound, "Message has no HTML part")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Captured mail is untrusted; keep its scripts and forms inert.
+	w.Header().Set("Content-Security-Policy", "sandbox; default-src 'none'; img-src * data:; style-src 'unsafe-inline'")
+	w.Write([]byte(msg.HTML))
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.Delete(r.PathValue("id")); err != nil {
+		h.storeError(w, err)
+		return
+	}
+	utils.SuccessResponse(w, http.StatusOK, "Message deleted successfully", nil)
+}
+
+func (h *handler) clear(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.Clear(); err != nil {
+		h.storeError(w, err)
+		return
+	}
+	utils.SuccessResponse(w, http.StatusOK, "Messages deleted successfully", nil)
+}
+
+func (h *handler) lookup(w http.ResponseWriter, r *http.Request) (*Message, bool) {
+	msg, err := h.store.Get(r.PathValue("id"))
+	if err != nil {
+		h.storeError(w, err)
+		return nil, false
+	}
+	return msg, true
+}
+
+func (h *handler) storeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrMessageNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,145 @@
+package mailsink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"email_campaign/internal/utils"
+)
+
+func startSink(t *testing.T) *Sink {
+	t.Helper()
+	sink, err := Start("127.0.0.1:0", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		sink.Shutdown(ctx)
+	})
+	return sink
+}
+
+func getJSON(t *testing.T, url string, out interface{}) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if out != nil && len(body.Data) > 0 {
+		if err := json.Unmarshal(body.Data, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestSendEmailIsCaptured(t *testing.T) {
+	sink := startSink(t)
+
+	settings := utils.SMTPSettings{
+		Host:     "127.0.0.1",
+		Port:     sink.SMTPAddr().Port,
+		Username: "sender@acme.test",
+		Password: "anything",
+	}
+	if err := utils.SendEmail(settings, "jane@example.com", "SMTP Connection Test", "Hello Jane"); err != nil {
+		t.Fatalf("SendEmail: %v", err)
+	}
+
+	var list []Summary
+	getJSON(t, sink.URL()+"/api/messages?to=jane@example.com", &list)
+	if len(list) != 1 {
+		t.Fatalf("got %d messages, want 1", len(list))
+	}
+	if list[0].Subject != "SMTP Connection Test" || list[0].From != "sender@acme.test" {
+		t.Errorf("got %+v", list[0])
+	}
+
+	var msg Message
+	getJSON(t, sink.URL()+"/api/messages/"+list[0].ID, &msg)
+	if strings.TrimSpace(msg.Text) != "Hello Jane" {
+		t.Errorf("text = %q", msg.Text)
+	}
+}
+
+func TestMultipartMessageAndSearch(t *testing.T) {
+	sink := startSink(t)
+
+	raw := strings.ReplaceAll(`From: Acme <news@acme.test>
+To: Bob <bob@example.com>
+Subject: =?UTF-8?Q?January_update_=E2=9C=89?=
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary="b1"
+
+--b1
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+Hi Bob, read the full story at https://acme.test/=
+news
+--b1
+Content-Type: text/html; charset=utf-8
+Content-Transfer-Encoding: base64
+
+PHA+SGkgQm9iPC9wPg==
+--b1--
+`, "\n", "\r\n")
+
+	addr := sink.SMTPAddr().String()
+	if err := smtp.SendMail(addr, nil, "bounces@acme.test", []string{"bob@example.com"}, []byte(raw)); err != nil {
+		t.Fatalf("SendMail: %v", err)
+	}
+
+	var list []Summary
+	getJSON(t, sink.URL()+"/api/messages?q=full+story", &list)
+	if len(list) != 1 {
+		t.Fatalf("search returned %d messages, want 1", len(list))
+	}
+	getJSON(t, sink.URL()+"/api/messages?subject=february", &list)
+	if len(list) != 0 {
+		t.Errorf("subject filter returned %d messages, want 0", len(list))
+	}
+
+	msgs := sink.Store().List()
+	if len(msgs) != 1 {
+		t.Fatalf("store has %d messages", len(msgs))
+	}
+	msg := msgs[0]
+	if msg.Subject != "January update ✉" {
+		t.Errorf("subject = %q", msg.Subject)
+	}
+	if msg.HTML != "<p>Hi Bob</p>" {
+		t.Errorf("html = %q", msg.HTML)
+	}
+	if !strings.Contains(msg.Text, "https://acme.test/news") {
+		t.Errorf("text = %q", msg.Text)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, sink.URL()+"/api/messages/"+msg.ID, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("delete status = %d", resp.StatusCode)
+	}
+	if status := getJSON(t, sink.URL()+"/api/messages/"+msg.ID, nil); status != http.StatusNotFound {
+		t.Errorf("get after delete status = %d, want 404", status)
+	}
+}
@@ -0,0 +1,177 @@
+// Package mailsink captures every message sent to it over SMTP and exposes
+// them over an HTTP API, for local development and end-to-end tests.
+package mailsink
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Message is a captured message with its parsed parts.
+type Message struct {
+	ID          string              `json:"id"`
+	ReceivedAt  time.Time           `json:"received_at"`
+	From        string              `json:"from"`
+	To          []string            `json:"to"`
+	Subject     string              `json:"subject"`
+	Headers     map[string][]string `json:"headers"`
+	Text        string              `json:"text"`
+	HTML        string              `json:"html"`
+	Attachments []Attachment        `json:"attachments"`
+	Size        int                 `json:"size"`
+
+	Raw []byte `json:"-"`
+}
+
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+}
+
+// Summary is the list view of a message.
+type Summary struct {
+	ID         string    `json:"id"`
+	ReceivedAt time.Time `json:"received_at"`
+	From       string    `json:"from"`
+	To         []string  `json:"to"`
+	Subject    string    `json:"subject"`
+	Size       int       `json:"size"`
+}
+
+func (m *Message) Summary() Summary {
+	return Summary{ID: m.ID, ReceivedAt: m.ReceivedAt, From: m.From, To: m.To, Subject: m.Subject, Size: m.Size}
+}
+
+// parseMessage fills the parsed fields of a message from its raw bytes. The
+// envelope sender and recipients are kept as given. Unparseable messages are
+// still stored, with only the raw source available.
+func parseMessage(id string, receivedAt time.Time, from string, to []string, raw []byte) *Message {
+	m := &Message{
+		ID:         id,
+		ReceivedAt: receivedAt,
+		From:       from,
+		To:         to,
+		Headers:    map[string][]string{},
+		Size:       len(raw),
+		Raw:        raw,
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return m
+	}
+	for k, v := range msg.Header {
+		m.Headers[k] = v
+	}
+	dec := new(mime.WordDecoder)
+	if subject, err := dec.DecodeHeader(msg.Header.Get("Subject")); err == nil {
+		m.Subject = subject
+	} else {
+		m.Subject = msg.Header.Get("Subject")
+	}
+	if m.From == "" {
+		if addr, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+			m.From = addr.Address
+		}
+	}
+
+	if len(m.To) == 0 {
+		for _, h := range []string{"To", "Cc"} {
+			if list, err := msg.Header.AddressList(h); err == nil {
+				for _, a := range list {
+					m.To = append(m.To, a.Address)
+				}
+			}
+		}
+	}
+
+	m.walk(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Header.Get("Content-Disposition"), msg.Body)
+	return m
+}
+
+// walk descends into multipart bodies and keeps the first text and HTML
+// parts; everything else is listed as an attachment.
+func (m *Message) walk(contentType, encoding, disposition string, body io.Reader) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				return
+			}
+			m.walk(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part.Header.Get("Content-Disposition"), part)
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(encoding, body))
+	if err != nil {
+		return
+	}
+
+	dispType, dispParams, _ := mime.ParseMediaType(disposition)
+	if dispType != "attachment" {
+		switch {
+		case mediaType == "text/plain" && m.Text == "":
+			m.Text = string(data)
+			return
+		case mediaType == "text/html" && m.HTML == "":
+			m.HTML = string(data)
+			return
+		}
+	}
+
+	name := dispParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	m.Attachments = append(m.Attachments, Attachment{Filename: name, ContentType: mediaType, Size: len(data)})
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// matches reports whether the message contains every non-empty filter,
+// case-insensitively. q is matched against subject, addresses and bodies.
+func (m *Message) matches(q, from, to, subject string) bool {
+	contains := func(s, sub string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+	}
+
+	if from != "" && !contains(m.From, from) && !contains(strings.Join(m.Headers["From"], ","), from) {
+		return false
+	}
+	if to != "" && !contains(strings.Join(m.To, ","), to) && !contains(strings.Join(m.Headers["To"], ","), to) {
+		return false
+	}
+	if subject != "" && !contains(m.Subject, subject) {
+		return false
+	}
+	if q != "" {
+		hay := strings.Join([]string{m.Subject, m.From, strings.Join(m.To, ","), m.Text, m.HTML}, "\n")
+		if !contains(hay, q) {
+			return false
+		}
+	}
+	return true
+}
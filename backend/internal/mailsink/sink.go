@@ -0,0 +1,102 @@
+package mailsink
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"email_campaign/internal/smtpd"
+)
+
+// Sink accepts every message over SMTP, with or without AUTH, and serves
+// the captured messages over HTTP.
+type Sink struct {
+	store Store
+	smtp  *smtpd.Server
+	http  *http.Server
+
+	smtpAddr net.Addr
+	httpAddr net.Addr
+}
+
+func New(store Store, hostname string) *Sink {
+	s := &Sink{store: store}
+	s.smtp = &smtpd.Server{
+		Hostname:     hostname,
+		Handler:      s.deliver,
+		Authenticate: func(username, password string) bool { return true },
+	}
+	s.http = &http.Server{
+		Handler:           NewHandler(store),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Start runs a sink in-process with an in-memory store. Pass "127.0.0.1:0"
+// for either address to pick a free port, as tests do.
+func Start(smtpAddr, httpAddr string) (*Sink, error) {
+	s := New(NewMemoryStore(0), "mailsink.local")
+	if err := s.Listen(smtpAddr, httpAddr); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Listen binds both listeners and serves them in the background.
+func (s *Sink) Listen(smtpAddr, httpAddr string) error {
+	smtpLn, err := net.Listen("tcp", smtpAddr)
+	if err != nil {
+		return err
+	}
+	httpLn, err := net.Listen("tcp", httpAddr)
+	if err != nil {
+		smtpLn.Close()
+		return err
+	}
+
+	s.smtpAddr = smtpLn.Addr()
+	s.httpAddr = httpLn.Addr()
+	go s.smtp.Serve(smtpLn)
+	go s.http.Serve(httpLn)
+	return nil
+}
+
+// SMTPAddr is the address the SMTP listener is bound to.
+func (s *Sink) SMTPAddr() *net.TCPAddr {
+	addr, _ := s.smtpAddr.(*net.TCPAddr)
+	return addr
+}
+
+// URL is the base URL of the HTTP API.
+func (s *Sink) URL() string {
+	return "http://" + s.httpAddr.String()
+}
+
+func (s *Sink) Store() Store {
+	return s.store
+}
+
+func (s *Sink) Shutdown(ctx context.Context) error {
+	return errors.Join(s.smtp.Shutdown(ctx), s.http.Shutdown(ctx))
+}
+
+func (s *Sink) deliver(env *smtpd.Envelope) error {
+	id, err := newMessageID()
+	if err != nil {
+		return err
+	}
+	return s.store.Add(parseMessage(id, time.Now(), env.From, env.To, env.Data))
+}
+
+func newMessageID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,180 @@
+package mailsink
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrMessageNotFound = errors.New("message not found")
+
+// Store keeps captured messages, newest first.
+type Store interface {
+	Add(msg *Message) error
+	List() []*Message
+	Get(id string) (*Message, error)
+	Delete(id string) error
+	Clear() error
+}
+
+type memoryStore struct {
+	mu    sync.RWMutex
+	max   int
+	order []string
+	byID  map[string]*Message
+}
+
+// NewMemoryStore keeps up to max messages, dropping the oldest beyond that.
+// A max of zero means no limit.
+func NewMemoryStore(max int) Store {
+	return &memoryStore{max: max, byID: make(map[string]*Message)}
+}
+
+func (s *memoryStore) Add(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.order = append(s.order, msg.ID)
+	s.byID[msg.ID] = msg
+	for s.max > 0 && len(s.order) > s.max {
+		delete(s.byID, s.order[0])
+		s.order = s.order[1:]
+	}
+	return nil
+}
+
+func (s *memoryStore) List() []*Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]*Message, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		out = append(out, s.byID[s.order[i]])
+	}
+	return out
+}
+
+func (s *memoryStore) Get(id string) (*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	msg, ok := s.byID[id]
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	return msg, nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byID[id]; !ok {
+		return ErrMessageNotFound
+	}
+	delete(s.byID, id)
+	for i, v := range s.order {
+		if v == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.order = nil
+	s.byID = make(map[string]*Message)
+	return nil
+}
+
+// diskStore writes each message to <dir>/<id>.eml so captures survive a
+// restart. Parsed messages are also indexed in memory.
+type diskStore struct {
+	dir string
+	mem *memoryStore
+}
+
+// NewDiskStore loads any messages already in dir.
+func NewDiskStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &diskStore{dir: dir, mem: NewMemoryStore(0).(*memoryStore)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type loaded struct {
+		msg *Message
+		at  time.Time
+	}
+	var msgs []loaded
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".eml")
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		msgs = append(msgs, loaded{parseMessage(id, info.ModTime(), "", nil, raw), info.ModTime()})
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].at.Before(msgs[j].at) })
+	for _, l := range msgs {
+		s.mem.Add(l.msg)
+	}
+	return s, nil
+}
+
+func (s *diskStore) path(id string) string {
+	return filepath.Join(s.dir, id+".eml")
+}
+
+func (s *diskStore) Add(msg *Message) error {
+	if err := os.WriteFile(s.path(msg.ID), msg.Raw, 0o644); err != nil {
+		return err
+	}
+	return s.mem.Add(msg)
+}
+
+func (s *diskStore) List() []*Message {
+	return s.mem.List()
+}
+
+func (s *diskStore) Get(id string) (*Message, error) {
+	return s.mem.Get(id)
+}
+
+func (s *diskStore) Delete(id string) error {
+	if err := s.mem.Delete(id); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *diskStore) Clear() error {
+	for _, msg := range s.mem.List() {
+		if err := os.Remove(s.path(msg.ID)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return s.mem.Clear()
+}
@@ -0,0 +1,182 @@
+package merge
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"email_campaign/internal/types"
+)
+
+// funcs is the merge language: the variable namespaces, bound to data, and
+// the filters. data may be nil, which is how templates are validated.
+func funcs(data *types.MergeData) map[string]interface{} {
+	if data == nil {
+		data = &types.MergeData{}
+	}
+	contact := contactVars(data.Contact)
+	campaign := campaignVars(data.Campaign)
+	sender := senderVars(data.Sender)
+	var tags []string
+	if data.Contact != nil {
+		tags = data.Contact.Tags
+	}
+
+	return map[string]interface{}{
+		"contact":         func() map[string]interface{} { return contact },
+		"campaign":        func() map[string]interface{} { return campaign },
+		"sender":          func() map[string]interface{} { return sender },
+		"unsubscribe_url": func() string { return data.UnsubscribeURL },
+		"view_online_url": func() string { return data.ViewOnlineURL },
+		"now":             time.Now,
+		"has_tag": func(tag string) bool {
+			for _, t := range tags {
+				if strings.EqualFold(t, tag) {
+					return true
+				}
+			}
+			return false
+		},
+		"default": defaultValue,
+		"upper":   func(v interface{}) string { return strings.ToUpper(str(v)) },
+		"lower":   func(v interface{}) string { return strings.ToLower(str(v)) },
+		"title":   func(v interface{}) string { return title(str(v)) },
+		"date":    date,
+		"number":  number,
+		"_blank":  str,
+		// Includes are expanded before rendering; see Expand.
+		"include": func(string) string { return "" },
+	}
+}
+
+// str prints a value the way it is merged, with missing values blank.
+func str(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// defaultValue returns v unless it is missing, blank or an empty list.
+func defaultValue(def, v interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.String:
+		if strings.TrimSpace(rv.String()) == "" {
+			return def
+		}
+	case reflect.Slice, reflect.Map:
+		if rv.Len() == 0 {
+			return def
+		}
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return def
+		}
+	}
+	return v
+}
+
+// title upper-cases the first letter of every word and leaves the rest, so
+// names like McDonald survive.
+func title(s string) string {
+	var b strings.Builder
+	start := true
+	for _, r := range s {
+		if start && unicode.IsLetter(r) {
+			b.WriteRune(unicode.ToUpper(r))
+		} else {
+			b.WriteRune(r)
+		}
+		start = unicode.IsSpace(r) || r == '-'
+	}
+	return b.String()
+}
+
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// date formats a time, or a date stored as text in a custom field, with a
+// Go layout such as "Jan 2, 2006". Text that is not a date is left as is.
+func date(layout string, v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return t.Format(layout)
+	case *time.Time:
+		if t == nil {
+			return ""
+		}
+		return t.Format(layout)
+	case string:
+		for _, l := range dateLayouts {
+			if parsed, err := time.Parse(l, t); err == nil {
+				return parsed.Format(layout)
+			}
+		}
+		return t
+	}
+	return str(v)
+}
+
+// number formats a number with the given decimals and thousands
+// separators. Anything that is not a number is left as is.
+func number(decimals int, v interface{}) string {
+	var f float64
+	switch n := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		f = n
+	case float32:
+		f = float64(n)
+	case int:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	case uint64:
+		f = float64(n)
+	case json.Number:
+		parsed, err := n.Float64()
+		if err != nil {
+			return n.String()
+		}
+		f = parsed
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return n
+		}
+		f = parsed
+	default:
+		return str(v)
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+
+	s := strconv.FormatFloat(f, 'f', decimals, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i:]
+	}
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (utf8.RuneCountInString(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return sign + b.String() + frac
+}
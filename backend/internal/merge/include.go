@@ -0,0 +1,141 @@
+package merge
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// includePattern matches {{ include "name" }}, trim markers allowed.
+var includePattern = regexp.MustCompile(`\{\{-?\s*include\s+"([^"\\]*)"\s*-?\}\}`)
+
+// MaxIncludeDepth is how deeply content blocks may include one another.
+const MaxIncludeDepth = 8
+
+// MaxExpandedSize caps content once its blocks are included, about ten
+// times the size past which Gmail clips a message. Blocks repeated through
+// a few levels of nesting would otherwise multiply without bound.
+const MaxExpandedSize = 1 << 20
+
+var (
+	// ErrUnknownBlock is returned by lookups for a name with no block.
+	ErrUnknownBlock = errors.New("unknown content block")
+	// ErrIncludeNotAllowed is returned by lookups for a block that cannot
+	// be used where it is included.
+	ErrIncludeNotAllowed = errors.New("content block cannot be included here")
+
+	errTooLarge = errors.New("expanded content too large")
+)
+
+// Includes returns the block names src includes directly, in order and
+// without repeats.
+func Includes(src string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range includePattern.FindAllStringSubmatch(src, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// HasIncludes reports whether src includes any block.
+func HasIncludes(src string) bool {
+	return includePattern.MatchString(src)
+}
+
+// Expand replaces each include tag with the content lookup returns for the
+// name, expanding includes inside blocks as well. Unknown blocks, blocks
+// that include themselves, nesting past MaxIncludeDepth and output past
+// MaxExpandedSize are returned as Errors at the tag in src; other lookup
+// errors are returned as is.
+func Expand(src string, lookup func(name string) (string, error)) (string, error) {
+	var errs Errors
+	size := 0
+	out, err := expand(src, lookup, nil, &size, func(offset int, msg string) {
+		line, col := position(src, offset)
+		errs = append(errs, Error{Line: line, Column: col, Message: msg})
+	})
+	if errors.Is(err, errTooLarge) {
+		return "", errs
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+	return out, nil
+}
+
+// expand adds the text it writes itself to size; included blocks count
+// their own.
+func expand(src string, lookup func(string) (string, error), stack []string, size *int, report func(int, string)) (string, error) {
+	var b strings.Builder
+	write := func(offset int, s string) error {
+		*size += len(s)
+		if *size > MaxExpandedSize {
+			report(offset, fmt.Sprintf("content is larger than %d bytes once blocks are included", MaxExpandedSize))
+			return errTooLarge
+		}
+		b.WriteString(s)
+		return nil
+	}
+	last := 0
+	for _, m := range includePattern.FindAllStringSubmatchIndex(src, -1) {
+		if err := write(last, src[last:m[0]]); err != nil {
+			return "", err
+		}
+		last = m[1]
+		name := src[m[2]:m[3]]
+		path := append(stack[:len(stack):len(stack)], name)
+
+		at := func(msg string) { report(m[0], msg) }
+		if contains(stack, name) {
+			at(fmt.Sprintf("content block %q includes itself: %s", name, strings.Join(path, " → ")))
+			continue
+		}
+		if len(path) > MaxIncludeDepth {
+			at(fmt.Sprintf("content blocks are nested more than %d deep: %s", MaxIncludeDepth, strings.Join(path, " → ")))
+			continue
+		}
+		content, err := lookup(name)
+		if errors.Is(err, ErrUnknownBlock) || errors.Is(err, ErrIncludeNotAllowed) {
+			msg := err.Error()
+			if errors.Is(err, ErrUnknownBlock) {
+				msg = fmt.Sprintf("%s %q", ErrUnknownBlock, name)
+			}
+			if len(stack) > 0 {
+				msg += " (in " + strings.Join(stack, " → ") + ")"
+			}
+			at(msg)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		// Problems inside the block are reported at this tag.
+		inner, err := expand(content, lookup, path, size, func(_ int, msg string) { at(msg) })
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(inner)
+	}
+	if err := write(last, src[last:]); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
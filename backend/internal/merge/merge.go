@@ -0,0 +1,134 @@
+// Package merge renders the merge language campaign content is written in.
+// It is Go template syntax over a fixed set of variables:
+//
+//	{{ contact.first_name | default "there" }}
+//	{{ contact.custom.plan | upper }}
+//	{{ if has_tag "vip" }}...{{ else }}...{{ end }}
+//	{{ campaign.subject }} {{ sender.name }} {{ unsubscribe_url }} {{ view_online_url }}
+//
+// HTML content is rendered with html/template, so merged values are
+// escaped for the context they land in; subjects and plain-text bodies are
+// rendered as text.
+package merge
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"email_campaign/internal/types"
+)
+
+const name = "content"
+
+// HTML renders HTML content for data.
+func HTML(src string, data *types.MergeData) (string, error) {
+	tmpl, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(funcs(data))).Parse(src)
+	if err != nil {
+		return "", convert(src, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, dot); err != nil {
+		return "", convert(src, err)
+	}
+	return buf.String(), nil
+}
+
+// Text renders a subject line or plain-text body for data.
+func Text(src string, data *types.MergeData) (string, error) {
+	tmpl, err := template.New(name).Funcs(funcs(data)).Parse(src)
+	if err != nil {
+		return "", convert(src, err)
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			blankMissing(t.Tree, t.Tree.Root)
+		}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, dot); err != nil {
+		return "", convert(src, err)
+	}
+	return buf.String(), nil
+}
+
+// dot is what a bare {{ .field }} refers to. Nothing is defined there, so
+// content written for the old free-form preview variables renders blank
+// instead of failing.
+var dot = map[string]interface{}{}
+
+// blankMissing ends every printing action with the blank filter, which is
+// what html/template's escapers already do for HTML: a missing custom field
+// renders as nothing rather than "<no value>".
+func blankMissing(tree *parse.Tree, n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			blankMissing(tree, c)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		ident := parse.NewIdentifier("_blank").SetTree(tree).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{ident},
+		})
+	case *parse.IfNode:
+		blankMissing(tree, n.List)
+		blankMissing(tree, n.ElseList)
+	case *parse.RangeNode:
+		blankMissing(tree, n.List)
+		blankMissing(tree, n.ElseList)
+	case *parse.WithNode:
+		blankMissing(tree, n.List)
+		blankMissing(tree, n.ElseList)
+	}
+}
+
+func contactVars(c *types.MergeContact) map[string]interface{} {
+	if c == nil {
+		c = &types.MergeContact{}
+	}
+	custom := c.Custom
+	if custom == nil {
+		custom = map[string]interface{}{}
+	}
+	tags := c.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return map[string]interface{}{
+		"email":      c.Email,
+		"first_name": c.FirstName,
+		"last_name":  c.LastName,
+		"full_name":  strings.TrimSpace(c.FirstName + " " + c.LastName),
+		"phone":      c.Phone,
+		"company":    c.Company,
+		"custom":     custom,
+		"tags":       tags,
+	}
+}
+
+func campaignVars(c types.MergeCampaign) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      c.ID,
+		"name":    c.Name,
+		"subject": c.Subject,
+	}
+}
+
+func senderVars(s types.MergeSender) map[string]interface{} {
+	return map[string]interface{}{
+		"name":     s.Name,
+		"email":    s.Email,
+		"reply_to": s.ReplyTo,
+	}
+}
@@ -0,0 +1,162 @@
+package merge
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"email_campaign/internal/types"
+)
+
+var jane = &types.MergeData{
+	Contact: &types.MergeContact{
+		Email:     "jane+news@acme.test",
+		FirstName: "jane",
+		Custom:    map[string]interface{}{"plan": "pro", "balance": 1234567.891, "renews": "2026-03-04"},
+		Tags:      []string{"VIP"},
+	},
+	Campaign: types.MergeCampaign{Name: "Tips & <tricks>"},
+	Sender:   types.MergeSender{Name: "Acme"},
+}
+
+func TestHTML(t *testing.T) {
+	src := `<p>Hi {{ contact.first_name | title }}, {{ campaign.name }}</p>` +
+		`{{ if has_tag "vip" }}<b>{{ contact.custom.plan | upper }}</b>{{ else }}standard{{ end }}` +
+		`<a href="https://acme.test/p?e={{ contact.email | urlquery }}">{{ contact.custom.missing }}</a>`
+	got, err := HTML(src, jane)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p>Hi Jane, Tips &amp; &lt;tricks&gt;</p><b>PRO</b>` +
+		`<a href="https://acme.test/p?e=jane%2Bnews%40acme.test"></a>`
+	if got != want {
+		t.Errorf("HTML() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMergeWithoutContact(t *testing.T) {
+	got, err := HTML(`<p>Hi {{ contact.first_name | default "there" }},</p><p>{{ campaign.name }}</p>`, &types.MergeData{
+		Campaign: types.MergeCampaign{Name: "Tips & <tricks>"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<p>Hi there,</p><p>Tips &amp; &lt;tricks&gt;</p>`; got != want {
+		t.Errorf("HTML() = %s, want %s", got, want)
+	}
+}
+
+func TestText(t *testing.T) {
+	src := `{{ contact.first_name | default "there" }}, {{ contact.custom.balance | number 2 }} due {{ contact.custom.renews | date "Jan 2, 2006" }}{{ contact.custom.missing }} from {{ sender.name }} & co`
+	got, err := Text(src, jane)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "jane, 1,234,567.89 due Mar 4, 2026 from Acme & co"; got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		src  string
+		want Error
+	}{
+		{"Hi {{ contact.firstname }}", Error{Line: 1, Column: 7, Message: `unknown variable "contact.firstname"`}},
+		{"Hi\n{{ first_name }}", Error{Line: 2, Message: `unknown variable or filter "first_name"`}},
+		{"{{ .FirstName }}", Error{Line: 1, Column: 4, Message: `unknown variable ".FirstName"`}},
+		{"{{ contact }}", Error{Line: 1, Column: 4, Message: "contact needs a field, such as contact.first_name"}},
+		{"{{ if has_tag \"vip\" }}", Error{Line: 1, Message: "unexpected EOF"}},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.src)
+		var errs Errors
+		if !errors.As(err, &errs) {
+			t.Errorf("Validate(%q) = %v, want Errors", tt.src, err)
+			continue
+		}
+		if errs[0] != tt.want {
+			t.Errorf("Validate(%q) = %+v, want %+v", tt.src, errs[0], tt.want)
+		}
+	}
+
+	valid := `{{ contact.custom.plan.tier }}{{ range contact.tags }}{{ . | lower }}{{ end }}{{ unsubscribe_url }}{{ view_online_url }}{{ now | date "2006" }}`
+	if err := ValidateHTML(valid); err != nil {
+		t.Errorf("ValidateHTML() = %v", err)
+	}
+}
+
+func TestValidateHTMLContext(t *testing.T) {
+	err := ValidateHTML("<a href=\"{{ unsubscribe_url }}\">ok</a>\n{{ if has_tag \"vip\" }}<a href=\"/vip{{ end }}\">")
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2") {
+		t.Errorf("ValidateHTML() = %v, want an error on line 2", err)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	blocks := map[string]string{
+		"header":  `<h1>{{ sender.name }}</h1>`,
+		"footer":  `<p>{{ include "address" }}</p>`,
+		"address": `1 Main St`,
+		"loop-a":  `{{ include "loop-b" }}`,
+		"loop-b":  `{{ include "loop-a" }}`,
+	}
+	lookup := func(name string) (string, error) {
+		if b, ok := blocks[name]; ok {
+			return b, nil
+		}
+		return "", ErrUnknownBlock
+	}
+
+	got, err := Expand(`{{ include "header" }}<p>Hi</p>{{- include "footer" -}}`, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<h1>{{ sender.name }}</h1><p>Hi</p><p>1 Main St</p>`; got != want {
+		t.Errorf("Expand() = %s, want %s", got, want)
+	}
+	if names := Includes(`{{ include "a" }}{{include "b"}}{{ include "a" }}`); strings.Join(names, ",") != "a,b" {
+		t.Errorf("Includes() = %v", names)
+	}
+
+	tests := []struct {
+		src  string
+		want Error
+	}{
+		{"x\n  {{ include \"nope\" }}", Error{Line: 2, Column: 3, Message: `unknown content block "nope"`}},
+		{`{{ include "loop-a" }}`, Error{Line: 1, Column: 1, Message: `content block "loop-a" includes itself: loop-a → loop-b → loop-a`}},
+	}
+	for _, tt := range tests {
+		_, err := Expand(tt.src, lookup)
+		var errs Errors
+		if !errors.As(err, &errs) {
+			t.Errorf("Expand(%q) = %v, want Errors", tt.src, err)
+			continue
+		}
+		if errs[0] != tt.want {
+			t.Errorf("Expand(%q) = %+v, want %+v", tt.src, errs[0], tt.want)
+		}
+	}
+
+	// Each level includes the one below ten times.
+	blocks["big0"] = strings.Repeat("x", 100)
+	for i := 1; i <= 5; i++ {
+		blocks[fmt.Sprintf("big%d", i)] = strings.Repeat(fmt.Sprintf(`{{ include "big%d" }}`, i-1), 10)
+	}
+	if _, err := Expand(`{{ include "big4" }}`, lookup); err != nil {
+		t.Errorf("Expand(1,000,000 bytes) = %v", err)
+	}
+	_, err = Expand("<p>\n{{ include \"big5\" }}", lookup)
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Line != 2 || !strings.Contains(errs[0].Message, "larger than") {
+		t.Errorf("Expand(10,000,000 bytes) = %v, want one Error at the include", err)
+	}
+
+	if err := Validate(`{{ include "footer" }}`); err != nil {
+		t.Errorf("Validate(include) = %v", err)
+	}
+	if err := Validate(`{{ include contact.company }}`); err == nil {
+		t.Error("Validate accepted an include without a quoted name")
+	}
+}
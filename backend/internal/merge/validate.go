@@ -0,0 +1,277 @@
+package merge
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"email_campaign/internal/types"
+)
+
+// Error is a problem with the merge tags at a position in the content.
+// Lines and columns start at 1; Column is 0 when only the line is known.
+// Field names the template field the content came from.
+type Error struct {
+	Field   string `json:"field,omitempty"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e Error) Error() string {
+	loc := "line " + strconv.Itoa(e.Line)
+	if e.Column > 0 {
+		loc += fmt.Sprintf(", column %d", e.Column)
+	}
+	if e.Field != "" {
+		loc = e.Field + " " + loc
+	}
+	return loc + ": " + e.Message
+}
+
+// Errors is every problem found in a piece of content, in source order.
+type Errors []Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// InField sets the field every error is reported against.
+func (e Errors) InField(field string) Errors {
+	for i := range e {
+		e[i].Field = field
+	}
+	return e
+}
+
+// vars are the fields of each variable namespace. Any key is allowed under
+// contact.custom, since custom fields differ per account.
+var vars = map[string]map[string]bool{
+	"contact": {
+		"email": true, "first_name": true, "last_name": true, "full_name": true,
+		"phone": true, "company": true, "custom": true, "tags": true,
+	},
+	"campaign": {"id": true, "name": true, "subject": true},
+	"sender":   {"name": true, "email": true, "reply_to": true},
+}
+
+// Validate checks text content, such as a subject line, for syntax errors
+// and unknown variables. It returns nil or Errors.
+func Validate(src string) error {
+	tmpl, err := template.New(name).Funcs(funcs(nil)).Parse(src)
+	if err != nil {
+		return convert(src, err)
+	}
+	c := &checker{src: src}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			c.walk(t.Tree.Root, true)
+		}
+	}
+	if len(c.errs) > 0 {
+		sort.SliceStable(c.errs, func(i, j int) bool {
+			if c.errs[i].Line != c.errs[j].Line {
+				return c.errs[i].Line < c.errs[j].Line
+			}
+			return c.errs[i].Column < c.errs[j].Column
+		})
+		return c.errs
+	}
+	_, err = Text(src, sample)
+	return err
+}
+
+// ValidateHTML is Validate for HTML content. It also catches merge tags
+// that leave the markup ambiguous, such as an if that opens an attribute
+// in only one branch, where no value could be escaped safely.
+func ValidateHTML(src string) error {
+	if err := Validate(src); err != nil {
+		return err
+	}
+	tmpl, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(funcs(sample))).Parse(src)
+	if err == nil {
+		err = tmpl.Execute(io.Discard, dot)
+	}
+	if err != nil {
+		return convert(src, err)
+	}
+	return nil
+}
+
+// sample is what content is trial-rendered with during validation.
+var sample = &types.MergeData{Contact: &types.MergeContact{}}
+
+type checker struct {
+	src  string
+	errs Errors
+}
+
+// walk checks every variable used under n. top is false inside range and
+// with, where dot is no longer the data root.
+func (c *checker) walk(n parse.Node, top bool) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.walk(child, top)
+		}
+	case *parse.ActionNode:
+		c.include(n.Pipe)
+		c.pipe(n.Pipe, top)
+	case *parse.IfNode:
+		c.pipe(n.Pipe, top)
+		c.walk(n.List, top)
+		c.walk(n.ElseList, top)
+	case *parse.RangeNode:
+		c.pipe(n.Pipe, top)
+		c.walk(n.List, false)
+		c.walk(n.ElseList, top)
+	case *parse.WithNode:
+		c.pipe(n.Pipe, top)
+		c.walk(n.List, false)
+		c.walk(n.ElseList, top)
+	case *parse.TemplateNode:
+		c.pipe(n.Pipe, top)
+	}
+}
+
+// include checks that include is only used as {{ include "name" }}, the
+// one form Expand replaces.
+func (c *checker) include(p *parse.PipeNode) {
+	for i, cmd := range p.Cmds {
+		ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+		if !ok || ident.Ident != "include" {
+			continue
+		}
+		var name *parse.StringNode
+		if len(cmd.Args) == 2 {
+			name, _ = cmd.Args[1].(*parse.StringNode)
+		}
+		if i > 0 || len(p.Cmds) > 1 || len(p.Decl) > 0 || name == nil || !strings.HasPrefix(name.Quoted, `"`) {
+			c.errorf(ident.Position(), `include takes a block name in quotes, as in {{ include "footer" }}`)
+		}
+	}
+}
+
+func (c *checker) pipe(p *parse.PipeNode, top bool) {
+	if p == nil {
+		return
+	}
+	for _, cmd := range p.Cmds {
+		for _, arg := range cmd.Args {
+			c.arg(arg, top)
+		}
+	}
+}
+
+func (c *checker) arg(n parse.Node, top bool) {
+	switch n := n.(type) {
+	case *parse.ChainNode:
+		if ident, ok := n.Node.(*parse.IdentifierNode); ok {
+			c.variable(ident.Ident, n.Field, ident.Position())
+			return
+		}
+		c.arg(n.Node, top)
+	case *parse.IdentifierNode:
+		if _, ok := vars[n.Ident]; ok {
+			c.errorf(n.Position(), "%s needs a field, such as %s.%s", n.Ident, n.Ident, example(n.Ident))
+		}
+	case *parse.FieldNode:
+		if top {
+			c.unknown(n.Position(), "."+strings.Join(n.Ident, "."))
+		}
+	case *parse.VariableNode:
+		if top && len(n.Ident) > 1 && n.Ident[0] == "$" {
+			c.unknown(n.Position(), strings.Join(n.Ident, "."))
+		}
+	case *parse.PipeNode:
+		c.pipe(n, top)
+	}
+}
+
+func (c *checker) variable(ns string, fields []string, pos parse.Pos) {
+	known, ok := vars[ns]
+	if !ok {
+		return
+	}
+	path := ns + "." + strings.Join(fields, ".")
+	switch {
+	case !known[fields[0]]:
+		c.unknown(pos, path)
+	case len(fields) > 1 && !(ns == "contact" && fields[0] == "custom"):
+		c.unknown(pos, path)
+	}
+}
+
+func (c *checker) unknown(pos parse.Pos, variable string) {
+	c.errorf(pos, "unknown variable %q", variable)
+}
+
+func (c *checker) errorf(pos parse.Pos, format string, args ...interface{}) {
+	line, col := position(c.src, int(pos))
+	c.errs = append(c.errs, Error{Line: line, Column: col, Message: fmt.Sprintf(format, args...)})
+}
+
+func example(ns string) string {
+	switch ns {
+	case "contact":
+		return "first_name"
+	case "sender":
+		return "email"
+	}
+	return "name"
+}
+
+// position turns a byte offset into a line and column.
+func position(src string, offset int) (int, int) {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	before := src[:offset]
+	line := strings.Count(before, "\n") + 1
+	col := offset - strings.LastIndexByte(before, '\n')
+	return line, col
+}
+
+var (
+	errLocation = regexp.MustCompile(`^template: [^:]*:(\d+):(?:(\d+):)? (.*)$`)
+	errExecuted = regexp.MustCompile(`^executing "[^"]*" at `)
+	errFunction = regexp.MustCompile(`^function "([^"]+)" not defined$`)
+)
+
+// convert turns a template error into Errors carrying its position.
+func convert(src string, err error) error {
+	var herr *htmltemplate.Error
+	if errors.As(err, &herr) && herr.ErrorCode != htmltemplate.OK {
+		e := Error{Line: herr.Line, Message: herr.Description}
+		if herr.Node != nil {
+			e.Line, e.Column = position(src, int(herr.Node.Position()))
+		}
+		return Errors{e}
+	}
+
+	m := errLocation.FindStringSubmatch(err.Error())
+	if m == nil {
+		return Errors{{Line: 1, Message: err.Error()}}
+	}
+	e := Error{Message: errExecuted.ReplaceAllString(m[3], "")}
+	e.Line, _ = strconv.Atoi(m[1])
+	e.Column, _ = strconv.Atoi(m[2])
+	if f := errFunction.FindStringSubmatch(e.Message); f != nil {
+		e.Message = fmt.Sprintf("unknown variable or filter %q", f[1])
+	}
+	return Errors{e}
+}
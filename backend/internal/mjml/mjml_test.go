@@ -0,0 +1,153 @@
+package mjml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const newsletter = `<mjml>
+  <mj-head>
+    <mj-title>Spring news</mj-title>
+    <mj-preview>What's new this spring</mj-preview>
+    <mj-attributes>
+      <mj-all font-family="Arial, sans-serif" />
+      <mj-text color="#333333" />
+      <mj-class name="big" font-size="24px" />
+    </mj-attributes>
+  </mj-head>
+  <mj-body background-color="#f4f4f4">
+    <mj-section background-color="#ffffff" padding="20px 0">
+      <mj-column>
+        <mj-image src="https://acme.test/logo.png" alt="Acme" width="200px" href="https://acme.test" />
+        <mj-text mj-class="big" align="center">Hello {{ contact.first_name }}<br>&nbsp;welcome</mj-text>
+        <mj-divider border-width="1px" border-color="#dddddd" />
+      </mj-column>
+    </mj-section>
+    <mj-section>
+      <mj-column width="40%">
+        <mj-button href="https://acme.test/shop" background-color="#ff6600">Shop now</mj-button>
+      </mj-column>
+      <mj-column width="60%">
+        <mj-spacer height="30px" />
+        <mj-social mode="horizontal">
+          <mj-social-element name="facebook" href="https://facebook.com/acme">Facebook</mj-social-element>
+          <mj-social-element name="x" href="https://x.com/acme" />
+        </mj-social>
+        <mj-raw><p class="raw">raw html</p></mj-raw>
+      </mj-column>
+    </mj-section>
+  </mj-body>
+</mjml>`
+
+func TestCompile(t *testing.T) {
+	html, err := Compile(newsletter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<title>Spring news</title>",
+		"What's new this spring</div>",
+		".mj-column-per-100 { width:100% !important; max-width: 100%; }",
+		".mj-column-per-40 { width:40% !important; max-width: 40%; }",
+		`<a href="https://acme.test" target="_blank"><img alt="Acme" height="auto" src="https://acme.test/logo.png"`,
+		`width="200">`,
+		// mj-class beats mj-attributes, which beats mj-all.
+		`font-family:Arial, sans-serif;font-size:24px;line-height:1;text-align:center;color:#333333;">Hello {{ contact.first_name }}<br>&nbsp;welcome</div>`,
+		"border-top:solid 1px #dddddd;",
+		`<td align="center" bgcolor="#ff6600"`,
+		`<a href="https://acme.test/shop" target="_blank" style="display:inline-block;background:#ff6600;color:#ffffff;`,
+		`<div style="height:30px;line-height:30px;">&#8202;</div>`,
+		socialIcons + "facebook.png",
+		socialIcons + "twitter-x.png",
+		">Facebook</a>",
+		`<p class="raw">raw html</p>`,
+		"background-color:#f4f4f4;",
+		// Outlook gets fixed pixel widths: 40% of 600px.
+		`<!--[if mso | IE]><td style="vertical-align:top;width:240px;"><![endif]-->`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("output missing %s", want)
+		}
+	}
+}
+
+func TestImageWidthFitsColumn(t *testing.T) {
+	html, err := Compile(`<mjml><mj-body><mj-section><mj-column><mj-image src="a.png" width="900px" /></mj-column></mj-section></mj-body></mjml>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 600px body, 0 section side padding, 25px image padding on each side.
+	if !strings.Contains(html, `<td style="width:550px;">`) || !strings.Contains(html, `width="550">`) {
+		t.Errorf("image not clamped to 550px:\n%s", html)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		want []Error
+	}{
+		{"unclosed", "<mjml>\n  <mj-body>\n    <mj-section>\n  </mj-body>\n</mjml>", []Error{
+			{Line: 4, Column: 3, Message: "unexpected </mj-body>, expected </mj-section> to close <mj-section> from line 3"},
+		}},
+		{"unclosed text", "<mjml><mj-body><mj-section><mj-column>\n<mj-text>hi", []Error{
+			{Line: 1, Column: 1, Message: "<mjml> is never closed"},
+			{Line: 1, Column: 7, Message: "<mj-body> is never closed"},
+			{Line: 1, Column: 16, Message: "<mj-section> is never closed"},
+			{Line: 1, Column: 28, Message: "<mj-column> is never closed"},
+			{Line: 2, Column: 1, Message: "<mj-text> is never closed"},
+		}},
+		{"rules", `<mjml>
+<mj-body>
+  <mj-section>
+    <mj-text>not in a column</mj-text>
+    <mj-column width="half">
+      <mj-image alt="no src" colour="red" />
+      <mj-blink />
+    </mj-column>
+  </mj-section>
+</mj-body>
+</mjml>`, []Error{
+			{Line: 4, Column: 5, Tag: "mj-text", Message: "<mj-text> cannot be used inside <mj-section>, which only accepts <mj-column>, <mj-raw>"},
+			{Line: 5, Column: 16, Tag: "mj-column", Message: `attribute width on <mj-column> must be a pixel or percent value such as 10px or 50%, got "half"`},
+			{Line: 6, Column: 7, Tag: "mj-image", Message: "<mj-image> requires the src attribute"},
+			{Line: 6, Column: 30, Tag: "mj-image", Message: "attribute colour is not allowed on <mj-image>"},
+			{Line: 7, Column: 7, Tag: "mj-blink", Message: "unknown tag <mj-blink>"},
+		}},
+		{"no body", "<mjml><mj-head></mj-head></mjml>", []Error{
+			{Line: 1, Column: 1, Tag: "mjml", Message: "<mjml> must contain an <mj-body>"},
+		}},
+		{"text outside", "<mjml><mj-body>\n  stray</mj-body></mjml>", []Error{
+			{Line: 2, Column: 3, Message: "text is not allowed directly inside <mj-body>; wrap it in <mj-text>"},
+		}},
+	}
+	for _, c := range cases {
+		_, err := Compile(c.src)
+		var errs Errors
+		if !errors.As(err, &errs) {
+			t.Errorf("%s: got %v, want Errors", c.name, err)
+			continue
+		}
+		if len(errs) != len(c.want) {
+			t.Errorf("%s: got %d errors, want %d: %v", c.name, len(errs), len(c.want), errs)
+			continue
+		}
+		for i := range errs {
+			if errs[i] != c.want[i] {
+				t.Errorf("%s: error %d\n got %+v\nwant %+v", c.name, i, errs[i], c.want[i])
+			}
+		}
+	}
+}
+
+func TestMergeTagsInAttributesAreKept(t *testing.T) {
+	html, err := Compile(`<mjml><mj-body><mj-section><mj-column><mj-button href='{{ view_online_url | printf "%s" }}'>View</mj-button></mj-column></mj-section></mj-body></mjml>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, `href="{{ view_online_url | printf "%s" }}"`) {
+		t.Errorf("merge tag was altered:\n%s", html)
+	}
+}
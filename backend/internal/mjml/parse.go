@@ -0,0 +1,317 @@
+// Package mjml compiles MJML markup into responsive, email-client friendly
+// HTML. It supports the core components: mj-section, mj-column, mj-text,
+// mj-image, mj-button, mj-divider, mj-spacer, mj-social, mj-raw and
+// mj-attributes, plus mj-title, mj-preview, mj-style, mj-font and
+// mj-breakpoint in mj-head.
+package mjml
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Error is a problem found at a position in the MJML source. Lines and
+// columns start at 1.
+type Error struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Tag     string `json:"tag,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// Errors is every problem found in a document, in source order.
+type Errors []Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e Errors) sort() {
+	sort.SliceStable(e, func(i, j int) bool {
+		if e[i].Line != e[j].Line {
+			return e[i].Line < e[j].Line
+		}
+		return e[i].Column < e[j].Column
+	})
+}
+
+type pos struct {
+	line, col int
+}
+
+type node struct {
+	tag      string
+	attrs    map[string]string
+	attrPos  map[string]pos
+	children []*node
+	// content is the raw inner HTML of ending tags such as mj-text, which
+	// is passed through without being parsed.
+	content string
+	pos     pos
+}
+
+// endingTags hold HTML rather than MJML.
+var endingTags = map[string]bool{
+	"mj-text":           true,
+	"mj-button":         true,
+	"mj-raw":            true,
+	"mj-title":          true,
+	"mj-preview":        true,
+	"mj-style":          true,
+	"mj-social-element": true,
+}
+
+type parser struct {
+	src  string
+	i    int
+	line int
+	col  int
+	errs Errors
+}
+
+func (p *parser) here() pos {
+	return pos{p.line, p.col}
+}
+
+func (p *parser) errorf(at pos, format string, args ...interface{}) {
+	p.errs = append(p.errs, Error{Line: at.line, Column: at.col, Message: fmt.Sprintf(format, args...)})
+}
+
+// advance moves past n bytes, keeping the line and column up to date.
+func (p *parser) advance(n int) {
+	for _, c := range p.src[p.i : p.i+n] {
+		if c == '\n' {
+			p.line++
+			p.col = 1
+		} else {
+			p.col++
+		}
+	}
+	p.i += n
+}
+
+func (p *parser) skipSpace() {
+	n := 0
+	for p.i+n < len(p.src) && isSpace(p.src[p.i+n]) {
+		n++
+	}
+	p.advance(n)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == ':'
+}
+
+func (p *parser) name() string {
+	n := 0
+	for p.i+n < len(p.src) && isNameChar(p.src[p.i+n]) {
+		n++
+	}
+	s := p.src[p.i : p.i+n]
+	p.advance(n)
+	return strings.ToLower(s)
+}
+
+// parse reads src into a tree. Syntax errors are collected rather than
+// returned one at a time, and parsing continues where it sensibly can.
+func parse(src string) (*node, Errors) {
+	p := &parser{src: src, line: 1, col: 1}
+	root := &node{tag: "#document"}
+	stack := []*node{root}
+
+	for p.i < len(p.src) {
+		top := stack[len(stack)-1]
+		rest := p.src[p.i:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			start := p.here()
+			end := strings.Index(rest, "-->")
+			if end < 0 {
+				p.errorf(start, "comment is never closed")
+				p.advance(len(rest))
+				continue
+			}
+			p.advance(end + 3)
+		case strings.HasPrefix(rest, "<?"), strings.HasPrefix(rest, "<!"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			p.advance(end + 1)
+		case strings.HasPrefix(rest, "</"):
+			start := p.here()
+			p.advance(2)
+			tag := p.name()
+			p.skipSpace()
+			if p.i < len(p.src) && p.src[p.i] == '>' {
+				p.advance(1)
+			} else {
+				p.errorf(start, "malformed closing tag </%s>", tag)
+			}
+			if tag != top.tag {
+				if len(stack) > 1 {
+					p.errorf(start, "unexpected </%s>, expected </%s> to close <%s> from line %d", tag, top.tag, top.tag, top.pos.line)
+				} else {
+					p.errorf(start, "unexpected </%s> with no open tag", tag)
+				}
+				// Recover by closing up to a matching open tag, if any.
+				for j := len(stack) - 1; j > 0; j-- {
+					if stack[j].tag == tag {
+						stack = stack[:j]
+						break
+					}
+				}
+				continue
+			}
+			stack = stack[:len(stack)-1]
+		case len(rest) > 1 && rest[0] == '<' && isNameChar(rest[1]):
+			n, open := p.openTag()
+			if n == nil {
+				continue
+			}
+			top.children = append(top.children, n)
+			if open {
+				stack = append(stack, n)
+			}
+		default:
+			start := p.here()
+			end := strings.IndexByte(rest, '<')
+			if end < 0 {
+				end = len(rest)
+			} else if end == 0 {
+				end = 1
+			}
+			if text := strings.TrimSpace(rest[:end]); text != "" {
+				at := start
+				// Point at the first non-blank character.
+				lead := rest[:strings.Index(rest, text[:1])]
+				at.line += strings.Count(lead, "\n")
+				if k := strings.LastIndexByte(lead, '\n'); k >= 0 {
+					at.col = len(lead) - k
+				} else {
+					at.col += len(lead)
+				}
+				if top.tag == "#document" {
+					p.errorf(at, "text outside of <mjml>")
+				} else {
+					p.errorf(at, "text is not allowed directly inside <%s>; wrap it in <mj-text>", top.tag)
+				}
+			}
+			p.advance(end)
+		}
+	}
+
+	for _, n := range stack[1:] {
+		p.errorf(n.pos, "<%s> is never closed", n.tag)
+	}
+	p.errs.sort()
+	return root, p.errs
+}
+
+var closingTags = func() map[string]*regexp.Regexp {
+	m := make(map[string]*regexp.Regexp, len(endingTags))
+	for tag := range endingTags {
+		m[tag] = regexp.MustCompile(`(?i)</` + regexp.QuoteMeta(tag) + `\s*>`)
+	}
+	return m
+}()
+
+// openTag reads a start tag and, for ending tags, everything up to the
+// matching end tag. open reports whether the tag still needs closing.
+func (p *parser) openTag() (n *node, open bool) {
+	start := p.here()
+	p.advance(1)
+	n = &node{tag: p.name(), attrs: map[string]string{}, attrPos: map[string]pos{}, pos: start}
+
+	for {
+		p.skipSpace()
+		if p.i >= len(p.src) {
+			p.errorf(start, "<%s> is never closed", n.tag)
+			return nil, false
+		}
+		c := p.src[p.i]
+		if c == '>' {
+			p.advance(1)
+			break
+		}
+		if c == '/' && p.i+1 < len(p.src) && p.src[p.i+1] == '>' {
+			p.advance(2)
+			return n, false
+		}
+
+		at := p.here()
+		name := p.name()
+		if name == "" {
+			p.errorf(at, "unexpected %q in <%s>", c, n.tag)
+			p.advance(1)
+			continue
+		}
+		value := ""
+		p.skipSpace()
+		if p.i < len(p.src) && p.src[p.i] == '=' {
+			p.advance(1)
+			p.skipSpace()
+			value = p.attrValue(n.tag, name)
+		}
+		if _, dup := n.attrs[name]; dup {
+			p.errorf(at, "duplicate attribute %s on <%s>", name, n.tag)
+		}
+		n.attrs[name] = value
+		n.attrPos[name] = at
+	}
+
+	if endingTags[n.tag] {
+		rest := p.src[p.i:]
+		loc := closingTags[n.tag].FindStringIndex(rest)
+		if loc == nil {
+			p.errorf(start, "<%s> is never closed", n.tag)
+			p.advance(len(rest))
+			return n, false
+		}
+		n.content = strings.TrimSpace(rest[:loc[0]])
+		p.advance(loc[1])
+		return n, false
+	}
+	return n, true
+}
+
+func (p *parser) attrValue(tag, name string) string {
+	if p.i >= len(p.src) {
+		return ""
+	}
+	q := p.src[p.i]
+	if q == '"' || q == '\'' {
+		at := p.here()
+		end := strings.IndexByte(p.src[p.i+1:], q)
+		if end < 0 {
+			p.errorf(at, "unterminated value for attribute %s on <%s>", name, tag)
+			p.advance(len(p.src) - p.i)
+			return ""
+		}
+		v := p.src[p.i+1 : p.i+1+end]
+		p.advance(end + 2)
+		return v
+	}
+	n := 0
+	for p.i+n < len(p.src) && !isSpace(p.src[p.i+n]) && p.src[p.i+n] != '>' &&
+		!(p.src[p.i+n] == '/' && p.i+n+1 < len(p.src) && p.src[p.i+n+1] == '>') {
+		n++
+	}
+	v := p.src[p.i : p.i+n]
+	p.advance(n)
+	return v
+}
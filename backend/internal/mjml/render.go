@@ -0,0 +1,702 @@
+package mjml
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Compile validates an MJML document and renders it to HTML. Every
+// problem found is returned at once as Errors.
+func Compile(src string) (string, error) {
+	doc, errs := parse(src)
+	if len(errs) == 0 {
+		errs = validate(doc)
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	r := &renderer{
+		defaults:   map[string]map[string]string{},
+		classes:    map[string]map[string]string{},
+		breakpoint: "480px",
+		bodyWidth:  600,
+	}
+	return r.render(doc.children[0]), nil
+}
+
+type font struct {
+	name, href string
+}
+
+type renderer struct {
+	defaults map[string]map[string]string // mj-attributes, by tag or "mj-all"
+	classes  map[string]map[string]string // mj-class attributes, by name
+
+	title      string
+	preview    string
+	styles     []string
+	fonts      []font
+	headRaw    []string
+	breakpoint string
+
+	bodyWidth int
+	columns   map[string]string // media query rules, by column class
+	colOrder  []string
+}
+
+// attr resolves an attribute in MJML's order of precedence: the tag
+// itself, then its mj-class classes, then mj-attributes for its tag, then
+// mj-all, then the component's default.
+func (r *renderer) attr(n *node, name string) string {
+	if v, ok := n.attrs[name]; ok {
+		return v
+	}
+	classes := strings.Fields(n.attrs["mj-class"])
+	for i := len(classes) - 1; i >= 0; i-- {
+		if v, ok := r.classes[classes[i]][name]; ok {
+			return v
+		}
+	}
+	if v, ok := r.defaults[n.tag][name]; ok {
+		return v
+	}
+	spec, known := components[n.tag].attrs[name]
+	if v, ok := r.defaults["mj-all"][name]; ok && known {
+		return v
+	}
+	return spec.def
+}
+
+func (r *renderer) render(root *node) string {
+	var body *node
+	for _, c := range root.children {
+		switch c.tag {
+		case "mj-head":
+			r.head(c)
+		case "mj-body":
+			body = c
+		}
+	}
+
+	var content strings.Builder
+	bodyStyle := "word-spacing:normal;"
+	if body != nil {
+		if w := pxValue(r.attr(body, "width")); w > 0 {
+			r.bodyWidth = w
+		}
+		bg := r.attr(body, "background-color")
+		bodyStyle += style("background-color", bg)
+		fmt.Fprintf(&content, `<div%s style="%s" lang="%s" dir="%s">`+"\n",
+			classAttr(r.attr(body, "css-class")), style("background-color", bg), esc(r.attr(root, "lang")), esc(r.attr(root, "dir")))
+		for _, c := range body.children {
+			switch c.tag {
+			case "mj-section":
+				r.section(&content, c)
+			case "mj-raw":
+				content.WriteString(c.content + "\n")
+			}
+		}
+		content.WriteString("</div>\n")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<!doctype html>
+<html lang="%s" dir="%s" xmlns="http://www.w3.org/1999/xhtml" xmlns:v="urn:schemas-microsoft-com:vml" xmlns:o="urn:schemas-microsoft-com:office:office">
+<head>
+<title>%s</title>
+<!--[if !mso]><!--><meta http-equiv="X-UA-Compatible" content="IE=edge"><!--<![endif]-->
+<meta http-equiv="Content-Type" content="text/html; charset=UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style type="text/css">
+#outlook a { padding:0; }
+body { margin:0;padding:0;-webkit-text-size-adjust:100%%;-ms-text-size-adjust:100%%; }
+table, td { border-collapse:collapse;mso-table-lspace:0pt;mso-table-rspace:0pt; }
+img { border:0;height:auto;line-height:100%%;outline:none;text-decoration:none;-ms-interpolation-mode:bicubic; }
+p { display:block;margin:13px 0; }
+</style>
+<!--[if mso]><noscript><xml><o:OfficeDocumentSettings><o:AllowPNG/><o:PixelsPerInch>96</o:PixelsPerInch></o:OfficeDocumentSettings></xml></noscript><![endif]-->
+<!--[if lte mso 11]><style type="text/css">.mj-outlook-group-fix { width:100%% !important; }</style><![endif]-->
+`, esc(r.attr(root, "lang")), esc(r.attr(root, "dir")), r.title)
+
+	if len(r.fonts) > 0 {
+		b.WriteString("<!--[if !mso]><!-->\n")
+		for _, f := range r.fonts {
+			fmt.Fprintf(&b, `<link href="%s" rel="stylesheet" type="text/css">`+"\n", esc(f.href))
+		}
+		b.WriteString(`<style type="text/css">` + "\n")
+		for _, f := range r.fonts {
+			fmt.Fprintf(&b, "@import url(%s);\n", f.href)
+		}
+		b.WriteString("</style>\n<!--<![endif]-->\n")
+	}
+
+	if len(r.colOrder) > 0 {
+		fmt.Fprintf(&b, "<style type=\"text/css\">\n@media only screen and (min-width:%s) {\n", r.breakpoint)
+		for _, class := range r.colOrder {
+			fmt.Fprintf(&b, ".%s { %s }\n", class, r.columns[class])
+		}
+		b.WriteString("}\n</style>\n")
+		fmt.Fprintf(&b, "<style media=\"screen and (min-width:%s)\">\n", r.breakpoint)
+		for _, class := range r.colOrder {
+			fmt.Fprintf(&b, ".moz-text-html .%s { %s }\n", class, r.columns[class])
+		}
+		b.WriteString("</style>\n")
+	}
+	for _, s := range r.styles {
+		b.WriteString("<style type=\"text/css\">\n" + s + "\n</style>\n")
+	}
+	for _, raw := range r.headRaw {
+		b.WriteString(raw + "\n")
+	}
+	b.WriteString("</head>\n")
+
+	fmt.Fprintf(&b, `<body style="%s">`+"\n", bodyStyle)
+	if r.preview != "" {
+		fmt.Fprintf(&b, `<div style="display:none;font-size:1px;color:#ffffff;line-height:1px;max-height:0px;max-width:0px;opacity:0;overflow:hidden;">%s</div>`+"\n", r.preview)
+	}
+	b.WriteString(content.String())
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+func (r *renderer) head(n *node) {
+	for _, c := range n.children {
+		switch c.tag {
+		case "mj-title":
+			r.title = c.content
+		case "mj-preview":
+			r.preview = c.content
+		case "mj-style":
+			r.styles = append(r.styles, c.content)
+		case "mj-font":
+			r.fonts = append(r.fonts, font{name: c.attrs["name"], href: c.attrs["href"]})
+		case "mj-breakpoint":
+			r.breakpoint = c.attrs["width"]
+		case "mj-raw":
+			r.headRaw = append(r.headRaw, c.content)
+		case "mj-attributes":
+			for _, a := range c.children {
+				attrs := map[string]string{}
+				for k, v := range a.attrs {
+					attrs[k] = v
+				}
+				if a.tag == "mj-class" {
+					name := attrs["name"]
+					delete(attrs, "name")
+					r.classes[name] = attrs
+					continue
+				}
+				if r.defaults[a.tag] == nil {
+					r.defaults[a.tag] = map[string]string{}
+				}
+				for k, v := range attrs {
+					r.defaults[a.tag][k] = v
+				}
+			}
+		}
+	}
+}
+
+func (r *renderer) section(w *strings.Builder, n *node) {
+	full := r.attr(n, "full-width") == "full-width"
+	pad := r.padding(n)
+	boxWidth := r.bodyWidth - pad[1] - pad[3]
+	bg := r.background(n)
+	bgColor := r.attr(n, "background-color")
+	radius := r.attr(n, "border-radius")
+
+	fmt.Fprintf(w, `<!--[if mso | IE]><table align="center" border="0" cellpadding="0" cellspacing="0" role="presentation" style="width:%dpx;" width="%d"%s><tr><td style="line-height:0px;font-size:0px;mso-line-height-rule:exactly;"><![endif]-->`+"\n",
+		r.bodyWidth, r.bodyWidth, optAttr("bgcolor", bgColor))
+
+	if full {
+		fmt.Fprintf(w, `<table align="center"%s border="0" cellpadding="0" cellspacing="0" role="presentation" style="%s"><tbody><tr><td>`+"\n",
+			classAttr(r.attr(n, "css-class")), bg+"width:100%;")
+		fmt.Fprintf(w, `<div style="margin:0px auto;max-width:%dpx;">`+"\n", r.bodyWidth)
+	} else {
+		fmt.Fprintf(w, `<div%s style="%smargin:0px auto;max-width:%dpx;%s">`+"\n",
+			classAttr(r.attr(n, "css-class")), bg, r.bodyWidth, style("border-radius", radius, "overflow", ifSet(radius, "hidden")))
+	}
+	tableBg := bg
+	if full {
+		tableBg = ""
+	}
+	fmt.Fprintf(w, `<table align="center" border="0" cellpadding="0" cellspacing="0" role="presentation" style="%swidth:100%%;%s"><tbody><tr>`+"\n",
+		tableBg, style("border-radius", radius))
+	fmt.Fprintf(w, `<td style="%s">`+"\n", style(
+		"border", r.attr(n, "border"),
+		"direction", r.attr(n, "direction"),
+		"font-size", "0px",
+	)+r.paddingCSS(n)+style("text-align", r.attr(n, "text-align")))
+	w.WriteString(`<!--[if mso | IE]><table role="presentation" border="0" cellpadding="0" cellspacing="0"><tr><![endif]-->` + "\n")
+
+	var columns []*node
+	for _, c := range n.children {
+		if c.tag == "mj-column" {
+			columns = append(columns, c)
+		}
+	}
+	for _, c := range n.children {
+		switch c.tag {
+		case "mj-column":
+			r.column(w, c, len(columns), boxWidth, r.attr(n, "direction"))
+		case "mj-raw":
+			w.WriteString(c.content + "\n")
+		}
+	}
+
+	w.WriteString(`<!--[if mso | IE]></tr></table><![endif]-->` + "\n")
+	w.WriteString("</td></tr></tbody></table>\n</div>\n")
+	if full {
+		w.WriteString("</td></tr></tbody></table>\n")
+	}
+	w.WriteString(`<!--[if mso | IE]></td></tr></table><![endif]-->` + "\n")
+}
+
+func (r *renderer) background(n *node) string {
+	bgColor := r.attr(n, "background-color")
+	url := r.attr(n, "background-url")
+	if url == "" {
+		return style("background", bgColor, "background-color", bgColor)
+	}
+	position := r.attr(n, "background-position")
+	size := r.attr(n, "background-size")
+	repeat := r.attr(n, "background-repeat")
+	return fmt.Sprintf("background:%s url('%s') %s / %s %s;", strings.TrimSpace(bgColor), esc(url), position, size, repeat) +
+		style("background-position", position, "background-repeat", repeat, "background-size", size)
+}
+
+func (r *renderer) column(w *strings.Builder, n *node, siblings int, boxWidth int, direction string) {
+	class, mediaWidth, widthPx := columnWidth(r.attr(n, "width"), siblings, boxWidth)
+	if _, seen := r.columns[class]; !seen {
+		if r.columns == nil {
+			r.columns = map[string]string{}
+		}
+		r.columns[class] = fmt.Sprintf("width:%s !important; max-width: %s;", mediaWidth, mediaWidth)
+		r.colOrder = append(r.colOrder, class)
+	}
+
+	valign := r.attr(n, "vertical-align")
+	pad := r.padding(n)
+	contentWidth := widthPx - pad[1] - pad[3]
+	decor := style(
+		"background-color", r.attr(n, "background-color"),
+		"border", r.attr(n, "border"),
+		"border-radius", r.attr(n, "border-radius"),
+	)
+
+	fmt.Fprintf(w, `<!--[if mso | IE]><td style="vertical-align:%s;width:%dpx;"><![endif]-->`+"\n", valign, widthPx)
+	fmt.Fprintf(w, `<div class="%s mj-outlook-group-fix%s" style="font-size:0px;text-align:left;direction:%s;display:inline-block;vertical-align:%s;width:100%%;">`+"\n",
+		class, spaced(r.attr(n, "css-class")), direction, valign)
+
+	hasPadding := r.paddingCSS(n) != ""
+	if hasPadding {
+		fmt.Fprintf(w, `<table border="0" cellpadding="0" cellspacing="0" role="presentation" width="100%%"><tbody><tr><td style="%svertical-align:%s;%s">`+"\n",
+			decor, valign, r.paddingCSS(n))
+		w.WriteString(`<table border="0" cellpadding="0" cellspacing="0" role="presentation" width="100%"><tbody>` + "\n")
+	} else {
+		fmt.Fprintf(w, `<table border="0" cellpadding="0" cellspacing="0" role="presentation" style="%svertical-align:%s;" width="100%%"><tbody>`+"\n", decor, valign)
+	}
+
+	for _, c := range n.children {
+		r.element(w, c, contentWidth)
+	}
+
+	w.WriteString("</tbody></table>\n")
+	if hasPadding {
+		w.WriteString("</td></tr></tbody></table>\n")
+	}
+	w.WriteString("</div>\n")
+	w.WriteString(`<!--[if mso | IE]></td><![endif]-->` + "\n")
+}
+
+// columnWidth returns a column's CSS class, its width for the desktop
+// media query and its width in pixels for Outlook.
+func columnWidth(width string, siblings int, boxWidth int) (string, string, int) {
+	if strings.HasSuffix(width, "px") {
+		px := pxValue(width)
+		return "mj-column-px-" + strconv.Itoa(px), strconv.Itoa(px) + "px", px
+	}
+	pct := 100.0 / float64(siblings)
+	if strings.HasSuffix(width, "%") {
+		if v, err := strconv.ParseFloat(strings.TrimSuffix(width, "%"), 64); err == nil {
+			pct = v
+		}
+	}
+	pct = math.Round(pct*100) / 100
+	s := strconv.FormatFloat(pct, 'f', -1, 64)
+	return "mj-column-per-" + strings.ReplaceAll(s, ".", "-"), s + "%", int(math.Round(pct * float64(boxWidth) / 100))
+}
+
+// element renders one component inside a column, in a table row of its
+// own as MJML does.
+func (r *renderer) element(w *strings.Builder, n *node, columnWidth int) {
+	if n.tag == "mj-raw" {
+		w.WriteString(n.content + "\n")
+		return
+	}
+
+	pad := r.padding(n)
+	width := columnWidth - pad[1] - pad[3]
+	align := r.attr(n, "align")
+	if align == "" {
+		align = "left"
+	}
+
+	var inner string
+	switch n.tag {
+	case "mj-text":
+		inner = r.text(n)
+	case "mj-image":
+		inner = r.image(n, width)
+	case "mj-button":
+		inner = r.button(n)
+	case "mj-divider":
+		inner = r.divider(n, width)
+	case "mj-spacer":
+		inner = fmt.Sprintf(`<div style="height:%s;line-height:%s;">&#8202;</div>`, r.attr(n, "height"), r.attr(n, "height"))
+	case "mj-social":
+		inner = r.social(n)
+	}
+
+	fmt.Fprintf(w, `<tr><td align="%s"%s style="%s">`+"\n%s\n</td></tr>\n",
+		align, classAttr(r.attr(n, "css-class")),
+		style("background", r.attr(n, "container-background-color"), "font-size", "0px")+r.paddingCSS(n)+"word-break:break-word;",
+		inner)
+}
+
+func (r *renderer) text(n *node) string {
+	return fmt.Sprintf(`<div style="%s">%s</div>`, style(
+		"font-family", r.attr(n, "font-family"),
+		"font-size", r.attr(n, "font-size"),
+		"font-style", r.attr(n, "font-style"),
+		"font-weight", r.attr(n, "font-weight"),
+		"letter-spacing", r.attr(n, "letter-spacing"),
+		"line-height", r.attr(n, "line-height"),
+		"text-align", r.attr(n, "align"),
+		"text-decoration", r.attr(n, "text-decoration"),
+		"text-transform", r.attr(n, "text-transform"),
+		"color", r.attr(n, "color"),
+		"height", r.attr(n, "height"),
+	), n.content)
+}
+
+func (r *renderer) image(n *node, maxWidth int) string {
+	width := maxWidth
+	if w := pxValue(r.attr(n, "width")); w > 0 && w < maxWidth {
+		width = w
+	}
+	height := r.attr(n, "height")
+	heightAttr := height
+	if strings.HasSuffix(height, "px") {
+		heightAttr = strconv.Itoa(pxValue(height))
+	}
+
+	img := fmt.Sprintf(`<img alt="%s" height="%s" src="%s"%s style="%s" width="%d">`,
+		esc(r.attr(n, "alt")), esc(heightAttr), esc(r.attr(n, "src")), optAttr("title", r.attr(n, "title")),
+		style(
+			"border", r.attr(n, "border"),
+			"border-radius", r.attr(n, "border-radius"),
+			"display", "block",
+			"outline", "none",
+			"text-decoration", "none",
+			"height", height,
+			"width", "100%",
+			"font-size", "13px",
+		), width)
+	if href := r.attr(n, "href"); href != "" {
+		img = fmt.Sprintf(`<a href="%s" target="%s"%s>%s</a>`, esc(href), esc(r.attr(n, "target")), optAttr("rel", r.attr(n, "rel")), img)
+	}
+	return fmt.Sprintf(`<table border="0" cellpadding="0" cellspacing="0" role="presentation" style="border-collapse:collapse;border-spacing:0px;"><tbody><tr><td style="width:%dpx;">%s</td></tr></tbody></table>`,
+		width, img)
+}
+
+func (r *renderer) button(n *node) string {
+	bg := r.attr(n, "background-color")
+	radius := r.attr(n, "border-radius")
+	innerPadding := r.attr(n, "inner-padding")
+
+	tag := "p"
+	link := ""
+	if href := r.attr(n, "href"); href != "" {
+		tag = "a"
+		link = fmt.Sprintf(` href="%s" target="%s"%s%s`, esc(href), esc(r.attr(n, "target")),
+			optAttr("rel", r.attr(n, "rel")), optAttr("title", r.attr(n, "title")))
+	}
+	inner := fmt.Sprintf(`<%s%s style="%s">%s</%s>`, tag, link, style(
+		"display", "inline-block",
+		"width", r.attr(n, "width"),
+		"background", bg,
+		"color", r.attr(n, "color"),
+		"font-family", r.attr(n, "font-family"),
+		"font-size", r.attr(n, "font-size"),
+		"font-style", r.attr(n, "font-style"),
+		"font-weight", r.attr(n, "font-weight"),
+		"line-height", r.attr(n, "line-height"),
+		"letter-spacing", r.attr(n, "letter-spacing"),
+		"margin", "0",
+		"text-decoration", r.attr(n, "text-decoration"),
+		"text-transform", r.attr(n, "text-transform"),
+		"padding", innerPadding,
+		"mso-padding-alt", "0px",
+		"border-radius", radius,
+	), n.content, tag)
+
+	return fmt.Sprintf(`<table border="0" cellpadding="0" cellspacing="0" role="presentation" style="border-collapse:separate;%sline-height:100%%;"><tbody><tr><td align="center"%s role="presentation" style="%s" valign="%s">%s</td></tr></tbody></table>`,
+		style("width", r.attr(n, "width")), optAttr("bgcolor", bg),
+		style(
+			"border", r.attr(n, "border"),
+			"border-radius", radius,
+			"cursor", "auto",
+			"height", r.attr(n, "height"),
+			"mso-padding-alt", innerPadding,
+			"text-align", r.attr(n, "text-align"),
+			"background", bg,
+		), esc(r.attr(n, "vertical-align")), inner)
+}
+
+func (r *renderer) divider(n *node, width int) string {
+	border := fmt.Sprintf("%s %s %s", r.attr(n, "border-style"), r.attr(n, "border-width"), r.attr(n, "border-color"))
+	margin := "0px auto"
+	switch r.attr(n, "align") {
+	case "left":
+		margin = "0px"
+	case "right":
+		margin = "0px 0px 0px auto"
+	}
+	dividerWidth := r.attr(n, "width")
+	msoWidth := width
+	if strings.HasSuffix(dividerWidth, "px") {
+		msoWidth = pxValue(dividerWidth)
+	} else if v, err := strconv.ParseFloat(strings.TrimSuffix(dividerWidth, "%"), 64); err == nil {
+		msoWidth = int(math.Round(v * float64(width) / 100))
+	}
+	return fmt.Sprintf(`<p style="border-top:%s;font-size:1px;margin:%s;width:%s;"></p>`+"\n"+
+		`<!--[if mso | IE]><table align="%s" border="0" cellpadding="0" cellspacing="0" style="border-top:%s;font-size:1px;margin:%s;width:%dpx;" role="presentation" width="%dpx"><tr><td style="height:0;line-height:0;">&nbsp;</td></tr></table><![endif]-->`,
+		border, margin, dividerWidth, r.attr(n, "align"), border, margin, msoWidth, msoWidth)
+}
+
+type network struct {
+	color string
+	icon  string
+}
+
+const socialIcons = "https://www.mailjet.com/images/theme/v1/icons/ico-social/"
+
+var networks = map[string]network{
+	"facebook":   {"#3b5998", "facebook"},
+	"twitter":    {"#55acee", "twitter"},
+	"x":          {"#000000", "twitter-x"},
+	"linkedin":   {"#0077b5", "linkedin"},
+	"instagram":  {"#3f729b", "instagram"},
+	"youtube":    {"#EB3323", "youtube"},
+	"pinterest":  {"#bd081c", "pinterest"},
+	"github":     {"#000000", "github"},
+	"snapchat":   {"#FFFA54", "snapchat"},
+	"tumblr":     {"#344356", "tumblr"},
+	"vimeo":      {"#53B4E7", "vimeo"},
+	"medium":     {"#000000", "medium"},
+	"soundcloud": {"#EF7F31", "soundcloud"},
+	"dribbble":   {"#D95988", "dribbble"},
+	"xing":       {"#296366", "xing"},
+	"web":        {"#4BADE9", "web"},
+}
+
+func (r *renderer) social(n *node) string {
+	var elements []*node
+	for _, c := range n.children {
+		if c.tag == "mj-social-element" {
+			elements = append(elements, c)
+		}
+	}
+	align := r.attr(n, "align")
+	vertical := r.attr(n, "mode") == "vertical"
+
+	var b strings.Builder
+	if vertical {
+		b.WriteString(`<table border="0" cellpadding="0" cellspacing="0" role="presentation" style="margin:0px;"><tbody>`)
+		for _, e := range elements {
+			b.WriteString(r.socialElement(n, e))
+		}
+		b.WriteString("</tbody></table>")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, `<!--[if mso | IE]><table align="%s" border="0" cellpadding="0" cellspacing="0" role="presentation"><tr><![endif]-->`, align)
+	for _, e := range elements {
+		fmt.Fprintf(&b, "\n"+`<!--[if mso | IE]><td><![endif]--><table align="%s" border="0" cellpadding="0" cellspacing="0" role="presentation" style="float:none;display:inline-table;"><tbody>%s</tbody></table><!--[if mso | IE]></td><![endif]-->`,
+			align, r.socialElement(n, e))
+	}
+	b.WriteString("\n" + `<!--[if mso | IE]></tr></table><![endif]-->`)
+	return b.String()
+}
+
+// socialElement renders one network icon, with its label when the element
+// has content. Unset attributes are inherited from the parent mj-social.
+func (r *renderer) socialElement(parent, e *node) string {
+	get := func(name string) string {
+		if v := r.attr(e, name); v != "" {
+			return v
+		}
+		return r.attr(parent, name)
+	}
+	name := strings.TrimSuffix(strings.ToLower(e.attrs["name"]), "-noshare")
+	net := networks[name]
+
+	bg := r.attr(e, "background-color")
+	if bg == "" {
+		bg = net.color
+	}
+	src := r.attr(e, "src")
+	if src == "" && net.icon != "" {
+		src = socialIcons + net.icon + ".png"
+	}
+	size := get("icon-size")
+	height := get("icon-height")
+	if height == "" {
+		height = size
+	}
+	radius := get("border-radius")
+	href := r.attr(e, "href")
+
+	img := fmt.Sprintf(`<img alt="%s" height="%d" src="%s"%s style="border-radius:%s;display:block;" width="%d">`,
+		esc(r.attr(e, "alt")), pxValue(height), esc(src), optAttr("title", r.attr(e, "title")), radius, pxValue(size))
+	if href != "" {
+		img = fmt.Sprintf(`<a href="%s" target="%s"%s>%s</a>`, esc(href), esc(r.attr(e, "target")), optAttr("rel", r.attr(e, "rel")), img)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<tr><td style="%svertical-align:%s;"><table border="0" cellpadding="0" cellspacing="0" role="presentation" style="%sborder-radius:%s;width:%s;"><tbody><tr><td style="%sfont-size:0;height:%s;vertical-align:middle;width:%s;">%s</td></tr></tbody></table></td>`,
+		style("padding", get("inner-padding")), r.attr(e, "vertical-align"),
+		style("background", bg), radius, size,
+		style("padding", get("icon-padding")), height, size, img)
+
+	if e.content != "" {
+		label := fmt.Sprintf(`style="%s"`, style(
+			"color", get("color"),
+			"font-size", get("font-size"),
+			"font-weight", get("font-weight"),
+			"font-style", get("font-style"),
+			"font-family", get("font-family"),
+			"line-height", get("line-height"),
+			"text-decoration", get("text-decoration"),
+		))
+		text := fmt.Sprintf(`<span %s>%s</span>`, label, e.content)
+		if href != "" {
+			text = fmt.Sprintf(`<a href="%s" %s target="%s"%s>%s</a>`, esc(href), label, esc(r.attr(e, "target")), optAttr("rel", r.attr(e, "rel")), e.content)
+		}
+		fmt.Fprintf(&b, `<td style="vertical-align:middle;%s">%s</td>`, style("padding", get("text-padding")), text)
+	}
+	b.WriteString("</tr>")
+	return b.String()
+}
+
+// padding returns the top, right, bottom and left padding in pixels.
+// Percentages count as zero.
+func (r *renderer) padding(n *node) [4]int {
+	var p [4]int
+	parts := strings.Fields(r.attr(n, "padding"))
+	vals := make([]int, len(parts))
+	for i, s := range parts {
+		vals[i] = pxValue(s)
+	}
+	switch len(vals) {
+	case 1:
+		p = [4]int{vals[0], vals[0], vals[0], vals[0]}
+	case 2:
+		p = [4]int{vals[0], vals[1], vals[0], vals[1]}
+	case 3:
+		p = [4]int{vals[0], vals[1], vals[2], vals[1]}
+	case 4:
+		p = [4]int{vals[0], vals[1], vals[2], vals[3]}
+	}
+	for i, side := range []string{"top", "right", "bottom", "left"} {
+		if v := r.attr(n, "padding-"+side); v != "" {
+			p[i] = pxValue(v)
+		}
+	}
+	return p
+}
+
+func (r *renderer) paddingCSS(n *node) string {
+	return style(
+		"padding", r.attr(n, "padding"),
+		"padding-top", r.attr(n, "padding-top"),
+		"padding-right", r.attr(n, "padding-right"),
+		"padding-bottom", r.attr(n, "padding-bottom"),
+		"padding-left", r.attr(n, "padding-left"),
+	)
+}
+
+// style builds an inline style from property/value pairs, skipping
+// properties with no value.
+func style(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if v := strings.TrimSpace(pairs[i+1]); v != "" {
+			b.WriteString(pairs[i] + ":" + esc(v) + ";")
+		}
+	}
+	return b.String()
+}
+
+func pxValue(s string) int {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "px")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int(v)
+}
+
+func ifSet(v, then string) string {
+	if v == "" {
+		return ""
+	}
+	return then
+}
+
+func classAttr(class string) string {
+	return optAttr("class", class)
+}
+
+func optAttr(name, value string) string {
+	if value == "" {
+		return ""
+	}
+	return fmt.Sprintf(` %s="%s"`, name, esc(value))
+}
+
+func spaced(s string) string {
+	if s == "" {
+		return ""
+	}
+	return " " + s
+}
+
+var attrEscaper = strings.NewReplacer(`"`, "&quot;", "<", "&lt;", ">", "&gt;")
+
+// esc makes a value safe inside a double-quoted attribute. Ampersands are
+// left alone so entities written in the source survive, and so are merge
+// tags, which may quote their own arguments.
+func esc(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			break
+		}
+		end += start + 2
+		b.WriteString(attrEscaper.Replace(s[:start]))
+		b.WriteString(s[start:end])
+		s = s[end:]
+	}
+	b.WriteString(attrEscaper.Replace(s))
+	return b.String()
+}
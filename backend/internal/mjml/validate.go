@@ -0,0 +1,443 @@
+package mjml
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type attrKind int
+
+const (
+	kindString attrKind = iota
+	kindColor
+	kindPx    // "10px"
+	kindPxPct // "10px" or "50%"
+	kindBox   // one to four px or % values, as in CSS padding
+	kindEnum  // one of values
+)
+
+type attrSpec struct {
+	kind   attrKind
+	def    string
+	values []string
+}
+
+func str(def string) attrSpec   { return attrSpec{kind: kindString, def: def} }
+func color(def string) attrSpec { return attrSpec{kind: kindColor, def: def} }
+func px(def string) attrSpec    { return attrSpec{kind: kindPx, def: def} }
+func pxPct(def string) attrSpec { return attrSpec{kind: kindPxPct, def: def} }
+func box(def string) attrSpec   { return attrSpec{kind: kindBox, def: def} }
+func enum(def string, values ...string) attrSpec {
+	return attrSpec{kind: kindEnum, def: def, values: values}
+}
+
+type component struct {
+	children []string
+	attrs    map[string]attrSpec
+	required []string
+}
+
+const defaultFont = "Ubuntu, Helvetica, Arial, sans-serif"
+
+// with adds the attributes every body component accepts.
+func with(attrs map[string]attrSpec) map[string]attrSpec {
+	attrs["css-class"] = str("")
+	attrs["mj-class"] = str("")
+	return attrs
+}
+
+func paddings(attrs map[string]attrSpec, def string) map[string]attrSpec {
+	attrs["padding"] = box(def)
+	for _, side := range []string{"top", "right", "bottom", "left"} {
+		attrs["padding-"+side] = pxPct("")
+	}
+	return attrs
+}
+
+var columnChildren = []string{"mj-text", "mj-image", "mj-button", "mj-divider", "mj-spacer", "mj-social", "mj-raw"}
+
+var components = map[string]component{
+	"mjml": {
+		children: []string{"mj-head", "mj-body"},
+		attrs:    map[string]attrSpec{"lang": str("und"), "dir": enum("auto", "auto", "ltr", "rtl"), "owa": str("")},
+	},
+	"mj-head": {
+		children: []string{"mj-attributes", "mj-title", "mj-preview", "mj-style", "mj-font", "mj-breakpoint", "mj-raw"},
+		attrs:    map[string]attrSpec{},
+	},
+	"mj-title":   {attrs: map[string]attrSpec{}},
+	"mj-preview": {attrs: map[string]attrSpec{}},
+	"mj-style":   {attrs: map[string]attrSpec{"inline": enum("", "inline")}},
+	"mj-font": {
+		attrs:    map[string]attrSpec{"name": str(""), "href": str("")},
+		required: []string{"name", "href"},
+	},
+	"mj-breakpoint": {
+		attrs:    map[string]attrSpec{"width": px("480px")},
+		required: []string{"width"},
+	},
+	"mj-attributes": {attrs: map[string]attrSpec{}},
+	"mj-body": {
+		children: []string{"mj-section", "mj-raw"},
+		attrs: with(map[string]attrSpec{
+			"width":            px("600px"),
+			"background-color": color(""),
+		}),
+	},
+	"mj-section": {
+		children: []string{"mj-column", "mj-raw"},
+		attrs: with(paddings(map[string]attrSpec{
+			"background-color":    color(""),
+			"background-url":      str(""),
+			"background-repeat":   enum("repeat", "repeat", "no-repeat"),
+			"background-size":     str("auto"),
+			"background-position": str("top center"),
+			"border":              str(""),
+			"border-radius":       str(""),
+			"direction":           enum("ltr", "ltr", "rtl"),
+			"full-width":          enum("", "full-width", "false"),
+			"text-align":          enum("center", "left", "center", "right"),
+		}, "20px 0")),
+	},
+	"mj-column": {
+		children: columnChildren,
+		attrs: with(paddings(map[string]attrSpec{
+			"width":            pxPct(""),
+			"vertical-align":   enum("top", "top", "middle", "bottom"),
+			"background-color": color(""),
+			"border":           str(""),
+			"border-radius":    str(""),
+		}, "")),
+	},
+	"mj-text": {
+		attrs: with(paddings(map[string]attrSpec{
+			"align":                      enum("left", "left", "right", "center", "justify"),
+			"color":                      color("#000000"),
+			"container-background-color": color(""),
+			"font-family":                str(defaultFont),
+			"font-size":                  px("13px"),
+			"font-style":                 str(""),
+			"font-weight":                str(""),
+			"height":                     pxPct(""),
+			"letter-spacing":             str(""),
+			"line-height":                str("1"),
+			"text-decoration":            str(""),
+			"text-transform":             str(""),
+		}, "10px 25px")),
+	},
+	"mj-image": {
+		attrs: with(paddings(map[string]attrSpec{
+			"align":                      enum("center", "left", "right", "center"),
+			"alt":                        str(""),
+			"border":                     str("0"),
+			"border-radius":              str(""),
+			"container-background-color": color(""),
+			"height":                     str("auto"),
+			"href":                       str(""),
+			"rel":                        str(""),
+			"src":                        str(""),
+			"target":                     str("_blank"),
+			"title":                      str(""),
+			"width":                      px(""),
+		}, "10px 25px")),
+		required: []string{"src"},
+	},
+	"mj-button": {
+		attrs: with(paddings(map[string]attrSpec{
+			"align":                      enum("center", "left", "right", "center"),
+			"background-color":           color("#414141"),
+			"border":                     str("none"),
+			"border-radius":              str("3px"),
+			"color":                      color("#ffffff"),
+			"container-background-color": color(""),
+			"font-family":                str(defaultFont),
+			"font-size":                  px("13px"),
+			"font-style":                 str(""),
+			"font-weight":                str("normal"),
+			"height":                     pxPct(""),
+			"href":                       str(""),
+			"inner-padding":              box("10px 25px"),
+			"letter-spacing":             str(""),
+			"line-height":                str("120%"),
+			"rel":                        str(""),
+			"target":                     str("_blank"),
+			"text-align":                 enum("", "left", "right", "center"),
+			"text-decoration":            str("none"),
+			"text-transform":             str("none"),
+			"title":                      str(""),
+			"vertical-align":             enum("middle", "top", "middle", "bottom"),
+			"width":                      pxPct(""),
+		}, "10px 25px")),
+	},
+	"mj-divider": {
+		attrs: with(paddings(map[string]attrSpec{
+			"align":                      enum("center", "left", "right", "center"),
+			"border-color":               color("#000000"),
+			"border-style":               enum("solid", "solid", "dashed", "dotted"),
+			"border-width":               px("4px"),
+			"container-background-color": color(""),
+			"width":                      pxPct("100%"),
+		}, "10px 25px")),
+	},
+	"mj-spacer": {
+		attrs: with(paddings(map[string]attrSpec{
+			"container-background-color": color(""),
+			"height":                     px("20px"),
+		}, "")),
+	},
+	"mj-social": {
+		children: []string{"mj-social-element", "mj-raw"},
+		attrs: with(paddings(map[string]attrSpec{
+			"align":                      enum("center", "left", "right", "center"),
+			"border-radius":              str("3px"),
+			"color":                      color("#333333"),
+			"container-background-color": color(""),
+			"font-family":                str(defaultFont),
+			"font-size":                  px("13px"),
+			"font-style":                 str(""),
+			"font-weight":                str(""),
+			"icon-size":                  pxPct("20px"),
+			"icon-height":                pxPct(""),
+			"icon-padding":               box(""),
+			"inner-padding":              box("4px"),
+			"line-height":                str("22px"),
+			"mode":                       enum("horizontal", "horizontal", "vertical"),
+			"text-decoration":            str("none"),
+			"text-padding":               box("4px 4px 4px 0"),
+		}, "10px 25px")),
+	},
+	"mj-social-element": {
+		attrs: with(map[string]attrSpec{
+			"align":            enum("left", "left", "right", "center"),
+			"alt":              str(""),
+			"background-color": color(""),
+			"border-radius":    str(""),
+			"color":            color(""),
+			"font-family":      str(""),
+			"font-size":        px(""),
+			"font-style":       str(""),
+			"font-weight":      str(""),
+			"href":             str(""),
+			"icon-size":        pxPct(""),
+			"icon-height":      pxPct(""),
+			"icon-padding":     box(""),
+			"line-height":      str(""),
+			"name":             str(""),
+			"padding":          box(""),
+			"rel":              str(""),
+			"src":              str(""),
+			"target":           str("_blank"),
+			"text-decoration":  str(""),
+			"text-padding":     box(""),
+			"title":            str(""),
+			"vertical-align":   enum("middle", "top", "middle", "bottom"),
+		}),
+	},
+	"mj-raw": {attrs: map[string]attrSpec{"position": enum("", "file-start")}},
+}
+
+var (
+	colorRe = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{4}|#[0-9a-fA-F]{6}|#[0-9a-fA-F]{8}|rgba?\([0-9.,%\s]+\)|[a-zA-Z]+)$`)
+	pxRe    = regexp.MustCompile(`^\d+(\.\d+)?px$|^0$`)
+	pxPctRe = regexp.MustCompile(`^\d+(\.\d+)?(px|%)$|^0$`)
+)
+
+func (s attrSpec) check(v string) string {
+	// Merge tags are filled in at send time and cannot be checked here.
+	if strings.Contains(v, "{{") {
+		return ""
+	}
+	v = strings.TrimSpace(v)
+	switch s.kind {
+	case kindColor:
+		if !colorRe.MatchString(v) {
+			return "a color such as #ff6600"
+		}
+	case kindPx:
+		if !pxRe.MatchString(v) {
+			return "a pixel value such as 10px"
+		}
+	case kindPxPct:
+		if !pxPctRe.MatchString(v) {
+			return "a pixel or percent value such as 10px or 50%"
+		}
+	case kindBox:
+		parts := strings.Fields(v)
+		if len(parts) < 1 || len(parts) > 4 {
+			return "one to four pixel or percent values such as 10px 25px"
+		}
+		for _, p := range parts {
+			if !pxPctRe.MatchString(p) {
+				return "one to four pixel or percent values such as 10px 25px"
+			}
+		}
+	case kindEnum:
+		for _, allowed := range s.values {
+			if v == allowed {
+				return ""
+			}
+		}
+		return "one of " + strings.Join(s.values, ", ")
+	}
+	return ""
+}
+
+// validate checks the tree against the component rules and returns every
+// problem found.
+func validate(doc *node) Errors {
+	var errs Errors
+	add := func(at pos, tag, format string, args ...interface{}) {
+		errs = append(errs, Error{Line: at.line, Column: at.col, Tag: tag, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(doc.children) == 0 {
+		add(pos{1, 1}, "", "document is empty; it must start with <mjml>")
+		return errs
+	}
+	for i, root := range doc.children {
+		if root.tag != "mjml" || i > 0 {
+			add(root.pos, root.tag, "the document must have a single <mjml> root element, found <%s>", root.tag)
+		}
+	}
+	root := doc.children[0]
+	if root.tag == "mjml" {
+		bodies := 0
+		for _, c := range root.children {
+			if c.tag == "mj-body" {
+				bodies++
+				if bodies > 1 {
+					add(c.pos, c.tag, "<mjml> may only contain one <mj-body>")
+				}
+			}
+		}
+		if bodies == 0 {
+			add(root.pos, root.tag, "<mjml> must contain an <mj-body>")
+		}
+	}
+
+	var walk func(n *node)
+	walk = func(n *node) {
+		spec, ok := components[n.tag]
+		if !ok {
+			return
+		}
+		if n.tag == "mj-attributes" {
+			validateAttributes(n, add)
+		} else {
+			checkAttrs(n, spec.attrs, add)
+		}
+		for _, name := range spec.required {
+			if strings.TrimSpace(n.attrs[name]) == "" {
+				add(n.pos, n.tag, "<%s> requires the %s attribute", n.tag, name)
+			}
+		}
+		if n.tag == "mj-attributes" {
+			return
+		}
+		for _, c := range n.children {
+			if _, known := components[c.tag]; !known {
+				add(c.pos, c.tag, "unknown tag <%s>", c.tag)
+				continue
+			}
+			if !contains(spec.children, c.tag) {
+				if len(spec.children) == 0 {
+					add(c.pos, c.tag, "<%s> cannot contain other tags", n.tag)
+				} else {
+					add(c.pos, c.tag, "<%s> cannot be used inside <%s>, which only accepts %s", c.tag, n.tag, tagList(spec.children))
+				}
+				continue
+			}
+			walk(c)
+		}
+	}
+	walk(root)
+
+	errs.sort()
+	return errs
+}
+
+func checkAttrs(n *node, allowed map[string]attrSpec, add func(pos, string, string, ...interface{})) {
+	for _, name := range sortedKeys(n.attrs) {
+		spec, ok := allowed[name]
+		if !ok {
+			add(n.attrPos[name], n.tag, "attribute %s is not allowed on <%s>", name, n.tag)
+			continue
+		}
+		if want := spec.check(n.attrs[name]); want != "" {
+			add(n.attrPos[name], n.tag, "attribute %s on <%s> must be %s, got %q", name, n.tag, want, n.attrs[name])
+		}
+	}
+}
+
+// validateAttributes checks an <mj-attributes> block. Its children set
+// defaults: mj-all for every component, mj-class for a named class, and
+// any component tag for that component.
+func validateAttributes(n *node, add func(pos, string, string, ...interface{})) {
+	checkAttrs(n, components["mj-attributes"].attrs, add)
+	for _, c := range n.children {
+		switch c.tag {
+		case "mj-all":
+			for _, name := range sortedKeys(c.attrs) {
+				if !anyComponentAccepts(name) {
+					add(c.attrPos[name], c.tag, "attribute %s is not used by any component", name)
+				}
+			}
+		case "mj-class":
+			if strings.TrimSpace(c.attrs["name"]) == "" {
+				add(c.pos, c.tag, "<mj-class> requires the name attribute")
+			}
+			for _, name := range sortedKeys(c.attrs) {
+				if name != "name" && !anyComponentAccepts(name) {
+					add(c.attrPos[name], c.tag, "attribute %s is not used by any component", name)
+				}
+			}
+		default:
+			spec, ok := components[c.tag]
+			if !ok || c.tag == "mjml" || c.tag == "mj-attributes" {
+				add(c.pos, c.tag, "unknown tag <%s> in <mj-attributes>", c.tag)
+				continue
+			}
+			checkAttrs(c, spec.attrs, add)
+		}
+		if len(c.children) > 0 || c.content != "" {
+			add(c.pos, c.tag, "<%s> in <mj-attributes> cannot have content", c.tag)
+		}
+	}
+}
+
+func anyComponentAccepts(name string) bool {
+	for _, c := range components {
+		if _, ok := c.attrs[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func tagList(tags []string) string {
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = "<" + t + ">"
+	}
+	return strings.Join(out, ", ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,144 @@
+package render
+
+import (
+	"encoding/xml"
+	"html/template"
+	"io"
+	"time"
+)
+
+// ArchiveEntry is one campaign listed in a public archive.
+type ArchiveEntry struct {
+	Title  string
+	URL    string
+	SentAt time.Time
+}
+
+// ArchivePage is a user's public archive: its index page URL, its feeds
+// and the campaigns in it, newest first.
+type ArchivePage struct {
+	Title   string
+	URL     string
+	RSSURL  string
+	AtomURL string
+	Entries []ArchiveEntry
+}
+
+var archiveIndex = template.Must(template.New("archive").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<link rel="alternate" type="application/rss+xml" title="{{.Title}}" href="{{.RSSURL}}">
+<link rel="alternate" type="application/atom+xml" title="{{.Title}}" href="{{.AtomURL}}">
+<style>
+body{font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;max-width:640px;margin:40px auto;padding:0 16px;color:#222}
+ul{list-style:none;padding:0}li{padding:10px 0;border-bottom:1px solid #eee}
+time{color:#777;font-size:14px;display:block}a{color:#0b63ce}
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Entries}}<ul>
+{{range .Entries}}<li><a href="{{.URL}}">{{.Title}}</a><time datetime="{{.SentAt.Format "2006-01-02"}}">{{.SentAt.Format "January 2, 2006"}}</time></li>
+{{end}}</ul>
+{{else}}<p>No campaigns have been published yet.</p>
+{{end}}<p><a href="{{.RSSURL}}">RSS</a> &middot; <a href="{{.AtomURL}}">Atom</a></p>
+</body>
+</html>
+`))
+
+func WriteArchiveIndex(w io.Writer, page *ArchivePage) error {
+	return archiveIndex.Execute(w, page)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+}
+
+func WriteArchiveRSS(w io.Writer, page *ArchivePage) error {
+	feed := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:       page.Title,
+		Link:        page.URL,
+		Description: page.Title,
+	}}
+	for _, e := range page.Entries {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:   e.Title,
+			Link:    e.URL,
+			GUID:    e.URL,
+			PubDate: e.SentAt.UTC().Format(time.RFC1123Z),
+		})
+	}
+	return writeXML(w, feed)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+}
+
+func WriteArchiveAtom(w io.Writer, page *ArchivePage) error {
+	feed := atomFeed{
+		Title: page.Title,
+		ID:    page.URL,
+		Links: []atomLink{{Href: page.URL}, {Href: page.AtomURL, Rel: "self"}},
+	}
+	// A feed must have an updated time even when it has no entries yet.
+	updated := time.Unix(0, 0)
+	for _, e := range page.Entries {
+		if e.SentAt.After(updated) {
+			updated = e.SentAt
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   e.Title,
+			ID:      e.URL,
+			Updated: e.SentAt.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: e.URL},
+		})
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+	return writeXML(w, feed)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(v)
+}
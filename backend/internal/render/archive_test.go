@@ -0,0 +1,68 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testArchive() *ArchivePage {
+	base := "https://api.acme.test/api/v1/public/archive/acme"
+	return &ArchivePage{
+		Title:   "Acme <News>",
+		URL:     base,
+		RSSURL:  base + "/rss",
+		AtomURL: base + "/atom",
+		Entries: []ArchiveEntry{
+			{Title: "May & June", URL: base + "/campaigns/2", SentAt: time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)},
+			{Title: "April", URL: base + "/campaigns/1", SentAt: time.Date(2025, 4, 3, 9, 0, 0, 0, time.UTC)},
+		},
+	}
+}
+
+func TestWriteArchiveIndex(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteArchiveIndex(&buf, testArchive()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<title>Acme &lt;News&gt;</title>",
+		`<a href="https://api.acme.test/api/v1/public/archive/acme/campaigns/2">May &amp; June</a>`,
+		`<time datetime="2025-04-03">April 3, 2025</time>`,
+		`type="application/atom+xml"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("index missing %q", want)
+		}
+	}
+}
+
+func TestWriteArchiveFeeds(t *testing.T) {
+	var rss bytes.Buffer
+	if err := WriteArchiveRSS(&rss, testArchive()); err != nil {
+		t.Fatal(err)
+	}
+	var gotRSS rssFeed
+	if err := xml.Unmarshal(rss.Bytes(), &gotRSS); err != nil {
+		t.Fatalf("RSS is not well-formed: %v", err)
+	}
+	if len(gotRSS.Channel.Items) != 2 || gotRSS.Channel.Items[0].Title != "May & June" ||
+		gotRSS.Channel.Items[0].PubDate != "Sun, 01 Jun 2025 09:00:00 +0000" {
+		t.Errorf("unexpected RSS items: %+v", gotRSS.Channel.Items)
+	}
+
+	var atom bytes.Buffer
+	if err := WriteArchiveAtom(&atom, testArchive()); err != nil {
+		t.Fatal(err)
+	}
+	var gotAtom atomFeed
+	if err := xml.Unmarshal(atom.Bytes(), &gotAtom); err != nil {
+		t.Fatalf("Atom is not well-formed: %v", err)
+	}
+	if gotAtom.Updated != "2025-06-01T09:00:00Z" || len(gotAtom.Entries) != 2 {
+		t.Errorf("unexpected Atom feed: updated %s, %d entries", gotAtom.Updated, len(gotAtom.Entries))
+	}
+}
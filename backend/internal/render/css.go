@@ -0,0 +1,416 @@
+package render
+
+import (
+	"strconv"
+	"strings"
+)
+
+// cssItem is one top-level entry of a stylesheet: a style rule, or an
+// at-rule such as @media kept verbatim.
+type cssItem struct {
+	rule *cssRule
+	raw  string
+}
+
+type cssRule struct {
+	selectors []string
+	decls     []cssDecl
+}
+
+type cssDecl struct {
+	prop      string
+	value     string
+	important bool
+}
+
+func (d cssDecl) String() string {
+	if d.important {
+		return d.prop + ": " + d.value + " !important"
+	}
+	return d.prop + ": " + d.value
+}
+
+// parseStylesheet splits css into rules and at-rules. Anything it cannot
+// make sense of is skipped, as browsers do.
+func parseStylesheet(css string) []cssItem {
+	css = stripComments(css)
+	var items []cssItem
+	for i := 0; i < len(css); {
+		c := css[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '}' || c == ';':
+			i++
+			continue
+		case strings.HasPrefix(css[i:], "<!--"):
+			i += 4
+			continue
+		case strings.HasPrefix(css[i:], "-->"):
+			i += 3
+			continue
+		}
+
+		end := scanUntil(css, i, "{;")
+		if c == '@' && (end == len(css) || css[end] == ';') {
+			items = append(items, cssItem{raw: strings.TrimSpace(css[i:min(end+1, len(css))])})
+			i = end + 1
+			continue
+		}
+		if end == len(css) {
+			break
+		}
+		if css[end] == ';' {
+			// A declaration outside any rule.
+			i = end + 1
+			continue
+		}
+		close := matchingBrace(css, end)
+		if c == '@' {
+			items = append(items, cssItem{raw: strings.TrimSpace(css[i:min(close+1, len(css))])})
+		} else {
+			prelude := strings.TrimSpace(css[i:end])
+			body := css[end+1 : min(close, len(css))]
+			if prelude != "" {
+				items = append(items, cssItem{rule: &cssRule{
+					selectors: splitTopLevel(prelude, ','),
+					decls:     parseDeclarations(body),
+				}})
+			}
+		}
+		i = close + 1
+	}
+	return items
+}
+
+// parseDeclarations parses the body of a rule or a style attribute.
+func parseDeclarations(body string) []cssDecl {
+	var decls []cssDecl
+	for _, part := range splitTopLevel(body, ';') {
+		colon := strings.IndexByte(part, ':')
+		if colon <= 0 {
+			continue
+		}
+		d := cssDecl{
+			prop:  strings.ToLower(strings.TrimSpace(part[:colon])),
+			value: strings.TrimSpace(part[colon+1:]),
+		}
+		if bang := strings.LastIndexByte(d.value, '!'); bang >= 0 &&
+			strings.EqualFold(strings.TrimSpace(d.value[bang+1:]), "important") {
+			d.important = true
+			d.value = strings.TrimSpace(d.value[:bang])
+		}
+		if d.prop != "" && d.value != "" {
+			decls = append(decls, d)
+		}
+	}
+	return decls
+}
+
+func stripComments(css string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			b.WriteString(css)
+			return b.String()
+		}
+		b.WriteString(css[:start])
+		end := strings.Index(css[start+2:], "*/")
+		if end < 0 {
+			return b.String()
+		}
+		css = css[start+2+end+2:]
+	}
+}
+
+// scanUntil returns the index of the first of stops outside quotes and
+// brackets, or len(s).
+func scanUntil(s string, i int, stops string) int {
+	depth := 0
+	var quote byte
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && strings.IndexByte(stops, c) >= 0:
+			return i
+		}
+	}
+	return i
+}
+
+// matchingBrace returns the index of the brace closing the one at open,
+// or len(s) when the block runs to the end.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		i = scanUntil(s, i, "{}")
+		if i == len(s) {
+			break
+		}
+		if s[i] == '{' {
+			depth++
+		} else if depth--; depth == 0 {
+			return i
+		}
+	}
+	return len(s)
+}
+
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	for i := 0; i <= len(s); {
+		end := scanUntil(s, i, string(sep))
+		if part := strings.TrimSpace(s[i:end]); part != "" {
+			parts = append(parts, part)
+		}
+		i = end + 1
+	}
+	return parts
+}
+
+// selector is a complex selector such as "table.main > td a", stored as
+// its compound selectors from left to right with the combinator before
+// each one after the first.
+type selector struct {
+	parts       []compound
+	combinators []byte
+	specificity [3]int
+}
+
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+	pseudos []pseudoSelector
+}
+
+type attrSelector struct {
+	name, op, value string
+}
+
+// pseudoSelector is a structural pseudo-class; nth holds a and b of an
+// an+b expression.
+type pseudoSelector struct {
+	name string
+	nth  [2]int
+}
+
+// parseSelector parses a selector that can be inlined. It reports false
+// for selectors that depend on state or generate content, such as :hover
+// or ::before, and for anything it does not understand.
+func parseSelector(s string) (*selector, bool) {
+	sel := &selector{}
+	cur := compound{}
+	empty := true
+	pending := byte(0)
+
+	flush := func() {
+		if !empty {
+			if len(sel.parts) > 0 {
+				if pending == 0 {
+					pending = ' '
+				}
+				sel.combinators = append(sel.combinators, pending)
+			}
+			sel.parts = append(sel.parts, cur)
+			cur, empty, pending = compound{}, true, 0
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+			i++
+		case c == '>' || c == '+' || c == '~':
+			flush()
+			if len(sel.parts) == 0 || pending != 0 {
+				return nil, false
+			}
+			pending = c
+			i++
+		case c == '*':
+			empty = false
+			i++
+		case c == '#' || c == '.':
+			name, n := cssIdent(s[i+1:])
+			if name == "" {
+				return nil, false
+			}
+			if c == '#' {
+				cur.id = name
+				sel.specificity[0]++
+			} else {
+				cur.classes = append(cur.classes, name)
+				sel.specificity[1]++
+			}
+			empty = false
+			i += 1 + n
+		case c == '[':
+			end := scanUntil(s, i+1, "]")
+			if end == len(s) {
+				return nil, false
+			}
+			attr, ok := parseAttrSelector(s[i+1 : end])
+			if !ok {
+				return nil, false
+			}
+			cur.attrs = append(cur.attrs, attr)
+			sel.specificity[1]++
+			empty = false
+			i = end + 1
+		case c == ':':
+			if strings.HasPrefix(s[i:], "::") {
+				return nil, false
+			}
+			name, n := cssIdent(s[i+1:])
+			i += 1 + n
+			p := pseudoSelector{name: strings.ToLower(name)}
+			if i < len(s) && s[i] == '(' {
+				end := scanUntil(s, i+1, ")")
+				if end == len(s) {
+					return nil, false
+				}
+				a, b, ok := parseNth(s[i+1 : end])
+				if !ok {
+					return nil, false
+				}
+				p.nth = [2]int{a, b}
+				i = end + 1
+			}
+			switch p.name {
+			case "first-child":
+				p = pseudoSelector{name: "nth-child", nth: [2]int{0, 1}}
+			case "last-child":
+				p = pseudoSelector{name: "nth-last-child", nth: [2]int{0, 1}}
+			case "first-of-type":
+				p = pseudoSelector{name: "nth-of-type", nth: [2]int{0, 1}}
+			case "last-of-type":
+				p = pseudoSelector{name: "nth-last-of-type", nth: [2]int{0, 1}}
+			case "only-child", "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+			default:
+				return nil, false
+			}
+			cur.pseudos = append(cur.pseudos, p)
+			sel.specificity[1]++
+			empty = false
+		default:
+			name, n := cssIdent(s[i:])
+			if name == "" || !empty {
+				return nil, false
+			}
+			cur.tag = strings.ToLower(name)
+			sel.specificity[2]++
+			empty = false
+			i += n
+		}
+	}
+	if empty && pending != 0 {
+		return nil, false
+	}
+	flush()
+	if len(sel.parts) == 0 {
+		return nil, false
+	}
+	return sel, true
+}
+
+func cssIdent(s string) (string, int) {
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		if c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 {
+			n++
+			continue
+		}
+		if c == '\\' && n+1 < len(s) {
+			n += 2
+			continue
+		}
+		break
+	}
+	return strings.ReplaceAll(s[:n], "\\", ""), n
+}
+
+func parseAttrSelector(s string) (attrSelector, bool) {
+	s = strings.TrimSpace(s)
+	name, n := cssIdent(s)
+	if name == "" {
+		return attrSelector{}, false
+	}
+	a := attrSelector{name: strings.ToLower(name)}
+	rest := strings.TrimSpace(s[n:])
+	if rest == "" {
+		return a, true
+	}
+	for _, op := range []string{"~=", "|=", "^=", "$=", "*=", "="} {
+		if strings.HasPrefix(rest, op) {
+			a.op = op
+			rest = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+	if a.op == "" {
+		return attrSelector{}, false
+	}
+	if len(rest) > 0 && (rest[0] == '"' || rest[0] == '\'') {
+		end := strings.IndexByte(rest[1:], rest[0])
+		if end < 0 {
+			return attrSelector{}, false
+		}
+		a.value = rest[1 : end+1]
+	} else {
+		a.value, _ = cssIdent(rest)
+	}
+	return a, true
+}
+
+// parseNth parses the an+b argument of :nth-child and friends.
+func parseNth(s string) (int, int, bool) {
+	s = strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	switch s {
+	case "odd":
+		return 2, 1, true
+	case "even":
+		return 2, 0, true
+	}
+	n := strings.IndexByte(s, 'n')
+	if n < 0 {
+		b, err := strconv.Atoi(s)
+		return 0, b, err == nil
+	}
+	a := 1
+	switch s[:n] {
+	case "", "+":
+	case "-":
+		a = -1
+	default:
+		var err error
+		if a, err = strconv.Atoi(s[:n]); err != nil {
+			return 0, 0, false
+		}
+	}
+	b := 0
+	if rest := s[n+1:]; rest != "" {
+		var err error
+		if b, err = strconv.Atoi(strings.TrimPrefix(rest, "+")); err != nil {
+			return 0, 0, false
+		}
+	}
+	return a, b, true
+}
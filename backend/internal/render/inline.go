@@ -0,0 +1,468 @@
+package render
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// NoInlineAttr keeps a <style> block out of inlining:
+//
+//	<style data-noinline>...</style>
+//
+// Blocks whose media attribute targets anything but screen are left alone
+// as well.
+const NoInlineAttr = "data-noinline"
+
+// InlineCSS moves the rules of the document's <style> blocks into style
+// attributes, since many email clients drop <style> altogether. Each
+// element gets the winning declaration of every property by the usual
+// cascade: !important first, then inline styles, specificity and source
+// order. Rules that cannot be inlined, such as media queries, @font-face
+// and :hover, stay in their block; blocks left empty are removed. Tags that
+// get no styles are copied through byte for byte.
+func InlineCSS(body string) (string, error) {
+	doc, err := tokenizeDocument(body)
+	if err != nil {
+		return "", err
+	}
+
+	var rules []inlineRule
+	for _, block := range doc.styles {
+		var kept []string
+		for _, item := range parseStylesheet(block.css) {
+			if item.rule == nil {
+				kept = append(kept, item.raw)
+				continue
+			}
+			var keep []string
+			for _, s := range item.rule.selectors {
+				sel, ok := parseSelector(s)
+				if !ok {
+					keep = append(keep, s)
+					continue
+				}
+				rules = append(rules, inlineRule{sel: sel, decls: item.rule.decls, order: len(rules)})
+			}
+			if len(keep) > 0 {
+				kept = append(kept, strings.Join(keep, ", ")+" { "+joinDecls(item.rule.decls)+" }")
+			}
+		}
+		block.css = strings.Join(kept, "\n")
+	}
+	if len(rules) == 0 {
+		return body, nil
+	}
+
+	for _, el := range doc.elements {
+		if el.rendered() {
+			el.applyRules(rules)
+		}
+	}
+	return doc.render(), nil
+}
+
+type inlineRule struct {
+	sel   *selector
+	decls []cssDecl
+	order int
+}
+
+// cascaded is a declaration competing for an element's property.
+type cascaded struct {
+	decl        cssDecl
+	inline      bool
+	specificity [3]int
+	order       int
+}
+
+func (a cascaded) beats(b cascaded) bool {
+	if a.decl.important != b.decl.important {
+		return a.decl.important
+	}
+	if a.inline != b.inline {
+		return a.inline
+	}
+	if a.specificity != b.specificity {
+		for i := range a.specificity {
+			if a.specificity[i] != b.specificity[i] {
+				return a.specificity[i] > b.specificity[i]
+			}
+		}
+	}
+	return a.order > b.order
+}
+
+func (el *element) applyRules(rules []inlineRule) {
+	var winners map[string]cascaded
+	var props []string
+	put := func(c cascaded) {
+		cur, ok := winners[c.decl.prop]
+		if !ok {
+			props = append(props, c.decl.prop)
+		}
+		if !ok || c.beats(cur) {
+			winners[c.decl.prop] = c
+		}
+	}
+	for _, r := range rules {
+		if !r.sel.match(el) {
+			continue
+		}
+		if winners == nil {
+			winners = map[string]cascaded{}
+		}
+		for _, d := range r.decls {
+			put(cascaded{decl: d, specificity: r.sel.specificity, order: r.order})
+		}
+	}
+	if winners == nil {
+		return
+	}
+	for i, d := range parseDeclarations(el.attr("style")) {
+		put(cascaded{decl: d, inline: true, order: i})
+	}
+
+	// Declarations are written weakest first, so a shorthand never
+	// overrides a longhand that beat it.
+	list := make([]cascaded, len(props))
+	for i, prop := range props {
+		list[i] = winners[prop]
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[j].beats(list[i]) })
+	decls := make([]cssDecl, len(list))
+	for i, c := range list {
+		decls[i] = c.decl
+		decls[i].value = strings.ReplaceAll(c.decl.value, `"`, "'")
+	}
+	el.style = joinDecls(decls) + ";"
+}
+
+func joinDecls(decls []cssDecl) string {
+	parts := make([]string, len(decls))
+	for i, d := range decls {
+		parts[i] = d.String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// element is a tag in the document tree rebuilt from the token stream.
+// Unlike a full HTML parse, nothing is added or moved, so every element
+// maps back to the exact start tag it came from.
+type element struct {
+	tag      string
+	attrs    []html.Attribute
+	parent   *element
+	children []*element
+	index    int
+	style    string
+}
+
+// rendered reports whether el is displayed, and so can take styles.
+func (el *element) rendered() bool {
+	for e := el; e != nil; e = e.parent {
+		switch e.tag {
+		case "head", "style", "script", "meta", "title", "link", "base", "noscript", "template":
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (el *element) attr(key string) string {
+	for _, a := range el.attrs {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func (el *element) hasAttr(key string) bool {
+	for _, a := range el.attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+type docToken struct {
+	tt    html.TokenType
+	raw   []byte
+	tok   html.Token
+	el    *element
+	style *styleBlock
+}
+
+type styleBlock struct {
+	css string
+}
+
+type tokenDoc struct {
+	tokens   []docToken
+	elements []*element
+	styles   []*styleBlock
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// impliedEnds lists, for tags whose end tag is often left out, the open
+// tags a new start tag closes first.
+var impliedEnds = map[string][]string{
+	"li": {"li"},
+	"td": {"td", "th"},
+	"th": {"td", "th"},
+	"tr": {"tr", "td", "th"},
+	"p":  {"p"},
+}
+
+func tokenizeDocument(body string) (*tokenDoc, error) {
+	doc := &tokenDoc{}
+	root := &element{}
+	stack := []*element{root}
+	var openStyle *styleBlock
+
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return doc, nil
+			}
+			return nil, z.Err()
+		}
+		raw := append([]byte(nil), z.Raw()...)
+		t := docToken{tt: tt, raw: raw}
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t.tok = z.Token()
+			name := t.tok.Data
+			for len(stack) > 1 && contains(impliedEnds[name], stack[len(stack)-1].tag) {
+				stack = stack[:len(stack)-1]
+			}
+			parent := stack[len(stack)-1]
+			el := &element{tag: name, attrs: t.tok.Attr, parent: parent, index: len(parent.children)}
+			parent.children = append(parent.children, el)
+			t.el = el
+			doc.elements = append(doc.elements, el)
+			if tt == html.StartTagToken && !voidElements[name] {
+				stack = append(stack, el)
+			}
+			if name == "style" && tt == html.StartTagToken && inlinableStyle(el) {
+				openStyle = &styleBlock{}
+				doc.styles = append(doc.styles, openStyle)
+				t.style = openStyle
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].tag == string(name) {
+					stack = stack[:i]
+					break
+				}
+			}
+			if openStyle != nil && string(name) == "style" {
+				t.style = openStyle
+				openStyle = nil
+			}
+		case html.TextToken:
+			if openStyle != nil {
+				openStyle.css += string(raw)
+				t.style = openStyle
+			}
+		}
+		doc.tokens = append(doc.tokens, t)
+	}
+}
+
+func inlinableStyle(el *element) bool {
+	if el.hasAttr(NoInlineAttr) {
+		return false
+	}
+	media := strings.ToLower(strings.TrimSpace(el.attr("media")))
+	return media == "" || media == "all" || media == "screen"
+}
+
+// render writes the document back with the computed styles, and with each
+// inlined <style> block reduced to what was left in it.
+func (doc *tokenDoc) render() string {
+	var out bytes.Buffer
+	for _, t := range doc.tokens {
+		switch {
+		case t.style != nil:
+			if t.style.css == "" {
+				continue
+			}
+			switch t.tt {
+			case html.TextToken:
+				// The remaining rules are written before the end tag.
+			case html.EndTagToken:
+				out.WriteString("\n" + t.style.css + "\n")
+				out.Write(t.raw)
+			default:
+				out.Write(t.raw)
+			}
+		case t.el != nil && t.el.style != "":
+			tok := t.tok
+			tok.Attr = append([]html.Attribute(nil), tok.Attr...)
+			found := false
+			for i := range tok.Attr {
+				if tok.Attr[i].Key == "style" {
+					tok.Attr[i].Val = t.el.style
+					found = true
+				}
+			}
+			if !found {
+				tok.Attr = append(tok.Attr, html.Attribute{Key: "style", Val: t.el.style})
+			}
+			out.WriteString(tok.String())
+		default:
+			out.Write(t.raw)
+		}
+	}
+	return out.String()
+}
+
+// match reports whether the selector matches el, working from the
+// rightmost compound selector outwards.
+func (s *selector) match(el *element) bool {
+	return s.matchAt(len(s.parts)-1, el)
+}
+
+func (s *selector) matchAt(i int, el *element) bool {
+	if el == nil || el.tag == "" || !s.parts[i].match(el) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch s.combinators[i-1] {
+	case '>':
+		return s.matchAt(i-1, el.parent)
+	case '+':
+		return el.index > 0 && s.matchAt(i-1, el.parent.children[el.index-1])
+	case '~':
+		for j := el.index - 1; j >= 0; j-- {
+			if s.matchAt(i-1, el.parent.children[j]) {
+				return true
+			}
+		}
+		return false
+	default:
+		for p := el.parent; p != nil && p.tag != ""; p = p.parent {
+			if s.matchAt(i-1, p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c *compound) match(el *element) bool {
+	if c.tag != "" && c.tag != el.tag {
+		return false
+	}
+	if c.id != "" && el.attr("id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(el.attr("class"))
+		for _, want := range c.classes {
+			found := false
+			for _, class := range classes {
+				if class == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.match(el) {
+			return false
+		}
+	}
+	for _, p := range c.pseudos {
+		if !p.match(el) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a attrSelector) match(el *element) bool {
+	if !el.hasAttr(a.name) {
+		return false
+	}
+	v := el.attr(a.name)
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return v == a.value
+	case "~=":
+		for _, f := range strings.Fields(v) {
+			if f == a.value {
+				return true
+			}
+		}
+		return false
+	case "|=":
+		return v == a.value || strings.HasPrefix(v, a.value+"-")
+	case "^=":
+		return a.value != "" && strings.HasPrefix(v, a.value)
+	case "$=":
+		return a.value != "" && strings.HasSuffix(v, a.value)
+	case "*=":
+		return a.value != "" && strings.Contains(v, a.value)
+	}
+	return false
+}
+
+func (p pseudoSelector) match(el *element) bool {
+	siblings := el.parent.children
+	var pos int // 1-based position counted from the start or the end
+	switch p.name {
+	case "only-child":
+		return len(siblings) == 1
+	case "nth-child":
+		pos = el.index + 1
+	case "nth-last-child":
+		pos = len(siblings) - el.index
+	case "nth-of-type", "nth-last-of-type":
+		for i, sib := range siblings {
+			if sib.tag != el.tag {
+				continue
+			}
+			if p.name == "nth-of-type" && i <= el.index || p.name == "nth-last-of-type" && i >= el.index {
+				pos++
+			}
+		}
+	}
+	a, b := p.nth[0], p.nth[1]
+	if a == 0 {
+		return pos == b
+	}
+	n := pos - b
+	return n%a == 0 && n/a >= 0
+}
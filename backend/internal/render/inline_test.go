@@ -0,0 +1,55 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineCSS(t *testing.T) {
+	body := `<html><head><style>
+/* brand */
+p { color: #333; font-family: "Helvetica Neue", Arial; margin: 0 }
+.lead { color: red; font-size: 18px }
+#intro.lead { color: blue }
+td > a { text-decoration: none }
+li:first-child { font-weight: bold }
+h1 + p { margin-top: 4px }
+a:hover { color: green }
+@media (max-width: 600px) { .lead { font-size: 14px !important } }
+</style></head><body>
+<h1>Hi {{ contact.first_name }}</h1>
+<p id="intro" class="lead" style="margin: 8px">Intro</p>
+<p class="lead">Lead</p>
+<table><tr><td><a href="https://acme.test">Go</a></td></tr></table>
+<ul><li>One<li>Two</ul>
+</body></html>`
+
+	got, err := InlineCSS(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<h1>Hi {{ contact.first_name }}</h1>`,
+		`<p id="intro" class="lead" style="font-family: &#39;Helvetica Neue&#39;, Arial; margin-top: 4px; font-size: 18px; color: blue; margin: 8px;">Intro</p>`,
+		`<p class="lead" style="font-family: &#39;Helvetica Neue&#39;, Arial; margin: 0; color: red; font-size: 18px;">Lead</p>`,
+		`<a href="https://acme.test" style="text-decoration: none;">Go</a>`,
+		`<li style="font-weight: bold;">One<li>Two`,
+		"<style>\na:hover { color: green }\n@media (max-width: 600px) { .lead { font-size: 14px !important } }\n</style>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InlineCSS() is missing\n%s\nin\n%s", want, got)
+		}
+	}
+}
+
+func TestInlineCSSDropsEmptyBlocks(t *testing.T) {
+	body := `<style>b { color: red }</style><style data-noinline>i { color: blue }</style><b>x</b><i>y</i>`
+	got, err := InlineCSS(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<style data-noinline>i { color: blue }</style><b style="color: red;">x</b><i>y</i>`
+	if got != want {
+		t.Errorf("InlineCSS() = %s, want %s", got, want)
+	}
+}
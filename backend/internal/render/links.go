@@ -0,0 +1,124 @@
+// Package render holds the steps that turn stored template content into
+// the HTML and text that is actually sent.
+package render
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// NoTrackAttr opts a single link out of click tracking:
+//
+//	<a href="https://example.com" data-notrack>
+//
+// The attribute is removed from the sent HTML.
+const NoTrackAttr = "data-notrack"
+
+// LinkRewriter returns the URL to put in place of href.
+type LinkRewriter func(href string) (string, error)
+
+// RewriteLinks passes the href of every trackable <a> and <area> tag through
+// rewrite. Everything else in the document is copied through byte for byte,
+// so conditional comments and client-specific markup survive untouched.
+func RewriteLinks(body string, rewrite LinkRewriter) (string, error) {
+	z := html.NewTokenizer(strings.NewReader(body))
+	var out bytes.Buffer
+	out.Grow(len(body) + len(body)/4)
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return out.String(), nil
+			}
+			return "", z.Err()
+		}
+
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.Write(z.Raw())
+			continue
+		}
+
+		// Token lower-cases the buffer in place, so keep the original bytes.
+		raw := append([]byte(nil), z.Raw()...)
+		tok := z.Token()
+		if tok.Data != "a" && tok.Data != "area" {
+			out.Write(raw)
+			continue
+		}
+
+		changed, err := rewriteTag(&tok, rewrite)
+		if err != nil {
+			return "", err
+		}
+		if !changed {
+			out.Write(raw)
+			continue
+		}
+		out.WriteString(tok.String())
+	}
+}
+
+func rewriteTag(tok *html.Token, rewrite LinkRewriter) (bool, error) {
+	hrefIdx := -1
+	noTrack := -1
+	for i, a := range tok.Attr {
+		switch a.Key {
+		case "href":
+			hrefIdx = i
+		case NoTrackAttr:
+			noTrack = i
+		}
+	}
+
+	if noTrack >= 0 {
+		tok.Attr = append(tok.Attr[:noTrack], tok.Attr[noTrack+1:]...)
+		return true, nil
+	}
+	if hrefIdx < 0 || !Trackable(tok.Attr[hrefIdx].Val) {
+		return false, nil
+	}
+
+	tracked, err := rewrite(strings.TrimSpace(tok.Attr[hrefIdx].Val))
+	if err != nil {
+		return false, err
+	}
+	tok.Attr[hrefIdx].Val = tracked
+	return true, nil
+}
+
+// Trackable reports whether a link should be routed through click
+// tracking. Only absolute http(s) links qualify; mailto:, tel:, in-page
+// anchors and unsubscribe links are left alone so they keep working
+// without a round trip and are never counted as engagement.
+func Trackable(href string) bool {
+	href = strings.TrimSpace(href)
+	u, err := url.Parse(href)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if strings.Contains(strings.ToLower(u.Path+"?"+u.RawQuery), "unsubscribe") {
+		return false
+	}
+	return true
+}
+
+// InsertOpenPixel adds the open-tracking image loading src at the end of
+// the body, where it doesn't move anything else, or at the end of the
+// document when it has no </body>.
+func InsertOpenPixel(body, src string) string {
+	img := `<img src="` + html.EscapeString(src) + `" width="1" height="1" alt="" style="display:block;width:1px;height:1px;border:0">`
+	for i := len(body) - len("</body"); i >= 0; i-- {
+		if strings.EqualFold(body[i:i+len("</body")], "</body") {
+			return body[:i] + img + body[i:]
+		}
+	}
+	return body + img
+}
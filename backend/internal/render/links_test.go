@@ -0,0 +1,78 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewriteLinks(t *testing.T) {
+	body := `<!--[if mso]><v:roundrect href="https://acme.test/mso"></v:roundrect><![endif]-->
+<P>Hi <A HREF="https://acme.test/a?x=1&amp;y=2" class="btn">read</A>
+<a href="mailto:help@acme.test">mail</a> <a href="tel:+15551234">call</a>
+<a href="#top">top</a> <a href="https://acme.test/unsubscribe?id=1">unsubscribe</a>
+<a href="https://acme.test/private" data-notrack>private</a>
+<map><area shape="rect" href="https://acme.test/b"></map></P>`
+
+	var seen []string
+	out, err := RewriteLinks(body, func(href string) (string, error) {
+		seen = append(seen, href)
+		return "https://t.test/c/" + string(rune('0'+len(seen))), nil
+	})
+	if err != nil {
+		t.Fatalf("RewriteLinks: %v", err)
+	}
+
+	if want := []string{"https://acme.test/a?x=1&y=2", "https://acme.test/b"}; strings.Join(seen, " ") != strings.Join(want, " ") {
+		t.Errorf("rewritten %q, want %q", seen, want)
+	}
+	for _, s := range []string{
+		`<!--[if mso]><v:roundrect href="https://acme.test/mso"></v:roundrect><![endif]-->`,
+		`<P>Hi `,
+		`<a href="https://t.test/c/1" class="btn">`,
+		`<a href="mailto:help@acme.test">`,
+		`<a href="tel:+15551234">`,
+		`<a href="#top">`,
+		`<a href="https://acme.test/unsubscribe?id=1">`,
+		`<a href="https://acme.test/private">private</a>`,
+		`<area shape="rect" href="https://t.test/c/2">`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output missing %q:\n%s", s, out)
+		}
+	}
+	if strings.Contains(out, NoTrackAttr) {
+		t.Errorf("%s attribute left in output", NoTrackAttr)
+	}
+}
+
+func TestTrackable(t *testing.T) {
+	cases := map[string]bool{
+		"https://acme.test/":                     true,
+		" http://acme.test/a ":                   true,
+		"mailto:a@acme.test":                     false,
+		"tel:123":                                false,
+		"#section":                               false,
+		"/relative":                              false,
+		"javascript:alert(1)":                    false,
+		"https://acme.test/Unsubscribe":          false,
+		"https://acme.test/p?action=unsubscribe": false,
+	}
+	for href, want := range cases {
+		if got := Trackable(href); got != want {
+			t.Errorf("Trackable(%q) = %v, want %v", href, got, want)
+		}
+	}
+}
+
+func TestInsertOpenPixel(t *testing.T) {
+	const img = `<img src="https://t.test/o/a&amp;b" width="1" height="1" alt="" style="display:block;width:1px;height:1px;border:0">`
+	cases := map[string]string{
+		"<html><body><p>Hi</p></BODY></html>": "<html><body><p>Hi</p>" + img + "</BODY></html>",
+		"<p>Hi</p>":                           "<p>Hi</p>" + img,
+	}
+	for body, want := range cases {
+		if got := InsertOpenPixel(body, "https://t.test/o/a&b"); got != want {
+			t.Errorf("InsertOpenPixel(%q) = %q, want %q", body, got, want)
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package render
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// PlainText converts email HTML into the plain-text alternative sent with
+// it. Headings, lists, blockquotes and data tables keep their shape, links
+// become numbered references listed at the end, and content no reader
+// would see, such as the hidden preheader and tracking pixels, is dropped.
+// Merge tags pass through untouched.
+func PlainText(body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	c := &textConverter{linkIndex: map[string]int{}}
+	w := &textWriter{}
+	c.walk(w, doc)
+
+	out := w.String()
+	if len(c.links) > 0 {
+		var b strings.Builder
+		b.WriteString(out)
+		b.WriteString("\n\nLinks:\n")
+		for i, link := range c.links {
+			b.WriteString("[" + strconv.Itoa(i+1) + "] " + link + "\n")
+		}
+		out = b.String()
+	}
+	return tidyText(out), nil
+}
+
+// textConverter holds the link references, which are shared by everything
+// rendered from one document.
+type textConverter struct {
+	links     []string
+	linkIndex map[string]int
+}
+
+func (c *textConverter) walk(w *textWriter, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.DocumentNode:
+		c.children(w, n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if hiddenElement(n) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Title, atom.Noscript, atom.Template, atom.Svg:
+	case atom.Br:
+		w.lineBreak()
+	case atom.Hr:
+		w.block(2)
+		w.write("--------------------")
+		w.block(2)
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		c.heading(w, n)
+	case atom.P, atom.Table, atom.Pre:
+		w.block(2)
+		if n.DataAtom == atom.Table && dataTable(n) {
+			c.table(w, n)
+		} else if n.DataAtom == atom.Pre {
+			w.pre++
+			c.children(w, n)
+			w.pre--
+		} else {
+			c.children(w, n)
+		}
+		w.block(2)
+	case atom.Blockquote:
+		w.block(2)
+		w.push("> ")
+		c.children(w, n)
+		w.pop()
+		w.block(2)
+	case atom.Ul, atom.Ol:
+		c.list(w, n)
+	case atom.Li:
+		// A list item outside any list reads as a bullet.
+		c.item(w, n, "* ")
+	case atom.A:
+		c.link(w, n)
+	case atom.Img:
+		if !trackingPixel(n) {
+			w.text(attr(n, "alt"))
+		}
+	default:
+		if blockElement(n.DataAtom) {
+			w.block(1)
+			c.children(w, n)
+			w.block(1)
+		} else {
+			c.children(w, n)
+		}
+	}
+}
+
+func (c *textConverter) children(w *textWriter, n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.walk(w, child)
+	}
+}
+
+// inline renders n on its own into a single line.
+func (c *textConverter) inline(n *html.Node) string {
+	sub := &textWriter{}
+	c.children(sub, n)
+	return strings.Join(strings.Fields(sub.String()), " ")
+}
+
+func (c *textConverter) heading(w *textWriter, n *html.Node) {
+	text := c.inline(n)
+	if text == "" {
+		return
+	}
+	w.block(2)
+	w.write(text)
+	switch n.DataAtom {
+	case atom.H1:
+		w.block(1)
+		w.write(strings.Repeat("=", utf8.RuneCountInString(text)))
+	case atom.H2:
+		w.block(1)
+		w.write(strings.Repeat("-", utf8.RuneCountInString(text)))
+	}
+	w.block(2)
+}
+
+func (c *textConverter) list(w *textWriter, n *html.Node) {
+	// Nested lists continue their item without a blank line.
+	gap := 2
+	if w.indent > 0 {
+		gap = 1
+	}
+	w.block(gap)
+	num := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		num = start
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || child.DataAtom != atom.Li {
+			c.walk(w, child)
+			continue
+		}
+		marker := "* "
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(num) + ". "
+			num++
+		}
+		c.item(w, child, marker)
+	}
+	w.block(gap)
+}
+
+func (c *textConverter) item(w *textWriter, n *html.Node, marker string) {
+	w.block(1)
+	w.marker = marker
+	w.push(strings.Repeat(" ", len(marker)))
+	w.indent++
+	c.children(w, n)
+	w.indent--
+	w.pop()
+	w.block(1)
+}
+
+// link writes the link's text followed by a numbered reference to its URL,
+// unless the text already is the URL.
+func (c *textConverter) link(w *textWriter, n *html.Node) {
+	href := strings.TrimSpace(attr(n, "href"))
+	text := c.inline(n)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		c.children(w, n)
+		return
+	}
+	bare := strings.TrimPrefix(strings.TrimPrefix(href, "mailto:"), "tel:")
+	if text == "" {
+		w.text(bare)
+		return
+	}
+	c.children(w, n)
+	if text == href || text == bare {
+		return
+	}
+
+	i, ok := c.linkIndex[href]
+	if !ok {
+		c.links = append(c.links, href)
+		i = len(c.links)
+		c.linkIndex[href] = i
+	}
+	w.text(" [" + strconv.Itoa(i) + "]")
+}
+
+// table writes a data table one row per line, with the cells separated by
+// bars and a rule under the header row.
+func (c *textConverter) table(w *textWriter, n *html.Node) {
+	for _, row := range tableRows(n) {
+		var cells []string
+		header := false
+		for cell := row.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type != html.ElementNode || (cell.DataAtom != atom.Td && cell.DataAtom != atom.Th) {
+				continue
+			}
+			if cell.DataAtom == atom.Th {
+				header = true
+			}
+			cells = append(cells, c.inline(cell))
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		line := strings.Join(cells, " | ")
+		w.block(1)
+		w.write(line)
+		if header {
+			w.block(1)
+			w.write(strings.Repeat("-", utf8.RuneCountInString(line)))
+		}
+	}
+}
+
+// dataTable tells tables of data from the layout tables emails are built
+// with. Layout tables are marked role="presentation", nest other tables or
+// hold a single column; they are read as a sequence of blocks.
+func dataTable(n *html.Node) bool {
+	if strings.EqualFold(attr(n, "role"), "presentation") {
+		return false
+	}
+	rows := tableRows(n)
+	multiColumn := false
+	for _, row := range rows {
+		cells := 0
+		for cell := row.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type != html.ElementNode {
+				continue
+			}
+			if cell.DataAtom == atom.Th {
+				return !containsTable(cell)
+			}
+			if cell.DataAtom == atom.Td {
+				if containsTable(cell) {
+					return false
+				}
+				cells++
+			}
+		}
+		if cells > 1 {
+			multiColumn = true
+		}
+	}
+	return multiColumn
+}
+
+func tableRows(table *html.Node) []*html.Node {
+	var rows []*html.Node
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.DataAtom {
+			case atom.Tr:
+				rows = append(rows, child)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				find(child)
+			}
+		}
+	}
+	find(table)
+	return rows
+}
+
+func containsTable(n *html.Node) bool {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && (child.DataAtom == atom.Table || containsTable(child)) {
+			return true
+		}
+	}
+	return false
+}
+
+func blockElement(a atom.Atom) bool {
+	switch a {
+	case atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main, atom.Nav,
+		atom.Aside, atom.Center, atom.Tr, atom.Td, atom.Th, atom.Caption, atom.Dl, atom.Dt, atom.Dd,
+		atom.Figure, atom.Figcaption, atom.Address, atom.Body, atom.Html:
+		return true
+	}
+	return false
+}
+
+// hiddenElement reports elements no reader sees, like the preheader that
+// only shows up in inbox listings.
+func hiddenElement(n *html.Node) bool {
+	if hasAttr(n, "hidden") {
+		return true
+	}
+	for _, class := range strings.Fields(attr(n, "class")) {
+		if strings.EqualFold(class, "preheader") {
+			return true
+		}
+	}
+	style := strings.ToLower(strings.Join(strings.Fields(attr(n, "style")), ""))
+	for _, rule := range []string{"display:none", "visibility:hidden", "mso-hide:all"} {
+		if strings.Contains(style, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackingPixel reports open-tracking images: the tracker's own pixel, or
+// any image sized one pixel or less.
+func trackingPixel(n *html.Node) bool {
+	if strings.Contains(attr(n, "src"), "/track/open/") {
+		return true
+	}
+	tiny := func(v string) bool {
+		v = strings.TrimSuffix(strings.TrimSpace(v), "px")
+		px, err := strconv.Atoi(v)
+		return err == nil && px <= 1
+	}
+	return tiny(attr(n, "width")) && tiny(attr(n, "height"))
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// tidyText trims trailing spaces and allows at most one blank line in a
+// row.
+func tidyText(s string) string {
+	lines := strings.Split(s, "\n")
+	out := lines[:0]
+	blank := 0
+	for _, line := range lines {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" {
+			blank++
+			if blank > 1 {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n")) + "\n"
+}
+
+// textWriter lays text out in lines. Blocks ask for line breaks before the
+// next text rather than writing them, so nested blocks do not pile up
+// blank lines.
+type textWriter struct {
+	b       strings.Builder
+	prefix  []string
+	pending int
+	marker  string
+	space   bool
+	midLine bool
+	pre     int
+	indent  int
+}
+
+func (w *textWriter) String() string {
+	return w.b.String()
+}
+
+// block asks for at least n line breaks before the next text.
+func (w *textWriter) block(n int) {
+	if n > w.pending {
+		w.pending = n
+	}
+	w.space = false
+}
+
+func (w *textWriter) lineBreak() {
+	w.pending++
+	w.space = false
+}
+
+func (w *textWriter) push(prefix string) {
+	w.prefix = append(w.prefix, prefix)
+}
+
+func (w *textWriter) pop() {
+	w.prefix = w.prefix[:len(w.prefix)-1]
+}
+
+// text writes HTML text, collapsing whitespace outside <pre>.
+func (w *textWriter) text(s string) {
+	if w.pre > 0 {
+		for i, line := range strings.Split(s, "\n") {
+			if i > 0 {
+				w.lineBreak()
+			}
+			if line != "" {
+				w.write(line)
+			}
+		}
+		return
+	}
+	if s == "" {
+		return
+	}
+	first, _ := utf8.DecodeRuneInString(s)
+	last, _ := utf8.DecodeLastRuneInString(s)
+	words := strings.Fields(s)
+	if unicode.IsSpace(first) || len(words) == 0 {
+		w.space = true
+	}
+	for i, word := range words {
+		if i > 0 {
+			w.space = true
+		}
+		w.write(word)
+	}
+	if unicode.IsSpace(last) {
+		w.space = true
+	}
+}
+
+// write puts s on the current line, first breaking lines as asked and
+// starting new lines with the prefixes of the enclosing quotes and list
+// items.
+func (w *textWriter) write(s string) {
+	if w.pending > 0 && w.b.Len() > 0 {
+		w.b.WriteString(strings.Repeat("\n", w.pending))
+		w.midLine = false
+	}
+	w.pending = 0
+	if !w.midLine {
+		prefix := strings.Join(w.prefix, "")
+		if w.marker != "" && len(prefix) >= len(w.marker) {
+			prefix = prefix[:len(prefix)-len(w.marker)] + w.marker
+			w.marker = ""
+		}
+		w.b.WriteString(prefix)
+		w.midLine = true
+	} else if w.space {
+		w.b.WriteByte(' ')
+	}
+	w.space = false
+	w.b.WriteString(s)
+}
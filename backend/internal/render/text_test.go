@@ -0,0 +1,63 @@
+package render
+
+import "testing"
+
+func TestPlainText(t *testing.T) {
+	body := `<html><head><title>News</title><style>p{color:red}</style></head><body>
+<div style="display: none; max-height:0">Hidden preheader</div>
+<table role="presentation"><tr><td>
+  <h1>Spring   news</h1>
+  <p>Hi {{ contact.first_name | default "there" }},<br>welcome &amp; enjoy.</p>
+  <h2>Highlights</h2>
+  <ul>
+    <li>New <a href="https://acme.test/shop">shop</a></li>
+    <li>Nested<ol start="3"><li>first</li><li>second</li></ol></li>
+  </ul>
+  <blockquote>Quoted text</blockquote>
+  <table>
+    <tr><th>Plan</th><th>Price</th></tr>
+    <tr><td>Pro</td><td>$10</td></tr>
+  </table>
+  <p><a href="https://acme.test/shop">Shop again</a> or mail <a href="mailto:hi@acme.test">hi@acme.test</a>.
+  <a href="{{ unsubscribe_url }}">Unsubscribe</a></p>
+  <img src="https://acme.test/logo.png" alt="Acme">
+  <img src="https://acme.test/p.gif" width="1" height="1" alt="pixel">
+</td></tr></table>
+</body></html>`
+
+	got, err := PlainText(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Spring news
+===========
+
+Hi {{ contact.first_name | default "there" }},
+welcome & enjoy.
+
+Highlights
+----------
+
+* New shop [1]
+* Nested
+  3. first
+  4. second
+
+> Quoted text
+
+Plan | Price
+------------
+Pro | $10
+
+Shop again [1] or mail hi@acme.test. Unsubscribe [2]
+
+Acme
+
+Links:
+[1] https://acme.test/shop
+[2] {{ unsubscribe_url }}
+`
+	if got != want {
+		t.Errorf("PlainText() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package render
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// UTM holds the value templates for the four tagged parameters. Values may
+// use these placeholders:
+//
+//	{campaign}     slug of the campaign name
+//	{campaign_id}  numeric campaign ID
+//	{position}     1-based position of the link among tracked links
+//	{variant}      A/B variant the recipient received, empty if none
+type UTM struct {
+	Source   string
+	Medium   string
+	Campaign string
+	Content  string
+}
+
+func DefaultUTM() UTM {
+	return UTM{
+		Source:   "newsletter",
+		Medium:   "email",
+		Campaign: "{campaign}",
+		Content:  "link-{position}",
+	}
+}
+
+// UTMVars are the per-send values substituted into UTM templates.
+type UTMVars struct {
+	CampaignID   uint64
+	CampaignName string
+	Variant      string
+}
+
+// UTMTagger appends UTM parameters to links of one campaign send.
+type UTMTagger struct {
+	utm  UTM
+	vars UTMVars
+	slug string
+}
+
+func NewUTMTagger(utm UTM, vars UTMVars) *UTMTagger {
+	return &UTMTagger{utm: utm, vars: vars, slug: Slug(vars.CampaignName)}
+}
+
+// Tag returns href with any missing utm_* parameters added. Parameters
+// already present in the link are left exactly as the author wrote them,
+// as is the rest of the query string.
+func (t *UTMTagger) Tag(href string, position int) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	existing := u.Query()
+
+	add := url.Values{}
+	for _, p := range []struct{ key, tmpl string }{
+		{"utm_source", t.utm.Source},
+		{"utm_medium", t.utm.Medium},
+		{"utm_campaign", t.utm.Campaign},
+		{"utm_content", t.utm.Content},
+	} {
+		if existing.Has(p.key) {
+			continue
+		}
+		if v := t.expand(p.tmpl, position); v != "" {
+			add.Set(p.key, v)
+		}
+	}
+	if len(add) == 0 {
+		return href
+	}
+
+	if u.RawQuery == "" {
+		u.RawQuery = add.Encode()
+	} else {
+		u.RawQuery += "&" + add.Encode()
+	}
+	return u.String()
+}
+
+func (t *UTMTagger) expand(tmpl string, position int) string {
+	v := strings.NewReplacer(
+		"{campaign}", t.slug,
+		"{campaign_id}", strconv.FormatUint(t.vars.CampaignID, 10),
+		"{position}", strconv.Itoa(position),
+		"{variant}", t.vars.Variant,
+	).Replace(tmpl)
+	// An empty {variant} must not leave "link-3-" behind.
+	return strings.Trim(v, "-_ ")
+}
+
+// Slug lower-cases s and joins its letters and digits with hyphens, so
+// "Spring Sale: 20% off!" becomes "spring-sale-20-off".
+func Slug(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+			continue
+		}
+		hyphen = true
+	}
+	return b.String()
+}
@@ -0,0 +1,41 @@
+package render
+
+import "testing"
+
+func TestUTMTagger(t *testing.T) {
+	tagger := NewUTMTagger(DefaultUTM(), UTMVars{CampaignID: 42, CampaignName: "Spring Sale: 20% off!"})
+
+	cases := []struct {
+		href     string
+		position int
+		want     string
+	}{
+		{"https://acme.test/shoes", 1,
+			"https://acme.test/shoes?utm_campaign=spring-sale-20-off&utm_content=link-1&utm_medium=email&utm_source=newsletter"},
+		{"https://acme.test/p?b=2&a=1#top", 2,
+			"https://acme.test/p?b=2&a=1&utm_campaign=spring-sale-20-off&utm_content=link-2&utm_medium=email&utm_source=newsletter#top"},
+		{"https://acme.test/?utm_source=partner&utm_campaign=custom", 3,
+			"https://acme.test/?utm_source=partner&utm_campaign=custom&utm_content=link-3&utm_medium=email"},
+		{"https://acme.test/?utm_source=a&utm_medium=b&utm_campaign=c&utm_content=d", 4,
+			"https://acme.test/?utm_source=a&utm_medium=b&utm_campaign=c&utm_content=d"},
+	}
+	for _, c := range cases {
+		if got := tagger.Tag(c.href, c.position); got != c.want {
+			t.Errorf("Tag(%q)\n got %s\nwant %s", c.href, got, c.want)
+		}
+	}
+}
+
+func TestUTMTemplates(t *testing.T) {
+	utm := UTM{Source: "acme", Medium: "", Campaign: "{campaign_id}-{variant}", Content: "pos{position}_{variant}"}
+
+	got := NewUTMTagger(utm, UTMVars{CampaignID: 7, Variant: "b"}).Tag("https://acme.test/", 3)
+	if want := "https://acme.test/?utm_campaign=7-b&utm_content=pos3_b&utm_source=acme"; got != want {
+		t.Errorf("with variant: got %s", got)
+	}
+
+	got = NewUTMTagger(utm, UTMVars{CampaignID: 7}).Tag("https://acme.test/", 3)
+	if want := "https://acme.test/?utm_campaign=7&utm_content=pos3&utm_source=acme"; got != want {
+		t.Errorf("without variant: got %s", got)
+	}
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"database/sql"
 	"email_campaign/internal/types"
+	"fmt"
 )
 
 type AnalyticsRepository interface {
@@ -16,6 +17,8 @@ type AnalyticsRepository interface {
 	GetRecentCampaigns(limit int) ([]types.CampaignDTO, error)
 	GetRecentActivity(limit int) ([]types.ActivityDTO, error)
 	GetQuickStats() (*types.QuickStatsDTO, error)
+	GetCampaignAudience(campaignID uint64, userID uint64, humanOnly bool) (*types.CampaignAudienceDTO, error)
+	GetAudienceTrend(userID uint64, filter *types.AudienceTrendFilter) ([]types.AudienceTrendPoint, error)
 }
 
 type analyticsRepository struct {
@@ -109,3 +112,129 @@ func (r *analyticsRepository) GetRecentActivity(limit int) ([]types.ActivityDTO,
 func (r *analyticsRepository) GetQuickStats() (*types.QuickStatsDTO, error) {
 	return &types.QuickStatsDTO{}, nil
 }
+
+// audienceColumns maps breakdown dimensions to email_events columns.
+var audienceColumns = map[string]string{
+	"client":  "e.client",
+	"device":  "e.device",
+	"os":      "e.os",
+	"country": "e.country",
+}
+
+var periodFormats = map[string]string{
+	"day":   "%Y-%m-%d",
+	"week":  "%x-W%v",
+	"month": "%Y-%m",
+}
+
+const humanOnlyClause = " AND COALESCE(e.classification, 'human') = 'human'"
+
+func (r *analyticsRepository) GetCampaignAudience(campaignID uint64, userID uint64, humanOnly bool) (*types.CampaignAudienceDTO, error) {
+	var exists int
+	err := r.db.QueryRow("SELECT 1 FROM campaigns WHERE id = ? AND user_id = ? AND is_deleted = 0", campaignID, userID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	dto := &types.CampaignAudienceDTO{CampaignID: campaignID}
+	for _, d := range []struct {
+		column string
+		dst    *[]types.AudienceSlice
+	}{
+		{"e.client", &dto.Clients},
+		{"e.device", &dto.Devices},
+		{"e.os", &dto.OS},
+		{"e.country", &dto.Countries},
+	} {
+		query := fmt.Sprintf(`SELECT COALESCE(%s, 'unknown') AS value,
+		                             COALESCE(SUM(e.event_type = 'opened'), 0),
+		                             COALESCE(SUM(e.event_type = 'clicked'), 0),
+		                             COUNT(DISTINCT CASE WHEN e.event_type = 'opened' THEN e.campaign_recipient_id END),
+		                             COUNT(DISTINCT CASE WHEN e.event_type = 'clicked' THEN e.campaign_recipient_id END)
+		                      FROM email_events e
+		                      JOIN campaign_recipients cr ON e.campaign_recipient_id = cr.id
+		                      WHERE cr.campaign_id = ? AND e.event_type IN ('opened', 'clicked')`, d.column)
+		if humanOnly {
+			query += humanOnlyClause
+		}
+		query += " GROUP BY value ORDER BY COUNT(*) DESC"
+
+		slices, err := r.queryAudience(query, campaignID)
+		if err != nil {
+			return nil, err
+		}
+		*d.dst = slices
+	}
+	return dto, nil
+}
+
+func (r *analyticsRepository) queryAudience(query string, args ...interface{}) ([]types.AudienceSlice, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	slices := []types.AudienceSlice{}
+	for rows.Next() {
+		var s types.AudienceSlice
+		if err := rows.Scan(&s.Value, &s.Opens, &s.Clicks, &s.UniqueOpens, &s.UniqueClicks); err != nil {
+			return nil, err
+		}
+		slices = append(slices, s)
+	}
+	return slices, rows.Err()
+}
+
+func (r *analyticsRepository) GetAudienceTrend(userID uint64, filter *types.AudienceTrendFilter) ([]types.AudienceTrendPoint, error) {
+	column, ok := audienceColumns[filter.Dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown dimension %q", filter.Dimension)
+	}
+	format, ok := periodFormats[filter.Period]
+	if !ok {
+		return nil, fmt.Errorf("unknown period %q", filter.Period)
+	}
+
+	query := fmt.Sprintf(`SELECT DATE_FORMAT(e.created_at, '%s') AS period, COALESCE(%s, 'unknown') AS value,
+	                             COALESCE(SUM(e.event_type = 'opened'), 0),
+	                             COALESCE(SUM(e.event_type = 'clicked'), 0)
+	                      FROM email_events e
+	                      JOIN campaign_recipients cr ON e.campaign_recipient_id = cr.id
+	                      JOIN campaigns c ON cr.campaign_id = c.id
+	                      WHERE c.user_id = ? AND e.event_type IN ('opened', 'clicked')`, format, column)
+	args := []interface{}{userID}
+
+	if filter.CampaignID != 0 {
+		query += " AND c.id = ?"
+		args = append(args, filter.CampaignID)
+	}
+	if filter.From != nil {
+		query += " AND e.created_at >= ?"
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		query += " AND e.created_at < ?"
+		args = append(args, *filter.To)
+	}
+	if filter.HumanOnly {
+		query += humanOnlyClause
+	}
+	query += " GROUP BY period, value ORDER BY period ASC, value ASC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []types.AudienceTrendPoint{}
+	for rows.Next() {
+		var p types.AudienceTrendPoint
+		if err := rows.Scan(&p.Period, &p.Value, &p.Opens, &p.Clicks); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
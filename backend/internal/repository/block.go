@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"database/sql"
+	"email_campaign/internal/types"
+	"strings"
+)
+
+type BlockRepository interface {
+	CreateBlock(block *types.ContentBlock) error
+	GetBlock(id uint64, userID uint64) (*types.ContentBlock, error)
+	GetBlockByName(userID uint64, name string) (*types.ContentBlock, error)
+	ListBlocks(userID uint64, search string, page, limit int) ([]types.ContentBlock, int, error)
+	ListAllBlocks(userID uint64) ([]types.ContentBlock, error)
+	UpdateBlock(block *types.ContentBlock) error
+	DeleteBlock(id uint64, userID uint64) error
+	BlockNameTaken(userID uint64, name string, exceptID uint64) (bool, error)
+	ListIncludingTemplates(userID uint64) ([]types.TemplateDTO, error)
+	ListBlockCampaigns(userID uint64, templateIDs []uint64, name string) ([]types.BlockCampaignUsage, error)
+	SnapshotCampaignBlocks(campaignID uint64, blocks []types.ContentBlock) error
+	GetCampaignBlocks(campaignID uint64) ([]types.ContentBlock, error)
+}
+
+type blockRepository struct {
+	db *sql.DB
+}
+
+func NewBlockRepository(db *sql.DB) BlockRepository {
+	return &blockRepository{db: db}
+}
+
+const blockColumns = `id, user_id, name, COALESCE(description, ''), type, content, created_at, updated_at`
+
+func scanBlock(row interface{ Scan(...interface{}) error }) (*types.ContentBlock, error) {
+	var b types.ContentBlock
+	if err := row.Scan(&b.ID, &b.UserID, &b.Name, &b.Description, &b.Type, &b.Content, &b.CreatedAt, &b.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *blockRepository) CreateBlock(block *types.ContentBlock) error {
+	query := `INSERT INTO content_blocks (user_id, name, description, type, content, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, NOW(), NOW())`
+	res, err := r.db.Exec(query, block.UserID, block.Name, block.Description, block.Type, block.Content)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	block.ID = uint64(id)
+	return nil
+}
+
+func (r *blockRepository) GetBlock(id uint64, userID uint64) (*types.ContentBlock, error) {
+	return scanBlock(r.db.QueryRow(`SELECT `+blockColumns+` FROM content_blocks WHERE id = ? AND user_id = ?`, id, userID))
+}
+
+func (r *blockRepository) GetBlockByName(userID uint64, name string) (*types.ContentBlock, error) {
+	return scanBlock(r.db.QueryRow(`SELECT `+blockColumns+` FROM content_blocks WHERE user_id = ? AND name = ?`, userID, name))
+}
+
+func (r *blockRepository) ListBlocks(userID uint64, search string, page, limit int) ([]types.ContentBlock, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	where := `WHERE user_id = ?`
+	args := []interface{}{userID}
+	if search = strings.TrimSpace(search); search != "" {
+		where += ` AND (name LIKE ? OR description LIKE ?)`
+		args = append(args, "%"+search+"%", "%"+search+"%")
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM content_blocks `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`SELECT `+blockColumns+` FROM content_blocks `+where+` ORDER BY name LIMIT ? OFFSET ?`,
+		append(args, limit, (page-1)*limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	blocks := []types.ContentBlock{}
+	for rows.Next() {
+		b, err := scanBlock(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		blocks = append(blocks, *b)
+	}
+	return blocks, total, rows.Err()
+}
+
+// ListAllBlocks returns every block a user has, for following includes
+// between them.
+func (r *blockRepository) ListAllBlocks(userID uint64) ([]types.ContentBlock, error) {
+	rows, err := r.db.Query(`SELECT `+blockColumns+` FROM content_blocks WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []types.ContentBlock
+	for rows.Next() {
+		b, err := scanBlock(rows)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, *b)
+	}
+	return blocks, rows.Err()
+}
+
+func (r *blockRepository) UpdateBlock(block *types.ContentBlock) error {
+	query := `UPDATE content_blocks SET name = ?, description = ?, type = ?, content = ?, updated_at = NOW()
+              WHERE id = ? AND user_id = ?`
+	_, err := r.db.Exec(query, block.Name, block.Description, block.Type, block.Content, block.ID, block.UserID)
+	return err
+}
+
+func (r *blockRepository) DeleteBlock(id uint64, userID uint64) error {
+	res, err := r.db.Exec(`DELETE FROM content_blocks WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// BlockNameTaken reports whether another of the user's blocks has name.
+// The unique key on (user_id, name) still guards against races.
+func (r *blockRepository) BlockNameTaken(userID uint64, name string, exceptID uint64) (bool, error) {
+	var n int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM content_blocks WHERE user_id = ? AND name = ? AND id <> ?`, userID, name, exceptID).Scan(&n)
+	return n > 0, err
+}
+
+// ListIncludingTemplates returns the user's templates whose content may
+// include a block. The include tags themselves are read by the caller.
+func (r *blockRepository) ListIncludingTemplates(userID uint64) ([]types.TemplateDTO, error) {
+	query := `SELECT id, name, type, COALESCE(mjml_content, ''), html_content, COALESCE(text_content, '')
+              FROM email_templates
+              WHERE user_id = ? AND is_deleted = 0 AND deleted_at IS NULL
+                AND (mjml_content LIKE '%include%' OR html_content LIKE '%include%' OR text_content LIKE '%include%')`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []types.TemplateDTO
+	for rows.Next() {
+		var t types.TemplateDTO
+		if err := rows.Scan(&t.ID, &t.Name, &t.Type, &t.MJMLContent, &t.HTMLContent, &t.TextContent); err != nil {
+			return nil, err
+		}
+		t.UserID = userID
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// ListBlockCampaigns returns the campaigns built on any of templateIDs or
+// sent with a copy of the named block, marking the latter frozen.
+func (r *blockRepository) ListBlockCampaigns(userID uint64, templateIDs []uint64, name string) ([]types.BlockCampaignUsage, error) {
+	query := `SELECT c.id, c.name, c.status, COALESCE(c.template_id, 0),
+                     EXISTS (SELECT 1 FROM campaign_blocks cb WHERE cb.campaign_id = c.id AND cb.name = ?)
+              FROM campaigns c
+              WHERE c.user_id = ? AND c.is_deleted = 0
+                AND (c.id IN (SELECT campaign_id FROM campaign_blocks WHERE name = ?)`
+	args := []interface{}{name, userID, name}
+	if len(templateIDs) > 0 {
+		query += ` OR c.template_id IN (?` + strings.Repeat(", ?", len(templateIDs)-1) + `)`
+		for _, id := range templateIDs {
+			args = append(args, id)
+		}
+	}
+	query += `) ORDER BY c.created_at DESC`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []types.BlockCampaignUsage{}
+	for rows.Next() {
+		var c types.BlockCampaignUsage
+		if err := rows.Scan(&c.ID, &c.Name, &c.Status, &c.TemplateID, &c.Frozen); err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, c)
+	}
+	return campaigns, rows.Err()
+}
+
+// SnapshotCampaignBlocks keeps the blocks a campaign is sent with. A
+// campaign that is resumed keeps its first copy.
+func (r *blockRepository) SnapshotCampaignBlocks(campaignID uint64, blocks []types.ContentBlock) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	query := `INSERT IGNORE INTO campaign_blocks (campaign_id, name, type, content, created_at) VALUES ` +
+		strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, NOW()), ", len(blocks)), ", ")
+	args := make([]interface{}, 0, len(blocks)*4)
+	for _, b := range blocks {
+		args = append(args, campaignID, b.Name, b.Type, b.Content)
+	}
+	_, err := r.db.Exec(query, args...)
+	return err
+}
+
+func (r *blockRepository) GetCampaignBlocks(campaignID uint64) ([]types.ContentBlock, error) {
+	rows, err := r.db.Query(`SELECT name, type, content FROM campaign_blocks WHERE campaign_id = ?`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []types.ContentBlock
+	for rows.Next() {
+		var b types.ContentBlock
+		if err := rows.Scan(&b.Name, &b.Type, &b.Content); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
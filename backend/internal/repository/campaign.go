@@ -1,11 +1,28 @@
 package repository
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"email_campaign/internal/types"
 	"email_campaign/internal/utils"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
+// ErrEventRejected is returned by RecordEvents when the database refuses
+// an event for what it holds, such as a value too long for its column or
+// a recipient that no longer exists. The same events would fail again.
+var ErrEventRejected = errors.New("event rejected by the database")
+
+// softBounceLimit is the number of soft bounces after which a contact is
+// treated as undeliverable.
+const softBounceLimit = 3
+
 type CampaignRepository interface {
 	CreateCampaign(campaign *types.CreateCampaignRequest) error
 	GetCampaign(id uint64, userID uint64) (*types.CampaignDTO, error)
@@ -14,9 +31,29 @@ type CampaignRepository interface {
 	DeleteCampaign(id uint64, userID uint64) error
 	DuplicateCampaign(id uint64, userID uint64) error
 	UpdateStatus(id uint64, userID uint64, status string) error
+	PinTemplateVersion(id uint64, userID uint64) error
 	GetCampaignRecipients(id uint64, userID uint64, page, limit int) ([]types.CampaignRecipientDTO, error)
-	RecordEvent(event *types.EmailEventDTO) error
+	RecordEvents(events []types.EmailEventDTO) error
+	GetEventContexts(recipientIDs []uint64, since time.Time) (map[uint64]*types.EventContext, error)
+	MarkClicks(recipientID uint64, from, to time.Time, classification string) error
+	GetEngagementCounts(campaignID uint64) (*types.EngagementCounts, error)
+	RegisterLink(campaignID uint64, url string) (uint64, error)
+	GetLinkURL(campaignID uint64, linkID uint64) (string, error)
+	GetLinkStats(campaignID uint64, userID uint64) ([]types.CampaignLinkStats, error)
+	GetCampaignContent(id uint64, userID uint64) (*types.CampaignContent, error)
+	GetCampaignLocales(id uint64) ([]string, error)
+	GetCampaignLocale(id uint64, locale string) (*types.TemplateLocaleDTO, error)
+	SetRecipientLocale(recipientID uint64, locale string) error
+	SetRecipientMessageID(recipientID uint64, messageID string) error
+	GetLocaleStats(id uint64, userID uint64) ([]types.CampaignLocaleStats, error)
+	GetCampaignUTM(id uint64, userID uint64) (*types.CampaignUTM, *types.UTMSettings, error)
+	UpdateCampaignUTM(id uint64, userID uint64, utm *types.CampaignUTM) error
+	GetLinkClickers(campaignID uint64, linkID uint64, userID uint64, page, limit int) (*types.CampaignLinkDetail, error)
 	UpdateRecipientStatus(campaignID, contactID uint64, status string, errorMessage string, bounceType string) error
+	FindRecipientForEvent(userID uint64, messageID string, email string) (*types.CampaignRecipientDTO, error)
+	GetRecipientForEvent(recipientID uint64) (*types.CampaignRecipientDTO, error)
+	FindRecipientByMessageID(messageID string) (*types.CampaignRecipientDTO, error)
+	ApplyDeliveryEvent(recipient *types.CampaignRecipientDTO, event *types.DeliveryEvent) error
 }
 
 type campaignRepository struct {
@@ -34,16 +71,16 @@ func (r *campaignRepository) CreateCampaign(campaign *types.CreateCampaignReques
 	}
 	defer tx.Rollback()
 
-	// Insert Campaign
-	query := `INSERT INTO campaigns (user_id, name, subject, from_name, from_email, reply_to_email, template_id, status, scheduled_at, created_at, updated_at) 
-              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
+	// Insert Campaign, pinned to the template's current version
+	query := `INSERT INTO campaigns (user_id, name, subject, from_name, from_email, reply_to_email, template_id, template_version, status, scheduled_at, created_at, updated_at) 
+              VALUES (?, ?, ?, ?, ?, ?, ?, (SELECT current_version FROM email_templates WHERE id = ? AND user_id = ?), ?, ?, NOW(), NOW())`
 
 	status := types.CampaignStatusDraft
 	if campaign.ScheduledAt != nil {
 		status = types.CampaignStatusScheduled
 	}
 
-	res, err := tx.Exec(query, campaign.UserID, campaign.Name, campaign.Subject, campaign.FromName, campaign.FromEmail, campaign.ReplyToEmail, campaign.TemplateID, status, campaign.ScheduledAt)
+	res, err := tx.Exec(query, campaign.UserID, campaign.Name, campaign.Subject, campaign.FromName, campaign.FromEmail, campaign.ReplyToEmail, campaign.TemplateID, campaign.TemplateID, campaign.UserID, status, campaign.ScheduledAt)
 	if err != nil {
 		return err
 	}
@@ -72,20 +109,20 @@ func (r *campaignRepository) CreateCampaign(campaign *types.CreateCampaignReques
 }
 
 func (r *campaignRepository) GetCampaign(id uint64, userID uint64) (*types.CampaignDTO, error) {
-	query := `SELECT c.id, c.user_id, c.template_id, t.name as template_name, c.name, c.subject, c.from_name, c.from_email, c.reply_to_email, c.status, c.scheduled_at, c.started_at, c.completed_at, 
+	query := `SELECT c.id, c.user_id, c.template_id, c.template_version, t.name as template_name, c.name, c.subject, c.from_name, c.from_email, c.reply_to_email, c.status, c.scheduled_at, c.started_at, c.completed_at, 
                      c.total_recipients, c.sent_count, c.delivered_count, c.failed_count, c.opened_count, c.clicked_count, c.bounced_count, c.unsubscribed_count, c.created_at, c.updated_at
               FROM campaigns c
               LEFT JOIN email_templates t ON c.template_id = t.id
               WHERE c.id = ? AND c.user_id = ? AND c.is_deleted = 0`
 
 	var c types.CampaignDTO
-	var templateID sql.NullInt64
+	var templateID, templateVersion sql.NullInt64
 	var templateName sql.NullString
 	var scheduledAt, startedAt, completedAt sql.NullTime
 	var replyToEmail sql.NullString
 
 	err := r.db.QueryRow(query, id, userID).Scan(
-		&c.ID, &c.UserID, &templateID, &templateName, &c.Name, &c.Subject, &c.FromName, &c.FromEmail, &replyToEmail, &c.Status,
+		&c.ID, &c.UserID, &templateID, &templateVersion, &templateName, &c.Name, &c.Subject, &c.FromName, &c.FromEmail, &replyToEmail, &c.Status,
 		&scheduledAt, &startedAt, &completedAt, &c.TotalRecipients, &c.SentCount, &c.DeliveredCount, &c.FailedCount,
 		&c.OpenedCount, &c.ClickedCount, &c.BouncedCount, &c.UnsubscribedCount, &c.CreatedAt, &c.UpdatedAt,
 	)
@@ -97,6 +134,10 @@ func (r *campaignRepository) GetCampaign(id uint64, userID uint64) (*types.Campa
 		tid := uint64(templateID.Int64)
 		c.TemplateID = &tid
 	}
+	if templateVersion.Valid {
+		v := int(templateVersion.Int64)
+		c.TemplateVersion = &v
+	}
 	if templateName.Valid {
 		c.TemplateName = templateName.String
 	}
@@ -264,11 +305,11 @@ func (r *campaignRepository) DuplicateCampaign(id uint64, userID uint64) error {
 	}
 	defer tx.Rollback()
 
-	query := `INSERT INTO campaigns (user_id, name, subject, from_name, from_email, reply_to_email, template_id, status, created_at, updated_at)
-              VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
+	query := `INSERT INTO campaigns (user_id, name, subject, from_name, from_email, reply_to_email, template_id, template_version, status, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
 
 	newName := "Copy of " + c.Name
-	res, err := tx.Exec(query, userID, newName, c.Subject, c.FromName, c.FromEmail, c.ReplyToEmail, c.TemplateID, types.CampaignStatusDraft)
+	res, err := tx.Exec(query, userID, newName, c.Subject, c.FromName, c.FromEmail, c.ReplyToEmail, c.TemplateID, c.TemplateVersion, types.CampaignStatusDraft)
 	if err != nil {
 		return err
 	}
@@ -286,6 +327,15 @@ func (r *campaignRepository) UpdateStatus(id uint64, userID uint64, status strin
 	return err
 }
 
+// PinTemplateVersion points the campaign at its template's current
+// version, the one it is about to be sent with.
+func (r *campaignRepository) PinTemplateVersion(id uint64, userID uint64) error {
+	_, err := r.db.Exec(`UPDATE campaigns c JOIN email_templates t ON c.template_id = t.id
+	                     SET c.template_version = t.current_version
+	                     WHERE c.id = ? AND c.user_id = ? AND c.is_deleted = 0`, id, userID)
+	return err
+}
+
 func (r *campaignRepository) GetCampaignRecipients(id uint64, userID uint64, page, limit int) ([]types.CampaignRecipientDTO, error) {
 	// Verify campaign belongs to user
 	var exists int
@@ -364,59 +414,430 @@ func (r *campaignRepository) GetCampaignRecipients(id uint64, userID uint64, pag
 	return recipients, nil
 }
 
-func (r *campaignRepository) RecordEvent(event *types.EmailEventDTO) error {
+// RecordEvents writes a batch of opens and clicks with one multi-row
+// insert, then bumps the recipient and campaign counters with one joined
+// update each. Callers must only pass events whose recipient belongs to
+// the event's campaign.
+func (r *campaignRepository) RecordEvents(events []types.EmailEventDTO) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	type recipientCounts struct {
+		opens, clicks         int
+		firstOpen, firstClick *time.Time
+	}
+	type campaignCounts struct{ opens, clicks int }
+
+	recipients := map[uint64]*recipientCounts{}
+	campaigns := map[uint64]*campaignCounts{}
+	var recipientOrder, campaignOrder []uint64
+
+	values := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*12)
+	for i := range events {
+		e := &events[i]
+		var linkID interface{}
+		if e.LinkID != 0 {
+			linkID = e.LinkID
+		}
+		values = append(values, "(?, ?, ?, NULLIF(?, ''), ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?)")
+		args = append(args, e.CampaignRecipientID, linkID, e.EventType, e.Classification, e.IPAddress, e.UserAgent,
+			e.Client, e.OS, e.Device, e.Country, e.Url, e.EventAt)
+
+		rc, ok := recipients[e.CampaignRecipientID]
+		if !ok {
+			rc = &recipientCounts{}
+			recipients[e.CampaignRecipientID] = rc
+			recipientOrder = append(recipientOrder, e.CampaignRecipientID)
+		}
+		cc, ok := campaigns[e.CampaignID]
+		if !ok {
+			cc = &campaignCounts{}
+			campaigns[e.CampaignID] = cc
+			campaignOrder = append(campaignOrder, e.CampaignID)
+		}
+		switch e.EventType {
+		case "opened":
+			rc.opens++
+			cc.opens++
+			if rc.firstOpen == nil {
+				rc.firstOpen = &e.EventAt
+			}
+		case "clicked":
+			rc.clicks++
+			cc.clicks++
+			if rc.firstClick == nil {
+				rc.firstClick = &e.EventAt
+			}
+		}
+	}
+
 	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// 1. Insert Event
-	_, err = tx.Exec(`INSERT INTO email_events (campaign_id, contact_id, event_type, event_at, user_agent, ip_address, url)
-	                  VALUES (?, ?, ?, NOW(), ?, ?, ?)`,
-		event.CampaignID, event.ContactID, event.EventType, event.UserAgent, event.IPAddress, event.Url)
+	// 1. Insert events
+	_, err = tx.Exec(`INSERT INTO email_events (campaign_recipient_id, campaign_link_id, event_type, classification, ip_address, user_agent,
+	                                            client, os, device, country, clicked_url, created_at)
+	                  VALUES `+strings.Join(values, ", "), args...)
 	if err != nil {
+		if rejectedByDB(err) {
+			return fmt.Errorf("%w: %v", ErrEventRejected, err)
+		}
 		return err
 	}
 
 	// 2. Update Campaign Recipient stats
-	// We only update opened_at/clicked_at if it's the first time
-	var updateRecipientQuery string
-	switch event.EventType {
-	case "opened":
-		updateRecipientQuery = `UPDATE campaign_recipients SET open_count = open_count + 1, opened_at = IFNULL(opened_at, NOW()), status = 'opened' WHERE campaign_id = ? AND contact_id = ?`
-	case "clicked":
-		updateRecipientQuery = `UPDATE campaign_recipients SET click_count = click_count + 1, clicked_at = IFNULL(clicked_at, NOW()), status = 'clicked' WHERE campaign_id = ? AND contact_id = ?`
-	default:
-		// For other events like bounced/complaint, we'd handle them here too, but for now focusing on Open/Click
+	// opened_at/clicked_at keep the first event; a click outranks an open in status.
+	rows := make([]string, 0, len(recipientOrder))
+	args = args[:0]
+	for _, id := range recipientOrder {
+		rc := recipients[id]
+		rows = append(rows, "SELECT ? AS id, ? AS opens, ? AS clicks, ? AS opened_at, ? AS clicked_at")
+		args = append(args, id, rc.opens, rc.clicks, rc.firstOpen, rc.firstClick)
+	}
+	_, err = tx.Exec(`UPDATE campaign_recipients cr
+	                  JOIN (`+strings.Join(rows, " UNION ALL ")+`) d ON cr.id = d.id
+	                  SET cr.open_count = cr.open_count + d.opens,
+	                      cr.click_count = cr.click_count + d.clicks,
+	                      cr.opened_at = IFNULL(cr.opened_at, d.opened_at),
+	                      cr.clicked_at = IFNULL(cr.clicked_at, d.clicked_at),
+	                      cr.status = CASE
+	                          WHEN d.clicks > 0 THEN 'clicked'
+	                          WHEN d.opens > 0 AND cr.status <> 'clicked' THEN 'opened'
+	                          ELSE cr.status END`, args...)
+	if err != nil {
+		return err
 	}
 
-	if updateRecipientQuery != "" {
-		_, err = tx.Exec(updateRecipientQuery, event.CampaignID, event.ContactID)
-		if err != nil {
-			return err
+	// 3. Update Campaign Aggregate stats
+	rows = rows[:0]
+	args = args[:0]
+	for _, id := range campaignOrder {
+		cc := campaigns[id]
+		rows = append(rows, "SELECT ? AS id, ? AS opens, ? AS clicks")
+		args = append(args, id, cc.opens, cc.clicks)
+	}
+	_, err = tx.Exec(`UPDATE campaigns c
+	                  JOIN (`+strings.Join(rows, " UNION ALL ")+`) d ON c.id = d.id
+	                  SET c.opened_count = c.opened_count + d.opens,
+	                      c.clicked_count = c.clicked_count + d.clicks`, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rejectedByDB reports whether err is MySQL refusing a row's values,
+// which retrying cannot fix.
+func rejectedByDB(err error) bool {
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) {
+		return false
+	}
+	switch me.Number {
+	case 1048, // column cannot be null
+		1264, // out of range value
+		1292, // incorrect value
+		1366, // incorrect string value
+		1406, // data too long
+		1452: // foreign key constraint fails
+		return true
+	}
+	return false
+}
+
+// duplicateKey reports whether err is MySQL refusing a row that repeats a
+// unique key.
+func duplicateKey(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == 1062
+}
+
+// GetEventContexts loads what the open/click classifier needs for each of
+// the given recipients: when they were sent the campaign, how many links
+// the campaign has, and their clicks since the given time. Recipients that
+// do not exist are missing from the result.
+func (r *campaignRepository) GetEventContexts(recipientIDs []uint64, since time.Time) (map[uint64]*types.EventContext, error) {
+	contexts := make(map[uint64]*types.EventContext, len(recipientIDs))
+	if len(recipientIDs) == 0 {
+		return contexts, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(recipientIDs)), ", ")
+	args := make([]interface{}, len(recipientIDs))
+	for i, id := range recipientIDs {
+		args[i] = id
+	}
+
+	rows, err := r.db.Query(`SELECT cr.id, cr.campaign_id, cr.sent_at,
+	                                (SELECT COUNT(*) FROM campaign_links l WHERE l.campaign_id = cr.campaign_id)
+	                         FROM campaign_recipients cr
+	                         WHERE cr.id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		var sentAt sql.NullTime
+		ctx := &types.EventContext{}
+		if err := rows.Scan(&id, &ctx.CampaignID, &sentAt, &ctx.CampaignLinks); err != nil {
+			return nil, err
 		}
+		if sentAt.Valid {
+			ctx.SentAt = &sentAt.Time
+		}
+		contexts[id] = ctx
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	// 3. Update Campaign Aggregate stats
-	// This is a bit simplistic; ideally we count unique opens/clicks.
-	// For now, simple increment.
-	var updateCampaignQuery string
-	switch event.EventType {
-	case "opened":
-		updateCampaignQuery = `UPDATE campaigns SET opened_count = opened_count + 1 WHERE id = ?`
-	case "clicked":
-		updateCampaignQuery = `UPDATE campaigns SET clicked_count = clicked_count + 1 WHERE id = ?`
-	}
-
-	if updateCampaignQuery != "" {
-		_, err = tx.Exec(updateCampaignQuery, event.CampaignID)
-		if err != nil {
-			return err
+	clicks, err := r.db.Query(`SELECT campaign_recipient_id, campaign_link_id, created_at
+	                           FROM email_events
+	                           WHERE campaign_recipient_id IN (`+placeholders+`)
+	                             AND event_type = 'clicked' AND campaign_link_id IS NOT NULL AND created_at >= ?
+	                           ORDER BY created_at`, append(args, since)...)
+	if err != nil {
+		return nil, err
+	}
+	defer clicks.Close()
+
+	for clicks.Next() {
+		var id uint64
+		var c types.LinkClick
+		if err := clicks.Scan(&id, &c.LinkID, &c.At); err != nil {
+			return nil, err
+		}
+		if ctx := contexts[id]; ctx != nil {
+			ctx.RecentClicks = append(ctx.RecentClicks, c)
 		}
 	}
+	return contexts, clicks.Err()
+}
 
-	return tx.Commit()
+// MarkClicks reclassifies a recipient's clicks between from and to, used
+// once a burst shows the earlier clicks were a scanner too.
+func (r *campaignRepository) MarkClicks(recipientID uint64, from, to time.Time, classification string) error {
+	_, err := r.db.Exec(`UPDATE email_events SET classification = ?
+	                     WHERE campaign_recipient_id = ? AND event_type = 'clicked' AND created_at BETWEEN ? AND ?`,
+		classification, recipientID, from, to)
+	return err
+}
+
+// GetEngagementCounts counts opens and clicks from email_events. Events
+// recorded before classification existed count as human.
+func (r *campaignRepository) GetEngagementCounts(campaignID uint64) (*types.EngagementCounts, error) {
+	c := &types.EngagementCounts{}
+	err := r.db.QueryRow(`SELECT
+	                          COUNT(DISTINCT CASE WHEN e.event_type = 'opened' THEN cr.id END),
+	                          COUNT(DISTINCT CASE WHEN e.event_type = 'clicked' THEN cr.id END),
+	                          COALESCE(SUM(e.event_type = 'opened' AND COALESCE(e.classification, 'human') = 'human'), 0),
+	                          COALESCE(SUM(e.event_type = 'clicked' AND COALESCE(e.classification, 'human') = 'human'), 0),
+	                          COUNT(DISTINCT CASE WHEN e.event_type = 'opened' AND COALESCE(e.classification, 'human') = 'human' THEN cr.id END),
+	                          COUNT(DISTINCT CASE WHEN e.event_type = 'clicked' AND COALESCE(e.classification, 'human') = 'human' THEN cr.id END)
+	                      FROM email_events e
+	                      JOIN campaign_recipients cr ON e.campaign_recipient_id = cr.id
+	                      WHERE cr.campaign_id = ? AND e.event_type IN ('opened', 'clicked')`,
+		campaignID).Scan(&c.UniqueOpens, &c.UniqueClicks, &c.HumanOpens, &c.HumanClicks, &c.UniqueHumanOpens, &c.UniqueHumanClicks)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCampaignContent returns the sender, subject and template content the
+// campaign's messages are rendered from.
+func (r *campaignRepository) GetCampaignContent(id uint64, userID uint64) (*types.CampaignContent, error) {
+	c := &types.CampaignContent{ID: id, UserID: userID}
+	var replyTo, templateType, mjmlContent, html, text sql.NullString
+	// Sent campaigns read the template version they were sent with, so
+	// later edits to the template don't change them; drafts read it as
+	// it is now.
+	err := r.db.QueryRow(`SELECT c.name, c.subject, c.from_name, c.from_email, c.reply_to_email,
+	                             IF(v.id IS NULL, t.type, v.type), IF(v.id IS NULL, t.mjml_content, v.mjml_content),
+	                             IF(v.id IS NULL, t.html_content, v.html_content), IF(v.id IS NULL, t.text_content, v.text_content),
+	                             COALESCE(s.default_locale, 'en')
+	                      FROM campaigns c
+	                      LEFT JOIN email_templates t ON c.template_id = t.id
+	                      LEFT JOIN email_template_versions v ON v.template_id = c.template_id AND v.version = c.template_version
+	                                AND (c.started_at IS NOT NULL OR c.status IN (?, ?, ?))
+	                      LEFT JOIN user_settings s ON s.user_id = c.user_id
+	                      WHERE c.id = ? AND c.user_id = ? AND c.is_deleted = 0`,
+		types.CampaignStatusSending, types.CampaignStatusPaused, types.CampaignStatusCompleted, id, userID).Scan(
+		&c.Name, &c.Subject, &c.FromName, &c.FromEmail, &replyTo, &templateType, &mjmlContent, &html, &text, &c.DefaultLocale,
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.ReplyToEmail = replyTo.String
+	c.TemplateType = templateType.String
+	c.MJML = mjmlContent.String
+	c.HTML = html.String
+	c.Text = text.String
+	return c, nil
+}
+
+// GetCampaignLocales lists the locales the campaign's template has been
+// translated into.
+func (r *campaignRepository) GetCampaignLocales(id uint64) ([]string, error) {
+	rows, err := r.db.Query(`SELECT l.locale FROM email_template_locales l
+	                         JOIN campaigns c ON c.template_id = l.template_id
+	                         WHERE c.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var locales []string
+	for rows.Next() {
+		var l string
+		if err := rows.Scan(&l); err != nil {
+			return nil, err
+		}
+		locales = append(locales, l)
+	}
+	return locales, rows.Err()
+}
+
+func (r *campaignRepository) GetCampaignLocale(id uint64, locale string) (*types.TemplateLocaleDTO, error) {
+	var l types.TemplateLocaleDTO
+	var mjmlContent, textContent sql.NullString
+	err := r.db.QueryRow(`SELECT l.template_id, l.locale, l.subject, l.mjml_content, l.html_content, l.text_content, l.created_at, l.updated_at
+	                      FROM email_template_locales l
+	                      JOIN campaigns c ON c.template_id = l.template_id
+	                      WHERE c.id = ? AND l.locale = ?`, id, locale).Scan(
+		&l.TemplateID, &l.Locale, &l.Subject, &mjmlContent, &l.HTMLContent, &textContent, &l.CreatedAt, &l.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	l.MJMLContent = mjmlContent.String
+	l.TextContent = textContent.String
+	return &l, nil
+}
+
+// SetRecipientLocale records the locale a recipient's message was first
+// rendered in. Later renders, such as viewing it online, leave it alone.
+func (r *campaignRepository) SetRecipientLocale(recipientID uint64, locale string) error {
+	_, err := r.db.Exec(`UPDATE campaign_recipients SET locale = ? WHERE id = ? AND locale IS NULL`, locale, recipientID)
+	return err
+}
+
+// SetRecipientMessageID records the Message-ID a recipient's message was
+// sent with, which provider events and bounce reports refer to.
+func (r *campaignRepository) SetRecipientMessageID(recipientID uint64, messageID string) error {
+	_, err := r.db.Exec(`UPDATE campaign_recipients SET message_id = ? WHERE id = ?`, messageID, recipientID)
+	return err
+}
+
+// GetLocaleStats counts a campaign's recipients and their engagement by
+// the locale they were sent. Recipients not rendered yet count under their
+// contact's locale, or the user's default when they have none.
+func (r *campaignRepository) GetLocaleStats(id uint64, userID uint64) ([]types.CampaignLocaleStats, error) {
+	rows, err := r.db.Query(`SELECT COALESCE(cr.locale, ct.locale, s.default_locale, 'en') AS locale,
+	                                COUNT(*),
+	                                COALESCE(SUM(cr.sent_at IS NOT NULL), 0),
+	                                COALESCE(SUM(cr.delivered_at IS NOT NULL), 0),
+	                                COALESCE(SUM(cr.opened_at IS NOT NULL), 0),
+	                                COALESCE(SUM(cr.clicked_at IS NOT NULL), 0),
+	                                COALESCE(SUM(cr.bounced_at IS NOT NULL), 0),
+	                                COALESCE(SUM(cr.unsubscribed_at IS NOT NULL), 0)
+	                         FROM campaign_recipients cr
+	                         JOIN campaigns c ON cr.campaign_id = c.id
+	                         JOIN contacts ct ON cr.contact_id = ct.id
+	                         LEFT JOIN user_settings s ON s.user_id = c.user_id
+	                         WHERE c.id = ? AND c.user_id = ? AND c.is_deleted = 0
+	                         GROUP BY locale
+	                         ORDER BY COUNT(*) DESC, locale`, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []types.CampaignLocaleStats{}
+	for rows.Next() {
+		var l types.CampaignLocaleStats
+		if err := rows.Scan(&l.Locale, &l.Recipients, &l.SentCount, &l.DeliveredCount, &l.OpenedCount,
+			&l.ClickedCount, &l.BouncedCount, &l.UnsubscribedCount); err != nil {
+			return nil, err
+		}
+		stats = append(stats, l)
+	}
+	return stats, rows.Err()
+}
+
+// GetCampaignUTM returns the campaign's UTM overrides together with the
+// owner's defaults they apply to.
+func (r *campaignRepository) GetCampaignUTM(id uint64, userID uint64) (*types.CampaignUTM, *types.UTMSettings, error) {
+	var enabled sql.NullBool
+	var source, medium, campaign, content sql.NullString
+	defaults := &types.UTMSettings{}
+
+	err := r.db.QueryRow(`SELECT c.utm_enabled, c.utm_source, c.utm_medium, c.utm_campaign, c.utm_content,
+	                             COALESCE(s.utm_enabled, 0), COALESCE(s.utm_source, ''), COALESCE(s.utm_medium, ''),
+	                             COALESCE(s.utm_campaign, ''), COALESCE(s.utm_content, '')
+	                      FROM campaigns c
+	                      LEFT JOIN user_settings s ON s.user_id = c.user_id
+	                      WHERE c.id = ? AND c.user_id = ? AND c.is_deleted = 0`, id, userID).Scan(
+		&enabled, &source, &medium, &campaign, &content,
+		&defaults.Enabled, &defaults.Source, &defaults.Medium, &defaults.Campaign, &defaults.Content,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	utm := &types.CampaignUTM{}
+	if enabled.Valid {
+		utm.Enabled = &enabled.Bool
+	}
+	for _, f := range []struct {
+		dst **string
+		src sql.NullString
+	}{{&utm.Source, source}, {&utm.Medium, medium}, {&utm.Campaign, campaign}, {&utm.Content, content}} {
+		if f.src.Valid {
+			v := f.src.String
+			*f.dst = &v
+		}
+	}
+	return utm, defaults, nil
+}
+
+func (r *campaignRepository) UpdateCampaignUTM(id uint64, userID uint64, utm *types.CampaignUTM) error {
+	_, err := r.db.Exec(`UPDATE campaigns SET utm_enabled = ?, utm_source = ?, utm_medium = ?, utm_campaign = ?, utm_content = ?, updated_at = NOW()
+	                     WHERE id = ? AND user_id = ? AND is_deleted = 0`,
+		utm.Enabled, utm.Source, utm.Medium, utm.Campaign, utm.Content, id, userID)
+	return err
+}
+
+// RegisterLink records a URL that appears in a campaign's content and
+// returns its ID, reusing the existing row when the URL is already known.
+func (r *campaignRepository) RegisterLink(campaignID uint64, url string) (uint64, error) {
+	sum := sha256.Sum256([]byte(url))
+	res, err := r.db.Exec(`INSERT INTO campaign_links (campaign_id, url, url_hash) VALUES (?, ?, ?)
+	                       ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`,
+		campaignID, url, hex.EncodeToString(sum[:]))
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(id), nil
+}
+
+// GetLinkURL returns the destination of a registered link. Click redirects
+// only ever go to URLs found here.
+func (r *campaignRepository) GetLinkURL(campaignID uint64, linkID uint64) (string, error) {
+	var url string
+	err := r.db.QueryRow(`SELECT url FROM campaign_links WHERE id = ? AND campaign_id = ?`, linkID, campaignID).Scan(&url)
+	return url, err
 }
 
 func (r *campaignRepository) UpdateRecipientStatus(campaignID, contactID uint64, status string, errorMessage string, bounceType string) error {
@@ -431,3 +852,248 @@ func (r *campaignRepository) UpdateRecipientStatus(campaignID, contactID uint64,
 
 	return nil
 }
+
+// FindRecipientForEvent correlates a provider event with the recipient row
+// it belongs to. The Message-ID is authoritative; when it matches no row,
+// as for messages sent before Message-IDs were stored or relayed under a
+// provider's own ID, the recipient address falls back to the most recent
+// send to that contact.
+func (r *campaignRepository) FindRecipientForEvent(userID uint64, messageID string, email string) (*types.CampaignRecipientDTO, error) {
+	query := `SELECT cr.id, cr.campaign_id, cr.contact_id, cr.status, cr.delivered_at
+	          FROM campaign_recipients cr
+	          JOIN campaigns c ON cr.campaign_id = c.id
+	          JOIN contacts ct ON cr.contact_id = ct.id
+	          WHERE c.user_id = ?`
+
+	if id := strings.Trim(strings.TrimSpace(messageID), "<>"); id != "" {
+		rec, err := r.scanEventRecipient(query+" AND cr.message_id IN (?, ?) ORDER BY cr.sent_at DESC, cr.id DESC LIMIT 1",
+			userID, id, "<"+id+">")
+		if err != sql.ErrNoRows {
+			return rec, err
+		}
+	}
+	if email == "" {
+		return nil, sql.ErrNoRows
+	}
+	return r.scanEventRecipient(query+" AND ct.email = ? ORDER BY cr.sent_at DESC, cr.id DESC LIMIT 1", userID, email)
+}
+
+// GetRecipientForEvent loads a recipient by ID, as decoded from a VERP
+// return path.
+func (r *campaignRepository) GetRecipientForEvent(recipientID uint64) (*types.CampaignRecipientDTO, error) {
+	query := `SELECT cr.id, cr.campaign_id, cr.contact_id, cr.status, cr.delivered_at
+	          FROM campaign_recipients cr
+	          WHERE cr.id = ?`
+	return r.scanEventRecipient(query, recipientID)
+}
+
+// FindRecipientByMessageID matches a Message-ID across all users. It is used
+// for inbound bounce reports, which arrive at a shared return path.
+func (r *campaignRepository) FindRecipientByMessageID(messageID string) (*types.CampaignRecipientDTO, error) {
+	id := strings.Trim(strings.TrimSpace(messageID), "<>")
+	if id == "" {
+		return nil, sql.ErrNoRows
+	}
+	query := `SELECT cr.id, cr.campaign_id, cr.contact_id, cr.status, cr.delivered_at
+	          FROM campaign_recipients cr
+	          WHERE cr.message_id IN (?, ?)
+	          ORDER BY cr.id DESC LIMIT 1`
+	return r.scanEventRecipient(query, id, "<"+id+">")
+}
+
+func (r *campaignRepository) scanEventRecipient(query string, args ...interface{}) (*types.CampaignRecipientDTO, error) {
+	var rcpt types.CampaignRecipientDTO
+	var deliveredAt sql.NullTime
+	err := r.db.QueryRow(query, args...).Scan(&rcpt.ID, &rcpt.CampaignID, &rcpt.ContactID, &rcpt.Status, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if deliveredAt.Valid {
+		rcpt.DeliveredAt = &deliveredAt.Time
+	}
+	return &rcpt, nil
+}
+
+// ApplyDeliveryEvent records a normalized bounce, complaint or delivery and
+// updates the recipient, contact and campaign counters in one transaction.
+// Providers retry deliveries, so an event already recorded for the
+// recipient, with the same type and timestamp, changes nothing.
+func (r *campaignRepository) ApplyDeliveryEvent(recipient *types.CampaignRecipientDTO, event *types.DeliveryEvent) error {
+	at := event.Timestamp
+	var key interface{}
+	if at.IsZero() {
+		at = time.Now()
+	} else {
+		key = at.UTC().Format(time.RFC3339Nano)
+	}
+
+	var eventType string
+	switch event.Type {
+	case types.DeliveryEventBounce:
+		eventType = "bounced"
+	case types.DeliveryEventComplaint:
+		eventType = "complained"
+	case types.DeliveryEventDelivery:
+		eventType = "delivered"
+	default:
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The recipient's state is read under a lock, so concurrent events
+	// for it count once.
+	var status string
+	var deliveredAt sql.NullTime
+	err = tx.QueryRow(`SELECT status, delivered_at FROM campaign_recipients WHERE id = ? FOR UPDATE`, recipient.ID).Scan(&status, &deliveredAt)
+	if err != nil {
+		return err
+	}
+
+	var eventData interface{}
+	if len(event.Raw) > 0 {
+		eventData = []byte(event.Raw)
+	}
+	_, err = tx.Exec(`INSERT INTO email_events (campaign_recipient_id, event_type, delivery_key, event_data, created_at) VALUES (?, ?, ?, ?, ?)`,
+		recipient.ID, eventType, key, eventData, at)
+	if duplicateKey(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case types.DeliveryEventBounce:
+		_, err = tx.Exec(`UPDATE campaign_recipients SET status = 'bounced', bounced_at = ?, bounce_type = ?, error_message = ?, updated_at = NOW() WHERE id = ?`,
+			at, event.BounceType, event.Reason, recipient.ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE contacts SET bounce_count = bounce_count + 1, is_bounced = (is_bounced OR ? OR bounce_count >= ?), updated_at = NOW() WHERE id = ?`,
+			event.BounceType == types.BounceTypeHard, softBounceLimit, recipient.ContactID)
+		if err != nil {
+			return err
+		}
+		if status != "bounced" {
+			_, err = tx.Exec(`UPDATE campaigns SET bounced_count = bounced_count + 1 WHERE id = ?`, recipient.CampaignID)
+		}
+	case types.DeliveryEventComplaint:
+		_, err = tx.Exec(`UPDATE campaign_recipients SET status = 'unsubscribed', unsubscribed_at = IFNULL(unsubscribed_at, ?), bounce_type = 'complaint', updated_at = NOW() WHERE id = ?`,
+			at, recipient.ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE contacts SET is_subscribed = FALSE, updated_at = NOW() WHERE id = ?`, recipient.ContactID)
+		if err != nil {
+			return err
+		}
+		if status != "unsubscribed" {
+			_, err = tx.Exec(`UPDATE campaigns SET unsubscribed_count = unsubscribed_count + 1 WHERE id = ?`, recipient.CampaignID)
+		}
+	case types.DeliveryEventDelivery:
+		_, err = tx.Exec(`UPDATE campaign_recipients SET delivered_at = IFNULL(delivered_at, ?),
+		                  status = IF(status IN ('pending', 'sending', 'sent'), 'delivered', status), updated_at = NOW() WHERE id = ?`,
+			at, recipient.ID)
+		if err != nil {
+			return err
+		}
+		if !deliveredAt.Valid {
+			_, err = tx.Exec(`UPDATE campaigns SET delivered_count = delivered_count + 1 WHERE id = ?`, recipient.CampaignID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const linkStatsQuery = `SELECT l.id, l.url, COUNT(e.id), COUNT(DISTINCT e.campaign_recipient_id), MIN(e.created_at), MAX(e.created_at)
+	FROM campaign_links l
+	JOIN campaigns c ON l.campaign_id = c.id
+	LEFT JOIN email_events e ON e.campaign_link_id = l.id AND e.event_type = 'clicked'
+	WHERE l.campaign_id = ? AND c.user_id = ? AND c.is_deleted = 0`
+
+func scanLinkStats(scanner interface{ Scan(...interface{}) error }) (*types.CampaignLinkStats, error) {
+	var l types.CampaignLinkStats
+	var firstAt, lastAt sql.NullTime
+	if err := scanner.Scan(&l.ID, &l.URL, &l.Clicks, &l.UniqueClickers, &firstAt, &lastAt); err != nil {
+		return nil, err
+	}
+	if firstAt.Valid {
+		l.FirstClickedAt = &firstAt.Time
+	}
+	if lastAt.Valid {
+		l.LastClickedAt = &lastAt.Time
+	}
+	return &l, nil
+}
+
+func (r *campaignRepository) GetLinkStats(campaignID uint64, userID uint64) ([]types.CampaignLinkStats, error) {
+	query := linkStatsQuery + " GROUP BY l.id, l.url ORDER BY COUNT(e.id) DESC, l.id ASC"
+
+	rows, err := r.db.Query(query, campaignID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []types.CampaignLinkStats{}
+	for rows.Next() {
+		l, err := scanLinkStats(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *l)
+	}
+	return links, rows.Err()
+}
+
+func (r *campaignRepository) GetLinkClickers(campaignID uint64, linkID uint64, userID uint64, page, limit int) (*types.CampaignLinkDetail, error) {
+	stats, err := scanLinkStats(r.db.QueryRow(linkStatsQuery+" AND l.id = ? GROUP BY l.id, l.url", campaignID, userID, linkID))
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT cr.id, ct.id, ct.email, ct.first_name, ct.last_name, COUNT(e.id), MIN(e.created_at), MAX(e.created_at)
+	          FROM email_events e
+	          JOIN campaign_recipients cr ON e.campaign_recipient_id = cr.id
+	          JOIN contacts ct ON cr.contact_id = ct.id
+	          WHERE e.campaign_link_id = ? AND e.event_type = 'clicked'
+	          GROUP BY cr.id, ct.id, ct.email, ct.first_name, ct.last_name
+	          ORDER BY MIN(e.created_at) ASC`
+	args := []interface{}{linkID}
+
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+		if page > 0 {
+			query += " OFFSET ?"
+			args = append(args, (page-1)*limit)
+		}
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	detail := &types.CampaignLinkDetail{CampaignLinkStats: *stats, Clickers: []types.LinkClickerDTO{}}
+	for rows.Next() {
+		var c types.LinkClickerDTO
+		var firstName, lastName sql.NullString
+		if err := rows.Scan(&c.RecipientID, &c.ContactID, &c.Email, &firstName, &lastName, &c.Clicks, &c.FirstClickedAt, &c.LastClickedAt); err != nil {
+			return nil, err
+		}
+		c.FirstName = firstName.String
+		c.LastName = lastName.String
+		detail.Clickers = append(detail.Clickers, c)
+	}
+	return detail, rows.Err()
+}
@@ -5,7 +5,6 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strings"
 
 	"email_campaign/internal/types"
@@ -24,6 +23,9 @@ type ContactRepository interface {
 	BulkCreateContacts(userID uint64, contacts []types.CreateContactRequest) error
 	BulkUpdateContacts(userID uint64, req *types.BulkUpdateContactsRequest) error
 	BulkDeleteContacts(userID uint64, contactIDs []uint64) error
+	UpsertImportedContacts(userID uint64, contacts []types.ImportedContact) ([]types.ImportOutcome, int, error)
+	ExistingEmails(userID uint64, emails []string) (map[string]bool, error)
+	StreamContacts(ctx context.Context, filter *types.ContactFilter, withTags bool, fn func(*types.ContactExportRow) error) error
 }
 
 type contactRepository struct {
@@ -53,10 +55,10 @@ func (r *contactRepository) CreateContact(contact *types.CreateContactRequest) e
 	}
 
 	// Insert contact
-	query := `INSERT INTO contacts (user_id, email, first_name, last_name, phone, company, is_subscribed, custom_fields, created_at, updated_at) 
-              VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
+	query := `INSERT INTO contacts (user_id, email, first_name, last_name, phone, company, locale, is_subscribed, custom_fields, created_at, updated_at) 
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
 
-	res, err := tx.Exec(query, contact.UserID, contact.Email, contact.FirstName, contact.LastName, contact.Phone, contact.Company, contact.IsSubscribed, contact.CustomFields)
+	res, err := tx.Exec(query, contact.UserID, contact.Email, contact.FirstName, contact.LastName, contact.Phone, contact.Company, nullString(contact.Locale), contact.IsSubscribed, contact.CustomFields)
 	if err != nil {
 		return err
 	}
@@ -88,7 +90,7 @@ func (r *contactRepository) CreateContact(contact *types.CreateContactRequest) e
 
 func (r *contactRepository) GetContact(id uint64, userId uint64) (*types.ContactDTO, error) {
 
-	baseQuery := `SELECT id, user_id, email, first_name, last_name,COALESCE(phone, '') as phone,COALESCE(company, '') as company, is_subscribed, is_bounced, bounce_count, created_at, updated_at, last_contacted_at FROM contacts WHERE id = ? AND user_id = ?`
+	baseQuery := `SELECT id, user_id, email, first_name, last_name,COALESCE(phone, '') as phone,COALESCE(company, '') as company, COALESCE(locale, ''), is_subscribed, is_bounced, bounce_count, created_at, updated_at, last_contacted_at FROM contacts WHERE id = ? AND user_id = ?`
 	//get tags as well
 
 	args := []interface{}{id, userId}
@@ -97,7 +99,7 @@ func (r *contactRepository) GetContact(id uint64, userId uint64) (*types.Contact
 	var contact types.ContactDTO
 	if err := row.Scan(
 		&contact.ID, &contact.UserID, &contact.Email, &contact.FirstName, &contact.LastName,
-		&contact.Phone, &contact.Company, &contact.IsSubscribed, &contact.IsBounced,
+		&contact.Phone, &contact.Company, &contact.Locale, &contact.IsSubscribed, &contact.IsBounced,
 		&contact.BounceCount, &contact.CreatedAt, &contact.UpdatedAt,
 		&contact.LastContactedAt,
 	); err != nil {
@@ -106,78 +108,123 @@ func (r *contactRepository) GetContact(id uint64, userId uint64) (*types.Contact
 	return &contact, nil
 }
 
-func (r *contactRepository) ListContacts(ctx context.Context, filter *types.ContactFilter) ([]types.ContactListDTO, int64, error) {
-	baseQuery := `SELECT id, email, CONCAT(first_name, ' ', last_name) as name, '' as campaign, 
-                  created_at, updated_at 
-                  FROM contacts WHERE user_id = ? AND deleted_at IS NULL AND is_deleted = 0`
-	args := []interface{}{filter.UserID}
-	// Define allowed filter fields and their database column mappings
-	allowedFields := map[string]string{
-		"email":         "email",
-		"first_name":    "first_name",
-		"last_name":     "last_name",
-		"company":       "company",
-		"created_at":    "created_at",
-		"updated_at":    "updated_at",
-		"is_subscribed": "is_subscribed",
-		"is_bounced":    "is_bounced",
-		"tags":          "tag_id",
-	}
-	// Build dynamic filter conditions
-	if len(filter.Filters) > 0 {
-		fb := utils.NewFilterBuilder()
-
-		// Separate tag filters from regular filters
-		regularFilters := []types.FilterField{}
-		tagFilters := []types.FilterField{}
-
-		for _, f := range filter.Filters {
-			if f.Id == "tags" {
-				tagFilters = append(tagFilters, f)
-			} else {
-				regularFilters = append(regularFilters, f)
-			}
+// contactFilterFields maps the filterable fields to their columns. Tags
+// are filtered by tag ID.
+var contactFilterFields = map[string]string{
+	"email":         "email",
+	"first_name":    "first_name",
+	"last_name":     "last_name",
+	"company":       "company",
+	"created_at":    "created_at",
+	"updated_at":    "updated_at",
+	"is_subscribed": "is_subscribed",
+	"is_bounced":    "is_bounced",
+}
+
+var contactSearchFields = []string{"email", "first_name", "last_name", "company"}
+
+// customFieldColumn is the typed column for "custom.<key>" when the
+// filter's custom fields define key.
+func customFieldColumn(filter *types.ContactFilter, id string) (string, bool) {
+	key, ok := strings.CutPrefix(id, "custom.")
+	if !ok {
+		return "", false
+	}
+	for _, f := range filter.CustomFields {
+		if f.Key == key {
+			return utils.CustomFieldColumn("custom_fields", key, f.Type), true
 		}
-		// Handle tag filters with JOIN
-		if len(tagFilters) > 0 {
-			baseQuery = `SELECT DISTINCT c.id, c.email, CONCAT(c.first_name, ' ', c.last_name) as name, '' as campaign, 
-                        c.created_at, c.updated_at 
-                        FROM contacts c 
-                        JOIN contact_tags ct ON c.id = ct.contact_id 
-                        WHERE c.user_id = ?`
-
-			tagCondition, tagArgs, err := fb.BuildFilterConditions(tagFilters, filter.JoinOperator, allowedFields)
-			if err != nil {
-				return nil, 0, err
-			}
-			if tagCondition != "" {
-				baseQuery += " AND " + tagCondition
-				args = append(args, tagArgs...)
+	}
+	return "", false
+}
+
+// contactFilterConditions builds the WHERE condition for a contact list's
+// filters, joined by its join operator. A tag filter matches contacts by
+// the tags they have, so "ne" and "notInArray" match contacts without the
+// tags. Defined custom fields are filtered as "custom.<key>", compared as
+// their type.
+func contactFilterConditions(filter *types.ContactFilter) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	for _, f := range filter.Filters {
+		if f.Id != "tags" {
+			fields := contactFilterFields
+			if column, ok := customFieldColumn(filter, f.Id); ok {
+				if f.Operator == "isEmpty" || f.Operator == "isNotEmpty" {
+					// Compared as a number or date, "" would match 0.
+					column = utils.CustomFieldColumn("custom_fields", strings.TrimPrefix(f.Id, "custom."), "")
+				}
+				fields = map[string]string{f.Id: column}
 			}
-		}
-		// Handle regular filters
-		log.Println(regularFilters)
-		if len(regularFilters) > 0 {
-			condition, filterArgs, err := fb.BuildFilterConditions(regularFilters, filter.JoinOperator, allowedFields)
-			log.Println(condition)
-			log.Println(filterArgs)
+			cond, fargs, err := utils.NewFilterBuilder().BuildFilterConditions([]types.FilterField{f}, "and", fields)
 			if err != nil {
-				return nil, 0, err
+				return "", nil, err
 			}
-			if condition != "" {
-				baseQuery += " AND " + condition
-				args = append(args, filterArgs...)
+			if cond != "" {
+				conditions = append(conditions, cond)
+				args = append(args, fargs...)
 			}
+			continue
+		}
+
+		exists := "EXISTS"
+		switch f.Operator {
+		case "ne":
+			exists, f.Operator = "NOT EXISTS", "eq"
+		case "notInArray":
+			exists, f.Operator = "NOT EXISTS", "inArray"
+		case "isEmpty":
+			conditions = append(conditions, "NOT EXISTS (SELECT 1 FROM contact_tags ct WHERE ct.contact_id = contacts.id)")
+			continue
+		case "isNotEmpty":
+			conditions = append(conditions, "EXISTS (SELECT 1 FROM contact_tags ct WHERE ct.contact_id = contacts.id)")
+			continue
+		}
+		cond, fargs, err := utils.NewFilterBuilder().BuildFilterConditions([]types.FilterField{f}, "and", map[string]string{"tags": "ct.tag_id"})
+		if err != nil {
+			return "", nil, err
 		}
+		if cond != "" {
+			conditions = append(conditions, exists+" (SELECT 1 FROM contact_tags ct WHERE ct.contact_id = contacts.id AND "+cond+")")
+			args = append(args, fargs...)
+		}
+	}
+	if len(conditions) == 0 {
+		return "", nil, nil
+	}
+	operator := " AND "
+	if strings.EqualFold(filter.JoinOperator, "or") {
+		operator = " OR "
+	}
+	return "(" + strings.Join(conditions, operator) + ")", args, nil
+}
+
+func (r *contactRepository) ListContacts(ctx context.Context, filter *types.ContactFilter) ([]types.ContactListDTO, int64, error) {
+	baseQuery := `SELECT id, email, CONCAT(first_name, ' ', last_name) as name, '' as campaign, 
+                  created_at, updated_at 
+                  FROM contacts WHERE user_id = ? AND deleted_at IS NULL AND is_deleted = 0`
+	args := []interface{}{filter.UserID}
+	condition, filterArgs, err := contactFilterConditions(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if condition != "" {
+		baseQuery += " AND " + condition
+		args = append(args, filterArgs...)
 	}
 	// Use existing paginator for search, sorting, and pagination
-	paginator := utils.NewPaginator(filter.Page, filter.Limit, filter.SortBy, filter.SortOrder, filter.Search)
+	sortBy := filter.SortBy
 	allowedSortFields := []string{"created_at", "updated_at", "email", "first_name", "last_name", "company"}
-	searchFields := []string{"email", "first_name", "last_name", "company"}
+	if column, ok := customFieldColumn(filter, sortBy); ok {
+		sortBy = column
+		allowedSortFields = append(allowedSortFields, column)
+	}
+	paginator := utils.NewPaginator(filter.Page, filter.Limit, sortBy, filter.SortOrder, filter.Search)
+	searchFields := contactSearchFields
 	// Build count query
 	countQuery, countArgs := paginator.BuildCountQuery(baseQuery, args, searchFields)
 	var total int64
-	err := r.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&total)
+	err = r.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -244,6 +291,10 @@ func (r *contactRepository) UpdateContact(contactID uint64, userID uint64, req *
 		query += ", company = ?"
 		args = append(args, req.Company)
 	}
+	if req.Locale != nil {
+		query += ", locale = ?"
+		args = append(args, nullString(*req.Locale))
+	}
 	if req.IsSubscribed != nil {
 		query += ", is_subscribed = ?"
 		args = append(args, *req.IsSubscribed)
@@ -303,12 +354,12 @@ func (r *contactRepository) DeleteContact(contactID uint64, userID uint64) error
 }
 
 func (r *contactRepository) GetContactByEmail(email string, userID uint64) (*types.ContactDTO, error) {
-	query := `SELECT id, user_id, email, first_name, last_name, phone, company, is_subscribed, is_bounced, bounce_count, custom_fields, created_at, updated_at, last_contacted_at FROM contacts WHERE email = ? AND user_id = ?`
+	query := `SELECT id, user_id, email, first_name, last_name, phone, company, COALESCE(locale, ''), is_subscribed, is_bounced, bounce_count, custom_fields, created_at, updated_at, last_contacted_at FROM contacts WHERE email = ? AND user_id = ?`
 	var contact types.ContactDTO
 	var customFields []byte
 	err := r.db.QueryRow(query, email, userID).Scan(
 		&contact.ID, &contact.UserID, &contact.Email, &contact.FirstName, &contact.LastName,
-		&contact.Phone, &contact.Company, &contact.IsSubscribed, &contact.IsBounced,
+		&contact.Phone, &contact.Company, &contact.Locale, &contact.IsSubscribed, &contact.IsBounced,
 		&contact.BounceCount, &customFields, &contact.CreatedAt, &contact.UpdatedAt,
 		&contact.LastContactedAt,
 	)
@@ -381,8 +432,8 @@ func (r *contactRepository) BulkCreateContacts(userID uint64, contacts []types.C
 	defer tx.Rollback()
 
 	// Prepare statement for bulk insert
-	query := `INSERT INTO contacts (user_id, email, first_name, last_name, phone, company, is_subscribed, custom_fields, created_at, updated_at) 
-              VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW()) ON DUPLICATE KEY UPDATE updated_at = NOW()`
+	query := `INSERT INTO contacts (user_id, email, first_name, last_name, phone, company, locale, is_subscribed, custom_fields, created_at, updated_at) 
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW()) ON DUPLICATE KEY UPDATE updated_at = NOW()`
 
 	stmt, err := tx.Prepare(query)
 	if err != nil {
@@ -398,7 +449,7 @@ func (r *contactRepository) BulkCreateContacts(userID uint64, contacts []types.C
 	defer tagStmt.Close()
 
 	for _, c := range contacts {
-		res, err := stmt.Exec(userID, c.Email, c.FirstName, c.LastName, c.Phone, c.Company, c.IsSubscribed, c.CustomFields)
+		res, err := stmt.Exec(userID, c.Email, c.FirstName, c.LastName, c.Phone, c.Company, nullString(c.Locale), c.IsSubscribed, c.CustomFields)
 		if err != nil {
 			return err
 		}
@@ -485,3 +536,205 @@ func (r *contactRepository) BulkDeleteContacts(userID uint64, contactIDs []uint6
 	_, err := r.db.Exec(query, args...)
 	return err
 }
+
+// UpsertImportedContacts adds contacts, or merges them into the user's
+// contacts of the same email in one transaction. Empty values do not
+// replace stored ones, custom fields are merged key by key, and an
+// unsubscribed or bounced contact stays so. Deleted contacts are restored.
+// It returns what happened to each contact and how many tags were newly
+// assigned.
+func (r *contactRepository) UpsertImportedContacts(userID uint64, contacts []types.ImportedContact) ([]types.ImportOutcome, int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	// Assignments run in order, so is_deleted is cleared last.
+	query := `INSERT INTO contacts (user_id, email, first_name, last_name, phone, company, locale, is_subscribed, is_bounced, custom_fields, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
+              ON DUPLICATE KEY UPDATE
+                  id = LAST_INSERT_ID(id),
+                  first_name = COALESCE(NULLIF(VALUES(first_name), ''), first_name),
+                  last_name = COALESCE(NULLIF(VALUES(last_name), ''), last_name),
+                  phone = COALESCE(VALUES(phone), phone),
+                  company = COALESCE(VALUES(company), company),
+                  locale = COALESCE(VALUES(locale), locale),
+                  is_subscribed = is_subscribed AND VALUES(is_subscribed),
+                  is_bounced = is_bounced OR VALUES(is_bounced),
+                  custom_fields = JSON_MERGE_PATCH(COALESCE(custom_fields, JSON_OBJECT()), VALUES(custom_fields)),
+                  is_deleted = 0,
+                  deleted_at = NULL`
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer stmt.Close()
+
+	tagStmt, err := tx.Prepare(`INSERT IGNORE INTO contact_tags (contact_id, tag_id) VALUES (?, ?)`)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tagStmt.Close()
+
+	outcomes := make([]types.ImportOutcome, len(contacts))
+	tagged := 0
+	for i, c := range contacts {
+		custom := c.CustomFields
+		if custom == nil {
+			custom = map[string]interface{}{}
+		}
+		customJSON, err := json.Marshal(custom)
+		if err != nil {
+			return nil, 0, err
+		}
+		res, err := stmt.Exec(userID, c.Email, c.FirstName, c.LastName, nullString(c.Phone), nullString(c.Company),
+			nullString(c.Locale), c.IsSubscribed, c.IsBounced, customJSON)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", c.Email, err)
+		}
+		contactID, err := res.LastInsertId()
+		if err != nil {
+			return nil, 0, err
+		}
+		switch n, _ := res.RowsAffected(); n {
+		case 1:
+			outcomes[i] = types.ImportCreated
+		case 0:
+			outcomes[i] = types.ImportUnchanged
+		default:
+			outcomes[i] = types.ImportUpdated
+		}
+
+		for _, tagID := range c.TagIDs {
+			res, err := tagStmt.Exec(contactID, tagID)
+			if err != nil {
+				return nil, 0, err
+			}
+			n, _ := res.RowsAffected()
+			tagged += int(n)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return outcomes, tagged, nil
+}
+
+// ExistingEmails reports which of emails belong to the user's contacts.
+// Deleted contacts do not count.
+func (r *contactRepository) ExistingEmails(userID uint64, emails []string) (map[string]bool, error) {
+	found := map[string]bool{}
+	if len(emails) == 0 {
+		return found, nil
+	}
+	placeholders := make([]string, len(emails))
+	args := []interface{}{userID}
+	for i, email := range emails {
+		placeholders[i] = "?"
+		args = append(args, email)
+	}
+	query := fmt.Sprintf("SELECT email FROM contacts WHERE user_id = ? AND is_deleted = 0 AND email IN (%s)", strings.Join(placeholders, ","))
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		found[strings.ToLower(email)] = true
+	}
+	return found, rows.Err()
+}
+
+// streamChunkSize is how many contacts StreamContacts reads per query.
+const streamChunkSize = 1000
+
+// StreamContacts calls fn for each contact matching the filter and
+// search, in ID order. Contacts are read a chunk at a time, each chunk
+// starting after the last ID of the one before, so no query stays open for
+// the whole export. Tags are read only if withTags is set.
+func (r *contactRepository) StreamContacts(ctx context.Context, filter *types.ContactFilter, withTags bool, fn func(*types.ContactExportRow) error) error {
+	tags := "NULL"
+	if withTags {
+		tags = `(SELECT JSON_ARRAYAGG(t.name) FROM contact_tags ct JOIN tags t ON t.id = ct.tag_id
+                 WHERE ct.contact_id = contacts.id AND t.is_deleted = 0)`
+	}
+	query := `SELECT id, email, COALESCE(first_name, ''), COALESCE(last_name, ''), COALESCE(phone, ''), COALESCE(company, ''),
+                     COALESCE(locale, ''), is_subscribed, is_bounced, custom_fields, ` + tags + `, created_at, updated_at
+              FROM contacts WHERE user_id = ? AND deleted_at IS NULL AND is_deleted = 0 AND id > ?`
+	var where []interface{}
+	condition, filterArgs, err := contactFilterConditions(filter)
+	if err != nil {
+		return err
+	}
+	if condition != "" {
+		query += " AND " + condition
+		where = append(where, filterArgs...)
+	}
+	if filter.Search != "" {
+		clauses := make([]string, len(contactSearchFields))
+		for i, f := range contactSearchFields {
+			clauses[i] = f + " LIKE ?"
+			where = append(where, "%"+filter.Search+"%")
+		}
+		query += " AND (" + strings.Join(clauses, " OR ") + ")"
+	}
+	query += " ORDER BY id LIMIT ?"
+
+	var lastID uint64
+	for {
+		args := append([]interface{}{filter.UserID, lastID}, where...)
+		n, err := r.streamChunk(ctx, query, append(args, streamChunkSize), &lastID, fn)
+		if err != nil || n < streamChunkSize {
+			return err
+		}
+	}
+}
+
+func (r *contactRepository) streamChunk(ctx context.Context, query string, args []interface{}, lastID *uint64, fn func(*types.ContactExportRow) error) (int, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var c types.ContactExportRow
+		var customFields, tags []byte
+		if err := rows.Scan(&c.ID, &c.Email, &c.FirstName, &c.LastName, &c.Phone, &c.Company, &c.Locale,
+			&c.IsSubscribed, &c.IsBounced, &customFields, &tags, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return n, err
+		}
+		if len(customFields) > 0 {
+			if err := json.Unmarshal(customFields, &c.CustomFields); err != nil {
+				return n, err
+			}
+		}
+		if len(tags) > 0 {
+			if err := json.Unmarshal(tags, &c.Tags); err != nil {
+				return n, err
+			}
+		}
+		if err := fn(&c); err != nil {
+			return n, err
+		}
+		*lastID = c.ID
+		n++
+	}
+	return n, rows.Err()
+}
+
+// nullString stores an empty string as NULL.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"database/sql"
+	"email_campaign/internal/types"
+	"encoding/json"
+)
+
+type CustomFieldRepository interface {
+	CreateField(field *types.CustomField) error
+	GetField(id uint64, userID uint64) (*types.CustomField, error)
+	ListFields(userID uint64) ([]types.CustomField, error)
+	UpdateField(field *types.CustomField) error
+	DeleteField(id uint64, userID uint64) error
+	FieldKeyTaken(userID uint64, key string) (bool, error)
+}
+
+type customFieldRepository struct {
+	db *sql.DB
+}
+
+func NewCustomFieldRepository(db *sql.DB) CustomFieldRepository {
+	return &customFieldRepository{db: db}
+}
+
+const customFieldColumns = `id, user_id, field_key, label, type, required, default_value, options, sort_order, created_at, updated_at`
+
+func scanCustomField(row interface{ Scan(...interface{}) error }) (*types.CustomField, error) {
+	var f types.CustomField
+	var def, options []byte
+	if err := row.Scan(&f.ID, &f.UserID, &f.Key, &f.Label, &f.Type, &f.Required, &def, &options, &f.SortOrder, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if len(def) > 0 {
+		if err := json.Unmarshal(def, &f.Default); err != nil {
+			return nil, err
+		}
+	}
+	if len(options) > 0 {
+		if err := json.Unmarshal(options, &f.Options); err != nil {
+			return nil, err
+		}
+	}
+	return &f, nil
+}
+
+// fieldJSON is a field's default and options as stored.
+func fieldJSON(field *types.CustomField) (def, options interface{}, err error) {
+	if field.Default != nil {
+		b, err := json.Marshal(field.Default)
+		if err != nil {
+			return nil, nil, err
+		}
+		def = string(b)
+	}
+	if len(field.Options) > 0 {
+		b, err := json.Marshal(field.Options)
+		if err != nil {
+			return nil, nil, err
+		}
+		options = string(b)
+	}
+	return def, options, nil
+}
+
+func (r *customFieldRepository) CreateField(field *types.CustomField) error {
+	def, options, err := fieldJSON(field)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO contact_custom_fields (user_id, field_key, label, type, required, default_value, options, sort_order, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
+	res, err := r.db.Exec(query, field.UserID, field.Key, field.Label, field.Type, field.Required, def, options, field.SortOrder)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	field.ID = uint64(id)
+	return nil
+}
+
+func (r *customFieldRepository) GetField(id uint64, userID uint64) (*types.CustomField, error) {
+	return scanCustomField(r.db.QueryRow(`SELECT `+customFieldColumns+` FROM contact_custom_fields WHERE id = ? AND user_id = ?`, id, userID))
+}
+
+func (r *customFieldRepository) ListFields(userID uint64) ([]types.CustomField, error) {
+	rows, err := r.db.Query(`SELECT `+customFieldColumns+` FROM contact_custom_fields WHERE user_id = ? ORDER BY sort_order, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	fields := []types.CustomField{}
+	for rows.Next() {
+		f, err := scanCustomField(rows)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, *f)
+	}
+	return fields, rows.Err()
+}
+
+func (r *customFieldRepository) UpdateField(field *types.CustomField) error {
+	def, options, err := fieldJSON(field)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE contact_custom_fields SET label = ?, type = ?, required = ?, default_value = ?, options = ?, sort_order = ?, updated_at = NOW()
+              WHERE id = ? AND user_id = ?`
+	_, err = r.db.Exec(query, field.Label, field.Type, field.Required, def, options, field.SortOrder, field.ID, field.UserID)
+	return err
+}
+
+func (r *customFieldRepository) DeleteField(id uint64, userID uint64) error {
+	res, err := r.db.Exec(`DELETE FROM contact_custom_fields WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *customFieldRepository) FieldKeyTaken(userID uint64, key string) (bool, error) {
+	var taken bool
+	err := r.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM contact_custom_fields WHERE user_id = ? AND field_key = ?)`, userID, key).Scan(&taken)
+	return taken, err
+}
@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"database/sql"
+	"email_campaign/internal/types"
+	"encoding/json"
+	"time"
+)
+
+type ImportRepository interface {
+	CreateJob(job *types.ImportJob) error
+	SetJobFile(job *types.ImportJob) error
+	FinishJob(job *types.ImportJob) error
+	GetJob(id uint64, userID uint64) (*types.ImportJob, error)
+	ListJobs(userID uint64, page, limit int) ([]types.ImportJob, int, error)
+	ClaimJob(id uint64) (*types.ImportJob, error)
+	SaveProgress(job *types.ImportJob, rejects []types.ImportReject) error
+	RequeueJob(id uint64) error
+	QueuedJobs(limit int) ([]uint64, error)
+	RecoverStaleJobs(idle time.Duration, maxAttempts int) ([]types.ImportJob, error)
+	EachReject(jobID uint64, fn func(types.ImportReject) error) error
+}
+
+type importRepository struct {
+	db *sql.DB
+}
+
+func NewImportRepository(db *sql.DB) ImportRepository {
+	return &importRepository{db: db}
+}
+
+const importJobColumns = `id, user_id, source, status, options, COALESCE(file_name, ''), COALESCE(file_key, ''), file_size,
+    rows_done, progress, attempts, summary, COALESCE(error, ''), created_at, updated_at, finished_at`
+
+func scanImportJob(row interface{ Scan(...interface{}) error }) (*types.ImportJob, error) {
+	var j types.ImportJob
+	var options, summary []byte
+	var finished sql.NullTime
+	if err := row.Scan(&j.ID, &j.UserID, &j.Source, &j.Status, &options, &j.FileName, &j.FileKey, &j.FileSize,
+		&j.RowsDone, &j.Progress, &j.Attempts, &summary, &j.Error, &j.CreatedAt, &j.UpdatedAt, &finished); err != nil {
+		return nil, err
+	}
+	j.Options = options
+	j.Summary = summary
+	if finished.Valid {
+		j.FinishedAt = &finished.Time
+	}
+	return &j, nil
+}
+
+func rawJSON(m json.RawMessage) interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	return []byte(m)
+}
+
+// CreateJob adds a job, running unless it says it is queued.
+func (r *importRepository) CreateJob(job *types.ImportJob) error {
+	if job.Status == "" {
+		job.Status = types.ImportRunning
+	}
+	res, err := r.db.Exec(`INSERT INTO import_jobs (user_id, source, status, options, file_name, file_size, created_at)
+                           VALUES (?, ?, ?, ?, ?, ?, NOW())`,
+		job.UserID, job.Source, job.Status, rawJSON(job.Options), nullString(job.FileName), job.FileSize)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	job.ID = uint64(id)
+	return nil
+}
+
+// SetJobFile stores where the job's upload is kept.
+func (r *importRepository) SetJobFile(job *types.ImportJob) error {
+	_, err := r.db.Exec(`UPDATE import_jobs SET file_key = ? WHERE id = ? AND user_id = ?`,
+		nullString(job.FileKey), job.ID, job.UserID)
+	return err
+}
+
+// FinishJob stores the job's status, progress, summary and error.
+func (r *importRepository) FinishJob(job *types.ImportJob) error {
+	_, err := r.db.Exec(`UPDATE import_jobs SET status = ?, rows_done = ?, progress = ?, summary = ?, error = ?, finished_at = NOW()
+                         WHERE id = ? AND user_id = ?`,
+		job.Status, job.RowsDone, job.Progress, rawJSON(job.Summary), nullString(job.Error), job.ID, job.UserID)
+	return err
+}
+
+func (r *importRepository) GetJob(id uint64, userID uint64) (*types.ImportJob, error) {
+	return scanImportJob(r.db.QueryRow(`SELECT `+importJobColumns+` FROM import_jobs WHERE id = ? AND user_id = ?`, id, userID))
+}
+
+// ListJobs lists jobs newest first, without their summaries.
+func (r *importRepository) ListJobs(userID uint64, page, limit int) ([]types.ImportJob, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM import_jobs WHERE user_id = ?`, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`SELECT id, user_id, source, status, options, COALESCE(file_name, ''), COALESCE(file_key, ''), file_size,
+                                    rows_done, progress, attempts, NULL, COALESCE(error, ''), created_at, updated_at, finished_at
+                             FROM import_jobs WHERE user_id = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		userID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	jobs := []types.ImportJob{}
+	for rows.Next() {
+		j, err := scanImportJob(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, total, rows.Err()
+}
+
+// ClaimJob marks a queued job running and returns it, or nil if another
+// worker took it first.
+func (r *importRepository) ClaimJob(id uint64) (*types.ImportJob, error) {
+	res, err := r.db.Exec(`UPDATE import_jobs SET status = 'running', attempts = attempts + 1 WHERE id = ? AND status = 'queued'`, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, err
+	}
+	return scanImportJob(r.db.QueryRow(`SELECT `+importJobColumns+` FROM import_jobs WHERE id = ?`, id))
+}
+
+// SaveProgress stores how far a running job got, together with the rows
+// it rejected along the way, so a job that stops can resume from there.
+func (r *importRepository) SaveProgress(job *types.ImportJob, rejects []types.ImportReject) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(rejects) > 0 {
+		stmt, err := tx.Prepare(`INSERT INTO import_rejects (job_id, file_row, record, reason) VALUES (?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, rej := range rejects {
+			record, err := json.Marshal(rej.Record)
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.Exec(job.ID, rej.Row, record, rej.Reason); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.Exec(`UPDATE import_jobs SET rows_done = ?, progress = ?, summary = ? WHERE id = ?`,
+		job.RowsDone, job.Progress, rawJSON(job.Summary), job.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RequeueJob hands a running job back to the queue.
+func (r *importRepository) RequeueJob(id uint64) error {
+	_, err := r.db.Exec(`UPDATE import_jobs SET status = 'queued' WHERE id = ? AND status = 'running'`, id)
+	return err
+}
+
+// QueuedJobs lists queued jobs, oldest first.
+func (r *importRepository) QueuedJobs(limit int) ([]uint64, error) {
+	rows, err := r.db.Query(`SELECT id FROM import_jobs WHERE status = 'queued' ORDER BY id LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uint64
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// RecoverStaleJobs requeues background jobs that have been running
+// without saving progress for idle, as happens when the server running
+// them stops. Jobs already tried maxAttempts times are failed instead, and
+// returned so their uploads can be removed.
+func (r *importRepository) RecoverStaleJobs(idle time.Duration, maxAttempts int) ([]types.ImportJob, error) {
+	seconds := int(idle.Seconds())
+	rows, err := r.db.Query(`SELECT id, user_id, file_key FROM import_jobs
+                             WHERE status = 'running' AND file_key IS NOT NULL AND updated_at < NOW() - INTERVAL ? SECOND
+                               AND attempts >= ?`,
+		seconds, maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	var stale []types.ImportJob
+	for rows.Next() {
+		var job types.ImportJob
+		if err := rows.Scan(&job.ID, &job.UserID, &job.FileKey); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stale = append(stale, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// A job that saved progress since it was listed is left running.
+	var failed []types.ImportJob
+	for _, job := range stale {
+		res, err := r.db.Exec(`UPDATE import_jobs SET status = 'failed', error = 'import stopped responding', finished_at = NOW()
+                               WHERE id = ? AND status = 'running' AND updated_at < NOW() - INTERVAL ? SECOND`,
+			job.ID, seconds)
+		if err != nil {
+			return failed, err
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			failed = append(failed, job)
+		}
+	}
+
+	_, err = r.db.Exec(`UPDATE import_jobs SET status = 'queued'
+                        WHERE status = 'running' AND file_key IS NOT NULL AND updated_at < NOW() - INTERVAL ? SECOND`, seconds)
+	return failed, err
+}
+
+// EachReject calls fn for each row the job rejected, in file order.
+func (r *importRepository) EachReject(jobID uint64, fn func(types.ImportReject) error) error {
+	rows, err := r.db.Query(`SELECT file_row, record, reason FROM import_rejects WHERE job_id = ? ORDER BY file_row, id`, jobID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rej types.ImportReject
+		var record []byte
+		if err := rows.Scan(&rej.Row, &record, &rej.Reason); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(record, &rej.Record); err != nil {
+			return err
+		}
+		if err := fn(rej); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"database/sql"
+	"email_campaign/internal/types"
+	"encoding/json"
+	"errors"
+)
+
+// ErrQuotaExceeded is returned when a new file would take a user past
+// their storage quota.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+type MediaRepository interface {
+	CreateMedia(media *types.MediaDTO, quota int64) error
+	ListMedia(userID uint64, page, limit int) ([]types.MediaDTO, int, error)
+	GetMedia(id uint64, userID uint64) (*types.MediaDTO, error)
+	GetMediaByKeyPrefix(userID uint64, prefix string) (*types.MediaDTO, error)
+	DeleteMedia(id uint64, userID uint64) error
+	GetUsage(userID uint64) (int64, error)
+	GetPlan(userID uint64) (string, error)
+}
+
+type mediaRepository struct {
+	db *sql.DB
+}
+
+func NewMediaRepository(db *sql.DB) MediaRepository {
+	return &mediaRepository{db: db}
+}
+
+// CreateMedia inserts the row only if it keeps the user within quota, so
+// concurrent uploads cannot overshoot it together.
+func (r *mediaRepository) CreateMedia(media *types.MediaDTO, quota int64) error {
+	variants, err := json.Marshal(media.Variants)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO media (user_id, filename, content_type, width, height, size_bytes, provider, variants, created_at)
+              SELECT ?, ?, ?, ?, ?, ?, ?, ?, NOW() FROM DUAL
+              WHERE (SELECT COALESCE(SUM(size_bytes), 0) FROM media WHERE user_id = ?) + ? <= ?`
+	res, err := r.db.Exec(query, media.UserID, media.Filename, media.ContentType, media.Width, media.Height,
+		media.Size, media.Provider, variants, media.UserID, media.Size, quota)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrQuotaExceeded
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	media.ID = uint64(id)
+	return r.db.QueryRow(`SELECT created_at FROM media WHERE id = ?`, id).Scan(&media.CreatedAt)
+}
+
+const mediaColumns = `id, user_id, filename, content_type, width, height, size_bytes, provider, variants, created_at`
+
+func scanMedia(row interface{ Scan(...interface{}) error }) (*types.MediaDTO, error) {
+	var m types.MediaDTO
+	var variants []byte
+	if err := row.Scan(&m.ID, &m.UserID, &m.Filename, &m.ContentType, &m.Width, &m.Height,
+		&m.Size, &m.Provider, &variants, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(variants, &m.Variants); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *mediaRepository) ListMedia(userID uint64, page, limit int) ([]types.MediaDTO, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM media WHERE user_id = ?`, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE user_id = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`
+	rows, err := r.db.Query(query, userID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	media := []types.MediaDTO{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		media = append(media, *m)
+	}
+	return media, total, rows.Err()
+}
+
+func (r *mediaRepository) GetMedia(id uint64, userID uint64) (*types.MediaDTO, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE id = ? AND user_id = ?`
+	return scanMedia(r.db.QueryRow(query, id, userID))
+}
+
+// GetMediaByKeyPrefix finds the image whose variants are stored under
+// prefix, such as "media/7/1a2b3c4d5e6f7a8b/".
+func (r *mediaRepository) GetMediaByKeyPrefix(userID uint64, prefix string) (*types.MediaDTO, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media
+              WHERE user_id = ? AND JSON_SEARCH(variants, 'one', ?, NULL, '$[*].key') IS NOT NULL LIMIT 1`
+	return scanMedia(r.db.QueryRow(query, userID, prefix+"%"))
+}
+
+func (r *mediaRepository) DeleteMedia(id uint64, userID uint64) error {
+	res, err := r.db.Exec(`DELETE FROM media WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *mediaRepository) GetUsage(userID uint64) (int64, error) {
+	var used int64
+	err := r.db.QueryRow(`SELECT COALESCE(SUM(size_bytes), 0) FROM media WHERE user_id = ?`, userID).Scan(&used)
+	return used, err
+}
+
+// GetPlan returns the plan of the user's active subscription, "free" when
+// there is none.
+func (r *mediaRepository) GetPlan(userID uint64) (string, error) {
+	var plan string
+	query := `SELECT plan_type FROM subscriptions
+              WHERE user_id = ? AND status = 'active' AND is_deleted = 0
+              ORDER BY created_at DESC LIMIT 1`
+	err := r.db.QueryRow(query, userID).Scan(&plan)
+	if err == sql.ErrNoRows {
+		return "free", nil
+	}
+	return plan, err
+}
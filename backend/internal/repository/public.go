@@ -2,12 +2,17 @@ package repository
 
 import (
 	"database/sql"
+	"email_campaign/internal/types"
 )
 
 type PublicRepository interface {
-	Unsubscribe(token string) error
+	UnsubscribeRecipient(campaignID uint64, recipientID uint64) error
 	Resubscribe(token string) error
 	UpdatePreferences(token string, isSubscribed bool) error
+	GetRecipientView(campaignID uint64, recipientID uint64) (*types.RecipientView, error)
+	GetArchive(slug string) (*types.Archive, error)
+	ListArchivedCampaigns(userID uint64, limit int) ([]types.ArchivedCampaign, error)
+	GetArchivedCampaign(userID uint64, campaignID uint64) (*types.ArchivedCampaign, error)
 }
 
 type publicRepository struct {
@@ -18,9 +23,35 @@ func NewPublicRepository(db *sql.DB) PublicRepository {
 	return &publicRepository{db: db}
 }
 
-func (r *publicRepository) Unsubscribe(token string) error {
-	// TODO: Implement
-	return nil
+// UnsubscribeRecipient unsubscribes a recipient's contact and marks the
+// recipient unsubscribed, counting it once against the campaign.
+func (r *publicRepository) UnsubscribeRecipient(campaignID uint64, recipientID uint64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var contactID uint64
+	var status string
+	err = tx.QueryRow(`SELECT contact_id, status FROM campaign_recipients WHERE id = ? AND campaign_id = ? FOR UPDATE`,
+		recipientID, campaignID).Scan(&contactID, &status)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE contacts SET is_subscribed = FALSE, updated_at = NOW() WHERE id = ?`, contactID); err != nil {
+		return err
+	}
+	if status != "unsubscribed" {
+		_, err = tx.Exec(`UPDATE campaign_recipients SET status = 'unsubscribed', unsubscribed_at = IFNULL(unsubscribed_at, NOW()), updated_at = NOW() WHERE id = ?`, recipientID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE campaigns SET unsubscribed_count = unsubscribed_count + 1 WHERE id = ?`, campaignID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func (r *publicRepository) Resubscribe(token string) error {
@@ -32,3 +63,92 @@ func (r *publicRepository) UpdatePreferences(token string, isSubscribed bool) er
 	// TODO: Implement
 	return nil
 }
+
+// archivedCampaignsWhere matches the campaigns that have actually gone out; drafts
+// and cancelled campaigns never appear in a public archive.
+const archivedCampaignsWhere = `c.user_id = ? AND c.is_deleted = 0 AND c.started_at IS NOT NULL
+	          AND c.status IN ('sending', 'paused', 'completed')`
+
+func (r *publicRepository) GetRecipientView(campaignID uint64, recipientID uint64) (*types.RecipientView, error) {
+	v := &types.RecipientView{CampaignID: campaignID, RecipientID: recipientID}
+	var firstName, lastName, phone, company, locale sql.NullString
+	var customFields []byte
+	// The locale the copy was rendered in wins, so the page matches the email.
+	query := `SELECT c.user_id, ct.id, ct.email, ct.first_name, ct.last_name, ct.phone, ct.company, COALESCE(cr.locale, ct.locale), ct.custom_fields
+	          FROM campaign_recipients cr
+	          JOIN campaigns c ON cr.campaign_id = c.id
+	          JOIN contacts ct ON cr.contact_id = ct.id
+	          WHERE cr.id = ? AND cr.campaign_id = ? AND c.is_deleted = 0`
+	err := r.db.QueryRow(query, recipientID, campaignID).Scan(
+		&v.UserID, &v.Contact.ID, &v.Contact.Email, &firstName, &lastName, &phone, &company, &locale, &customFields,
+	)
+	if err != nil {
+		return nil, err
+	}
+	v.Contact.UserID = v.UserID
+	v.Contact.FirstName = firstName.String
+	v.Contact.LastName = lastName.String
+	v.Contact.Phone = phone.String
+	v.Contact.Company = company.String
+	v.Contact.Locale = locale.String
+	v.Contact.CustomFields = customFields
+
+	rows, err := r.db.Query(`SELECT t.id, t.name FROM tags t
+	                         JOIN contact_tags ct ON ct.tag_id = t.id
+	                         WHERE ct.contact_id = ?`, v.Contact.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t types.Tag
+		if err := rows.Scan(&t.ID, &t.Name); err != nil {
+			return nil, err
+		}
+		v.Contact.Tags = append(v.Contact.Tags, t)
+	}
+	return v, rows.Err()
+}
+
+func (r *publicRepository) GetArchive(slug string) (*types.Archive, error) {
+	a := &types.Archive{Slug: slug}
+	err := r.db.QueryRow(`SELECT user_id, COALESCE(archive_title, '') FROM user_settings
+	                      WHERE archive_slug = ? AND archive_enabled = 1`, slug).Scan(&a.UserID, &a.Title)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *publicRepository) ListArchivedCampaigns(userID uint64, limit int) ([]types.ArchivedCampaign, error) {
+	rows, err := r.db.Query(`SELECT c.id, c.name, c.subject, c.started_at
+	                         FROM campaigns c
+	                         WHERE `+archivedCampaignsWhere+`
+	                         ORDER BY c.started_at DESC, c.id DESC
+	                         LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []types.ArchivedCampaign{}
+	for rows.Next() {
+		var c types.ArchivedCampaign
+		if err := rows.Scan(&c.ID, &c.Name, &c.Subject, &c.SentAt); err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, c)
+	}
+	return campaigns, rows.Err()
+}
+
+func (r *publicRepository) GetArchivedCampaign(userID uint64, campaignID uint64) (*types.ArchivedCampaign, error) {
+	c := &types.ArchivedCampaign{ID: campaignID}
+	err := r.db.QueryRow(`SELECT c.name, c.subject, c.started_at
+	                      FROM campaigns c
+	                      WHERE c.id = ? AND `+archivedCampaignsWhere, campaignID, userID).Scan(&c.Name, &c.Subject, &c.SentAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -11,6 +11,9 @@ type SettingsRepository interface {
 	UpdateFileSettings(settings *types.UserSettings) error
 	UpdatePrivacySettings(settings *types.UserSettings) error
 	UpdateSMTP(settings *types.UserSettings) error
+	UpdateUTMSettings(settings *types.UserSettings) error
+	UpdateArchiveSettings(settings *types.UserSettings) error
+	ArchiveSlugTaken(slug string, userID uint64) (bool, error)
 	CreateSettings(userID uint64) error
 }
 
@@ -26,24 +29,28 @@ func (r *settingsRepository) GetSettings(userID uint64) (*types.UserSettings, er
 	var s types.UserSettings
 	query := `SELECT id, user_id, 
 			  COALESCE(smtp_host, ''), COALESCE(smtp_port, 587), COALESCE(smtp_username, ''), COALESCE(smtp_password_encrypted, ''), 
-			  COALESCE(daily_send_limit, 1000), COALESCE(monthly_send_limit, 10000), COALESCE(timezone, 'UTC'), created_at, updated_at,
-			  COALESCE(file_provider, 'filesystem'), COALESCE(s3_bucket, ''), COALESCE(s3_region, ''), COALESCE(s3_access_key, ''), COALESCE(s3_secret_key, ''),
+			  COALESCE(daily_send_limit, 1000), COALESCE(monthly_send_limit, 10000), COALESCE(timezone, 'UTC'), COALESCE(default_locale, 'en'), created_at, updated_at,
+			  COALESCE(file_provider, 'filesystem'), COALESCE(s3_bucket, ''), COALESCE(s3_region, ''), COALESCE(s3_endpoint, ''), COALESCE(s3_access_key, ''), COALESCE(s3_secret_key, ''),
 			  COALESCE(cloudinary_cloud_name, ''), COALESCE(cloudinary_api_key, ''), COALESCE(cloudinary_api_secret, ''),
 			  COALESCE(two_factor_enabled, 0), COALESCE(data_retention_days, 365),
 			  COALESCE(default_from_email, ''), COALESCE(admin_notification_emails, ''), COALESCE(concurrency, 1), COALESCE(message_rate, 0),
 			  COALESCE(batch_size, 100), COALESCE(max_error_threshold, 10), COALESCE(s3_bucket_path, ''), COALESCE(s3_bucket_type, 'public'),
-			  COALESCE(s3_upload_expiry, 15), COALESCE(permitted_file_extensions, 'jpg,jpeg,png,gif,svg'), COALESCE(smtp_max_connections, 5), COALESCE(smtp_retries, 3)
+			  COALESCE(s3_upload_expiry, 15), COALESCE(permitted_file_extensions, 'jpg,jpeg,png,gif,svg'), COALESCE(smtp_max_connections, 5), COALESCE(smtp_retries, 3),
+			  COALESCE(utm_enabled, 0), COALESCE(utm_source, ''), COALESCE(utm_medium, ''), COALESCE(utm_campaign, ''), COALESCE(utm_content, ''),
+			  COALESCE(archive_enabled, 0), COALESCE(archive_slug, ''), COALESCE(archive_title, '')
 			  FROM user_settings WHERE user_id = ?`
 
 	err := r.db.QueryRow(query, userID).Scan(
 		&s.ID, &s.UserID, &s.SMTPHost, &s.SMTPPort, &s.SMTPUsername, &s.SMTPPasswordEncrypted,
-		&s.DailySendLimit, &s.MonthlySendLimit, &s.Timezone, &s.CreatedAt, &s.UpdatedAt,
-		&s.FileProvider, &s.S3Bucket, &s.S3Region, &s.S3AccessKey, &s.S3SecretKey,
+		&s.DailySendLimit, &s.MonthlySendLimit, &s.Timezone, &s.DefaultLocale, &s.CreatedAt, &s.UpdatedAt,
+		&s.FileProvider, &s.S3Bucket, &s.S3Region, &s.S3Endpoint, &s.S3AccessKey, &s.S3SecretKey,
 		&s.CloudinaryCloudName, &s.CloudinaryApiKey, &s.CloudinaryApiSecret,
 		&s.TwoFactorEnabled, &s.DataRetentionDays,
 		&s.DefaultFromEmail, &s.AdminNotificationEmails, &s.Concurrency, &s.MessageRate,
 		&s.BatchSize, &s.MaxErrorThreshold, &s.S3BucketPath, &s.S3BucketType,
 		&s.S3UploadExpiry, &s.PermittedFileExtensions, &s.SMTPMaxConnections, &s.SMTPRetries,
+		&s.UTMEnabled, &s.UTMSource, &s.UTMMedium, &s.UTMCampaign, &s.UTMContent,
+		&s.ArchiveEnabled, &s.ArchiveSlug, &s.ArchiveTitle,
 	)
 	if err == sql.ErrNoRows {
 		// Create default settings if not exists
@@ -67,14 +74,14 @@ func (r *settingsRepository) CreateSettings(userID uint64) error {
 func (r *settingsRepository) UpdateSettings(s *types.UserSettings) error {
 	query := `UPDATE user_settings SET 
 			  smtp_host = ?, smtp_port = ?, smtp_username = ?, smtp_password_encrypted = ?,
-			  daily_send_limit = ?, monthly_send_limit = ?, timezone = ?,
+			  daily_send_limit = ?, monthly_send_limit = ?, timezone = ?, default_locale = ?,
 			  default_from_email = ?, admin_notification_emails = ?, concurrency = ?,
 			  message_rate = ?, batch_size = ?, max_error_threshold = ?
 			  WHERE user_id = ?`
 
 	_, err := r.db.Exec(query,
 		s.SMTPHost, s.SMTPPort, s.SMTPUsername, s.SMTPPasswordEncrypted,
-		s.DailySendLimit, s.MonthlySendLimit, s.Timezone,
+		s.DailySendLimit, s.MonthlySendLimit, s.Timezone, s.DefaultLocale,
 		s.DefaultFromEmail, s.AdminNotificationEmails, s.Concurrency,
 		s.MessageRate, s.BatchSize, s.MaxErrorThreshold, s.UserID,
 	)
@@ -83,13 +90,13 @@ func (r *settingsRepository) UpdateSettings(s *types.UserSettings) error {
 
 func (r *settingsRepository) UpdateFileSettings(s *types.UserSettings) error {
 	query := `UPDATE user_settings SET 
-			  file_provider = ?, s3_bucket = ?, s3_region = ?, s3_access_key = ?, s3_secret_key = ?,
+			  file_provider = ?, s3_bucket = ?, s3_region = ?, s3_endpoint = ?, s3_access_key = ?, s3_secret_key = ?,
 			  cloudinary_cloud_name = ?, cloudinary_api_key = ?, cloudinary_api_secret = ?,
 			  s3_bucket_path = ?, s3_bucket_type = ?, s3_upload_expiry = ?, permitted_file_extensions = ?
 			  WHERE user_id = ?`
 
 	_, err := r.db.Exec(query,
-		s.FileProvider, s.S3Bucket, s.S3Region, s.S3AccessKey, s.S3SecretKey,
+		s.FileProvider, s.S3Bucket, s.S3Region, s.S3Endpoint, s.S3AccessKey, s.S3SecretKey,
 		s.CloudinaryCloudName, s.CloudinaryApiKey, s.CloudinaryApiSecret,
 		s.S3BucketPath, s.S3BucketType, s.S3UploadExpiry, s.PermittedFileExtensions, s.UserID,
 	)
@@ -119,3 +126,35 @@ func (r *settingsRepository) UpdateSMTP(s *types.UserSettings) error {
 	)
 	return err
 }
+
+func (r *settingsRepository) UpdateUTMSettings(s *types.UserSettings) error {
+	query := `UPDATE user_settings SET 
+			  utm_enabled = ?, utm_source = ?, utm_medium = ?, utm_campaign = ?, utm_content = ?
+			  WHERE user_id = ?`
+
+	_, err := r.db.Exec(query,
+		s.UTMEnabled, s.UTMSource, s.UTMMedium, s.UTMCampaign, s.UTMContent, s.UserID,
+	)
+	return err
+}
+
+func (r *settingsRepository) UpdateArchiveSettings(s *types.UserSettings) error {
+	query := `UPDATE user_settings SET 
+			  archive_enabled = ?, archive_slug = ?, archive_title = ?
+			  WHERE user_id = ?`
+
+	var slug interface{}
+	if s.ArchiveSlug != "" {
+		slug = s.ArchiveSlug
+	}
+	_, err := r.db.Exec(query, s.ArchiveEnabled, slug, s.ArchiveTitle, s.UserID)
+	return err
+}
+
+// ArchiveSlugTaken reports whether a user other than userID has claimed
+// slug. The unique key on archive_slug still guards against races.
+func (r *settingsRepository) ArchiveSlugTaken(slug string, userID uint64) (bool, error) {
+	var n int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM user_settings WHERE archive_slug = ? AND user_id <> ?`, slug, userID).Scan(&n)
+	return n > 0, err
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"email_campaign/internal/types"
 	"email_campaign/internal/utils"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -20,6 +22,8 @@ type TagRepository interface {
 	AddTagToCampaign(campaignID, tagID uint64) error
 	RemoveTagFromCampaign(campaignID, tagID uint64) error
 	GetCampaignTags(campaignID uint64) ([]types.Tag, error)
+	FindTagsByName(userID uint64, names []string) (map[string]uint64, error)
+	EnsureTags(userID uint64, names []string) (map[string]uint64, []string, error)
 }
 
 type tagRepository struct {
@@ -212,3 +216,63 @@ func (r *tagRepository) GetCampaignTags(campaignID uint64) ([]types.Tag, error)
 	}
 	return tags, nil
 }
+
+// FindTagsByName looks up the user's tags by name. The IDs are keyed by
+// lower-cased name, as names are matched without regard to case.
+func (r *tagRepository) FindTagsByName(userID uint64, names []string) (map[string]uint64, error) {
+	ids := map[string]uint64{}
+	if len(names) == 0 {
+		return ids, nil
+	}
+	placeholders := make([]string, len(names))
+	args := []interface{}{userID}
+	for i, name := range names {
+		placeholders[i] = "?"
+		args = append(args, name)
+	}
+	query := fmt.Sprintf("SELECT id, name FROM tags WHERE user_id = ? AND is_deleted = 0 AND name IN (%s)", strings.Join(placeholders, ","))
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		ids[strings.ToLower(name)] = id
+	}
+	return ids, rows.Err()
+}
+
+// EnsureTags returns the IDs of the named tags, keyed by lower-cased name,
+// creating the tags the user does not have and restoring deleted ones. It
+// also returns the names of the tags it created.
+func (r *tagRepository) EnsureTags(userID uint64, names []string) (map[string]uint64, []string, error) {
+	ids := map[string]uint64{}
+	var created []string
+	query := `INSERT INTO tags (user_id, name, created_at, updated_at) VALUES (?, ?, NOW(), NOW())
+              ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), is_deleted = 0, deleted_at = NULL`
+	for _, name := range names {
+		if _, ok := ids[strings.ToLower(name)]; ok {
+			continue
+		}
+		res, err := r.db.Exec(query, userID, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, nil, err
+		}
+		// One row is affected by an insert, none or two by an update.
+		if n, _ := res.RowsAffected(); n == 1 {
+			created = append(created, name)
+		}
+		ids[strings.ToLower(name)] = uint64(id)
+	}
+	return ids, created, nil
+}
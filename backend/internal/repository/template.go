@@ -4,16 +4,26 @@ import (
 	"database/sql"
 	"email_campaign/internal/types"
 	"email_campaign/internal/utils"
+	"strings"
 )
 
 type TemplateRepository interface {
-	CreateTemplate(template *types.CreateTemplateRequest) error
+	CreateTemplate(template *types.CreateTemplateRequest) (uint64, error)
 	GetTemplate(id uint64, userID uint64) (*types.TemplateDTO, error)
 	ListTemplates(filter *types.TemplateFilter) ([]types.TemplateDTO, int, error)
 	UpdateTemplate(id uint64, userID uint64, req *types.UpdateTemplateRequest) error
 	DeleteTemplate(id uint64, userID uint64) error
 	DuplicateTemplate(id uint64, userID uint64) error
 	SetDefaultTemplate(id uint64, userID uint64) error
+	ListTemplateVersions(id uint64, userID uint64, page, limit int) ([]types.TemplateVersionDTO, int, error)
+	GetTemplateVersion(id uint64, userID uint64, version int) (*types.TemplateVersionDTO, error)
+	RestoreTemplateVersion(id uint64, userID uint64, version int) error
+	ListTemplateLocales(id uint64, userID uint64) ([]types.TemplateLocaleDTO, error)
+	GetTemplateLocale(id uint64, userID uint64, locale string) (*types.TemplateLocaleDTO, error)
+	SaveTemplateLocale(userID uint64, l *types.TemplateLocaleDTO) error
+	DeleteTemplateLocale(id uint64, userID uint64, locale string) error
+	SaveLintReport(report *types.TemplateLintReport) error
+	GetLintReport(id uint64, userID uint64) (*types.TemplateLintReport, error)
 }
 
 type templateRepository struct {
@@ -24,16 +34,32 @@ func NewTemplateRepository(db *sql.DB) TemplateRepository {
 	return &templateRepository{db: db}
 }
 
-func (r *templateRepository) CreateTemplate(template *types.CreateTemplateRequest) error {
+func (r *templateRepository) CreateTemplate(template *types.CreateTemplateRequest) (uint64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	query := `INSERT INTO email_templates (user_id, name, subject, type, mjml_content, html_content, text_content, thumbnail_url, is_default, created_at, updated_at) 
               VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
 
-	_, err := r.db.Exec(query, template.UserID, template.Name, template.Subject, template.Type, template.MJMLContent, template.HTMLContent, template.TextContent, template.ThumbnailURL, template.IsDefault)
-	return err
+	res, err := tx.Exec(query, template.UserID, template.Name, template.Subject, template.Type, template.MJMLContent, template.HTMLContent, template.TextContent, template.ThumbnailURL, template.IsDefault)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := snapshotTemplate(tx, uint64(id), template.UserID, nil, true); err != nil {
+		return 0, err
+	}
+	return uint64(id), tx.Commit()
 }
 
 func (r *templateRepository) GetTemplate(id uint64, userID uint64) (*types.TemplateDTO, error) {
-	query := `SELECT id, user_id, name, subject, type, mjml_content, html_content, text_content, thumbnail_url, is_default, created_at, updated_at 
+	query := `SELECT id, user_id, name, subject, type, mjml_content, html_content, text_content, thumbnail_url, is_default, current_version, created_at, updated_at 
               FROM email_templates WHERE id = ? AND user_id = ?`
 
 	var t types.TemplateDTO
@@ -41,7 +67,7 @@ func (r *templateRepository) GetTemplate(id uint64, userID uint64) (*types.Templ
 
 	err := r.db.QueryRow(query, id, userID).Scan(
 		&t.ID, &t.UserID, &t.Name, &t.Subject, &t.Type, &mjmlContent, &t.HTMLContent, &textContent, &thumbnailURL,
-		&t.IsDefault, &t.CreatedAt, &t.UpdatedAt,
+		&t.IsDefault, &t.Version, &t.CreatedAt, &t.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -53,8 +79,11 @@ func (r *templateRepository) GetTemplate(id uint64, userID uint64) (*types.Templ
 }
 
 func (r *templateRepository) ListTemplates(filter *types.TemplateFilter) ([]types.TemplateDTO, int, error) {
-	baseQuery := `SELECT id, user_id, name, subject, type, mjml_content, html_content, text_content, thumbnail_url, is_default, created_at, updated_at 
-                   FROM email_templates WHERE user_id = ? AND deleted_at IS NULL AND is_deleted = 0`
+	baseQuery := `SELECT id, user_id, name, subject, type, mjml_content, html_content, text_content, thumbnail_url, is_default, current_version, created_at, updated_at,
+                   l.status, l.errors, l.warnings, l.template_version, l.checked_at
+                   FROM email_templates
+                   LEFT JOIN template_lint_reports l ON l.template_id = email_templates.id
+                   WHERE user_id = ? AND deleted_at IS NULL AND is_deleted = 0`
 	args := []interface{}{filter.UserID}
 
 	allowedFields := map[string]string{
@@ -107,14 +136,26 @@ func (r *templateRepository) ListTemplates(filter *types.TemplateFilter) ([]type
 	var templates []types.TemplateDTO
 	for rows.Next() {
 		var t types.TemplateDTO
-		var thumbnailURL, textContent, mjmlContent sql.NullString
+		var thumbnailURL, textContent, mjmlContent, lintStatus sql.NullString
+		var lintErrors, lintWarnings, lintVersion sql.NullInt64
+		var checkedAt sql.NullTime
 		err := rows.Scan(
 			&t.ID, &t.UserID, &t.Name, &t.Subject, &t.Type, &mjmlContent, &t.HTMLContent, &textContent, &thumbnailURL,
-			&t.IsDefault, &t.CreatedAt, &t.UpdatedAt,
+			&t.IsDefault, &t.Version, &t.CreatedAt, &t.UpdatedAt,
+			&lintStatus, &lintErrors, &lintWarnings, &lintVersion, &checkedAt,
 		)
 		if err != nil {
 			return nil, 0, err
 		}
+		if lintStatus.Valid {
+			t.Health = &types.TemplateHealth{
+				Status:    lintStatus.String,
+				Errors:    int(lintErrors.Int64),
+				Warnings:  int(lintWarnings.Int64),
+				Stale:     int(lintVersion.Int64) != t.Version,
+				CheckedAt: checkedAt.Time,
+			}
+		}
 		t.ThumbnailURL = thumbnailURL.String
 		t.TextContent = textContent.String
 		t.MJMLContent = mjmlContent.String
@@ -163,8 +204,19 @@ func (r *templateRepository) UpdateTemplate(id uint64, userID uint64, req *types
 	query += " WHERE id = ? AND user_id = ?"
 	args = append(args, id, userID)
 
-	_, err := r.db.Exec(query, args...)
-	return err
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	if err := snapshotTemplate(tx, id, userID, nil, false); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (r *templateRepository) DeleteTemplate(id uint64, userID uint64) error {
@@ -189,10 +241,32 @@ func (r *templateRepository) DuplicateTemplate(id uint64, userID uint64) error {
 	newName := "Copy of " + t.Name
 	// Basic implementation, doesn't handle "Copy of Copy of..." collision logic perfectly but good enough
 
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `INSERT INTO email_templates (user_id, name, subject, type, mjml_content, html_content, text_content, thumbnail_url, is_default, created_at, updated_at)
               VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
-	_, err = r.db.Exec(query, userID, newName, t.Subject, t.Type, t.MJMLContent, t.HTMLContent, t.TextContent, t.ThumbnailURL, false) // Default to false
-	return err
+	res, err := tx.Exec(query, userID, newName, t.Subject, t.Type, t.MJMLContent, t.HTMLContent, t.TextContent, t.ThumbnailURL, false) // Default to false
+	if err != nil {
+		return err
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := snapshotTemplate(tx, uint64(newID), userID, nil, true); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO email_template_locales (template_id, locale, subject, mjml_content, html_content, text_content, created_at, updated_at)
+                      SELECT ?, locale, subject, mjml_content, html_content, text_content, NOW(), NOW()
+                      FROM email_template_locales WHERE template_id = ?`, newID, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (r *templateRepository) SetDefaultTemplate(id uint64, userID uint64) error {
@@ -221,3 +295,229 @@ func (r *templateRepository) SetDefaultTemplate(id uint64, userID uint64) error
 
 	return tx.Commit()
 }
+
+// snapshotTemplate records the template's current content as its next
+// version and makes that version the head. Unless force is set, nothing is
+// recorded when the content matches the head version, so saving only the
+// thumbnail or default flag adds no history.
+func snapshotTemplate(tx *sql.Tx, id uint64, userID uint64, restoredFrom *int, force bool) error {
+	query := `INSERT INTO email_template_versions (template_id, version, name, subject, type, mjml_content, html_content, text_content, created_by, restored_from, created_at)
+              SELECT t.id, t.current_version + 1, t.name, t.subject, t.type, t.mjml_content, t.html_content, t.text_content, ?, ?, NOW()
+              FROM email_templates t
+              LEFT JOIN email_template_versions v ON v.template_id = t.id AND v.version = t.current_version
+              WHERE t.id = ? AND t.user_id = ?`
+	if !force {
+		// BINARY keeps case-only edits from comparing equal under the
+		// table's case-insensitive collation.
+		query += ` AND (v.id IS NULL OR NOT (BINARY v.name <=> BINARY t.name AND BINARY v.subject <=> BINARY t.subject AND v.type <=> t.type
+                      AND BINARY v.mjml_content <=> BINARY t.mjml_content AND BINARY v.html_content <=> BINARY t.html_content
+                      AND BINARY v.text_content <=> BINARY t.text_content))`
+	}
+	res, err := tx.Exec(query, userID, restoredFrom, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	_, err = tx.Exec("UPDATE email_templates SET current_version = current_version + 1 WHERE id = ?", id)
+	return err
+}
+
+func (r *templateRepository) ListTemplateVersions(id uint64, userID uint64, page, limit int) ([]types.TemplateVersionDTO, int, error) {
+	var total int
+	err := r.db.QueryRow(`SELECT current_version FROM email_templates WHERE id = ? AND user_id = ? AND is_deleted = 0`, id, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	query := `SELECT v.id, v.template_id, v.version, v.name, v.subject, v.type, v.created_by, u.first_name, u.last_name, v.restored_from, v.created_at
+              FROM email_template_versions v
+              LEFT JOIN users u ON v.created_by = u.id
+              WHERE v.template_id = ?
+              ORDER BY v.version DESC
+              LIMIT ? OFFSET ?`
+
+	rows, err := r.db.Query(query, id, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	versions := []types.TemplateVersionDTO{}
+	for rows.Next() {
+		var v types.TemplateVersionDTO
+		var createdBy, restoredFrom sql.NullInt64
+		var firstName, lastName sql.NullString
+		err := rows.Scan(&v.ID, &v.TemplateID, &v.Version, &v.Name, &v.Subject, &v.Type, &createdBy, &firstName, &lastName, &restoredFrom, &v.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		setVersionAuthor(&v, createdBy, firstName, lastName, restoredFrom)
+		versions = append(versions, v)
+	}
+	return versions, total, rows.Err()
+}
+
+func (r *templateRepository) GetTemplateVersion(id uint64, userID uint64, version int) (*types.TemplateVersionDTO, error) {
+	query := `SELECT v.id, v.template_id, v.version, v.name, v.subject, v.type, v.mjml_content, v.html_content, v.text_content,
+                     v.created_by, u.first_name, u.last_name, v.restored_from, v.created_at
+              FROM email_template_versions v
+              JOIN email_templates t ON v.template_id = t.id
+              LEFT JOIN users u ON v.created_by = u.id
+              WHERE v.template_id = ? AND v.version = ? AND t.user_id = ? AND t.is_deleted = 0`
+
+	var v types.TemplateVersionDTO
+	var mjmlContent, textContent sql.NullString
+	var createdBy, restoredFrom sql.NullInt64
+	var firstName, lastName sql.NullString
+	err := r.db.QueryRow(query, id, version, userID).Scan(
+		&v.ID, &v.TemplateID, &v.Version, &v.Name, &v.Subject, &v.Type, &mjmlContent, &v.HTMLContent, &textContent,
+		&createdBy, &firstName, &lastName, &restoredFrom, &v.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	v.MJMLContent = mjmlContent.String
+	v.TextContent = textContent.String
+	setVersionAuthor(&v, createdBy, firstName, lastName, restoredFrom)
+	return &v, nil
+}
+
+func setVersionAuthor(v *types.TemplateVersionDTO, createdBy sql.NullInt64, firstName, lastName sql.NullString, restoredFrom sql.NullInt64) {
+	if createdBy.Valid {
+		uid := uint64(createdBy.Int64)
+		v.CreatedBy = &uid
+	}
+	v.AuthorName = strings.TrimSpace(firstName.String + " " + lastName.String)
+	if restoredFrom.Valid {
+		rf := int(restoredFrom.Int64)
+		v.RestoredFrom = &rf
+	}
+}
+
+// RestoreTemplateVersion copies a version's content back into the template
+// and records it as a new version, so the history is never rewritten.
+func (r *templateRepository) RestoreTemplateVersion(id uint64, userID uint64, version int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE email_templates t
+                         JOIN email_template_versions v ON v.template_id = t.id AND v.version = ?
+                         SET t.name = v.name, t.subject = v.subject, t.type = v.type, t.mjml_content = v.mjml_content,
+                             t.html_content = v.html_content, t.text_content = v.text_content, t.updated_at = NOW()
+                         WHERE t.id = ? AND t.user_id = ? AND t.is_deleted = 0`, version, id, userID)
+	if err != nil {
+		return err
+	}
+	if err := snapshotTemplate(tx, id, userID, &version, true); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListTemplateLocales lists a template's translations without their
+// content.
+func (r *templateRepository) ListTemplateLocales(id uint64, userID uint64) ([]types.TemplateLocaleDTO, error) {
+	rows, err := r.db.Query(`SELECT l.template_id, l.locale, l.subject, l.created_at, l.updated_at
+                             FROM email_template_locales l
+                             JOIN email_templates t ON l.template_id = t.id
+                             WHERE t.id = ? AND t.user_id = ? AND t.is_deleted = 0
+                             ORDER BY l.locale`, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locales := []types.TemplateLocaleDTO{}
+	for rows.Next() {
+		var l types.TemplateLocaleDTO
+		if err := rows.Scan(&l.TemplateID, &l.Locale, &l.Subject, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		locales = append(locales, l)
+	}
+	return locales, rows.Err()
+}
+
+func (r *templateRepository) GetTemplateLocale(id uint64, userID uint64, locale string) (*types.TemplateLocaleDTO, error) {
+	var l types.TemplateLocaleDTO
+	var mjmlContent, textContent sql.NullString
+	err := r.db.QueryRow(`SELECT l.template_id, l.locale, l.subject, l.mjml_content, l.html_content, l.text_content, l.created_at, l.updated_at
+                          FROM email_template_locales l
+                          JOIN email_templates t ON l.template_id = t.id
+                          WHERE t.id = ? AND t.user_id = ? AND t.is_deleted = 0 AND l.locale = ?`, id, userID, locale).Scan(
+		&l.TemplateID, &l.Locale, &l.Subject, &mjmlContent, &l.HTMLContent, &textContent, &l.CreatedAt, &l.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	l.MJMLContent = mjmlContent.String
+	l.TextContent = textContent.String
+	return &l, nil
+}
+
+// SaveTemplateLocale creates or replaces the translation of a template
+// for l.Locale. Callers check the template exists first: saving unchanged
+// content affects no rows, so the result cannot tell.
+func (r *templateRepository) SaveTemplateLocale(userID uint64, l *types.TemplateLocaleDTO) error {
+	_, err := r.db.Exec(`INSERT INTO email_template_locales (template_id, locale, subject, mjml_content, html_content, text_content, created_at, updated_at)
+                           SELECT t.id, ?, ?, ?, ?, ?, NOW(), NOW()
+                           FROM email_templates t WHERE t.id = ? AND t.user_id = ? AND t.is_deleted = 0
+                           ON DUPLICATE KEY UPDATE subject = VALUES(subject), mjml_content = VALUES(mjml_content),
+                               html_content = VALUES(html_content), text_content = VALUES(text_content), updated_at = NOW()`,
+		l.Locale, l.Subject, l.MJMLContent, l.HTMLContent, l.TextContent, l.TemplateID, userID)
+	return err
+}
+
+func (r *templateRepository) DeleteTemplateLocale(id uint64, userID uint64, locale string) error {
+	res, err := r.db.Exec(`DELETE l FROM email_template_locales l
+                           JOIN email_templates t ON l.template_id = t.id
+                           WHERE t.id = ? AND t.user_id = ? AND l.locale = ?`, id, userID, locale)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SaveLintReport replaces the template's stored lint report.
+func (r *templateRepository) SaveLintReport(report *types.TemplateLintReport) error {
+	_, err := r.db.Exec(`INSERT INTO template_lint_reports (template_id, template_version, status, errors, warnings, report, checked_at)
+                         VALUES (?, ?, ?, ?, ?, ?, ?)
+                         ON DUPLICATE KEY UPDATE template_version = VALUES(template_version), status = VALUES(status), errors = VALUES(errors),
+                             warnings = VALUES(warnings), report = VALUES(report), checked_at = VALUES(checked_at)`,
+		report.TemplateID, report.Version, report.Status, report.Errors, report.Warnings, []byte(report.Report), report.CheckedAt)
+	return err
+}
+
+func (r *templateRepository) GetLintReport(id uint64, userID uint64) (*types.TemplateLintReport, error) {
+	report := &types.TemplateLintReport{}
+	var current int
+	var body []byte
+	err := r.db.QueryRow(`SELECT l.template_id, l.template_version, l.status, l.errors, l.warnings, l.report, l.checked_at, t.current_version
+                          FROM template_lint_reports l
+                          JOIN email_templates t ON l.template_id = t.id
+                          WHERE t.id = ? AND t.user_id = ? AND t.is_deleted = 0`, id, userID).Scan(
+		&report.TemplateID, &report.Version, &report.Status, &report.Errors, &report.Warnings, &body, &report.CheckedAt, &current,
+	)
+	if err != nil {
+		return nil, err
+	}
+	report.Report = body
+	report.Stale = report.Version != current
+	return report, nil
+}
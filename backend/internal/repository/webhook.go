@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"database/sql"
+	"email_campaign/internal/types"
+)
+
+type WebhookRepository interface {
+	CreateEndpoint(endpoint *types.WebhookEndpoint) error
+	ListEndpoints(userID uint64) ([]types.WebhookEndpoint, error)
+	GetEndpointByToken(token string) (*types.WebhookEndpoint, error)
+	DeleteEndpoint(id uint64, userID uint64) error
+	TouchEndpoint(id uint64) error
+}
+
+type webhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) CreateEndpoint(endpoint *types.WebhookEndpoint) error {
+	query := `INSERT INTO webhook_endpoints (user_id, provider, token, signing_secret, topic_arn, is_active, created_at, updated_at)
+              VALUES (?, ?, ?, ?, NULLIF(?, ''), TRUE, NOW(), NOW())`
+
+	res, err := r.db.Exec(query, endpoint.UserID, endpoint.Provider, endpoint.Token, endpoint.SigningSecret, endpoint.TopicArn)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	endpoint.ID = uint64(id)
+	endpoint.IsActive = true
+	return nil
+}
+
+func (r *webhookRepository) ListEndpoints(userID uint64) ([]types.WebhookEndpoint, error) {
+	query := `SELECT id, user_id, provider, token, COALESCE(topic_arn, ''), is_active, last_received_at, created_at, updated_at
+              FROM webhook_endpoints WHERE user_id = ? AND is_deleted = 0 ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []types.WebhookEndpoint
+	for rows.Next() {
+		var e types.WebhookEndpoint
+		var lastReceivedAt sql.NullTime
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Provider, &e.Token, &e.TopicArn, &e.IsActive, &lastReceivedAt, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if lastReceivedAt.Valid {
+			e.LastReceivedAt = &lastReceivedAt.Time
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, nil
+}
+
+func (r *webhookRepository) GetEndpointByToken(token string) (*types.WebhookEndpoint, error) {
+	query := `SELECT id, user_id, provider, token, COALESCE(signing_secret, ''), COALESCE(topic_arn, ''), is_active, created_at, updated_at
+              FROM webhook_endpoints WHERE token = ? AND is_deleted = 0`
+
+	var e types.WebhookEndpoint
+	err := r.db.QueryRow(query, token).Scan(&e.ID, &e.UserID, &e.Provider, &e.Token, &e.SigningSecret, &e.TopicArn, &e.IsActive, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *webhookRepository) DeleteEndpoint(id uint64, userID uint64) error {
+	res, err := r.db.Exec("UPDATE webhook_endpoints SET is_deleted = 1, deleted_at = NOW(), is_active = FALSE WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *webhookRepository) TouchEndpoint(id uint64) error {
+	_, err := r.db.Exec("UPDATE webhook_endpoints SET last_received_at = NOW() WHERE id = ?", id)
+	return err
+}
@@ -1,10 +1,12 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
 
+	"email_campaign/internal/bounce"
 	"email_campaign/internal/config"
 	"email_campaign/internal/database"
 	"email_campaign/internal/handler"
@@ -12,12 +14,15 @@ import (
 	"email_campaign/internal/middleware"
 	"email_campaign/internal/repository"
 	"email_campaign/internal/service"
+	"email_campaign/internal/storage"
+	"email_campaign/internal/tracking"
 	"email_campaign/internal/utils"
 )
 
 type Server struct {
-	port int
-	db   database.Service
+	port    int
+	db      database.Service
+	uploads *storage.Filesystem
 
 	// Handlers
 	authHandler         *handler.AuthHandler
@@ -33,9 +38,35 @@ type Server struct {
 	subscriptionHandler *handler.SubscriptionHandler
 	retryQueueHandler   *handler.RetryQueueHandler
 	reportHandler       *handler.ReportHandler
+	webhookHandler      *handler.WebhookHandler
+	mediaHandler        *handler.MediaHandler
+	blockHandler        *handler.BlockHandler
+	bundleHandler       *handler.TemplateBundleHandler
+	importHandler       *handler.ImportHandler
+	customFieldHandler  *handler.CustomFieldHandler
 }
 
-func NewServer(cfg *config.Config, db database.Service) *http.Server {
+// HTTPServer is the API server. Shutdown also flushes tracking events
+// still buffered once the last request has finished, and stops the import
+// workers, whose jobs resume on the next start.
+type HTTPServer struct {
+	*http.Server
+	events  *tracking.Pipeline
+	imports service.ImportService
+}
+
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	err := s.Server.Shutdown(ctx)
+	if cerr := s.events.Close(ctx); err == nil {
+		err = cerr
+	}
+	if cerr := s.imports.Close(ctx); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func NewServer(cfg *config.Config, db database.Service) *HTTPServer {
 	// Initialize Logger
 	if err := logger.Init("app.log"); err != nil {
 		fmt.Printf("Failed to initialize logger: %v\n", err)
@@ -56,28 +87,48 @@ func NewServer(cfg *config.Config, db database.Service) *http.Server {
 	subscriptionRepo := repository.NewSubscriptionRepository(sqlDB)
 	retryQueueRepo := repository.NewRetryQueueRepository(sqlDB)
 	reportRepo := repository.NewReportRepository(sqlDB)
+	webhookRepo := repository.NewWebhookRepository(sqlDB)
+	mediaRepo := repository.NewMediaRepository(sqlDB)
+	blockRepo := repository.NewBlockRepository(sqlDB)
+	importRepo := repository.NewImportRepository(sqlDB)
+	customFieldRepo := repository.NewCustomFieldRepository(sqlDB)
 
 	// Services
 	authSvc := service.NewAuthService(authRepo, userRepo)
 	userSvc := service.NewUserService(userRepo)
-	contactSvc := service.NewContactService(contactRepo)
-	templateSvc := service.NewTemplateService(templateRepo)
-	campaignSvc := service.NewCampaignService(campaignRepo)
+	uploads := storage.NewFilesystem("./uploads", tracking.PublicURLFromEnv()+"/uploads")
+	files := storage.NewResolver(settingsRepo, uploads)
+	contactSvc := service.NewContactService(contactRepo, customFieldRepo, files)
+	templateSvc := service.NewTemplateService(templateRepo, blockRepo)
+	verp, err := bounce.VERPFromEnv(cfg.JWTSecret)
+	if err != nil {
+		logger.Error("Invalid VERP configuration, sending without VERP return paths", map[string]interface{}{"error": err.Error()})
+	}
+	campaignSvc := service.NewCampaignService(campaignRepo, blockRepo, customFieldRepo, tracking.SignerFromEnv(cfg.JWTSecret), verp)
 	analyticsSvc := service.NewAnalyticsService(analyticsRepo)
 	searchSvc := service.NewSearchService(searchRepo)
-	publicSvc := service.NewPublicService(publicRepo)
+	publicSvc := service.NewPublicService(publicRepo, campaignSvc)
 	settingsSvc := service.NewSettingsService(settingsRepo)
 	tagSvc := service.NewTagService(tagRepo)
 	subscriptionSvc := service.NewSubscriptionService(subscriptionRepo)
 	retryQueueSvc := service.NewRetryQueueService(retryQueueRepo)
-	reportSvc := service.NewReportService(reportRepo)
+	reportSvc := service.NewReportService(reportRepo, files)
+	webhookSvc := service.NewWebhookService(webhookRepo, campaignSvc)
+	mediaSvc := service.NewMediaService(mediaRepo, settingsRepo, files)
+	blockSvc := service.NewBlockService(blockRepo)
+	bundleSvc := service.NewTemplateBundleService(templateSvc, blockSvc, mediaSvc, templateRepo, blockRepo, mediaRepo, settingsRepo, files)
+	importSvc := service.NewImportService(importRepo, contactRepo, tagRepo, customFieldRepo, templateSvc, files)
+	customFieldSvc := service.NewCustomFieldService(customFieldRepo)
+
+	// Opens and clicks are recorded in batches off the request path
+	events := tracking.NewPipeline(campaignSvc, tracking.PipelineConfigFromEnv())
 
 	// Handlers
 	authHandler := handler.NewAuthHandler(authSvc)
 	userHandler := handler.NewUserHandler(userSvc)
 	contactHandler := handler.NewContactHandler(contactSvc)
 	templateHandler := handler.NewTemplateHandler(templateSvc)
-	campaignHandler := handler.NewCampaignHandler(campaignSvc)
+	campaignHandler := handler.NewCampaignHandler(campaignSvc, events)
 	analyticsHandler := handler.NewAnalyticsHandler(analyticsSvc)
 	searchHandler := handler.NewSearchHandler(searchSvc)
 	publicHandler := handler.NewPublicHandler(publicSvc)
@@ -86,10 +137,17 @@ func NewServer(cfg *config.Config, db database.Service) *http.Server {
 	subscriptionHandler := handler.NewSubscriptionHandler(subscriptionSvc)
 	retryQueueHandler := handler.NewRetryQueueHandler(retryQueueSvc)
 	reportHandler := handler.NewReportHandler(reportSvc)
+	webhookHandler := handler.NewWebhookHandler(webhookSvc)
+	mediaHandler := handler.NewMediaHandler(mediaSvc)
+	blockHandler := handler.NewBlockHandler(blockSvc)
+	bundleHandler := handler.NewTemplateBundleHandler(bundleSvc)
+	importHandler := handler.NewImportHandler(importSvc)
+	customFieldHandler := handler.NewCustomFieldHandler(customFieldSvc)
 
 	NewServer := &Server{
 		port:                cfg.Port,
 		db:                  db,
+		uploads:             uploads,
 		authHandler:         authHandler,
 		userHandler:         userHandler,
 		contactHandler:      contactHandler,
@@ -103,6 +161,12 @@ func NewServer(cfg *config.Config, db database.Service) *http.Server {
 		subscriptionHandler: subscriptionHandler,
 		retryQueueHandler:   retryQueueHandler,
 		reportHandler:       reportHandler,
+		webhookHandler:      webhookHandler,
+		mediaHandler:        mediaHandler,
+		blockHandler:        blockHandler,
+		bundleHandler:       bundleHandler,
+		importHandler:       importHandler,
+		customFieldHandler:  customFieldHandler,
 	}
 
 	server := &http.Server{
@@ -113,7 +177,7 @@ func NewServer(cfg *config.Config, db database.Service) *http.Server {
 		WriteTimeout: 30 * time.Second,
 	}
 
-	return server
+	return &HTTPServer{Server: server, events: events, imports: importSvc}
 }
 
 func (s *Server) RegisterRoutes() http.Handler {
@@ -158,8 +222,22 @@ func (s *Server) RegisterRoutes() http.Handler {
 	mux.Handle("POST /api/v1/contacts/bulk/delete", middleware.AuthMiddleware(http.HandlerFunc(s.contactHandler.BulkDeleteContacts)))
 
 	// Import/Export
-	mux.Handle("POST /api/v1/contacts/import", middleware.AuthMiddleware(http.HandlerFunc(s.contactHandler.ImportContacts)))
+	mux.Handle("POST /api/v1/contacts/import", middleware.AuthMiddleware(http.HandlerFunc(s.importHandler.ImportContacts)))
 	mux.Handle("GET /api/v1/contacts/export", middleware.AuthMiddleware(http.HandlerFunc(s.contactHandler.ExportContacts)))
+	mux.Handle("GET /api/v1/contacts/exports/{id}", middleware.AuthMiddleware(http.HandlerFunc(s.contactHandler.DownloadExport)))
+
+	// Custom Field Routes
+	mux.Handle("GET /api/v1/custom-fields", middleware.AuthMiddleware(http.HandlerFunc(s.customFieldHandler.ListFields)))
+	mux.Handle("POST /api/v1/custom-fields", middleware.AuthMiddleware(http.HandlerFunc(s.customFieldHandler.CreateField)))
+	mux.Handle("GET /api/v1/custom-fields/{id}", middleware.AuthMiddleware(http.HandlerFunc(s.customFieldHandler.GetField)))
+	mux.Handle("PUT /api/v1/custom-fields/{id}", middleware.AuthMiddleware(http.HandlerFunc(s.customFieldHandler.UpdateField)))
+	mux.Handle("DELETE /api/v1/custom-fields/{id}", middleware.AuthMiddleware(http.HandlerFunc(s.customFieldHandler.DeleteField)))
+
+	// Imports
+	mux.Handle("POST /api/v1/imports/mailchimp", middleware.AuthMiddleware(http.HandlerFunc(s.importHandler.ImportMailchimp)))
+	mux.Handle("GET /api/v1/imports", middleware.AuthMiddleware(http.HandlerFunc(s.importHandler.ListJobs)))
+	mux.Handle("GET /api/v1/imports/{id}", middleware.AuthMiddleware(http.HandlerFunc(s.importHandler.GetJob)))
+	mux.Handle("GET /api/v1/imports/{id}/rejected", middleware.AuthMiddleware(http.HandlerFunc(s.importHandler.DownloadRejects)))
 
 	// Template Routes
 	mux.Handle("GET /api/v1/templates", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.ListTemplates)))
@@ -170,10 +248,40 @@ func (s *Server) RegisterRoutes() http.Handler {
 	mux.Handle("POST /api/v1/templates/{id}/duplicate", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.DuplicateTemplate)))
 	mux.Handle("POST /api/v1/templates/{id}/set-default", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.SetDefaultTemplate)))
 	mux.Handle("POST /api/v1/templates/{id}/preview", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.PreviewTemplate)))
-	mux.Handle("POST /api/v1/templates/upload/image", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.UploadTemplateImage)))
-
-	// Static Files (Uploads)
-	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("./uploads"))))
+	mux.Handle("POST /api/v1/templates/{id}/text", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.GenerateTemplateText)))
+	mux.Handle("GET /api/v1/templates/{id}/versions", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.ListTemplateVersions)))
+	mux.Handle("GET /api/v1/templates/{id}/versions/diff", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.DiffTemplateVersions)))
+	mux.Handle("GET /api/v1/templates/{id}/versions/{version}", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.GetTemplateVersion)))
+	mux.Handle("POST /api/v1/templates/{id}/versions/{version}/restore", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.RestoreTemplateVersion)))
+	mux.Handle("GET /api/v1/templates/{id}/locales", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.ListTemplateLocales)))
+	mux.Handle("GET /api/v1/templates/{id}/locales/{locale}", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.GetTemplateLocale)))
+	mux.Handle("PUT /api/v1/templates/{id}/locales/{locale}", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.SaveTemplateLocale)))
+	mux.Handle("DELETE /api/v1/templates/{id}/locales/{locale}", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.DeleteTemplateLocale)))
+	mux.Handle("POST /api/v1/templates/{id}/lint", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.LintTemplate)))
+	mux.Handle("GET /api/v1/templates/{id}/lint", middleware.AuthMiddleware(http.HandlerFunc(s.templateHandler.GetTemplateLint)))
+	mux.Handle("GET /api/v1/templates/{id}/export", middleware.AuthMiddleware(http.HandlerFunc(s.bundleHandler.ExportTemplate)))
+	mux.Handle("POST /api/v1/templates/import", middleware.AuthMiddleware(http.HandlerFunc(s.bundleHandler.ImportTemplate)))
+	mux.Handle("GET /api/v1/templates/gallery", middleware.AuthMiddleware(http.HandlerFunc(s.bundleHandler.ListStarters)))
+	mux.Handle("POST /api/v1/templates/gallery/{slug}/clone", middleware.AuthMiddleware(http.HandlerFunc(s.bundleHandler.CloneStarter)))
+	mux.Handle("POST /api/v1/templates/upload/image", middleware.AuthMiddleware(http.HandlerFunc(s.mediaHandler.UploadMedia)))
+
+	// Content Block Routes
+	mux.Handle("GET /api/v1/blocks", middleware.AuthMiddleware(http.HandlerFunc(s.blockHandler.ListBlocks)))
+	mux.Handle("POST /api/v1/blocks", middleware.AuthMiddleware(http.HandlerFunc(s.blockHandler.CreateBlock)))
+	mux.Handle("GET /api/v1/blocks/{id}", middleware.AuthMiddleware(http.HandlerFunc(s.blockHandler.GetBlock)))
+	mux.Handle("PUT /api/v1/blocks/{id}", middleware.AuthMiddleware(http.HandlerFunc(s.blockHandler.UpdateBlock)))
+	mux.Handle("DELETE /api/v1/blocks/{id}", middleware.AuthMiddleware(http.HandlerFunc(s.blockHandler.DeleteBlock)))
+	mux.Handle("GET /api/v1/blocks/{id}/usage", middleware.AuthMiddleware(http.HandlerFunc(s.blockHandler.GetBlockUsage)))
+
+	// Media Library Routes
+	mux.Handle("GET /api/v1/media", middleware.AuthMiddleware(http.HandlerFunc(s.mediaHandler.ListMedia)))
+	mux.Handle("POST /api/v1/media", middleware.AuthMiddleware(http.HandlerFunc(s.mediaHandler.UploadMedia)))
+	mux.Handle("GET /api/v1/media/usage", middleware.AuthMiddleware(http.HandlerFunc(s.mediaHandler.GetMediaUsage)))
+	mux.Handle("DELETE /api/v1/media/{id}", middleware.AuthMiddleware(http.HandlerFunc(s.mediaHandler.DeleteMedia)))
+
+	// Static Files (Uploads). Only media is public; reports, imports and
+	// exports are served through authenticated routes.
+	mux.Handle("GET /uploads/", http.StripPrefix("/uploads", s.uploads.Handler(storage.PublicPrefix)))
 
 	// Campaign Routes
 	mux.Handle("GET /api/v1/campaigns", middleware.AuthMiddleware(http.HandlerFunc(s.campaignHandler.ListCampaigns)))
@@ -189,19 +297,30 @@ func (s *Server) RegisterRoutes() http.Handler {
 	mux.Handle("POST /api/v1/campaigns/{id}/cancel", middleware.AuthMiddleware(http.HandlerFunc(s.campaignHandler.CancelCampaign)))
 	mux.Handle("GET /api/v1/campaigns/{id}/recipients", middleware.AuthMiddleware(http.HandlerFunc(s.campaignHandler.GetCampaignRecipients)))
 	mux.Handle("GET /api/v1/campaigns/{id}/stats", middleware.AuthMiddleware(http.HandlerFunc(s.campaignHandler.GetCampaignStats)))
+	mux.Handle("GET /api/v1/campaigns/{id}/stats/locales", middleware.AuthMiddleware(http.HandlerFunc(s.campaignHandler.GetLocaleStats)))
+	mux.Handle("GET /api/v1/campaigns/{id}/links", middleware.AuthMiddleware(http.HandlerFunc(s.campaignHandler.GetCampaignLinks)))
+	mux.Handle("GET /api/v1/campaigns/{id}/links/{linkId}", middleware.AuthMiddleware(http.HandlerFunc(s.campaignHandler.GetCampaignLink)))
+	mux.Handle("GET /api/v1/campaigns/{id}/links/preview", middleware.AuthMiddleware(http.HandlerFunc(s.campaignHandler.PreviewCampaignLinks)))
+	mux.Handle("GET /api/v1/campaigns/{id}/utm", middleware.AuthMiddleware(http.HandlerFunc(s.campaignHandler.GetCampaignUTM)))
+	mux.Handle("PUT /api/v1/campaigns/{id}/utm", middleware.AuthMiddleware(http.HandlerFunc(s.campaignHandler.UpdateCampaignUTM)))
 
 	// Public Tracking Routes
 	mux.Handle("GET /api/v1/track/open/{id}", http.HandlerFunc(s.campaignHandler.TrackOpen))
 	mux.Handle("GET /api/v1/track/click/{id}", http.HandlerFunc(s.campaignHandler.TrackClick))
 
-	// Webhook Routes (Public)
-	mux.Handle("POST /api/v1/webhooks/bounce", http.HandlerFunc(s.campaignHandler.WebhookBounce))
-	mux.Handle("POST /api/v1/webhooks/complaint", http.HandlerFunc(s.campaignHandler.WebhookComplaint))
-	mux.Handle("POST /api/v1/webhooks/delivery", http.HandlerFunc(s.campaignHandler.WebhookDelivery))
+	// Webhook Endpoint Routes
+	mux.Handle("GET /api/v1/webhooks/endpoints", middleware.AuthMiddleware(http.HandlerFunc(s.webhookHandler.ListEndpoints)))
+	mux.Handle("POST /api/v1/webhooks/endpoints", middleware.AuthMiddleware(http.HandlerFunc(s.webhookHandler.CreateEndpoint)))
+	mux.Handle("DELETE /api/v1/webhooks/endpoints/{id}", middleware.AuthMiddleware(http.HandlerFunc(s.webhookHandler.DeleteEndpoint)))
+
+	// Webhook Routes (Public, verified per provider)
+	mux.Handle("POST /api/v1/webhooks/{token}", http.HandlerFunc(s.webhookHandler.Receive))
 
 	// Analytics Routes (Detailed)
 	mux.Handle("GET /api/v1/analytics/dashboard", middleware.AuthMiddleware(http.HandlerFunc(s.analyticsHandler.GetDashboardStats)))
 	mux.Handle("GET /api/v1/analytics/campaigns/{id}/timeline", middleware.AuthMiddleware(http.HandlerFunc(s.analyticsHandler.GetCampaignTimeline)))
+	mux.Handle("GET /api/v1/analytics/campaigns/{id}/audience", middleware.AuthMiddleware(http.HandlerFunc(s.analyticsHandler.GetCampaignAudience)))
+	mux.Handle("GET /api/v1/analytics/audience/trend", middleware.AuthMiddleware(http.HandlerFunc(s.analyticsHandler.GetAudienceTrend)))
 	mux.Handle("POST /api/v1/analytics/campaigns/compare", middleware.AuthMiddleware(http.HandlerFunc(s.analyticsHandler.GetCampaignComparison)))
 	mux.Handle("GET /api/v1/analytics/contacts/{id}/engagement", middleware.AuthMiddleware(http.HandlerFunc(s.analyticsHandler.GetContactEngagement)))
 	mux.Handle("GET /api/v1/analytics/tags/{id}/performance", middleware.AuthMiddleware(http.HandlerFunc(s.analyticsHandler.GetTagPerformance)))
@@ -222,8 +341,15 @@ func (s *Server) RegisterRoutes() http.Handler {
 
 	// Public Routes
 	mux.HandleFunc("POST /api/v1/public/unsubscribe", s.publicHandler.Unsubscribe)
+	mux.HandleFunc("GET /api/v1/public/unsubscribe/{token}", s.publicHandler.UnsubscribePage)
+	mux.HandleFunc("POST /api/v1/public/unsubscribe/{token}", s.publicHandler.UnsubscribeLink)
 	mux.HandleFunc("POST /api/v1/public/resubscribe/{token}", s.publicHandler.Resubscribe)
 	mux.HandleFunc("POST /api/v1/public/preferences", s.publicHandler.UpdatePreferences)
+	mux.HandleFunc("GET /api/v1/public/view/{token}", s.publicHandler.ViewOnline)
+	mux.HandleFunc("GET /api/v1/public/archive/{slug}", s.publicHandler.ArchiveIndex)
+	mux.HandleFunc("GET /api/v1/public/archive/{slug}/rss", s.publicHandler.ArchiveRSS)
+	mux.HandleFunc("GET /api/v1/public/archive/{slug}/atom", s.publicHandler.ArchiveAtom)
+	mux.HandleFunc("GET /api/v1/public/archive/{slug}/campaigns/{id}", s.publicHandler.ArchivedCampaign)
 
 	// Settings Routes
 	mux.Handle("GET /api/v1/settings", middleware.AuthMiddleware(http.HandlerFunc(s.settingsHandler.GetSettings)))
@@ -232,6 +358,8 @@ func (s *Server) RegisterRoutes() http.Handler {
 	mux.Handle("POST /api/v1/settings/smtp/test", middleware.AuthMiddleware(http.HandlerFunc(s.settingsHandler.TestSMTP)))
 	mux.Handle("PUT /api/v1/settings/files", middleware.AuthMiddleware(http.HandlerFunc(s.settingsHandler.UpdateFileSettings)))
 	mux.Handle("PUT /api/v1/settings/privacy", middleware.AuthMiddleware(http.HandlerFunc(s.settingsHandler.UpdatePrivacySettings)))
+	mux.Handle("PUT /api/v1/settings/archive", middleware.AuthMiddleware(http.HandlerFunc(s.settingsHandler.UpdateArchiveSettings)))
+	mux.Handle("PUT /api/v1/settings/utm", middleware.AuthMiddleware(http.HandlerFunc(s.settingsHandler.UpdateUTMSettings)))
 
 	// Tag Routes
 	mux.Handle("GET /api/v1/tags", middleware.AuthMiddleware(http.HandlerFunc(s.tagHandler.ListTags)))
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"errors"
+
 	"email_campaign/internal/repository"
 	"email_campaign/internal/types"
 )
@@ -16,8 +18,13 @@ type AnalyticsService interface {
 	GetRecentCampaigns(limit int) ([]types.CampaignDTO, error)
 	GetRecentActivity(limit int) ([]types.ActivityDTO, error)
 	GetQuickStats() (*types.QuickStatsDTO, error)
+	GetCampaignAudience(campaignID uint64, userID uint64, humanOnly bool) (*types.CampaignAudienceDTO, error)
+	GetAudienceTrend(userID uint64, filter *types.AudienceTrendFilter) ([]types.AudienceTrendPoint, error)
 }
 
+// ErrInvalidAudienceFilter is returned for an unknown dimension or period.
+var ErrInvalidAudienceFilter = errors.New("dimension must be client, device, os or country and period day, week or month")
+
 type analyticsService struct {
 	repo repository.AnalyticsRepository
 }
@@ -57,3 +64,22 @@ func (s *analyticsService) GetRecentActivity(limit int) ([]types.ActivityDTO, er
 func (s *analyticsService) GetQuickStats() (*types.QuickStatsDTO, error) {
 	return s.repo.GetQuickStats()
 }
+func (s *analyticsService) GetCampaignAudience(campaignID uint64, userID uint64, humanOnly bool) (*types.CampaignAudienceDTO, error) {
+	return s.repo.GetCampaignAudience(campaignID, userID, humanOnly)
+}
+func (s *analyticsService) GetAudienceTrend(userID uint64, filter *types.AudienceTrendFilter) ([]types.AudienceTrendPoint, error) {
+	if filter.Period == "" {
+		filter.Period = "day"
+	}
+	switch filter.Dimension {
+	case "client", "device", "os", "country":
+	default:
+		return nil, ErrInvalidAudienceFilter
+	}
+	switch filter.Period {
+	case "day", "week", "month":
+	default:
+		return nil, ErrInvalidAudienceFilter
+	}
+	return s.repo.GetAudienceTrend(userID, filter)
+}
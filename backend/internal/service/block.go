@@ -0,0 +1,400 @@
+package service
+
+import (
+	"database/sql"
+	"email_campaign/internal/merge"
+	"email_campaign/internal/mjml"
+	"email_campaign/internal/render"
+	"email_campaign/internal/repository"
+	"email_campaign/internal/types"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type BlockService interface {
+	CreateBlock(req *types.CreateContentBlockRequest) (*types.ContentBlock, error)
+	GetBlock(id uint64, userID uint64) (*types.ContentBlock, error)
+	ListBlocks(userID uint64, search string, page, limit int) ([]types.ContentBlock, int, error)
+	UpdateBlock(id uint64, userID uint64, req *types.UpdateContentBlockRequest) (*types.ContentBlock, error)
+	DeleteBlock(id uint64, userID uint64) error
+	GetBlockUsage(id uint64, userID uint64) (*types.ContentBlockUsage, error)
+}
+
+type blockService struct {
+	repo repository.BlockRepository
+}
+
+func NewBlockService(repo repository.BlockRepository) BlockService {
+	return &blockService{repo: repo}
+}
+
+var blockNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+var (
+	ErrInvalidBlockName    = errors.New("block names are lowercase letters, digits, - and _, up to 64 characters")
+	ErrInvalidBlockType    = errors.New("block type must be html or mjml")
+	ErrBlockNameTaken      = errors.New("a content block with this name already exists")
+	ErrBlockInUse          = errors.New("content block is in use")
+	ErrBlockBreaksTemplate = errors.New("content block change breaks a template")
+)
+
+func (s *blockService) CreateBlock(req *types.CreateContentBlockRequest) (*types.ContentBlock, error) {
+	block := &types.ContentBlock{
+		UserID:      req.UserID,
+		Name:        req.Name,
+		Description: req.Description,
+		Type:        req.Type,
+		Content:     req.Content,
+	}
+	if err := s.validate(block); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateBlock(block); err != nil {
+		return nil, err
+	}
+	return s.repo.GetBlock(block.ID, block.UserID)
+}
+
+func (s *blockService) GetBlock(id uint64, userID uint64) (*types.ContentBlock, error) {
+	return s.repo.GetBlock(id, userID)
+}
+
+func (s *blockService) ListBlocks(userID uint64, search string, page, limit int) ([]types.ContentBlock, int, error) {
+	return s.repo.ListBlocks(userID, search, page, limit)
+}
+
+// UpdateBlock saves the change only if every template using the block
+// still renders with it. Unsent campaigns pick the change up at once.
+func (s *blockService) UpdateBlock(id uint64, userID uint64, req *types.UpdateContentBlockRequest) (*types.ContentBlock, error) {
+	block, err := s.repo.GetBlock(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	oldName := block.Name
+	if req.Name != "" {
+		block.Name = req.Name
+	}
+	if req.Description != nil {
+		block.Description = *req.Description
+	}
+	if req.Type != "" {
+		block.Type = req.Type
+	}
+	if req.Content != "" {
+		block.Content = req.Content
+	}
+	if err := s.validate(block); err != nil {
+		return nil, err
+	}
+
+	usage, err := s.usage(block, oldName)
+	if err != nil {
+		return nil, err
+	}
+	if block.Name != oldName && (len(usage.Templates) > 0 || len(usage.includedBy) > 0) {
+		return nil, fmt.Errorf("%w; it cannot be renamed while %s", ErrBlockInUse, usage.describe())
+	}
+	find := liveBlocks(s.repo, userID, block)
+	for _, t := range usage.templates {
+		if err := checkTemplateBlocks(&t, find); err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrBlockBreaksTemplate, t.Name, err)
+		}
+	}
+
+	if err := s.repo.UpdateBlock(block); err != nil {
+		return nil, err
+	}
+	return s.repo.GetBlock(id, userID)
+}
+
+// DeleteBlock refuses to remove a block that templates, other blocks or
+// unsent campaigns still include. Sent campaigns keep their own copy.
+func (s *blockService) DeleteBlock(id uint64, userID uint64) error {
+	block, err := s.repo.GetBlock(id, userID)
+	if err != nil {
+		return err
+	}
+	usage, err := s.usage(block, block.Name)
+	if err != nil {
+		return err
+	}
+	if len(usage.Templates) > 0 || len(usage.includedBy) > 0 {
+		return fmt.Errorf("%w; it is %s", ErrBlockInUse, usage.describe())
+	}
+	for _, c := range usage.Campaigns {
+		if !c.Frozen {
+			return fmt.Errorf("%w by campaign %q", ErrBlockInUse, c.Name)
+		}
+	}
+	return s.repo.DeleteBlock(id, userID)
+}
+
+func (s *blockService) GetBlockUsage(id uint64, userID uint64) (*types.ContentBlockUsage, error) {
+	block, err := s.repo.GetBlock(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.usage(block, block.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &usage.ContentBlockUsage, nil
+}
+
+// validate checks a block's name and type, its merge tags, and that its
+// includes resolve without looping back to it.
+func (s *blockService) validate(block *types.ContentBlock) error {
+	block.Name = strings.TrimSpace(block.Name)
+	if !blockNamePattern.MatchString(block.Name) {
+		return ErrInvalidBlockName
+	}
+	if block.Type == "" {
+		block.Type = "html"
+	}
+	if block.Type != "html" && block.Type != "mjml" {
+		return ErrInvalidBlockType
+	}
+	taken, err := s.repo.BlockNameTaken(block.UserID, block.Name, block.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrBlockNameTaken
+	}
+
+	check := merge.ValidateHTML
+	if block.Type == "mjml" {
+		check = merge.Validate
+	}
+	if err := check(block.Content); err != nil {
+		return inField(err, "content")
+	}
+	_, err = expandBlocks(block.Content, block.Type, liveBlocks(s.repo, block.UserID, block))
+	return inField(err, "content")
+}
+
+// blockUsage is a ContentBlockUsage with what the checks need besides.
+type blockUsage struct {
+	types.ContentBlockUsage
+	templates  []types.TemplateDTO
+	includedBy []string
+}
+
+func (u *blockUsage) describe() string {
+	var parts []string
+	for _, t := range u.Templates {
+		parts = append(parts, fmt.Sprintf("template %q", t.Name))
+	}
+	for _, b := range u.includedBy {
+		parts = append(parts, fmt.Sprintf("block %q", b))
+	}
+	return "included by " + strings.Join(parts, ", ")
+}
+
+// usage finds the templates that include the block, directly or through
+// other blocks, and the campaigns rendered from them. name is what the
+// block is saved as, which an update may be about to change.
+func (s *blockService) usage(block *types.ContentBlock, name string) (*blockUsage, error) {
+	blocks, err := s.repo.ListAllBlocks(block.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// Walk the includes backwards to every block that leads to this one.
+	includers := map[string][]string{}
+	for _, b := range blocks {
+		if b.ID == block.ID {
+			continue
+		}
+		for _, inc := range merge.Includes(b.Content) {
+			includers[inc] = append(includers[inc], b.Name)
+		}
+	}
+	u := &blockUsage{
+		ContentBlockUsage: types.ContentBlockUsage{
+			BlockID:   block.ID,
+			Name:      name,
+			Templates: []types.BlockTemplateUsage{},
+		},
+		includedBy: includers[name],
+	}
+	reaches := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, parent := range includers[n] {
+			if !reaches[parent] {
+				reaches[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	templates, err := s.repo.ListIncludingTemplates(block.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, t := range templates {
+		direct, indirect := false, false
+		for _, inc := range templateIncludes(&t) {
+			direct = direct || inc == name
+			indirect = indirect || reaches[inc]
+		}
+		if !direct && !indirect {
+			continue
+		}
+		u.templates = append(u.templates, t)
+		u.Templates = append(u.Templates, types.BlockTemplateUsage{ID: t.ID, Name: t.Name, Type: t.Type, Indirect: !direct})
+		ids = append(ids, t.ID)
+	}
+	sort.Slice(u.Templates, func(i, j int) bool { return u.Templates[i].Name < u.Templates[j].Name })
+
+	if u.Campaigns, err = s.repo.ListBlockCampaigns(block.UserID, ids, name); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// templateIncludes lists the blocks a template's content includes itself.
+func templateIncludes(t *types.TemplateDTO) []string {
+	src := t.HTMLContent
+	if t.Type == "mjml" {
+		src = t.MJMLContent
+	}
+	return append(merge.Includes(src), merge.Includes(t.TextContent)...)
+}
+
+// checkTemplateBlocks renders a template's includes with find, compiling
+// MJML templates, to see that they still work.
+func checkTemplateBlocks(t *types.TemplateDTO, find blockFinder) error {
+	if t.Type == "mjml" && t.MJMLContent != "" {
+		if _, err := compileMJML(t.MJMLContent, find); err != nil {
+			return err
+		}
+	} else if _, err := expandBlocks(t.HTMLContent, "html", find); err != nil {
+		return inField(err, "html_content")
+	}
+	_, err := expandBlocks(t.TextContent, "text", find)
+	return inField(err, "text_content")
+}
+
+// blockFinder looks up a block by name, returning merge.ErrUnknownBlock
+// when there is none.
+type blockFinder func(name string) (*types.ContentBlock, error)
+
+// liveBlocks looks a user's blocks up by name, remembering each one found.
+// A non-nil override stands in for the saved block with its ID.
+func liveBlocks(repo repository.BlockRepository, userID uint64, override *types.ContentBlock) blockFinder {
+	seen := map[string]*types.ContentBlock{}
+	return func(name string) (*types.ContentBlock, error) {
+		if override != nil && name == override.Name {
+			return override, nil
+		}
+		if b, ok := seen[name]; ok {
+			return b, nil
+		}
+		b, err := repo.GetBlockByName(userID, name)
+		if err == sql.ErrNoRows || err == nil && override != nil && b.ID == override.ID {
+			// The override may be renaming this block away.
+			return nil, merge.ErrUnknownBlock
+		}
+		if err != nil {
+			return nil, err
+		}
+		seen[name] = b
+		return b, nil
+	}
+}
+
+// expandBlocks replaces the include tags in content of a kind: "html",
+// "mjml" or "text". Text parts get the plain-text form of each block.
+func expandBlocks(src, kind string, find blockFinder) (string, error) {
+	if !merge.HasIncludes(src) {
+		return src, nil
+	}
+	return merge.Expand(src, func(name string) (string, error) {
+		b, err := find(name)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case kind == "text":
+			return blockText(b, find)
+		case kind == "html" && b.Type == "mjml":
+			return "", fmt.Errorf("%w: %q is an MJML block, which only MJML templates and blocks can include", merge.ErrIncludeNotAllowed, name)
+		}
+		return b.Content, nil
+	})
+}
+
+// blockText converts a block for a text part. Include tags survive the
+// conversion and are expanded by the caller.
+func blockText(b *types.ContentBlock, find blockFinder) (string, error) {
+	if b.Type != "mjml" {
+		return render.PlainText(b.Content)
+	}
+	src, err := expandBlocks(b.Content, "mjml", find)
+	if err != nil {
+		return "", err
+	}
+	// A block may be whole sections or just column content.
+	html, err := mjml.Compile("<mjml><mj-body>" + src + "</mj-body></mjml>")
+	if err != nil {
+		var err2 error
+		if html, err2 = mjml.Compile("<mjml><mj-body><mj-section><mj-column>" + src + "</mj-column></mj-section></mj-body></mjml>"); err2 != nil {
+			return "", err
+		}
+	}
+	return render.PlainText(html)
+}
+
+// compileMJML expands a template's includes and compiles it.
+func compileMJML(src string, find blockFinder) (string, error) {
+	expanded, err := expandBlocks(src, "mjml", find)
+	if err != nil {
+		return "", inField(err, "mjml_content")
+	}
+	return mjml.Compile(expanded)
+}
+
+// collectBlocks returns every block content includes, directly or
+// through other blocks.
+func collectBlocks(find blockFinder, contents ...string) ([]types.ContentBlock, error) {
+	var blocks []types.ContentBlock
+	seen := map[string]bool{}
+	var queue []string
+	for _, c := range contents {
+		queue = append(queue, merge.Includes(c)...)
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		b, err := find(name)
+		if errors.Is(err, merge.ErrUnknownBlock) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, *b)
+		queue = append(queue, merge.Includes(b.Content)...)
+	}
+	return blocks, nil
+}
+
+// inField places merge errors in a field, passing other errors through.
+func inField(err error, field string) error {
+	var errs merge.Errors
+	if errors.As(err, &errs) {
+		return errs.InField(field)
+	}
+	return err
+}
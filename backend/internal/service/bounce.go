@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+
+	"email_campaign/internal/bounce"
+	"email_campaign/internal/logger"
+)
+
+type BounceService interface {
+	HandleMessage(msg *bounce.Message) error
+}
+
+type bounceService struct {
+	campaignSvc CampaignService
+	verp        *bounce.VERP
+}
+
+// NewBounceService returns the processor for inbound DSN and ARF reports.
+// verp may be nil when outgoing mail is not sent with VERP return paths.
+func NewBounceService(campaignSvc CampaignService, verp *bounce.VERP) BounceService {
+	return &bounceService{campaignSvc: campaignSvc, verp: verp}
+}
+
+// HandleMessage only returns an error for failures worth retrying. Messages
+// that are not reports, or that match nothing we sent, are logged and
+// dropped.
+func (s *bounceService) HandleMessage(msg *bounce.Message) error {
+	report, err := bounce.Parse(msg.Data)
+	if err != nil {
+		logger.Info("Ignoring inbound message", map[string]interface{}{"reason": err.Error()})
+		return nil
+	}
+
+	recipientID := s.recipientFromVERP(msg.Recipients, report)
+	for i := range report.Events {
+		event := &report.Events[i]
+		event.RecipientID = recipientID
+
+		err := s.campaignSvc.HandleBounceReport(event)
+		if errors.Is(err, ErrRecipientNotFound) {
+			logger.Info("Unmatched bounce report", map[string]interface{}{
+				"kind":       report.Kind,
+				"type":       event.Type,
+				"email":      event.Email,
+				"message_id": event.MessageID,
+			})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recipientFromVERP looks for our encoded return path among the envelope
+// recipients, the report's delivery headers and the original sender.
+func (s *bounceService) recipientFromVERP(envelope []string, report *bounce.Report) uint64 {
+	if s.verp == nil {
+		return 0
+	}
+
+	candidates := append(append([]string{}, envelope...), report.Addressees...)
+	candidates = append(candidates, report.OriginalReturnPath)
+	for _, addr := range candidates {
+		if id, ok := s.verp.Parse(addr); ok {
+			return id
+		}
+	}
+	return 0
+}
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"email_campaign/internal/bundle"
+	"email_campaign/internal/gallery"
+	"email_campaign/internal/logger"
+	"email_campaign/internal/merge"
+	"email_campaign/internal/repository"
+	"email_campaign/internal/storage"
+	"email_campaign/internal/types"
+)
+
+// MaxBundleSize is the largest template bundle accepted for import.
+const MaxBundleSize = 50 << 20
+
+var (
+	ErrBundleTooLarge = fmt.Errorf("bundle is larger than %dMB", MaxBundleSize>>20)
+	ErrBlockLoop      = errors.New("bundle blocks include each other in a loop")
+)
+
+type TemplateBundleService interface {
+	ExportTemplate(id uint64, userID uint64) (*bundle.Bundle, error)
+	ImportTemplate(userID uint64, r io.ReaderAt, size int64) (*types.TemplateImportResult, error)
+	ListStarters() ([]types.TemplateStarter, error)
+	CloneStarter(userID uint64, slug string) (*types.TemplateImportResult, error)
+}
+
+type templateBundleService struct {
+	templates    TemplateService
+	blocks       BlockService
+	media        MediaService
+	templateRepo repository.TemplateRepository
+	blockRepo    repository.BlockRepository
+	mediaRepo    repository.MediaRepository
+	settings     repository.SettingsRepository
+	files        *storage.Resolver
+}
+
+func NewTemplateBundleService(templates TemplateService, blocks BlockService, media MediaService,
+	templateRepo repository.TemplateRepository, blockRepo repository.BlockRepository, mediaRepo repository.MediaRepository,
+	settings repository.SettingsRepository, files *storage.Resolver) TemplateBundleService {
+	return &templateBundleService{
+		templates:    templates,
+		blocks:       blocks,
+		media:        media,
+		templateRepo: templateRepo,
+		blockRepo:    blockRepo,
+		mediaRepo:    mediaRepo,
+		settings:     settings,
+		files:        files,
+	}
+}
+
+// mediaURL matches the URL of a media library file on any backend. The
+// key it contains is "media/<user>/<id>/<variant>.<ext>".
+var mediaURL = regexp.MustCompile(`https?://[^\s"'()<>]*?/(media/(\d+)/([0-9a-f]{16})/)([a-z0-9]+)\.[a-z0-9]+(?:\?[^\s"'()<>]*)?`)
+
+// ExportTemplate bundles a template with its translations, the blocks it
+// includes and the library images any of them use. Images that cannot be
+// fetched, such as those left on a provider the user has moved away from,
+// keep their URLs.
+func (s *templateBundleService) ExportTemplate(id uint64, userID uint64) (*bundle.Bundle, error) {
+	t, err := s.templateRepo.GetTemplate(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := s.templateRepo.ListTemplateLocales(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	body := t.HTMLContent
+	if t.Type == "mjml" {
+		body = t.MJMLContent
+	}
+	contents := []string{body, t.TextContent}
+	locales := make([]*types.TemplateLocaleDTO, 0, len(summaries))
+	for _, l := range summaries {
+		full, err := s.templateRepo.GetTemplateLocale(id, userID, l.Locale)
+		if err != nil {
+			return nil, err
+		}
+		locales = append(locales, full)
+		contents = append(contents, full.MJMLContent, full.HTMLContent, full.TextContent)
+	}
+	blocks, err := collectBlocks(liveBlocks(s.blockRepo, userID, nil), contents...)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bundle.Bundle{
+		Manifest: bundle.Manifest{Name: t.Name, Subject: t.Subject, Type: t.Type},
+		Files:    map[string][]byte{},
+	}
+	store, provider := currentStore(s.settings, s.files, userID)
+	e := &assetExporter{
+		userID:   userID,
+		repo:     s.mediaRepo,
+		store:    store,
+		provider: provider,
+		bundle:   b,
+		used:     map[string]bool{},
+		paths:    map[string]string{},
+	}
+
+	if b.Body, err = e.portable(body); err != nil {
+		return nil, err
+	}
+	if b.Text, err = e.portable(t.TextContent); err != nil {
+		return nil, err
+	}
+	for _, l := range locales {
+		bl := bundle.Locale{Locale: l.Locale, Subject: l.Subject}
+		if t.Type == "mjml" {
+			bl.MJMLContent, err = e.portable(l.MJMLContent)
+		} else {
+			bl.HTMLContent, err = e.portable(l.HTMLContent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bl.TextContent, err = e.portable(l.TextContent); err != nil {
+			return nil, err
+		}
+		b.Locales = append(b.Locales, bl)
+	}
+	for _, blk := range blocks {
+		content, err := e.portable(blk.Content)
+		if err != nil {
+			return nil, err
+		}
+		b.Blocks = append(b.Blocks, bundle.Block{Name: blk.Name, Description: blk.Description, Type: blk.Type, Content: content})
+	}
+	return b, nil
+}
+
+// assetExporter copies the library images content uses into a bundle,
+// once each, and points the content at the copies.
+type assetExporter struct {
+	userID   uint64
+	repo     repository.MediaRepository
+	store    storage.Storage
+	provider string
+	bundle   *bundle.Bundle
+	used     map[string]bool
+	// paths maps key prefixes to asset paths, or to "" for images that
+	// stay where they are.
+	paths map[string]string
+}
+
+func (e *assetExporter) portable(content string) (string, error) {
+	var err error
+	out := mediaURL.ReplaceAllStringFunc(content, func(u string) string {
+		m := mediaURL.FindStringSubmatch(u)
+		if err != nil || m[2] != strconv.FormatUint(e.userID, 10) {
+			return u
+		}
+		var p string
+		if p, err = e.asset(m[1]); err != nil || p == "" {
+			return u
+		}
+		return bundle.Ref(p, m[4])
+	})
+	return out, err
+}
+
+func (e *assetExporter) asset(prefix string) (string, error) {
+	if p, ok := e.paths[prefix]; ok {
+		return p, nil
+	}
+	e.paths[prefix] = ""
+	if e.store == nil || len(e.bundle.Assets) >= bundle.MaxAssets {
+		return "", nil
+	}
+	media, err := e.repo.GetMediaByKeyPrefix(e.userID, prefix)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if media.Provider != e.provider {
+		logger.Info("Leaving image on previous provider out of bundle", map[string]interface{}{
+			"media_id": media.ID, "provider": media.Provider,
+		})
+		return "", nil
+	}
+
+	var key string
+	for _, v := range media.Variants {
+		if v.Name == "original" {
+			key = v.Key
+		}
+	}
+	if key == "" {
+		return "", nil
+	}
+	rc, err := e.store.Get(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, bundle.MaxAssetSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > bundle.MaxAssetSize {
+		return "", nil
+	}
+
+	p := bundle.AssetPath(media.Filename, e.used)
+	e.bundle.Assets = append(e.bundle.Assets, bundle.Asset{Path: p, Filename: media.Filename})
+	e.bundle.Files[p] = data
+	e.paths[prefix] = p
+	return p, nil
+}
+
+// ImportTemplate creates a template from a zipped bundle.
+func (s *templateBundleService) ImportTemplate(userID uint64, r io.ReaderAt, size int64) (*types.TemplateImportResult, error) {
+	if size > MaxBundleSize {
+		return nil, ErrBundleTooLarge
+	}
+	b, err := bundle.Open(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return s.importBundle(userID, b)
+}
+
+func (s *templateBundleService) ListStarters() ([]types.TemplateStarter, error) {
+	return gallery.List()
+}
+
+// CloneStarter copies a gallery template into the user's library.
+func (s *templateBundleService) CloneStarter(userID uint64, slug string) (*types.TemplateImportResult, error) {
+	b, err := gallery.Open(slug)
+	if err != nil {
+		return nil, err
+	}
+	return s.importBundle(userID, b)
+}
+
+// importBundle uploads the bundle's images into the media library, creates
+// the blocks the user does not have yet, then the template and its
+// translations, all with asset references swapped for the new image URLs.
+// A failure part way removes whatever had been created.
+func (s *templateBundleService) importBundle(userID uint64, b *bundle.Bundle) (result *types.TemplateImportResult, err error) {
+	var images []*types.MediaDTO
+	var created []*types.ContentBlock
+	var template *types.TemplateDTO
+	defer func() {
+		if err == nil {
+			return
+		}
+		if template != nil {
+			s.templateRepo.DeleteTemplate(template.ID, userID)
+		}
+		for _, blk := range created {
+			s.blockRepo.DeleteBlock(blk.ID, userID)
+		}
+		for _, m := range images {
+			if err := s.media.Delete(m.ID, userID); err != nil {
+				logger.Error("Failed to remove imported image", map[string]interface{}{"media_id": m.ID, "error": err.Error()})
+			}
+		}
+	}()
+
+	uploaded := map[string]*types.MediaDTO{}
+	for _, a := range b.Assets {
+		m, err := s.media.Upload(userID, bytes.NewReader(b.Files[a.Path]), a.Filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", a.Path, err)
+		}
+		images = append(images, m)
+		uploaded[a.Path] = m
+	}
+	resolve := func(content string) string {
+		return bundle.Resolve(content, func(p, variant string) (string, bool) {
+			m, ok := uploaded[p]
+			if !ok {
+				return "", false
+			}
+			for _, v := range m.Variants {
+				if v.Name == variant {
+					return v.URL, true
+				}
+			}
+			// Small images get no resized variants.
+			return m.URL, true
+		})
+	}
+
+	result = &types.TemplateImportResult{Images: len(images), BlocksCreated: []string{}, BlocksKept: []string{}}
+	var pending []bundle.Block
+	for _, blk := range b.Blocks {
+		_, err := s.blockRepo.GetBlockByName(userID, blk.Name)
+		if err == nil {
+			result.BlocksKept = append(result.BlocksKept, blk.Name)
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+		pending = append(pending, blk)
+	}
+	// Blocks are created after the blocks they include.
+	for len(pending) > 0 {
+		var later []bundle.Block
+		for _, blk := range pending {
+			if includesAny(blk.Content, pending, blk.Name) {
+				later = append(later, blk)
+				continue
+			}
+			block, err := s.blocks.CreateBlock(&types.CreateContentBlockRequest{
+				UserID:      userID,
+				Name:        blk.Name,
+				Description: blk.Description,
+				Type:        blk.Type,
+				Content:     resolve(blk.Content),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("block %q: %w", blk.Name, err)
+			}
+			created = append(created, block)
+			result.BlocksCreated = append(result.BlocksCreated, blk.Name)
+		}
+		if len(later) == len(pending) {
+			return nil, ErrBlockLoop
+		}
+		pending = later
+	}
+
+	req := &types.CreateTemplateRequest{
+		UserID:      userID,
+		Name:        b.Name,
+		Subject:     b.Subject,
+		Type:        b.Type,
+		TextContent: resolve(b.Text),
+	}
+	if b.Type == "mjml" {
+		req.MJMLContent = resolve(b.Body)
+	} else {
+		req.HTMLContent = resolve(b.Body)
+	}
+	if template, err = s.templates.CreateTemplate(req); err != nil {
+		return nil, err
+	}
+	for _, l := range b.Locales {
+		_, err := s.templates.SaveTemplateLocale(template.ID, userID, l.Locale, &types.SaveTemplateLocaleRequest{
+			Subject:     l.Subject,
+			MJMLContent: resolve(l.MJMLContent),
+			HTMLContent: resolve(l.HTMLContent),
+			TextContent: resolve(l.TextContent),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("locale %s: %w", l.Locale, err)
+		}
+	}
+	result.Locales = len(b.Locales)
+	result.Template = template
+	return result, nil
+}
+
+// includesAny reports whether content includes one of blocks other than
+// the one named self.
+func includesAny(content string, blocks []bundle.Block, self string) bool {
+	for _, name := range merge.Includes(content) {
+		for _, b := range blocks {
+			if b.Name == name && name != self {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,12 +1,24 @@
 package service
 
 import (
-	"encoding/base64"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"email_campaign/internal/bounce"
+	"email_campaign/internal/customfield"
+	"email_campaign/internal/geoip"
+	"email_campaign/internal/locale"
+	"email_campaign/internal/merge"
+	"email_campaign/internal/render"
 	"email_campaign/internal/repository"
+	"email_campaign/internal/tracking"
 	"email_campaign/internal/types"
 )
 
@@ -24,18 +36,56 @@ type CampaignService interface {
 	CancelCampaign(id uint64, userID uint64) error
 	GetCampaignRecipients(id uint64, userID uint64, page, limit int) ([]types.CampaignRecipientDTO, error)
 	GetCampaignStats(id uint64, userID uint64) (*types.CampaignStatsDTO, error)
-	TrackEvent(trackingID string, eventType string, userAgent string, ipAddress string, url string) error
-	HandleWebhookBounce(req *types.WebhookBounceRequest) error
-	HandleWebhookComplaint(req *types.WebhookComplaintRequest) error
-	HandleWebhookDelivery(req *types.WebhookDeliveryRequest) error
+	VerifyOpen(token string) (*tracking.Token, error)
+	ResolveClick(token string) (*tracking.Token, string, error)
+	VerifyView(token string) (*tracking.Token, error)
+	VerifyUnsubscribe(token string) (*tracking.Token, error)
+	ViewOnlineURL(campaignID uint64, recipientID uint64) string
+	UnsubscribeURL(campaignID uint64, recipientID uint64) string
+	RenderMessage(id uint64, userID uint64, recipientID uint64, contact *types.ContactDTO) (*types.RenderedMessage, error)
+	PrepareMessage(id uint64, userID uint64, recipientID uint64, contact *types.ContactDTO) (*types.OutgoingMessage, error)
+	RecordHits(hits []tracking.Event) error
+	TrackLinks(campaignID uint64, recipientID uint64, body string, tagger *render.UTMTagger) (string, error)
+	UTMTagger(id uint64, userID uint64, variant string) (*render.UTMTagger, error)
+	GetCampaignUTM(id uint64, userID uint64) (*types.CampaignUTMResponse, error)
+	UpdateCampaignUTM(id uint64, userID uint64, req *types.CampaignUTM) error
+	PreviewCampaignLinks(id uint64, userID uint64, variant string, lang string) (*types.LinkPreviewResponse, error)
+	GetLocaleStats(id uint64, userID uint64) ([]types.CampaignLocaleStats, error)
+	GetCampaignLinks(id uint64, userID uint64) ([]types.CampaignLinkStats, error)
+	GetCampaignLink(id uint64, linkID uint64, userID uint64, page, limit int) (*types.CampaignLinkDetail, error)
+	HandleDeliveryEvent(userID uint64, event *types.DeliveryEvent) error
+	HandleBounceReport(event *types.DeliveryEvent) error
 }
 
+// ErrRecipientNotFound is returned when a delivery event cannot be matched
+// to any message we sent.
+var ErrRecipientNotFound = errors.New("no recipient matches event")
+
 type campaignService struct {
-	repo repository.CampaignRepository
+	repo       repository.CampaignRepository
+	blocks     repository.BlockRepository
+	fields     repository.CustomFieldRepository
+	signer     *tracking.Signer
+	publicURL  string
+	links      *linkCache
+	classifier *tracking.Classifier
+	geo        *geoip.Reader
+	verp       *bounce.VERP
 }
 
-func NewCampaignService(repo repository.CampaignRepository) CampaignService {
-	return &campaignService{repo: repo}
+// verp may be nil when outgoing mail is not sent with VERP return paths.
+func NewCampaignService(repo repository.CampaignRepository, blocks repository.BlockRepository, fields repository.CustomFieldRepository, signer *tracking.Signer, verp *bounce.VERP) CampaignService {
+	return &campaignService{
+		repo:       repo,
+		blocks:     blocks,
+		fields:     fields,
+		signer:     signer,
+		verp:       verp,
+		publicURL:  tracking.PublicURLFromEnv(),
+		links:      newLinkCache(),
+		classifier: tracking.ClassifierFromEnv(),
+		geo:        geoip.FromEnv(),
+	}
 }
 
 func (s *campaignService) CreateCampaign(req *types.CreateCampaignRequest) error {
@@ -79,6 +129,35 @@ func (s *campaignService) SendCampaign(id uint64, userID uint64) error {
 		return nil // Already sending or done
 	}
 
+	// Later edits to its template and content blocks no longer reach
+	// this campaign.
+	if err := s.repo.PinTemplateVersion(id, userID); err != nil {
+		return err
+	}
+	content, err := s.repo.GetCampaignContent(id, userID)
+	if err != nil {
+		return err
+	}
+	contents := []string{content.MJML, content.HTML, content.Text}
+	locales, err := s.repo.GetCampaignLocales(id)
+	if err != nil {
+		return err
+	}
+	for _, tag := range locales {
+		l, err := s.repo.GetCampaignLocale(id, tag)
+		if err != nil {
+			return err
+		}
+		contents = append(contents, l.MJMLContent, l.HTMLContent, l.TextContent)
+	}
+	blocks, err := collectBlocks(liveBlocks(s.blocks, userID, nil), contents...)
+	if err != nil {
+		return err
+	}
+	if err := s.blocks.SnapshotCampaignBlocks(id, blocks); err != nil {
+		return err
+	}
+
 	// TODO: Trigger background worker to send logic
 
 	return s.repo.UpdateStatus(id, userID, types.CampaignStatusSending)
@@ -119,6 +198,17 @@ func (s *campaignService) GetCampaignStats(id uint64, userID uint64) (*types.Cam
 		UpdatedAt:         c.UpdatedAt,
 	}
 
+	counts, err := s.repo.GetEngagementCounts(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	stats.UniqueOpens = counts.UniqueOpens
+	stats.UniqueClicks = counts.UniqueClicks
+	stats.HumanOpenedCount = counts.HumanOpens
+	stats.HumanClickedCount = counts.HumanClicks
+	stats.UniqueHumanOpens = counts.UniqueHumanOpens
+	stats.UniqueHumanClicks = counts.UniqueHumanClicks
+
 	if c.SentCount > 0 {
 		stats.DeliveryRate = float64(c.DeliveredCount) / float64(c.SentCount) * 100
 		stats.BounceRate = float64(c.BouncedCount) / float64(c.SentCount) * 100
@@ -126,57 +216,634 @@ func (s *campaignService) GetCampaignStats(id uint64, userID uint64) (*types.Cam
 	if c.DeliveredCount > 0 {
 		stats.OpenRate = float64(c.OpenedCount) / float64(c.DeliveredCount) * 100
 		stats.ClickRate = float64(c.ClickedCount) / float64(c.DeliveredCount) * 100
+		// Recipients who opened or clicked, not events, so repeat opens
+		// can't push the rates past 100%.
+		stats.FilteredOpenRate = float64(counts.UniqueHumanOpens) / float64(c.DeliveredCount) * 100
+		stats.FilteredClickRate = float64(counts.UniqueHumanClicks) / float64(c.DeliveredCount) * 100
 		stats.UnsubscribeRate = float64(c.UnsubscribedCount) / float64(c.DeliveredCount) * 100
 	}
 
 	return stats, nil
 }
 
-func (s *campaignService) TrackEvent(trackingID string, eventType string, userAgent string, ipAddress string, url string) error {
-	// Decode trackingID (base64 of campaignID:contactID)
-	data, err := base64.StdEncoding.DecodeString(trackingID)
+// GetLocaleStats breaks a campaign's recipients down by the locale they
+// were sent, with rates worked out as in GetCampaignStats.
+func (s *campaignService) GetLocaleStats(id uint64, userID uint64) ([]types.CampaignLocaleStats, error) {
+	if _, err := s.repo.GetCampaign(id, userID); err != nil {
+		return nil, err
+	}
+	stats, err := s.repo.GetLocaleStats(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range stats {
+		l := &stats[i]
+		if l.SentCount > 0 {
+			l.BounceRate = float64(l.BouncedCount) / float64(l.SentCount) * 100
+		}
+		if l.DeliveredCount > 0 {
+			l.OpenRate = float64(l.OpenedCount) / float64(l.DeliveredCount) * 100
+			l.ClickRate = float64(l.ClickedCount) / float64(l.DeliveredCount) * 100
+		}
+	}
+	return stats, nil
+}
+
+// VerifyOpen checks a signed open token. Forged and expired tokens are
+// reported as errors but callers still serve the pixel.
+func (s *campaignService) VerifyOpen(token string) (*tracking.Token, error) {
+	return s.signer.Verify(token, tracking.KindOpen)
+}
+
+// ResolveClick verifies a click token and returns the registered link it
+// points at. The destination always comes from campaign_links, never from
+// the request, so the redirect cannot be pointed elsewhere.
+func (s *campaignService) ResolveClick(token string) (*tracking.Token, string, error) {
+	t, err := s.signer.Verify(token, tracking.KindClick)
+	if err != nil {
+		return nil, "", err
+	}
+
+	url, err := s.repo.GetLinkURL(t.CampaignID, t.LinkID)
+	if err == sql.ErrNoRows {
+		return nil, "", tracking.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return t, url, nil
+}
+
+func (s *campaignService) VerifyView(token string) (*tracking.Token, error) {
+	return s.signer.Verify(token, tracking.KindView)
+}
+
+func (s *campaignService) VerifyUnsubscribe(token string) (*tracking.Token, error) {
+	return s.signer.Verify(token, tracking.KindUnsubscribe)
+}
+
+// UnsubscribeURL is the signed link that unsubscribes one recipient.
+func (s *campaignService) UnsubscribeURL(campaignID uint64, recipientID uint64) string {
+	token := s.signer.Sign(tracking.Token{Kind: tracking.KindUnsubscribe, CampaignID: campaignID, RecipientID: recipientID})
+	return tracking.UnsubscribeURL(s.publicURL, token)
+}
+
+// ViewOnlineURL is the signed "view in browser" link for one recipient's
+// copy of a campaign.
+func (s *campaignService) ViewOnlineURL(campaignID uint64, recipientID uint64) string {
+	token := s.signer.Sign(tracking.Token{Kind: tracking.KindView, CampaignID: campaignID, RecipientID: recipientID})
+	return tracking.ViewURL(s.publicURL, token)
+}
+
+// RenderMessage merges a campaign's subject, HTML and text for one
+// recipient, in the translation closest to the contact's locale. Every
+// message is rendered through it, whether sent or viewed online. contact
+// is nil, and recipientID 0, when the campaign is rendered for nobody in
+// particular, as in the public archive. It writes nothing, so viewing a
+// message online doesn't change what was recorded when it was sent.
+func (s *campaignService) RenderMessage(id uint64, userID uint64, recipientID uint64, contact *types.ContactDTO) (*types.RenderedMessage, error) {
+	_, msg, err := s.render(id, userID, recipientID, contact)
+	return msg, err
+}
+
+// PrepareMessage is RenderMessage for sending: its links go through click
+// tracking, with UTM parameters when the campaign has them, and it carries
+// the recipient's open-tracking pixel. It records the
+// locale the recipient is sent, and gives the message a Message-ID, stored
+// on the recipient so provider events and bounce reports can be matched to
+// it, and the envelope sender to send it from, a VERP return path when
+// bounces are processed. The sender must use both.
+func (s *campaignService) PrepareMessage(id uint64, userID uint64, recipientID uint64, contact *types.ContactDTO) (*types.OutgoingMessage, error) {
+	c, msg, err := s.render(id, userID, recipientID, contact)
+	if err != nil {
+		return nil, err
+	}
+	tagger, err := s.UTMTagger(id, userID, "")
 	if err != nil {
-		return fmt.Errorf("invalid tracking id: %v", err)
+		return nil, err
+	}
+	if msg.HTML, err = s.TrackLinks(id, recipientID, msg.HTML, tagger); err != nil {
+		return nil, err
+	}
+	open := s.signer.Sign(tracking.Token{Kind: tracking.KindOpen, CampaignID: id, RecipientID: recipientID})
+	msg.HTML = render.InsertOpenPixel(msg.HTML, tracking.OpenURL(s.publicURL, open))
+	if err := s.repo.SetRecipientLocale(recipientID, c.Locale); err != nil {
+		return nil, err
+	}
+	out := &types.OutgoingMessage{
+		RenderedMessage: *msg,
+		ReturnPath:      c.FromEmail,
+		UnsubscribeURL:  s.UnsubscribeURL(id, recipientID),
+	}
+	if s.verp != nil {
+		out.ReturnPath = s.verp.Address(recipientID)
+	}
+
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if _, d, ok := strings.Cut(out.ReturnPath, "@"); ok && d != "" {
+		domain = d
 	}
-	parts := strings.Split(string(data), ":")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid tracking id format")
+	out.MessageID = fmt.Sprintf("<%s.%d@%s>", hex.EncodeToString(b), recipientID, domain)
+	if err := s.repo.SetRecipientMessageID(recipientID, out.MessageID); err != nil {
+		return nil, err
 	}
+	return out, nil
+}
 
-	campaignID, err := strconv.ParseUint(parts[0], 10, 64)
+// render renders a message and returns the content it was rendered from.
+func (s *campaignService) render(id uint64, userID uint64, recipientID uint64, contact *types.ContactDTO) (*types.CampaignContent, *types.RenderedMessage, error) {
+	want := ""
+	if contact != nil {
+		want = contact.Locale
+	}
+	c, err := s.campaignContent(id, userID, want)
 	if err != nil {
-		return fmt.Errorf("invalid campaign id in tracking id")
+		return nil, nil, err
+	}
+
+	data := &types.MergeData{
+		Campaign: types.MergeCampaign{ID: c.ID, Name: c.Name, Subject: c.Subject},
+		Sender:   types.MergeSender{Name: c.FromName, Email: c.FromEmail, ReplyTo: c.ReplyToEmail},
+	}
+	if contact != nil {
+		schema, err := customFieldSchema(s.fields, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		data.Contact = mergeContact(contact, schema)
+	}
+	if recipientID != 0 {
+		data.ViewOnlineURL = s.ViewOnlineURL(id, recipientID)
+		data.UnsubscribeURL = s.UnsubscribeURL(id, recipientID)
+	}
+
+	msg := &types.RenderedMessage{}
+	if msg.Subject, err = merge.Text(c.Subject, data); err != nil {
+		return nil, nil, err
+	}
+	// Content refers to the subject the recipient actually sees.
+	data.Campaign.Subject = msg.Subject
+	if msg.HTML, err = merge.HTML(c.HTML, data); err != nil {
+		return nil, nil, err
+	}
+	// MJML output is inlined by the compiler; hand-written HTML is
+	// inlined here so clients that strip <style> still see the design.
+	if c.TemplateType == "html" {
+		if msg.HTML, err = render.InlineCSS(msg.HTML); err != nil {
+			return nil, nil, err
+		}
+	}
+	if c.Text == "" {
+		// Every message gets a text part, even when the template has none.
+		msg.Text, err = render.PlainText(msg.HTML)
+	} else {
+		msg.Text, err = merge.Text(c.Text, data)
 	}
-	contactID, err := strconv.ParseUint(parts[1], 10, 64)
 	if err != nil {
-		return fmt.Errorf("invalid contact id in tracking id")
+		return nil, nil, err
 	}
+	return c, msg, nil
+}
 
-	event := &types.EmailEventDTO{
-		CampaignID: campaignID,
-		ContactID:  contactID,
-		EventType:  eventType,
-		UserAgent:  userAgent,
-		IPAddress:  ipAddress,
-		Url:        url,
+// campaignContent is the campaign's template content in the translation
+// that best matches want, falling back to the user's default locale and
+// then to the template's own content, with its content blocks expanded.
+// Sent campaigns use the blocks they were sent with; the rest use each
+// block as it is now.
+func (s *campaignService) campaignContent(id uint64, userID uint64, want string) (*types.CampaignContent, error) {
+	c, err := s.repo.GetCampaignContent(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.translate(c, want); err != nil {
+		return nil, err
+	}
+	if !merge.HasIncludes(c.MJML) && !merge.HasIncludes(c.HTML) && !merge.HasIncludes(c.Text) {
+		return c, nil
 	}
 
-	return s.repo.RecordEvent(event)
+	find, err := s.campaignBlocks(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if c.TemplateType == "mjml" && merge.HasIncludes(c.MJML) {
+		html, err := compileMJML(c.MJML, find)
+		if err != nil {
+			return nil, err
+		}
+		// A text part generated from the HTML saved with the template
+		// is generated again from the current HTML.
+		if !merge.HasIncludes(c.Text) {
+			if text, err := render.PlainText(c.HTML); err == nil && text == c.Text {
+				c.Text = ""
+			}
+		}
+		c.HTML = html
+	} else if c.HTML, err = expandBlocks(c.HTML, "html", find); err != nil {
+		return nil, err
+	}
+	if c.Text, err = expandBlocks(c.Text, "text", find); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
-func (s *campaignService) HandleWebhookBounce(req *types.WebhookBounceRequest) error {
-	// In a real system, we would map req.MessageID to a campaign_recipient record.
-	// For this implementation, we will log it and attempt to find the contact by email if possible.
-	// 1. Find contact by email (This would require ContactRepo access or a join query in CampaignRepo)
-	// 2. Update status
-	// For now, we'll placeholder this.
+// translate swaps in the template translation for want, if there is one
+// close enough. A translation without a subject keeps the campaign's.
+func (s *campaignService) translate(c *types.CampaignContent, want string) error {
+	c.Locale = c.DefaultLocale
+	available, err := s.repo.GetCampaignLocales(c.ID)
+	if err != nil || len(available) == 0 {
+		return err
+	}
+	tag, ok := locale.Resolve(available, want, c.DefaultLocale)
+	if !ok {
+		return nil
+	}
+	l, err := s.repo.GetCampaignLocale(c.ID, tag)
+	if err != nil {
+		return err
+	}
+	c.Locale = l.Locale
+	if l.Subject != "" {
+		c.Subject = l.Subject
+	}
+	c.MJML = l.MJMLContent
+	c.HTML = l.HTMLContent
+	c.Text = l.TextContent
 	return nil
 }
 
-func (s *campaignService) HandleWebhookComplaint(req *types.WebhookComplaintRequest) error {
-	return nil
+// campaignBlocks finds the content blocks a campaign's includes refer to,
+// preferring the copies saved when it was sent.
+func (s *campaignService) campaignBlocks(id uint64, userID uint64) (blockFinder, error) {
+	sent, err := s.blocks.GetCampaignBlocks(id)
+	if err != nil {
+		return nil, err
+	}
+	live := liveBlocks(s.blocks, userID, nil)
+	return func(name string) (*types.ContentBlock, error) {
+		for i := range sent {
+			if sent[i].Name == name {
+				return &sent[i], nil
+			}
+		}
+		return live(name)
+	}, nil
+}
+
+// mergeContact is the merge language's view of a contact. Custom fields
+// the user has defined read in their type, or as their default when the
+// contact has no value.
+func mergeContact(c *types.ContactDTO, schema *customfield.Schema) *types.MergeContact {
+	m := &types.MergeContact{
+		Email:     c.Email,
+		FirstName: c.FirstName,
+		LastName:  c.LastName,
+		Phone:     c.Phone,
+		Company:   c.Company,
+		Custom:    map[string]interface{}{},
+		Tags:      make([]string, 0, len(c.Tags)),
+	}
+	if len(c.CustomFields) > 0 {
+		json.Unmarshal(c.CustomFields, &m.Custom)
+	}
+	m.Custom = schema.Typed(m.Custom)
+	for _, t := range c.Tags {
+		m.Tags = append(m.Tags, t.Name)
+	}
+	return m
 }
 
-func (s *campaignService) HandleWebhookDelivery(req *types.WebhookDeliveryRequest) error {
+// RecordHits classifies and stores a batch of verified opens and clicks
+// handed over by the tracking pipeline. Events for recipients that no
+// longer exist are dropped.
+func (s *campaignService) RecordHits(hits []tracking.Event) error {
+	if len(hits) == 0 {
+		return nil
+	}
+
+	ids := make([]uint64, 0, len(hits))
+	seen := make(map[uint64]bool, len(hits))
+	since := hits[0].At
+	for _, h := range hits {
+		if !seen[h.Token.RecipientID] {
+			seen[h.Token.RecipientID] = true
+			ids = append(ids, h.Token.RecipientID)
+		}
+		if h.At.Before(since) {
+			since = h.At
+		}
+	}
+
+	window := s.classifier.BurstWindow
+	contexts, err := s.repo.GetEventContexts(ids, since.Add(-window))
+	if err != nil {
+		return err
+	}
+
+	events := make([]types.EmailEventDTO, 0, len(hits))
+	bursts := map[uint64]time.Time{}
+	for _, h := range hits {
+		ctx := contexts[h.Token.RecipientID]
+		if ctx == nil || ctx.CampaignID != h.Token.CampaignID {
+			continue
+		}
+
+		hit := tracking.Hit{
+			Kind:          h.Token.Kind,
+			UserAgent:     h.UserAgent,
+			IPAddress:     h.IPAddress,
+			At:            h.At,
+			CampaignLinks: ctx.CampaignLinks,
+		}
+		if ctx.SentAt != nil {
+			hit.SentAt = *ctx.SentAt
+		}
+
+		eventType := "opened"
+		if h.Token.Kind == tracking.KindClick {
+			eventType = "clicked"
+			hit.RecentLinks = recentLinks(ctx.RecentClicks, h.Token.LinkID, h.At.Add(-window), h.At)
+			ctx.RecentClicks = append(ctx.RecentClicks, types.LinkClick{LinkID: h.Token.LinkID, At: h.At})
+		}
+
+		class := s.classifier.Classify(hit)
+		client := tracking.ParseUserAgent(h.UserAgent)
+		// Events spilled before ports were stripped may still carry one.
+		var ip string
+		if parsed := tracking.ParseIP(h.IPAddress); parsed != nil {
+			ip = parsed.String()
+		}
+		if class == tracking.ClassScanner && hit.Kind == tracking.KindClick && s.classifier.IsBurst(hit.RecentLinks+1, hit.CampaignLinks) {
+			bursts[h.Token.RecipientID] = h.At
+		}
+
+		events = append(events, types.EmailEventDTO{
+			CampaignID:          h.Token.CampaignID,
+			CampaignRecipientID: h.Token.RecipientID,
+			LinkID:              h.Token.LinkID,
+			EventType:           eventType,
+			Classification:      string(class),
+			EventAt:             h.At,
+			UserAgent:           h.UserAgent,
+			IPAddress:           ip,
+			Client:              client.Client,
+			OS:                  client.OS,
+			Device:              client.Device,
+			Country:             s.geo.Country(tracking.ParseIP(h.IPAddress)),
+			Url:                 h.URL,
+		})
+	}
+
+	if err := s.repo.RecordEvents(events); err != nil {
+		if errors.Is(err, repository.ErrEventRejected) {
+			return fmt.Errorf("%w: %v", tracking.ErrRejected, err)
+		}
+		return err
+	}
+
+	// The clicks that led up to a burst looked human on their own.
+	for recipientID, at := range bursts {
+		// created_at has whole seconds and may have been rounded up.
+		if err := s.repo.MarkClicks(recipientID, at.Add(-window), at.Add(time.Second), string(tracking.ClassScanner)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// recentLinks counts the distinct links other than linkID clicked between
+// from and to.
+func recentLinks(clicks []types.LinkClick, linkID uint64, from, to time.Time) int {
+	links := map[uint64]bool{}
+	for _, c := range clicks {
+		if c.LinkID != linkID && !c.At.Before(from) && !c.At.After(to) {
+			links[c.LinkID] = true
+		}
+	}
+	return len(links)
+}
+
+// TrackLinks rewrites the links in the HTML sent to one recipient into
+// signed click-tracking URLs. Each unique URL is registered once per
+// campaign, so every recipient's links share the same link IDs. When
+// tagger is set, UTM parameters are added before the URL is registered.
+func (s *campaignService) TrackLinks(campaignID uint64, recipientID uint64, body string, tagger *render.UTMTagger) (string, error) {
+	position := 0
+	return render.RewriteLinks(body, func(href string) (string, error) {
+		position++
+		if tagger != nil {
+			href = tagger.Tag(href, position)
+		}
+		linkID, err := s.linkID(campaignID, href)
+		if err != nil {
+			return "", err
+		}
+		token := s.signer.Sign(tracking.Token{
+			Kind:        tracking.KindClick,
+			CampaignID:  campaignID,
+			RecipientID: recipientID,
+			LinkID:      linkID,
+		})
+		return tracking.ClickURL(s.publicURL, token), nil
+	})
+}
+
+// UTMTagger returns the tagger for one send of a campaign, or nil when UTM
+// tagging is off for it.
+func (s *campaignService) UTMTagger(id uint64, userID uint64, variant string) (*render.UTMTagger, error) {
+	c, err := s.repo.GetCampaign(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	overrides, defaults, err := s.repo.GetCampaignUTM(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	return newUTMTagger(c, effectiveUTM(overrides, defaults), variant), nil
+}
+
+func (s *campaignService) GetCampaignUTM(id uint64, userID uint64) (*types.CampaignUTMResponse, error) {
+	overrides, defaults, err := s.repo.GetCampaignUTM(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &types.CampaignUTMResponse{Overrides: *overrides, Effective: effectiveUTM(overrides, defaults)}, nil
+}
+
+func (s *campaignService) UpdateCampaignUTM(id uint64, userID uint64, req *types.CampaignUTM) error {
+	if _, err := s.repo.GetCampaign(id, userID); err != nil {
+		return err
+	}
+	return s.repo.UpdateCampaignUTM(id, userID, req)
+}
+
+// PreviewCampaignLinks lists the campaign's tracked links in order with
+// the URL each one finally lands on, UTM parameters included. lang picks
+// the translation to preview, as RenderMessage would for a contact.
+func (s *campaignService) PreviewCampaignLinks(id uint64, userID uint64, variant string, lang string) (*types.LinkPreviewResponse, error) {
+	c, err := s.repo.GetCampaign(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	overrides, defaults, err := s.repo.GetCampaignUTM(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.campaignContent(id, userID, lang)
+	if err != nil {
+		return nil, err
+	}
+
+	utm := effectiveUTM(overrides, defaults)
+	tagger := newUTMTagger(c, utm, variant)
+	preview := &types.LinkPreviewResponse{UTM: utm, Links: []types.LinkPreview{}}
+
+	_, err = render.RewriteLinks(content.HTML, func(href string) (string, error) {
+		link := types.LinkPreview{Position: len(preview.Links) + 1, URL: href, FinalURL: href}
+		if tagger != nil {
+			link.FinalURL = tagger.Tag(href, link.Position)
+		}
+		preview.Links = append(preview.Links, link)
+		return href, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// effectiveUTM layers the campaign's overrides on the user's defaults,
+// which in turn fall back to render.DefaultUTM field by field.
+func effectiveUTM(overrides *types.CampaignUTM, defaults *types.UTMSettings) types.UTMSettings {
+	base := render.DefaultUTM()
+	utm := *defaults
+	for _, f := range []struct {
+		dst      *string
+		fallback string
+		override *string
+	}{
+		{&utm.Source, base.Source, overrides.Source},
+		{&utm.Medium, base.Medium, overrides.Medium},
+		{&utm.Campaign, base.Campaign, overrides.Campaign},
+		{&utm.Content, base.Content, overrides.Content},
+	} {
+		if *f.dst == "" {
+			*f.dst = f.fallback
+		}
+		if f.override != nil {
+			*f.dst = *f.override
+		}
+	}
+	if overrides.Enabled != nil {
+		utm.Enabled = *overrides.Enabled
+	}
+	return utm
+}
+
+func newUTMTagger(c *types.CampaignDTO, utm types.UTMSettings, variant string) *render.UTMTagger {
+	if !utm.Enabled {
+		return nil
+	}
+	return render.NewUTMTagger(
+		render.UTM{Source: utm.Source, Medium: utm.Medium, Campaign: utm.Campaign, Content: utm.Content},
+		render.UTMVars{CampaignID: c.ID, CampaignName: c.Name, Variant: variant},
+	)
+}
+
+func (s *campaignService) linkID(campaignID uint64, url string) (uint64, error) {
+	if id, ok := s.links.get(campaignID, url); ok {
+		return id, nil
+	}
+	id, err := s.repo.RegisterLink(campaignID, url)
+	if err != nil {
+		return 0, err
+	}
+	s.links.put(campaignID, url, id)
+	return id, nil
+}
+
+func (s *campaignService) GetCampaignLinks(id uint64, userID uint64) ([]types.CampaignLinkStats, error) {
+	return s.repo.GetLinkStats(id, userID)
+}
+
+func (s *campaignService) GetCampaignLink(id uint64, linkID uint64, userID uint64, page, limit int) (*types.CampaignLinkDetail, error) {
+	return s.repo.GetLinkClickers(id, linkID, userID, page, limit)
+}
+
+// HandleDeliveryEvent applies a bounce, complaint or delivery reported by a
+// provider webhook or an inbound bounce report to the matching recipient.
+func (s *campaignService) HandleDeliveryEvent(userID uint64, event *types.DeliveryEvent) error {
+	rcpt, err := s.repo.FindRecipientForEvent(userID, event.MessageID, event.Email)
+	if err == sql.ErrNoRows {
+		return ErrRecipientNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.repo.ApplyDeliveryEvent(rcpt, event)
+}
+
+// HandleBounceReport applies an event parsed from an inbound DSN or ARF
+// report. Those arrive at a shared return path rather than a per-user
+// endpoint, so they are matched by VERP recipient ID or by our Message-ID,
+// never by address alone.
+func (s *campaignService) HandleBounceReport(event *types.DeliveryEvent) error {
+	var rcpt *types.CampaignRecipientDTO
+	var err error
+	switch {
+	case event.RecipientID != 0:
+		rcpt, err = s.repo.GetRecipientForEvent(event.RecipientID)
+	case event.MessageID != "":
+		rcpt, err = s.repo.FindRecipientByMessageID(event.MessageID)
+	default:
+		return ErrRecipientNotFound
+	}
+	if err == sql.ErrNoRows {
+		return ErrRecipientNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.repo.ApplyDeliveryEvent(rcpt, event)
+}
+
+// linkCacheLimit bounds the link ID cache; it is simply emptied when full.
+const linkCacheLimit = 50000
+
+type linkKey struct {
+	campaignID uint64
+	url        string
+}
+
+// linkCache saves a database round trip per link per recipient while a
+// campaign is being rendered.
+type linkCache struct {
+	mu  sync.Mutex
+	ids map[linkKey]uint64
+}
+
+func newLinkCache() *linkCache {
+	return &linkCache{ids: make(map[linkKey]uint64)}
+}
+
+func (c *linkCache) get(campaignID uint64, url string) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.ids[linkKey{campaignID, url}]
+	return id, ok
+}
+
+func (c *linkCache) put(campaignID uint64, url string, id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.ids) >= linkCacheLimit {
+		c.ids = make(map[linkKey]uint64)
+	}
+	c.ids[linkKey{campaignID, url}] = id
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"email_campaign/internal/repository"
+	"email_campaign/internal/tracking"
+	"email_campaign/internal/types"
+)
+
+// fakeCampaignRepo serves one campaign's content and keeps what sending
+// records. Methods the tests don't reach are left to the nil interface.
+type fakeCampaignRepo struct {
+	repository.CampaignRepository
+
+	content    types.CampaignContent
+	links      []string
+	locales    map[uint64]string
+	messageIDs map[uint64]string
+}
+
+func newFakeCampaignRepo(html string) *fakeCampaignRepo {
+	return &fakeCampaignRepo{
+		content: types.CampaignContent{
+			ID: 7, UserID: 1, Name: "Spring", Subject: "Hello", FromEmail: "news@acme.test",
+			TemplateType: "html", HTML: html, Text: "Hi", DefaultLocale: "en",
+		},
+		locales:    map[uint64]string{},
+		messageIDs: map[uint64]string{},
+	}
+}
+
+func (f *fakeCampaignRepo) GetCampaign(id uint64, userID uint64) (*types.CampaignDTO, error) {
+	return &types.CampaignDTO{ID: id, UserID: userID, Name: f.content.Name}, nil
+}
+
+func (f *fakeCampaignRepo) GetCampaignContent(id uint64, userID uint64) (*types.CampaignContent, error) {
+	c := f.content
+	return &c, nil
+}
+
+func (f *fakeCampaignRepo) GetCampaignLocales(id uint64) ([]string, error) { return nil, nil }
+
+func (f *fakeCampaignRepo) GetCampaignUTM(id uint64, userID uint64) (*types.CampaignUTM, *types.UTMSettings, error) {
+	return &types.CampaignUTM{}, &types.UTMSettings{}, nil
+}
+
+func (f *fakeCampaignRepo) RegisterLink(campaignID uint64, url string) (uint64, error) {
+	f.links = append(f.links, url)
+	return uint64(len(f.links)), nil
+}
+
+func (f *fakeCampaignRepo) SetRecipientLocale(recipientID uint64, locale string) error {
+	f.locales[recipientID] = locale
+	return nil
+}
+
+func (f *fakeCampaignRepo) SetRecipientMessageID(recipientID uint64, messageID string) error {
+	f.messageIDs[recipientID] = messageID
+	return nil
+}
+
+var (
+	trackingToken    = regexp.MustCompile(`/api/v1/track/(open|click)/([A-Za-z0-9_-]+)`)
+	unsubscribeToken = regexp.MustCompile(`href="[^"]*/api/v1/public/unsubscribe/([A-Za-z0-9_-]+)"`)
+)
+
+func TestPrepareMessageTracksOpensAndClicks(t *testing.T) {
+	repo := newFakeCampaignRepo(`<html><body><p>Hi <a href="https://acme.test/spring">read</a></p>` +
+		`<p><a href="{{ unsubscribe_url }}">Unsubscribe</a></p></body></html>`)
+	signer := tracking.NewSigner([]byte("test secret"), time.Hour)
+	svc := NewCampaignService(repo, nil, nil, signer, nil)
+
+	msg, err := svc.PrepareMessage(7, 1, 42, nil)
+	if err != nil {
+		t.Fatalf("PrepareMessage: %v", err)
+	}
+
+	if strings.Contains(msg.HTML, `href="https://acme.test/spring"`) {
+		t.Errorf("link was sent untracked:\n%s", msg.HTML)
+	}
+	if len(repo.links) != 1 || repo.links[0] != "https://acme.test/spring" {
+		t.Errorf("registered links %q", repo.links)
+	}
+
+	found := map[string]*tracking.Token{}
+	for _, m := range trackingToken.FindAllStringSubmatch(msg.HTML, -1) {
+		kind := tracking.KindOpen
+		if m[1] == "click" {
+			kind = tracking.KindClick
+		}
+		tok, err := signer.Verify(m[2], kind)
+		if err != nil {
+			t.Fatalf("%s token does not verify: %v", m[1], err)
+		}
+		found[m[1]] = tok
+	}
+	for _, kind := range []string{"open", "click"} {
+		tok := found[kind]
+		if tok == nil {
+			t.Errorf("no %s token in:\n%s", kind, msg.HTML)
+			continue
+		}
+		if tok.CampaignID != 7 || tok.RecipientID != 42 {
+			t.Errorf("%s token is for campaign %d recipient %d", kind, tok.CampaignID, tok.RecipientID)
+		}
+	}
+	if !strings.HasSuffix(msg.HTML, "</body></html>") {
+		t.Errorf("open pixel not placed inside the body:\n%s", msg.HTML)
+	}
+
+	// The unsubscribe link is the recipient's own and is not click-tracked.
+	m := unsubscribeToken.FindStringSubmatch(msg.HTML)
+	if m == nil {
+		t.Fatalf("no unsubscribe link in:\n%s", msg.HTML)
+	}
+	if tok, err := signer.Verify(m[1], tracking.KindUnsubscribe); err != nil || tok.RecipientID != 42 {
+		t.Errorf("unsubscribe token %+v, %v", tok, err)
+	}
+	if !strings.Contains(msg.UnsubscribeURL, "/api/v1/public/unsubscribe/") {
+		t.Errorf("List-Unsubscribe URL %q", msg.UnsubscribeURL)
+	}
+
+	if repo.messageIDs[42] != msg.MessageID || msg.MessageID == "" {
+		t.Errorf("stored Message-ID %q, sent %q", repo.messageIDs[42], msg.MessageID)
+	}
+	if repo.locales[42] != "en" {
+		t.Errorf("recorded locale %q", repo.locales[42])
+	}
+	if msg.ReturnPath != "news@acme.test" {
+		t.Errorf("return path %q", msg.ReturnPath)
+	}
+}
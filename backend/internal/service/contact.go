@@ -2,10 +2,21 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"email_campaign/internal/customfield"
+	"email_campaign/internal/exporter"
+	"email_campaign/internal/locale"
 	"email_campaign/internal/repository"
+	"email_campaign/internal/storage"
 	"email_campaign/internal/types"
-	"email_campaign/internal/utils"
-	"errors"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"time"
 )
 
 type ContactService interface {
@@ -21,19 +32,32 @@ type ContactService interface {
 	BulkCreateContacts(userID uint64, req *types.BulkCreateContactsRequest) error
 	BulkUpdateContacts(userID uint64, req *types.BulkUpdateContactsRequest) error
 	BulkDeleteContacts(userID uint64, req *types.BulkDeleteContactsRequest) error
-	ImportContacts(userID uint64, req *types.ImportContactsRequest, fileType string) error
-	ExportContacts(userID uint64, filter *types.ContactFilter, format string) ([]byte, error)
+	ExportContacts(ctx context.Context, userID uint64, req *types.ExportContactsRequest, w io.Writer) (int, error)
+	ExportContactsToFile(ctx context.Context, userID uint64, req *types.ExportContactsRequest) (*types.ContactExportFile, error)
+	OpenContactExport(userID uint64, id string) (io.ReadCloser, string, error)
 }
 
 type contactService struct {
-	repo repository.ContactRepository
+	repo   repository.ContactRepository
+	fields repository.CustomFieldRepository
+	files  *storage.Resolver
 }
 
-func NewContactService(repo repository.ContactRepository) ContactService {
-	return &contactService{repo: repo}
+func NewContactService(repo repository.ContactRepository, fields repository.CustomFieldRepository, files *storage.Resolver) ContactService {
+	return &contactService{repo: repo, fields: fields, files: files}
 }
 
 func (s *contactService) CreateContact(req *types.CreateContactRequest) error {
+	if err := normalizeLocale(&req.Locale); err != nil {
+		return err
+	}
+	schema, err := customFieldSchema(s.fields, req.UserID)
+	if err != nil {
+		return err
+	}
+	if req.CustomFields, err = completeCustomFields(schema, req.CustomFields); err != nil {
+		return err
+	}
 	return s.repo.CreateContact(req)
 }
 
@@ -42,13 +66,68 @@ func (s *contactService) GetContact(id uint64, userId uint64) (*types.ContactDTO
 }
 
 func (s *contactService) ListContacts(ctx context.Context, filter *types.ContactFilter) ([]types.ContactListDTO, int64, error) {
+	fields, err := s.fields.ListFields(filter.UserID)
+	if err != nil {
+		return nil, 0, err
+	}
+	filter.CustomFields = fields
 	return s.repo.ListContacts(ctx, filter)
 }
 
 func (s *contactService) UpdateContact(contactID uint64, userID uint64, req *types.UpdateContactRequest) error {
+	if req.Locale != nil {
+		if err := normalizeLocale(req.Locale); err != nil {
+			return err
+		}
+	}
+	// The custom fields given replace the contact's, so they are checked
+	// as a whole.
+	if req.CustomFields != nil {
+		schema, err := customFieldSchema(s.fields, userID)
+		if err != nil {
+			return err
+		}
+		if req.CustomFields, err = completeCustomFields(schema, req.CustomFields); err != nil {
+			return err
+		}
+	}
 	return s.repo.UpdateContact(contactID, userID, req)
 }
 
+// completeCustomFields checks a contact's whole set of custom field values
+// against the user's definitions, filling in defaults. Nothing given and
+// nothing to fill in is left as nothing.
+func completeCustomFields(schema *customfield.Schema, raw json.RawMessage) (json.RawMessage, error) {
+	var values map[string]interface{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return nil, fmt.Errorf("%w: custom_fields must be a JSON object", customfield.ErrInvalidValue)
+		}
+	}
+	values, err := schema.Complete(values)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 && len(raw) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(values)
+}
+
+// normalizeLocale puts a contact's locale in canonical form. An empty
+// locale is left empty, so the user's default applies.
+func normalizeLocale(tag *string) error {
+	if *tag == "" {
+		return nil
+	}
+	n, err := locale.Normalize(*tag)
+	if err != nil {
+		return err
+	}
+	*tag = n
+	return nil
+}
+
 func (s *contactService) DeleteContact(contactID uint64, userID uint64) error {
 	return s.repo.DeleteContact(contactID, userID)
 }
@@ -70,6 +149,19 @@ func (s *contactService) UnsubscribeContact(contactID uint64, userID uint64) err
 }
 
 func (s *contactService) BulkCreateContacts(userID uint64, req *types.BulkCreateContactsRequest) error {
+	schema, err := customFieldSchema(s.fields, userID)
+	if err != nil {
+		return err
+	}
+	for i := range req.Contacts {
+		c := &req.Contacts[i]
+		if err := normalizeLocale(&c.Locale); err != nil {
+			return err
+		}
+		if c.CustomFields, err = completeCustomFields(schema, c.CustomFields); err != nil {
+			return fmt.Errorf("%s: %w", c.Email, err)
+		}
+	}
 	return s.repo.BulkCreateContacts(userID, req.Contacts)
 }
 
@@ -81,113 +173,110 @@ func (s *contactService) BulkDeleteContacts(userID uint64, req *types.BulkDelete
 	return s.repo.BulkDeleteContacts(userID, req.ContactIDs)
 }
 
-func (s *contactService) ImportContacts(userID uint64, req *types.ImportContactsRequest, fileType string) error {
-	var records []map[string]string
-	var err error
-
-	if fileType == "csv" {
-		records, err = utils.ParseCSV(req.FileData)
-	} else if fileType == "excel" {
-		records, err = utils.ParseExcel(req.FileData)
-	} else {
-		return errors.New("unsupported file type")
+// ExportContacts writes the contacts matching the request's filter to w,
+// a chunk at a time. The request is checked before anything is written.
+func (s *contactService) ExportContacts(ctx context.Context, userID uint64, req *types.ExportContactsRequest, w io.Writer) (int, error) {
+	format, err := prepareExport(req)
+	if err != nil {
+		return 0, err
 	}
-
+	req.Filter.UserID = userID
+	if req.Filter.CustomFields, err = s.fields.ListFields(userID); err != nil {
+		return 0, err
+	}
+	ew, err := exporter.NewWriter(w, format, req.Columns)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	if err := s.repo.StreamContacts(ctx, &req.Filter, slices.Contains(req.Columns, exporter.ColumnTags), ew.Write); err != nil {
+		ew.Discard()
+		return ew.Rows(), err
+	}
+	return ew.Rows(), ew.Close()
+}
 
-	var contacts []types.CreateContactRequest
-	for _, record := range records {
-		contact := types.CreateContactRequest{}
-
-		// Map fields based on user provided mapping or default
-		if email, ok := record[req.FieldMapping["email"]]; ok && email != "" {
-			contact.Email = email
-		} else if email, ok := record["email"]; ok && email != "" {
-			contact.Email = email
-		} else {
-			continue // Skip records without email
-		}
-
-		if name, ok := record[req.FieldMapping["first_name"]]; ok {
-			contact.FirstName = name
-		} else if name, ok := record["first_name"]; ok {
-			contact.FirstName = name
-		}
-
-		if name, ok := record[req.FieldMapping["last_name"]]; ok {
-			contact.LastName = name
-		} else if name, ok := record["last_name"]; ok {
-			contact.LastName = name
-		}
-
-		if phone, ok := record[req.FieldMapping["phone"]]; ok {
-			contact.Phone = phone
-		} else if phone, ok := record["phone"]; ok {
-			contact.Phone = phone
-		}
+// prepareExport fills in the request's defaults and checks it.
+func prepareExport(req *types.ExportContactsRequest) (exporter.Format, error) {
+	format, err := exporter.ParseFormat(req.Format)
+	if err != nil {
+		return "", err
+	}
+	req.Format = string(format)
+	if len(req.Columns) == 0 {
+		req.Columns = exporter.DefaultColumns
+	}
+	if err := exporter.CheckColumns(req.Columns); err != nil {
+		return "", err
+	}
+	return format, nil
+}
 
-		if company, ok := record[req.FieldMapping["company"]]; ok {
-			contact.Company = company
-		} else if company, ok := record["company"]; ok {
-			contact.Company = company
-		}
+var exportIDPattern = regexp.MustCompile(`^contacts-[0-9a-f]{16}\.(csv|xlsx|ndjson)$`)
 
-		contact.IsSubscribed = true // Default to subscribed on import
+// exportKey is where an export file is kept on the user's file backend.
+func exportKey(userID uint64, id string) string {
+	return fmt.Sprintf("exports/%d/%s", userID, id)
+}
 
-		contacts = append(contacts, contact)
+// ExportContactsToFile exports to the user's file storage instead, for
+// exports too large to wait for in a browser. The file is written to a
+// temporary file first, then stored.
+func (s *contactService) ExportContactsToFile(ctx context.Context, userID uint64, req *types.ExportContactsRequest) (*types.ContactExportFile, error) {
+	format, err := prepareExport(req)
+	if err != nil {
+		return nil, err
 	}
-
-	if len(contacts) == 0 {
-		return errors.New("no valid contacts found in file")
+	store, err := s.files.ForUser(userID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Process in batches of 100
-	batchSize := 100
-	for i := 0; i < len(contacts); i += batchSize {
-		end := i + batchSize
-		if end > len(contacts) {
-			end = len(contacts)
-		}
-
-		batch := contacts[i:end]
-		// In a real scenario, we might want to collect errors but continue
-		// For now fail fast or we could return a report
-		if err := s.repo.BulkCreateContacts(userID, batch); err != nil {
-			return err
-		}
+	tmp, err := os.CreateTemp("", "contacts-export-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	rows, err := s.ExportContacts(ctx, userID, req, tmp)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
 	}
 
-	return nil
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := "contacts-" + hex.EncodeToString(b) + "." + string(format)
+	if err := store.Put(exportKey(userID, id), tmp, format.ContentType()); err != nil {
+		return nil, err
+	}
+	return &types.ContactExportFile{
+		ID:          id,
+		Format:      string(format),
+		Rows:        rows,
+		Columns:     req.Columns,
+		DownloadURL: "/api/v1/contacts/exports/" + id,
+		CreatedAt:   time.Now(),
+	}, nil
 }
 
-func (s *contactService) ExportContacts(userID uint64, filter *types.ContactFilter, format string) ([]byte, error) {
-	// For export, we likely want all contacts matching filter, so high limit
-	// filter.Limit = 100000 // reasonable max for now
-	// filter.Page = 1
-
-	// contacts, _, err := s.repo.ListContacts(context.Background(), filter)
-	// if err != nil {
-	// 	return nil, err
-	// }
-
-	// var data []map[string]interface{}
-	// for _, c := range contacts {
-	// 	row := map[string]interface{}{
-	// 		"email":      c.Email,
-	// 		"first_name": c.FirstName,
-	// 		"last_name":  c.LastName,
-	// 		"phone":      c.Phone,
-	// 		"company":    c.Company,
-	// 		"created_at": c.CreatedAt.Format("2006-01-02 15:04:05"),
-	// 	}
-	// 	data = append(data, row)
-	// }
-
-	// if format == "csv" {
-	// 	return utils.GenerateCSV(data)
-	// }
-	// TODO: Excel generation if needed, reusing logic
-	return nil, errors.New("unsupported format")
+// OpenContactExport opens an export stored by ExportContactsToFile and
+// returns its content type.
+func (s *contactService) OpenContactExport(userID uint64, id string) (io.ReadCloser, string, error) {
+	m := exportIDPattern.FindStringSubmatch(id)
+	if m == nil {
+		return nil, "", storage.ErrNotFound
+	}
+	store, err := s.files.ForUser(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	rc, err := store.Get(exportKey(userID, id))
+	if err != nil {
+		return nil, "", err
+	}
+	return rc, exporter.Format(m[1]).ContentType(), nil
 }
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"email_campaign/internal/customfield"
+	"email_campaign/internal/repository"
+	"email_campaign/internal/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type CustomFieldService interface {
+	CreateField(req *types.CreateCustomFieldRequest) (*types.CustomField, error)
+	GetField(id uint64, userID uint64) (*types.CustomField, error)
+	ListFields(userID uint64) ([]types.CustomField, error)
+	UpdateField(id uint64, userID uint64, req *types.UpdateCustomFieldRequest) (*types.CustomField, error)
+	DeleteField(id uint64, userID uint64) error
+}
+
+type customFieldService struct {
+	repo repository.CustomFieldRepository
+}
+
+func NewCustomFieldService(repo repository.CustomFieldRepository) CustomFieldService {
+	return &customFieldService{repo: repo}
+}
+
+var ErrFieldKeyTaken = errors.New("a custom field with this key already exists")
+
+func (s *customFieldService) CreateField(req *types.CreateCustomFieldRequest) (*types.CustomField, error) {
+	field := &types.CustomField{
+		UserID:    req.UserID,
+		Key:       req.Key,
+		Label:     req.Label,
+		Type:      req.Type,
+		Required:  req.Required,
+		Default:   req.Default,
+		Options:   req.Options,
+		SortOrder: req.SortOrder,
+	}
+	if err := customfield.Check(field); err != nil {
+		return nil, err
+	}
+	taken, err := s.repo.FieldKeyTaken(field.UserID, field.Key)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrFieldKeyTaken
+	}
+	if err := s.repo.CreateField(field); err != nil {
+		return nil, err
+	}
+	return s.repo.GetField(field.ID, field.UserID)
+}
+
+func (s *customFieldService) GetField(id uint64, userID uint64) (*types.CustomField, error) {
+	return s.repo.GetField(id, userID)
+}
+
+func (s *customFieldService) ListFields(userID uint64) ([]types.CustomField, error) {
+	return s.repo.ListFields(userID)
+}
+
+// UpdateField changes a field's definition. Values contacts already have
+// are left as they are; they are checked against the new definition the
+// next time they are written.
+func (s *customFieldService) UpdateField(id uint64, userID uint64, req *types.UpdateCustomFieldRequest) (*types.CustomField, error) {
+	field, err := s.repo.GetField(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Label != "" {
+		field.Label = req.Label
+	}
+	if req.Type != "" {
+		field.Type = req.Type
+	}
+	if req.Required != nil {
+		field.Required = *req.Required
+	}
+	if req.Default != nil {
+		field.Default = nil
+		if err := json.Unmarshal(req.Default, &field.Default); err != nil {
+			return nil, fmt.Errorf("%w: the default is not a JSON value", customfield.ErrInvalidField)
+		}
+	}
+	if req.Options != nil {
+		field.Options = req.Options
+	}
+	if req.SortOrder != nil {
+		field.SortOrder = *req.SortOrder
+	}
+	if err := customfield.Check(field); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateField(field); err != nil {
+		return nil, err
+	}
+	return s.repo.GetField(id, userID)
+}
+
+// DeleteField removes a field's definition. Contacts keep their values
+// for it, untyped.
+func (s *customFieldService) DeleteField(id uint64, userID uint64) error {
+	return s.repo.DeleteField(id, userID)
+}
+
+// customFieldSchema loads the custom fields a user has defined.
+func customFieldSchema(repo repository.CustomFieldRepository, userID uint64) (*customfield.Schema, error) {
+	fields, err := repo.ListFields(userID)
+	if err != nil {
+		return nil, err
+	}
+	return customfield.NewSchema(fields), nil
+}
@@ -0,0 +1,546 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"email_campaign/internal/customfield"
+	"email_campaign/internal/importer"
+	"email_campaign/internal/logger"
+	"email_campaign/internal/mailchimp"
+	"email_campaign/internal/merge"
+	"email_campaign/internal/repository"
+	"email_campaign/internal/storage"
+	"email_campaign/internal/types"
+)
+
+const (
+	// MaxImportUploadSize bounds all the files of one import together.
+	MaxImportUploadSize = 256 << 20
+	// MaxTemplateImportSize bounds an imported template's HTML.
+	MaxTemplateImportSize = 5 << 20
+	MaxImportRows         = 1000000
+
+	importBatchSize = 500
+	// maxSkippedRows is how many skipped rows a summary lists; all are
+	// counted.
+	maxSkippedRows = 100
+)
+
+var (
+	ErrNothingToImport   = errors.New("upload an audience export, a template or both")
+	ErrNoAudienceFiles   = errors.New("zip has no CSV files")
+	ErrTooManyImportRows = fmt.Errorf("import has more than %d rows", MaxImportRows)
+	ErrImportTooLarge    = fmt.Errorf("upload is larger than %dMB", MaxImportUploadSize>>20)
+)
+
+// ImportFile is an uploaded file.
+type ImportFile struct {
+	Name string
+	Data io.ReaderAt
+	Size int64
+}
+
+type ImportService interface {
+	ImportMailchimp(userID uint64, files []ImportFile, req *types.MailchimpImportRequest) (*types.ImportJob, *types.MailchimpImportSummary, error)
+	ImportContacts(userID uint64, file ImportFile, req *types.ImportContactsRequest) (*types.ImportJob, error)
+	GetJob(id uint64, userID uint64) (*types.ImportJob, error)
+	ListJobs(userID uint64, page, limit int) ([]types.ImportJob, int, error)
+	WriteRejects(job *types.ImportJob, w io.Writer) error
+	// Close stops the workers. A job they were running is queued again
+	// and resumes where it stopped.
+	Close(ctx context.Context) error
+}
+
+type importService struct {
+	repo      repository.ImportRepository
+	contacts  repository.ContactRepository
+	tags      repository.TagRepository
+	fields    repository.CustomFieldRepository
+	templates TemplateService
+	files     *storage.Resolver
+
+	queue     chan uint64
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewImportService starts the workers that run contact imports in the
+// background.
+func NewImportService(repo repository.ImportRepository, contacts repository.ContactRepository, tags repository.TagRepository,
+	fields repository.CustomFieldRepository, templates TemplateService, files *storage.Resolver) ImportService {
+	s := &importService{
+		repo:      repo,
+		contacts:  contacts,
+		tags:      tags,
+		fields:    fields,
+		templates: templates,
+		files:     files,
+		queue:     make(chan uint64, importQueueSize),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	s.start()
+	return s
+}
+
+func (s *importService) GetJob(id uint64, userID uint64) (*types.ImportJob, error) {
+	job, err := s.repo.GetJob(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	withRejectedURL(job)
+	return job, nil
+}
+
+func (s *importService) ListJobs(userID uint64, page, limit int) ([]types.ImportJob, int, error) {
+	jobs, total, err := s.repo.ListJobs(userID, page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range jobs {
+		withRejectedURL(&jobs[i])
+	}
+	return jobs, total, nil
+}
+
+// audienceFile is a CSV of an export, uploaded as it is or inside a zip.
+type audienceFile struct {
+	name string
+	open func() (io.ReadCloser, error)
+}
+
+// audienceFiles lists the CSVs of the uploads. Mailchimp exports an
+// audience as a zip with a CSV for each status.
+func audienceFiles(files []ImportFile) ([]audienceFile, error) {
+	var out []audienceFile
+	for _, f := range files {
+		f := f
+		if !isZip(f) {
+			out = append(out, audienceFile{name: f.Name, open: func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(f.Data, 0, f.Size)), nil
+			}})
+			continue
+		}
+		zr, err := zip.NewReader(f.Data, f.Size)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		n := len(out)
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() || strings.HasPrefix(zf.Name, "__MACOSX/") ||
+				!strings.EqualFold(path.Ext(zf.Name), ".csv") {
+				continue
+			}
+			out = append(out, audienceFile{name: zf.Name, open: zf.Open})
+		}
+		if len(out) == n {
+			return nil, fmt.Errorf("%s: %w", f.Name, ErrNoAudienceFiles)
+		}
+	}
+	return out, nil
+}
+
+func isZip(f ImportFile) bool {
+	magic := make([]byte, 4)
+	if _, err := f.Data.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return string(magic) == "PK\x03\x04"
+}
+
+// ImportMailchimp imports a Mailchimp audience export, and a template
+// whose merge tags are converted to ours. Every file's header is checked
+// before anything is imported. A dry run reports what an import would do
+// and returns no job.
+func (s *importService) ImportMailchimp(userID uint64, files []ImportFile, req *types.MailchimpImportRequest) (*types.ImportJob, *types.MailchimpImportSummary, error) {
+	if len(files) == 0 && strings.TrimSpace(req.Template) == "" {
+		return nil, nil, ErrNothingToImport
+	}
+	sources, err := audienceFiles(files)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summary := &types.MailchimpImportSummary{
+		DryRun:       req.DryRun,
+		Files:        []types.MailchimpImportFile{},
+		Statuses:     map[string]int{},
+		TagsCreated:  []string{},
+		CustomFields: []string{},
+		SkippedRows:  []types.ImportRowError{},
+	}
+	var columns []mailchimp.Column
+	customFields := map[string]bool{}
+	for _, src := range sources {
+		rc, err := src.open()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", src.name, err)
+		}
+		rd, err := mailchimp.NewReader(rc, mailchimp.StatusFromFilename(src.name), req.GDPRFields)
+		rc.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", src.name, err)
+		}
+		file := types.MailchimpImportFile{Name: src.name, Status: string(mailchimp.StatusFromFilename(src.name))}
+		for _, c := range rd.Columns() {
+			file.Columns = append(file.Columns, types.ImportColumn{Header: c.Header, Kind: string(c.Kind), Key: c.Key})
+			switch c.Kind {
+			case mailchimp.KindCustom, mailchimp.KindConsent:
+				customFields[c.Key] = true
+			case mailchimp.KindGDPR:
+				customFields["gdpr"] = true
+			}
+		}
+		columns = append(columns, rd.Columns()...)
+		summary.Files = append(summary.Files, file)
+	}
+	for key := range customFields {
+		summary.CustomFields = append(summary.CustomFields, key)
+	}
+	sort.Strings(summary.CustomFields)
+
+	var job *types.ImportJob
+	if !req.DryRun {
+		job = &types.ImportJob{UserID: userID, Source: "mailchimp"}
+		if err := s.repo.CreateJob(job); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	schema, err := customFieldSchema(s.fields, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.TrimSpace(req.Template) != "" {
+		summary.Template = s.importTemplate(userID, req, mailchimp.MergeFields(columns, req.MergeFields))
+	}
+	im := &audienceImport{
+		svc:     s,
+		userID:  userID,
+		req:     req,
+		summary: summary,
+		schema:  schema,
+		tags:    map[string]uint64{},
+	}
+	var runErr error
+	for i, src := range sources {
+		if runErr = im.file(src, &summary.Files[i]); runErr != nil {
+			break
+		}
+	}
+	if runErr == nil {
+		runErr = im.flush()
+	}
+
+	if job == nil {
+		if runErr != nil {
+			return nil, nil, runErr
+		}
+		return nil, summary, nil
+	}
+	job.RowsDone = summary.Rows
+	job.Status, job.Progress = types.ImportCompleted, 100
+	if runErr != nil {
+		job.Status, job.Progress, job.Error = types.ImportFailed, 0, runErr.Error()
+	}
+	if job.Summary, err = json.Marshal(summary); err != nil {
+		return nil, nil, err
+	}
+	if err := s.repo.FinishJob(job); err != nil {
+		return nil, nil, err
+	}
+	logger.Info("Mailchimp import finished", map[string]interface{}{
+		"job_id": job.ID, "user_id": userID, "status": job.Status, "rows": summary.Rows,
+		"created": summary.Created, "updated": summary.Updated, "skipped": summary.Skipped,
+	})
+	return job, summary, runErr
+}
+
+var templateTitle = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// importTemplate converts the template and, unless this is a dry run,
+// creates it. Problems are reported in the summary rather than failing the
+// import.
+func (s *importService) importTemplate(userID uint64, req *types.MailchimpImportRequest, fields mailchimp.Fields) *types.MailchimpTemplateSummary {
+	conv := mailchimp.Convert(req.Template, fields)
+	result := &types.MailchimpTemplateSummary{Converted: conv.Converted, Issues: []types.MergeTagIssue{}}
+	for _, is := range conv.Issues {
+		result.Issues = append(result.Issues, types.MergeTagIssue{Tag: is.Tag, Count: is.Count, Message: is.Message})
+	}
+	if err := merge.ValidateHTML(conv.Content); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if req.DryRun {
+		return result
+	}
+
+	name := strings.TrimSpace(req.TemplateName)
+	if name == "" {
+		name = "Mailchimp import"
+	}
+	// Mailchimp templates usually title themselves with the subject.
+	subject := name
+	if m := templateTitle.FindStringSubmatch(conv.Content); m != nil {
+		if title := strings.TrimSpace(m[1]); title != "" && title != "{{ campaign.subject }}" {
+			subject = title
+		}
+	}
+	t, err := s.templates.CreateTemplate(&types.CreateTemplateRequest{
+		UserID:      userID,
+		Name:        name,
+		Subject:     subject,
+		Type:        "html",
+		HTMLContent: conv.Content,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Template = t
+	return result
+}
+
+// audienceImport streams members into contacts a batch at a time.
+type audienceImport struct {
+	svc     *importService
+	userID  uint64
+	req     *types.MailchimpImportRequest
+	summary *types.MailchimpImportSummary
+	schema  *customfield.Schema
+	batch   []types.ImportedContact
+	// from is where each contact of the batch came from.
+	from []types.ImportRowError
+	// tags caches tag IDs by lower-cased name; 0 marks a tag a dry run
+	// would create.
+	tags map[string]uint64
+}
+
+func (im *audienceImport) file(src audienceFile, file *types.MailchimpImportFile) error {
+	rc, err := src.open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", src.name, err)
+	}
+	defer rc.Close()
+	rd, err := mailchimp.NewReader(rc, mailchimp.StatusFromFilename(src.name), im.req.GDPRFields)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src.name, err)
+	}
+
+	for {
+		m, err := rd.Next()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			im.skip(src.name, parseErr.StartLine, "", parseErr.Err.Error())
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", src.name, err)
+		}
+		file.Rows++
+		if im.summary.Rows++; im.summary.Rows > MaxImportRows {
+			return ErrTooManyImportRows
+		}
+		if err := im.member(src.name, m); err != nil {
+			return err
+		}
+	}
+}
+
+func (im *audienceImport) skip(file string, row int, email, reason string) {
+	im.summary.Skipped++
+	if len(im.summary.SkippedRows) < maxSkippedRows {
+		im.summary.SkippedRows = append(im.summary.SkippedRows, types.ImportRowError{File: file, Row: row, Email: email, Reason: reason})
+	}
+}
+
+// member maps a member onto a contact. Unsubscribed, pending and
+// transactional members, and members who withheld email permission, are
+// not subscribed; cleaned members are bounced.
+func (im *audienceImport) member(file string, m *mailchimp.Member) error {
+	if m.Email == "" {
+		im.skip(file, m.Row, "", "email address is empty")
+		return nil
+	}
+	if !importer.ValidEmail(m.Email) {
+		im.skip(file, m.Row, m.Email, "email address is not valid")
+		return nil
+	}
+
+	c := types.ImportedContact{
+		Email:        m.Email,
+		FirstName:    truncate(m.FirstName, 100),
+		LastName:     truncate(m.LastName, 100),
+		Phone:        m.Phone,
+		Company:      truncate(m.Company, 255),
+		IsSubscribed: m.Status == mailchimp.StatusSubscribed,
+		IsBounced:    m.Status == mailchimp.StatusCleaned,
+		CustomFields: map[string]interface{}{},
+	}
+	im.summary.Statuses[string(m.Status)]++
+	if consent, ok := m.EmailConsent(); ok && !consent && c.IsSubscribed {
+		c.IsSubscribed = false
+		im.summary.NoConsent++
+	}
+	if !c.IsSubscribed || c.IsBounced {
+		im.summary.Suppressed++
+	}
+	for k, v := range m.Custom {
+		c.CustomFields[k] = v
+	}
+	if len(m.GDPR) > 0 {
+		c.CustomFields["gdpr"] = m.GDPR
+	}
+	// Longer numbers do not fit the phone column.
+	if utf8.RuneCountInString(c.Phone) > 20 {
+		c.CustomFields["phone"] = c.Phone
+		c.Phone = ""
+	}
+	values, err := im.schema.Check(c.CustomFields)
+	if err != nil {
+		im.skip(file, m.Row, m.Email, err.Error())
+		return nil
+	}
+	c.CustomFields = values
+
+	for _, name := range m.Tags {
+		id, err := im.tag(truncate(name, 100))
+		if err != nil {
+			return err
+		}
+		if id != 0 {
+			c.TagIDs = append(c.TagIDs, id)
+		} else {
+			// A tag a dry run would create.
+			im.summary.TagsAssigned++
+		}
+	}
+
+	im.batch = append(im.batch, c)
+	im.from = append(im.from, types.ImportRowError{File: file, Row: m.Row, Email: m.Email})
+	if len(im.batch) >= importBatchSize {
+		return im.flush()
+	}
+	return nil
+}
+
+// tag returns the ID of the named tag, creating it unless this is a dry
+// run.
+func (im *audienceImport) tag(name string) (uint64, error) {
+	key := strings.ToLower(name)
+	if id, ok := im.tags[key]; ok {
+		return id, nil
+	}
+	var ids map[string]uint64
+	var created []string
+	var err error
+	if im.req.DryRun {
+		if ids, err = im.svc.tags.FindTagsByName(im.userID, []string{name}); err == nil && ids[key] == 0 {
+			created = []string{name}
+		}
+	} else {
+		ids, created, err = im.svc.tags.EnsureTags(im.userID, []string{name})
+	}
+	if err != nil {
+		return 0, err
+	}
+	im.summary.TagsCreated = append(im.summary.TagsCreated, created...)
+	im.tags[key] = ids[key]
+	return ids[key], nil
+}
+
+func (im *audienceImport) flush() error {
+	if len(im.batch) == 0 {
+		return nil
+	}
+	defer func() { im.batch, im.from = im.batch[:0], im.from[:0] }()
+
+	var existing map[string]bool
+	if im.req.DryRun || im.schema.Fills() {
+		emails := make([]string, len(im.batch))
+		for i, c := range im.batch {
+			emails[i] = c.Email
+		}
+		var err error
+		if existing, err = im.svc.contacts.ExistingEmails(im.userID, emails); err != nil {
+			return err
+		}
+	}
+	if im.schema.Fills() {
+		im.completeNew(existing)
+	}
+
+	if im.req.DryRun {
+		for _, c := range im.batch {
+			im.summary.TagsAssigned += len(c.TagIDs)
+			if existing[c.Email] {
+				im.summary.Updated++
+			} else {
+				im.summary.Created++
+			}
+		}
+		return nil
+	}
+
+	outcomes, tagged, err := im.svc.contacts.UpsertImportedContacts(im.userID, im.batch)
+	if err != nil {
+		return err
+	}
+	im.summary.TagsAssigned += tagged
+	for _, o := range outcomes {
+		switch o {
+		case types.ImportCreated:
+			im.summary.Created++
+		case types.ImportUpdated:
+			im.summary.Updated++
+		default:
+			im.summary.Unchanged++
+		}
+	}
+	return nil
+}
+
+// completeNew gives the batch's new contacts the custom field defaults,
+// and skips those missing a required field.
+func (im *audienceImport) completeNew(existing map[string]bool) {
+	created := map[string]bool{}
+	batch := im.batch[:0]
+	for i, c := range im.batch {
+		if !existing[c.Email] && !created[c.Email] {
+			values, err := im.schema.Complete(c.CustomFields)
+			if err != nil {
+				im.skip(im.from[i].File, im.from[i].Row, c.Email, err.Error())
+				continue
+			}
+			c.CustomFields = values
+			created[c.Email] = true
+		}
+		batch = append(batch, c)
+	}
+	im.batch = batch
+}
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,536 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"email_campaign/internal/customfield"
+	"email_campaign/internal/importer"
+	"email_campaign/internal/logger"
+	"email_campaign/internal/storage"
+	"email_campaign/internal/types"
+)
+
+const (
+	// MaxContactImportSize bounds a contact import's CSV. Spreadsheets are
+	// read into memory, so they are kept smaller.
+	MaxContactImportSize = 1 << 30
+	MaxXLSXImportSize    = 100 << 20
+
+	importWorkers      = 2
+	importQueueSize    = 100
+	importPollInterval = 30 * time.Second
+	// A running job that has not saved progress for this long is taken to
+	// have lost its server and is queued again, up to maxImportAttempts
+	// times.
+	staleImportAfter  = 10 * time.Minute
+	maxImportAttempts = 3
+	maxRejectReason   = 255
+)
+
+var (
+	ErrInvalidImportMode  = errors.New("mode must be create, upsert or update")
+	ErrImportTagNotFound  = errors.New("tag not found")
+	ErrImportFileTooLarge = errors.New("file is too large to import")
+
+	// errImportStopped ends a job when the service closes; the job is
+	// queued again.
+	errImportStopped = errors.New("import stopped")
+)
+
+// ImportContacts stores the uploaded file and queues a job to import it.
+// The job's progress and summary are updated as it runs.
+func (s *importService) ImportContacts(userID uint64, file ImportFile, req *types.ImportContactsRequest) (*types.ImportJob, error) {
+	format, err := importer.FormatOf(file.Name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case format == importer.XLSX && file.Size > MaxXLSXImportSize:
+		return nil, fmt.Errorf("%w: .xlsx files are limited to %dMB; save larger ones as .csv", ErrImportFileTooLarge, MaxXLSXImportSize>>20)
+	case file.Size > MaxContactImportSize:
+		return nil, fmt.Errorf("%w: files are limited to %dMB", ErrImportFileTooLarge, MaxContactImportSize>>20)
+	}
+
+	if req.Mode == "" {
+		req.Mode = types.ImportModeUpsert
+	}
+	switch req.Mode {
+	case types.ImportModeCreate, types.ImportModeUpsert, types.ImportModeUpdate:
+	default:
+		return nil, ErrInvalidImportMode
+	}
+	if err := importer.CheckMapping(req.FieldMapping); err != nil {
+		return nil, err
+	}
+	for _, id := range req.TagIDs {
+		tag, err := s.tags.GetTag(id)
+		if err != nil || tag.UserID != userID {
+			return nil, fmt.Errorf("%w: %d", ErrImportTagNotFound, id)
+		}
+	}
+
+	store, err := s.files.ForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	options, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	// The job is queued once its file is stored, so no worker sees it
+	// before then.
+	job := &types.ImportJob{
+		UserID:   userID,
+		Source:   "contacts",
+		Status:   types.ImportRunning,
+		Options:  options,
+		FileName: file.Name,
+		FileSize: file.Size,
+	}
+	if err := s.repo.CreateJob(job); err != nil {
+		return nil, err
+	}
+	// The key is random: it holds a whole contact list and must not be
+	// guessable from the job's ID.
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, s.abandonJob(store, job, err)
+	}
+	job.FileKey = fmt.Sprintf("imports/%d/%s.%s", userID, hex.EncodeToString(b), format)
+	if err := store.Put(job.FileKey, io.NewSectionReader(file.Data, 0, file.Size), "application/octet-stream"); err != nil {
+		return nil, s.abandonJob(store, job, err)
+	}
+	if err := s.repo.SetJobFile(job); err != nil {
+		return nil, s.abandonJob(store, job, err)
+	}
+	if err := s.repo.RequeueJob(job.ID); err != nil {
+		return nil, s.abandonJob(store, job, err)
+	}
+	job.Status = types.ImportQueued
+	s.enqueue(job.ID)
+
+	logger.Info("Contact import queued", map[string]interface{}{
+		"job_id": job.ID, "user_id": userID, "file": file.Name, "size": file.Size, "mode": req.Mode,
+	})
+	withRejectedURL(job)
+	return job, nil
+}
+
+// abandonJob fails a job that could not be queued and removes its upload.
+func (s *importService) abandonJob(store storage.Storage, job *types.ImportJob, err error) error {
+	job.Status, job.Error = types.ImportFailed, "queueing the import: "+err.Error()
+	if ferr := s.repo.FinishJob(job); ferr != nil {
+		logger.Error("Failed to fail import", map[string]interface{}{"job_id": job.ID, "error": ferr.Error()})
+	}
+	if job.FileKey != "" {
+		deleteImportFile(store, job)
+	}
+	return err
+}
+
+// deleteImportFile removes a job's upload once the job is over.
+func deleteImportFile(store storage.Storage, job *types.ImportJob) {
+	if err := store.Delete(job.FileKey); err != nil {
+		logger.Error("Failed to delete import file", map[string]interface{}{"job_id": job.ID, "error": err.Error()})
+	}
+}
+
+// withRejectedURL links a contact import to its rejected rows.
+func withRejectedURL(job *types.ImportJob) {
+	if job.Source == "contacts" {
+		job.RejectedURL = fmt.Sprintf("/api/v1/imports/%d/rejected", job.ID)
+	}
+}
+
+// WriteRejects writes the rows a contact import rejected as CSV: the
+// file's own columns, then the row number and the reason.
+func (s *importService) WriteRejects(job *types.ImportJob, w io.Writer) error {
+	var header []string
+	if len(job.Summary) > 0 {
+		var summary types.ContactImportSummary
+		if err := json.Unmarshal(job.Summary, &summary); err != nil {
+			return err
+		}
+		for _, c := range summary.Columns {
+			header = append(header, c.Header)
+		}
+	}
+	rw, err := importer.NewRejects(w, header)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.EachReject(job.ID, func(rej types.ImportReject) error {
+		return rw.Add(rej.Row, rej.Record, rej.Reason)
+	}); err != nil {
+		return err
+	}
+	return rw.Flush()
+}
+
+func (s *importService) start() {
+	for i := 0; i < importWorkers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+	s.wg.Add(1)
+	go s.poll()
+	go func() {
+		s.wg.Wait()
+		close(s.done)
+	}()
+}
+
+func (s *importService) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue hands a job to a worker if one can take it soon. Jobs that do
+// not fit are found by the next poll.
+func (s *importService) enqueue(id uint64) {
+	select {
+	case s.queue <- id:
+	default:
+	}
+}
+
+// poll queues jobs left over from before a restart, or from other
+// servers, and recovers jobs whose server stopped.
+func (s *importService) poll() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(importPollInterval)
+	defer ticker.Stop()
+	for {
+		failed, err := s.repo.RecoverStaleJobs(staleImportAfter, maxImportAttempts)
+		if err != nil {
+			logger.Error("Failed to recover stale imports", map[string]interface{}{"error": err.Error()})
+		}
+		for i := range failed {
+			if store, err := s.files.ForUser(failed[i].UserID); err == nil {
+				deleteImportFile(store, &failed[i])
+			}
+		}
+		ids, err := s.repo.QueuedJobs(importQueueSize)
+		if err != nil {
+			logger.Error("Failed to list queued imports", map[string]interface{}{"error": err.Error()})
+		}
+		for _, id := range ids {
+			s.enqueue(id)
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *importService) work() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case id := <-s.queue:
+			s.runJob(id)
+		}
+	}
+}
+
+func (s *importService) runJob(id uint64) {
+	job, err := s.repo.ClaimJob(id)
+	if err != nil {
+		logger.Error("Failed to claim import", map[string]interface{}{"job_id": id, "error": err.Error()})
+		return
+	}
+	if job == nil {
+		return
+	}
+
+	runErr := s.importContacts(job)
+	if errors.Is(runErr, errImportStopped) {
+		if err := s.repo.RequeueJob(job.ID); err != nil {
+			logger.Error("Failed to requeue import", map[string]interface{}{"job_id": job.ID, "error": err.Error()})
+		}
+		return
+	}
+
+	if runErr != nil {
+		job.Status, job.Error = types.ImportFailed, runErr.Error()
+	} else {
+		job.Status, job.Progress = types.ImportCompleted, 100
+	}
+	if err := s.repo.FinishJob(job); err != nil {
+		logger.Error("Failed to finish import", map[string]interface{}{"job_id": job.ID, "error": err.Error()})
+		return
+	}
+	// The rejected rows are kept; the upload is not needed any more.
+	if store, err := s.files.ForUser(job.UserID); err == nil {
+		deleteImportFile(store, job)
+	}
+	logger.Info("Contact import finished", map[string]interface{}{
+		"job_id": job.ID, "user_id": job.UserID, "status": job.Status, "rows": job.RowsDone,
+	})
+}
+
+// importContacts runs a job from its last saved row. Each batch of rows is
+// imported, then the job's progress, summary and the batch's rejected rows
+// are saved together.
+func (s *importService) importContacts(job *types.ImportJob) error {
+	var req types.ImportContactsRequest
+	if err := json.Unmarshal(job.Options, &req); err != nil {
+		return err
+	}
+	summary := &types.ContactImportSummary{Mode: req.Mode, TagsCreated: []string{}, CustomFields: []string{}}
+	if len(job.Summary) > 0 {
+		if err := json.Unmarshal(job.Summary, summary); err != nil {
+			return err
+		}
+	}
+
+	format, err := importer.FormatOf(job.FileName)
+	if err != nil {
+		return err
+	}
+	store, err := s.files.ForUser(job.UserID)
+	if err != nil {
+		return err
+	}
+	rc, err := store.Get(job.FileKey)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	rows, err := importer.Open(rc, job.FileSize, format)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	mapper, err := importer.NewMapper(rows.Header(), req.FieldMapping, req.IgnoreUnmapped)
+	if err != nil {
+		return err
+	}
+	summary.Columns = mapper.Columns()
+	summary.CustomFields = append(summary.CustomFields[:0], mapper.CustomKeys()...)
+	schema, err := customFieldSchema(s.fields, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	im := &contactImport{svc: s, job: job, req: &req, summary: summary, mapper: mapper, schema: schema, rows: rows, tags: map[string]uint64{}}
+	for {
+		record, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return err
+		}
+		if rows.Row() <= job.RowsDone {
+			continue
+		}
+		if parseErr != nil {
+			summary.Rows++
+			im.reject(record, parseErr.Err.Error())
+		} else if !blank(record) {
+			summary.Rows++
+			if err := im.row(record); err != nil {
+				return err
+			}
+		}
+		if len(im.batch)+len(im.rejects) >= importBatchSize {
+			if err := im.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return im.flush()
+}
+
+func blank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// contactImport is a contact import job while it runs.
+type contactImport struct {
+	svc     *importService
+	job     *types.ImportJob
+	req     *types.ImportContactsRequest
+	summary *types.ContactImportSummary
+	mapper  *importer.Mapper
+	schema  *customfield.Schema
+	rows    importer.Rows
+	batch   []pendingContact
+	rejects []types.ImportReject
+	// tags caches tag IDs by lower-cased name.
+	tags map[string]uint64
+}
+
+type pendingContact struct {
+	row     int
+	record  []string
+	contact types.ImportedContact
+}
+
+func (im *contactImport) reject(record []string, reason string) {
+	im.summary.Rejected++
+	im.rejects = append(im.rejects, types.ImportReject{Row: im.rows.Row(), Record: record, Reason: truncate(reason, maxRejectReason)})
+}
+
+func (im *contactImport) row(record []string) error {
+	c, tags, reason := im.mapper.Contact(record)
+	if reason != "" {
+		im.reject(record, reason)
+		return nil
+	}
+	values, err := im.schema.Check(c.CustomFields)
+	if err != nil {
+		im.reject(record, err.Error())
+		return nil
+	}
+	c.CustomFields = values
+	for _, name := range tags {
+		id, err := im.tag(name)
+		if err != nil {
+			return err
+		}
+		c.TagIDs = append(c.TagIDs, id)
+	}
+	c.TagIDs = append(c.TagIDs, im.req.TagIDs...)
+	im.batch = append(im.batch, pendingContact{row: im.rows.Row(), record: record, contact: *c})
+	return nil
+}
+
+func (im *contactImport) tag(name string) (uint64, error) {
+	key := strings.ToLower(name)
+	if id, ok := im.tags[key]; ok {
+		return id, nil
+	}
+	ids, created, err := im.svc.tags.EnsureTags(im.job.UserID, []string{name})
+	if err != nil {
+		return 0, err
+	}
+	im.summary.TagsCreated = append(im.summary.TagsCreated, created...)
+	im.tags[key] = ids[key]
+	return ids[key], nil
+}
+
+// flush imports the batch as the mode allows and saves the job's progress.
+// It stops the job if the service is closing.
+func (im *contactImport) flush() error {
+	if len(im.batch) > 0 {
+		contacts, err := im.admit()
+		if err != nil {
+			return err
+		}
+		if len(contacts) > 0 {
+			outcomes, tagged, err := im.svc.contacts.UpsertImportedContacts(im.job.UserID, contacts)
+			if err != nil {
+				return err
+			}
+			im.summary.TagsAssigned += tagged
+			for _, o := range outcomes {
+				switch o {
+				case types.ImportCreated:
+					im.summary.Created++
+				case types.ImportUpdated:
+					im.summary.Updated++
+				default:
+					im.summary.Unchanged++
+				}
+			}
+		}
+	}
+
+	summary, err := json.Marshal(im.summary)
+	if err != nil {
+		return err
+	}
+	im.job.Summary = summary
+	im.job.RowsDone = im.rows.Row()
+	im.job.Progress = im.rows.Progress()
+	if err := im.svc.repo.SaveProgress(im.job, im.rejects); err != nil {
+		return err
+	}
+	im.batch, im.rejects = im.batch[:0], im.rejects[:0]
+
+	select {
+	case <-im.svc.stop:
+		return errImportStopped
+	default:
+		return nil
+	}
+}
+
+// admit returns the contacts of the batch the mode lets through and
+// rejects the rest: create only takes new emails, update only existing
+// ones. New contacts take the custom field defaults, and are rejected
+// without a required field.
+func (im *contactImport) admit() ([]types.ImportedContact, error) {
+	contacts := make([]types.ImportedContact, 0, len(im.batch))
+	if im.req.Mode == types.ImportModeUpsert && !im.schema.Fills() {
+		for _, p := range im.batch {
+			contacts = append(contacts, p.contact)
+		}
+		return contacts, nil
+	}
+
+	emails := make([]string, len(im.batch))
+	for i, p := range im.batch {
+		emails[i] = p.contact.Email
+	}
+	existing, err := im.svc.contacts.ExistingEmails(im.job.UserID, emails)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	created := map[string]bool{}
+	for _, p := range im.batch {
+		var reason string
+		switch {
+		case im.req.Mode == types.ImportModeCreate && existing[p.contact.Email]:
+			reason = "a contact with this email already exists"
+		case im.req.Mode == types.ImportModeCreate && seen[p.contact.Email]:
+			reason = "email appears earlier in the file"
+		case im.req.Mode == types.ImportModeUpdate && !existing[p.contact.Email]:
+			reason = "no contact has this email"
+		case !existing[p.contact.Email] && !created[p.contact.Email]:
+			values, err := im.schema.Complete(p.contact.CustomFields)
+			if err != nil {
+				reason = err.Error()
+				break
+			}
+			p.contact.CustomFields = values
+			created[p.contact.Email] = true
+		}
+		seen[p.contact.Email] = true
+		if reason != "" {
+			im.summary.Rejected++
+			im.rejects = append(im.rejects, types.ImportReject{Row: p.row, Record: p.record, Reason: truncate(reason, maxRejectReason)})
+			continue
+		}
+		contacts = append(contacts, p.contact)
+	}
+	return contacts, nil
+}
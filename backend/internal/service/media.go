@@ -0,0 +1,270 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"email_campaign/internal/imaging"
+	"email_campaign/internal/logger"
+	"email_campaign/internal/repository"
+	"email_campaign/internal/storage"
+	"email_campaign/internal/types"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// MaxUploadSize is the largest image file accepted.
+const MaxUploadSize = 10 << 20
+
+// MediaQuotas is how many bytes of media each plan may store, counting
+// every variant.
+var MediaQuotas = map[string]int64{
+	"free":         100 << 20,
+	"starter":      1 << 30,
+	"professional": 5 << 30,
+	"enterprise":   25 << 30,
+}
+
+var (
+	ErrFileTooLarge         = fmt.Errorf("file is larger than %dMB", MaxUploadSize>>20)
+	ErrFileTypeNotPermitted = errors.New("file type is not in the permitted extensions")
+)
+
+type MediaService interface {
+	Upload(userID uint64, file io.Reader, filename string) (*types.MediaDTO, error)
+	List(userID uint64, page, limit int) ([]types.MediaDTO, int, error)
+	Delete(id uint64, userID uint64) error
+	Usage(userID uint64) (*types.MediaUsage, error)
+}
+
+type mediaService struct {
+	repo     repository.MediaRepository
+	settings repository.SettingsRepository
+	files    *storage.Resolver
+}
+
+func NewMediaService(repo repository.MediaRepository, settings repository.SettingsRepository, files *storage.Resolver) MediaService {
+	return &mediaService{repo: repo, settings: settings, files: files}
+}
+
+// Upload checks what the file really is, re-encodes it with its email
+// variants and stores them on the user's file backend. The client's file
+// name is kept for display only.
+func (s *mediaService) Upload(userID uint64, file io.Reader, filename string) (*types.MediaDTO, error) {
+	data, err := io.ReadAll(io.LimitReader(file, MaxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxUploadSize {
+		return nil, ErrFileTooLarge
+	}
+
+	settings, err := s.settings.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	contentType := imaging.Sniff(data)
+	if _, ok := imaging.Formats[contentType]; !ok {
+		return nil, fmt.Errorf("%w: %s", imaging.ErrUnsupportedType, contentType)
+	}
+	if !permitted(settings.PermittedFileExtensions, contentType) {
+		return nil, ErrFileTypeNotPermitted
+	}
+
+	img, err := imaging.Process(data)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, v := range img.Variants {
+		size += int64(len(v.Data))
+	}
+	usage, err := s.Usage(userID)
+	if err != nil {
+		return nil, err
+	}
+	if usage.Used+size > usage.Quota {
+		return nil, repository.ErrQuotaExceeded
+	}
+
+	store, err := s.files.ForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	prefix := fmt.Sprintf("media/%d/%s/", userID, hex.EncodeToString(b))
+
+	media := &types.MediaDTO{
+		UserID:      userID,
+		Filename:    displayName(filename, img.Ext),
+		ContentType: img.ContentType,
+		Width:       img.Width,
+		Height:      img.Height,
+		Size:        size,
+		Provider:    providerName(settings),
+	}
+	for _, v := range img.Variants {
+		key := prefix + v.Name + "." + img.Ext
+		if err := store.Put(key, bytes.NewReader(v.Data), img.ContentType); err != nil {
+			s.removeFiles(store, media.Variants)
+			return nil, err
+		}
+		url, err := store.URL(key)
+		if err != nil {
+			return nil, err
+		}
+		media.Variants = append(media.Variants, types.MediaVariant{
+			Name: v.Name, Key: key, Width: v.Width, Height: v.Height, Size: int64(len(v.Data)), URL: url,
+		})
+	}
+
+	if err := s.repo.CreateMedia(media, usage.Quota); err != nil {
+		s.removeFiles(store, media.Variants)
+		return nil, err
+	}
+	media.URL = preferredURL(media.Variants)
+	return media, nil
+}
+
+func (s *mediaService) List(userID uint64, page, limit int) ([]types.MediaDTO, int, error) {
+	media, total, err := s.repo.ListMedia(userID, page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	store, provider := currentStore(s.settings, s.files, userID)
+	for i := range media {
+		m := &media[i]
+		// URLs on private buckets expire, so fresh ones are made while
+		// the files are still on the backend in use.
+		if store != nil && m.Provider == provider {
+			for j := range m.Variants {
+				if url, err := store.URL(m.Variants[j].Key); err == nil {
+					m.Variants[j].URL = url
+				}
+			}
+		}
+		m.URL = preferredURL(m.Variants)
+	}
+	return media, total, nil
+}
+
+// Delete removes the files and then the library entry. Files left on a
+// provider the user has since switched away from cannot be reached and
+// are only logged.
+func (s *mediaService) Delete(id uint64, userID uint64) error {
+	media, err := s.repo.GetMedia(id, userID)
+	if err != nil {
+		return err
+	}
+	store, provider := currentStore(s.settings, s.files, userID)
+	if store != nil && media.Provider == provider {
+		for _, v := range media.Variants {
+			if err := store.Delete(v.Key); err != nil {
+				return err
+			}
+		}
+	} else {
+		logger.Info("Leaving media files on previous provider", map[string]interface{}{
+			"media_id": media.ID, "provider": media.Provider,
+		})
+	}
+	return s.repo.DeleteMedia(id, userID)
+}
+
+func (s *mediaService) Usage(userID uint64) (*types.MediaUsage, error) {
+	plan, err := s.repo.GetPlan(userID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := s.repo.GetUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+	quota, ok := MediaQuotas[plan]
+	if !ok {
+		quota = MediaQuotas["free"]
+	}
+	return &types.MediaUsage{Plan: plan, Used: used, Quota: quota}, nil
+}
+
+// currentStore returns the user's backend and its provider name, or a nil
+// store when the settings no longer make a usable one.
+func currentStore(settingsRepo repository.SettingsRepository, files *storage.Resolver, userID uint64) (storage.Storage, string) {
+	settings, err := settingsRepo.GetSettings(userID)
+	if err != nil {
+		return nil, ""
+	}
+	store, err := files.ForUser(userID)
+	if err != nil {
+		return nil, ""
+	}
+	return store, providerName(settings)
+}
+
+func (s *mediaService) removeFiles(store storage.Storage, variants []types.MediaVariant) {
+	for _, v := range variants {
+		if err := store.Delete(v.Key); err != nil {
+			logger.Error("Failed to remove media file", map[string]interface{}{"key": v.Key, "error": err.Error()})
+		}
+	}
+}
+
+func providerName(settings *types.UserSettings) string {
+	if settings.FileProvider == "" {
+		return storage.ProviderFilesystem
+	}
+	return settings.FileProvider
+}
+
+// permitted reports whether a comma-separated extension list allows the
+// content type. An empty list allows every supported image type.
+func permitted(list string, contentType string) bool {
+	if strings.TrimSpace(list) == "" {
+		return true
+	}
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		for _, allowed := range imaging.Extensions[contentType] {
+			if ext == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// preferredURL is the 1200px variant when there is one, as it suits both
+// regular and retina screens at email width, else the original.
+func preferredURL(variants []types.MediaVariant) string {
+	url := ""
+	for _, v := range variants {
+		if v.Name == "1200" {
+			return v.URL
+		}
+		if v.Name == "original" {
+			url = v.URL
+		}
+	}
+	return url
+}
+
+// displayName keeps the base of the client's file name, with the
+// extension of the format actually stored.
+func displayName(filename, ext string) string {
+	base := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	name := strings.TrimSpace(strings.TrimSuffix(base, path.Ext(base)))
+	if name == "" || name == "." || name == "/" {
+		name = "image"
+	}
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	return strings.ToValidUTF8(name, "") + "." + ext
+}
@@ -1,26 +1,44 @@
 package service
 
 import (
+	"strconv"
+
+	"email_campaign/internal/merge"
+	"email_campaign/internal/render"
 	"email_campaign/internal/repository"
+	"email_campaign/internal/tracking"
 	"email_campaign/internal/types"
 )
 
+// archiveLimit caps how many campaigns the archive index and feeds list.
+const archiveLimit = 100
+
 type PublicService interface {
 	Unsubscribe(req *types.UnsubscribeRequest) error
 	Resubscribe(token string) error
 	UpdatePreferences(req *types.UpdatePreferencesRequest) error
+	ViewOnline(token string) (string, error)
+	GetArchive(slug string) (*render.ArchivePage, error)
+	GetArchivedCampaign(slug string, campaignID uint64) (string, error)
 }
 
 type publicService struct {
-	repo repository.PublicRepository
+	repo        repository.PublicRepository
+	campaignSvc CampaignService
+	publicURL   string
 }
 
-func NewPublicService(repo repository.PublicRepository) PublicService {
-	return &publicService{repo: repo}
+func NewPublicService(repo repository.PublicRepository, campaignSvc CampaignService) PublicService {
+	return &publicService{repo: repo, campaignSvc: campaignSvc, publicURL: tracking.PublicURLFromEnv()}
 }
 
+// Unsubscribe takes the signed token of a recipient's unsubscribe link.
 func (s *publicService) Unsubscribe(req *types.UnsubscribeRequest) error {
-	return s.repo.Unsubscribe(req.Token)
+	t, err := s.campaignSvc.VerifyUnsubscribe(req.Token)
+	if err != nil {
+		return err
+	}
+	return s.repo.UnsubscribeRecipient(t.CampaignID, t.RecipientID)
 }
 
 func (s *publicService) Resubscribe(token string) error {
@@ -30,3 +48,89 @@ func (s *publicService) Resubscribe(token string) error {
 func (s *publicService) UpdatePreferences(req *types.UpdatePreferencesRequest) error {
 	return s.repo.UpdatePreferences(req.Token, req.IsSubscribed)
 }
+
+// ViewOnline renders one recipient's copy of a campaign, merged with their
+// contact data and with the same tracked links as the email.
+func (s *publicService) ViewOnline(token string) (string, error) {
+	t, err := s.campaignSvc.VerifyView(token)
+	if err != nil {
+		return "", err
+	}
+	v, err := s.repo.GetRecipientView(t.CampaignID, t.RecipientID)
+	if err != nil {
+		return "", err
+	}
+
+	msg, err := s.campaignSvc.RenderMessage(v.CampaignID, v.UserID, v.RecipientID, &v.Contact)
+	if err != nil {
+		return "", err
+	}
+
+	tagger, err := s.campaignSvc.UTMTagger(v.CampaignID, v.UserID, "")
+	if err != nil {
+		return "", err
+	}
+	return s.campaignSvc.TrackLinks(v.CampaignID, v.RecipientID, msg.HTML, tagger)
+}
+
+func (s *publicService) GetArchive(slug string) (*render.ArchivePage, error) {
+	a, err := s.repo.GetArchive(slug)
+	if err != nil {
+		return nil, err
+	}
+	campaigns, err := s.repo.ListArchivedCampaigns(a.UserID, archiveLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	base := tracking.ArchiveURL(s.publicURL, slug)
+	page := &render.ArchivePage{
+		Title:   a.Title,
+		URL:     base,
+		RSSURL:  base + "/rss",
+		AtomURL: base + "/atom",
+		Entries: make([]render.ArchiveEntry, 0, len(campaigns)),
+	}
+	if page.Title == "" {
+		page.Title = "Campaign archive"
+	}
+	for _, c := range campaigns {
+		page.Entries = append(page.Entries, render.ArchiveEntry{
+			Title:  archiveSubject(c.Name, c.Subject),
+			URL:    base + "/campaigns/" + strconv.FormatUint(c.ID, 10),
+			SentAt: c.SentAt,
+		})
+	}
+	return page, nil
+}
+
+// GetArchivedCampaign renders a campaign for the public archive. It is
+// merged without a contact, so no recipient's data ever shows up.
+func (s *publicService) GetArchivedCampaign(slug string, campaignID uint64) (string, error) {
+	a, err := s.repo.GetArchive(slug)
+	if err != nil {
+		return "", err
+	}
+	c, err := s.repo.GetArchivedCampaign(a.UserID, campaignID)
+	if err != nil {
+		return "", err
+	}
+	msg, err := s.campaignSvc.RenderMessage(c.ID, a.UserID, 0, nil)
+	if err != nil {
+		return "", err
+	}
+	return msg.HTML, nil
+}
+
+// archiveSubject is the subject merged without personal data, falling back
+// to the campaign name when that leaves nothing.
+func archiveSubject(name, subject string) string {
+	data := &types.MergeData{Campaign: types.MergeCampaign{Name: name, Subject: subject}}
+	if merged, err := merge.Text(subject, data); err == nil {
+		subject = merged
+	}
+	if subject == "" {
+		return name
+	}
+	return subject
+}
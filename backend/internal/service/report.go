@@ -1,38 +1,82 @@
 package service
 
 import (
+	"crypto/rand"
 	"email_campaign/internal/repository"
+	"email_campaign/internal/storage"
 	"email_campaign/internal/types"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"regexp"
+	"strings"
 	"time"
 )
 
 type ReportService interface {
-	GenerateReport(req *types.GenerateReportRequest) (*types.ReportDTO, error)
-	DownloadReport(id string) ([]byte, string, error) // Returns content, filename, error
+	GenerateReport(userID uint64, req *types.GenerateReportRequest) (*types.ReportDTO, error)
+	DownloadReport(userID uint64, id string) ([]byte, string, error) // Returns content, filename, error
 }
 
 type reportService struct {
-	repo repository.ReportRepository
+	repo  repository.ReportRepository
+	files *storage.Resolver
 }
 
-func NewReportService(repo repository.ReportRepository) ReportService {
-	return &reportService{repo: repo}
+func NewReportService(repo repository.ReportRepository, files *storage.Resolver) ReportService {
+	return &reportService{repo: repo, files: files}
 }
 
-func (s *reportService) GenerateReport(req *types.GenerateReportRequest) (*types.ReportDTO, error) {
-	// Mock generation
+var reportIDPattern = regexp.MustCompile(`^report-[0-9a-f]{16}$`)
+
+// reportKey is where a report file is kept on the user's file backend.
+func reportKey(userID uint64, id string) string {
+	return fmt.Sprintf("reports/%d/%s.csv", userID, id)
+}
+
+func (s *reportService) GenerateReport(userID uint64, req *types.GenerateReportRequest) (*types.ReportDTO, error) {
+	store, err := s.files.ForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := "report-" + hex.EncodeToString(b)
+
+	// Mock content
+	content := "campaign_id,sent,delivered,opened\n1,100,90,50"
+	if err := store.Put(reportKey(userID, id), strings.NewReader(content), "text/csv"); err != nil {
+		return nil, err
+	}
+
 	return &types.ReportDTO{
-		ID:          fmt.Sprintf("report-%d", time.Now().Unix()),
+		ID:          id,
 		Type:        req.Type,
 		GeneratedAt: time.Now(),
 		Status:      "completed",
-		DownloadURL: "/api/v1/reports/report-123/download",
+		DownloadURL: "/api/v1/reports/" + id + "/download",
 	}, nil
 }
 
-func (s *reportService) DownloadReport(id string) ([]byte, string, error) {
-	// Mock CSV content
-	content := "campaign_id,sent,delivered,opened\n1,100,90,50"
-	return []byte(content), "report.csv", nil
+func (s *reportService) DownloadReport(userID uint64, id string) ([]byte, string, error) {
+	if !reportIDPattern.MatchString(id) {
+		return nil, "", storage.ErrNotFound
+	}
+	store, err := s.files.ForUser(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	rc, err := store.Get(reportKey(userID, id))
+	if err != nil {
+		return nil, "", err
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, id + ".csv", nil
 }
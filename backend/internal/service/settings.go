@@ -1,11 +1,14 @@
 package service
 
 import (
+	"email_campaign/internal/locale"
 	"email_campaign/internal/repository"
+	"email_campaign/internal/storage"
 	"email_campaign/internal/types"
 	"email_campaign/internal/utils"
 	"errors"
 	"fmt"
+	"strings"
 )
 
 type SettingsService interface {
@@ -15,8 +18,15 @@ type SettingsService interface {
 	TestSMTP(userID uint64, req *types.TestSMTPRequest) error
 	UpdateFileSettings(userID uint64, req *types.UpdateFileSettingsRequest) error
 	UpdatePrivacySettings(userID uint64, req *types.UpdatePrivacySettingsRequest) error
+	UpdateUTMSettings(userID uint64, req *types.UTMSettings) error
+	UpdateArchiveSettings(userID uint64, req *types.ArchiveSettings) error
 }
 
+var (
+	ErrInvalidArchiveSlug = errors.New("slug must be 3-64 lowercase letters, digits or hyphens")
+	ErrArchiveSlugTaken   = errors.New("slug is already in use")
+)
+
 type settingsService struct {
 	repo repository.SettingsRepository
 }
@@ -45,6 +55,13 @@ func (s *settingsService) UpdateSettings(userID uint64, req *types.UpdateSetting
 	if req.Timezone != "" {
 		settings.Timezone = req.Timezone
 	}
+	if req.DefaultLocale != "" {
+		tag, err := locale.Normalize(req.DefaultLocale)
+		if err != nil {
+			return err
+		}
+		settings.DefaultLocale = tag
+	}
 
 	return s.repo.UpdateSettings(settings)
 }
@@ -100,6 +117,7 @@ func (s *settingsService) UpdateFileSettings(userID uint64, req *types.UpdateFil
 	settings.FileProvider = req.FileProvider
 	settings.S3Bucket = req.S3Bucket
 	settings.S3Region = req.S3Region
+	settings.S3Endpoint = req.S3Endpoint
 	settings.S3AccessKey = req.S3AccessKey
 	settings.S3SecretKey = req.S3SecretKey
 	settings.S3BucketPath = req.S3BucketPath
@@ -110,6 +128,9 @@ func (s *settingsService) UpdateFileSettings(userID uint64, req *types.UpdateFil
 	settings.CloudinaryApiSecret = req.CloudinaryApiSecret
 	settings.PermittedFileExtensions = req.PermittedFileExtensions
 
+	if _, err := storage.New(settings, nil); err != nil {
+		return err
+	}
 	return s.repo.UpdateFileSettings(settings)
 }
 
@@ -124,3 +145,57 @@ func (s *settingsService) UpdatePrivacySettings(userID uint64, req *types.Update
 
 	return s.repo.UpdatePrivacySettings(settings)
 }
+
+func (s *settingsService) UpdateUTMSettings(userID uint64, req *types.UTMSettings) error {
+	settings, err := s.repo.GetSettings(userID)
+	if err != nil {
+		return err
+	}
+
+	settings.UTMEnabled = req.Enabled
+	settings.UTMSource = req.Source
+	settings.UTMMedium = req.Medium
+	settings.UTMCampaign = req.Campaign
+	settings.UTMContent = req.Content
+
+	return s.repo.UpdateUTMSettings(settings)
+}
+
+func (s *settingsService) UpdateArchiveSettings(userID uint64, req *types.ArchiveSettings) error {
+	settings, err := s.repo.GetSettings(userID)
+	if err != nil {
+		return err
+	}
+
+	slug := strings.TrimSpace(req.Slug)
+	if slug != "" || req.Enabled {
+		if !validArchiveSlug(slug) {
+			return ErrInvalidArchiveSlug
+		}
+		taken, err := s.repo.ArchiveSlugTaken(slug, userID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrArchiveSlugTaken
+		}
+	}
+
+	settings.ArchiveEnabled = req.Enabled
+	settings.ArchiveSlug = slug
+	settings.ArchiveTitle = strings.TrimSpace(req.Title)
+
+	return s.repo.UpdateArchiveSettings(settings)
+}
+
+func validArchiveSlug(slug string) bool {
+	if len(slug) < 3 || len(slug) > 64 || slug[0] == '-' || slug[len(slug)-1] == '-' {
+		return false
+	}
+	for _, c := range slug {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -1,20 +1,22 @@
 package service
 
 import (
-	"bytes"
-	"fmt"
-	"html/template"
-	"io"
-	"os"
-	"path/filepath"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"time"
 
+	"email_campaign/internal/diff"
+	"email_campaign/internal/lint"
+	"email_campaign/internal/locale"
+	"email_campaign/internal/merge"
+	"email_campaign/internal/render"
 	"email_campaign/internal/repository"
 	"email_campaign/internal/types"
 )
 
 type TemplateService interface {
-	CreateTemplate(req *types.CreateTemplateRequest) error
+	CreateTemplate(req *types.CreateTemplateRequest) (*types.TemplateDTO, error)
 	GetTemplate(id uint64, userID uint64) (*types.TemplateDTO, error)
 	ListTemplates(filter *types.TemplateFilter) ([]types.TemplateDTO, int, error)
 	UpdateTemplate(id uint64, userID uint64, req *types.UpdateTemplateRequest) error
@@ -22,19 +24,71 @@ type TemplateService interface {
 	DuplicateTemplate(id uint64, userID uint64) error
 	SetDefaultTemplate(id uint64, userID uint64) error
 	PreviewTemplate(req *types.PreviewTemplateRequest) (string, error)
-	UploadTemplateImage(file io.Reader, filename string) (string, error)
+	GenerateText(id uint64, userID uint64, req *types.GenerateTextRequest) (string, error)
+	ListTemplateVersions(id uint64, userID uint64, page, limit int) ([]types.TemplateVersionDTO, int, error)
+	GetTemplateVersion(id uint64, userID uint64, version int) (*types.TemplateVersionDTO, error)
+	DiffTemplateVersions(id uint64, userID uint64, from, to int) (*types.TemplateVersionDiff, error)
+	RestoreTemplateVersion(id uint64, userID uint64, version int) (*types.TemplateDTO, error)
+	ListTemplateLocales(id uint64, userID uint64) ([]types.TemplateLocaleDTO, error)
+	GetTemplateLocale(id uint64, userID uint64, tag string) (*types.TemplateLocaleDTO, error)
+	SaveTemplateLocale(id uint64, userID uint64, tag string, req *types.SaveTemplateLocaleRequest) (*types.TemplateLocaleDTO, error)
+	DeleteTemplateLocale(id uint64, userID uint64, tag string) error
+	LintTemplate(id uint64, userID uint64) (*types.TemplateLintReport, error)
+	GetTemplateLint(id uint64, userID uint64) (*types.TemplateLintReport, error)
 }
 
 type templateService struct {
-	repo repository.TemplateRepository
+	repo   repository.TemplateRepository
+	blocks repository.BlockRepository
 }
 
-func NewTemplateService(repo repository.TemplateRepository) TemplateService {
-	return &templateService{repo: repo}
+func NewTemplateService(repo repository.TemplateRepository, blocks repository.BlockRepository) TemplateService {
+	return &templateService{repo: repo, blocks: blocks}
 }
 
-func (s *templateService) CreateTemplate(req *types.CreateTemplateRequest) error {
-	return s.repo.CreateTemplate(req)
+var (
+	// ErrMJMLContentRequired is returned when an mjml template has no MJML.
+	ErrMJMLContentRequired = errors.New("mjml_content is required for mjml templates")
+	ErrHTMLContentRequired = errors.New("html_content is required for html templates")
+	ErrLocaleNotFound      = errors.New("template has no translation for this locale")
+	ErrNotLinted           = errors.New("template has not been linted")
+)
+
+func (s *templateService) CreateTemplate(req *types.CreateTemplateRequest) (*types.TemplateDTO, error) {
+	if req.Type == "" {
+		req.Type = "html"
+		if req.MJMLContent != "" {
+			req.Type = "mjml"
+		}
+	}
+	if req.Type == "mjml" {
+		if req.MJMLContent == "" {
+			return nil, ErrMJMLContentRequired
+		}
+		html, err := compileMJML(req.MJMLContent, liveBlocks(s.blocks, req.UserID, nil))
+		if err != nil {
+			return nil, err
+		}
+		req.HTMLContent = html
+	}
+	if req.TextContent == "" && req.HTMLContent != "" {
+		text, err := render.PlainText(req.HTMLContent)
+		if err != nil {
+			return nil, err
+		}
+		req.TextContent = text
+	}
+	if err := validateMergeTags(req.Subject, req.Type, req.MJMLContent, req.HTMLContent, req.TextContent); err != nil {
+		return nil, err
+	}
+	if err := checkIncludes(req.Type, req.HTMLContent, req.TextContent, liveBlocks(s.blocks, req.UserID, nil)); err != nil {
+		return nil, err
+	}
+	id, err := s.repo.CreateTemplate(req)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetTemplate(id, req.UserID)
 }
 
 func (s *templateService) GetTemplate(id uint64, userID uint64) (*types.TemplateDTO, error) {
@@ -45,10 +99,114 @@ func (s *templateService) ListTemplates(filter *types.TemplateFilter) ([]types.T
 	return s.repo.ListTemplates(filter)
 }
 
+// UpdateTemplate recompiles the HTML whenever new MJML is saved for an
+// mjml template, and validates the merge tags of whatever content changes.
+// New HTML also regenerates the text part, unless the text was written or
+// edited by hand. HTML is saved with its <style> blocks; CSS is inlined
+// only when messages are rendered.
 func (s *templateService) UpdateTemplate(id uint64, userID uint64, req *types.UpdateTemplateRequest) error {
+	t, err := s.repo.GetTemplate(id, userID)
+	if err != nil {
+		return err
+	}
+	typ := req.Type
+	if typ == "" {
+		typ = t.Type
+	}
+	mjmlContent := ""
+	find := liveBlocks(s.blocks, userID, nil)
+	if typ == "mjml" && req.MJMLContent != "" {
+		html, err := compileMJML(req.MJMLContent, find)
+		if err != nil {
+			return err
+		}
+		req.HTMLContent = html
+		mjmlContent = req.MJMLContent
+	}
+	if req.TextContent == "" && req.HTMLContent != "" && generatedText(t) {
+		text, err := render.PlainText(req.HTMLContent)
+		if err != nil {
+			return err
+		}
+		req.TextContent = text
+	}
+	if err := validateMergeTags(req.Subject, typ, mjmlContent, req.HTMLContent, req.TextContent); err != nil {
+		return err
+	}
+	if err := checkIncludes(typ, req.HTMLContent, req.TextContent, find); err != nil {
+		return err
+	}
 	return s.repo.UpdateTemplate(id, userID, req)
 }
 
+// generatedText reports whether the template's text part is missing or
+// still exactly what would be generated from its HTML.
+func generatedText(t *types.TemplateDTO) bool {
+	if t.TextContent == "" {
+		return true
+	}
+	text, err := render.PlainText(t.HTMLContent)
+	return err == nil && text == t.TextContent
+}
+
+// validateMergeTags checks every piece of template content for merge tag
+// syntax errors and unknown variables, reporting each problem against the
+// field it was found in. MJML is checked as written, so positions match
+// the editor; its compiled HTML only adds the escaping checks.
+func validateMergeTags(subject, typ, mjmlContent, htmlContent, textContent string) error {
+	var errs merge.Errors
+	add := func(field string, err error) {
+		var found merge.Errors
+		if errors.As(err, &found) {
+			errs = append(errs, found.InField(field)...)
+		}
+	}
+	add("subject", merge.Validate(subject))
+	if typ == "mjml" && mjmlContent != "" {
+		if err := merge.Validate(mjmlContent); err != nil {
+			add("mjml_content", err)
+		} else {
+			add("html_content", merge.ValidateHTML(htmlContent))
+		}
+	} else {
+		add("html_content", merge.ValidateHTML(htmlContent))
+	}
+	add("text_content", merge.Validate(textContent))
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkIncludes expands the include tags in a template's HTML and text to
+// report blocks that are missing, loop or cannot be used there. MJML
+// templates are checked as they compile.
+func checkIncludes(typ, htmlContent, textContent string, find blockFinder) error {
+	var errs merge.Errors
+	add := func(field string, err error) error {
+		var found merge.Errors
+		if errors.As(err, &found) {
+			errs = append(errs, found.InField(field)...)
+			return nil
+		}
+		return err
+	}
+	if typ != "mjml" {
+		_, err := expandBlocks(htmlContent, "html", find)
+		if err := add("html_content", err); err != nil {
+			return err
+		}
+	}
+	_, err := expandBlocks(textContent, "text", find)
+	if err := add("text_content", err); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
 func (s *templateService) DeleteTemplate(id uint64, userID uint64) error {
 	return s.repo.DeleteTemplate(id, userID)
 }
@@ -62,41 +220,254 @@ func (s *templateService) SetDefaultTemplate(id uint64, userID uint64) error {
 }
 
 func (s *templateService) PreviewTemplate(req *types.PreviewTemplateRequest) (string, error) {
-	tmpl, err := template.New("preview").Parse(req.HTMLContent)
+	find := liveBlocks(s.blocks, req.UserID, nil)
+	content, err := expandBlocks(req.HTMLContent, "html", find)
 	if err != nil {
-		return "", err
+		return "", inField(err, "html_content")
+	}
+	if req.MJMLContent != "" {
+		html, err := compileMJML(req.MJMLContent, find)
+		if err != nil {
+			return "", err
+		}
+		content = html
 	}
+	html, err := merge.HTML(content, &req.MergeData)
+	if err != nil || !req.Inline || req.MJMLContent != "" {
+		return html, err
+	}
+	return render.InlineCSS(html)
+}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, req.Variables); err != nil {
-		return "", err
+// GenerateText converts HTML to the plain-text part. It uses the content in
+// req when given, so editors can convert unsaved changes, and the saved
+// template otherwise. Nothing is stored.
+func (s *templateService) GenerateText(id uint64, userID uint64, req *types.GenerateTextRequest) (string, error) {
+	content := req.HTMLContent
+	switch {
+	case req.MJMLContent != "":
+		html, err := compileMJML(req.MJMLContent, liveBlocks(s.blocks, userID, nil))
+		if err != nil {
+			return "", err
+		}
+		content = html
+	case content == "":
+		t, err := s.repo.GetTemplate(id, userID)
+		if err != nil {
+			return "", err
+		}
+		content = t.HTMLContent
 	}
+	return render.PlainText(content)
+}
+
+func (s *templateService) ListTemplateVersions(id uint64, userID uint64, page, limit int) ([]types.TemplateVersionDTO, int, error) {
+	return s.repo.ListTemplateVersions(id, userID, page, limit)
+}
 
-	return buf.String(), nil
+func (s *templateService) GetTemplateVersion(id uint64, userID uint64, version int) (*types.TemplateVersionDTO, error) {
+	return s.repo.GetTemplateVersion(id, userID, version)
 }
 
-func (s *templateService) UploadTemplateImage(file io.Reader, filename string) (string, error) {
-	// Ensure upload directory exists
-	uploadDir := "./uploads"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return "", err
+// DiffTemplateVersions compares two versions field by field. A to of 0
+// means the current version. Fields that did not change are left out.
+func (s *templateService) DiffTemplateVersions(id uint64, userID uint64, from, to int) (*types.TemplateVersionDiff, error) {
+	if to == 0 {
+		t, err := s.repo.GetTemplate(id, userID)
+		if err != nil {
+			return nil, err
+		}
+		to = t.Version
+	}
+	a, err := s.repo.GetTemplateVersion(id, userID, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.repo.GetTemplateVersion(id, userID, to)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create unique filename
-	ext := filepath.Ext(filename)
-	newFilename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	path := filepath.Join(uploadDir, newFilename)
+	d := &types.TemplateVersionDiff{TemplateID: id, From: from, To: to, Changes: []types.TemplateFieldDiff{}}
+	fields := []struct {
+		name string
+		a, b string
+	}{
+		{"name", a.Name, b.Name},
+		{"subject", a.Subject, b.Subject},
+		{"type", a.Type, b.Type},
+		{"mjml_content", a.MJMLContent, b.MJMLContent},
+		{"html_content", a.HTMLContent, b.HTMLContent},
+		{"text_content", a.TextContent, b.TextContent},
+	}
+	for _, f := range fields {
+		if hunks := diff.Lines(f.a, f.b); len(hunks) > 0 {
+			d.Changes = append(d.Changes, types.TemplateFieldDiff{Field: f.name, Hunks: hunks})
+		}
+	}
+	return d, nil
+}
 
-	dst, err := os.Create(path)
+// RestoreTemplateVersion makes an old version's content the template's
+// current content again, recorded as a new version.
+func (s *templateService) RestoreTemplateVersion(id uint64, userID uint64, version int) (*types.TemplateDTO, error) {
+	if _, err := s.repo.GetTemplateVersion(id, userID, version); err != nil {
+		return nil, err
+	}
+	if err := s.repo.RestoreTemplateVersion(id, userID, version); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTemplate(id, userID)
+}
+
+func (s *templateService) ListTemplateLocales(id uint64, userID uint64) ([]types.TemplateLocaleDTO, error) {
+	if _, err := s.repo.GetTemplate(id, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListTemplateLocales(id, userID)
+}
+
+func (s *templateService) GetTemplateLocale(id uint64, userID uint64, tag string) (*types.TemplateLocaleDTO, error) {
+	tag, err := locale.Normalize(tag)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetTemplate(id, userID); err != nil {
+		return nil, err
+	}
+	l, err := s.repo.GetTemplateLocale(id, userID, tag)
+	if err == sql.ErrNoRows {
+		return nil, ErrLocaleNotFound
+	}
+	return l, err
+}
+
+// SaveTemplateLocale creates or replaces a translation. Its content is
+// compiled, given a text part and checked just as the template's own.
+func (s *templateService) SaveTemplateLocale(id uint64, userID uint64, tag string, req *types.SaveTemplateLocaleRequest) (*types.TemplateLocaleDTO, error) {
+	tag, err := locale.Normalize(tag)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.repo.GetTemplate(id, userID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		return "", err
+	l := &types.TemplateLocaleDTO{
+		TemplateID:  id,
+		Locale:      tag,
+		Subject:     req.Subject,
+		HTMLContent: req.HTMLContent,
+		TextContent: req.TextContent,
+	}
+	find := liveBlocks(s.blocks, userID, nil)
+	if t.Type == "mjml" {
+		if req.MJMLContent == "" {
+			return nil, ErrMJMLContentRequired
+		}
+		html, err := compileMJML(req.MJMLContent, find)
+		if err != nil {
+			return nil, err
+		}
+		l.MJMLContent = req.MJMLContent
+		l.HTMLContent = html
+	} else if l.HTMLContent == "" {
+		return nil, ErrHTMLContentRequired
+	}
+	if l.TextContent == "" {
+		if l.TextContent, err = render.PlainText(l.HTMLContent); err != nil {
+			return nil, err
+		}
 	}
+	if err := validateMergeTags(l.Subject, t.Type, l.MJMLContent, l.HTMLContent, l.TextContent); err != nil {
+		return nil, err
+	}
+	if err := checkIncludes(t.Type, l.HTMLContent, l.TextContent, find); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveTemplateLocale(userID, l); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTemplateLocale(id, userID, tag)
+}
 
-	// Return relative URL
-	return fmt.Sprintf("/uploads/%s", newFilename), nil
+func (s *templateService) DeleteTemplateLocale(id uint64, userID uint64, tag string) error {
+	tag, err := locale.Normalize(tag)
+	if err != nil {
+		return err
+	}
+	if _, err := s.repo.GetTemplate(id, userID); err != nil {
+		return err
+	}
+	err = s.repo.DeleteTemplateLocale(id, userID, tag)
+	if err == sql.ErrNoRows {
+		return ErrLocaleNotFound
+	}
+	return err
+}
+
+// LintTemplate checks the template's HTML, with its content blocks in
+// place, against what email clients support and stores the result as the
+// template's health.
+func (s *templateService) LintTemplate(id uint64, userID uint64) (*types.TemplateLintReport, error) {
+	t, err := s.repo.GetTemplate(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	find := liveBlocks(s.blocks, userID, nil)
+	var html string
+	var opts lint.Options
+	if t.Type == "mjml" && t.MJMLContent != "" {
+		if html, err = compileMJML(t.MJMLContent, find); err != nil {
+			return nil, err
+		}
+	} else {
+		if html, err = expandBlocks(t.HTMLContent, "html", find); err != nil {
+			return nil, inField(err, "html_content")
+		}
+		// Hand-written HTML grows when its CSS is inlined for sending.
+		inlined, err := render.InlineCSS(html)
+		if err != nil {
+			return nil, err
+		}
+		opts.SentSize = len(inlined)
+	}
+
+	result, err := lint.Check(html, opts)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	report := &types.TemplateLintReport{
+		TemplateID: id,
+		Version:    t.Version,
+		TemplateHealth: types.TemplateHealth{
+			Status:    string(result.Status),
+			Errors:    result.Errors,
+			Warnings:  result.Warnings,
+			CheckedAt: time.Now().UTC().Truncate(time.Second),
+		},
+		Report: body,
+	}
+	if err := s.repo.SaveLintReport(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (s *templateService) GetTemplateLint(id uint64, userID uint64) (*types.TemplateLintReport, error) {
+	if _, err := s.repo.GetTemplate(id, userID); err != nil {
+		return nil, err
+	}
+	report, err := s.repo.GetLintReport(id, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotLinted
+	}
+	return report, err
 }
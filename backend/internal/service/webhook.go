@@ -0,0 +1,149 @@
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"email_campaign/internal/logger"
+	"email_campaign/internal/repository"
+	"email_campaign/internal/types"
+	"email_campaign/internal/webhook"
+)
+
+var (
+	ErrWebhookEndpointNotFound = errors.New("webhook endpoint not found")
+	ErrWebhookSecretRequired   = errors.New("signing_secret is required for this provider")
+	ErrWebhookTopicRequired    = errors.New("topic_arn is required for ses endpoints")
+)
+
+type WebhookService interface {
+	CreateEndpoint(req *types.CreateWebhookEndpointRequest) (*types.WebhookEndpoint, error)
+	ListEndpoints(userID uint64) ([]types.WebhookEndpoint, error)
+	DeleteEndpoint(id uint64, userID uint64) error
+	HandleWebhook(token string, r *http.Request, body []byte) (int, error)
+}
+
+type webhookService struct {
+	repo        repository.WebhookRepository
+	campaignSvc CampaignService
+}
+
+func NewWebhookService(repo repository.WebhookRepository, campaignSvc CampaignService) WebhookService {
+	return &webhookService{repo: repo, campaignSvc: campaignSvc}
+}
+
+func (s *webhookService) CreateEndpoint(req *types.CreateWebhookEndpointRequest) (*types.WebhookEndpoint, error) {
+	if _, err := webhook.New(req.Provider); err != nil {
+		return nil, err
+	}
+	if webhook.RequiresSecret(req.Provider) && req.SigningSecret == "" {
+		return nil, ErrWebhookSecretRequired
+	}
+	req.TopicArn = strings.TrimSpace(req.TopicArn)
+	if req.Provider == types.WebhookProviderSES && !strings.HasPrefix(req.TopicArn, "arn:") {
+		return nil, ErrWebhookTopicRequired
+	}
+
+	token, err := newWebhookToken()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := &types.WebhookEndpoint{
+		UserID:        req.UserID,
+		Provider:      req.Provider,
+		Token:         token,
+		SigningSecret: req.SigningSecret,
+		TopicArn:      req.TopicArn,
+	}
+	if err := s.repo.CreateEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	endpoint.URL = "/api/v1/webhooks/" + token
+	return endpoint, nil
+}
+
+func (s *webhookService) ListEndpoints(userID uint64) ([]types.WebhookEndpoint, error) {
+	endpoints, err := s.repo.ListEndpoints(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range endpoints {
+		endpoints[i].URL = "/api/v1/webhooks/" + endpoints[i].Token
+	}
+	return endpoints, nil
+}
+
+func (s *webhookService) DeleteEndpoint(id uint64, userID uint64) error {
+	return s.repo.DeleteEndpoint(id, userID)
+}
+
+// HandleWebhook verifies and normalizes a provider callback for the endpoint
+// identified by token, then applies every resulting event. It returns the
+// number of events that matched a recipient. An event that fails doesn't
+// stop the rest; the error is returned after them so the provider retries
+// the callback, and the events already applied are not counted again.
+func (s *webhookService) HandleWebhook(token string, r *http.Request, body []byte) (int, error) {
+	endpoint, err := s.repo.GetEndpointByToken(token)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !endpoint.IsActive {
+		return 0, ErrWebhookEndpointNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	adapter, err := webhook.New(endpoint.Provider)
+	if err != nil {
+		return 0, err
+	}
+
+	events, err := adapter.Parse(r, body, endpoint)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.repo.TouchEndpoint(endpoint.ID); err != nil {
+		logger.Error("Failed to update webhook endpoint", map[string]interface{}{"endpoint_id": endpoint.ID, "error": err.Error()})
+	}
+
+	applied := 0
+	var failed error
+	for i := range events {
+		err := s.campaignSvc.HandleDeliveryEvent(endpoint.UserID, &events[i])
+		if errors.Is(err, ErrRecipientNotFound) {
+			logger.Info("Webhook event did not match a recipient", map[string]interface{}{
+				"provider":   endpoint.Provider,
+				"type":       events[i].Type,
+				"message_id": events[i].MessageID,
+			})
+			continue
+		}
+		if err != nil {
+			logger.Error("Failed to apply webhook event", map[string]interface{}{
+				"provider":   endpoint.Provider,
+				"type":       events[i].Type,
+				"message_id": events[i].MessageID,
+				"error":      err.Error(),
+			})
+			if failed == nil {
+				failed = fmt.Errorf("applying %s event: %w", events[i].Type, err)
+			}
+			continue
+		}
+		applied++
+	}
+	return applied, failed
+}
+
+func newWebhookToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,492 @@
+// Package smtpd is a minimal SMTP receiver used by the bounce processor and
+// the development mail sink. It speaks enough of RFC 5321 for MTAs and
+// net/smtp clients to hand over a message, and nothing more.
+package smtpd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxSize     = 25 << 20
+	defaultTimeout     = 5 * time.Minute
+	defaultMaxSessions = 100
+
+	// RFC 5321 4.5.3.1: a command line is at most 512 octets and a text
+	// line at most 1000, both counting the CRLF.
+	maxCommandLine = 512
+	maxTextLine    = 1000
+)
+
+// ErrTemporary can be returned (or wrapped) by a Handler to answer with a
+// 4xx reply so the sending MTA retries later.
+var ErrTemporary = errors.New("temporary failure")
+
+var errLineTooLong = errors.New("smtpd: line too long")
+
+// Envelope is a message as received on the wire.
+type Envelope struct {
+	RemoteAddr string
+	// Username is the AUTH identity, empty for unauthenticated sessions.
+	Username string
+	From     string
+	To       []string
+	Data     []byte
+}
+
+// Handler is called once per accepted message.
+type Handler func(env *Envelope) error
+
+// Authenticator checks AUTH PLAIN and AUTH LOGIN credentials.
+type Authenticator func(username, password string) bool
+
+type Server struct {
+	Addr     string
+	Hostname string
+	Handler  Handler
+	// Authenticate enables AUTH. Authentication is optional for clients
+	// even when it is set; it exists so clients that insist on logging in,
+	// such as net/smtp with PlainAuth, can talk to the server.
+	Authenticate Authenticator
+	// MaxSize caps the DATA section in bytes. Zero means 25MB.
+	MaxSize int64
+	// Timeout bounds each command read. Zero means five minutes.
+	Timeout time.Duration
+	// MaxSessions caps concurrent connections; clients past it get a 421.
+	// Zero means 100.
+	MaxSessions int
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	closed   bool
+}
+
+// ListenAndServe listens on s.Addr and serves until Shutdown is called.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln. It always returns a non-nil error; after
+// Shutdown the error is net.ErrClosed.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return net.ErrClosed
+	}
+	s.listener = ln
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return net.ErrClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(50 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		busy := len(s.conns) >= s.maxSessions()
+		if !busy {
+			s.conns[conn] = struct{}{}
+		}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			if busy {
+				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				fmt.Fprintf(conn, "421 %s Too many connections, try again later\r\n", s.hostname())
+				conn.Close()
+				return
+			}
+			s.serveConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// ListenerAddr returns the listener address once Serve has started.
+func (s *Server) ListenerAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Shutdown stops accepting connections and waits for in-flight sessions to
+// finish, closing them forcibly when ctx expires.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for c := range s.conns {
+			c.Close()
+		}
+		s.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (s *Server) maxSessions() int {
+	if s.MaxSessions > 0 {
+		return s.MaxSessions
+	}
+	return defaultMaxSessions
+}
+
+func (s *Server) hostname() string {
+	if s.Hostname != "" {
+		return s.Hostname
+	}
+	return "localhost"
+}
+
+type session struct {
+	srv  *Server
+	conn net.Conn
+	tp   *textproto.Conn
+	env  *Envelope
+	helo bool
+	user string
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	// Reading through lineLimiter keeps a client from making ReadLine
+	// buffer an endless line; commands get the tighter check below.
+	rwc := struct {
+		io.Reader
+		io.Writer
+		io.Closer
+	}{&lineLimiter{r: conn}, conn, conn}
+	sess := &session{srv: s, conn: conn, tp: textproto.NewConn(rwc)}
+	sess.reply(220, s.hostname()+" ESMTP ready")
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		line, err := sess.tp.ReadLine()
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				// The rest of the line can't be told apart from the next
+				// command, so give up on the session.
+				sess.reply(500, "Line too long")
+			}
+			return
+		}
+		if len(line)+2 > maxCommandLine {
+			sess.reply(500, "Line too long")
+			continue
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			sess.helo = true
+			sess.reset()
+			sess.reply(250, s.hostname())
+		case "EHLO":
+			sess.helo = true
+			sess.reset()
+			ext := []string{s.hostname(), "PIPELINING", "8BITMIME", fmt.Sprintf("SIZE %d", s.maxSize())}
+			if s.Authenticate != nil {
+				ext = append(ext, "AUTH PLAIN LOGIN")
+			}
+			sess.reply(250, ext...)
+		case "AUTH":
+			sess.auth(arg)
+		case "MAIL":
+			sess.mail(arg)
+		case "RCPT":
+			sess.rcpt(arg)
+		case "DATA":
+			sess.data()
+		case "RSET":
+			sess.reset()
+			sess.reply(250, "OK")
+		case "NOOP":
+			sess.reply(250, "OK")
+		case "VRFY":
+			sess.reply(252, "Cannot VRFY user")
+		case "QUIT":
+			sess.reply(221, "Bye")
+			return
+		default:
+			sess.reply(502, "Command not implemented")
+		}
+	}
+}
+
+func (s *Server) maxSize() int64 {
+	if s.MaxSize > 0 {
+		return s.MaxSize
+	}
+	return defaultMaxSize
+}
+
+func (sess *session) reply(code int, lines ...string) {
+	for i, l := range lines {
+		sep := " "
+		if i < len(lines)-1 {
+			sep = "-"
+		}
+		sess.tp.PrintfLine("%d%s%s", code, sep, l)
+	}
+}
+
+func (sess *session) reset() {
+	sess.env = nil
+}
+
+func (sess *session) mail(arg string) {
+	if !sess.helo {
+		sess.reply(503, "Send HELO/EHLO first")
+		return
+	}
+	if sess.env != nil {
+		sess.reply(503, "Nested MAIL command")
+		return
+	}
+	addr, ok := parsePath(arg, "FROM:")
+	if !ok {
+		sess.reply(501, "Syntax: MAIL FROM:<address>")
+		return
+	}
+	sess.env = &Envelope{RemoteAddr: sess.conn.RemoteAddr().String(), Username: sess.user, From: addr}
+	sess.reply(250, "OK")
+}
+
+func (sess *session) auth(arg string) {
+	if sess.srv.Authenticate == nil {
+		sess.reply(502, "AUTH not supported")
+		return
+	}
+	if !sess.helo || sess.env != nil || sess.user != "" {
+		sess.reply(503, "Bad sequence of commands")
+		return
+	}
+
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var username, password string
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		resp, ok := sess.challenge(initial, "")
+		if !ok {
+			return
+		}
+		// authzid NUL authcid NUL passwd
+		parts := strings.SplitN(string(resp), "\x00", 3)
+		if len(parts) != 3 {
+			sess.reply(501, "Malformed AUTH PLAIN response")
+			return
+		}
+		username, password = parts[1], parts[2]
+	case "LOGIN":
+		user, ok := sess.challenge(initial, "Username:")
+		if !ok {
+			return
+		}
+		pass, ok := sess.challenge("", "Password:")
+		if !ok {
+			return
+		}
+		username, password = string(user), string(pass)
+	default:
+		sess.reply(504, "Unrecognized authentication type")
+		return
+	}
+
+	if !sess.srv.Authenticate(username, password) {
+		sess.reply(535, "Authentication credentials invalid")
+		return
+	}
+	sess.user = username
+	sess.reply(235, "Authentication successful")
+}
+
+// challenge returns the decoded client response, sending a 334 prompt first
+// unless the client already supplied an initial response.
+func (sess *session) challenge(initial, prompt string) ([]byte, bool) {
+	if initial == "" {
+		sess.reply(334, base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, err := sess.tp.ReadLine()
+		if err != nil {
+			return nil, false
+		}
+		initial = line
+	}
+	if initial == "*" {
+		sess.reply(501, "Authentication cancelled")
+		return nil, false
+	}
+	resp, err := base64.StdEncoding.DecodeString(initial)
+	if err != nil {
+		sess.reply(501, "Invalid base64 response")
+		return nil, false
+	}
+	return resp, true
+}
+
+func (sess *session) rcpt(arg string) {
+	if sess.env == nil {
+		sess.reply(503, "Need MAIL before RCPT")
+		return
+	}
+	addr, ok := parsePath(arg, "TO:")
+	if !ok || addr == "" {
+		sess.reply(501, "Syntax: RCPT TO:<address>")
+		return
+	}
+	if len(sess.env.To) >= 100 {
+		sess.reply(452, "Too many recipients")
+		return
+	}
+	sess.env.To = append(sess.env.To, addr)
+	sess.reply(250, "OK")
+}
+
+func (sess *session) data() {
+	if sess.env == nil || len(sess.env.To) == 0 {
+		sess.reply(503, "Need RCPT before DATA")
+		return
+	}
+	sess.reply(354, "End data with <CR><LF>.<CR><LF>")
+
+	limit := sess.srv.maxSize()
+	dot := sess.tp.DotReader()
+	data, err := io.ReadAll(io.LimitReader(dot, limit+1))
+	if errors.Is(err, errLineTooLong) {
+		// The command loop sees the same error next and ends the session.
+		sess.reset()
+		return
+	}
+	if err != nil {
+		sess.reply(451, "Error reading message")
+		sess.reset()
+		return
+	}
+	if int64(len(data)) > limit {
+		// Drain the rest of the message so the session stays in sync.
+		io.Copy(io.Discard, dot)
+		sess.reply(552, "Message exceeds size limit")
+		sess.reset()
+		return
+	}
+
+	env := sess.env
+	env.Data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	sess.reset()
+
+	if sess.srv.Handler != nil {
+		if err := sess.srv.Handler(env); err != nil {
+			if errors.Is(err, ErrTemporary) {
+				sess.reply(451, "Temporary failure, try again later")
+			} else {
+				sess.reply(554, "Transaction failed")
+			}
+			return
+		}
+	}
+	sess.reply(250, "OK: queued")
+}
+
+// lineLimiter fails reads once a line on the wire grows past maxTextLine
+// octets, the longest any part of the session may send. The error sticks,
+// since the stream is out of step after it.
+type lineLimiter struct {
+	r   io.Reader
+	n   int // octets since the last LF
+	err error
+}
+
+func (l *lineLimiter) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	n, err := l.r.Read(p)
+	for i, c := range p[:n] {
+		l.n++
+		if l.n > maxTextLine {
+			l.err = errLineTooLong
+			return i, l.err
+		}
+		if c == '\n' {
+			l.n = 0
+		}
+	}
+	return n, err
+}
+
+// parsePath extracts the address from "FROM:<addr> PARAMS" style arguments.
+func parsePath(arg, prefix string) (string, bool) {
+	arg = strings.TrimSpace(arg)
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		addr, _, _ := strings.Cut(rest, " ")
+		return addr, addr != ""
+	}
+	end := strings.IndexByte(rest, '>')
+	if end < 0 {
+		return "", false
+	}
+	return rest[1:end], true
+}
@@ -0,0 +1,354 @@
+package smtpd
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// start serves s on a local port until the test ends.
+func start(t *testing.T, s *Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ln) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+		if err := <-served; !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Serve returned %v, want net.ErrClosed", err)
+		}
+	})
+	return ln.Addr().String()
+}
+
+type client struct {
+	t  *testing.T
+	tp *textproto.Conn
+}
+
+func dial(t *testing.T, addr string) *client {
+	t.Helper()
+	tp, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tp.Close() })
+	c := &client{t: t, tp: tp}
+	c.expect(220)
+	return c
+}
+
+// cmd sends a line and checks the reply code, returning the reply text.
+func (c *client) cmd(want int, line string) string {
+	c.t.Helper()
+	if err := c.tp.PrintfLine("%s", line); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.expect(want)
+}
+
+func (c *client) expect(want int) string {
+	c.t.Helper()
+	code, msg, err := c.tp.ReadResponse(want)
+	if err != nil {
+		c.t.Fatalf("got %d %q, want %d", code, msg, want)
+	}
+	return msg
+}
+
+// recorder is a Handler that keeps what it receives.
+type recorder struct {
+	mu   sync.Mutex
+	envs []*Envelope
+	err  error
+}
+
+func (r *recorder) handle(env *Envelope) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.envs = append(r.envs, env)
+	return nil
+}
+
+func (r *recorder) received() []*Envelope {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Envelope(nil), r.envs...)
+}
+
+func TestSessionStateMachine(t *testing.T) {
+	rec := &recorder{}
+	c := dial(t, start(t, &Server{Hostname: "mx.test", Handler: rec.handle}))
+
+	c.cmd(503, "MAIL FROM:<a@example.com>")
+	c.cmd(502, "STARTTLS")
+	c.cmd(250, "HELO client.test")
+	c.cmd(503, "RCPT TO:<b@example.com>")
+	c.cmd(503, "DATA")
+	c.cmd(501, "MAIL <a@example.com>")
+	c.cmd(501, "MAIL FROM:<a@example.com")
+	c.cmd(250, "MAIL FROM:<a@example.com> BODY=8BITMIME")
+	c.cmd(503, "MAIL FROM:<c@example.com>")
+	c.cmd(503, "DATA")
+	c.cmd(501, "RCPT TO:<>")
+	c.cmd(250, "RCPT TO:<b@example.com>")
+	c.cmd(250, "rcpt to:d@example.com")
+	c.cmd(354, "DATA")
+	c.tp.PrintfLine("Subject: hi")
+	c.tp.PrintfLine("")
+	c.tp.PrintfLine("..leading dot")
+	c.cmd(250, ".")
+
+	// The transaction is over: a new one starts with MAIL.
+	c.cmd(503, "RCPT TO:<b@example.com>")
+	c.cmd(250, "MAIL FROM:<>")
+	c.cmd(250, "RSET")
+	c.cmd(503, "DATA")
+	c.cmd(250, "NOOP")
+	c.cmd(252, "VRFY b")
+	c.cmd(221, "QUIT")
+
+	envs := rec.received()
+	if len(envs) != 1 {
+		t.Fatalf("received %d messages, want 1", len(envs))
+	}
+	env := envs[0]
+	if env.From != "a@example.com" || strings.Join(env.To, ",") != "b@example.com,d@example.com" || env.Username != "" {
+		t.Errorf("envelope = %+v", env)
+	}
+	if got := string(env.Data); got != "Subject: hi\r\n\r\n.leading dot\r\n" {
+		t.Errorf("data = %q", got)
+	}
+}
+
+func TestEHLOAdvertisesExtensions(t *testing.T) {
+	c := dial(t, start(t, &Server{MaxSize: 1024}))
+	msg := c.cmd(250, "EHLO client.test")
+	if !strings.Contains(msg, "SIZE 1024") || strings.Contains(msg, "AUTH") {
+		t.Errorf("EHLO without Authenticate = %q", msg)
+	}
+	c.cmd(502, "AUTH PLAIN")
+
+	c = dial(t, start(t, &Server{Authenticate: func(u, p string) bool { return true }}))
+	if msg := c.cmd(250, "EHLO client.test"); !strings.Contains(msg, "AUTH PLAIN LOGIN") {
+		t.Errorf("EHLO with Authenticate = %q", msg)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	rec := &recorder{}
+	addr := start(t, &Server{
+		Handler:      rec.handle,
+		Authenticate: func(u, p string) bool { return u == "sam" && p == "secret" },
+	})
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	c := dial(t, addr)
+	c.cmd(503, "AUTH PLAIN "+b64("\x00sam\x00secret"))
+	c.cmd(250, "EHLO client.test")
+	c.cmd(504, "AUTH CRAM-MD5")
+	c.cmd(501, "AUTH PLAIN not-base64!")
+	c.cmd(501, "AUTH PLAIN "+b64("sam:secret"))
+	c.cmd(535, "AUTH PLAIN "+b64("\x00sam\x00wrong"))
+	c.cmd(334, "AUTH PLAIN")
+	c.cmd(501, "*")
+	c.cmd(235, "AUTH PLAIN "+b64("\x00sam\x00secret"))
+	c.cmd(503, "AUTH PLAIN "+b64("\x00sam\x00secret"))
+	c.cmd(250, "MAIL FROM:<a@example.com>")
+	c.cmd(250, "RCPT TO:<b@example.com>")
+	c.cmd(354, "DATA")
+	c.cmd(250, ".")
+
+	c = dial(t, addr)
+	c.cmd(250, "EHLO client.test")
+	if prompt := c.cmd(334, "AUTH LOGIN"); prompt != b64("Username:") {
+		t.Errorf("LOGIN prompt = %q", prompt)
+	}
+	if prompt := c.cmd(334, b64("sam")); prompt != b64("Password:") {
+		t.Errorf("LOGIN prompt = %q", prompt)
+	}
+	c.cmd(235, b64("secret"))
+
+	// AUTH is not allowed in the middle of a transaction.
+	c = dial(t, addr)
+	c.cmd(250, "EHLO client.test")
+	c.cmd(250, "MAIL FROM:<a@example.com>")
+	c.cmd(503, "AUTH LOGIN")
+
+	envs := rec.received()
+	if len(envs) != 1 || envs[0].Username != "sam" {
+		t.Errorf("received %+v, want one message from sam", envs)
+	}
+}
+
+func TestHandlerFailures(t *testing.T) {
+	rec := &recorder{}
+	c := dial(t, start(t, &Server{Handler: rec.handle}))
+	c.cmd(250, "HELO client.test")
+
+	send := func(want int) {
+		t.Helper()
+		c.cmd(250, "MAIL FROM:<a@example.com>")
+		c.cmd(250, "RCPT TO:<b@example.com>")
+		c.cmd(354, "DATA")
+		c.tp.PrintfLine("body")
+		c.cmd(want, ".")
+	}
+	rec.err = ErrTemporary
+	send(451)
+	rec.err = errors.New("no such mailbox")
+	send(554)
+	rec.err = nil
+	send(250)
+}
+
+func TestMessageSizeLimit(t *testing.T) {
+	rec := &recorder{}
+	c := dial(t, start(t, &Server{Handler: rec.handle, MaxSize: 16}))
+	c.cmd(250, "HELO client.test")
+	c.cmd(250, "MAIL FROM:<a@example.com>")
+	c.cmd(250, "RCPT TO:<b@example.com>")
+	c.cmd(354, "DATA")
+	c.tp.PrintfLine("%s", strings.Repeat("x", 64))
+	c.tp.PrintfLine("%s", strings.Repeat("y", 64))
+	c.cmd(552, ".")
+
+	// The session is still in step and the transaction was reset.
+	c.cmd(503, "DATA")
+	c.cmd(250, "NOOP")
+	if envs := rec.received(); len(envs) != 0 {
+		t.Errorf("oversized message was handed over: %+v", envs)
+	}
+}
+
+func TestLineLimits(t *testing.T) {
+	rec := &recorder{}
+	addr := start(t, &Server{Handler: rec.handle})
+
+	// An overlong command is refused but the session carries on.
+	c := dial(t, addr)
+	c.cmd(500, "NOOP "+strings.Repeat("x", 600))
+	c.cmd(250, "HELO client.test")
+	c.cmd(250, "MAIL FROM:<a@example.com>")
+	c.cmd(250, "RCPT TO:<b@example.com>")
+	c.cmd(354, "DATA")
+	c.tp.PrintfLine("%s", strings.Repeat("x", 998))
+	c.cmd(250, ".")
+
+	// A text line past 1000 octets ends the session.
+	c = dial(t, addr)
+	c.cmd(250, "HELO client.test")
+	c.cmd(250, "MAIL FROM:<a@example.com>")
+	c.cmd(250, "RCPT TO:<b@example.com>")
+	c.cmd(354, "DATA")
+	c.tp.PrintfLine("%s", strings.Repeat("y", 4096))
+	c.expect(500)
+	if _, err := c.tp.ReadLine(); err == nil {
+		t.Error("connection still open after an overlong line")
+	}
+
+	if envs := rec.received(); len(envs) != 1 {
+		t.Errorf("received %d messages, want 1", len(envs))
+	}
+}
+
+func TestMaxSessions(t *testing.T) {
+	addr := start(t, &Server{MaxSessions: 1})
+	first := dial(t, addr)
+
+	tp, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	if code, msg, err := tp.ReadResponse(421); err != nil {
+		t.Errorf("second session got %d %q, want 421", code, msg)
+	}
+
+	// Once the first session ends there is room again.
+	first.cmd(221, "QUIT")
+	deadline := time.Now().Add(time.Second)
+	for {
+		tp, err := textproto.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _, _ := tp.ReadResponse(0)
+		tp.Close()
+		if code == 220 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no free session after QUIT, got %d", code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTooManyRecipients(t *testing.T) {
+	c := dial(t, start(t, &Server{}))
+	c.cmd(250, "HELO client.test")
+	c.cmd(250, "MAIL FROM:<a@example.com>")
+	for i := 0; i < 100; i++ {
+		c.cmd(250, "RCPT TO:<b@example.com>")
+	}
+	c.cmd(452, "RCPT TO:<b@example.com>")
+}
+
+func TestNetSMTPClient(t *testing.T) {
+	rec := &recorder{}
+	addr := start(t, &Server{
+		Handler:      rec.handle,
+		Authenticate: func(u, p string) bool { return u == "sam" && p == "secret" },
+	})
+	host, _, _ := net.SplitHostPort(addr)
+
+	msg := "Subject: hello\r\n\r\nbody\r\n"
+	if err := smtp.SendMail(addr, smtp.PlainAuth("", "sam", "secret", host), "a@example.com", []string{"b@example.com"}, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	err := smtp.SendMail(addr, smtp.PlainAuth("", "sam", "wrong", host), "a@example.com", []string{"b@example.com"}, []byte(msg))
+	if err == nil || !strings.Contains(err.Error(), "535") {
+		t.Errorf("wrong password: %v", err)
+	}
+
+	envs := rec.received()
+	if len(envs) != 1 || string(envs[0].Data) != msg || envs[0].Username != "sam" {
+		t.Errorf("received %+v", envs)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	for _, tt := range []struct {
+		arg, want string
+		ok        bool
+	}{
+		{"FROM:<a@example.com>", "a@example.com", true},
+		{"from: <a@example.com> SIZE=10", "a@example.com", true},
+		{"FROM:a@example.com SIZE=10", "a@example.com", true},
+		{"FROM:<>", "", true},
+		{"FROM:", "", false},
+		{"FROM:<a@example.com", "", false},
+		{"TO:<a@example.com>", "", false},
+	} {
+		got, ok := parsePath(tt.arg, "FROM:")
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parsePath(%q) = %q, %v; want %q, %v", tt.arg, got, ok, tt.want, tt.ok)
+		}
+	}
+}
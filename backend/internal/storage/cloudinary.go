@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cloudinary stores files through Cloudinary's upload API. Images are kept
+// as image resources, so Cloudinary can transform them, and everything
+// else as raw files. Public files get plain delivery URLs; private ones
+// are uploaded as authenticated assets, which are only delivered through
+// signed URLs.
+type Cloudinary struct {
+	CloudName string
+	APIKey    string
+	APISecret string
+
+	// apiBase and deliveryBase are overridden in tests.
+	apiBase      string
+	deliveryBase string
+	client       *http.Client
+	now          func() time.Time
+}
+
+var cloudinaryImageExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".svg": true, ".bmp": true, ".avif": true,
+}
+
+// asset returns the resource type and public ID for a key. Image public
+// IDs leave out the extension, which Cloudinary treats as the format.
+func (c *Cloudinary) asset(key string) (string, string, error) {
+	if err := checkKey(key); err != nil {
+		return "", "", err
+	}
+	ext := strings.ToLower(path.Ext(key))
+	if cloudinaryImageExts[ext] {
+		return "image", strings.TrimSuffix(key, path.Ext(key)), nil
+	}
+	return "raw", key, nil
+}
+
+func (c *Cloudinary) api(resource, action string) string {
+	base := c.apiBase
+	if base == "" {
+		base = "https://api.cloudinary.com"
+	}
+	return fmt.Sprintf("%s/v1_1/%s/%s/%s", base, url.PathEscape(c.CloudName), resource, action)
+}
+
+// signParams adds the timestamp, API key and signature: the SHA-1 of the
+// sorted parameters followed by the API secret.
+func (c *Cloudinary) signParams(params map[string]string) {
+	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
+	params["timestamp"] = strconv.FormatInt(now.Unix(), 10)
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + params[k]
+	}
+	sum := sha1.Sum([]byte(strings.Join(parts, "&") + c.APISecret))
+	params["signature"] = hex.EncodeToString(sum[:])
+	params["api_key"] = c.APIKey
+}
+
+func (c *Cloudinary) Put(key string, r io.Reader, contentType string) error {
+	resource, publicID, err := c.asset(key)
+	if err != nil {
+		return err
+	}
+	params := map[string]string{"public_id": publicID, "overwrite": "true", "type": deliveryType(key)}
+	c.signParams(params)
+
+	// The form is written as it is sent, so the file is never held in
+	// memory.
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		pw.CloseWithError(writeUploadForm(mw, params, path.Base(key), r))
+	}()
+	// If the request ends before the whole form is read, closing the pipe
+	// stops the writer; r is not touched once Put returns.
+	defer func() {
+		pr.Close()
+		<-written
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, c.api(resource, "upload"), pr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return c.do(req, nil)
+}
+
+func writeUploadForm(mw *multipart.Writer, params map[string]string, filename string, r io.Reader) error {
+	for k, v := range params {
+		if err := mw.WriteField(k, v); err != nil {
+			return err
+		}
+	}
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fw, r); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+func (c *Cloudinary) Get(key string) (io.ReadCloser, error) {
+	u, err := c.URL(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("cloudinary: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (c *Cloudinary) Delete(key string) error {
+	resource, publicID, err := c.asset(key)
+	if err != nil {
+		return err
+	}
+	params := map[string]string{"public_id": publicID, "invalidate": "true", "type": deliveryType(key)}
+	c.signParams(params)
+	form := url.Values{}
+	for k, v := range params {
+		form.Set(k, v)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.api(resource, "destroy"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	if err := c.do(req, &result); err != nil {
+		return err
+	}
+	// "not found" is fine: the file is gone either way.
+	if result.Result != "ok" && result.Result != "not found" {
+		return fmt.Errorf("cloudinary: destroy returned %q", result.Result)
+	}
+	return nil
+}
+
+func (c *Cloudinary) URL(key string) (string, error) {
+	resource, _, err := c.asset(key)
+	if err != nil {
+		return "", err
+	}
+	base := c.deliveryBase
+	if base == "" {
+		base = "https://res.cloudinary.com"
+	}
+	if Public(key) {
+		return fmt.Sprintf("%s/%s/%s/upload/%s", base, url.PathEscape(c.CloudName), resource, escapePath(key)), nil
+	}
+	// The delivery signature is the first 8 characters of the URL-safe
+	// base64 SHA-1 of the path after it followed by the API secret.
+	sum := sha1.Sum([]byte(key + c.APISecret))
+	sig := base64.URLEncoding.EncodeToString(sum[:])[:8]
+	return fmt.Sprintf("%s/%s/%s/authenticated/s--%s--/%s", base, url.PathEscape(c.CloudName), resource, sig, escapePath(key)), nil
+}
+
+// deliveryType is the Cloudinary type a key's asset is stored as.
+func deliveryType(key string) string {
+	if Public(key) {
+		return "upload"
+	}
+	return "authenticated"
+}
+
+func (c *Cloudinary) do(req *http.Request, out interface{}) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e) == nil && e.Error.Message != "" {
+			return fmt.Errorf("cloudinary: %s", e.Error.Message)
+		}
+		return fmt.Errorf("cloudinary: %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Filesystem keeps files under a local directory that the API serves at
+// BaseURL.
+type Filesystem struct {
+	Root    string
+	BaseURL string
+}
+
+func NewFilesystem(root, baseURL string) *Filesystem {
+	return &Filesystem{Root: root, BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (f *Filesystem) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.Root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first so readers never see a partial one.
+func (f *Filesystem) Put(key string, r io.Reader, contentType string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *Filesystem) Get(key string) (io.ReadCloser, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (f *Filesystem) Delete(key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (f *Filesystem) URL(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return f.BaseURL + "/" + escapePath(key), nil
+}
+
+// Handler serves the files whose keys start with one of prefixes, such as
+// "media/", and nothing else: other keys under Root may be private, and
+// directories are never listed.
+func (f *Filesystem) Handler(prefixes ...string) http.Handler {
+	files := http.FileServer(http.Dir(f.Root))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		if checkKey(key) != nil || !hasPrefix(key, prefixes) {
+			http.NotFound(w, r)
+			return
+		}
+		if info, err := os.Stat(filepath.Join(f.Root, filepath.FromSlash(key))); err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+func hasPrefix(key string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,433 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 stores files in an S3 bucket, or in any service speaking the S3 API
+// when Endpoint is set, such as MinIO. Requests are signed with AWS
+// Signature Version 4. Files in a private bucket are handed out as
+// presigned URLs valid for Expiry; a public bucket must allow anonymous
+// reads through its bucket policy.
+type S3 struct {
+	// Endpoint is the base URL of an S3-compatible service. Buckets are
+	// then addressed by path rather than by host name.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Private   bool
+	Expiry    time.Duration
+
+	client *http.Client
+	now    func() time.Time
+	// partSize overrides s3PartSize in tests.
+	partSize int
+}
+
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Object is where a key lives: the scheme and host to send requests to,
+// and the canonical, escaped path of the object.
+type s3Object struct {
+	scheme, host, path string
+}
+
+func (o s3Object) String() string {
+	return o.scheme + "://" + o.host + o.path
+}
+
+func (s *S3) region() string {
+	if s.Region == "" {
+		return "us-east-1"
+	}
+	return s.Region
+}
+
+func (s *S3) object(key string) (s3Object, error) {
+	if err := checkKey(key); err != nil {
+		return s3Object{}, err
+	}
+	if prefix := strings.Trim(s.Prefix, "/"); prefix != "" {
+		key = prefix + "/" + key
+	}
+	if s.Endpoint != "" {
+		u, err := url.Parse(s.Endpoint)
+		if err != nil || u.Host == "" {
+			return s3Object{}, fmt.Errorf("%w: invalid s3 endpoint %q", ErrNotConfigured, s.Endpoint)
+		}
+		return s3Object{u.Scheme, u.Host, strings.TrimRight(u.Path, "/") + "/" + uriEncode(s.Bucket) + "/" + escapePath(key)}, nil
+	}
+	host := s.Bucket + ".s3." + s.region() + ".amazonaws.com"
+	if s.region() == "us-east-1" {
+		host = s.Bucket + ".s3.amazonaws.com"
+	}
+	return s3Object{"https", host, "/" + escapePath(key)}, nil
+}
+
+func (s *S3) time() time.Time {
+	if s.now != nil {
+		return s.now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// Put streams the body without hashing it first. A body whose size is not
+// known up front, because r cannot seek, is sent as a multipart upload
+// when it is larger than one part, so at most one part is held in memory.
+func (s *S3) Put(key string, r io.Reader, contentType string) error {
+	if size, ok := readerSize(r); ok {
+		return s.putObject(key, r, size, unsignedPayload, contentType)
+	}
+	part, err := readPart(r, s.partLimit())
+	if err != nil {
+		return err
+	}
+	if len(part) < s.partLimit() {
+		return s.putObject(key, bytes.NewReader(part), int64(len(part)), sha256Hex(part), contentType)
+	}
+	return s.putMultipart(key, part, r, contentType)
+}
+
+func (s *S3) putObject(key string, body io.Reader, size int64, payloadHash, contentType string) error {
+	req, err := s.request(http.MethodPut, key, nil, body, payloadHash, func(req *http.Request) {
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return s.send(req, nil)
+}
+
+// putMultipart uploads first and the rest of r as the parts of a multipart
+// upload, which is aborted if any of them fails.
+func (s *S3) putMultipart(key string, first []byte, r io.Reader, contentType string) error {
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	req, err := s.request(http.MethodPost, key, url.Values{"uploads": {""}}, nil, emptySHA256, func(req *http.Request) {
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.send(req, &initiated); err != nil {
+		return err
+	}
+	upload := url.Values{"uploadId": {initiated.UploadID}}
+
+	var complete s3CompleteUpload
+	err = func() error {
+		for part := first; len(part) > 0; {
+			n := len(complete.Parts) + 1
+			query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {initiated.UploadID}}
+			req, err := s.request(http.MethodPut, key, query, bytes.NewReader(part), sha256Hex(part), func(req *http.Request) {
+				req.ContentLength = int64(len(part))
+			})
+			if err != nil {
+				return err
+			}
+			resp, err := s.client.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if err := s3Error(resp); err != nil {
+				return err
+			}
+			complete.Parts = append(complete.Parts, s3Part{n, resp.Header.Get("ETag")})
+			if part, err = readPart(r, s.partLimit()); err != nil {
+				return err
+			}
+		}
+		body, err := xml.Marshal(complete)
+		if err != nil {
+			return err
+		}
+		req, err := s.request(http.MethodPost, key, upload, bytes.NewReader(body), sha256Hex(body), nil)
+		if err != nil {
+			return err
+		}
+		return s.send(req, nil)
+	}()
+	if err != nil {
+		if req, rerr := s.request(http.MethodDelete, key, upload, nil, emptySHA256, nil); rerr == nil {
+			s.send(req, nil)
+		}
+		return err
+	}
+	return nil
+}
+
+type s3Part struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3CompleteUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []s3Part `xml:"Part"`
+}
+
+// s3PartSize is the size of each part of a multipart upload. S3 needs
+// every part but the last to be at least 5MB.
+const s3PartSize = 8 << 20
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+func (s *S3) partLimit() int {
+	if s.partSize > 0 {
+		return s.partSize
+	}
+	return s3PartSize
+}
+
+// readerSize returns how much is left to read from r, when r can seek.
+func readerSize(r io.Reader) (int64, bool) {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return 0, false
+	}
+	cur, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false
+	}
+	if _, err := seeker.Seek(cur, io.SeekStart); err != nil {
+		return 0, false
+	}
+	return end - cur, true
+}
+
+// readPart reads up to size bytes, returning fewer only at the end of r.
+func readPart(r io.Reader, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return buf[:n], err
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// send sends req and decodes an XML response into out, when it is not nil.
+// Completing a multipart upload can fail after a 200, with an Error
+// document as the body, so that is checked for too.
+func (s *S3) send(req *http.Request, out interface{}) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := s3Error(resp); err != nil {
+		return err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	var e struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(body, &e) == nil && e.XMLName.Local == "Error" {
+		return fmt.Errorf("s3: %s: %s", e.Code, e.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return xml.Unmarshal(body, out)
+}
+
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	req, err := s.request(http.MethodGet, key, nil, nil, emptySHA256, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s3Error(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete succeeds for missing keys, as S3 itself does.
+func (s *S3) Delete(key string) error {
+	req, err := s.request(http.MethodDelete, key, nil, nil, emptySHA256, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := s3Error(resp); err != nil && err != ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+func (s *S3) URL(key string) (string, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return "", err
+	}
+	if !s.Private {
+		return obj.String(), nil
+	}
+	return s.presign(http.MethodGet, obj, s.Expiry, s.time()), nil
+}
+
+func (s *S3) request(method, key string, query url.Values, body io.Reader, payloadHash string, prepare func(*http.Request)) (*http.Request, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return nil, err
+	}
+	u := obj.String()
+	if len(query) > 0 {
+		u += "?" + canonicalQueryString(query)
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+	s.sign(req, obj, payloadHash, s.time())
+	return req, nil
+}
+
+// sign adds the Authorization header. Host, Content-Type, Range and every
+// x-amz- header are signed.
+func (s *S3) sign(req *http.Request, obj s3Object, payloadHash string, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": obj.host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	scope := amzDate[:8] + "/" + s.region() + "/s3/aws4_request"
+	sig := s.signature(req.Method, obj.path, canonicalQueryString(req.URL.Query()), canonical.String(), signed, payloadHash, amzDate, scope)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signed, sig))
+}
+
+// presign returns a URL that grants method on the object until expiry.
+func (s *S3) presign(method string, obj s3Object, expiry time.Duration, t time.Time) string {
+	amzDate := t.Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + s.region() + "/s3/aws4_request"
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.AccessKey + "/" + scope},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(expiry.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	canonicalQuery := canonicalQueryString(query)
+	sig := s.signature(method, obj.path, canonicalQuery, "host:"+obj.host+"\n", "host", unsignedPayload, amzDate, scope)
+	return obj.String() + "?" + canonicalQuery + "&X-Amz-Signature=" + sig
+}
+
+func (s *S3) signature(method, path, query, headers, signedHeaders, payloadHash, amzDate, scope string) string {
+	canonicalRequest := strings.Join([]string{method, path, query, headers, signedHeaders, payloadHash}, "\n")
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), amzDate[:8])
+	key = hmacSHA256(key, s.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalQueryString(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Error turns an error response into an error carrying S3's code and
+// message.
+func s3Error(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	var e struct {
+		Code    string
+		Message string
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e); err != nil || e.Code == "" {
+		return fmt.Errorf("s3: %s", resp.Status)
+	}
+	return fmt.Errorf("s3: %s: %s", e.Code, e.Message)
+}
@@ -0,0 +1,159 @@
+// Package storage keeps user files, such as template images and generated
+// reports, on the backend chosen in each user's file settings.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"email_campaign/internal/types"
+)
+
+// Storage is a file backend. Keys are slash-separated relative paths such
+// as "reports/7/report-1a2b.csv".
+type Storage interface {
+	Put(key string, r io.Reader, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+	// URL returns where the file can be fetched from. On private backends
+	// it is signed and expires.
+	URL(key string) (string, error)
+}
+
+// PublicPrefix starts the keys of files anyone may fetch, the media
+// library's images. Files under other keys, such as reports, exports and
+// import uploads, are private and read through Get.
+const PublicPrefix = "media/"
+
+// Public reports whether the file at key may be served to anyone.
+func Public(key string) bool {
+	return strings.HasPrefix(key, PublicPrefix)
+}
+
+const (
+	ProviderFilesystem = "filesystem"
+	ProviderS3         = "s3"
+	ProviderCloudinary = "cloudinary"
+)
+
+var (
+	ErrNotFound       = errors.New("file not found")
+	ErrInvalidKey     = errors.New("invalid file key")
+	ErrUnknownBackend = errors.New("unknown file provider")
+	ErrNotConfigured  = errors.New("file provider is not fully configured")
+)
+
+// httpClient bounds how long a provider may take to answer, not how long a
+// body takes to send or read, since files can be large.
+var httpClient = &http.Client{Transport: func() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ResponseHeaderTimeout = 30 * time.Second
+	return t
+}()}
+
+// defaultExpiry is used for signed URLs when no expiry is set.
+const defaultExpiry = 15 * time.Minute
+
+// New returns the backend selected by the settings. The filesystem backend
+// is shared by every user, so it is passed in rather than built here.
+func New(s *types.UserSettings, fs Storage) (Storage, error) {
+	switch s.FileProvider {
+	case "", ProviderFilesystem:
+		return fs, nil
+	case ProviderS3:
+		if s.S3Bucket == "" || s.S3AccessKey == "" || s.S3SecretKey == "" || s.S3Region == "" && s.S3Endpoint == "" {
+			return nil, fmt.Errorf("%w: s3 needs a bucket, region or endpoint, and keys", ErrNotConfigured)
+		}
+		expiry := time.Duration(s.S3UploadExpiry) * time.Minute
+		if expiry <= 0 {
+			expiry = defaultExpiry
+		}
+		return &S3{
+			Endpoint:  s.S3Endpoint,
+			Region:    s.S3Region,
+			Bucket:    s.S3Bucket,
+			Prefix:    s.S3BucketPath,
+			AccessKey: s.S3AccessKey,
+			SecretKey: s.S3SecretKey,
+			Private:   s.S3BucketType == "private",
+			Expiry:    expiry,
+			client:    httpClient,
+		}, nil
+	case ProviderCloudinary:
+		if s.CloudinaryCloudName == "" || s.CloudinaryApiKey == "" || s.CloudinaryApiSecret == "" {
+			return nil, fmt.Errorf("%w: cloudinary needs a cloud name, API key and API secret", ErrNotConfigured)
+		}
+		return &Cloudinary{
+			CloudName: s.CloudinaryCloudName,
+			APIKey:    s.CloudinaryApiKey,
+			APISecret: s.CloudinaryApiSecret,
+			client:    httpClient,
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, s.FileProvider)
+	}
+}
+
+// SettingsSource looks up a user's file settings.
+type SettingsSource interface {
+	GetSettings(userID uint64) (*types.UserSettings, error)
+}
+
+// Resolver picks each user's backend from their current settings.
+type Resolver struct {
+	settings SettingsSource
+	fs       Storage
+}
+
+func NewResolver(settings SettingsSource, fs Storage) *Resolver {
+	return &Resolver{settings: settings, fs: fs}
+}
+
+func (r *Resolver) ForUser(userID uint64) (Storage, error) {
+	s, err := r.settings.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	return New(s, r.fs)
+}
+
+// checkKey rejects keys that could escape the storage root.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// escapePath percent-encodes each segment of key, keeping the slashes.
+func escapePath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = uriEncode(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+// uriEncode escapes everything but the unreserved characters, as S3
+// signing requires.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,160 @@
+package tracking
+
+import (
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Class says who most likely caused an open or click.
+type Class string
+
+const (
+	ClassHuman Class = "human"
+	// ClassProxy is an image fetched ahead of time by a mail privacy
+	// proxy (Apple Mail Privacy Protection, Gmail/Yahoo image proxies).
+	ClassProxy Class = "proxy"
+	// ClassScanner is a link or image fetched by a security gateway,
+	// crawler or other automated client.
+	ClassScanner Class = "scanner"
+)
+
+// Hit is everything the classifier looks at for one open or click.
+type Hit struct {
+	Kind      Kind
+	UserAgent string
+	IPAddress string // may include a port, as in http.Request.RemoteAddr
+	At        time.Time
+	SentAt    time.Time // zero when unknown
+
+	// RecentLinks is how many distinct links the same recipient clicked
+	// within the classifier's burst window before this click, and
+	// CampaignLinks how many links the campaign has in total.
+	RecentLinks   int
+	CampaignLinks int
+}
+
+var (
+	proxyAgents = []string{"googleimageproxy", "ggpht.com", "yahoomailproxy"}
+
+	scannerAgents = []string{
+		"bot", "crawler", "spider", "headless",
+		"barracuda", "mimecast", "proofpoint", "symantec", "trendmicro", "forcepoint", "sophos",
+		"microsoft office protection", "safelinks",
+		"curl/", "wget/", "python-", "go-http-client", "java/", "okhttp", "libwww", "httpclient",
+	}
+
+	// Apple's own network; Mail Privacy Protection prefetches from here.
+	defaultProxyNets = []string{"17.0.0.0/8"}
+)
+
+type Classifier struct {
+	ProxyNets   []*net.IPNet
+	ScannerNets []*net.IPNet
+
+	// Opens and clicks this soon after sending are prefetches or gateway
+	// scans; no person is that quick.
+	PrefetchWindow time.Duration
+
+	// Clicking BurstLinks distinct links within BurstWindow, or every link
+	// of a campaign with fewer, is treated as a scanner following all links.
+	BurstWindow time.Duration
+	BurstLinks  int
+}
+
+func NewClassifier() *Classifier {
+	return &Classifier{
+		ProxyNets:      parseNets(defaultProxyNets),
+		PrefetchWindow: 10 * time.Second,
+		BurstWindow:    10 * time.Second,
+		BurstLinks:     3,
+	}
+}
+
+// ClassifierFromEnv extends the built-in proxy ranges with the
+// comma-separated CIDRs in TRACKING_PROXY_CIDRS, and sets scanner ranges
+// (security gateways seen in your own traffic) from TRACKING_SCANNER_CIDRS.
+func ClassifierFromEnv() *Classifier {
+	c := NewClassifier()
+	c.ProxyNets = append(c.ProxyNets, parseNets(strings.Split(os.Getenv("TRACKING_PROXY_CIDRS"), ","))...)
+	c.ScannerNets = parseNets(strings.Split(os.Getenv("TRACKING_SCANNER_CIDRS"), ","))
+	return c
+}
+
+func (c *Classifier) Classify(h Hit) Class {
+	ua := strings.ToLower(strings.TrimSpace(h.UserAgent))
+	ip := ParseIP(h.IPAddress)
+
+	if containsAny(ua, proxyAgents) {
+		return ClassProxy
+	}
+	if ua == "" || containsAny(ua, scannerAgents) || inNets(ip, c.ScannerNets) {
+		return ClassScanner
+	}
+
+	early := !h.SentAt.IsZero() && h.At.Sub(h.SentAt) < c.PrefetchWindow
+
+	if h.Kind == KindOpen {
+		// MPP fetches with a bare "Mozilla/5.0" from Apple's network.
+		if inNets(ip, c.ProxyNets) || ua == "mozilla/5.0" || early {
+			return ClassProxy
+		}
+		return ClassHuman
+	}
+
+	if early || c.IsBurst(h.RecentLinks+1, h.CampaignLinks) {
+		return ClassScanner
+	}
+	return ClassHuman
+}
+
+// IsBurst reports whether clicking links distinct links inside the burst
+// window looks like a scanner following every link.
+func (c *Classifier) IsBurst(links, campaignLinks int) bool {
+	threshold := c.BurstLinks
+	if campaignLinks >= 2 && campaignLinks < threshold {
+		threshold = campaignLinks
+	}
+	return threshold > 0 && links >= threshold
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIP parses an address as found in http.Request.RemoteAddr, with or
+// without a port.
+func ParseIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.TrimSpace(addr))
+}
+
+func inNets(ip net.IP, nets []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseNets(cidrs []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, s := range cidrs {
+		if _, n, err := net.ParseCIDR(strings.TrimSpace(s)); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
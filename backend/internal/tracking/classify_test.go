@@ -0,0 +1,52 @@
+package tracking
+
+import (
+	"testing"
+	"time"
+)
+
+const chromeUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+
+func TestClassify(t *testing.T) {
+	c := NewClassifier()
+	sent := time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+	later := sent.Add(2 * time.Hour)
+
+	cases := map[string]struct {
+		hit  Hit
+		want Class
+	}{
+		"human open":       {Hit{Kind: KindOpen, UserAgent: chromeUA, IPAddress: "203.0.113.7:51234", At: later, SentAt: sent}, ClassHuman},
+		"gmail proxy":      {Hit{Kind: KindOpen, UserAgent: "Mozilla/5.0 (Windows NT 5.1; rv:11.0) Gecko Firefox/11.0 (via ggpht.com GoogleImageProxy)", IPAddress: "66.102.8.1", At: later}, ClassProxy},
+		"apple mpp":        {Hit{Kind: KindOpen, UserAgent: "Mozilla/5.0", IPAddress: "17.58.1.2:443", At: later}, ClassProxy},
+		"apple network":    {Hit{Kind: KindOpen, UserAgent: chromeUA, IPAddress: "17.1.2.3", At: later}, ClassProxy},
+		"open on delivery": {Hit{Kind: KindOpen, UserAgent: chromeUA, At: sent.Add(3 * time.Second), SentAt: sent}, ClassProxy},
+		"no user agent":    {Hit{Kind: KindClick, At: later}, ClassScanner},
+		"gateway":          {Hit{Kind: KindClick, UserAgent: "Mozilla/5.0 Barracuda Sentinel", At: later}, ClassScanner},
+		"script":           {Hit{Kind: KindClick, UserAgent: "python-requests/2.31", At: later}, ClassScanner},
+		"instant click":    {Hit{Kind: KindClick, UserAgent: chromeUA, At: sent.Add(time.Second), SentAt: sent}, ClassScanner},
+		"human click":      {Hit{Kind: KindClick, UserAgent: chromeUA, At: later, SentAt: sent, RecentLinks: 1, CampaignLinks: 5}, ClassHuman},
+		"every link":       {Hit{Kind: KindClick, UserAgent: chromeUA, At: later, RecentLinks: 2, CampaignLinks: 8}, ClassScanner},
+		"both of two":      {Hit{Kind: KindClick, UserAgent: chromeUA, At: later, RecentLinks: 1, CampaignLinks: 2}, ClassScanner},
+		"single link":      {Hit{Kind: KindClick, UserAgent: chromeUA, At: later, CampaignLinks: 1}, ClassHuman},
+	}
+	for name, tc := range cases {
+		if got := c.Classify(tc.hit); got != tc.want {
+			t.Errorf("%s: got %s, want %s", name, got, tc.want)
+		}
+	}
+}
+
+func TestClassifierFromEnv(t *testing.T) {
+	t.Setenv("TRACKING_SCANNER_CIDRS", "198.51.100.0/24, bogus")
+	c := ClassifierFromEnv()
+
+	hit := Hit{Kind: KindClick, UserAgent: chromeUA, IPAddress: "198.51.100.20:1234", At: time.Now()}
+	if got := c.Classify(hit); got != ClassScanner {
+		t.Errorf("got %s, want scanner", got)
+	}
+	hit.IPAddress = "203.0.113.7"
+	if got := c.Classify(hit); got != ClassHuman {
+		t.Errorf("got %s, want human", got)
+	}
+}
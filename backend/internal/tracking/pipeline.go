@@ -0,0 +1,400 @@
+package tracking
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"email_campaign/internal/logger"
+)
+
+// ErrPipelineFull is returned by Enqueue when the buffer stays full for
+// longer than the enqueue timeout and there is no spill directory.
+var ErrPipelineFull = errors.New("tracking pipeline full")
+
+// ErrPipelineClosed is returned by Enqueue after Close.
+var ErrPipelineClosed = errors.New("tracking pipeline closed")
+
+// Event is one verified open or click waiting to be recorded.
+type Event struct {
+	Token     Token     `json:"token"`
+	URL       string    `json:"url,omitempty"`
+	UserAgent string    `json:"user_agent"`
+	IPAddress string    `json:"ip_address"`
+	At        time.Time `json:"at"`
+}
+
+// ErrRejected is wrapped by a Recorder's error when the database refuses
+// a batch for what one of its events holds, rather than for being
+// unavailable. Retrying the batch would fail the same way, so its events
+// are recorded one at a time and the ones rejected are dropped.
+var ErrRejected = errors.New("tracking event rejected")
+
+// Recorder writes a batch of events to the database.
+type Recorder interface {
+	RecordHits(events []Event) error
+}
+
+type PipelineConfig struct {
+	Workers       int
+	BufferSize    int // per worker
+	BatchSize     int
+	FlushInterval time.Duration
+	// EnqueueTimeout is how long Enqueue waits for room before giving up,
+	// which slows tracking requests down instead of growing memory.
+	EnqueueTimeout time.Duration
+
+	// SpillDir, when set, receives batches that could not be written and
+	// events that did not fit in the buffer. They are replayed every
+	// RetryInterval once the database is reachable again.
+	SpillDir      string
+	RetryInterval time.Duration
+}
+
+func DefaultPipelineConfig() PipelineConfig {
+	return PipelineConfig{
+		Workers:        2,
+		BufferSize:     5000,
+		BatchSize:      500,
+		FlushInterval:  time.Second,
+		EnqueueTimeout: 100 * time.Millisecond,
+		RetryInterval:  30 * time.Second,
+	}
+}
+
+// PipelineConfigFromEnv is DefaultPipelineConfig with the spill directory
+// taken from TRACKING_SPILL_DIR.
+func PipelineConfigFromEnv() PipelineConfig {
+	cfg := DefaultPipelineConfig()
+	cfg.SpillDir = os.Getenv("TRACKING_SPILL_DIR")
+	return cfg
+}
+
+// Pipeline buffers tracking events in memory and writes them in batches.
+// Events are sharded by recipient so one worker sees all of a recipient's
+// clicks in order, which keeps burst detection accurate.
+type Pipeline struct {
+	rec    Recorder
+	cfg    PipelineConfig
+	shards []chan Event
+
+	mu     sync.RWMutex
+	closed bool
+
+	spillSeq atomic.Uint64
+	spillMu  sync.Mutex // serializes replay against itself
+
+	wg   sync.WaitGroup
+	stop chan struct{}
+	done chan struct{}
+	// replayed is closed when the replay loop has returned.
+	replayed chan struct{}
+}
+
+func NewPipeline(rec Recorder, cfg PipelineConfig) *Pipeline {
+	def := DefaultPipelineConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = def.Workers
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = def.BufferSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = def.FlushInterval
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = def.RetryInterval
+	}
+
+	p := &Pipeline{
+		rec:      rec,
+		cfg:      cfg,
+		shards:   make([]chan Event, cfg.Workers),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		replayed: make(chan struct{}),
+	}
+	for i := range p.shards {
+		p.shards[i] = make(chan Event, cfg.BufferSize)
+		p.wg.Add(1)
+		go p.work(p.shards[i])
+	}
+	go func() {
+		p.wg.Wait()
+		close(p.done)
+	}()
+	if cfg.SpillDir != "" {
+		go p.replayLoop()
+	} else {
+		close(p.replayed)
+	}
+	return p
+}
+
+// Enqueue hands an event to the pipeline. When the buffer is full it waits
+// up to EnqueueTimeout, then spills the event to disk if it can and
+// returns ErrPipelineFull if it cannot.
+func (p *Pipeline) Enqueue(e Event) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPipelineClosed
+	}
+
+	shard := p.shards[e.Token.RecipientID%uint64(len(p.shards))]
+	select {
+	case shard <- e:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(p.cfg.EnqueueTimeout)
+	defer timer.Stop()
+	select {
+	case shard <- e:
+		return nil
+	case <-timer.C:
+	}
+
+	if p.cfg.SpillDir != "" {
+		return p.spill([]Event{e})
+	}
+	return ErrPipelineFull
+}
+
+// Close stops accepting events and waits for everything buffered to be
+// written, or spilled, and for a replay in progress to finish, until ctx
+// is done.
+func (p *Pipeline) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.stop)
+		for _, shard := range p.shards {
+			close(shard)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, done := range []chan struct{}{p.done, p.replayed} {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) work(in <-chan Event) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, p.cfg.BatchSize)
+	for {
+		select {
+		case e, ok := <-in:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(batch)
+				batch = make([]Event, 0, p.cfg.BatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = make([]Event, 0, p.cfg.BatchSize)
+			}
+		}
+	}
+}
+
+func (p *Pipeline) flush(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+	rest, err := p.record(batch)
+	if err == nil {
+		return
+	}
+
+	if p.cfg.SpillDir != "" {
+		serr := p.spill(rest)
+		if serr == nil {
+			logger.Error("Tracking events spilled to disk", map[string]interface{}{"count": len(rest), "error": err.Error()})
+			return
+		}
+		err = fmt.Errorf("%v; spill: %v", err, serr)
+	}
+	logger.Error("Tracking events dropped", map[string]interface{}{"count": len(rest), "error": err.Error()})
+}
+
+// record writes a batch. When the batch is rejected, its events are
+// written one at a time and those rejected on their own are dropped. On
+// any other failure it returns the events not yet written.
+func (p *Pipeline) record(batch []Event) ([]Event, error) {
+	err := p.rec.RecordHits(batch)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, ErrRejected) {
+		return batch, err
+	}
+	for i, e := range batch {
+		err := p.rec.RecordHits([]Event{e})
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrRejected):
+			logger.Error("Tracking event rejected", map[string]interface{}{
+				"campaign_id": e.Token.CampaignID, "recipient_id": e.Token.RecipientID, "error": err.Error(),
+			})
+		default:
+			return batch[i:], err
+		}
+	}
+	return nil, nil
+}
+
+// spill writes events to a new file in SpillDir.
+func (p *Pipeline) spill(events []Event) error {
+	if err := os.MkdirAll(p.cfg.SpillDir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("events-%d-%d.jsonl", time.Now().UnixNano(), p.spillSeq.Add(1))
+	return writeSpill(filepath.Join(p.cfg.SpillDir, name), events)
+}
+
+// writeSpill writes events to path. The file is written under a temporary
+// name and renamed, so replay never sees a partial file.
+func writeSpill(path string, events []Event) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path))
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (p *Pipeline) replayLoop() {
+	defer close(p.replayed)
+
+	ticker := time.NewTicker(p.cfg.RetryInterval)
+	defer ticker.Stop()
+
+	select {
+	case <-p.stop:
+		return
+	default:
+	}
+	p.Replay()
+	for {
+		select {
+		case <-ticker.C:
+			p.Replay()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Replay records spilled files oldest first, stopping at the first
+// failure so events are not reordered more than necessary. Events the
+// database rejects are dropped rather than stopping it.
+func (p *Pipeline) Replay() {
+	p.spillMu.Lock()
+	defer p.spillMu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(p.cfg.SpillDir, "events-*.jsonl"))
+	if err != nil || len(files) == 0 {
+		return
+	}
+	sort.Strings(files)
+
+	for _, path := range files {
+		events, err := readSpill(path)
+		if err != nil {
+			logger.Error("Unreadable tracking spill file", map[string]interface{}{"file": path, "error": err.Error()})
+			os.Rename(path, strings.TrimSuffix(path, ".jsonl")+".bad")
+			continue
+		}
+		for start := 0; start < len(events); start += p.cfg.BatchSize {
+			end := min(start+p.cfg.BatchSize, len(events))
+			if rest, err := p.record(events[start:end]); err != nil {
+				// Keep what is left for the next attempt.
+				// rest ends where the batch does.
+				if left := events[end-len(rest):]; len(left) < len(events) {
+					p.rewriteSpill(path, left)
+				}
+				return
+			}
+		}
+		os.Remove(path)
+		logger.Info("Replayed spilled tracking events", map[string]interface{}{"file": path, "count": len(events)})
+	}
+}
+
+// rewriteSpill replaces a spill file with the events left in it. The file
+// keeps its name, so it stays ahead of the files spilled after it.
+func (p *Pipeline) rewriteSpill(path string, rest []Event) {
+	if err := writeSpill(path, rest); err != nil {
+		logger.Error("Could not rewrite tracking spill file", map[string]interface{}{"file": path, "error": err.Error()})
+	}
+}
+
+func readSpill(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	dec := json.NewDecoder(f)
+	for {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			if errors.Is(err, io.EOF) {
+				return events, nil
+			}
+			return nil, err
+		}
+		events = append(events, e)
+	}
+}
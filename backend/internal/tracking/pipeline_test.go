@@ -0,0 +1,219 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeRecorder struct {
+	mu      sync.Mutex
+	batches [][]Event
+	err     error
+	block   chan struct{}
+	// reject makes batches holding this recipient's events fail with
+	// ErrRejected.
+	reject uint64
+}
+
+func (f *fakeRecorder) RecordHits(events []Event) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	for _, e := range events {
+		if f.reject != 0 && e.Token.RecipientID == f.reject {
+			return fmt.Errorf("%w: data too long", ErrRejected)
+		}
+	}
+	f.batches = append(f.batches, append([]Event(nil), events...))
+	return nil
+}
+
+func (f *fakeRecorder) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *fakeRecorder) count() (batches, events int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, b := range f.batches {
+		events += len(b)
+	}
+	return len(f.batches), events
+}
+
+func event(recipientID uint64) Event {
+	return Event{Token: Token{Kind: KindOpen, CampaignID: 1, RecipientID: recipientID}, At: time.Now()}
+}
+
+func TestPipelineBatchesAndFlushesOnClose(t *testing.T) {
+	rec := &fakeRecorder{}
+	p := NewPipeline(rec, PipelineConfig{Workers: 1, BatchSize: 10, FlushInterval: time.Hour})
+
+	for i := 1; i <= 25; i++ {
+		if err := p.Enqueue(event(uint64(i))); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if batches, events := rec.count(); batches != 3 || events != 25 {
+		t.Errorf("got %d batches with %d events, want 3 with 25", batches, events)
+	}
+	if err := p.Enqueue(event(1)); !errors.Is(err, ErrPipelineClosed) {
+		t.Errorf("Enqueue after Close: got %v", err)
+	}
+}
+
+func TestPipelineBackpressure(t *testing.T) {
+	rec := &fakeRecorder{block: make(chan struct{})}
+	p := NewPipeline(rec, PipelineConfig{Workers: 1, BufferSize: 2, BatchSize: 1, FlushInterval: time.Hour, EnqueueTimeout: 10 * time.Millisecond})
+
+	var err error
+	for i := 1; i <= 10 && err == nil; i++ {
+		err = p.Enqueue(event(uint64(i)))
+	}
+	if !errors.Is(err, ErrPipelineFull) {
+		t.Errorf("got %v, want ErrPipelineFull", err)
+	}
+
+	close(rec.block)
+	p.Close(context.Background())
+}
+
+func TestPipelineSpillsAndReplays(t *testing.T) {
+	dir := t.TempDir()
+	rec := &fakeRecorder{err: errors.New("database is down")}
+	p := NewPipeline(rec, PipelineConfig{Workers: 2, BatchSize: 100, FlushInterval: time.Hour, SpillDir: dir, RetryInterval: time.Hour})
+
+	for i := 1; i <= 5; i++ {
+		p.Enqueue(event(uint64(i)))
+	}
+	p.Close(context.Background())
+
+	files, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl"))
+	if len(files) == 0 {
+		t.Fatal("nothing spilled")
+	}
+
+	rec.setErr(nil)
+	p.Replay()
+
+	if _, events := rec.count(); events != 5 {
+		t.Errorf("replayed %d events, want 5", events)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl")); len(files) != 0 {
+		t.Errorf("%d spill files left after replay", len(files))
+	}
+}
+
+func TestPipelineDropsRejectedEvents(t *testing.T) {
+	dir := t.TempDir()
+	rec := &fakeRecorder{reject: 3}
+	p := NewPipeline(rec, PipelineConfig{Workers: 1, BatchSize: 100, FlushInterval: time.Hour, SpillDir: dir, RetryInterval: time.Hour})
+	for i := 1; i <= 5; i++ {
+		p.Enqueue(event(uint64(i)))
+	}
+	p.Close(context.Background())
+
+	if _, events := rec.count(); events != 4 {
+		t.Errorf("recorded %d events, want the 4 not rejected", events)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl")); len(files) != 0 {
+		t.Errorf("rejected events were spilled: %v", files)
+	}
+
+	// A spill file holding a rejected event is replayed all the same.
+	rec = &fakeRecorder{err: errors.New("database is down"), reject: 2}
+	p = NewPipeline(rec, PipelineConfig{Workers: 1, BatchSize: 2, FlushInterval: time.Hour, SpillDir: dir, RetryInterval: time.Hour})
+	for i := 1; i <= 5; i++ {
+		p.Enqueue(event(uint64(i)))
+	}
+	p.Close(context.Background())
+
+	rec.setErr(nil)
+	p.Replay()
+	if _, events := rec.count(); events != 4 {
+		t.Errorf("replayed %d events, want 4", events)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl")); len(files) != 0 {
+		t.Errorf("%d spill files left after replay", len(files))
+	}
+}
+
+type recorderFunc func(events []Event) error
+
+func (f recorderFunc) RecordHits(events []Event) error { return f(events) }
+
+func TestPipelineCloseWaitsForReplay(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeSpill(filepath.Join(dir, "events-1-1.jsonl"), []Event{event(1)}); err != nil {
+		t.Fatal(err)
+	}
+	entered, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	rec := recorderFunc(func([]Event) error {
+		once.Do(func() { close(entered) })
+		<-release
+		return nil
+	})
+	p := NewPipeline(rec, PipelineConfig{Workers: 1, FlushInterval: time.Hour, SpillDir: dir, RetryInterval: time.Hour})
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close during replay: got %v, want it to wait", err)
+	}
+	close(release)
+	if err := p.Close(context.Background()); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestPipelineReplayKeepsSpillOrder(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "events-1-1.jsonl")
+	second := filepath.Join(dir, "events-2-2.jsonl")
+	writeSpill(first, []Event{event(1), event(2), event(3)})
+	writeSpill(second, []Event{event(4)})
+
+	// The database goes away after the first event is written.
+	var mu sync.Mutex
+	var recorded []uint64
+	calls := 0
+	rec := recorderFunc(func(events []Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if calls++; calls == 2 {
+			return errors.New("database is down")
+		}
+		for _, e := range events {
+			recorded = append(recorded, e.Token.RecipientID)
+		}
+		return nil
+	})
+	p := NewPipeline(rec, PipelineConfig{Workers: 1, BatchSize: 1, FlushInterval: time.Hour, SpillDir: dir, RetryInterval: time.Hour})
+	p.Close(context.Background())
+	p.Replay()
+	p.Replay()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(recorded) != "[1 2 3 4]" {
+		t.Errorf("replayed recipients %v, want [1 2 3 4]", recorded)
+	}
+}
@@ -0,0 +1,135 @@
+// Package tracking issues and verifies the signed tokens embedded in open
+// pixels and click links.
+package tracking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"os"
+	"time"
+)
+
+// Kind says what a token may be used for, so an open token cannot be
+// replayed as a click and vice versa.
+type Kind byte
+
+const (
+	KindOpen  Kind = 1
+	KindClick Kind = 2
+	// KindView opens the hosted "view in browser" copy of an email.
+	KindView Kind = 3
+	// KindUnsubscribe unsubscribes the recipient's contact.
+	KindUnsubscribe Kind = 4
+)
+
+const (
+	// tokenVersion is the first byte of every token. Bump it when the
+	// layout or key derivation changes; older versions are then rejected.
+	tokenVersion = 1
+	macSize      = 16
+
+	// DefaultMaxAge is how long links in a sent email keep working.
+	DefaultMaxAge = 365 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid tracking token")
+	ErrExpiredToken = errors.New("tracking token expired")
+)
+
+// Token binds an event to one recipient of one campaign and, for clicks,
+// to one registered link.
+type Token struct {
+	Kind        Kind
+	CampaignID  uint64
+	RecipientID uint64
+	LinkID      uint64
+	IssuedAt    time.Time
+}
+
+type Signer struct {
+	key    []byte
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+func NewSigner(secret []byte, maxAge time.Duration) *Signer {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("tracking-token-v1"))
+	return &Signer{key: mac.Sum(nil), maxAge: maxAge, now: time.Now}
+}
+
+// SignerFromEnv uses TRACKING_SECRET, falling back to a key derived from
+// fallbackSecret (the JWT secret) so existing deployments keep working.
+func SignerFromEnv(fallbackSecret string) *Signer {
+	secret := os.Getenv("TRACKING_SECRET")
+	if secret == "" {
+		secret = "tracking:" + fallbackSecret
+	}
+	return NewSigner([]byte(secret), DefaultMaxAge)
+}
+
+// Sign encodes t as a URL-safe string. IssuedAt defaults to now.
+func (s *Signer) Sign(t Token) string {
+	if t.IssuedAt.IsZero() {
+		t.IssuedAt = s.now()
+	}
+
+	buf := make([]byte, 0, 2+4*binary.MaxVarintLen64+macSize)
+	buf = append(buf, tokenVersion, byte(t.Kind))
+	buf = binary.AppendUvarint(buf, t.CampaignID)
+	buf = binary.AppendUvarint(buf, t.RecipientID)
+	buf = binary.AppendUvarint(buf, t.LinkID)
+	buf = binary.AppendUvarint(buf, uint64(t.IssuedAt.Unix()))
+	buf = append(buf, s.mac(buf)...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// Verify decodes a token and checks its signature, kind and age.
+func (s *Signer) Verify(token string, kind Kind) (*Token, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) < 2+4+macSize {
+		return nil, ErrInvalidToken
+	}
+
+	payload, sig := raw[:len(raw)-macSize], raw[len(raw)-macSize:]
+	if !hmac.Equal(sig, s.mac(payload)) {
+		return nil, ErrInvalidToken
+	}
+	if payload[0] != tokenVersion || Kind(payload[1]) != kind {
+		return nil, ErrInvalidToken
+	}
+
+	t := &Token{Kind: kind}
+	rest := payload[2:]
+	var issued uint64
+	for _, f := range []*uint64{&t.CampaignID, &t.RecipientID, &t.LinkID, &issued} {
+		v, n := binary.Uvarint(rest)
+		if n <= 0 {
+			return nil, ErrInvalidToken
+		}
+		*f = v
+		rest = rest[n:]
+	}
+	if len(rest) != 0 || t.CampaignID == 0 || t.RecipientID == 0 {
+		return nil, ErrInvalidToken
+	}
+	if kind == KindClick && t.LinkID == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	t.IssuedAt = time.Unix(int64(issued), 0)
+	if s.maxAge > 0 && s.now().Sub(t.IssuedAt) > s.maxAge {
+		return nil, ErrExpiredToken
+	}
+	return t, nil
+}
+
+func (s *Signer) mac(payload []byte) []byte {
+	m := hmac.New(sha256.New, s.key)
+	m.Write(payload)
+	return m.Sum(nil)[:macSize]
+}
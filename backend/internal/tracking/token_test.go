@@ -0,0 +1,62 @@
+package tracking
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	s := NewSigner([]byte("secret"), DefaultMaxAge)
+
+	token := s.Sign(Token{Kind: KindClick, CampaignID: 12, RecipientID: 3456, LinkID: 7})
+	got, err := s.Verify(token, KindClick)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got.CampaignID != 12 || got.RecipientID != 3456 || got.LinkID != 7 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestVerifyRejectsForgeries(t *testing.T) {
+	s := NewSigner([]byte("secret"), DefaultMaxAge)
+	open := s.Sign(Token{Kind: KindOpen, CampaignID: 12, RecipientID: 3456})
+
+	// The old format: base64 of "campaignID:contactID".
+	legacy := base64.StdEncoding.EncodeToString([]byte("12:3456"))
+
+	raw, _ := base64.RawURLEncoding.DecodeString(open)
+	raw[3] ^= 0x01
+	flipped := base64.RawURLEncoding.EncodeToString(raw)
+
+	other := NewSigner([]byte("other"), DefaultMaxAge).Sign(Token{Kind: KindOpen, CampaignID: 12, RecipientID: 3456})
+
+	cases := map[string]struct {
+		token string
+		kind  Kind
+	}{
+		"legacy":          {legacy, KindOpen},
+		"tampered":        {flipped, KindOpen},
+		"wrong key":       {other, KindOpen},
+		"wrong kind":      {open, KindClick},
+		"empty":           {"", KindOpen},
+		"not base64":      {"%%%", KindOpen},
+		"click sans link": {s.Sign(Token{Kind: KindClick, CampaignID: 1, RecipientID: 1}), KindClick},
+	}
+	for name, c := range cases {
+		if _, err := s.Verify(c.token, c.kind); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: got %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestVerifyRejectsExpired(t *testing.T) {
+	s := NewSigner([]byte("secret"), time.Hour)
+	token := s.Sign(Token{Kind: KindOpen, CampaignID: 1, RecipientID: 2, IssuedAt: time.Now().Add(-2 * time.Hour)})
+
+	if _, err := s.Verify(token, KindOpen); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("got %v, want ErrExpiredToken", err)
+	}
+}
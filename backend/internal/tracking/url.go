@@ -0,0 +1,38 @@
+package tracking
+
+import (
+	"os"
+	"strings"
+)
+
+const defaultPublicURL = "http://localhost:8080"
+
+// PublicURLFromEnv returns the externally reachable base URL of the API,
+// used for every link placed in outgoing mail. It comes from PUBLIC_URL.
+func PublicURLFromEnv() string {
+	base := os.Getenv("PUBLIC_URL")
+	if base == "" {
+		base = defaultPublicURL
+	}
+	return strings.TrimRight(base, "/")
+}
+
+func OpenURL(base, token string) string {
+	return base + "/api/v1/track/open/" + token
+}
+
+func ClickURL(base, token string) string {
+	return base + "/api/v1/track/click/" + token
+}
+
+func ViewURL(base, token string) string {
+	return base + "/api/v1/public/view/" + token
+}
+
+func UnsubscribeURL(base, token string) string {
+	return base + "/api/v1/public/unsubscribe/" + token
+}
+
+func ArchiveURL(base, slug string) string {
+	return base + "/api/v1/public/archive/" + slug
+}
@@ -0,0 +1,114 @@
+package tracking
+
+import "strings"
+
+const (
+	ClientAppleMail   = "Apple Mail"
+	ClientGmail       = "Gmail"
+	ClientOutlook     = "Outlook"
+	ClientOutlookWeb  = "Outlook.com"
+	ClientYahoo       = "Yahoo Mail"
+	ClientThunderbird = "Thunderbird"
+	ClientAndroidMail = "Android Mail"
+	ClientBrowser     = "Web Browser"
+	ClientOther       = "Other"
+
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceUnknown = "unknown"
+
+	OSiOS      = "iOS"
+	OSAndroid  = "Android"
+	OSMacOS    = "macOS"
+	OSWindows  = "Windows"
+	OSChromeOS = "ChromeOS"
+	OSLinux    = "Linux"
+)
+
+// ClientInfo is what a tracking request's User-Agent says about the
+// recipient's mail client. Empty OS means it could not be told.
+type ClientInfo struct {
+	Client string
+	OS     string
+	Device string
+}
+
+// ParseUserAgent identifies the mail client, operating system and device
+// class behind an open or click. Image proxies hide the device, so opens
+// through them report the proxying client with an unknown device.
+func ParseUserAgent(userAgent string) ClientInfo {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+
+	switch {
+	case strings.Contains(ua, "googleimageproxy"):
+		return ClientInfo{Client: ClientGmail, Device: DeviceUnknown}
+	case strings.Contains(ua, "yahoomailproxy"):
+		return ClientInfo{Client: ClientYahoo, Device: DeviceUnknown}
+	case ua == "mozilla/5.0":
+		// Apple Mail Privacy Protection prefetch.
+		return ClientInfo{Client: ClientAppleMail, Device: DeviceUnknown}
+	}
+
+	info := ClientInfo{OS: parseOS(ua)}
+	info.Device = parseDevice(ua, info.OS)
+	info.Client = parseClient(ua, info.OS)
+	return info
+}
+
+func parseOS(ua string) string {
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return OSiOS
+	case strings.Contains(ua, "android"):
+		return OSAndroid
+	case strings.Contains(ua, "windows"):
+		return OSWindows
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return OSMacOS
+	case strings.Contains(ua, "cros"):
+		return OSChromeOS
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		return OSLinux
+	}
+	return ""
+}
+
+func parseDevice(ua string, os string) string {
+	switch {
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"):
+		return DeviceTablet
+	case os == OSAndroid && !strings.Contains(ua, "mobile"):
+		return DeviceTablet
+	case os == OSiOS, os == OSAndroid, strings.Contains(ua, "mobile"):
+		return DeviceMobile
+	case os != "":
+		return DeviceDesktop
+	}
+	return DeviceUnknown
+}
+
+func parseClient(ua string, os string) string {
+	switch {
+	case strings.Contains(ua, "thunderbird"):
+		return ClientThunderbird
+	case strings.Contains(ua, "owa/"), strings.Contains(ua, "outlook.com"), strings.Contains(ua, "outlook-web"):
+		return ClientOutlookWeb
+	case strings.Contains(ua, "microsoft outlook"), strings.Contains(ua, "ms-office"), strings.Contains(ua, "outlook-"),
+		strings.Contains(ua, "microsoft office"):
+		return ClientOutlook
+	case strings.Contains(ua, "gmail"):
+		return ClientGmail
+	case strings.Contains(ua, "yahoo"):
+		return ClientYahoo
+	case strings.Contains(ua, "applewebkit") && !strings.Contains(ua, "safari") && (os == OSMacOS || os == OSiOS):
+		// Apple Mail renders with WebKit but, unlike Safari, does not say so.
+		return ClientAppleMail
+	case os == OSAndroid && strings.Contains(ua, "; wv)"):
+		return ClientAndroidMail
+	case strings.Contains(ua, "chrome/"), strings.Contains(ua, "firefox/"), strings.Contains(ua, "safari/"),
+		strings.Contains(ua, "edg/"), strings.Contains(ua, "opera"):
+		return ClientBrowser
+	}
+	return ClientOther
+}
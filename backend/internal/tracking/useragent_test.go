@@ -0,0 +1,35 @@
+package tracking
+
+import "testing"
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		name string
+		ua   string
+		want ClientInfo
+	}{
+		{"gmail proxy", "Mozilla/5.0 (Windows NT 5.1; rv:11.0) Gecko Firefox/11.0 (via ggpht.com GoogleImageProxy)",
+			ClientInfo{Client: ClientGmail, Device: DeviceUnknown}},
+		{"apple mpp", "Mozilla/5.0", ClientInfo{Client: ClientAppleMail, Device: DeviceUnknown}},
+		{"apple mail mac", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko)",
+			ClientInfo{Client: ClientAppleMail, OS: OSMacOS, Device: DeviceDesktop}},
+		{"apple mail iphone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148",
+			ClientInfo{Client: ClientAppleMail, OS: OSiOS, Device: DeviceMobile}},
+		{"ipad safari", "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			ClientInfo{Client: ClientBrowser, OS: OSiOS, Device: DeviceTablet}},
+		{"outlook desktop", "Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 10.0; Microsoft Outlook 16.0.17029; ms-office; MSOffice 16)",
+			ClientInfo{Client: ClientOutlook, OS: OSWindows, Device: DeviceDesktop}},
+		{"thunderbird", "Mozilla/5.0 (X11; Linux x86_64; rv:115.0) Gecko/20100101 Thunderbird/115.3.1",
+			ClientInfo{Client: ClientThunderbird, OS: OSLinux, Device: DeviceDesktop}},
+		{"android webview", "Mozilla/5.0 (Linux; Android 14; Pixel 8; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/120.0 Mobile Safari/537.36",
+			ClientInfo{Client: ClientAndroidMail, OS: OSAndroid, Device: DeviceMobile}},
+		{"chrome desktop", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36",
+			ClientInfo{Client: ClientBrowser, OS: OSWindows, Device: DeviceDesktop}},
+		{"unknown", "SomeClient/1.0", ClientInfo{Client: ClientOther, Device: DeviceUnknown}},
+	}
+	for _, c := range cases {
+		if got := ParseUserAgent(c.ua); got != c.want {
+			t.Errorf("%s: ParseUserAgent() = %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
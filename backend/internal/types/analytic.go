@@ -107,3 +107,37 @@ type ExportAnalyticsRequest struct {
 	EndDate   time.Time `json:"end_date" binding:"required"`
 	Format    string    `json:"format" binding:"required,oneof=csv xlsx pdf"`
 }
+
+// AudienceSlice counts opens and clicks for one value of a breakdown
+// dimension, such as one email client or one country.
+type AudienceSlice struct {
+	Value        string `json:"value"`
+	Opens        int    `json:"opens"`
+	Clicks       int    `json:"clicks"`
+	UniqueOpens  int    `json:"unique_opens"`
+	UniqueClicks int    `json:"unique_clicks"`
+}
+
+type CampaignAudienceDTO struct {
+	CampaignID uint64          `json:"campaign_id"`
+	Clients    []AudienceSlice `json:"clients"`
+	Devices    []AudienceSlice `json:"devices"`
+	OS         []AudienceSlice `json:"os"`
+	Countries  []AudienceSlice `json:"countries"`
+}
+
+type AudienceTrendFilter struct {
+	Dimension  string // client, device, os or country
+	Period     string // day, week or month
+	From       *time.Time
+	To         *time.Time
+	CampaignID uint64
+	HumanOnly  bool
+}
+
+type AudienceTrendPoint struct {
+	Period string `json:"period"`
+	Value  string `json:"value"`
+	Opens  int    `json:"opens"`
+	Clicks int    `json:"clicks"`
+}
@@ -0,0 +1,33 @@
+package types
+
+import "time"
+
+// ArchiveSettings control a user's public campaign archive, served at
+// /api/v1/public/archive/{slug}.
+type ArchiveSettings struct {
+	Enabled bool   `json:"enabled"`
+	Slug    string `json:"slug"`
+	Title   string `json:"title"`
+}
+
+type Archive struct {
+	UserID uint64
+	Slug   string
+	Title  string
+}
+
+type ArchivedCampaign struct {
+	ID      uint64
+	Name    string
+	Subject string
+	SentAt  time.Time
+}
+
+// RecipientView is what the "view in browser" page of one recipient's
+// copy of a campaign is rendered from.
+type RecipientView struct {
+	CampaignID  uint64
+	RecipientID uint64
+	UserID      uint64
+	Contact     ContactDTO
+}
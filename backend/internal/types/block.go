@@ -0,0 +1,57 @@
+package types
+
+import "time"
+
+// ContentBlock is a named HTML or MJML snippet that templates pull in with
+// {{ include "name" }}. Blocks may include other blocks.
+type ContentBlock struct {
+	ID          uint64    `json:"id"`
+	UserID      uint64    `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Type        string    `json:"type"`
+	Content     string    `json:"content"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type CreateContentBlockRequest struct {
+	UserID      uint64 `json:"-"`
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Content     string `json:"content" binding:"required"`
+}
+
+// UpdateContentBlockRequest changes the fields that are set.
+type UpdateContentBlockRequest struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	Type        string  `json:"type"`
+	Content     string  `json:"content"`
+}
+
+// ContentBlockUsage lists what renders a block. Templates that include it
+// through another block are marked indirect. Campaigns marked frozen
+// keep the copy they were sent with; the rest follow every edit.
+type ContentBlockUsage struct {
+	BlockID   uint64               `json:"block_id"`
+	Name      string               `json:"name"`
+	Templates []BlockTemplateUsage `json:"templates"`
+	Campaigns []BlockCampaignUsage `json:"campaigns"`
+}
+
+type BlockTemplateUsage struct {
+	ID       uint64 `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Indirect bool   `json:"indirect"`
+}
+
+type BlockCampaignUsage struct {
+	ID         uint64 `json:"id"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	TemplateID uint64 `json:"template_id"`
+	Frozen     bool   `json:"frozen"`
+}
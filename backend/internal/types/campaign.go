@@ -6,6 +6,7 @@ type CampaignDTO struct {
 	ID                uint64       `json:"id"`
 	UserID            uint64       `json:"user_id"`
 	TemplateID        *uint64      `json:"template_id"`
+	TemplateVersion   *int         `json:"template_version"`
 	TemplateName      string       `json:"template_name,omitempty"`
 	Name              string       `json:"name"`
 	Subject           string       `json:"subject"`
@@ -77,25 +78,49 @@ type SendTestEmailRequest struct {
 }
 
 type CampaignStatsDTO struct {
-	CampaignID        uint64    `json:"campaign_id"`
-	TotalRecipients   int       `json:"total_recipients"`
-	SentCount         int       `json:"sent_count"`
-	DeliveredCount    int       `json:"delivered_count"`
-	FailedCount       int       `json:"failed_count"`
-	OpenedCount       int       `json:"opened_count"`
-	ClickedCount      int       `json:"clicked_count"`
-	BouncedCount      int       `json:"bounced_count"`
-	UnsubscribedCount int       `json:"unsubscribed_count"`
-	UniqueOpens       int       `json:"unique_opens"`
-	UniqueClicks      int       `json:"unique_clicks"`
-	OpenRate          float64   `json:"open_rate"`
-	ClickRate         float64   `json:"click_rate"`
+	CampaignID        uint64  `json:"campaign_id"`
+	TotalRecipients   int     `json:"total_recipients"`
+	SentCount         int     `json:"sent_count"`
+	DeliveredCount    int     `json:"delivered_count"`
+	FailedCount       int     `json:"failed_count"`
+	OpenedCount       int     `json:"opened_count"`
+	ClickedCount      int     `json:"clicked_count"`
+	BouncedCount      int     `json:"bounced_count"`
+	UnsubscribedCount int     `json:"unsubscribed_count"`
+	UniqueOpens       int     `json:"unique_opens"`
+	UniqueClicks      int     `json:"unique_clicks"`
+	OpenRate          float64 `json:"open_rate"`
+	ClickRate         float64 `json:"click_rate"`
+	// Machine-filtered figures leave out privacy-proxy prefetches and
+	// security-scanner hits.
+	HumanOpenedCount  int       `json:"human_opened_count"`
+	HumanClickedCount int       `json:"human_clicked_count"`
+	UniqueHumanOpens  int       `json:"unique_human_opens"`
+	UniqueHumanClicks int       `json:"unique_human_clicks"`
+	FilteredOpenRate  float64   `json:"filtered_open_rate"`
+	FilteredClickRate float64   `json:"filtered_click_rate"`
 	BounceRate        float64   `json:"bounce_rate"`
 	DeliveryRate      float64   `json:"delivery_rate"`
 	UnsubscribeRate   float64   `json:"unsubscribe_rate"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
 
+// CampaignLocaleStats is a campaign's delivery and engagement for the
+// recipients sent one locale.
+type CampaignLocaleStats struct {
+	Locale            string  `json:"locale"`
+	Recipients        int     `json:"recipients"`
+	SentCount         int     `json:"sent_count"`
+	DeliveredCount    int     `json:"delivered_count"`
+	OpenedCount       int     `json:"opened_count"`
+	ClickedCount      int     `json:"clicked_count"`
+	BouncedCount      int     `json:"bounced_count"`
+	UnsubscribedCount int     `json:"unsubscribed_count"`
+	OpenRate          float64 `json:"open_rate"`
+	ClickRate         float64 `json:"click_rate"`
+	BounceRate        float64 `json:"bounce_rate"`
+}
+
 type UpdateCampaignTagsRequest struct {
 	TagIDs []uint64 `json:"tag_ids" binding:"required"`
 }
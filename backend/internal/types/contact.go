@@ -13,6 +13,7 @@ type ContactDTO struct {
 	LastName        string          `json:"last_name"`
 	Phone           string          `json:"phone"`
 	Company         string          `json:"company"`
+	Locale          string          `json:"locale"`
 	IsSubscribed    bool            `json:"is_subscribed"`
 	IsBounced       bool            `json:"is_bounced"`
 	BounceCount     int             `json:"bounce_count"`
@@ -40,6 +41,7 @@ type CreateContactRequest struct {
 	LastName     string          `json:"last_name"`
 	Phone        string          `json:"phone"`
 	Company      string          `json:"company"`
+	Locale       string          `json:"locale"`
 	IsSubscribed bool            `json:"is_subscribed"`
 	CustomFields json.RawMessage `json:"custom_fields"`
 	TagIDs       []uint64        `json:"tag_ids"`
@@ -51,6 +53,7 @@ type UpdateContactRequest struct {
 	LastName     string          `json:"last_name"`
 	Phone        string          `json:"phone"`
 	Company      string          `json:"company"`
+	Locale       *string         `json:"locale"`
 	IsSubscribed *bool           `json:"is_subscribed"`
 	CustomFields json.RawMessage `json:"custom_fields"`
 	TagIDs       []uint64        `json:"tag_ids"`
@@ -72,10 +75,40 @@ type BulkDeleteContactsRequest struct {
 	ContactIDs []uint64 `json:"contact_ids" binding:"required,min=1"`
 }
 
-type ImportContactsRequest struct {
-	FileData       []byte            `json:"file_data" binding:"required"`
-	FieldMapping   map[string]string `json:"field_mapping"`
-	SkipDuplicates bool              `json:"skip_duplicates"`
+// ContactExportRow is a contact as exported. Tags are the contact's tag
+// names.
+type ContactExportRow struct {
+	ID           uint64
+	Email        string
+	FirstName    string
+	LastName     string
+	Phone        string
+	Company      string
+	Locale       string
+	IsSubscribed bool
+	IsBounced    bool
+	CustomFields map[string]interface{}
+	Tags         []string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// ExportContactsRequest selects the contacts to export, the columns and
+// the file format.
+type ExportContactsRequest struct {
+	Filter  ContactFilter
+	Format  string
+	Columns []string
+}
+
+// ContactExportFile is an export saved to the user's file storage.
+type ContactExportFile struct {
+	ID          string    `json:"id"`
+	Format      string    `json:"format"`
+	Rows        int       `json:"rows"`
+	Columns     []string  `json:"columns"`
+	DownloadURL string    `json:"download_url"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 type ContactActivityDTO struct {
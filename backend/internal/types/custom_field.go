@@ -0,0 +1,55 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The types a custom field's values can have. Dates are kept as
+// YYYY-MM-DD text; enum values are one of the field's options.
+const (
+	CustomFieldText   = "text"
+	CustomFieldNumber = "number"
+	CustomFieldDate   = "date"
+	CustomFieldBool   = "bool"
+	CustomFieldEnum   = "enum"
+)
+
+// CustomField defines a key of contacts' custom_fields. Values of defined
+// fields are checked and converted to the field's type when contacts are
+// written; other keys are kept as they are given.
+type CustomField struct {
+	ID        uint64      `json:"id"`
+	UserID    uint64      `json:"-"`
+	Key       string      `json:"key"`
+	Label     string      `json:"label"`
+	Type      string      `json:"type"`
+	Required  bool        `json:"required"`
+	Default   interface{} `json:"default"`
+	Options   []string    `json:"options,omitempty"`
+	SortOrder int         `json:"sort_order"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type CreateCustomFieldRequest struct {
+	UserID    uint64      `json:"-"`
+	Key       string      `json:"key" binding:"required"`
+	Label     string      `json:"label"`
+	Type      string      `json:"type"`
+	Required  bool        `json:"required"`
+	Default   interface{} `json:"default"`
+	Options   []string    `json:"options"`
+	SortOrder int         `json:"sort_order"`
+}
+
+// UpdateCustomFieldRequest changes the fields that are set; a default of
+// null removes the default. A field's key cannot be changed.
+type UpdateCustomFieldRequest struct {
+	Label     string          `json:"label"`
+	Type      string          `json:"type"`
+	Required  *bool           `json:"required"`
+	Default   json.RawMessage `json:"default"`
+	Options   []string        `json:"options"`
+	SortOrder *int            `json:"sort_order"`
+}
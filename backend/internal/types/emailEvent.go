@@ -1,35 +1,72 @@
 package types
 
 import (
+	"encoding/json"
 	"time"
 )
 
 type EmailEventDTO struct {
-	CampaignID uint64    `json:"campaign_id"`
-	ContactID  uint64    `json:"contact_id"`
-	EventType  string    `json:"event_type"`
-	EventAt    time.Time `json:"event_at"`
-	UserAgent  string    `json:"user_agent"`
-	IPAddress  string    `json:"ip_address"`
-	Url        string    `json:"url,omitempty"`
+	CampaignID          uint64    `json:"campaign_id"`
+	CampaignRecipientID uint64    `json:"campaign_recipient_id"`
+	LinkID              uint64    `json:"link_id,omitempty"`
+	EventType           string    `json:"event_type"`
+	Classification      string    `json:"classification,omitempty"` // human, proxy or scanner for opens and clicks
+	EventAt             time.Time `json:"event_at"`
+	UserAgent           string    `json:"user_agent"`
+	IPAddress           string    `json:"ip_address"`
+	Client              string    `json:"client,omitempty"`
+	OS                  string    `json:"os,omitempty"`
+	Device              string    `json:"device,omitempty"`
+	Country             string    `json:"country,omitempty"`
+	Url                 string    `json:"url,omitempty"`
 }
 
-type WebhookBounceRequest struct {
-	MessageID    string    `json:"message_id"`
-	Email        string    `json:"email"`
-	BounceType   string    `json:"bounce_type"`
-	BounceReason string    `json:"bounce_reason"`
-	Timestamp    time.Time `json:"timestamp"`
+// EventContext is what the open/click classifier needs to know about a
+// recipient beyond the tracking request itself.
+type EventContext struct {
+	CampaignID    uint64
+	SentAt        *time.Time
+	CampaignLinks int
+	RecentClicks  []LinkClick
 }
 
-type WebhookComplaintRequest struct {
-	MessageID string    `json:"message_id"`
-	Email     string    `json:"email"`
-	Timestamp time.Time `json:"timestamp"`
+type LinkClick struct {
+	LinkID uint64
+	At     time.Time
 }
 
-type WebhookDeliveryRequest struct {
-	MessageID string    `json:"message_id"`
-	Email     string    `json:"email"`
-	Timestamp time.Time `json:"timestamp"`
+// EngagementCounts splits a campaign's opens and clicks into everything
+// recorded and what is left after machine (proxy and scanner) events are
+// filtered out.
+type EngagementCounts struct {
+	UniqueOpens       int
+	UniqueClicks      int
+	HumanOpens        int
+	HumanClicks       int
+	UniqueHumanOpens  int
+	UniqueHumanClicks int
+}
+
+const (
+	DeliveryEventBounce    = "bounce"
+	DeliveryEventComplaint = "complaint"
+	DeliveryEventDelivery  = "delivery"
+
+	BounceTypeHard = "hard"
+	BounceTypeSoft = "soft"
+)
+
+// DeliveryEvent is the provider-neutral shape every webhook adapter and the
+// inbound bounce processor normalize their native payload into before it
+// reaches the campaign service.
+type DeliveryEvent struct {
+	Provider    string          `json:"provider"`
+	Type        string          `json:"type"` // bounce, complaint or delivery
+	Email       string          `json:"email"`
+	MessageID   string          `json:"message_id"`
+	RecipientID uint64          `json:"recipient_id,omitempty"` // decoded from a VERP return path
+	BounceType  string          `json:"bounce_type,omitempty"`  // hard or soft
+	Reason      string          `json:"reason,omitempty"`
+	Timestamp   time.Time       `json:"timestamp"`
+	Raw         json.RawMessage `json:"raw,omitempty"`
 }
@@ -19,6 +19,9 @@ type ContactFilter struct {
 	SortOrder    string        `json:"sort_order" form:"sort_order"`
 	JoinOperator string        `json:"join_operator" form:"join_operator"`
 	Filters      []FilterField `json:"filters" form:"filters"`
+	// CustomFields are the user's custom field definitions, which make
+	// "custom.<key>" filterable and sortable.
+	CustomFields []CustomField `json:"-" form:"-"`
 }
 
 type Filter struct {
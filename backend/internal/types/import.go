@@ -0,0 +1,175 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ImportJob is a run of an importer. Summary is what the importer
+// reported, which depends on its source. Jobs run in the background are
+// queued until a worker takes them and report their progress as they go.
+type ImportJob struct {
+	ID          uint64          `json:"id"`
+	UserID      uint64          `json:"-"`
+	Source      string          `json:"source"`
+	Status      string          `json:"status"`
+	Options     json.RawMessage `json:"options,omitempty"`
+	FileName    string          `json:"file_name,omitempty"`
+	FileKey     string          `json:"-"`
+	FileSize    int64           `json:"file_size,omitempty"`
+	RowsDone    int             `json:"rows_done"`
+	Progress    int             `json:"progress"`
+	Attempts    int             `json:"-"`
+	Summary     json.RawMessage `json:"summary,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	RejectedURL string          `json:"rejected_url,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportedContact is a contact an importer adds or merges into an
+// existing contact of the same email.
+type ImportedContact struct {
+	Email        string
+	FirstName    string
+	LastName     string
+	Phone        string
+	Company      string
+	Locale       string
+	IsSubscribed bool
+	IsBounced    bool
+	CustomFields map[string]interface{}
+	TagIDs       []uint64
+}
+
+// ImportOutcome is what an import did to a contact.
+type ImportOutcome string
+
+const (
+	ImportCreated   ImportOutcome = "created"
+	ImportUpdated   ImportOutcome = "updated"
+	ImportUnchanged ImportOutcome = "unchanged"
+)
+
+// ImportColumn is how an importer read a column. Key names the custom
+// field it fills.
+type ImportColumn struct {
+	Header string `json:"header"`
+	Kind   string `json:"kind"`
+	Key    string `json:"key,omitempty"`
+}
+
+// ImportRowError is a row an importer skipped.
+type ImportRowError struct {
+	File   string `json:"file"`
+	Row    int    `json:"row"`
+	Email  string `json:"email,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// What a contact import does with each row's email.
+const (
+	// ImportModeCreate adds new contacts and rejects rows for existing ones.
+	ImportModeCreate = "create"
+	// ImportModeUpsert adds new contacts and updates existing ones.
+	ImportModeUpsert = "upsert"
+	// ImportModeUpdate updates existing contacts and rejects the rest.
+	ImportModeUpdate = "update"
+)
+
+// ImportContactsRequest holds the options of a contact import. FieldMapping
+// maps contact fields, or "custom.<key>", to the file's headers. TagIDs
+// are added to every imported contact.
+type ImportContactsRequest struct {
+	Mode           string            `json:"mode"`
+	FieldMapping   map[string]string `json:"field_mapping,omitempty"`
+	TagIDs         []uint64          `json:"tag_ids,omitempty"`
+	IgnoreUnmapped bool              `json:"ignore_unmapped,omitempty"`
+}
+
+// ContactImportSummary reports a contact import so far. An import never
+// subscribes a contact who had unsubscribed or bounced.
+type ContactImportSummary struct {
+	Mode         string         `json:"mode"`
+	Rows         int            `json:"rows"`
+	Created      int            `json:"created"`
+	Updated      int            `json:"updated"`
+	Unchanged    int            `json:"unchanged"`
+	Rejected     int            `json:"rejected"`
+	TagsCreated  []string       `json:"tags_created"`
+	TagsAssigned int            `json:"tags_assigned"`
+	CustomFields []string       `json:"custom_fields"`
+	Columns      []ImportColumn `json:"columns"`
+}
+
+// ImportReject is a row an import rejected, as it was in the file.
+type ImportReject struct {
+	Row    int
+	Record []string
+	Reason string
+}
+
+type MailchimpImportRequest struct {
+	// Template is the HTML of a Mailchimp template, if one is imported.
+	Template     string
+	TemplateName string
+	// MergeFields maps merge tags to the column labels they fill.
+	MergeFields map[string]string
+	// GDPRFields names the marketing permission columns, if the audience
+	// uses others than Mailchimp's defaults.
+	GDPRFields []string
+	DryRun     bool
+}
+
+// MailchimpImportSummary reports a Mailchimp import. Members who are
+// unsubscribed, pending or did not give email permission are imported as
+// unsubscribed and cleaned members as bounced; an import never subscribes
+// a contact who had unsubscribed or bounced. In a dry run Updated counts
+// every member who is already a contact.
+type MailchimpImportSummary struct {
+	DryRun       bool                      `json:"dry_run"`
+	Files        []MailchimpImportFile     `json:"files"`
+	Rows         int                       `json:"rows"`
+	Created      int                       `json:"created"`
+	Updated      int                       `json:"updated"`
+	Unchanged    int                       `json:"unchanged"`
+	Skipped      int                       `json:"skipped"`
+	Statuses     map[string]int            `json:"statuses"`
+	NoConsent    int                       `json:"no_consent"`
+	Suppressed   int                       `json:"suppressed"`
+	TagsCreated  []string                  `json:"tags_created"`
+	TagsAssigned int                       `json:"tags_assigned"`
+	CustomFields []string                  `json:"custom_fields"`
+	SkippedRows  []ImportRowError          `json:"skipped_rows"`
+	Template     *MailchimpTemplateSummary `json:"template,omitempty"`
+}
+
+type MailchimpImportFile struct {
+	Name    string         `json:"name"`
+	Status  string         `json:"status"`
+	Rows    int            `json:"rows"`
+	Columns []ImportColumn `json:"columns"`
+}
+
+// MailchimpTemplateSummary reports the template conversion. Issues lists
+// the merge tags that were left as they were or only approximated.
+type MailchimpTemplateSummary struct {
+	Template  *TemplateDTO    `json:"template,omitempty"`
+	Converted int             `json:"converted"`
+	Issues    []MergeTagIssue `json:"issues"`
+	Error     string          `json:"error,omitempty"`
+}
+
+type MergeTagIssue struct {
+	Tag     string `json:"tag"`
+	Count   int    `json:"count"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,29 @@
+package types
+
+import "time"
+
+// CampaignLinkStats reports engagement with one tracked link of a campaign.
+type CampaignLinkStats struct {
+	ID             uint64     `json:"id"`
+	URL            string     `json:"url"`
+	Clicks         int        `json:"clicks"`
+	UniqueClickers int        `json:"unique_clickers"`
+	FirstClickedAt *time.Time `json:"first_clicked_at"`
+	LastClickedAt  *time.Time `json:"last_clicked_at"`
+}
+
+type LinkClickerDTO struct {
+	RecipientID    uint64    `json:"recipient_id"`
+	ContactID      uint64    `json:"contact_id"`
+	Email          string    `json:"email"`
+	FirstName      string    `json:"first_name"`
+	LastName       string    `json:"last_name"`
+	Clicks         int       `json:"clicks"`
+	FirstClickedAt time.Time `json:"first_clicked_at"`
+	LastClickedAt  time.Time `json:"last_clicked_at"`
+}
+
+type CampaignLinkDetail struct {
+	CampaignLinkStats
+	Clickers []LinkClickerDTO `json:"clickers"`
+}
@@ -0,0 +1,37 @@
+package types
+
+import "time"
+
+// MediaDTO is an uploaded image in a user's media library. Size counts
+// every stored variant, as that is what the quota is charged.
+type MediaDTO struct {
+	ID          uint64         `json:"id"`
+	UserID      uint64         `json:"-"`
+	Filename    string         `json:"filename"`
+	ContentType string         `json:"content_type"`
+	Width       int            `json:"width"`
+	Height      int            `json:"height"`
+	Size        int64          `json:"size"`
+	Provider    string         `json:"provider"`
+	URL         string         `json:"url"`
+	Variants    []MediaVariant `json:"variants"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// MediaVariant is one stored copy of an image: "original" or a width such
+// as "600". URL is the one recorded at upload and is refreshed on read
+// while the user still uses the same provider.
+type MediaVariant struct {
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+	URL    string `json:"url"`
+}
+
+type MediaUsage struct {
+	Plan  string `json:"plan"`
+	Used  int64  `json:"used"`
+	Quota int64  `json:"quota"`
+}
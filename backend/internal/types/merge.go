@@ -0,0 +1,70 @@
+package types
+
+// MergeData is what campaign content is rendered with. Contact is nil when
+// nothing personal may be shown, as in the public archive.
+type MergeData struct {
+	Contact        *MergeContact `json:"contact"`
+	Campaign       MergeCampaign `json:"campaign"`
+	Sender         MergeSender   `json:"sender"`
+	UnsubscribeURL string        `json:"unsubscribe_url"`
+	ViewOnlineURL  string        `json:"view_online_url"`
+}
+
+type MergeContact struct {
+	Email     string                 `json:"email"`
+	FirstName string                 `json:"first_name"`
+	LastName  string                 `json:"last_name"`
+	Phone     string                 `json:"phone"`
+	Company   string                 `json:"company"`
+	Custom    map[string]interface{} `json:"custom"`
+	Tags      []string               `json:"tags"`
+}
+
+type MergeCampaign struct {
+	ID      uint64 `json:"id"`
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+}
+
+type MergeSender struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	ReplyTo string `json:"reply_to"`
+}
+
+// RenderedMessage is a campaign merged for one recipient.
+type RenderedMessage struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// OutgoingMessage is a rendered message ready to send: MessageID goes in
+// its Message-ID header, ReturnPath is the envelope sender (MAIL FROM) and
+// UnsubscribeURL goes in List-Unsubscribe, with List-Unsubscribe-Post for
+// one-click unsubscribes.
+type OutgoingMessage struct {
+	RenderedMessage
+	MessageID      string `json:"message_id"`
+	ReturnPath     string `json:"return_path"`
+	UnsubscribeURL string `json:"unsubscribe_url"`
+}
+
+// CampaignContent is what every message of a campaign is rendered from.
+type CampaignContent struct {
+	ID           uint64
+	UserID       uint64
+	Name         string
+	Subject      string
+	FromName     string
+	FromEmail    string
+	ReplyToEmail string
+	TemplateType string
+	MJML         string
+	HTML         string
+	Text         string
+	// Locale is the translation the content is in; the template's own
+	// content counts as DefaultLocale.
+	Locale        string
+	DefaultLocale string
+}
@@ -12,6 +12,7 @@ type UserSettings struct {
 	DailySendLimit        int       `json:"daily_send_limit"`
 	MonthlySendLimit      int       `json:"monthly_send_limit"`
 	Timezone              string    `json:"timezone"`
+	DefaultLocale         string    `json:"default_locale"`
 	CreatedAt             time.Time `json:"created_at"`
 	UpdatedAt             time.Time `json:"updated_at"`
 
@@ -19,6 +20,7 @@ type UserSettings struct {
 	FileProvider        string `json:"file_provider"`
 	S3Bucket            string `json:"s3_bucket"`
 	S3Region            string `json:"s3_region"`
+	S3Endpoint          string `json:"s3_endpoint"`
 	S3AccessKey         string `json:"s3_access_key"`
 	S3SecretKey         string `json:"s3_secret_key"`
 	CloudinaryCloudName string `json:"cloudinary_cloud_name"`
@@ -42,10 +44,23 @@ type UserSettings struct {
 	PermittedFileExtensions string `json:"permitted_file_extensions"`
 	SMTPMaxConnections      int    `json:"smtp_max_connections"`
 	SMTPRetries             int    `json:"smtp_retries"`
+
+	// UTM Defaults
+	UTMEnabled  bool   `json:"utm_enabled"`
+	UTMSource   string `json:"utm_source"`
+	UTMMedium   string `json:"utm_medium"`
+	UTMCampaign string `json:"utm_campaign"`
+	UTMContent  string `json:"utm_content"`
+
+	// Public Archive
+	ArchiveEnabled bool   `json:"archive_enabled"`
+	ArchiveSlug    string `json:"archive_slug"`
+	ArchiveTitle   string `json:"archive_title"`
 }
 
 type UpdateSettingsRequest struct {
 	Timezone                string `json:"timezone"`
+	DefaultLocale           string `json:"default_locale"`
 	DefaultFromEmail        string `json:"default_from_email"`
 	AdminNotificationEmails string `json:"admin_notification_emails"`
 	Concurrency             int    `json:"concurrency"`
@@ -76,6 +91,7 @@ type UpdateFileSettingsRequest struct {
 	FileProvider            string `json:"file_provider" binding:"required,oneof=filesystem s3 cloudinary"`
 	S3Bucket                string `json:"s3_bucket"`
 	S3Region                string `json:"s3_region"`
+	S3Endpoint              string `json:"s3_endpoint"`
 	S3AccessKey             string `json:"s3_access_key"`
 	S3SecretKey             string `json:"s3_secret_key"`
 	S3BucketPath            string `json:"s3_bucket_path"`
@@ -1,6 +1,9 @@
 package types
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type TemplateDTO struct {
 	ID           uint64    `json:"id"`
@@ -13,8 +16,30 @@ type TemplateDTO struct {
 	TextContent  string    `json:"text_content"`
 	ThumbnailURL string    `json:"thumbnail_url"`
 	IsDefault    bool      `json:"is_default"`
+	Version      int       `json:"version"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	// Health is the outcome of the last lint; nil until one is run.
+	Health *TemplateHealth `json:"health,omitempty"`
+}
+
+// TemplateHealth sums up a lint report for badges. Stale is set once the
+// template has been edited since it was checked.
+type TemplateHealth struct {
+	Status    string    `json:"status"`
+	Errors    int       `json:"errors"`
+	Warnings  int       `json:"warnings"`
+	Stale     bool      `json:"stale"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// TemplateLintReport is a stored lint of the template at Version. Report
+// holds the findings, each with its severity, line and column.
+type TemplateLintReport struct {
+	TemplateID uint64 `json:"template_id"`
+	Version    int    `json:"version"`
+	TemplateHealth
+	Report json.RawMessage `json:"report"`
 }
 
 type CreateTemplateRequest struct {
@@ -23,7 +48,7 @@ type CreateTemplateRequest struct {
 	Subject      string `json:"subject" binding:"required"`
 	Type         string `json:"type" binding:"required"`
 	MJMLContent  string `json:"mjml_content"`
-	HTMLContent  string `json:"html_content" binding:"required"`
+	HTMLContent  string `json:"html_content"` // compiled from mjml_content for mjml templates
 	TextContent  string `json:"text_content"`
 	ThumbnailURL string `json:"thumbnail_url"`
 	IsDefault    bool   `json:"is_default"`
@@ -41,11 +66,116 @@ type UpdateTemplateRequest struct {
 	IsDefault    *bool  `json:"is_default"`
 }
 
+// PreviewTemplateRequest previews unsaved content. When mjml_content is set
+// it is compiled first and html_content is ignored. The merge fields
+// (contact, campaign, sender, unsubscribe_url, view_online_url) are sample
+// data to render the merge tags with. Inline shows html_content with its
+// CSS inlined, as it is sent.
 type PreviewTemplateRequest struct {
-	HTMLContent string                 `json:"html_content" binding:"required"`
-	Variables   map[string]interface{} `json:"variables"`
+	UserID      uint64 `json:"-"`
+	HTMLContent string `json:"html_content"`
+	MJMLContent string `json:"mjml_content"`
+	Inline      bool   `json:"inline"`
+	MergeData
+}
+
+// GenerateTextRequest optionally carries unsaved content to convert instead
+// of the saved template.
+type GenerateTextRequest struct {
+	HTMLContent string `json:"html_content"`
+	MJMLContent string `json:"mjml_content"`
+}
+
+type GenerateTextResponse struct {
+	TextContent string `json:"text_content"`
+}
+
+// TemplateLocaleDTO is a translation of a template. An empty subject
+// falls back to the campaign's subject; html_content is compiled from
+// mjml_content for mjml templates.
+type TemplateLocaleDTO struct {
+	TemplateID  uint64    `json:"template_id"`
+	Locale      string    `json:"locale"`
+	Subject     string    `json:"subject"`
+	MJMLContent string    `json:"mjml_content,omitempty"`
+	HTMLContent string    `json:"html_content,omitempty"`
+	TextContent string    `json:"text_content,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type SaveTemplateLocaleRequest struct {
+	Subject     string `json:"subject"`
+	MJMLContent string `json:"mjml_content"`
+	HTMLContent string `json:"html_content"`
+	TextContent string `json:"text_content"`
+}
+
+// TemplateVersionDTO is a saved state of a template. Versions are never
+// changed once written; content is left out of listings.
+type TemplateVersionDTO struct {
+	ID           uint64    `json:"id"`
+	TemplateID   uint64    `json:"template_id"`
+	Version      int       `json:"version"`
+	Name         string    `json:"name"`
+	Subject      string    `json:"subject"`
+	Type         string    `json:"type"`
+	MJMLContent  string    `json:"mjml_content,omitempty"`
+	HTMLContent  string    `json:"html_content,omitempty"`
+	TextContent  string    `json:"text_content,omitempty"`
+	CreatedBy    *uint64   `json:"created_by"`
+	AuthorName   string    `json:"author_name,omitempty"`
+	RestoredFrom *int      `json:"restored_from"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TemplateVersionDiff lists the fields that differ between two versions.
+type TemplateVersionDiff struct {
+	TemplateID uint64              `json:"template_id"`
+	From       int                 `json:"from"`
+	To         int                 `json:"to"`
+	Changes    []TemplateFieldDiff `json:"changes"`
+}
+
+type TemplateFieldDiff struct {
+	Field string     `json:"field"`
+	Hunks []DiffHunk `json:"hunks"`
+}
+
+// DiffHunk is a run of changed lines with unchanged lines around it, as in
+// a unified diff. Starts are 1-based line numbers.
+type DiffHunk struct {
+	OldStart int        `json:"old_start"`
+	OldLines int        `json:"old_lines"`
+	NewStart int        `json:"new_start"`
+	NewLines int        `json:"new_lines"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+// DiffLine is one line of a hunk. Op is "equal", "delete" or "insert".
+type DiffLine struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+}
+
+// TemplateStarter is a template in the built-in gallery.
+type TemplateStarter struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Subject     string `json:"subject"`
+	Type        string `json:"type"`
 }
 
-type UploadTemplateImageResponse struct {
-	URL string `json:"url"`
+// TemplateImportResult describes a template created from a bundle. Blocks
+// whose names the user already had are not imported; the template uses
+// the user's own blocks of those names.
+type TemplateImportResult struct {
+	Template      *TemplateDTO `json:"template"`
+	Images        int          `json:"images"`
+	Locales       int          `json:"locales"`
+	BlocksCreated []string     `json:"blocks_created"`
+	BlocksKept    []string     `json:"blocks_kept"`
 }
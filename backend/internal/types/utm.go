@@ -0,0 +1,37 @@
+package types
+
+// UTMSettings are the UTM parameters appended to tracked links. Values are
+// templates; see render.UTM for the placeholders.
+type UTMSettings struct {
+	Enabled  bool   `json:"enabled"`
+	Source   string `json:"source"`
+	Medium   string `json:"medium"`
+	Campaign string `json:"campaign"`
+	Content  string `json:"content"`
+}
+
+// CampaignUTM overrides the user's default UTM settings for one campaign.
+// A nil field inherits the default.
+type CampaignUTM struct {
+	Enabled  *bool   `json:"enabled"`
+	Source   *string `json:"source"`
+	Medium   *string `json:"medium"`
+	Campaign *string `json:"campaign"`
+	Content  *string `json:"content"`
+}
+
+type CampaignUTMResponse struct {
+	Overrides CampaignUTM `json:"overrides"`
+	Effective UTMSettings `json:"effective"`
+}
+
+type LinkPreview struct {
+	Position int    `json:"position"`
+	URL      string `json:"url"`
+	FinalURL string `json:"final_url"`
+}
+
+type LinkPreviewResponse struct {
+	UTM   UTMSettings   `json:"utm"`
+	Links []LinkPreview `json:"links"`
+}
@@ -0,0 +1,36 @@
+package types
+
+import "time"
+
+const (
+	WebhookProviderSES      = "ses"
+	WebhookProviderSendGrid = "sendgrid"
+	WebhookProviderMailgun  = "mailgun"
+	WebhookProviderPostmark = "postmark"
+)
+
+type WebhookEndpoint struct {
+	ID             uint64     `json:"id"`
+	UserID         uint64     `json:"user_id"`
+	Provider       string     `json:"provider"`
+	Token          string     `json:"token"`
+	SigningSecret  string     `json:"-"`
+	TopicArn       string     `json:"topic_arn,omitempty"`
+	IsActive       bool       `json:"is_active"`
+	URL            string     `json:"url,omitempty"`
+	LastReceivedAt *time.Time `json:"last_received_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// CreateWebhookEndpointRequest registers a provider callback URL. The signing
+// secret depends on the provider: the Mailgun HTTP webhook signing key, the
+// SendGrid verification public key (base64 DER), or the Postmark basic auth
+// password. SES endpoints are verified through SNS certificates and need none,
+// but take the ARN of the SNS topic they accept notifications from.
+type CreateWebhookEndpointRequest struct {
+	UserID        uint64 `json:"-"`
+	Provider      string `json:"provider" binding:"required,oneof=ses sendgrid mailgun postmark"`
+	SigningSecret string `json:"signing_secret"`
+	TopicArn      string `json:"topic_arn"`
+}
@@ -147,6 +147,21 @@ func (fb *FilterBuilder) buildRelativeDateFilter(dbColumn, relativeValue string)
 	return fmt.Sprintf("DATE(%s) = ?", dbColumn), []interface{}{targetDate}, nil
 }
 
+// CustomFieldColumn is the SQL expression for a custom field's value in a
+// JSON column, typed so filters and sorting compare it as the field's
+// type. An empty fieldType gives the value as text. The key must be a
+// valid custom field key, which needs no quoting in a JSON path.
+func CustomFieldColumn(column, key, fieldType string) string {
+	value := fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(%s, '$.%s'))", column, key)
+	switch fieldType {
+	case types.CustomFieldNumber:
+		return "CAST(" + value + " AS DECIMAL(65,10))"
+	case types.CustomFieldDate:
+		return "CAST(" + value + " AS DATE)"
+	}
+	return value + " COLLATE utf8mb4_unicode_ci"
+}
+
 func ParseIntDefault(val string, def int) int {
 	if v, err := strconv.Atoi(val); err == nil {
 		return v
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"email_campaign/internal/types"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrInvalidPayload is wrapped by Parse errors for requests that will
+	// never parse, as opposed to failures worth a retry.
+	ErrInvalidPayload  = errors.New("invalid webhook payload")
+	ErrUnknownProvider = errors.New("unknown webhook provider")
+)
+
+// Adapter verifies a provider callback and normalizes its native payload.
+// An adapter may return no events for messages that carry no delivery data,
+// such as SNS subscription confirmations.
+type Adapter interface {
+	Parse(r *http.Request, body []byte, endpoint *types.WebhookEndpoint) ([]types.DeliveryEvent, error)
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// adapters are shared by every request, so the SES adapter's certificate
+// cache outlives a single callback.
+var adapters = map[string]Adapter{
+	types.WebhookProviderSES:      newSESAdapter(httpClient),
+	types.WebhookProviderSendGrid: &sendGridAdapter{},
+	types.WebhookProviderMailgun:  &mailgunAdapter{},
+	types.WebhookProviderPostmark: &postmarkAdapter{},
+}
+
+// New returns the adapter for the given provider name.
+func New(provider string) (Adapter, error) {
+	a, ok := adapters[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, provider)
+	}
+	return a, nil
+}
+
+// RequiresSecret reports whether endpoints for the provider must be created
+// with a signing secret.
+func RequiresSecret(provider string) bool {
+	return provider != types.WebhookProviderSES
+}
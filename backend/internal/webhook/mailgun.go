@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"email_campaign/internal/types"
+)
+
+// mailgunMaxSkew rejects replays of old, correctly signed payloads.
+const mailgunMaxSkew = 15 * time.Minute
+
+type mailgunPayload struct {
+	Signature struct {
+		Timestamp string `json:"timestamp"`
+		Token     string `json:"token"`
+		Signature string `json:"signature"`
+	} `json:"signature"`
+	EventData struct {
+		Event     string  `json:"event"`
+		Severity  string  `json:"severity"`
+		Reason    string  `json:"reason"`
+		Recipient string  `json:"recipient"`
+		Timestamp float64 `json:"timestamp"`
+		Message   struct {
+			Headers struct {
+				MessageID string `json:"message-id"`
+			} `json:"headers"`
+		} `json:"message"`
+		DeliveryStatus struct {
+			Code        int    `json:"code"`
+			Message     string `json:"message"`
+			Description string `json:"description"`
+		} `json:"delivery-status"`
+	} `json:"event-data"`
+}
+
+// mailgunAdapter handles Mailgun webhooks, which carry an HMAC-SHA256 of the
+// timestamp and token keyed with the account's HTTP webhook signing key.
+type mailgunAdapter struct {
+	now func() time.Time
+}
+
+func (a *mailgunAdapter) Parse(r *http.Request, body []byte, endpoint *types.WebhookEndpoint) ([]types.DeliveryEvent, error) {
+	var p mailgunPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("%w: mailgun: %w", ErrInvalidPayload, err)
+	}
+
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	if err := verifyMailgun(endpoint.SigningSecret, p.Signature.Timestamp, p.Signature.Token, p.Signature.Signature, now()); err != nil {
+		return nil, err
+	}
+
+	data := p.EventData
+	sec, frac := math.Modf(data.Timestamp)
+	ev := types.DeliveryEvent{
+		Provider:  types.WebhookProviderMailgun,
+		Email:     data.Recipient,
+		MessageID: data.Message.Headers.MessageID,
+		Reason:    firstNonEmpty(data.DeliveryStatus.Description, data.DeliveryStatus.Message, data.Reason),
+		Timestamp: time.Unix(int64(sec), int64(frac*1e9)).UTC(),
+		Raw:       body,
+	}
+
+	switch data.Event {
+	case "failed":
+		ev.Type = types.DeliveryEventBounce
+		ev.BounceType = types.BounceTypeSoft
+		if data.Severity == "permanent" {
+			ev.BounceType = types.BounceTypeHard
+		}
+	case "complained":
+		ev.Type = types.DeliveryEventComplaint
+	case "delivered":
+		ev.Type = types.DeliveryEventDelivery
+	default:
+		return nil, nil
+	}
+	return []types.DeliveryEvent{ev}, nil
+}
+
+func verifyMailgun(key, timestamp, token, signature string, now time.Time) error {
+	if key == "" || timestamp == "" || token == "" || signature == "" {
+		return ErrInvalidSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > mailgunMaxSkew || d < -mailgunMaxSkew {
+		return fmt.Errorf("%w: stale timestamp", ErrInvalidSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp + token))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"email_campaign/internal/types"
+)
+
+type postmarkPayload struct {
+	RecordType  string            `json:"RecordType"`
+	Type        string            `json:"Type"`
+	MessageID   string            `json:"MessageID"`
+	Email       string            `json:"Email"`
+	Recipient   string            `json:"Recipient"`
+	Description string            `json:"Description"`
+	Details     string            `json:"Details"`
+	BouncedAt   time.Time         `json:"BouncedAt"`
+	DeliveredAt time.Time         `json:"DeliveredAt"`
+	Metadata    map[string]string `json:"Metadata"`
+}
+
+// postmarkAdapter handles Postmark webhooks. Postmark does not sign its
+// payloads, so the webhook URL is configured with basic auth credentials
+// and the password must match the endpoint secret.
+type postmarkAdapter struct{}
+
+func (a *postmarkAdapter) Parse(r *http.Request, body []byte, endpoint *types.WebhookEndpoint) ([]types.DeliveryEvent, error) {
+	_, password, ok := r.BasicAuth()
+	if !ok || endpoint.SigningSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(endpoint.SigningSecret)) != 1 {
+		return nil, ErrInvalidSignature
+	}
+
+	var p postmarkPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("%w: postmark: %w", ErrInvalidPayload, err)
+	}
+
+	ev := types.DeliveryEvent{
+		Provider: types.WebhookProviderPostmark,
+		Email:    firstNonEmpty(p.Email, p.Recipient),
+		// Postmark's MessageID is its own; our Message-ID travels as metadata.
+		MessageID: p.Metadata["message_id"],
+		Reason:    firstNonEmpty(p.Details, p.Description),
+		Raw:       body,
+	}
+
+	switch p.RecordType {
+	case "Bounce":
+		ev.Type = types.DeliveryEventBounce
+		ev.Timestamp = p.BouncedAt
+		switch p.Type {
+		case "HardBounce", "BadEmailAddress", "ManuallyDeactivated":
+			ev.BounceType = types.BounceTypeHard
+		case "SoftBounce", "Transient", "DnsError", "Blocked", "DMARCPolicy":
+			ev.BounceType = types.BounceTypeSoft
+		case "SpamComplaint":
+			ev.Type = types.DeliveryEventComplaint
+		default:
+			// Auto-responders, subscription changes and similar notices
+			// are reported as bounces but are not delivery failures.
+			return nil, nil
+		}
+	case "SpamComplaint":
+		ev.Type = types.DeliveryEventComplaint
+		ev.Timestamp = p.BouncedAt
+	case "Delivery":
+		ev.Type = types.DeliveryEventDelivery
+		ev.Timestamp = p.DeliveredAt
+	default:
+		return nil, nil
+	}
+	return []types.DeliveryEvent{ev}, nil
+}
@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"email_campaign/internal/types"
+)
+
+const (
+	sendGridSignatureHeader = "X-Twilio-Email-Event-Webhook-Signature"
+	sendGridTimestampHeader = "X-Twilio-Email-Event-Webhook-Timestamp"
+
+	// sendGridMaxSkew rejects replays of old, correctly signed payloads.
+	sendGridMaxSkew = 15 * time.Minute
+)
+
+type sendGridEvent struct {
+	Email       string `json:"email"`
+	Timestamp   int64  `json:"timestamp"`
+	Event       string `json:"event"`
+	Type        string `json:"type"`
+	Reason      string `json:"reason"`
+	Status      string `json:"status"`
+	SMTPID      string `json:"smtp-id"`
+	SGMessageID string `json:"sg_message_id"`
+}
+
+// sendGridAdapter handles the SendGrid Event Webhook. Requests are signed
+// with ECDSA over the timestamp header followed by the raw body, and the
+// endpoint secret holds the base64 DER public key shown in the SendGrid UI.
+type sendGridAdapter struct {
+	now func() time.Time
+}
+
+func (a *sendGridAdapter) Parse(r *http.Request, body []byte, endpoint *types.WebhookEndpoint) ([]types.DeliveryEvent, error) {
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	if err := verifySendGrid(endpoint.SigningSecret, r.Header.Get(sendGridTimestampHeader), r.Header.Get(sendGridSignatureHeader), body, now()); err != nil {
+		return nil, err
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("%w: sendgrid: %w", ErrInvalidPayload, err)
+	}
+
+	var events []types.DeliveryEvent
+	for _, item := range raw {
+		var e sendGridEvent
+		if err := json.Unmarshal(item, &e); err != nil {
+			return nil, fmt.Errorf("%w: sendgrid event: %w", ErrInvalidPayload, err)
+		}
+
+		ev := types.DeliveryEvent{
+			Provider:  types.WebhookProviderSendGrid,
+			Email:     e.Email,
+			MessageID: e.SMTPID,
+			Reason:    e.Reason,
+			Timestamp: time.Unix(e.Timestamp, 0).UTC(),
+			Raw:       item,
+		}
+
+		switch e.Event {
+		case "bounce":
+			ev.Type = types.DeliveryEventBounce
+			ev.BounceType = types.BounceTypeHard
+			if e.Type == "blocked" {
+				ev.BounceType = types.BounceTypeSoft
+			}
+		case "spamreport":
+			ev.Type = types.DeliveryEventComplaint
+		case "delivered":
+			ev.Type = types.DeliveryEventDelivery
+		default:
+			// processed, deferred, dropped and engagement events are not
+			// delivery outcomes we act on.
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+func verifySendGrid(publicKey, timestamp, signature string, body []byte, now time.Time) error {
+	if publicKey == "" || timestamp == "" || signature == "" {
+		return ErrInvalidSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > sendGridMaxSkew || d < -sendGridMaxSkew {
+		return fmt.Errorf("%w: stale timestamp", ErrInvalidSignature)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return fmt.Errorf("%w: malformed public key", ErrInvalidSignature)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return fmt.Errorf("%w: malformed public key", ErrInvalidSignature)
+	}
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: public key is not ECDSA", ErrInvalidSignature)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	digest := sha256.Sum256(append([]byte(timestamp), body...))
+	if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package webhook
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"email_campaign/internal/types"
+)
+
+// snsHostPattern limits certificate and subscription URLs to genuine SNS
+// endpoints so a forged message cannot point us at an attacker's key.
+var snsHostPattern = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// snsMaxAge rejects replays of old, correctly signed messages. SNS keeps a
+// message's Timestamp when it retries, and retry policies can run for an
+// hour, so the window is wider than the other providers'.
+const snsMaxAge = time.Hour
+
+type snsMessage struct {
+	Type             string `json:"Type"`
+	MessageId        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	SubscribeURL     string `json:"SubscribeURL"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+}
+
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Mail             struct {
+		MessageID     string `json:"messageId"`
+		CommonHeaders struct {
+			MessageID string `json:"messageId"`
+		} `json:"commonHeaders"`
+	} `json:"mail"`
+	Bounce *struct {
+		BounceType        string    `json:"bounceType"`
+		BounceSubType     string    `json:"bounceSubType"`
+		Timestamp         time.Time `json:"timestamp"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint *struct {
+		Timestamp             time.Time `json:"timestamp"`
+		ComplaintFeedbackType string    `json:"complaintFeedbackType"`
+		ComplainedRecipients  []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+	} `json:"complaint"`
+	Delivery *struct {
+		Timestamp  time.Time `json:"timestamp"`
+		Recipients []string  `json:"recipients"`
+	} `json:"delivery"`
+}
+
+type sesAdapter struct {
+	client    *http.Client
+	fetchCert func(certURL string) (*x509.Certificate, error)
+	now       func() time.Time
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+func newSESAdapter(client *http.Client) *sesAdapter {
+	a := &sesAdapter{client: client, now: time.Now, certs: make(map[string]*x509.Certificate)}
+	a.fetchCert = a.downloadCert
+	return a
+}
+
+func (a *sesAdapter) Parse(r *http.Request, body []byte, endpoint *types.WebhookEndpoint) ([]types.DeliveryEvent, error) {
+	var msg snsMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("%w: sns message: %w", ErrInvalidPayload, err)
+	}
+
+	// Any AWS account can sign a message for its own topic, so only the
+	// endpoint's topic is trusted, and never subscribed to otherwise.
+	if endpoint.TopicArn == "" || msg.TopicArn != endpoint.TopicArn {
+		return nil, fmt.Errorf("%w: message is not from the endpoint's topic", ErrInvalidSignature)
+	}
+	if err := a.verify(&msg); err != nil {
+		return nil, err
+	}
+	sent, err := time.Parse(time.RFC3339, msg.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed sns timestamp", ErrInvalidSignature)
+	}
+	if d := a.now().Sub(sent); d > snsMaxAge || d < -snsMaxAge {
+		return nil, fmt.Errorf("%w: stale timestamp", ErrInvalidSignature)
+	}
+
+	switch msg.Type {
+	case "SubscriptionConfirmation":
+		return nil, a.confirmSubscription(msg.SubscribeURL)
+	case "UnsubscribeConfirmation":
+		return nil, nil
+	case "Notification":
+		return parseSESNotification(msg.Message)
+	default:
+		return nil, fmt.Errorf("%w: unsupported sns message type %s", ErrInvalidPayload, msg.Type)
+	}
+}
+
+func (a *sesAdapter) verify(msg *snsMessage) error {
+	if err := validateSNSURL(msg.SigningCertURL); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(msg.SigningCertURL, ".pem") {
+		return ErrInvalidSignature
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	var hash crypto.Hash
+	var digest []byte
+	payload := []byte(snsStringToSign(msg))
+	switch msg.SignatureVersion {
+	case "1":
+		sum := sha1.Sum(payload)
+		hash, digest = crypto.SHA1, sum[:]
+	case "2":
+		sum := sha256.Sum256(payload)
+		hash, digest = crypto.SHA256, sum[:]
+	default:
+		return ErrInvalidSignature
+	}
+
+	a.mu.Lock()
+	cert, ok := a.certs[msg.SigningCertURL]
+	a.mu.Unlock()
+	if !ok {
+		cert, err = a.fetchCert(msg.SigningCertURL)
+		if err != nil {
+			return err
+		}
+		a.mu.Lock()
+		a.certs[msg.SigningCertURL] = cert
+		a.mu.Unlock()
+	}
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return ErrInvalidSignature
+	}
+	if err := rsa.VerifyPKCS1v15(pub, hash, digest, signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// snsStringToSign builds the canonical string SNS signs, which depends on
+// the message type.
+func snsStringToSign(msg *snsMessage) string {
+	var b strings.Builder
+	add := func(k, v string) {
+		b.WriteString(k)
+		b.WriteString("\n")
+		b.WriteString(v)
+		b.WriteString("\n")
+	}
+
+	add("Message", msg.Message)
+	add("MessageId", msg.MessageId)
+	if msg.Type == "Notification" {
+		if msg.Subject != "" {
+			add("Subject", msg.Subject)
+		}
+		add("Timestamp", msg.Timestamp)
+		add("TopicArn", msg.TopicArn)
+		add("Type", msg.Type)
+		return b.String()
+	}
+	add("SubscribeURL", msg.SubscribeURL)
+	add("Timestamp", msg.Timestamp)
+	add("Token", msg.Token)
+	add("TopicArn", msg.TopicArn)
+	add("Type", msg.Type)
+	return b.String()
+}
+
+func validateSNSURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || !snsHostPattern.MatchString(u.Hostname()) {
+		return fmt.Errorf("%w: untrusted sns url", ErrInvalidSignature)
+	}
+	return nil
+}
+
+func (a *sesAdapter) downloadCert(certURL string) (*x509.Certificate, error) {
+	resp, err := a.client.Get(certURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching signing certificate: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing certificate is not PEM encoded")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func (a *sesAdapter) confirmSubscription(subscribeURL string) error {
+	if err := validateSNSURL(subscribeURL); err != nil {
+		return err
+	}
+	resp, err := a.client.Get(subscribeURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("confirming sns subscription: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func parseSESNotification(message string) ([]types.DeliveryEvent, error) {
+	var n sesNotification
+	if err := json.Unmarshal([]byte(message), &n); err != nil {
+		return nil, fmt.Errorf("%w: ses notification: %w", ErrInvalidPayload, err)
+	}
+
+	messageID := n.Mail.CommonHeaders.MessageID
+	if messageID == "" {
+		messageID = n.Mail.MessageID
+	}
+
+	kind := n.NotificationType
+	if kind == "" {
+		kind = n.EventType
+	}
+
+	var events []types.DeliveryEvent
+	switch kind {
+	case "Bounce":
+		if n.Bounce == nil {
+			return nil, fmt.Errorf("%w: ses bounce notification without bounce data", ErrInvalidPayload)
+		}
+		bounceType := types.BounceTypeSoft
+		if n.Bounce.BounceType == "Permanent" {
+			bounceType = types.BounceTypeHard
+		}
+		for _, rcpt := range n.Bounce.BouncedRecipients {
+			events = append(events, types.DeliveryEvent{
+				Provider:   types.WebhookProviderSES,
+				Type:       types.DeliveryEventBounce,
+				Email:      rcpt.EmailAddress,
+				MessageID:  messageID,
+				BounceType: bounceType,
+				Reason:     firstNonEmpty(rcpt.DiagnosticCode, n.Bounce.BounceSubType),
+				Timestamp:  n.Bounce.Timestamp,
+				Raw:        json.RawMessage(message),
+			})
+		}
+	case "Complaint":
+		if n.Complaint == nil {
+			return nil, fmt.Errorf("%w: ses complaint notification without complaint data", ErrInvalidPayload)
+		}
+		for _, rcpt := range n.Complaint.ComplainedRecipients {
+			events = append(events, types.DeliveryEvent{
+				Provider:  types.WebhookProviderSES,
+				Type:      types.DeliveryEventComplaint,
+				Email:     rcpt.EmailAddress,
+				MessageID: messageID,
+				Reason:    n.Complaint.ComplaintFeedbackType,
+				Timestamp: n.Complaint.Timestamp,
+				Raw:       json.RawMessage(message),
+			})
+		}
+	case "Delivery":
+		if n.Delivery == nil {
+			return nil, fmt.Errorf("%w: ses delivery notification without delivery data", ErrInvalidPayload)
+		}
+		for _, rcpt := range n.Delivery.Recipients {
+			events = append(events, types.DeliveryEvent{
+				Provider:  types.WebhookProviderSES,
+				Type:      types.DeliveryEventDelivery,
+				Email:     rcpt,
+				MessageID: messageID,
+				Timestamp: n.Delivery.Timestamp,
+				Raw:       json.RawMessage(message),
+			})
+		}
+	}
+	return events, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
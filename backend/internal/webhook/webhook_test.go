@@ -0,0 +1,335 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"email_campaign/internal/types"
+)
+
+func loadFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("reading fixture %s: %v", name, err)
+	}
+	return data
+}
+
+// signSNS signs a recorded SNS envelope with a throwaway key and returns the
+// re-encoded body together with the matching certificate.
+func signSNS(t *testing.T, fixture []byte) ([]byte, *x509.Certificate) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg snsMessage
+	if err := json.Unmarshal(fixture, &msg); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum([]byte(snsStringToSign(&msg)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Signature = base64.StdEncoding.EncodeToString(sig)
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body, cert
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// sesEndpoint accepts the topic the SES fixtures were published to.
+var sesEndpoint = &types.WebhookEndpoint{TopicArn: "arn:aws:sns:us-east-1:123456789012:ses-feedback"}
+
+// sesFixtureTime is shortly after the SES fixtures were published.
+func sesFixtureTime() time.Time {
+	return time.Date(2026, 1, 12, 9, 20, 0, 0, time.UTC)
+}
+
+func TestSESBounce(t *testing.T) {
+	body, cert := signSNS(t, loadFixture(t, "ses_bounce.json"))
+
+	a := newSESAdapter(http.DefaultClient)
+	a.fetchCert = func(string) (*x509.Certificate, error) { return cert, nil }
+	a.now = sesFixtureTime
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	events, err := a.Parse(req, body, sesEndpoint)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+
+	ev := events[0]
+	if ev.Type != types.DeliveryEventBounce || ev.BounceType != types.BounceTypeHard {
+		t.Errorf("got %s/%s, want bounce/hard", ev.Type, ev.BounceType)
+	}
+	if ev.Email != "jane@example.com" {
+		t.Errorf("email = %q", ev.Email)
+	}
+	if ev.MessageID != "<42.7.1736673260@acme.test>" {
+		t.Errorf("message id = %q", ev.MessageID)
+	}
+
+	tampered := bytes.Replace(body, []byte("Permanent"), []byte("Transient"), 1)
+	if _, err := a.Parse(req, tampered, sesEndpoint); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered message: got %v, want ErrInvalidSignature", err)
+	}
+
+	a.now = func() time.Time { return sesFixtureTime().Add(2 * time.Hour) }
+	if _, err := a.Parse(req, body, sesEndpoint); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("replayed message: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestSESRejectsForeignCertURL(t *testing.T) {
+	var msg snsMessage
+	if err := json.Unmarshal(loadFixture(t, "ses_bounce.json"), &msg); err != nil {
+		t.Fatal(err)
+	}
+	msg.SigningCertURL = "https://sns.us-east-1.amazonaws.com.evil.test/cert.pem"
+	body, _ := json.Marshal(msg)
+
+	a := newSESAdapter(http.DefaultClient)
+	a.fetchCert = func(string) (*x509.Certificate, error) {
+		t.Fatal("certificate should not be fetched")
+		return nil, nil
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	if _, err := a.Parse(req, body, sesEndpoint); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestSESSubscriptionConfirmation(t *testing.T) {
+	body, cert := signSNS(t, loadFixture(t, "ses_subscription.json"))
+
+	var confirmed string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		confirmed = r.URL.String()
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+	})}
+
+	a := newSESAdapter(client)
+	a.fetchCert = func(string) (*x509.Certificate, error) { return cert, nil }
+	a.now = sesFixtureTime
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	events, err := a.Parse(req, body, sesEndpoint)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("got %d events, want 0", len(events))
+	}
+	if confirmed == "" {
+		t.Error("subscription was not confirmed")
+	}
+}
+
+func TestSESRejectsOtherTopics(t *testing.T) {
+	var msg snsMessage
+	if err := json.Unmarshal(loadFixture(t, "ses_subscription.json"), &msg); err != nil {
+		t.Fatal(err)
+	}
+	msg.TopicArn = "arn:aws:sns:us-east-1:999999999999:attacker"
+	fixture, _ := json.Marshal(msg)
+	body, cert := signSNS(t, fixture)
+
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t.Error("subscription to another topic was confirmed")
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+	})}
+	a := newSESAdapter(client)
+	a.fetchCert = func(string) (*x509.Certificate, error) { return cert, nil }
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	for _, endpoint := range []*types.WebhookEndpoint{sesEndpoint, {}} {
+		if _, err := a.Parse(req, body, endpoint); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("topic %q: got %v, want ErrInvalidSignature", endpoint.TopicArn, err)
+		}
+	}
+}
+
+func TestSendGridEvents(t *testing.T) {
+	body := loadFixture(t, "sendgrid_events.json")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := &types.WebhookEndpoint{SigningSecret: base64.StdEncoding.EncodeToString(der)}
+
+	timestamp := "1736673305"
+	digest := sha256.Sum256(append([]byte(timestamp), body...))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set(sendGridTimestampHeader, timestamp)
+	req.Header.Set(sendGridSignatureHeader, base64.StdEncoding.EncodeToString(sig))
+
+	a := &sendGridAdapter{now: func() time.Time { return time.Unix(1736673305, 0).Add(time.Minute) }}
+	events, err := a.Parse(req, body, endpoint)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := []struct{ typ, bounce, email string }{
+		{types.DeliveryEventDelivery, "", "jane@example.com"},
+		{types.DeliveryEventBounce, types.BounceTypeHard, "bob@example.com"},
+		{types.DeliveryEventBounce, types.BounceTypeSoft, "carol@example.com"},
+		{types.DeliveryEventComplaint, "", "dave@example.com"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		ev := events[i]
+		if ev.Type != w.typ || ev.BounceType != w.bounce || ev.Email != w.email {
+			t.Errorf("event %d = %s/%s/%s, want %s/%s/%s", i, ev.Type, ev.BounceType, ev.Email, w.typ, w.bounce, w.email)
+		}
+	}
+
+	req.Header.Set(sendGridTimestampHeader, "1736673306")
+	if _, err := a.Parse(req, body, endpoint); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong timestamp: got %v, want ErrInvalidSignature", err)
+	}
+
+	req.Header.Set(sendGridTimestampHeader, timestamp)
+	a.now = func() time.Time { return time.Unix(1736673305, 0).Add(time.Hour) }
+	if _, err := a.Parse(req, body, endpoint); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("replayed payload: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestMailgunFailed(t *testing.T) {
+	body := loadFixture(t, "mailgun_failed.json")
+	endpoint := &types.WebhookEndpoint{SigningSecret: "key-mailgun-test-signing"}
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+
+	a := &mailgunAdapter{now: func() time.Time { return time.Unix(1736673300, 0) }}
+	events, err := a.Parse(req, body, endpoint)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	ev := events[0]
+	if ev.Type != types.DeliveryEventBounce || ev.BounceType != types.BounceTypeHard {
+		t.Errorf("got %s/%s, want bounce/hard", ev.Type, ev.BounceType)
+	}
+	if ev.MessageID != "42.7.1736673260@acme.test" {
+		t.Errorf("message id = %q", ev.MessageID)
+	}
+
+	a.now = func() time.Time { return time.Unix(1736673270, 0).Add(time.Hour) }
+	if _, err := a.Parse(req, body, endpoint); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("replayed payload: got %v, want ErrInvalidSignature", err)
+	}
+
+	a.now = func() time.Time { return time.Unix(1736673300, 0) }
+	endpoint.SigningSecret = "some-other-key"
+	if _, err := a.Parse(req, body, endpoint); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong key: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestPostmarkBounce(t *testing.T) {
+	body := loadFixture(t, "postmark_bounce.json")
+	endpoint := &types.WebhookEndpoint{SigningSecret: "s3cret"}
+	a := &postmarkAdapter{}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.SetBasicAuth("postmark", "s3cret")
+	events, err := a.Parse(req, body, endpoint)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	ev := events[0]
+	if ev.Type != types.DeliveryEventBounce || ev.BounceType != types.BounceTypeHard {
+		t.Errorf("got %s/%s, want bounce/hard", ev.Type, ev.BounceType)
+	}
+	if ev.MessageID != "<42.7.1736673260@acme.test>" || ev.Email != "jane@example.com" {
+		t.Errorf("got %q for %q", ev.MessageID, ev.Email)
+	}
+
+	req.SetBasicAuth("postmark", "guess")
+	if _, err := a.Parse(req, body, endpoint); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong password: got %v, want ErrInvalidSignature", err)
+	}
+
+	req.SetBasicAuth("postmark", "s3cret")
+	if _, err := a.Parse(req, []byte("{"), endpoint); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("truncated body: got %v, want ErrInvalidPayload", err)
+	}
+}
+
+func TestNewSharesAdapters(t *testing.T) {
+	a, err := New(types.WebhookProviderSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := New(types.WebhookProviderSES)
+	if a != b {
+		t.Error("each call built a new SES adapter, losing its certificate cache")
+	}
+	if _, err := New("sparkpost"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("unknown provider: got %v", err)
+	}
+}
@@ -50,5 +50,5 @@ func SetupTestServer(t *testing.T) (*http.Server, sqlmock.Sqlmock, func()) {
 		db.Close()
 	}
 
-	return srv, mock, teardown
+	return srv.Server, mock, teardown
 }
@@ -17,6 +17,7 @@ export default function FileSettings({ initialSettings, onSave }: FileSettingsPr
     const [s3Settings, setS3Settings] = useState({
         bucket: initialSettings?.s3_bucket || "",
         region: initialSettings?.s3_region || "",
+        endpoint: initialSettings?.s3_endpoint || "",
         accessKey: initialSettings?.s3_access_key || "",
         secretKey: initialSettings?.s3_secret_key || "",
         bucketPath: initialSettings?.s3_bucket_path || "",
@@ -36,6 +37,7 @@ export default function FileSettings({ initialSettings, onSave }: FileSettingsPr
             setS3Settings({
                 bucket: initialSettings.s3_bucket || "",
                 region: initialSettings.s3_region || "",
+                endpoint: initialSettings.s3_endpoint || "",
                 accessKey: initialSettings.s3_access_key || "",
                 secretKey: initialSettings.s3_secret_key || "",
                 bucketPath: initialSettings.s3_bucket_path || "",
@@ -56,6 +58,7 @@ export default function FileSettings({ initialSettings, onSave }: FileSettingsPr
             file_provider: provider,
             s3_bucket: s3Settings.bucket,
             s3_region: s3Settings.region,
+            s3_endpoint: s3Settings.endpoint,
             s3_access_key: s3Settings.accessKey,
             s3_secret_key: s3Settings.secretKey,
             s3_bucket_path: s3Settings.bucketPath,
@@ -145,6 +148,18 @@ export default function FileSettings({ initialSettings, onSave }: FileSettingsPr
                                 />
                             </div>
                         </div>
+                        <div className="space-y-2">
+                            <Label htmlFor="s3_endpoint">Custom Endpoint (Optional)</Label>
+                            <Input
+                                id="s3_endpoint"
+                                value={s3Settings.endpoint}
+                                onChange={(e) => setS3Settings({ ...s3Settings, endpoint: e.target.value })}
+                                placeholder="https://minio.example.com"
+                            />
+                            <p className="text-xs text-muted-foreground">
+                                For S3-compatible services. Leave empty for AWS S3.
+                            </p>
+                        </div>
                         <div className="grid grid-cols-2 gap-4">
                             <div className="space-y-2">
                                 <Label htmlFor="s3_path">Bucket Path (Prefix)</Label>
@@ -36,14 +36,30 @@ const API_PATH = {
         BULK_CREATE_CONTACTS: '/api/v1/contacts/bulk',
         BULK_UPDATE_CONTACTS: '/api/v1/contacts/bulk/update',
         BULK_DELETE_CONTACTS: '/api/v1/contacts/bulk/delete',
-        IMPORT_CONTACTS_CSV: '/api/v1/contacts/import/csv',
-        EXPORT_CONTACTS_CSV: '/api/v1/contacts/export/csv',
+        IMPORT_CONTACTS: '/api/v1/contacts/import',
+        EXPORT_CONTACTS: '/api/v1/contacts/export',
+        DOWNLOAD_CONTACT_EXPORT: '/api/v1/contacts/exports/:id',
         GET_CONTACT_BY_EMAIL: '/api/v1/contacts/email/:email',
         GET_CONTACT_ACTIVITY: '/api/v1/contacts/:id/activity',
         SUBSCRIBE_CONTACT: '/api/v1/contacts/:id/subscribe',
         UNSUBSCRIBE_CONTACT: '/api/v1/contacts/:id/unsubscribe',
     },
 
+    CUSTOM_FIELDS: {
+        LIST_CUSTOM_FIELDS: '/api/v1/custom-fields',
+        CREATE_CUSTOM_FIELD: '/api/v1/custom-fields',
+        GET_CUSTOM_FIELD: '/api/v1/custom-fields/:id',
+        UPDATE_CUSTOM_FIELD: '/api/v1/custom-fields/:id',
+        DELETE_CUSTOM_FIELD: '/api/v1/custom-fields/:id',
+    },
+
+    IMPORTS: {
+        IMPORT_MAILCHIMP: '/api/v1/imports/mailchimp',
+        LIST_IMPORT_JOBS: '/api/v1/imports',
+        GET_IMPORT_JOB: '/api/v1/imports/:id',
+        DOWNLOAD_IMPORT_REJECTS: '/api/v1/imports/:id/rejected',
+    },
+
     TAGS: {
         LIST_TAGS: '/api/v1/tags',
         CREATE_TAG: '/api/v1/tags',
@@ -70,9 +86,35 @@ const API_PATH = {
         DUPLICATE_TEMPLATE: '/api/v1/templates/:id/duplicate',
         SET_DEFAULT_TEMPLATE: '/api/v1/templates/:id/set-default',
         PREVIEW_TEMPLATE: '/api/v1/templates/:id/preview',
+        LIST_TEMPLATE_LOCALES: '/api/v1/templates/:id/locales',
+        GET_TEMPLATE_LOCALE: '/api/v1/templates/:id/locales/:locale',
+        SAVE_TEMPLATE_LOCALE: '/api/v1/templates/:id/locales/:locale',
+        DELETE_TEMPLATE_LOCALE: '/api/v1/templates/:id/locales/:locale',
+        LINT_TEMPLATE: '/api/v1/templates/:id/lint',
+        GET_TEMPLATE_LINT: '/api/v1/templates/:id/lint',
+        EXPORT_TEMPLATE: '/api/v1/templates/:id/export',
+        IMPORT_TEMPLATE: '/api/v1/templates/import',
+        LIST_TEMPLATE_STARTERS: '/api/v1/templates/gallery',
+        CLONE_TEMPLATE_STARTER: '/api/v1/templates/gallery/:slug/clone',
         UPLOAD_TEMPLATE_IMAGE: '/api/v1/templates/upload/image',
     },
 
+    BLOCKS: {
+        LIST_BLOCKS: '/api/v1/blocks',
+        CREATE_BLOCK: '/api/v1/blocks',
+        GET_BLOCK: '/api/v1/blocks/:id',
+        UPDATE_BLOCK: '/api/v1/blocks/:id',
+        DELETE_BLOCK: '/api/v1/blocks/:id',
+        GET_BLOCK_USAGE: '/api/v1/blocks/:id/usage',
+    },
+
+    MEDIA: {
+        LIST_MEDIA: '/api/v1/media',
+        UPLOAD_MEDIA: '/api/v1/media',
+        GET_MEDIA_USAGE: '/api/v1/media/usage',
+        DELETE_MEDIA: '/api/v1/media/:id',
+    },
+
     CAMPAIGNS: {
         LIST_CAMPAIGNS: '/api/v1/campaigns',
         CREATE_CAMPAIGN: '/api/v1/campaigns',
@@ -86,6 +128,7 @@ const API_PATH = {
         RESUME_CAMPAIGN: '/api/v1/campaigns/:id/resume',
         CANCEL_CAMPAIGN: '/api/v1/campaigns/:id/cancel',
         GET_CAMPAIGN_STATS: '/api/v1/campaigns/:id/stats',
+        GET_CAMPAIGN_LOCALE_STATS: '/api/v1/campaigns/:id/stats/locales',
         GET_CAMPAIGN_RECIPIENTS: '/api/v1/campaigns/:id/recipients',
         SEND_TEST_EMAIL: '/api/v1/campaigns/:id/test',
         PREVIEW_CAMPAIGN: '/api/v1/campaigns/:id/preview',
@@ -11,6 +11,7 @@ export interface Campaign {
     id: number;
     user_id: number;
     template_id?: number;
+    template_version?: number | null;
     template_name?: string;
     name: string;
     subject: string;
@@ -64,3 +65,17 @@ export interface CampaignStats {
     unsubscribe_rate: number;
     updated_at: string;
 }
+
+export interface CampaignLocaleStats {
+    locale: string;
+    recipients: number;
+    sent_count: number;
+    delivered_count: number;
+    opened_count: number;
+    clicked_count: number;
+    bounced_count: number;
+    unsubscribed_count: number;
+    open_rate: number;
+    click_rate: number;
+    bounce_rate: number;
+}
@@ -6,6 +6,7 @@ export const createContactSchema = z.object({
     last_name: z.string().optional(),
     phone: z.string().optional(),
     company: z.string().optional(),
+    locale: z.string().optional(),
     is_subscribed: z.boolean().optional(),
     custom_fields: z.any().optional(),
     tag_ids: z.array(z.number()).optional(),
@@ -28,4 +29,29 @@ export const contactSchema = z.object({
     tag_ids: z.array(z.number()).optional(),
 })
 
-export type Contact = z.infer<typeof contactSchema>;
\ No newline at end of file
+export type Contact = z.infer<typeof contactSchema>;
+export type ContactExportFormat = 'csv' | 'xlsx' | 'ndjson';
+
+export interface ContactExportFile {
+    id: string;
+    format: ContactExportFormat;
+    rows: number;
+    columns: string[];
+    download_url: string;
+    created_at: string;
+}
+
+export type CustomFieldType = 'text' | 'number' | 'date' | 'bool' | 'enum';
+
+export interface CustomField {
+    id: number;
+    key: string;
+    label: string;
+    type: CustomFieldType;
+    required: boolean;
+    default: string | number | boolean | null;
+    options?: string[];
+    sort_order: number;
+    created_at: string;
+    updated_at: string;
+}
@@ -0,0 +1,87 @@
+import { Template } from './template';
+
+export interface ImportJob {
+    id: number;
+    source: 'contacts' | 'mailchimp';
+    status: 'queued' | 'running' | 'completed' | 'failed';
+    options?: ImportContactsOptions;
+    file_name?: string;
+    file_size?: number;
+    rows_done: number;
+    progress: number;
+    summary?: MailchimpImportSummary | ContactImportSummary;
+    error?: string;
+    rejected_url?: string;
+    created_at: string;
+    updated_at: string;
+    finished_at?: string;
+}
+
+export type ImportMode = 'create' | 'upsert' | 'update';
+
+export interface ImportContactsOptions {
+    mode: ImportMode;
+    field_mapping?: Record<string, string>;
+    tag_ids?: number[];
+    ignore_unmapped?: boolean;
+}
+
+export interface ContactImportSummary {
+    mode: ImportMode;
+    rows: number;
+    created: number;
+    updated: number;
+    unchanged: number;
+    rejected: number;
+    tags_created: string[];
+    tags_assigned: number;
+    custom_fields: string[];
+    columns: ImportColumn[];
+}
+
+export interface ImportColumn {
+    header: string;
+    kind: string;
+    key?: string;
+}
+
+export interface ImportRowError {
+    file: string;
+    row: number;
+    email?: string;
+    reason: string;
+}
+
+export interface MergeTagIssue {
+    tag: string;
+    count: number;
+    message: string;
+}
+
+export interface MailchimpImportSummary {
+    dry_run: boolean;
+    files: { name: string; status: string; rows: number; columns: ImportColumn[] }[];
+    rows: number;
+    created: number;
+    updated: number;
+    unchanged: number;
+    skipped: number;
+    statuses: Record<string, number>;
+    no_consent: number;
+    suppressed: number;
+    tags_created: string[];
+    tags_assigned: number;
+    custom_fields: string[];
+    skipped_rows: ImportRowError[];
+    template?: {
+        template?: Template;
+        converted: number;
+        issues: MergeTagIssue[];
+        error?: string;
+    };
+}
+
+export interface MailchimpImportResult {
+    job: ImportJob | null;
+    summary: MailchimpImportSummary;
+}
@@ -9,8 +9,43 @@ export interface Template {
     text_content?: string;
     thumbnail_url?: string;
     is_default: boolean;
+    version: number;
     created_at: string;
     updated_at: string;
+    health?: TemplateHealth;
+}
+
+export type LintSeverity = 'error' | 'warning' | 'info';
+
+export interface TemplateHealth {
+    status: 'ok' | 'warning' | 'error';
+    errors: number;
+    warnings: number;
+    stale: boolean;
+    checked_at: string;
+}
+
+export interface LintFinding {
+    rule: string;
+    severity: LintSeverity;
+    message: string;
+    line?: number;
+    column?: number;
+    count?: number;
+}
+
+export interface TemplateLintReport extends TemplateHealth {
+    template_id: number;
+    version: number;
+    report: {
+        status: 'ok' | 'warning' | 'error';
+        errors: number;
+        warnings: number;
+        size: number;
+        text_length: number;
+        images: number;
+        findings: LintFinding[];
+    };
 }
 
 export interface CreateTemplateRequest {
@@ -35,9 +70,25 @@ export interface UpdateTemplateRequest {
     is_default?: boolean;
 }
 
+export interface MergeContact {
+    email?: string;
+    first_name?: string;
+    last_name?: string;
+    phone?: string;
+    company?: string;
+    custom?: Record<string, any>;
+    tags?: string[];
+}
+
 export interface PreviewTemplateRequest {
-    html_content: string;
-    variables?: Record<string, any>;
+    html_content?: string;
+    mjml_content?: string;
+    inline?: boolean;
+    contact?: MergeContact;
+    campaign?: { id?: number; name?: string; subject?: string };
+    sender?: { name?: string; email?: string; reply_to?: string };
+    unsubscribe_url?: string;
+    view_online_url?: string;
 }
 
 export interface TemplateListResponse {
@@ -46,3 +97,120 @@ export interface TemplateListResponse {
     limit: number;
     total: number;
 }
+
+export interface TemplateVersion {
+    id: number;
+    template_id: number;
+    version: number;
+    name: string;
+    subject: string;
+    type: 'mjml' | 'html';
+    mjml_content?: string;
+    html_content?: string;
+    text_content?: string;
+    created_by: number | null;
+    author_name?: string;
+    restored_from: number | null;
+    created_at: string;
+}
+
+export interface TemplateVersionListResponse {
+    data: TemplateVersion[];
+    page: number;
+    limit: number;
+    total: number;
+}
+
+export interface TemplateLocale {
+    template_id: number;
+    locale: string;
+    subject: string;
+    mjml_content?: string;
+    html_content?: string;
+    text_content?: string;
+    created_at: string;
+    updated_at: string;
+}
+
+export interface DiffLine {
+    op: 'equal' | 'delete' | 'insert';
+    text: string;
+    old_line?: number;
+    new_line?: number;
+}
+
+export interface DiffHunk {
+    old_start: number;
+    old_lines: number;
+    new_start: number;
+    new_lines: number;
+    lines: DiffLine[];
+}
+
+export interface TemplateVersionDiff {
+    template_id: number;
+    from: number;
+    to: number;
+    changes: { field: string; hunks: DiffHunk[] }[];
+}
+
+export interface MediaVariant {
+    name: string;
+    key: string;
+    width: number;
+    height: number;
+    size: number;
+    url: string;
+}
+
+export interface Media {
+    id: number;
+    filename: string;
+    content_type: string;
+    width: number;
+    height: number;
+    size: number;
+    provider: string;
+    url: string;
+    variants: MediaVariant[];
+    created_at: string;
+}
+
+export interface MediaUsage {
+    plan: string;
+    used: number;
+    quota: number;
+}
+
+export interface ContentBlock {
+    id: number;
+    name: string;
+    description: string;
+    type: 'html' | 'mjml';
+    content: string;
+    created_at: string;
+    updated_at: string;
+}
+
+export interface ContentBlockUsage {
+    block_id: number;
+    name: string;
+    templates: { id: number; name: string; type: 'mjml' | 'html'; indirect: boolean }[];
+    campaigns: { id: number; name: string; status: string; template_id: number; frozen: boolean }[];
+}
+
+export interface TemplateStarter {
+    slug: string;
+    name: string;
+    description: string;
+    subject: string;
+    type: 'mjml' | 'html';
+}
+
+export interface TemplateImportResult {
+    template: Template;
+    images: number;
+    locales: number;
+    blocks_created: string[];
+    blocks_kept: string[];
+}